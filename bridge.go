@@ -2,23 +2,34 @@ package main
 
 /*
 #include <stdlib.h>
+
+// wa_log_callback receives every log line: level is 0 (debug) to 3 (error)
+typedef void (*wa_log_callback)(int level, const char *module, const char *message);
+
+static inline void wa_call_log_callback(wa_log_callback cb, int level, const char *module, const char *message) {
+	cb(level, module, message);
+}
 */
 import "C"
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
 
+	"github.com/jo-inc/wa_meow/internal/core"
 	_ "github.com/mattn/go-sqlite3"
 	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -28,8 +39,28 @@ var (
 	mu             sync.Mutex
 	qrCodeChannel  chan string
 	loginDone      chan bool
+	messageDB      *sql.DB // live and history-synced messages, next to the session in dbPath
+)
+
+const (
+	defaultMessageLimit = 50
+	maxMessageLimit     = 500
 )
 
+const messageSchema = `
+CREATE TABLE IF NOT EXISTS bridge_messages (
+	chat_jid    TEXT    NOT NULL,
+	id          TEXT    NOT NULL,
+	sender_jid  TEXT    NOT NULL,
+	sender_name TEXT    NOT NULL DEFAULT '',
+	text        TEXT    NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	is_from_me  INTEGER NOT NULL,
+	PRIMARY KEY (chat_jid, id)
+);
+CREATE INDEX IF NOT EXISTS bridge_messages_chat_timestamp ON bridge_messages (chat_jid, timestamp);
+`
+
 type ChatJSON struct {
 	JID      string `json:"jid"`
 	Name     string `json:"name"`
@@ -37,43 +68,42 @@ type ChatJSON struct {
 	LastSeen int64  `json:"last_seen,omitempty"`
 }
 
-type MessageJSON struct {
-	ID        string `json:"id"`
-	ChatJID   string `json:"chat_jid"`
-	SenderJID string `json:"sender_jid"`
-	SenderName string `json:"sender_name"`
-	Text      string `json:"text"`
-	Timestamp int64  `json:"timestamp"`
-	IsFromMe  bool   `json:"is_from_me"`
-}
-
-type EventJSON struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
+type ContactJSON struct {
+	JID          string `json:"jid"`
+	Name         string `json:"name"`
+	PushName     string `json:"push_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
 }
 
 //export WhatsAppInit
-func WhatsAppInit(dbPath *C.char) *C.char {
+func WhatsAppInit(dbPath *C.char) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
 	mu.Lock()
 	defer mu.Unlock()
 
 	ctx := context.Background()
 	dbPathGo := C.GoString(dbPath)
 	
-	dbLog := waLog.Stdout("Database", "ERROR", true)
 	var err error
-	container, err = sqlstore.New(ctx, "sqlite3", "file:"+dbPathGo+"?_foreign_keys=on", dbLog)
+	container, err = core.OpenSQLite(ctx, dbPathGo, callbackLogger{module: "Database"})
 	if err != nil {
 		return C.CString(`{"error":"` + err.Error() + `"}`)
 	}
 
-	deviceStore, err := container.GetFirstDevice(ctx)
+	messageDB, err = sql.Open("sqlite3", "file:"+dbPathGo+"?_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
 		return C.CString(`{"error":"` + err.Error() + `"}`)
 	}
+	if _, err := messageDB.Exec(messageSchema); err != nil {
+		return C.CString(`{"error":"failed to create message store: ` + err.Error() + `"}`)
+	}
 
-	clientLog := waLog.Stdout("Client", "ERROR", true)
-	client = whatsmeow.NewClient(deviceStore, clientLog)
+	client, err = core.NewClient(ctx, container, callbackLogger{module: "Client"})
+	if err != nil {
+		return C.CString(`{"error":"` + err.Error() + `"}`)
+	}
 	client.AddEventHandler(handleEvent)
 
 	qrCodeChannel = make(chan string, 10)
@@ -83,7 +113,9 @@ func WhatsAppInit(dbPath *C.char) *C.char {
 }
 
 //export WhatsAppConnect
-func WhatsAppConnect() *C.char {
+func WhatsAppConnect() (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -121,7 +153,9 @@ func WhatsAppConnect() *C.char {
 }
 
 //export WhatsAppGetQRCode
-func WhatsAppGetQRCode(timeoutMs C.int) *C.char {
+func WhatsAppGetQRCode(timeoutMs C.int) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
 	select {
 	case code := <-qrCodeChannel:
 		return C.CString(`{"qr_code":"` + code + `"}`)
@@ -133,7 +167,9 @@ func WhatsAppGetQRCode(timeoutMs C.int) *C.char {
 }
 
 //export WhatsAppIsConnected
-func WhatsAppIsConnected() C.int {
+func WhatsAppIsConnected() (connected C.int) {
+	defer recoverQuietly()
+
 	if client != nil && client.IsConnected() {
 		return 1
 	}
@@ -141,7 +177,9 @@ func WhatsAppIsConnected() C.int {
 }
 
 //export WhatsAppIsLoggedIn
-func WhatsAppIsLoggedIn() C.int {
+func WhatsAppIsLoggedIn() (loggedIn C.int) {
+	defer recoverQuietly()
+
 	if client != nil && client.IsLoggedIn() {
 		return 1
 	}
@@ -149,7 +187,9 @@ func WhatsAppIsLoggedIn() C.int {
 }
 
 //export WhatsAppGetChats
-func WhatsAppGetChats() *C.char {
+func WhatsAppGetChats() (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
 	if client == nil {
 		return C.CString(`{"error":"not initialized"}`)
 	}
@@ -190,26 +230,124 @@ func WhatsAppGetChats() *C.char {
 	return C.CString(string(jsonData))
 }
 
-//export WhatsAppSendMessage
-func WhatsAppSendMessage(jidStr *C.char, text *C.char) *C.char {
+//export WhatsAppGetContacts
+func WhatsAppGetContacts() (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
 	if client == nil {
 		return C.CString(`{"error":"not initialized"}`)
 	}
 
-	jid, err := types.ParseJID(C.GoString(jidStr))
+	contacts, err := client.Store.Contacts.GetAllContacts(context.Background())
+	if err != nil {
+		return C.CString(`{"error":"` + err.Error() + `"}`)
+	}
+
+	result := make([]ContactJSON, 0, len(contacts))
+	for jid, contact := range contacts {
+		name := contact.FullName
+		if name == "" {
+			name = contact.PushName
+		}
+		if name == "" {
+			name = contact.BusinessName
+		}
+		if name == "" {
+			name = jid.User
+		}
+		result = append(result, ContactJSON{
+			JID:          jid.String(),
+			Name:         name,
+			PushName:     contact.PushName,
+			FullName:     contact.FullName,
+			BusinessName: contact.BusinessName,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	jsonData, _ := json.Marshal(result)
+	return C.CString(string(jsonData))
+}
+
+// WhatsAppGetMessages returns the latest limit stored messages of a chat, oldest first.
+// A limit of 0 or less means the default of 50.
+//
+//export WhatsAppGetMessages
+func WhatsAppGetMessages(chatJID *C.char, limit C.int) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
+	if messageDB == nil {
+		return C.CString(`{"error":"not initialized"}`)
+	}
+
+	jid, err := types.ParseJID(C.GoString(chatJID))
 	if err != nil {
 		return C.CString(`{"error":"invalid jid: ` + err.Error() + `"}`)
 	}
+	n := int(limit)
+	if n <= 0 {
+		n = defaultMessageLimit
+	} else if n > maxMessageLimit {
+		n = maxMessageLimit
+	}
+
+	rows, err := messageDB.Query(`SELECT id, chat_jid, sender_jid, sender_name, text, timestamp, is_from_me
+		FROM bridge_messages WHERE chat_jid = ? ORDER BY timestamp DESC, rowid DESC LIMIT ?`, jid.String(), n)
+	if err != nil {
+		return C.CString(`{"error":"` + err.Error() + `"}`)
+	}
+	defer rows.Close()
+
+	messages := []core.MessagePayload{}
+	for rows.Next() {
+		var msg core.MessagePayload
+		if err := rows.Scan(&msg.ID, &msg.ChatJID, &msg.SenderJID, &msg.SenderName, &msg.Text, &msg.Timestamp, &msg.IsFromMe); err != nil {
+			return C.CString(`{"error":"` + err.Error() + `"}`)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return C.CString(`{"error":"` + err.Error() + `"}`)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	jsonData, _ := json.Marshal(messages)
+	return C.CString(string(jsonData))
+}
 
-	msg := &waE2E.Message{
-		Conversation: proto.String(C.GoString(text)),
+//export WhatsAppSendMessage
+func WhatsAppSendMessage(jidStr *C.char, text *C.char) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
+	if client == nil {
+		return C.CString(`{"error":"not initialized"}`)
 	}
 
-	resp, err := client.SendMessage(context.Background(), jid, msg)
+	jid, err := types.ParseJID(C.GoString(jidStr))
+	if err != nil {
+		return C.CString(`{"error":"invalid jid: ` + err.Error() + `"}`)
+	}
+
+	resp, err := client.SendMessage(context.Background(), jid, core.TextMessage(C.GoString(text)))
 	if err != nil {
 		return C.CString(`{"error":"` + err.Error() + `"}`)
 	}
 
+	sender := ""
+	if client.Store.ID != nil {
+		sender = client.Store.ID.ToNonAD().String()
+	}
+	saveMessage(core.MessagePayload{
+		ID:        resp.ID,
+		ChatJID:   jid.String(),
+		SenderJID: sender,
+		Text:      C.GoString(text),
+		Timestamp: resp.Timestamp.Unix(),
+		IsFromMe:  true,
+	})
+
 	result := map[string]interface{}{
 		"id":        resp.ID,
 		"timestamp": resp.Timestamp.Unix(),
@@ -218,8 +356,93 @@ func WhatsAppSendMessage(jidStr *C.char, text *C.char) *C.char {
 	return C.CString(string(jsonData))
 }
 
+// WhatsAppSendTyping shows (on != 0) or clears the typing indicator in a chat
+//
+//export WhatsAppSendTyping
+func WhatsAppSendTyping(jidStr *C.char, on C.int) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
+	if client == nil {
+		return C.CString(`{"error":"not initialized"}`)
+	}
+
+	jid, err := types.ParseJID(C.GoString(jidStr))
+	if err != nil {
+		return C.CString(`{"error":"invalid jid: ` + err.Error() + `"}`)
+	}
+
+	presence := types.ChatPresencePaused
+	if on != 0 {
+		presence = types.ChatPresenceComposing
+	}
+	if err := client.SendChatPresence(context.Background(), jid, presence, types.ChatPresenceMediaText); err != nil {
+		return C.CString(`{"error":"` + err.Error() + `"}`)
+	}
+	return C.CString(`{"status":"ok"}`)
+}
+
+// WhatsAppMarkRead sends read receipts for messages in a chat, given as a JSON array of
+// message IDs. In groups each receipt names the message's sender, which is looked up in
+// the message store; unknown messages are marked read without one.
+//
+//export WhatsAppMarkRead
+func WhatsAppMarkRead(jidStr *C.char, messageIDsJSON *C.char) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
+	if client == nil {
+		return C.CString(`{"error":"not initialized"}`)
+	}
+
+	jid, err := types.ParseJID(C.GoString(jidStr))
+	if err != nil {
+		return C.CString(`{"error":"invalid jid: ` + err.Error() + `"}`)
+	}
+	var ids []types.MessageID
+	if err := json.Unmarshal([]byte(C.GoString(messageIDsJSON)), &ids); err != nil {
+		return C.CString(`{"error":"invalid message ids: ` + err.Error() + `"}`)
+	}
+	if len(ids) == 0 {
+		return C.CString(`{"error":"message ids required"}`)
+	}
+
+	// One receipt per sender
+	bySender := make(map[types.JID][]types.MessageID)
+	for _, id := range ids {
+		sender := types.EmptyJID
+		if jid.Server == types.GroupServer {
+			sender = messageSender(jid, id)
+		}
+		bySender[sender] = append(bySender[sender], id)
+	}
+	for sender, senderIDs := range bySender {
+		if err := client.MarkRead(context.Background(), senderIDs, time.Now(), jid, sender); err != nil {
+			return C.CString(`{"error":"` + err.Error() + `"}`)
+		}
+	}
+	return C.CString(`{"status":"ok"}`)
+}
+
+// messageSender looks up who sent a stored message, or returns an empty JID
+func messageSender(chat types.JID, id types.MessageID) types.JID {
+	if messageDB == nil {
+		return types.EmptyJID
+	}
+	var raw string
+	err := messageDB.QueryRow(`SELECT sender_jid FROM bridge_messages WHERE chat_jid = ? AND id = ?`, chat.String(), id).Scan(&raw)
+	if err != nil {
+		return types.EmptyJID
+	}
+	sender, err := types.ParseJID(raw)
+	if err != nil {
+		return types.EmptyJID
+	}
+	return sender
+}
+
 //export WhatsAppDisconnect
 func WhatsAppDisconnect() {
+	defer recoverQuietly()
+
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -230,6 +453,8 @@ func WhatsAppDisconnect() {
 
 //export WhatsAppFreeString
 func WhatsAppFreeString(str *C.char) {
+	defer recoverQuietly()
+
 	C.free(unsafe.Pointer(str))
 }
 
@@ -237,38 +462,182 @@ var messageCallback unsafe.Pointer
 
 //export WhatsAppSetMessageCallback
 func WhatsAppSetMessageCallback(callback unsafe.Pointer) {
+	defer recoverQuietly()
+
 	messageCallback = callback
 }
 
+// Log levels as passed to the log callback
+const (
+	logDebug = iota
+	logInfo
+	logWarn
+	logError
+)
+
+var logLevels = map[string]int{"DEBUG": logDebug, "INFO": logInfo, "WARN": logWarn, "ERROR": logError}
+
+// logSink is where log lines go: stdout until the host sets a callback
+var logSink struct {
+	sync.RWMutex
+	callback C.wa_log_callback
+	minLevel int
+}
+
+func init() {
+	logSink.minLevel = logError
+}
+
+// callbackLogger is the waLog.Logger given to whatsmeow. It looks the sink up on every
+// line, so loggers created before the host sets a callback follow it too.
+type callbackLogger struct {
+	module string
+}
+
+var bridgeLog waLog.Logger = callbackLogger{module: "Bridge"}
+
+func (l callbackLogger) log(level int, levelName, msg string, args []interface{}) {
+	logSink.RLock()
+	callback, minLevel := logSink.callback, logSink.minLevel
+	logSink.RUnlock()
+	if level < minLevel {
+		return
+	}
+	line := fmt.Sprintf(msg, args...)
+	if callback == nil {
+		fmt.Printf("%s [%s %s] %s\n", time.Now().Format("15:04:05.000"), l.module, levelName, line)
+		return
+	}
+	module := C.CString(l.module)
+	message := C.CString(line)
+	C.wa_call_log_callback(callback, C.int(level), module, message)
+	C.free(unsafe.Pointer(module))
+	C.free(unsafe.Pointer(message))
+}
+
+func (l callbackLogger) Debugf(msg string, args ...interface{}) { l.log(logDebug, "DEBUG", msg, args) }
+func (l callbackLogger) Infof(msg string, args ...interface{})  { l.log(logInfo, "INFO", msg, args) }
+func (l callbackLogger) Warnf(msg string, args ...interface{})  { l.log(logWarn, "WARN", msg, args) }
+func (l callbackLogger) Errorf(msg string, args ...interface{}) { l.log(logError, "ERROR", msg, args) }
+
+func (l callbackLogger) Sub(module string) waLog.Logger {
+	return callbackLogger{module: l.module + "/" + module}
+}
+
+// WhatsAppSetLogCallback routes the bridge's and whatsmeow's logs to callback instead
+// of stdout. minLevel is DEBUG, INFO, WARN or ERROR (the default); pass a NULL callback
+// to go back to stdout. The strings passed to callback are freed when it returns.
+//
+//export WhatsAppSetLogCallback
+func WhatsAppSetLogCallback(callback C.wa_log_callback, minLevel *C.char) (jsonResult *C.char) {
+	defer recoverToError(&jsonResult)
+
+	level := logError
+	if name := strings.ToUpper(C.GoString(minLevel)); name != "" {
+		var ok bool
+		if level, ok = logLevels[name]; !ok {
+			return C.CString(`{"error":"unknown log level ` + name + `"}`)
+		}
+	}
+
+	logSink.Lock()
+	defer logSink.Unlock()
+	logSink.callback = callback
+	logSink.minLevel = level
+	return C.CString(`{"status":"ok"}`)
+}
+
+// recoverToError is deferred first thing in every export that returns JSON: a panic
+// must not unwind into the host, which would abort its whole process, so it's logged
+// and returned as an error instead
+func recoverToError(result **C.char) {
+	if p := recover(); p != nil {
+		msg, _ := json.Marshal(map[string]string{"error": panicMessage(p)})
+		*result = C.CString(string(msg))
+	}
+}
+
+// recoverQuietly is recoverToError for exports without a JSON result; they return
+// their zero value
+func recoverQuietly() {
+	if p := recover(); p != nil {
+		panicMessage(p)
+	}
+}
+
+// panicMessage logs a recovered panic with its stack and describes it for the caller
+func panicMessage(p interface{}) string {
+	bridgeLog.Errorf("Recovered from panic: %v\n%s", p, debug.Stack())
+	return fmt.Sprintf("internal error: %v", p)
+}
+
 func main() {}
 
+// saveMessage keeps a text message for WhatsAppGetMessages
+func saveMessage(msg core.MessagePayload) {
+	if messageDB == nil || msg.Text == "" {
+		return
+	}
+	_, err := messageDB.Exec(`INSERT OR REPLACE INTO bridge_messages
+		(chat_jid, id, sender_jid, sender_name, text, timestamp, is_from_me) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		msg.ChatJID, msg.ID, msg.SenderJID, msg.SenderName, msg.Text, msg.Timestamp, msg.IsFromMe)
+	if err != nil {
+		bridgeLog.Errorf("Failed to store message %s: %v", msg.ID, err)
+	}
+}
+
+// saveHistory stores the text messages of a history sync, so chats have history from
+// before the bridge was linked
+func saveHistory(evt *events.HistorySync) {
+	for _, conv := range evt.Data.GetConversations() {
+		chatJID, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			continue
+		}
+		for _, histMsg := range conv.GetMessages() {
+			parsed, err := client.ParseWebMessage(chatJID, histMsg.GetMessage())
+			if err != nil {
+				continue
+			}
+			msg, _ := core.NewMessagePayload(core.ParseMessage(parsed))
+			saveMessage(msg)
+		}
+	}
+}
+
 func handleEvent(evt interface{}) {
 	switch v := evt.(type) {
+	case *events.HistorySync:
+		saveHistory(v)
+
 	case *events.Message:
-		text := ""
-		if v.Message.Conversation != nil {
-			text = *v.Message.Conversation
-		} else if v.Message.ExtendedTextMessage != nil && v.Message.ExtendedTextMessage.Text != nil {
-			text = *v.Message.ExtendedTextMessage.Text
+		msg, hasContent := core.NewMessagePayload(core.ParseMessage(v))
+		if !hasContent {
+			return
 		}
+		saveMessage(msg)
+		emitEvent(msg)
 
-		msg := MessageJSON{
-			ID:         v.Info.ID,
-			ChatJID:    v.Info.Chat.String(),
-			SenderJID:  v.Info.Sender.String(),
-			SenderName: v.Info.PushName,
-			Text:       text,
-			Timestamp:  v.Info.Timestamp.Unix(),
-			IsFromMe:   v.Info.IsFromMe,
+	case *events.Receipt:
+		if receipt, ok := core.NewReceiptPayload(v); ok {
+			emitEvent(receipt)
 		}
 
-		jsonData, _ := json.Marshal(EventJSON{
-			Type:    "message",
-			Payload: msg,
-		})
+	case *events.Presence:
+		emitEvent(core.NewPresencePayload(v))
 
-		if eventCallback != nil {
-			eventCallback(string(jsonData))
+	case *events.GroupInfo:
+		if update, ok := core.NewGroupUpdatePayload(v); ok {
+			emitEvent(update)
 		}
 	}
 }
+
+// emitEvent passes an event to the host's callback, in the same JSON the server sends
+func emitEvent(payload core.Payload) {
+	if eventCallback == nil {
+		return
+	}
+	jsonData, _ := json.Marshal(core.NewEvent(payload))
+	eventCallback(string(jsonData))
+}
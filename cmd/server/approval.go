@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ApprovalSetting is whether a session's outgoing messages wait for someone to approve
+// them. Turning it off leaves sends already pending pending.
+type ApprovalSetting struct {
+	persistedSetting[approvalConfig]
+}
+
+type approvalConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Enabled reports whether sends are held for approval
+func (a *ApprovalSetting) Enabled() bool {
+	return a.Get().Enabled
+}
+
+// pendingSend is a message held until it's approved or rejected
+type pendingSend struct {
+	ID        types.MessageID // the ID it goes out with once approved
+	To        types.JID
+	Message   *waE2E.Message
+	Extra     whatsmeow.SendRequestExtra
+	CreatedAt time.Time
+}
+
+// payload describes the held message to whoever reviews it
+func (p *pendingSend) payload() ApprovalPayload {
+	msg := p.Message
+	// view-once media is wrapped; the reviewer sees what's inside
+	if inner := msg.GetViewOnceMessageV2().GetMessage(); inner != nil {
+		msg = inner
+	} else if inner := msg.GetViewOnceMessageV2Extension().GetMessage(); inner != nil {
+		msg = inner
+	}
+	payload := ApprovalPayload{
+		ID:        p.ID,
+		ChatJID:   p.To.String(),
+		Text:      core.Text(msg),
+		CreatedAt: p.CreatedAt.Unix(),
+	}
+	if media := core.MediaOf(msg); media != nil {
+		payload.MediaType, payload.Text = media.Kind, media.Caption
+	}
+	return payload
+}
+
+// ApprovalPayload is the payload of the send_pending, send_approved and send_rejected
+// events, and an entry of the pending list
+type ApprovalPayload struct {
+	ID        string `json:"id"` // the message ID, the same once it's sent
+	ChatJID   string `json:"chat_jid"`
+	Text      string `json:"text,omitempty"` // text or caption
+	MediaType string `json:"media_type,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	Timestamp int64  `json:"timestamp,omitempty"` // send_approved: when it was sent
+	Reason    string `json:"reason,omitempty"`    // send_rejected
+}
+
+// PendingSends holds a session's sends awaiting approval, in memory only: pending sends
+// don't survive a restart. The zero value is ready to use.
+type PendingSends struct {
+	mu    sync.Mutex
+	items map[types.MessageID]*pendingSend
+}
+
+func (p *PendingSends) add(send *pendingSend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.items == nil {
+		p.items = make(map[types.MessageID]*pendingSend)
+	}
+	p.items[send.ID] = send
+}
+
+// take removes and returns a pending send, so two reviewers can't both act on it
+func (p *PendingSends) take(id types.MessageID) *pendingSend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	send := p.items[id]
+	delete(p.items, id)
+	return send
+}
+
+// List returns the pending sends, oldest first
+func (p *PendingSends) List() []ApprovalPayload {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]ApprovalPayload, 0, len(p.items))
+	for _, send := range p.items {
+		list = append(list, send.payload())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// PendingApprovalError is returned instead of sending while approval mode is on. The
+// message is held under ID until it's approved or rejected.
+type PendingApprovalError struct {
+	ID types.MessageID
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("message %s is awaiting approval", e.ID)
+}
+
+type approvedSendKey struct{}
+
+// withApprovedSend marks a send as approved, so it goes out instead of being held again
+func withApprovedSend(ctx context.Context) context.Context {
+	return context.WithValue(ctx, approvedSendKey{}, true)
+}
+
+func isApprovedSend(ctx context.Context) bool {
+	approved, _ := ctx.Value(approvedSendKey{}).(bool)
+	return approved
+}
+
+// holdForApproval queues a send and announces it with a send_pending event
+func (s *UserSession) holdForApproval(to types.JID, message *waE2E.Message, extra []whatsmeow.SendRequestExtra) error {
+	send := &pendingSend{To: to, Message: message, CreatedAt: time.Now()}
+	if len(extra) > 0 {
+		send.Extra = extra[0]
+	}
+	if send.Extra.ID == "" {
+		send.Extra.ID = newMessageID()
+	}
+	send.ID = send.Extra.ID
+	s.Pending.add(send)
+	log.Printf("[approval] User %d: holding message %s to %s for approval", s.UserID, send.ID, to)
+	s.emit(MessageEvent{Type: "send_pending", Payload: send.payload()})
+	return &PendingApprovalError{ID: send.ID}
+}
+
+// approvalSettingHandler reads (GET) or sets (POST) whether a session's sends need approval
+func approvalSettingHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[approvalConfig]{
+		name:    "approval setting",
+		setting: func(s *UserSession) settingStore[approvalConfig] { return &s.Approval },
+	})
+}
+
+// listApprovalsHandler lists a session's sends awaiting approval
+func listApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"pending": session.Pending.List()})
+}
+
+// approveSendHandler sends a held message. If it fails before anything went out, it
+// stays pending so it can be approved again.
+func approveSendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		ID     string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	send := session.Pending.take(req.ID)
+	if send == nil {
+		errorResponse(w, http.StatusNotFound, "no pending message with that id")
+		return
+	}
+
+	resp, err := session.Client.SendMessage(withApprovedSend(r.Context()), send.To, send.Message, send.Extra)
+	if err != nil {
+		if classifySendError(err).RetrySafe {
+			session.Pending.add(send)
+		} else {
+			// Whoever sent it was only told it's pending
+			session.emitSendFailed("approval", send.ID, send.To, send.ID, err)
+		}
+		sendErrorResponse(w, err)
+		return
+	}
+
+	log.Printf("[approval] User %d: message %s to %s approved and sent", session.UserID, send.ID, send.To)
+	payload := send.payload()
+	payload.Timestamp = resp.Timestamp.Unix()
+	session.emit(MessageEvent{Type: "send_approved", Payload: payload})
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
+
+// rejectSendHandler drops a held message without sending it
+func rejectSendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	send := session.Pending.take(req.ID)
+	if send == nil {
+		errorResponse(w, http.StatusNotFound, "no pending message with that id")
+		return
+	}
+
+	log.Printf("[approval] User %d: message %s to %s rejected", session.UserID, send.ID, send.To)
+	session.Duplicates.forget(send.ID)
+	payload := send.payload()
+	payload.Reason = req.Reason
+	session.emit(MessageEvent{Type: "send_rejected", Payload: payload})
+	jsonResponse(w, map[string]interface{}{"id": send.ID, "status": "rejected"})
+}
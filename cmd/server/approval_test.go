@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+func TestApprovalMode(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Client = &pacedClient{WhatsAppClient: mock, session: session}
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body)))
+		return w
+	}
+	nextEvent := func() MessageEvent {
+		select {
+		case evt := <-session.EventChan:
+			return evt
+		default:
+			t.Fatal("expected an event")
+			return MessageEvent{}
+		}
+	}
+
+	if w := post(approvalSettingHandler, `{"user_id": 1, "enabled": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var held []string
+	for _, text := range []string{"first", "second"} {
+		w := post(sendMessageHandler, `{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "`+text+`"}`)
+		var resp struct{ ID, Status string }
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusAccepted || resp.Status != "pending" || resp.ID == "" {
+			t.Fatalf("expected 202 pending with an id, got %d %+v", w.Code, resp)
+		}
+		if evt := nextEvent(); evt.Type != "send_pending" || evt.Payload.(ApprovalPayload).Text != text {
+			t.Errorf("expected a send_pending event for %q, got %+v", text, evt)
+		}
+		held = append(held, resp.ID)
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 0 {
+		t.Fatalf("expected nothing sent before approval, got %d sends", len(calls))
+	}
+
+	w := httptest.NewRecorder()
+	listApprovalsHandler(w, httptest.NewRequest(http.MethodGet, "/admin/approvals?user_id=1", nil))
+	var list struct{ Pending []ApprovalPayload }
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Pending) != 2 {
+		t.Errorf("expected two pending sends, got %+v", list.Pending)
+	}
+
+	// Approved: it goes out under the ID the sender was given
+	if w := post(approveSendHandler, `{"user_id": 1, "id": "`+held[0]+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	calls := mock.GetCallsByMethod("SendMessage")
+	if len(calls) != 1 || calls[0].Args[3].([]whatsmeow.SendRequestExtra)[0].ID != held[0] {
+		t.Errorf("expected the approved message sent with its id, got %+v", calls)
+	}
+	if evt := nextEvent(); evt.Type != "send_approved" || evt.Payload.(ApprovalPayload).ID != held[0] {
+		t.Errorf("expected send_approved, got %+v", evt)
+	}
+
+	// Rejected: dropped unsent
+	if w := post(rejectSendHandler, `{"user_id": 1, "id": "`+held[1]+`", "reason": "off-brand"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if evt := nextEvent(); evt.Type != "send_rejected" || evt.Payload.(ApprovalPayload).Reason != "off-brand" {
+		t.Errorf("expected send_rejected with the reason, got %+v", evt)
+	}
+	if w := post(approveSendHandler, `{"user_id": 1, "id": "`+held[1]+`"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a rejected message, got %d", w.Code)
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 1 {
+		t.Errorf("expected only the approved message sent, got %d sends", len(calls))
+	}
+}
+
+func TestApprovalMode_Duplicates(t *testing.T) {
+	prev := duplicateWindow
+	duplicateWindow = time.Minute
+	t.Cleanup(func() { duplicateWindow = prev })
+
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Client = &pacedClient{WhatsAppClient: mock, session: session}
+	session.Approval.Set(approvalConfig{Enabled: true})
+	session.Redaction.Set(redactionConfig{Enabled: true})
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send",
+			bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "the code is 1234"}`)))
+		return w
+	}
+
+	w := send()
+	var held struct{ ID string }
+	json.NewDecoder(w.Body).Decode(&held)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if evt := <-session.EventChan; evt.Payload.(ApprovalPayload).Text != "" {
+		t.Errorf("expected the send_pending event to be redacted, got %+v", evt.Payload)
+	}
+
+	// A retry of a held text is a duplicate of it, not a second pending copy
+	w = send()
+	if w.Code != http.StatusConflict || !bytes.Contains(w.Body.Bytes(), []byte(held.ID)) {
+		t.Errorf("expected 409 naming the pending message, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := len(session.Pending.List()); n != 1 {
+		t.Errorf("expected one pending send, got %d", n)
+	}
+
+	// Once it's rejected, the text can be sent again
+	rejectSendHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/approvals/reject",
+		bytes.NewBufferString(`{"user_id": 1, "id": "`+held.ID+`"}`)))
+	if w := send(); w.Code != http.StatusAccepted {
+		t.Errorf("expected a rejected text to be sendable again, got %d: %s", w.Code, w.Body.String())
+	}
+}
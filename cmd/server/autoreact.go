@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const maxAutoReactRules = 50
+
+// AutoReactRule reacts with Emoji to incoming messages it matches, e.g. ✅ to "done"
+// in a team group, so acknowledgments don't need a round trip through a bot
+type AutoReactRule struct {
+	Emoji string `json:"emoji"`
+	// Pattern is a regular expression matched against the text or caption; empty matches
+	// every message
+	Pattern string `json:"pattern,omitempty"`
+	// ChatJID limits the rule to one chat; empty means every chat
+	ChatJID string `json:"chat_jid,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// AutoReactConfig is a session's auto-react rules. The first rule that matches wins.
+type AutoReactConfig struct {
+	Rules []AutoReactRule `json:"rules"`
+}
+
+func (c *AutoReactConfig) compile() error {
+	if len(c.Rules) > maxAutoReactRules {
+		return fmt.Errorf("at most %d rules are allowed", maxAutoReactRules)
+	}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.Emoji == "" {
+			return fmt.Errorf("rule %d: emoji required", i)
+		}
+		if rule.ChatJID != "" {
+			jid, err := types.ParseJID(rule.ChatJID)
+			if err != nil {
+				return fmt.Errorf("rule %d: invalid chat_jid", i)
+			}
+			rule.ChatJID = jid.ToNonAD().String()
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("rule %d: %w", i, err)
+			}
+			rule.pattern = pattern
+		}
+	}
+	return nil
+}
+
+// normalize validates and compiles a copy of the rules
+func (c AutoReactConfig) normalize() (AutoReactConfig, error) {
+	c.Rules = append([]AutoReactRule(nil), c.Rules...)
+	err := c.compile()
+	return c, err
+}
+
+// match returns the emoji to react to a message with, if a rule matches it
+func (c AutoReactConfig) match(payload MessagePayload) (string, bool) {
+	text := payload.Text
+	if text == "" {
+		text = payload.Caption
+	}
+	for _, rule := range c.Rules {
+		if rule.ChatJID != "" && rule.ChatJID != payload.ChatJID {
+			continue
+		}
+		if rule.pattern != nil && !rule.pattern.MatchString(text) {
+			continue
+		}
+		return rule.Emoji, true
+	}
+	return "", false
+}
+
+// AutoReact holds a session's auto-react rules. The zero value has none.
+type AutoReact struct {
+	persistedSetting[AutoReactConfig]
+}
+
+// autoReact reacts to an incoming message if one of the session's rules matches it
+func (s *UserSession) autoReact(payload MessagePayload) {
+	if payload.IsFromMe || payload.MediaType == "system" {
+		return
+	}
+	cfg := s.AutoReact.Get()
+	emoji, ok := cfg.match(payload)
+	if !ok {
+		return
+	}
+	chat, err := types.ParseJID(payload.ChatJID)
+	if err != nil {
+		return
+	}
+	key := &waCommon.MessageKey{
+		RemoteJID: proto.String(chat.String()),
+		FromMe:    proto.Bool(false),
+		ID:        proto.String(payload.ID),
+	}
+	if chat.Server == types.GroupServer {
+		key.Participant = proto.String(payload.SenderJID)
+	}
+	go func() {
+		msg := &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+			Key:               key,
+			Text:              proto.String(emoji),
+			SenderTimestampMS: proto.Int64(time.Now().UnixMilli()),
+		}}
+		if _, err := s.Client.SendMessage(context.Background(), chat, msg); err != nil {
+			log.Printf("[autoreact] User %d: failed to react to %s: %v", s.UserID, payload.ID, err)
+			s.emitSendFailed("auto_react", payload.ID, chat, "", err)
+		}
+	}()
+}
+
+// autoReactHandler reads (GET) or replaces (POST) a session's auto-react rules
+func autoReactHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[AutoReactConfig]{
+		name:    "auto-react rules",
+		setting: func(s *UserSession) settingStore[AutoReactConfig] { return &s.AutoReact },
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAutoReactConfig_match(t *testing.T) {
+	cfg := AutoReactConfig{Rules: []AutoReactRule{
+		{Emoji: "✅", Pattern: `(?i)\bdone\b`, ChatJID: "123@g.us"},
+		{Emoji: "👀", Pattern: `^urgent`},
+	}}
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		payload MessagePayload
+		want    string
+	}{
+		{MessagePayload{ChatJID: "123@g.us", Text: "Deploy DONE"}, "✅"},
+		{MessagePayload{ChatJID: "456@g.us", Text: "deploy done"}, ""},
+		{MessagePayload{ChatJID: "456@g.us", Caption: "urgent: look"}, "👀"},
+		{MessagePayload{ChatJID: "123@g.us", Text: "undone"}, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := cfg.match(tt.payload); got != tt.want {
+			t.Errorf("match(%+v) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+
+	for _, bad := range []AutoReactConfig{
+		{Rules: []AutoReactRule{{Pattern: "x"}}},
+		{Rules: []AutoReactRule{{Emoji: "✅", Pattern: "("}}},
+		{Rules: []AutoReactRule{{Emoji: "✅", ChatJID: "1:x@s.whatsapp.net"}}},
+	} {
+		if err := bad.compile(); err == nil {
+			t.Errorf("expected %+v to be invalid", bad)
+		}
+	}
+}
+
+func TestAutoReactHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	path := filepath.Join(t.TempDir(), "autoreact.json")
+	session.AutoReact.load(path)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		autoReactHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/auto-react", bytes.NewBufferString(body)))
+		return w
+	}
+	if w := post(`{"user_id": 1, "rules": [{"emoji": "✅", "pattern": "("}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad pattern, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "rules": [{"emoji": "✅", "pattern": "done"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Rules survive a restart
+	var reloaded AutoReact
+	if err := reloaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if emoji, ok := reloaded.Get().match(MessagePayload{Text: "all done"}); !ok || emoji != "✅" {
+		t.Errorf("expected the saved rule to match after reload, got %q", emoji)
+	}
+}
+
+func TestHandleEvent_AutoReacts(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.AutoReact.Set(AutoReactConfig{Rules: []AutoReactRule{{Emoji: "✅", Pattern: "done"}}})
+
+	group := types.NewJID("123", types.GroupServer)
+	sender := types.NewJID("111", types.DefaultUserServer)
+	message := func(id, text string) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: group, Sender: sender, IsGroup: true},
+				ID:            id,
+			},
+			Message: &waE2E.Message{Conversation: proto.String(text)},
+		}
+	}
+	session.handleEvent(message("MSG1", "hello"))
+	session.handleEvent(message("MSG2", "it's done"))
+
+	for deadline := time.Now().Add(time.Second); len(mock.GetCallsByMethod("SendMessage")) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a reaction")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	calls := mock.GetCallsByMethod("SendMessage")
+	reaction := calls[0].Args[2].(*waE2E.Message).GetReactionMessage()
+	if len(calls) != 1 || reaction.GetText() != "✅" || reaction.GetKey().GetID() != "MSG2" || reaction.GetKey().GetParticipant() != sender.String() {
+		t.Errorf("expected one ✅ reaction to MSG2 from %s, got %+v", sender, reaction)
+	}
+}
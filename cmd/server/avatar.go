@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// avatarClient fetches profile pictures from WhatsApp's CDN for proxy=true
+var avatarClient = &http.Client{Timeout: 30 * time.Second}
+
+// contactAvatarHandler returns the profile picture of a contact (or group, or "me"):
+// where to download it, or with proxy=true the image itself, for UIs that can't load
+// WhatsApp's short-lived CDN URLs. quality is "preview" (the default, a small
+// thumbnail) or "full". The ETag is the quality and picture ID; sending it back in
+// If-None-Match answers 304 while the picture is unchanged.
+func contactAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	quality := r.URL.Query().Get("quality")
+	switch quality {
+	case "":
+		quality = "preview"
+	case "preview", "full":
+	default:
+		errorResponse(w, http.StatusBadRequest, "quality must be preview or full")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(r.URL.Query().Get("jid"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	known := knownAvatarID(r.Header.Get("If-None-Match"), quality)
+	info, err := session.Client.GetProfilePictureInfo(r.Context(), jid, &whatsmeow.GetProfilePictureParams{
+		Preview:    quality == "preview",
+		ExistingID: known,
+	})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet):
+		errorResponse(w, http.StatusNotFound, "no profile picture")
+		return
+	case errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		errorResponse(w, http.StatusForbidden, "profile picture hidden by privacy settings")
+		return
+	case err != nil:
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to get profile picture: %v", err))
+		return
+	case info == nil:
+		// Unchanged since the ID the client has
+		w.Header().Set("ETag", avatarETag(quality, known))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", avatarETag(quality, info.ID))
+
+	if r.URL.Query().Get("proxy") != "true" {
+		jsonResponse(w, map[string]interface{}{
+			"id":      info.ID,
+			"url":     info.URL,
+			"quality": quality,
+		})
+		return
+	}
+	proxyAvatar(r.Context(), w, info.URL)
+}
+
+// avatarETag tags a picture by its ID, which changes with the picture, and its quality,
+// since the preview and the full picture share the ID
+func avatarETag(quality, id string) string {
+	return `"` + quality + "-" + id + `"`
+}
+
+// knownAvatarID returns the picture ID an If-None-Match header holds for quality, if any
+func knownAvatarID(header, quality string) string {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+		if id, ok := strings.CutPrefix(tag, quality+"-"); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// proxyAvatar streams a profile picture from WhatsApp's CDN
+func proxyAvatar(ctx context.Context, w http.ResponseWriter, url string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("invalid profile picture url: %v", err))
+		return
+	}
+	resp, err := avatarClient.Do(req)
+	if err != nil {
+		errorResponse(w, http.StatusBadGateway, fmt.Sprintf("failed to download profile picture: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errorResponse(w, http.StatusBadGateway, fmt.Sprintf("failed to download profile picture: %s", resp.Status))
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if length := resp.Header.Get("Content-Length"); length != "" {
+		w.Header().Set("Content-Length", length)
+	}
+	// The picture ID changes with the picture, so caches can keep it a while
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("[avatar] Failed to stream profile picture: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestContactAvatarHandler(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("\xff\xd8\xff avatar"))
+	}))
+	defer cdn.Close()
+
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.ProfilePicture = &types.ProfilePictureInfo{ID: "1700000000", URL: cdn.URL + "/v/avatar.jpg", Type: "preview"}
+
+	w := httptest.NewRecorder()
+	contactAvatarHandler(w, httptest.NewRequest(http.MethodGet, "/contacts/avatar?user_id=1&jid=15557654321@s.whatsapp.net", nil))
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp["url"] != mock.ProfilePicture.URL || resp["quality"] != "preview" || w.Header().Get("ETag") != `"preview-1700000000"` {
+		t.Fatalf("expected the picture's URL, got %d: %s", w.Code, w.Body.String())
+	}
+	if params := mock.GetCallsByMethod("GetProfilePictureInfo")[0].Args[2].(*whatsmeow.GetProfilePictureParams); !params.Preview {
+		t.Error("expected the preview to be the default")
+	}
+
+	w = httptest.NewRecorder()
+	contactAvatarHandler(w, httptest.NewRequest(http.MethodGet, "/contacts/avatar?user_id=1&jid=15557654321@s.whatsapp.net&quality=full&proxy=true", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "\xff\xd8\xff avatar" || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected the image itself, got %d: %q", w.Code, w.Body.String())
+	}
+	if params := mock.GetCallsByMethod("GetProfilePictureInfo")[1].Args[2].(*whatsmeow.GetProfilePictureParams); params.Preview {
+		t.Error("expected the full picture")
+	}
+
+	// WhatsApp answers nothing when the picture is still the one the client has
+	mock.ProfilePicture = nil
+	req := httptest.NewRequest(http.MethodGet, "/contacts/avatar?user_id=1&jid=15557654321@s.whatsapp.net", nil)
+	req.Header.Set("If-None-Match", `"preview-1700000000"`)
+	w = httptest.NewRecorder()
+	contactAvatarHandler(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for an unchanged picture, got %d", w.Code)
+	}
+	if params := mock.GetCallsByMethod("GetProfilePictureInfo")[2].Args[2].(*whatsmeow.GetProfilePictureParams); params.ExistingID != "1700000000" {
+		t.Errorf("expected the known ID to be passed on, got %q", params.ExistingID)
+	}
+	// The full picture's tag says nothing about the preview
+	req = httptest.NewRequest(http.MethodGet, "/contacts/avatar?user_id=1&jid=15557654321@s.whatsapp.net", nil)
+	req.Header.Set("If-None-Match", `"full-1700000000"`)
+	contactAvatarHandler(httptest.NewRecorder(), req)
+	if params := mock.GetCallsByMethod("GetProfilePictureInfo")[3].Args[2].(*whatsmeow.GetProfilePictureParams); params.ExistingID != "" {
+		t.Errorf("expected no known ID for another quality, got %q", params.ExistingID)
+	}
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{whatsmeow.ErrProfilePictureNotSet, http.StatusNotFound},
+		{whatsmeow.ErrProfilePictureUnauthorized, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		mock.ProfilePictureError = tt.err
+		w = httptest.NewRecorder()
+		contactAvatarHandler(w, httptest.NewRequest(http.MethodGet, "/contacts/avatar?user_id=1&jid=15557654321@s.whatsapp.net", nil))
+		if w.Code != tt.want {
+			t.Errorf("expected %d for %v, got %d", tt.want, tt.err, w.Code)
+		}
+	}
+}
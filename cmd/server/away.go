@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultAwayCooldown is how long a chat that got the away message is left alone
+// before it can get it again
+const defaultAwayCooldown = 6 * time.Hour
+
+// AwayConfig is a session's away-message setting. When enabled, incoming direct
+// messages received inside the window are answered with Message, at most once per
+// chat per cooldown.
+type AwayConfig struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+	// Start and End bound the daily window as "HH:MM"; leave both empty to be away all day.
+	// A window may wrap midnight, e.g. 22:00 to 07:00.
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Timezone string `json:"timezone,omitempty"` // IANA name, defaults to UTC
+	// CooldownSeconds is the minimum gap between replies to the same chat; 0 means 6 hours
+	CooldownSeconds int `json:"cooldown_seconds,omitempty"`
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (c AwayConfig) validate() error {
+	if c.Enabled && c.Message == "" {
+		return errors.New("message required when enabled")
+	}
+	if (c.Start == "") != (c.End == "") {
+		return errors.New("start and end must be set together")
+	}
+	if c.Start != "" {
+		if _, err := parseClock(c.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(c.End); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", c.Timezone)
+	}
+	if c.CooldownSeconds < 0 {
+		return errors.New("cooldown_seconds must not be negative")
+	}
+	return nil
+}
+
+// active reports whether now falls inside the away window
+func (c AwayConfig) active(now time.Time) bool {
+	if !c.Enabled {
+		return false
+	}
+	if c.Start == "" {
+		return true
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	start, _ := parseClock(c.Start)
+	end, _ := parseClock(c.End)
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func (c AwayConfig) normalize() (AwayConfig, error) {
+	return c, c.validate()
+}
+
+func (c AwayConfig) cooldown() time.Duration {
+	if c.CooldownSeconds == 0 {
+		return defaultAwayCooldown
+	}
+	return time.Duration(c.CooldownSeconds) * time.Second
+}
+
+// AwayMode holds a session's away configuration and the chats already answered. The
+// zero value is disabled.
+type AwayMode struct {
+	persistedSetting[AwayConfig]
+	answeredMu sync.Mutex
+	answered   map[string]time.Time
+}
+
+// Set validates and applies a new configuration. Chats answered under the previous
+// configuration may be answered again.
+func (a *AwayMode) Set(cfg AwayConfig) (AwayConfig, error) {
+	cfg, err := a.persistedSetting.Set(cfg)
+	if err != nil {
+		return cfg, err
+	}
+	a.answeredMu.Lock()
+	a.answered = nil
+	a.answeredMu.Unlock()
+	return cfg, nil
+}
+
+// claim returns the away message if chat should get it now, and records the reply
+func (a *AwayMode) claim(chat string, now time.Time) (string, bool) {
+	cfg := a.Get()
+	a.answeredMu.Lock()
+	defer a.answeredMu.Unlock()
+	if !cfg.active(now) {
+		return "", false
+	}
+	cooldown := cfg.cooldown()
+	if last, ok := a.answered[chat]; ok && now.Sub(last) < cooldown {
+		return "", false
+	}
+	if a.answered == nil {
+		a.answered = make(map[string]time.Time)
+	}
+	for jid, last := range a.answered {
+		if now.Sub(last) >= cooldown {
+			delete(a.answered, jid)
+		}
+	}
+	a.answered[chat] = now
+	return cfg.Message, true
+}
+
+// autoReply sends the away message for an incoming direct message, if away mode applies
+func (s *UserSession) autoReply(payload MessagePayload) {
+	if payload.IsFromMe || payload.MediaType == "system" {
+		return
+	}
+	chat, err := types.ParseJID(payload.ChatJID)
+	if err != nil || (chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer) {
+		return
+	}
+	text, ok := s.Away.claim(chat.String(), time.Now())
+	if !ok {
+		return
+	}
+	go func() {
+		msg := &waE2E.Message{Conversation: proto.String(text)}
+		if _, err := s.Client.SendMessage(context.Background(), chat, msg); err != nil {
+			log.Printf("[away] User %d: failed to reply to %s: %v", s.UserID, chat, err)
+			s.emitSendFailed("away", payload.ID, chat, "", err)
+		}
+	}()
+}
+
+// awayHandler reads (GET) or replaces (POST) a session's away-message configuration
+func awayHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[AwayConfig]{
+		name:    "away config",
+		setting: func(s *UserSession) settingStore[AwayConfig] { return &s.Away },
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestAwayConfig_active(t *testing.T) {
+	at := func(clock string) time.Time {
+		ts, _ := time.Parse("2006-01-02 15:04", "2026-03-02 "+clock)
+		return ts
+	}
+	tests := []struct {
+		name   string
+		config AwayConfig
+		now    time.Time
+		want   bool
+	}{
+		{"disabled", AwayConfig{Message: "x"}, at("12:00"), false},
+		{"all day", AwayConfig{Enabled: true, Message: "x"}, at("12:00"), true},
+		{"inside window", AwayConfig{Enabled: true, Start: "09:00", End: "17:00"}, at("09:00"), true},
+		{"end is exclusive", AwayConfig{Enabled: true, Start: "09:00", End: "17:00"}, at("17:00"), false},
+		{"overnight late", AwayConfig{Enabled: true, Start: "22:00", End: "07:00"}, at("23:30"), true},
+		{"overnight early", AwayConfig{Enabled: true, Start: "22:00", End: "07:00"}, at("06:59"), true},
+		{"overnight daytime", AwayConfig{Enabled: true, Start: "22:00", End: "07:00"}, at("12:00"), false},
+		// 20:00 UTC is 21:00 in Berlin during winter
+		{"timezone", AwayConfig{Enabled: true, Start: "21:00", End: "22:00", Timezone: "Europe/Berlin"}, at("20:00"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.active(tt.now); got != tt.want {
+				t.Errorf("active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAwayConfig_validate(t *testing.T) {
+	invalid := []AwayConfig{
+		{Enabled: true},
+		{Enabled: true, Message: "x", Start: "09:00"},
+		{Enabled: true, Message: "x", Start: "9am", End: "17:00"},
+		{Enabled: true, Message: "x", Timezone: "Mars/Olympus"},
+		{Enabled: true, Message: "x", CooldownSeconds: -1},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+	if err := (AwayConfig{}).validate(); err != nil {
+		t.Errorf("expected disabled config to be valid, got %v", err)
+	}
+}
+
+func TestAwayMode_claim(t *testing.T) {
+	var away AwayMode
+	if _, err := away.Set(AwayConfig{Enabled: true, Message: "back soon", CooldownSeconds: 60}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	if text, ok := away.claim("a", now); !ok || text != "back soon" {
+		t.Errorf("expected first message to be answered, got %q %v", text, ok)
+	}
+	if _, ok := away.claim("a", now.Add(30*time.Second)); ok {
+		t.Error("expected chat to be skipped during cooldown")
+	}
+	if _, ok := away.claim("b", now.Add(30*time.Second)); !ok {
+		t.Error("expected other chat to be answered")
+	}
+	if _, ok := away.claim("a", now.Add(61*time.Second)); !ok {
+		t.Error("expected chat to be answered again after cooldown")
+	}
+}
+
+func TestAwayMode_persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "away.json")
+	var away AwayMode
+	if err := away.load(path); err != nil {
+		t.Fatalf("load of missing file failed: %v", err)
+	}
+	cfg := AwayConfig{Enabled: true, Message: "on holiday", Start: "18:00", End: "08:00"}
+	if _, err := away.Set(cfg); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var restored AwayMode
+	if err := restored.load(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if restored.Get() != cfg {
+		t.Errorf("expected %+v, got %+v", cfg, restored.Get())
+	}
+}
+
+func TestUserSession_autoReply(t *testing.T) {
+	contact := types.NewJID("15551234567", types.DefaultUserServer)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+
+	mock := NewLoggedInMockClient()
+	session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+	session.Away.Set(AwayConfig{Enabled: true, Message: "I'm away"})
+
+	session.handleEvent(incomingText(group, "G1", "hello group"))
+	session.handleEvent(incomingText(contact, "M1", "hello"))
+	session.handleEvent(incomingText(contact, "M2", "are you there?"))
+
+	if got := waitForSentText(t, mock); got != "I'm away" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	calls := mock.GetCallsByMethod("SendMessage")
+	if len(calls) != 1 || calls[0].Args[1].(types.JID) != contact {
+		t.Errorf("expected a single reply to the direct chat, got %d calls", len(calls))
+	}
+	if len(session.EventChan) != 3 {
+		t.Errorf("expected all messages to be emitted, got %d events", len(session.EventChan))
+	}
+}
+
+func TestAwayHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	injectMockSession(manager, 980, NewLoggedInMockClient())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sessions/away", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		awayHandler(w, req)
+		return w
+	}
+
+	if w := post(`{"user_id": 980, "enabled": true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without message, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 981, "enabled": false}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown session, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 980, "enabled": true, "message": "away", "start": "18:00", "end": "08:00"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/away?user_id=980", nil)
+	w := httptest.NewRecorder()
+	awayHandler(w, req)
+	var cfg AwayConfig
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if !cfg.Enabled || cfg.Message != "away" || cfg.Start != "18:00" || cfg.End != "08:00" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+)
+
+// The benchmarks cover the two paths that scale with traffic: an incoming event fanned
+// out to the event log, the store and every consumer, and media downloads. Compare runs
+// with benchstat before and after a change to them; CONTRIBUTING.md has the targets.
+
+// quietLogs silences the per-event logging, which would otherwise dominate the numbers
+func quietLogs(tb testing.TB) {
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+// newBenchSession is a logged-in session with a message store and consumers that take
+// every event as it arrives
+func newBenchSession(b *testing.B, consumers int) *UserSession {
+	session := injectMockSession(setupTestManager(b), 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(b)
+	for i := 0; i < consumers; i++ {
+		sub := session.Events.subscribe(eventQueue.Size)
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-sub.C:
+				case <-done:
+					return
+				}
+			}
+		}()
+		b.Cleanup(func() {
+			close(done)
+			session.Events.unsubscribe(sub)
+		})
+	}
+	return session
+}
+
+func BenchmarkEmit(b *testing.B) {
+	quietLogs(b)
+	for _, consumers := range []int{1, 4, 16} {
+		b.Run("consumers="+strconv.Itoa(consumers), func(b *testing.B) {
+			session := newBenchSession(b, consumers)
+			payload := MessagePayload{ChatJID: "15557654321@s.whatsapp.net", Text: "hello", Timestamp: 1700000000}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				payload.ID = strconv.Itoa(i)
+				session.emit(core.NewEvent(payload))
+			}
+		})
+	}
+}
+
+func BenchmarkHandleEvent_Text(b *testing.B) {
+	quietLogs(b)
+	session := newBenchSession(b, 1)
+	alice := types.NewJID("15557654321", types.DefaultUserServer)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		session.handleEvent(incomingText(alice, "M"+strconv.Itoa(i), "hello"))
+	}
+}
+
+func BenchmarkDownloadMedia(b *testing.B) {
+	quietLogs(b)
+	for _, size := range []int{64 << 10, 1 << 20, 16 << 20} {
+		b.Run(fmt.Sprintf("size=%dKiB", size>>10), func(b *testing.B) {
+			manager = setupTestManager(b)
+			mock := NewLoggedInMockClient()
+			mock.DownloadData = bytes.Repeat([]byte{0xAB}, size)
+			injectMockSession(manager, 1, mock)
+			body := []byte(`{"user_id": 1, "direct_path": "/v/t62/img", "mime_type": "image/jpeg"}`)
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				downloadMediaHandler(w, httptest.NewRequest(http.MethodPost, "/media/download", bytes.NewReader(body)))
+				if w.Code != http.StatusOK {
+					b.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
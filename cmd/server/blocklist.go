@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// blocklistPayload lists the blocked contacts
+func blocklistPayload(list *types.Blocklist) map[string]interface{} {
+	blocked := make([]string, 0, len(list.JIDs))
+	for _, jid := range list.JIDs {
+		blocked = append(blocked, jid.String())
+	}
+	return map[string]interface{}{
+		"blocked": blocked,
+	}
+}
+
+// getBlocklistHandler lists the contacts the account has blocked
+func getBlocklistHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	list, err := session.Client.GetBlocklist(context.Background())
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to get blocklist: %v", err))
+		return
+	}
+	jsonResponse(w, blocklistPayload(list))
+}
+
+// blockContactHandler blocks a contact: they can no longer message or call the account
+// or see its last seen, online status and profile changes
+func blockContactHandler(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, events.BlocklistChangeActionBlock)
+}
+
+// unblockContactHandler unblocks a contact
+func unblockContactHandler(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, events.BlocklistChangeActionUnblock)
+}
+
+// updateBlocklist blocks or unblocks the contact in the request and answers with the
+// new blocklist
+func updateBlocklist(w http.ResponseWriter, r *http.Request, action events.BlocklistChangeAction) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		JID    string `json:"jid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	// Only people can be blocked; to stop hearing from a group, leave it
+	jid, err := types.ParseJID(req.JID)
+	if err != nil || (jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer) {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	list, err := session.Client.UpdateBlocklist(context.Background(), jid.ToNonAD(), action)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to %s %s: %v", action, jid.ToNonAD(), err))
+		return
+	}
+	jsonResponse(w, blocklistPayload(list))
+}
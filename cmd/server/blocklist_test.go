@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestBlocklistHandlers(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	blocked := func(w *httptest.ResponseRecorder) []string {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Blocked []string `json:"blocked"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Blocked
+	}
+
+	w := httptest.NewRecorder()
+	blockContactHandler(w, httptest.NewRequest(http.MethodPost, "/contacts/block", bytes.NewBufferString(`{"user_id": 1, "jid": "15557654321:3@s.whatsapp.net"}`)))
+	if got := blocked(w); len(got) != 1 || got[0] != "15557654321@s.whatsapp.net" {
+		t.Errorf("expected the contact to be blocked without its device, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	getBlocklistHandler(w, httptest.NewRequest(http.MethodGet, "/contacts/blocklist?user_id=1", nil))
+	if got := blocked(w); len(got) != 1 {
+		t.Errorf("expected one blocked contact, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	unblockContactHandler(w, httptest.NewRequest(http.MethodPost, "/contacts/unblock", bytes.NewBufferString(`{"user_id": 1, "jid": "15557654321@s.whatsapp.net"}`)))
+	if got := blocked(w); len(got) != 0 {
+		t.Errorf("expected the contact to be unblocked, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	blockContactHandler(w, httptest.NewRequest(http.MethodPost, "/contacts/block", bytes.NewBufferString(`{"user_id": 1, "jid": "120363000000000000@g.us"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a group to be refused, got %d", w.Code)
+	}
+	if calls := mock.GetCallsByMethod("UpdateBlocklist"); len(calls) != 2 || calls[0].Args[1].(types.JID).Device != 0 {
+		t.Errorf("expected 2 blocklist updates, got %d", len(calls))
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// eventSubscriber is one connected /events or /ws consumer
+type eventSubscriber struct {
+	C chan MessageEvent
+	// Signalled when an event didn't fit in C under the spill policy and has to be
+	// replayed from the log
+	spilled chan struct{}
+}
+
+// eventBroadcaster hands every emitted event to each connected consumer, so several can
+// follow one session without taking events from each other
+type eventBroadcaster struct {
+	mu   sync.Mutex
+	subs []*eventSubscriber
+}
+
+func (b *eventBroadcaster) subscribe(size int) *eventSubscriber {
+	sub := &eventSubscriber{
+		C:       make(chan MessageEvent, size),
+		spilled: make(chan struct{}, 1),
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *eventBroadcaster) unsubscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// subscribers returns the connected consumers
+func (b *eventBroadcaster) subscribers() []*eventSubscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*eventSubscriber(nil), b.subs...)
+}
+
+// Count returns how many consumers are connected
+func (b *eventBroadcaster) Count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// takeBacklog empties EventChan, which holds what was emitted while no consumer was
+// connected, and stops any spill into it. If the backlog was spilling, the rest of it is
+// in the log after spillAfter. The caller has already subscribed, so every later event
+// reaches it directly.
+func (s *UserSession) takeBacklog() (backlog []MessageEvent, spillAfter int64, spilled bool) {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	spilled, spillAfter = s.Queue.spilling, s.Queue.spillAfter
+	s.Queue.spilling = false
+	for {
+		select {
+		case evt := <-s.EventChan:
+			backlog = append(backlog, evt)
+		default:
+			return backlog, spillAfter, spilled
+		}
+	}
+}
+
+// streamEvents sends a session's events to one consumer until ctx ends or send fails:
+// first everything logged after cursor (if set), then the backlog, then live events.
+func (s *UserSession) streamEvents(ctx context.Context, cursor int64, send func(MessageEvent) error) error {
+	sub := s.Events.subscribe(eventQueue.Size)
+	defer s.Events.unsubscribe(sub)
+
+	events := eventCursor{session: s, last: cursor}
+	if cursor > 0 {
+		if err := events.replay(ctx, 0, send); err != nil {
+			log.Printf("[events] User %d: replay from %d failed: %v", s.UserID, cursor, err)
+			return err
+		}
+	}
+
+	backlog, spillAfter, spilled := s.takeBacklog()
+	for _, evt := range backlog {
+		if err := events.deliver(ctx, evt, send); err != nil {
+			return err
+		}
+	}
+	if spilled {
+		events.last = max(events.last, spillAfter)
+		if err := events.replay(ctx, 0, send); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case evt := <-sub.C:
+			if err := events.deliver(ctx, evt, send); err != nil {
+				return err
+			}
+
+		case <-sub.spilled:
+			// Queued events come first, then the ones that didn't fit
+			for queued := true; queued; {
+				select {
+				case evt := <-sub.C:
+					if err := events.deliver(ctx, evt, send); err != nil {
+						return err
+					}
+				default:
+					queued = false
+				}
+			}
+			if err := events.replay(ctx, 0, send); err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
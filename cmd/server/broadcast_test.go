@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// collectEvents streams a session's events into a channel until the test ends
+func collectEvents(t *testing.T, session *UserSession, cursor int64) <-chan MessageEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	out := make(chan MessageEvent, 100)
+	go session.streamEvents(ctx, cursor, func(evt MessageEvent) error {
+		out <- evt
+		return nil
+	})
+	return out
+}
+
+func waitForConsumers(t *testing.T, session *UserSession, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); session.Events.Count() != n; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d consumers, got %d", n, session.Events.Count())
+		}
+	}
+}
+
+func receiveTypes(t *testing.T, events <-chan MessageEvent, n int) []string {
+	t.Helper()
+	var types []string
+	for len(types) < n {
+		select {
+		case evt := <-events:
+			types = append(types, evt.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d events, got %v", n, types)
+		}
+	}
+	return types
+}
+
+func TestStreamEvents_fanOut(t *testing.T) {
+	session := injectMockSession(setupTestManager(t), 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+
+	// Emitted before anyone listens: the first consumer gets it from the backlog
+	session.emit(MessageEvent{Type: "early"})
+	first := collectEvents(t, session, 0)
+	if got := receiveTypes(t, first, 1); got[0] != "early" {
+		t.Fatalf("expected the backlog first, got %v", got)
+	}
+	second := collectEvents(t, session, 0)
+	waitForConsumers(t, session, 2)
+
+	session.emit(MessageEvent{Type: "a"})
+	session.emit(MessageEvent{Type: "b"})
+	for name, events := range map[string]<-chan MessageEvent{"first": first, "second": second} {
+		if got := receiveTypes(t, events, 2); got[0] != "a" || got[1] != "b" {
+			t.Errorf("%s consumer: expected a and b, got %v", name, got)
+		}
+	}
+	if len(session.EventChan) != 0 {
+		t.Errorf("expected nothing in the backlog while consumers are connected, got %d", len(session.EventChan))
+	}
+}
+
+func TestStreamEvents_spillReplaysFromLog(t *testing.T) {
+	withEventQueue(t, eventQueueConfig{Size: 1, Overflow: overflowSpill})
+	session := injectMockSession(setupTestManager(t), 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	out := make(chan MessageEvent, 10)
+	go session.streamEvents(ctx, 0, func(evt MessageEvent) error {
+		<-release // a slow consumer
+		out <- evt
+		return nil
+	})
+	waitForConsumers(t, session, 1)
+
+	for _, typ := range []string{"a", "b", "c", "d"} {
+		session.emit(MessageEvent{Type: typ})
+	}
+	close(release)
+	got := receiveTypes(t, out, 4)
+	if got[0] != "a" || got[1] != "b" || got[2] != "c" || got[3] != "d" {
+		t.Errorf("expected every event once and in order, got %v", got)
+	}
+	if session.Queue.Dropped() != 0 {
+		t.Errorf("expected nothing dropped, got %d", session.Queue.Dropped())
+	}
+}
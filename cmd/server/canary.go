@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultCanaryInterval = 5 * time.Minute
+	defaultCanaryTimeout  = time.Minute
+)
+
+// Canary states reported by /readyz
+const (
+	CanaryStatePending = "pending" // no check has finished yet
+	CanaryStateOK      = "ok"
+	CanaryStateFailing = "failing"
+)
+
+// CanaryStatus is the outcome of the most recent self-test
+type CanaryStatus struct {
+	UserID              int    `json:"user_id"`
+	State               string `json:"state"`
+	LastCheck           int64  `json:"last_check,omitempty"`
+	LastSuccess         int64  `json:"last_success,omitempty"`
+	LatencyMs           int64  `json:"latency_ms,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// Canary periodically sends a message from a canary session to its own note-to-self
+// chat and waits for the receipt to come back as an event. Sends that are accepted
+// but never delivered don't show up as errors anywhere else.
+type Canary struct {
+	UserID   int
+	Interval time.Duration
+	Timeout  time.Duration
+
+	mu      sync.Mutex
+	pending map[types.MessageID]chan struct{}
+	status  CanaryStatus
+}
+
+var (
+	// canary is nil unless CANARY_USER_ID is set
+	canary = canaryFromEnv()
+
+	canaryChecks = newCounterVec("wa_canary_checks",
+		"Canary self-test round trips by result.", "result")
+)
+
+func NewCanary(userID int, interval, timeout time.Duration) *Canary {
+	return &Canary{
+		UserID:   userID,
+		Interval: interval,
+		Timeout:  timeout,
+		pending:  make(map[types.MessageID]chan struct{}),
+		status:   CanaryStatus{UserID: userID, State: CanaryStatePending},
+	}
+}
+
+func canaryFromEnv() *Canary {
+	value := os.Getenv("CANARY_USER_ID")
+	if value == "" {
+		return nil
+	}
+	userID, err := strconv.Atoi(value)
+	if err != nil || userID <= 0 {
+		log.Printf("Warning: invalid CANARY_USER_ID %q, canary disabled", value)
+		return nil
+	}
+	return NewCanary(userID,
+		durationFromEnv("CANARY_INTERVAL", defaultCanaryInterval),
+		durationFromEnv("CANARY_TIMEOUT", defaultCanaryTimeout))
+}
+
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, value, def)
+		return def
+	}
+	return d
+}
+
+// newMessageID makes a message ID up front, in the form WhatsApp's own clients use, so
+// a canary's receipt that beats SendMessage back, or a send approved later, is matched
+func newMessageID() types.MessageID {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "3EB0" + strings.ToUpper(hex.EncodeToString(b))
+}
+
+// Status returns the outcome of the most recent check
+func (c *Canary) Status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Check runs one round trip through the canary session and records the result
+func (c *Canary) Check(m *SessionManager) error {
+	start := time.Now()
+	err := c.roundTrip(m)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastCheck = start.Unix()
+	if err != nil {
+		c.status.State = CanaryStateFailing
+		c.status.ConsecutiveFailures++
+		c.status.LastError = err.Error()
+		canaryChecks.Inc("failed")
+		log.Printf("[canary] User %d: self-test failed (%d in a row): %v", c.UserID, c.status.ConsecutiveFailures, err)
+		return err
+	}
+	c.status.State = CanaryStateOK
+	c.status.LastSuccess = time.Now().Unix()
+	c.status.LatencyMs = time.Since(start).Milliseconds()
+	c.status.ConsecutiveFailures = 0
+	c.status.LastError = ""
+	canaryChecks.Inc("ok")
+	return nil
+}
+
+func (c *Canary) roundTrip(m *SessionManager) error {
+	session := m.GetSession(c.UserID)
+	if session == nil {
+		return errors.New("canary session not found")
+	}
+	own := session.Client.GetStore().GetID()
+	if !session.Client.IsLoggedIn() || own == nil {
+		return errors.New("canary session not logged in")
+	}
+
+	id := newMessageID()
+	received := make(chan struct{})
+	c.mu.Lock()
+	c.pending[id] = received
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	msg := &waE2E.Message{Conversation: proto.String("wa_meow canary " + time.Now().UTC().Format(time.RFC3339))}
+	if _, err := session.Client.SendMessage(ctx, own.ToNonAD(), msg, whatsmeow.SendRequestExtra{ID: id}); err != nil {
+		return fmt.Errorf("send failed: %w", err)
+	}
+	select {
+	case <-received:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no receipt within %v", c.Timeout)
+	}
+}
+
+// observeReceipt completes a pending check when the canary session gets a receipt for it
+func (c *Canary) observeReceipt(userID int, receipt *events.Receipt) {
+	if c == nil || userID != c.UserID {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range receipt.MessageIDs {
+		if received, ok := c.pending[id]; ok {
+			close(received)
+			delete(c.pending, id)
+		}
+	}
+}
+
+// run checks the canary session every Interval
+func (c *Canary) run(m *SessionManager) {
+	log.Printf("[canary] Self-test enabled for user %d every %v", c.UserID, c.Interval)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.Check(m)
+	}
+}
+
+// readyzHandler reports whether the server can deliver messages. Without a canary it's
+// ready as soon as it serves requests; with one, it's not ready while the self-test fails.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if canary == nil {
+		jsonResponse(w, map[string]string{"status": "ready"})
+		return
+	}
+	status := canary.Status()
+	resp := map[string]interface{}{"status": "ready", "canary": status}
+	if status.State == CanaryStateFailing {
+		resp["status"] = "not_ready"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	jsonResponse(w, resp)
+}
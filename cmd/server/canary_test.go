@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// answerCanary delivers a receipt for the next canary message the mock sends
+func answerCanary(session *UserSession, mock *MockWhatsAppClient) {
+	for i := 0; i < 100; i++ {
+		if calls := mock.GetCallsByMethod("SendMessage"); len(calls) > 0 {
+			extra := calls[0].Args[3].([]whatsmeow.SendRequestExtra)
+			session.handleEvent(&events.Receipt{
+				MessageSource: types.MessageSource{Chat: calls[0].Args[1].(types.JID)},
+				MessageIDs:    []types.MessageID{extra[0].ID},
+				Type:          types.ReceiptTypeDelivered,
+			})
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCanary_Check(t *testing.T) {
+	originalCanary := canary
+	defer func() { canary = originalCanary }()
+
+	t.Run("receipt completes the round trip", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(manager, 42, mock)
+		canary = NewCanary(42, time.Minute, 2*time.Second)
+
+		go answerCanary(session, mock)
+		if err := canary.Check(manager); err != nil {
+			t.Fatalf("expected check to pass, got %v", err)
+		}
+		if to := mock.GetCallsByMethod("SendMessage")[0].Args[1].(types.JID); to.String() != "1234567890@s.whatsapp.net" {
+			t.Errorf("expected canary to message itself, sent to %s", to)
+		}
+		if status := canary.Status(); status.State != CanaryStateOK || status.LastSuccess == 0 {
+			t.Errorf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("missing receipt fails readiness", func(t *testing.T) {
+		manager = setupTestManager(t)
+		injectMockSession(manager, 42, NewLoggedInMockClient())
+		canary = NewCanary(42, time.Minute, 50*time.Millisecond)
+
+		if err := canary.Check(manager); err == nil {
+			t.Fatal("expected check to time out")
+		}
+		w := httptest.NewRecorder()
+		readyzHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+		var resp struct {
+			Status string       `json:"status"`
+			Canary CanaryStatus `json:"canary"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Status != "not_ready" || resp.Canary.ConsecutiveFailures != 1 || resp.Canary.LastError == "" {
+			t.Errorf("unexpected readyz response %+v", resp)
+		}
+	})
+
+	t.Run("send error and missing session fail", func(t *testing.T) {
+		manager = setupTestManager(t)
+		canary = NewCanary(42, time.Minute, time.Second)
+		if err := canary.Check(manager); err == nil {
+			t.Error("expected missing session to fail")
+		}
+
+		mock := NewLoggedInMockClient()
+		mock.SendMessageError = errors.New("websocket not connected")
+		injectMockSession(manager, 42, mock)
+		canary.Check(manager)
+		if status := canary.Status(); status.ConsecutiveFailures != 2 {
+			t.Errorf("expected 2 consecutive failures, got %+v", status)
+		}
+	})
+}
+
+func TestReadyzHandler_NoCanary(t *testing.T) {
+	originalCanary := canary
+	defer func() { canary = originalCanary }()
+	canary = nil
+
+	w := httptest.NewRecorder()
+	readyzHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
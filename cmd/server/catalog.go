@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultCatalogLimit = 10
+	maxCatalogLimit     = 100
+	// Size WhatsApp renders product images at for the request_image_url
+	catalogImageSize = "100"
+)
+
+// catalogImageClient fetches product images from WhatsApp's CDN to attach to product messages
+var catalogImageClient = &http.Client{Timeout: 30 * time.Second}
+
+// BusinessProduct is one item of a business's catalog
+type BusinessProduct struct {
+	ID          string `json:"id"`
+	RetailerID  string `json:"retailer_id,omitempty"` // the business's own SKU
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	// Price in thousandths of the currency unit, as WhatsApp keeps it: 12990 is 12.99
+	PriceAmount1000 int64  `json:"price_amount_1000,omitempty"`
+	ImageURL        string `json:"image_url,omitempty"`
+	Hidden          bool   `json:"hidden,omitempty"`
+	ReviewStatus    string `json:"review_status,omitempty"` // WhatsApp's commerce policy review, e.g. "APPROVED"
+}
+
+// BusinessCatalog is a page of a business's catalog
+type BusinessCatalog struct {
+	Products []BusinessProduct `json:"products"`
+	// Cursor is passed as after to get the next page; empty on the last one
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// catalogQuery asks for a page of jid's catalog
+func catalogQuery(jid types.JID, limit int, after string) waBinary.Node {
+	content := []waBinary.Node{
+		{Tag: "limit", Content: []byte(strconv.Itoa(limit))},
+		{Tag: "width", Content: []byte(catalogImageSize)},
+		{Tag: "height", Content: []byte(catalogImageSize)},
+	}
+	if after != "" {
+		content = append(content, waBinary.Node{Tag: "after", Content: []byte(after)})
+	}
+	return waBinary.Node{
+		Tag:     "product_catalog",
+		Attrs:   waBinary.Attrs{"jid": jid, "allow_shop_source": "true"},
+		Content: content,
+	}
+}
+
+// productQuery asks for one product of jid's catalog
+func productQuery(jid types.JID, productID string) waBinary.Node {
+	return waBinary.Node{
+		Tag:   "product",
+		Attrs: waBinary.Attrs{"jid": jid},
+		Content: []waBinary.Node{
+			{Tag: "id", Content: []byte(productID)},
+			{Tag: "width", Content: []byte(catalogImageSize)},
+			{Tag: "height", Content: []byte(catalogImageSize)},
+		},
+	}
+}
+
+// childText returns the text content of node's first child called tag, or ""
+func childText(node waBinary.Node, tag string) string {
+	child, ok := node.GetOptionalChildByTag(tag)
+	if !ok {
+		return ""
+	}
+	text, _ := child.Content.([]byte)
+	return string(text)
+}
+
+// parseProduct reads a <product> node of a catalog response
+func parseProduct(node waBinary.Node) BusinessProduct {
+	ag := node.AttrGetter()
+	product := BusinessProduct{
+		ID:          ag.OptionalString("id"),
+		RetailerID:  childText(node, "retailer_id"),
+		Name:        childText(node, "name"),
+		Description: childText(node, "description"),
+		URL:         childText(node, "url"),
+		Currency:    childText(node, "currency"),
+		Hidden:      ag.OptionalString("is_hidden") == "true",
+	}
+	if product.ID == "" {
+		product.ID = childText(node, "id")
+	}
+	product.PriceAmount1000, _ = strconv.ParseInt(childText(node, "price"), 10, 64)
+	if image, ok := node.GetOptionalChildByTag("media", "image"); ok {
+		product.ImageURL = childText(image, "request_image_url")
+		if product.ImageURL == "" {
+			product.ImageURL = childText(image, "original_image_url")
+		}
+	}
+	if status, ok := node.GetOptionalChildByTag("status_info"); ok {
+		product.ReviewStatus = childText(status, "status")
+	}
+	return product
+}
+
+// parseCatalog reads the response to a catalogQuery
+func parseCatalog(resp *waBinary.Node) (*BusinessCatalog, error) {
+	node, ok := resp.GetOptionalChildByTag("product_catalog")
+	if !ok {
+		return nil, &whatsmeow.ElementMissingError{Tag: "product_catalog", In: "catalog response"}
+	}
+	catalog := &BusinessCatalog{Products: []BusinessProduct{}}
+	for _, child := range node.GetChildrenByTag("product") {
+		catalog.Products = append(catalog.Products, parseProduct(child))
+	}
+	if paging, ok := node.GetOptionalChildByTag("paging"); ok {
+		catalog.Cursor = childText(paging, "after")
+	}
+	return catalog, nil
+}
+
+// parseProductResponse reads the response to a productQuery, which has the product
+// either directly or wrapped in a catalog
+func parseProductResponse(resp *waBinary.Node) (*BusinessProduct, error) {
+	node, ok := resp.GetOptionalChildByTag("product")
+	if !ok {
+		node, ok = resp.GetOptionalChildByTag("product_catalog", "product")
+	}
+	if !ok {
+		return nil, &whatsmeow.ElementMissingError{Tag: "product", In: "product response"}
+	}
+	if inner, ok := node.GetOptionalChildByTag("product"); ok {
+		node = inner
+	}
+	product := parseProduct(node)
+	return &product, nil
+}
+
+// catalogQueryTimeout bounds the wait for a catalog query's answer, as whatsmeow does its own
+const catalogQueryTimeout = 75 * time.Second
+
+// queryCatalog sends an info query about business catalogs. whatsmeow has none of its
+// own, so this builds the <iq> and waits for the answer itself.
+func queryCatalog(ctx context.Context, cli *whatsmeow.Client, content waBinary.Node) (*waBinary.Node, error) {
+	timer := time.NewTimer(catalogQueryTimeout)
+	defer timer.Stop()
+	internals := cli.DangerousInternals()
+	id := internals.GenerateRequestID()
+	waiter := internals.WaitResponse(id)
+	err := internals.SendNode(ctx, waBinary.Node{
+		Tag: "iq",
+		Attrs: waBinary.Attrs{
+			"id":    id,
+			"xmlns": "w:biz:catalog",
+			"type":  "get",
+			"to":    types.ServerJID,
+		},
+		Content: []waBinary.Node{content},
+	})
+	if err != nil {
+		internals.CancelResponse(id, waiter)
+		return nil, err
+	}
+
+	select {
+	case resp := <-waiter:
+		if resp.Tag == "xmlstreamend" || resp.Tag == "stream:error" {
+			return nil, whatsmeow.ErrIQDisconnected
+		}
+		if resp.AttrGetter().OptionalString("type") != "error" {
+			return resp, nil
+		}
+		iqErr := &whatsmeow.IQError{RawNode: resp}
+		if errNode, ok := resp.GetOptionalChildByTag("error"); ok {
+			iqErr.ErrorNode = &errNode
+			iqErr.Code = errNode.AttrGetter().OptionalInt("code")
+			iqErr.Text = errNode.AttrGetter().OptionalString("text")
+		}
+		return nil, iqErr
+	case <-ctx.Done():
+		internals.CancelResponse(id, waiter)
+		return nil, ctx.Err()
+	case <-timer.C:
+		internals.CancelResponse(id, waiter)
+		return nil, whatsmeow.ErrIQTimedOut
+	}
+}
+
+// catalogErrorStatus maps a failed catalog query to a status code
+func catalogErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, whatsmeow.ErrIQNotFound):
+		// Not a business, no catalog, or no such product
+		return http.StatusNotFound
+	case errors.Is(err, whatsmeow.ErrIQForbidden), errors.Is(err, whatsmeow.ErrIQNotAuthorized):
+		return http.StatusForbidden
+	case errors.Is(err, whatsmeow.ErrIQBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, whatsmeow.ErrIQTimedOut), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// businessCatalogHandler lists a page of a business's products. jid defaults to the
+// account's own; after is the cursor of the previous page.
+func businessCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	limit := defaultCatalogLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxCatalogLimit {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxCatalogLimit))
+			return
+		}
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	business, err := session.parseBusinessJID(r.URL.Query().Get("jid"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	catalog, err := session.Client.GetBusinessCatalog(r.Context(), business, limit, r.URL.Query().Get("after"))
+	if err != nil {
+		errorResponse(w, catalogErrorStatus(err), fmt.Sprintf("failed to get catalog: %v", err))
+		return
+	}
+	jsonResponse(w, catalog)
+}
+
+// businessProductHandler returns one product of a business's catalog
+func businessProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	productID := r.URL.Query().Get("product_id")
+	if productID == "" {
+		errorResponse(w, http.StatusBadRequest, "product_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	business, err := session.parseBusinessJID(r.URL.Query().Get("jid"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	product, err := session.Client.GetBusinessProduct(r.Context(), business, productID)
+	if err != nil {
+		errorResponse(w, catalogErrorStatus(err), fmt.Sprintf("failed to get product: %v", err))
+		return
+	}
+	jsonResponse(w, product)
+}
+
+// sendProductHandler sends a product of a business's catalog as a product card, or
+// without product_id a card for the whole catalog
+func sendProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID      int    `json:"user_id"`
+		ChatJID     string `json:"chat_jid"`
+		BusinessJID string `json:"business_jid,omitempty"` // defaults to the account's own catalog
+		ProductID   string `json:"product_id,omitempty"`
+		Body        string `json:"body,omitempty"`
+		Footer      string `json:"footer,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	var limits limitCheck
+	limits.length("body", req.Body, maxCaptionLength)
+	limits.length("footer", req.Footer, maxCaptionLength)
+	if limits.reject(w) {
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	business, err := session.parseBusinessJID(req.BusinessJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid business_jid")
+		return
+	}
+
+	ctx := r.Context()
+	msg := &waE2E.ProductMessage{
+		BusinessOwnerJID: proto.String(business.String()),
+	}
+	if req.Body != "" {
+		msg.Body = proto.String(req.Body)
+	}
+	if req.Footer != "" {
+		msg.Footer = proto.String(req.Footer)
+	}
+	if req.ProductID == "" {
+		msg.Catalog = &waE2E.ProductMessage_CatalogSnapshot{}
+	} else {
+		product, err := session.Client.GetBusinessProduct(ctx, business, req.ProductID)
+		if err != nil {
+			errorResponse(w, catalogErrorStatus(err), fmt.Sprintf("failed to get product: %v", err))
+			return
+		}
+		msg.Product = &waE2E.ProductMessage_ProductSnapshot{
+			ProductID:       proto.String(product.ID),
+			Title:           proto.String(product.Name),
+			Description:     proto.String(product.Description),
+			CurrencyCode:    proto.String(product.Currency),
+			PriceAmount1000: proto.Int64(product.PriceAmount1000),
+			RetailerID:      proto.String(product.RetailerID),
+			URL:             proto.String(product.URL),
+		}
+		if product.ImageURL != "" {
+			// The card shows without a picture if it can't be attached
+			if image, err := session.uploadProductImage(ctx, product.ImageURL); err != nil {
+				log.Printf("[catalog] User %d: failed to attach image of product %s: %v", session.UserID, product.ID, err)
+			} else {
+				msg.Product.ProductImage = image
+				msg.Product.ProductImageCount = proto.Uint32(1)
+			}
+		}
+	}
+
+	resp, err := session.Client.SendMessage(ctx, jid, &waE2E.Message{ProductMessage: msg})
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
+
+// parseBusinessJID parses the JID of a business whose catalog to use; empty means the
+// account's own
+func (s *UserSession) parseBusinessJID(raw string) (types.JID, error) {
+	if raw == "" {
+		raw = "me"
+	}
+	jid, err := s.parseChatJID(raw)
+	if err != nil {
+		return jid, err
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return jid, errors.New("not a user JID")
+	}
+	return jid.ToNonAD(), nil
+}
+
+// uploadProductImage re-uploads a product's catalog image as message media
+func (s *UserSession) uploadProductImage(ctx context.Context, url string) (*waE2E.ImageMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := catalogImageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaSize["image"]+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxMediaSize["image"] {
+		return nil, errors.New("image too large")
+	}
+
+	mimeType := sniffMimeType(data)
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	uploaded, err := s.Client.Upload(ctx, data, whatsmeow.MediaImage)
+	if err != nil {
+		return nil, err
+	}
+	return &waE2E.ImageMessage{
+		URL:           proto.String(uploaded.URL),
+		DirectPath:    proto.String(uploaded.DirectPath),
+		MediaKey:      uploaded.MediaKey,
+		Mimetype:      proto.String(mimeType),
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    proto.Uint64(uint64(len(data))),
+	}, nil
+}
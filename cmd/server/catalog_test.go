@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func textNode(tag, text string) waBinary.Node {
+	return waBinary.Node{Tag: tag, Content: []byte(text)}
+}
+
+func TestParseCatalog(t *testing.T) {
+	resp := &waBinary.Node{Tag: "iq", Content: []waBinary.Node{{
+		Tag: "product_catalog",
+		Content: []waBinary.Node{
+			{Tag: "product", Attrs: waBinary.Attrs{"id": "7001", "is_hidden": "false"}, Content: []waBinary.Node{
+				textNode("name", "Espresso"),
+				textNode("retailer_id", "SKU-1"),
+				textNode("price", "2500"),
+				textNode("currency", "EUR"),
+				{Tag: "media", Content: []waBinary.Node{{Tag: "image", Content: []waBinary.Node{
+					textNode("request_image_url", "https://cdn.example/espresso-100.jpg"),
+					textNode("original_image_url", "https://cdn.example/espresso.jpg"),
+				}}}},
+				{Tag: "status_info", Content: []waBinary.Node{textNode("status", "APPROVED")}},
+			}},
+			{Tag: "product", Attrs: waBinary.Attrs{"id": "7002", "is_hidden": "true"}, Content: []waBinary.Node{
+				textNode("name", "Decaf"),
+			}},
+			{Tag: "paging", Content: []waBinary.Node{textNode("after", "cursor-2")}},
+		},
+	}}}
+
+	catalog, err := parseCatalog(resp)
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	if len(catalog.Products) != 2 || catalog.Cursor != "cursor-2" {
+		t.Fatalf("expected 2 products and a cursor, got %+v", catalog)
+	}
+	want := BusinessProduct{
+		ID: "7001", RetailerID: "SKU-1", Name: "Espresso", Currency: "EUR", PriceAmount1000: 2500,
+		ImageURL: "https://cdn.example/espresso-100.jpg", ReviewStatus: "APPROVED",
+	}
+	if catalog.Products[0] != want {
+		t.Errorf("expected %+v, got %+v", want, catalog.Products[0])
+	}
+	if !catalog.Products[1].Hidden {
+		t.Error("expected the second product to be hidden")
+	}
+
+	if _, err := parseCatalog(&waBinary.Node{Tag: "iq"}); err == nil {
+		t.Error("expected a response without a catalog to fail")
+	}
+
+	product, err := parseProductResponse(&waBinary.Node{Tag: "iq", Content: []waBinary.Node{{
+		Tag: "product", Content: []waBinary.Node{textNode("id", "7003"), textNode("name", "Cortado")},
+	}}})
+	if err != nil || product.ID != "7003" || product.Name != "Cortado" {
+		t.Errorf("expected the product, got %+v (%v)", product, err)
+	}
+}
+
+func TestBusinessCatalogHandlers(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	businessCatalogHandler(w, httptest.NewRequest(http.MethodGet, "/business/catalog?user_id=1&jid=15557654321@s.whatsapp.net", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a catalog, got %d", w.Code)
+	}
+
+	mock.Catalog = &BusinessCatalog{Products: []BusinessProduct{{ID: "7001", Name: "Espresso"}}, Cursor: "next"}
+	w = httptest.NewRecorder()
+	businessCatalogHandler(w, httptest.NewRequest(http.MethodGet, "/business/catalog?user_id=1&limit=5&after=prev", nil))
+	var catalog BusinessCatalog
+	json.Unmarshal(w.Body.Bytes(), &catalog)
+	if w.Code != http.StatusOK || len(catalog.Products) != 1 || catalog.Cursor != "next" {
+		t.Fatalf("expected the catalog, got %d: %s", w.Code, w.Body.String())
+	}
+	call := mock.GetCallsByMethod("GetBusinessCatalog")[1]
+	if jid := call.Args[1].(types.JID); jid.User != "1234567890" || call.Args[2] != 5 || call.Args[3] != "prev" {
+		t.Errorf("expected the own catalog from the cursor, got %v", call.Args[1:])
+	}
+
+	w = httptest.NewRecorder()
+	businessCatalogHandler(w, httptest.NewRequest(http.MethodGet, "/business/catalog?user_id=1&limit=1000", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a limit over %d, got %d", maxCatalogLimit, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	businessProductHandler(w, httptest.NewRequest(http.MethodGet, "/business/product?user_id=1&product_id=7001", nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("Espresso")) {
+		t.Errorf("expected the product, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if status := catalogErrorStatus(whatsmeow.ErrIQTimedOut); status != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for an unanswered query, got %d", status)
+	}
+}
+
+func TestSendProductHandler(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xd8\xff product"))
+	}))
+	defer cdn.Close()
+
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.Catalog = &BusinessCatalog{Products: []BusinessProduct{{
+		ID: "7001", Name: "Espresso", Currency: "EUR", PriceAmount1000: 2500, ImageURL: cdn.URL + "/espresso.jpg",
+	}}}
+
+	w := httptest.NewRecorder()
+	sendProductHandler(w, httptest.NewRequest(http.MethodPost, "/messages/product",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "product_id": "7001", "body": "Today's special"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	msg := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message).GetProductMessage()
+	product := msg.GetProduct()
+	if product.GetProductID() != "7001" || product.GetPriceAmount1000() != 2500 || product.GetCurrencyCode() != "EUR" || msg.GetBody() != "Today's special" {
+		t.Errorf("unexpected product message %v", msg)
+	}
+	if product.GetProductImage().GetMimetype() != "image/jpeg" || len(mock.GetCallsByMethod("Upload")) != 1 {
+		t.Errorf("expected the product image to be attached, got %v", product.GetProductImage())
+	}
+	if msg.GetBusinessOwnerJID() != "1234567890@s.whatsapp.net" {
+		t.Errorf("expected the own business, got %q", msg.GetBusinessOwnerJID())
+	}
+
+	// Without a product_id the whole catalog is shared
+	w = httptest.NewRecorder()
+	sendProductHandler(w, httptest.NewRequest(http.MethodPost, "/messages/product",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net"}`)))
+	if msg := mock.GetCallsByMethod("SendMessage")[1].Args[2].(*waE2E.Message).GetProductMessage(); w.Code != http.StatusOK || msg.GetCatalog() == nil {
+		t.Errorf("expected a catalog message, got %d: %v", w.Code, msg)
+	}
+
+	w = httptest.NewRecorder()
+	sendProductHandler(w, httptest.NewRequest(http.MethodPost, "/messages/product",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "product_id": "nope"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown product, got %d", w.Code)
+	}
+}
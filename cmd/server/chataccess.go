@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// chatAccessConfig is the chats a session may talk to. With an allow list only those
+// chats get through; the deny list shuts chats out either way.
+type chatAccessConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	allow, deny map[string]bool // the lists as sets, filled in by normalize
+}
+
+// invalidJIDsError lists the entries of a chat access list that aren't JIDs
+type invalidJIDsError struct {
+	JIDs []string
+}
+
+func (e *invalidJIDsError) Error() string {
+	return fmt.Sprintf("invalid jids: %v", e.JIDs)
+}
+
+// normalize parses both lists into chat JIDs, dropping devices and duplicates, and
+// fails with an *invalidJIDsError if any entries aren't JIDs
+func (c chatAccessConfig) normalize() (chatAccessConfig, error) {
+	var invalid []string
+	clean := func(raw []string) ([]string, map[string]bool) {
+		out := []string{}
+		seen := make(map[string]bool)
+		for _, s := range raw {
+			jid, err := types.ParseJID(s)
+			if err != nil || jid.User == "" || jid.Server == "" {
+				invalid = append(invalid, s)
+				continue
+			}
+			key := jid.ToNonAD().String()
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, key)
+			}
+		}
+		return out, seen
+	}
+	var cfg chatAccessConfig
+	cfg.Allow, cfg.allow = clean(c.Allow)
+	cfg.Deny, cfg.deny = clean(c.Deny)
+	if len(invalid) > 0 {
+		return cfg, &invalidJIDsError{JIDs: invalid}
+	}
+	return cfg, nil
+}
+
+// ChatAccessSetting ring-fences a session to the chats its lists let through: nothing
+// from other chats is stored or emitted, including their receipts, presence and group
+// changes, their stored history isn't served, and sends to them are refused. The zero
+// value lets everything through.
+type ChatAccessSetting struct {
+	persistedSetting[chatAccessConfig]
+}
+
+// Open reports whether both lists are empty, letting every chat through
+func (c *ChatAccessSetting) Open() bool {
+	cfg := c.Get()
+	return len(cfg.allow) == 0 && len(cfg.deny) == 0
+}
+
+// Allows reports whether a chat passes the lists, given every address it's known by: a
+// contact listed by phone number may write from their LID and the other way around.
+// Empty JIDs are ignored.
+func (c *ChatAccessSetting) Allows(addresses ...types.JID) bool {
+	cfg := c.Get()
+	allowed := len(cfg.allow) == 0
+	for _, jid := range addresses {
+		if jid.IsEmpty() {
+			continue
+		}
+		key := jid.ToNonAD().String()
+		if cfg.deny[key] {
+			return false
+		}
+		allowed = allowed || cfg.allow[key]
+	}
+	return allowed
+}
+
+// ChatNotAllowedError is returned instead of sending to a chat the session's access
+// lists shut out. Nothing was sent.
+type ChatNotAllowedError struct {
+	Chat types.JID
+}
+
+func (e *ChatNotAllowedError) Error() string {
+	return fmt.Sprintf("chat %s is not allowed for this session", e.Chat)
+}
+
+// chatAllowed reports whether the session may exchange messages with chat. Its own
+// chat, which also carries history requests and canaries, is always allowed.
+func (s *UserSession) chatAllowed(chat types.JID) bool {
+	if s.ChatAccess.Open() || s.isSelfChat(chat) {
+		return true
+	}
+	return s.ChatAccess.Allows(chat, s.altJID(chat))
+}
+
+// altJID returns the other address of a contact, the LID of a phone number or the phone
+// number of a LID, or EmptyJID if the device store doesn't know it
+func (s *UserSession) altJID(jid types.JID) types.JID {
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return types.EmptyJID
+	}
+	alt, err := s.Client.GetStore().GetAltJID(context.Background(), jid.ToNonAD())
+	if err != nil {
+		log.Printf("[chat-access] User %d: failed to look up the other address of %s: %v", s.UserID, jid, err)
+		return types.EmptyJID
+	}
+	return alt
+}
+
+// chatNotAllowedResponse answers a read of a chat the access lists shut out
+func chatNotAllowedResponse(w http.ResponseWriter) {
+	errorResponseWith(w, http.StatusForbidden, "chat not allowed for this session", map[string]interface{}{"code": "chat_not_allowed"})
+}
+
+// chatAccessHandler reads (GET) or replaces (POST) the chats a session is limited to
+func chatAccessHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[chatAccessConfig]{
+		name:    "chat access",
+		setting: func(s *UserSession) settingStore[chatAccessConfig] { return &s.ChatAccess },
+		view: func(cfg chatAccessConfig) interface{} {
+			// Lists are never null, even before they're first set
+			return chatAccessConfig{Allow: append([]string{}, cfg.Allow...), Deny: append([]string{}, cfg.Deny...)}
+		},
+		refuse: func(w http.ResponseWriter, err error) {
+			var invalid *invalidJIDsError
+			if errors.As(err, &invalid) {
+				errorResponseWith(w, http.StatusBadRequest, "invalid jid", map[string]interface{}{"invalid": invalid.JIDs})
+				return
+			}
+			errorResponse(w, http.StatusBadRequest, err.Error())
+		},
+	})
+}
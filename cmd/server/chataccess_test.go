@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestChatAccessSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chataccess_1.json")
+	var c ChatAccessSetting
+	if err := c.load(path); err != nil {
+		t.Fatal(err)
+	}
+	group := types.NewJID("120363000000000001", types.GroupServer)
+	other := types.NewJID("15557654321", types.DefaultUserServer)
+	if !c.Allows(group) || !c.Allows(other) {
+		t.Fatal("expected every chat to be allowed without lists")
+	}
+
+	if _, err := c.Set(chatAccessConfig{Allow: []string{"not a jid@"}}); err == nil {
+		t.Error("expected an invalid jid to be refused")
+	}
+	cfg, err := c.Set(chatAccessConfig{Allow: []string{group.String(), group.String()}, Deny: []string{"15550000000:3@s.whatsapp.net"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Allow) != 1 || cfg.Deny[0] != "15550000000@s.whatsapp.net" {
+		t.Errorf("expected deduplicated chat JIDs without devices, got %+v", cfg)
+	}
+	if !c.Allows(group) || c.Allows(other) {
+		t.Error("expected only the allowed group through")
+	}
+
+	var reloaded ChatAccessSetting
+	if err := reloaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Allows(other) || reloaded.Allows(types.NewJID("15550000000", types.DefaultUserServer)) {
+		t.Error("expected the lists to be persisted")
+	}
+}
+
+func TestChatAccess_Session(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Client = &pacedClient{WhatsAppClient: mock, session: session}
+
+	w := httptest.NewRecorder()
+	chatAccessHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/chat-access",
+		bytes.NewBufferString(`{"user_id": 1, "deny": ["15557654321@s.whatsapp.net", "bogus@"]}`)))
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("bogus@")) {
+		t.Errorf("expected 400 naming the invalid jid, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	chatAccessHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/chat-access",
+		bytes.NewBufferString(`{"user_id": 1, "deny": ["15557654321@s.whatsapp.net"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	chatAccessHandler(w, httptest.NewRequest(http.MethodGet, "/sessions/chat-access?user_id=1", nil))
+	var cfg chatAccessConfig
+	json.NewDecoder(w.Body).Decode(&cfg)
+	if len(cfg.Allow) != 0 || len(cfg.Deny) != 1 {
+		t.Errorf("expected the deny list back, got %+v", cfg)
+	}
+
+	// Sends to the denied chat are refused before reaching WhatsApp
+	w = httptest.NewRecorder()
+	sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "hi"}`)))
+	if w.Code != http.StatusForbidden || !bytes.Contains(w.Body.Bytes(), []byte(`"chat_not_allowed"`)) {
+		t.Errorf("expected 403 chat_not_allowed, got %d: %s", w.Code, w.Body.String())
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 0 {
+		t.Errorf("expected nothing sent, got %d sends", len(calls))
+	}
+	// Notes to self always go out
+	own := session.Client.GetStore().GetID().ToNonAD()
+	if _, err := session.Client.SendMessage(context.Background(), own, nil); err != nil {
+		t.Errorf("expected a note to self to go out, got %v", err)
+	}
+
+	// Nothing from the denied contact is emitted, whichever address they write from
+	denied := types.NewJID("15557654321", types.DefaultUserServer)
+	deniedLID := types.NewJID("98765432109876", types.HiddenUserServer)
+	mock.SetLIDMapping(denied, deniedLID)
+	session.handleEvent(incomingText(denied, "D1", "hello"))
+	session.handleEvent(incomingText(deniedLID, "D2", "hello"))
+	session.handleEvent(&events.Receipt{MessageSource: types.MessageSource{Chat: deniedLID, Sender: deniedLID},
+		MessageIDs: []types.MessageID{"OUT1"}, Type: types.ReceiptTypeRead})
+	session.handleEvent(&events.Presence{From: denied})
+	session.handleEvent(incomingText(types.NewJID("15551112222", types.DefaultUserServer), "A1", "hello"))
+	if evt := <-session.EventChan; evt.Type != "message" || evt.Payload.(MessagePayload).ID != "A1" {
+		t.Errorf("expected only the allowed chat's message, got %s %+v", evt.Type, evt.Payload)
+	}
+	select {
+	case evt := <-session.EventChan:
+		t.Errorf("expected no more events, got %+v", evt)
+	default:
+	}
+
+	// Nor is its stored history served
+	session.Messages.Save(context.Background(), MessagePayload{ID: "OLD", ChatJID: denied.String(), Text: "before", Timestamp: 1700000000})
+	w = httptest.NewRecorder()
+	getMessagesHandler(w, httptest.NewRequest(http.MethodGet, "/messages?user_id=1&chat_jid="+deniedLID.String(), nil))
+	if w.Code != http.StatusForbidden || !bytes.Contains(w.Body.Bytes(), []byte(`"chat_not_allowed"`)) {
+		t.Errorf("expected 403 chat_not_allowed for the denied chat's history, got %d: %s", w.Code, w.Body.String())
+	}
+}
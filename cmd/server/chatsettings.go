@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ChatSettingsPayload is the response of GET /chats/settings
+type ChatSettingsPayload struct {
+	JID     string `json:"jid"`
+	IsGroup bool   `json:"is_group"`
+	// EphemeralTimer is the disappearing messages timer in seconds, 0 when off.
+	// For direct chats it's only known once a message or timer change has been seen;
+	// EphemeralKnown is false until then.
+	EphemeralTimer uint32 `json:"ephemeral_timer"`
+	EphemeralKnown bool   `json:"ephemeral_known"`
+	Muted          bool   `json:"muted"`
+	// MutedUntil is a unix timestamp, -1 when muted indefinitely
+	MutedUntil   int64 `json:"muted_until,omitempty"`
+	Archived     bool  `json:"archived"`
+	Pinned       bool  `json:"pinned"`
+	AnnounceOnly bool  `json:"announce_only"`
+	Locked       bool  `json:"locked"`
+}
+
+// EphemeralTimers remembers the disappearing-messages timer of direct chats as it's
+// observed on incoming messages. WhatsApp only exposes it for groups via group info.
+// The zero value is ready to use.
+type EphemeralTimers struct {
+	mu     sync.RWMutex
+	timers map[string]uint32
+}
+
+func (e *EphemeralTimers) Set(chatJID string, seconds uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.timers == nil {
+		e.timers = make(map[string]uint32)
+	}
+	e.timers[chatJID] = seconds
+}
+
+func (e *EphemeralTimers) Get(chatJID string) (uint32, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	seconds, ok := e.timers[chatJID]
+	return seconds, ok
+}
+
+// observeEphemeral records the chat's timer from a timer change or from the expiration
+// that senders attach to every message while disappearing messages are on
+func (s *UserSession) observeEphemeral(v *events.Message) {
+	if v.Info.IsGroup {
+		return
+	}
+	chat := v.Info.Chat.String()
+	if protoMsg := v.Message.GetProtocolMessage(); protoMsg.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+		s.Ephemeral.Set(chat, protoMsg.GetEphemeralExpiration())
+		return
+	}
+	if info := core.ContextInfo(v.Message); info != nil {
+		s.Ephemeral.Set(chat, info.GetExpiration())
+	}
+}
+
+func getChatSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	chatJID := r.URL.Query().Get("chat_jid")
+	if chatJID == "" {
+		errorResponse(w, http.StatusBadRequest, "chat_jid required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	ctx := context.Background()
+	payload := ChatSettingsPayload{
+		JID:     jid.String(),
+		IsGroup: jid.Server == types.GroupServer,
+	}
+
+	if payload.IsGroup {
+		info, err := session.Client.GetGroupInfo(ctx, jid)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to get group info: "+err.Error())
+			return
+		}
+		session.refreshGroup(jid, info)
+		if info.IsEphemeral {
+			payload.EphemeralTimer = info.DisappearingTimer
+		}
+		payload.EphemeralKnown = true
+		payload.AnnounceOnly = info.IsAnnounce
+		payload.Locked = info.IsLocked
+	} else {
+		payload.EphemeralTimer, payload.EphemeralKnown = session.Ephemeral.Get(payload.JID)
+	}
+
+	// Mute, archive and pin state come from app state sync with the phone
+	settings, err := session.Client.GetStore().GetChatSettings().GetChatSettings(ctx, jid)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to get chat settings: "+err.Error())
+		return
+	}
+	payload.Archived = settings.Archived
+	payload.Pinned = settings.Pinned
+	payload.Muted, payload.MutedUntil = muteState(settings)
+
+	jsonResponse(w, payload)
+}
+
+// muteState reports whether a chat is muted now, and until when (-1 when indefinitely)
+func muteState(settings types.LocalChatSettings) (bool, int64) {
+	switch {
+	case settings.MutedUntil.Equal(store.MutedForever):
+		return true, -1
+	case settings.MutedUntil.After(time.Now()):
+		return true, settings.MutedUntil.Unix()
+	}
+	return false, 0
+}
+
+// flagChatState marks a message with its chat's mute and archive state as synced from
+// the phone, so consumers that notify can respect the user's mutes
+func (s *UserSession) flagChatState(payload *MessagePayload, chat types.JID) {
+	settings, err := s.Client.GetStore().GetChatSettings().GetChatSettings(context.Background(), chat)
+	if err != nil {
+		log.Printf("Failed to get chat settings of %s for user %d: %v", chat, s.UserID, err)
+		return
+	}
+	payload.ChatMuted, _ = muteState(settings)
+	payload.ChatArchived = settings.Archived
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func getChatSettings(t *testing.T, query string) (*httptest.ResponseRecorder, ChatSettingsPayload) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/chats/settings?"+query, nil)
+	w := httptest.NewRecorder()
+	getChatSettingsHandler(w, req)
+
+	var payload ChatSettingsPayload
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return w, payload
+}
+
+func TestGetChatSettingsHandler(t *testing.T) {
+	t.Run("requires user_id and chat_jid", func(t *testing.T) {
+		manager = setupTestManager(t)
+		if w, _ := getChatSettings(t, "chat_jid=123@s.whatsapp.net"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 without user_id, got %d", w.Code)
+		}
+		if w, _ := getChatSettings(t, "user_id=1"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 without chat_jid, got %d", w.Code)
+		}
+	})
+
+	t.Run("returns 404 for unknown session", func(t *testing.T) {
+		manager = setupTestManager(t)
+		if w, _ := getChatSettings(t, "user_id=999&chat_jid=123@s.whatsapp.net"); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("combines group info and app state", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		mock.GroupInfo = &types.GroupInfo{
+			GroupEphemeral: types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 604800},
+			GroupAnnounce:  types.GroupAnnounce{IsAnnounce: true},
+		}
+		groupJID := types.NewJID("120363000000000000", types.GroupServer)
+		mock.store.ChatSettings.Settings[groupJID] = types.LocalChatSettings{
+			Found: true, MutedUntil: store.MutedForever, Archived: true,
+		}
+		injectMockSession(manager, 960, mock)
+
+		w, payload := getChatSettings(t, "user_id=960&chat_jid="+groupJID.String())
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if !payload.IsGroup || payload.EphemeralTimer != 604800 || !payload.EphemeralKnown {
+			t.Errorf("unexpected ephemeral state: %+v", payload)
+		}
+		if !payload.AnnounceOnly || !payload.Archived || payload.Pinned {
+			t.Errorf("unexpected flags: %+v", payload)
+		}
+		if !payload.Muted || payload.MutedUntil != -1 {
+			t.Errorf("expected muted forever, got %+v", payload)
+		}
+	})
+
+	t.Run("expired mute is reported as unmuted", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		chat := types.NewJID("15551234567", types.DefaultUserServer)
+		mock.store.ChatSettings.Settings[chat] = types.LocalChatSettings{
+			Found: true, MutedUntil: time.Now().Add(-time.Hour), Pinned: true,
+		}
+		injectMockSession(manager, 961, mock)
+
+		w, payload := getChatSettings(t, "user_id=961&chat_jid="+chat.String())
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if payload.Muted || payload.MutedUntil != 0 || !payload.Pinned {
+			t.Errorf("unexpected settings: %+v", payload)
+		}
+		if payload.EphemeralKnown {
+			t.Error("expected direct chat timer to be unknown before any message")
+		}
+	})
+
+	t.Run("direct chat timer learned from messages", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(manager, 962, mock)
+		chat := types.NewJID("15557654321", types.DefaultUserServer)
+
+		expiration := uint32(86400)
+		session.handleEvent(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+				ID:            "msg-eph",
+				Timestamp:     time.Now(),
+			},
+			Message: &waE2E.Message{
+				ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+					Text:        proto.String("hi"),
+					ContextInfo: &waE2E.ContextInfo{Expiration: &expiration},
+				},
+			},
+		})
+
+		w, payload := getChatSettings(t, "user_id=962&chat_jid="+chat.String())
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if !payload.EphemeralKnown || payload.EphemeralTimer != 86400 {
+			t.Errorf("expected 24h timer, got %+v", payload)
+		}
+	})
+
+	t.Run("handles group info error", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		mock.GroupInfoError = errors.New("not a participant")
+		injectMockSession(manager, 963, mock)
+
+		if w, _ := getChatSettings(t, "user_id=963&chat_jid=120363000000000000@g.us"); w.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500, got %d", w.Code)
+		}
+	})
+}
+
+func TestHandleEvent_FlagsChatState(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 964, mock)
+	muted := types.NewJID("15550000001", types.DefaultUserServer)
+	archived := types.NewJID("15550000002", types.DefaultUserServer)
+	mock.store.ChatSettings.Settings[muted] = types.LocalChatSettings{Found: true, MutedUntil: time.Now().Add(time.Hour)}
+	mock.store.ChatSettings.Settings[archived] = types.LocalChatSettings{Found: true, Archived: true, MutedUntil: time.Now().Add(-time.Hour)}
+
+	receive := func(chat types.JID) MessagePayload {
+		session.handleEvent(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+				ID:            "msg-" + chat.User,
+				Timestamp:     time.Now(),
+			},
+			Message: &waE2E.Message{Conversation: proto.String("hi")},
+		})
+		return (<-session.EventChan).Payload.(MessagePayload)
+	}
+	if p := receive(muted); !p.ChatMuted || p.ChatArchived {
+		t.Errorf("expected a muted chat, got %+v", p)
+	}
+	if p := receive(archived); p.ChatMuted || !p.ChatArchived {
+		t.Errorf("expected an archived chat whose mute expired, got %+v", p)
+	}
+}
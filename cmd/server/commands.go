@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultCommandPrefix = "!"
+
+// CommandConfig configures the built-in command router. Incoming text messages that start
+// with the prefix followed by a rule's command are answered by the server itself, either
+// from a template or by asking a webhook for the reply.
+type CommandConfig struct {
+	Prefix string        `json:"prefix,omitempty"` // defaults to "!"
+	Rules  []CommandRule `json:"rules"`
+}
+
+// CommandRule answers one command. Exactly one of Reply or Webhook must be set.
+type CommandRule struct {
+	Command string `json:"command"` // without the prefix, e.g. "ping"
+	// Reply is a text/template rendered with CommandInvocation
+	Reply string `json:"reply,omitempty"`
+	// Webhook receives the invocation as JSON and may answer {"reply": "..."}
+	Webhook string `json:"webhook,omitempty"`
+	// UserIDs limits the rule to these sessions; empty means every session
+	UserIDs []int `json:"user_ids,omitempty"`
+	// Consume stops matched messages from also being emitted to event consumers
+	Consume bool `json:"consume,omitempty"`
+
+	reply *template.Template
+}
+
+// CommandInvocation describes a matched command, for reply templates and webhooks
+type CommandInvocation struct {
+	UserID     int            `json:"user_id"`
+	Command    string         `json:"command"`
+	Args       string         `json:"args"`
+	ChatJID    string         `json:"chat_jid"`
+	SenderJID  string         `json:"sender_jid"`
+	SenderName string         `json:"sender_name"`
+	Message    MessagePayload `json:"message"`
+}
+
+func (c *CommandConfig) compile() error {
+	if c.Prefix == "" {
+		c.Prefix = defaultCommandPrefix
+	}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		rule.Command = strings.ToLower(strings.TrimPrefix(rule.Command, c.Prefix))
+		if rule.Command == "" || strings.ContainsAny(rule.Command, " \t\n") {
+			return fmt.Errorf("rule %d: command must be a single word", i)
+		}
+		if (rule.Reply == "") == (rule.Webhook == "") {
+			return fmt.Errorf("rule %q: set exactly one of reply or webhook", rule.Command)
+		}
+		if rule.Reply != "" {
+			tmpl, err := template.New(rule.Command).Parse(rule.Reply)
+			if err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Command, err)
+			}
+			rule.reply = tmpl
+		}
+	}
+	return nil
+}
+
+// match finds the rule for a message text, returning the rule and the text after the command
+func (c *CommandConfig) match(userID int, text string) (*CommandRule, string) {
+	if len(c.Rules) == 0 || !strings.HasPrefix(text, c.Prefix) {
+		return nil, ""
+	}
+	command, args, _ := strings.Cut(strings.TrimPrefix(text, c.Prefix), " ")
+	command = strings.ToLower(strings.TrimSpace(command))
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.Command != command {
+			continue
+		}
+		if len(rule.UserIDs) > 0 && !slices.Contains(rule.UserIDs, userID) {
+			continue
+		}
+		return rule, strings.TrimSpace(args)
+	}
+	return nil, ""
+}
+
+// routeCommand answers a message if it invokes a configured command. It reports whether
+// the message was consumed and should not be emitted to consumers.
+func (s *UserSession) routeCommand(payload MessagePayload) bool {
+	if payload.IsFromMe || payload.Text == "" || payload.MediaType != "" {
+		return false
+	}
+	rule, args := currentConfig().Commands.match(s.UserID, payload.Text)
+	if rule == nil {
+		return false
+	}
+
+	inv := CommandInvocation{
+		UserID:     s.UserID,
+		Command:    rule.Command,
+		Args:       args,
+		ChatJID:    payload.ChatJID,
+		SenderJID:  payload.SenderJID,
+		SenderName: payload.SenderName,
+		Message:    payload,
+	}
+	log.Printf("[commands] User %d: %q from %s in %s", s.UserID, rule.Command, inv.SenderJID, inv.ChatJID)
+	// Webhooks can be slow; never hold up the event loop
+	go s.answerCommand(rule, inv)
+	return rule.Consume
+}
+
+func (s *UserSession) answerCommand(rule *CommandRule, inv CommandInvocation) {
+	var reply string
+	var err error
+	if rule.reply != nil {
+		var buf bytes.Buffer
+		err = rule.reply.Execute(&buf, inv)
+		reply = buf.String()
+	} else {
+		// The webhook needs the command's arguments to answer it, but not the message
+		posted := inv
+		if s.Redaction.Enabled() {
+			posted.Message = redactMessage(posted.Message)
+		}
+		reply, err = callCommandWebhook(rule.Webhook, posted)
+	}
+	if err != nil {
+		log.Printf("[commands] User %d: %q failed: %v", s.UserID, rule.Command, err)
+		return
+	}
+	if strings.TrimSpace(reply) == "" {
+		return
+	}
+
+	chat, err := types.ParseJID(inv.ChatJID)
+	if err != nil {
+		log.Printf("[commands] User %d: invalid chat %s: %v", s.UserID, inv.ChatJID, err)
+		return
+	}
+	msg := &waE2E.Message{Conversation: proto.String(reply)}
+	if _, err := s.Client.SendMessage(context.Background(), chat, msg); err != nil {
+		log.Printf("[commands] User %d: failed to send %q reply: %v", s.UserID, rule.Command, err)
+		s.emitSendFailed("command", inv.Message.ID, chat, "", err)
+	}
+}
+
+// callCommandWebhook posts the invocation and returns the reply from the response, if any
+func callCommandWebhook(url string, inv CommandInvocation) (string, error) {
+	body, err := json.Marshal(inv)
+	if err != nil {
+		return "", err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Reply string `json:"reply"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid webhook response: %w", err)
+	}
+	return result.Reply, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// useConfig installs cfg as the active config for the duration of the test
+func useConfig(t *testing.T, data string) {
+	t.Helper()
+	cfg, err := parseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	prev := serverConfig.Load()
+	serverConfig.Store(cfg)
+	t.Cleanup(func() { serverConfig.Store(prev) })
+}
+
+// waitForSentText waits for the mock client to send a text message and returns it
+func waitForSentText(t *testing.T, mock *MockWhatsAppClient) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if calls := mock.GetCallsByMethod("SendMessage"); len(calls) > 0 {
+			return calls[0].Args[2].(*waE2E.Message).GetConversation()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected a reply to be sent")
+	return ""
+}
+
+func incomingText(chat types.JID, id, text string) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            id,
+			PushName:      "Alice",
+			Timestamp:     time.Unix(1700000000, 0),
+		},
+		Message: &waE2E.Message{Conversation: proto.String(text)},
+	}
+}
+
+func TestParseConfig_Commands(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"template rule", `{"commands": {"rules": [{"command": "ping", "reply": "pong"}]}}`, false},
+		{"webhook rule", `{"commands": {"rules": [{"command": "!weather", "webhook": "http://localhost/w"}]}}`, false},
+		{"no response", `{"commands": {"rules": [{"command": "ping"}]}}`, true},
+		{"both responses", `{"commands": {"rules": [{"command": "ping", "reply": "pong", "webhook": "http://localhost/w"}]}}`, true},
+		{"multi-word command", `{"commands": {"rules": [{"command": "two words", "reply": "x"}]}}`, true},
+		{"bad template", `{"commands": {"rules": [{"command": "ping", "reply": "{{.Nope"}]}}`, true},
+		{"not json", `commands:`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandConfig_match(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{"commands": {"rules": [
+		{"command": "!Ping", "reply": "pong"},
+		{"command": "secret", "reply": "hi", "user_ids": [7]}
+	]}}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	commands := &cfg.Commands
+
+	if rule, args := commands.match(1, "!ping  some args "); rule == nil || rule.Command != "ping" || args != "some args" {
+		t.Errorf("expected ping with args, got %v %q", rule, args)
+	}
+	if rule, _ := commands.match(1, "!PING"); rule == nil {
+		t.Error("expected commands to match case-insensitively")
+	}
+	if rule, _ := commands.match(1, "ping"); rule != nil {
+		t.Error("expected text without prefix not to match")
+	}
+	if rule, _ := commands.match(1, "!pingpong"); rule != nil {
+		t.Error("expected longer word not to match")
+	}
+	if rule, _ := commands.match(1, "!secret"); rule != nil {
+		t.Error("expected rule restricted to other users not to match")
+	}
+	if rule, _ := commands.match(7, "!secret"); rule == nil {
+		t.Error("expected restricted rule to match its user")
+	}
+}
+
+func TestUserSession_routeCommand(t *testing.T) {
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	t.Run("template reply", func(t *testing.T) {
+		useConfig(t, `{"commands": {"rules": [{"command": "echo", "reply": "{{.SenderName}} said {{.Args}}"}]}}`)
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+
+		session.handleEvent(incomingText(chat, "M1", "!echo hello there"))
+
+		if got := waitForSentText(t, mock); got != "Alice said hello there" {
+			t.Errorf("unexpected reply %q", got)
+		}
+		if len(session.EventChan) != 1 {
+			t.Errorf("expected command message to still be emitted, got %d events", len(session.EventChan))
+		}
+	})
+
+	t.Run("webhook reply", func(t *testing.T) {
+		var got CommandInvocation
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(map[string]string{"reply": "sunny"})
+		}))
+		defer srv.Close()
+		useConfig(t, `{"commands": {"rules": [{"command": "weather", "webhook": "`+srv.URL+`"}]}}`)
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 3, Client: mock, EventChan: make(chan MessageEvent, 10)}
+
+		session.handleEvent(incomingText(chat, "M2", "!weather berlin"))
+
+		if reply := waitForSentText(t, mock); reply != "sunny" {
+			t.Errorf("unexpected reply %q", reply)
+		}
+		if got.UserID != 3 || got.Command != "weather" || got.Args != "berlin" || got.Message.ID != "M2" {
+			t.Errorf("unexpected invocation: %+v", got)
+		}
+	})
+
+	t.Run("consumed command is stored but not emitted", func(t *testing.T) {
+		useConfig(t, `{"commands": {"rules": [{"command": "ping", "reply": "pong", "consume": true}]}}`)
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+		session.Messages = newTestMessageStore(t)
+
+		session.handleEvent(incomingText(chat, "M3", "!ping"))
+
+		waitForSentText(t, mock)
+		if len(session.EventChan) != 0 {
+			t.Errorf("expected consumed command not to be emitted, got %d events", len(session.EventChan))
+		}
+		stored, _ := session.Messages.List(t.Context(), chat.String(), 0, 10)
+		if len(stored) != 1 || stored[0].ID != "M3" {
+			t.Errorf("expected consumed command to be stored, got %+v", stored)
+		}
+	})
+
+	t.Run("own messages are ignored", func(t *testing.T) {
+		useConfig(t, `{"commands": {"rules": [{"command": "ping", "reply": "pong", "consume": true}]}}`)
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+
+		evt := incomingText(chat, "M4", "!ping")
+		evt.Info.IsFromMe = true
+		session.handleEvent(evt)
+
+		if len(session.EventChan) != 1 {
+			t.Errorf("expected own message to be emitted normally, got %d events", len(session.EventChan))
+		}
+		time.Sleep(50 * time.Millisecond)
+		if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 0 {
+			t.Errorf("expected no reply to own message, got %d", len(calls))
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webhookClient is shared by the config-driven hooks that call out to other services
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// ServerConfig holds the optional behaviour configured in the JSON file named by CONFIG_FILE.
+// Plain settings such as ports and paths stay in environment variables; this file is for
+// structured rules that don't fit in one.
+type ServerConfig struct {
+	Commands CommandConfig `json:"commands"`
+	Routing  RoutingConfig `json:"routing"`
+	Limits   LimitsConfig  `json:"limits"`
+	Warmup   WarmupConfig  `json:"warmup"`
+}
+
+// LimitsConfig overrides the MEDIA_*_CONCURRENCY environment variables. Unset fields
+// keep the environment's value.
+type LimitsConfig struct {
+	MediaUploadConcurrency   *int `json:"media_upload_concurrency,omitempty"`
+	MediaDownloadConcurrency *int `json:"media_download_concurrency,omitempty"`
+}
+
+// defaultConfigReloadInterval is how often the config file is checked for changes
+const defaultConfigReloadInterval = 10 * time.Second
+
+var serverConfig atomic.Pointer[ServerConfig]
+
+// currentConfig returns the active configuration, or an empty one if none was loaded
+func currentConfig() *ServerConfig {
+	if cfg := serverConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &ServerConfig{}
+}
+
+// loadConfig reads and validates a config file
+func loadConfig(path string) (*ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// applyConfig makes cfg the active configuration. Messages already being handled finish
+// under the rules they started with.
+func applyConfig(cfg *ServerConfig) {
+	serverConfig.Store(cfg)
+	uploadLimiter.override(cfg.Limits.MediaUploadConcurrency)
+	downloadLimiter.override(cfg.Limits.MediaDownloadConcurrency)
+}
+
+// configWatcher reloads the config file when it changes, so rules and limits can be
+// updated without a restart dropping every event stream
+type configWatcher struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// configFile watches CONFIG_FILE; nil if it isn't set
+var configFile *configWatcher
+
+// reload reads and applies the config file. An invalid file leaves the active
+// configuration in place.
+func (c *configWatcher) reload() (*ServerConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(c.path)
+	if err != nil {
+		return nil, err
+	}
+	applyConfig(cfg)
+	c.modTime, c.size = info.ModTime(), info.Size()
+	return cfg, nil
+}
+
+func (c *configWatcher) changed() bool {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !info.ModTime().Equal(c.modTime) || info.Size() != c.size
+}
+
+// run polls the config file and reloads it whenever it changes
+func (c *configWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.changed() {
+			continue
+		}
+		if cfg, err := c.reload(); err != nil {
+			log.Printf("⚙️  Keeping current config, %s failed to load: %v", c.path, err)
+		} else {
+			log.Printf("⚙️  Reloaded config from %s (%d command rules, %d routing rules)", c.path, len(cfg.Commands.Rules), len(cfg.Routing.Rules))
+		}
+	}
+}
+
+// reloadConfigHandler reloads the config file on demand
+func reloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if configFile == nil {
+		errorResponse(w, http.StatusBadRequest, "CONFIG_FILE not set")
+		return
+	}
+	cfg, err := configFile.reload()
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("⚙️  Reloaded config from %s on request", configFile.path)
+	jsonResponse(w, map[string]interface{}{
+		"status":        "reloaded",
+		"command_rules": len(cfg.Commands.Rules),
+		"routing_rules": len(cfg.Routing.Rules),
+	})
+}
+
+func parseConfig(data []byte) (*ServerConfig, error) {
+	var cfg ServerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.Commands.compile(); err != nil {
+		return nil, fmt.Errorf("invalid commands config: %w", err)
+	}
+	if err := cfg.Routing.compile(); err != nil {
+		return nil, fmt.Errorf("invalid routing config: %w", err)
+	}
+	if err := cfg.Warmup.validate(); err != nil {
+		return nil, fmt.Errorf("invalid warmup config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// readJSONFile decodes a JSON file into v, leaving v untouched if the file doesn't exist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile atomically replaces a file with v encoded as JSON
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
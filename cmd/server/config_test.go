@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigWatcher_Reload(t *testing.T) {
+	prevConfig, prevUpload := serverConfig.Load(), uploadLimiter
+	uploadLimiter = newConcurrencyLimiter("media upload", 8)
+	t.Cleanup(func() { serverConfig.Store(prevConfig); uploadLimiter = prevUpload })
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"routing": {"rules": [{"tag": "orders", "keywords": ["order"]}]}}`)
+	watcher := &configWatcher{path: path}
+	if _, err := watcher.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if watcher.changed() {
+		t.Error("expected no change right after loading")
+	}
+
+	write(`{"routing": {"rules": [{"tag": "orders", "keywords": ["order"]}, {"tag": "invoices", "keywords": ["invoice"]}]}, "limits": {"media_upload_concurrency": 2}}`)
+	if !watcher.changed() {
+		t.Fatal("expected the rewritten file to count as changed")
+	}
+	if _, err := watcher.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if n := len(currentConfig().Routing.Rules); n != 2 {
+		t.Errorf("expected 2 routing rules after reload, got %d", n)
+	}
+	if uploadLimiter.limit != 2 {
+		t.Errorf("expected the upload limit from the config, got %d", uploadLimiter.limit)
+	}
+
+	write(`{"routing": {"rules": [{"tag": "broken", "regex": "("}]}}`)
+	if _, err := watcher.reload(); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+	if n := len(currentConfig().Routing.Rules); n != 2 {
+		t.Errorf("expected the previous config to stay active, got %d rules", n)
+	}
+
+	write(`{}`)
+	watcher.reload()
+	if uploadLimiter.limit != 8 {
+		t.Errorf("expected the environment's limit once the override is removed, got %d", uploadLimiter.limit)
+	}
+}
+
+func TestReloadConfigHandler(t *testing.T) {
+	prevConfig, prevFile := serverConfig.Load(), configFile
+	t.Cleanup(func() { serverConfig.Store(prevConfig); configFile = prevFile })
+
+	reload := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		reloadConfigHandler(w, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+		return w
+	}
+
+	configFile = nil
+	if w := reload(); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without CONFIG_FILE, got %d", w.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"commands": {"rules": [{"command": "ping", "reply": "pong"}]}}`), 0600)
+	configFile = &configWatcher{path: path}
+	if w := reload(); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := len(currentConfig().Commands.Rules); n != 1 {
+		t.Errorf("expected 1 command rule, got %d", n)
+	}
+}
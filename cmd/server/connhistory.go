@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// connectionHistorySize is how many state transitions are kept per session
+const connectionHistorySize = 50
+
+// Connection states recorded in the history
+const (
+	ConnStateConnected         = "connected"
+	ConnStateDisconnected      = "disconnected"
+	ConnStateLoggedOut         = "logged_out"
+	ConnStateConnectAttempt    = "connect_attempt"
+	ConnStateReconnectAttempt  = "reconnect_attempt"
+	ConnStateConnectFailure    = "connect_failure"
+	ConnStateKeepAliveTimeout  = "keepalive_timeout"
+	ConnStateKeepAliveRestored = "keepalive_restored"
+	ConnStateTemporaryBan      = "temporary_ban"
+	ConnStateStreamReplaced    = "stream_replaced"
+	ConnStateClientOutdated    = "client_outdated"
+	ConnStateWatchdogReconnect = "watchdog_reconnect"
+)
+
+// ConnectionEvent is a single connection state transition
+type ConnectionEvent struct {
+	State     string `json:"state"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ConnectionHistory is a ring buffer of the most recent connection state transitions.
+// The zero value is ready to use.
+type ConnectionHistory struct {
+	mu     sync.Mutex
+	events []ConnectionEvent
+	next   int
+}
+
+// Record appends a transition, overwriting the oldest entry once the buffer is full
+func (h *ConnectionHistory) Record(state, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	evt := ConnectionEvent{
+		State:     state,
+		Reason:    reason,
+		Timestamp: time.Now().Unix(),
+	}
+	if len(h.events) < connectionHistorySize {
+		h.events = append(h.events, evt)
+		return
+	}
+	h.events[h.next] = evt
+	h.next = (h.next + 1) % connectionHistorySize
+}
+
+// Snapshot returns the recorded transitions, oldest first
+func (h *ConnectionHistory) Snapshot() []ConnectionEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]ConnectionEvent, 0, len(h.events))
+	result = append(result, h.events[h.next:]...)
+	result = append(result, h.events[:h.next]...)
+	return result
+}
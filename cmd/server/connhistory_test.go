@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConnectionHistory(t *testing.T) {
+	t.Run("zero value is empty", func(t *testing.T) {
+		var h ConnectionHistory
+		if len(h.Snapshot()) != 0 {
+			t.Error("expected empty snapshot")
+		}
+	})
+
+	t.Run("records in order", func(t *testing.T) {
+		var h ConnectionHistory
+		h.Record(ConnStateConnected, "")
+		h.Record(ConnStateLoggedOut, "logged out")
+
+		snap := h.Snapshot()
+		if len(snap) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(snap))
+		}
+		if snap[0].State != ConnStateConnected || snap[1].State != ConnStateLoggedOut {
+			t.Errorf("unexpected order: %+v", snap)
+		}
+		if snap[1].Reason != "logged out" {
+			t.Errorf("expected reason 'logged out', got %q", snap[1].Reason)
+		}
+	})
+
+	t.Run("keeps only the most recent entries", func(t *testing.T) {
+		var h ConnectionHistory
+		for i := 0; i < connectionHistorySize+5; i++ {
+			h.Record(ConnStateReconnectAttempt, fmt.Sprintf("%d", i))
+		}
+
+		snap := h.Snapshot()
+		if len(snap) != connectionHistorySize {
+			t.Fatalf("expected %d entries, got %d", connectionHistorySize, len(snap))
+		}
+		if snap[0].Reason != "5" {
+			t.Errorf("expected oldest entry '5', got %q", snap[0].Reason)
+		}
+		if snap[len(snap)-1].Reason != fmt.Sprintf("%d", connectionHistorySize+4) {
+			t.Errorf("expected newest entry %d, got %q", connectionHistorySize+4, snap[len(snap)-1].Reason)
+		}
+	})
+}
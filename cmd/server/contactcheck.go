@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxCheckNumbers is how many phone numbers one /contacts/check looks up. WhatsApp
+// watches for accounts querying numbers in bulk, so large lists go in batches.
+const maxCheckNumbers = 100
+
+// normalizePhone turns a phone number in international format, possibly with spaces,
+// dashes, dots or parentheses, into the "+<digits>" form IsOnWhatsApp takes
+func normalizePhone(phone string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+	digits = strings.TrimPrefix(digits, "+")
+	// E.164 numbers are at most 15 digits; shorter than 7 isn't a full number anywhere
+	if len(digits) < 7 || len(digits) > 15 {
+		return "", false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return "+" + digits, true
+}
+
+// checkContactsHandler looks up which phone numbers are on WhatsApp and the JID to
+// message each at, so senders can drop invalid numbers before sending fails
+func checkContactsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int      `json:"user_id"`
+		Phones []string `json:"phones"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	var limits limitCheck
+	limits.count("phones", len(req.Phones), 1, maxCheckNumbers)
+	queries := make([]string, len(req.Phones))
+	for i, phone := range req.Phones {
+		query, ok := normalizePhone(phone)
+		if !ok {
+			limits.fail(fmt.Sprintf("phones[%d]", i), "%q is not a phone number in international format", phone)
+		}
+		queries[i] = query
+	}
+	if limits.reject(w) {
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	found, err := session.Client.IsOnWhatsApp(context.Background(), queries)
+	if err != nil {
+		errorResponse(w, http.StatusBadGateway, fmt.Sprintf("failed to check numbers: %v", err))
+		return
+	}
+	byQuery := make(map[string]int, len(found))
+	for i, info := range found {
+		byQuery[info.Query] = i
+	}
+
+	// One result per phone asked about, in order; numbers WhatsApp didn't answer for count as not on it
+	results := make([]map[string]interface{}, len(req.Phones))
+	for i, phone := range req.Phones {
+		result := map[string]interface{}{
+			"phone":       phone,
+			"on_whatsapp": false,
+		}
+		if j, ok := byQuery[queries[i]]; ok && found[j].IsIn {
+			result["on_whatsapp"] = true
+			result["jid"] = found[j].JID.String()
+			if vn := found[j].VerifiedName; vn != nil && vn.Details.GetVerifiedName() != "" {
+				result["business_name"] = vn.Details.GetVerifiedName()
+			}
+		}
+		results[i] = result
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"results": results,
+	})
+}
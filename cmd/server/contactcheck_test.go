@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waVnameCert"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	for in, want := range map[string]string{
+		"+1 (555) 765-4321": "+15557654321",
+		"447700900123":      "+447700900123",
+		" +49.30.1234567 ":  "+49301234567",
+		"12345":             "",
+		"+1 555 CALL NOW":   "",
+	} {
+		if got, _ := normalizePhone(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestCheckContactsHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.OnWhatsApp = []types.IsOnWhatsAppResponse{
+		{Query: "+15557654321", JID: types.NewJID("15557654321", types.DefaultUserServer), IsIn: true},
+		{Query: "+15550000000", JID: types.NewJID("15550000000", types.DefaultUserServer), IsIn: false},
+		{Query: "+447700900123", JID: types.NewJID("447700900123", types.DefaultUserServer), IsIn: true, VerifiedName: &types.VerifiedName{
+			Details: &waVnameCert.VerifiedNameCertificate_Details{VerifiedName: proto.String("Acme Ltd")},
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	checkContactsHandler(w, httptest.NewRequest(http.MethodPost, "/contacts/check",
+		bytes.NewBufferString(`{"user_id": 1, "phones": ["+1 555 765 4321", "+15550000000", "447700900123", "+15551111111"]}`)))
+	var resp struct {
+		Results []struct {
+			Phone        string `json:"phone"`
+			OnWhatsApp   bool   `json:"on_whatsapp"`
+			JID          string `json:"jid"`
+			BusinessName string `json:"business_name"`
+		} `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.Results) != 4 {
+		t.Fatalf("expected a result per phone, got %d: %s", w.Code, w.Body.String())
+	}
+	if r := resp.Results[0]; r.Phone != "+1 555 765 4321" || !r.OnWhatsApp || r.JID != "15557654321@s.whatsapp.net" {
+		t.Errorf("expected the first number to be found, got %+v", r)
+	}
+	if r := resp.Results[1]; r.OnWhatsApp || r.JID != "" {
+		t.Errorf("expected the second number not to be on WhatsApp, got %+v", r)
+	}
+	if r := resp.Results[2]; !r.OnWhatsApp || r.BusinessName != "Acme Ltd" {
+		t.Errorf("expected the business name, got %+v", r)
+	}
+	if r := resp.Results[3]; r.OnWhatsApp {
+		t.Errorf("expected an unanswered number not to be on WhatsApp, got %+v", r)
+	}
+	if queries := mock.GetCallsByMethod("IsOnWhatsApp")[0].Args[1].([]string); queries[0] != "+15557654321" || queries[2] != "+447700900123" {
+		t.Errorf("expected normalized numbers to be looked up, got %v", queries)
+	}
+
+	w = httptest.NewRecorder()
+	checkContactsHandler(w, httptest.NewRequest(http.MethodPost, "/contacts/check", bytes.NewBufferString(`{"user_id": 1, "phones": ["+15557654321", "not a number"]}`)))
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("phones[1]")) {
+		t.Errorf("expected the invalid number to be pointed out, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultCORSHeaders are the request headers browsers may send when CORS_ALLOWED_HEADERS
+// isn't set
+var defaultCORSHeaders = []string{"Content-Type", "Authorization", requestIDHeader}
+
+// corsConfig says which browser origins may call the API. The zero value allows none,
+// leaving responses without CORS headers as before.
+type corsConfig struct {
+	Origins     []string // exact origins such as https://dash.example.com, or "*"
+	Headers     []string
+	Credentials bool
+}
+
+func corsFromEnv() corsConfig {
+	cfg := corsConfig{
+		Origins:     splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		Headers:     splitList(os.Getenv("CORS_ALLOWED_HEADERS")),
+		Credentials: strings.EqualFold(os.Getenv("CORS_ALLOW_CREDENTIALS"), "true"),
+	}
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = defaultCORSHeaders
+	}
+	return cfg
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c corsConfig) allows(origin string) bool {
+	return c.listed(origin) || c.wildcard()
+}
+
+// listed reports whether origin is one of the exact origins, which are the only ones
+// credentialed requests are allowed from
+func (c corsConfig) listed(origin string) bool {
+	for _, o := range c.Origins {
+		if o != "*" && strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c corsConfig) wildcard() bool {
+	for _, o := range c.Origins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers preflight requests
+// itself, so dashboards can open /sessions/qr and /events and POST JSON directly.
+// Requests from other origins are served without CORS headers, which browsers block.
+func corsMiddleware(cfg corsConfig, next http.Handler) http.Handler {
+	if len(cfg.Origins) == 0 {
+		return next
+	}
+	allowHeaders := strings.Join(cfg.Headers, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !cfg.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if cfg.listed(origin) {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if cfg.Credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			// Allowed by "*" only: any site may read responses, but never with the
+			// user's credentials, or any site could act as them
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		h.Set("Access-Control-Expose-Headers", requestIDHeader+", Retry-After")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	served := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		jsonResponse(w, map[string]string{"status": "ok"})
+	})
+	handler := corsMiddleware(corsConfig{
+		Origins:     []string{"https://dash.example.com"},
+		Headers:     defaultCORSHeaders,
+		Credentials: true,
+	}, next)
+
+	t.Run("preflight is answered without reaching the handler", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/messages/send", nil)
+		req.Header.Set("Origin", "https://dash.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent || served != 0 {
+			t.Fatalf("expected 204 without calling the handler, got %d (served %d)", w.Code, served)
+		}
+		h := w.Header()
+		if h.Get("Access-Control-Allow-Origin") != "https://dash.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("unexpected origin headers: %v", h)
+		}
+		if h.Get("Access-Control-Allow-Methods") == "" || h.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization, X-Request-ID" {
+			t.Errorf("unexpected preflight headers: %v", h)
+		}
+	})
+
+	t.Run("allowed origin gets CORS headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/status?user_id=1", nil)
+		req.Header.Set("Origin", "https://dash.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if served != 1 || w.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" {
+			t.Errorf("expected request to be served with CORS headers, got %v", w.Header())
+		}
+	})
+
+	t.Run("other origins get none", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/status?user_id=1", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("expected no CORS headers for a foreign origin, got %v", w.Header())
+		}
+	})
+}
+
+func TestCORSMiddleware_Wildcard(t *testing.T) {
+	handler := corsMiddleware(corsConfig{
+		Origins:     []string{"https://dash.example.com", "*"},
+		Headers:     defaultCORSHeaders,
+		Credentials: true,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(origin string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/status?user_id=1", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	if h := get("https://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected a wildcard without credentials for an unlisted origin, got %v", h)
+	}
+	if h := get("https://dash.example.com"); h.Get("Access-Control-Allow-Origin") != "https://dash.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("expected a listed origin echoed with credentials, got %v", h)
+	}
+}
+
+func TestCORSFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example.com, *,")
+	t.Setenv("CORS_ALLOWED_HEADERS", "")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "TRUE")
+	cfg := corsFromEnv()
+	if len(cfg.Origins) != 2 || !cfg.allows("https://anything.example.com") || !cfg.Credentials {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if len(cfg.Headers) != len(defaultCORSHeaders) {
+		t.Errorf("expected default headers, got %v", cfg.Headers)
+	}
+}
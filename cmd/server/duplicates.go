@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// duplicateWindow is how long a text sent to a chat blocks sending the same text there
+// again, set by DUPLICATE_WINDOW. Upstream bots that retry on timeouts otherwise post
+// the same reply several times. 0 disables the guard.
+var duplicateWindow = durationFromEnv("DUPLICATE_WINDOW", 0)
+
+// DuplicateError is returned instead of sending a text that already went to the chat
+// within duplicateWindow. Nothing was sent.
+type DuplicateError struct {
+	PreviousID string // empty while the earlier send is still in flight
+	Age        time.Duration
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("identical text sent to this chat %v ago", e.Age.Round(time.Second))
+}
+
+type duplicateKey struct {
+	chat types.JID
+	text [sha256.Size]byte
+}
+
+// sentText is a recent send of a text to a chat
+type sentText struct {
+	at time.Time
+	id string // set once WhatsApp accepted it
+}
+
+// DuplicateGuard remembers the texts recently sent to each chat. The zero value is ready to use.
+type DuplicateGuard struct {
+	mu     sync.Mutex
+	recent map[duplicateKey]sentText
+}
+
+// claim refuses text with a *DuplicateError if it went to chat within window, and
+// otherwise records it as being sent. The caller settles the claim once the send is done.
+func (g *DuplicateGuard) claim(chat types.JID, text string, window time.Duration, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, sent := range g.recent {
+		if now.Sub(sent.at) >= window {
+			delete(g.recent, key)
+		}
+	}
+
+	key := duplicateKey{chat.ToNonAD(), sha256.Sum256([]byte(text))}
+	if sent, ok := g.recent[key]; ok {
+		return &DuplicateError{PreviousID: sent.id, Age: now.Sub(sent.at)}
+	}
+	if g.recent == nil {
+		g.recent = make(map[duplicateKey]sentText)
+	}
+	g.recent[key] = sentText{at: now}
+	return nil
+}
+
+// settle completes a claim. A send that certainly didn't go out is forgotten so it can be
+// retried. One that went out keeps blocking duplicates with its message ID, and so does
+// one that may have, such as after a timeout or a dropped connection. A send held for
+// approval keeps blocking them with the ID it will go out with, or it would be queued twice.
+func (g *DuplicateGuard) settle(chat types.JID, text, id string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := duplicateKey{chat.ToNonAD(), sha256.Sum256([]byte(text))}
+	sent, ok := g.recent[key]
+	if !ok {
+		return
+	}
+	var pending *PendingApprovalError
+	if errors.As(err, &pending) {
+		id = pending.ID
+	} else if err != nil && classifySendError(err).RetrySafe {
+		delete(g.recent, key)
+		return
+	}
+	sent.id = id
+	g.recent[key] = sent
+}
+
+// forget releases the claim held by a message that will never be sent, such as a
+// rejected one
+func (g *DuplicateGuard) forget(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, sent := range g.recent {
+		if sent.id == id {
+			delete(g.recent, key)
+		}
+	}
+}
+
+// sendText sends a message with text to chat through the duplicate guard, unless force
+// is set or the guard is off. The message is built only once the chat is known to be
+// allowed and the text isn't a duplicate, so a refused send costs nothing, such as a
+// link preview fetch.
+func (s *UserSession) sendText(ctx context.Context, chat types.JID, text string, force bool, build func() *waE2E.Message) (whatsmeow.SendResponse, error) {
+	if !s.chatAllowed(chat) {
+		log.Printf("[chat-access] User %d: refusing send to %s", s.UserID, chat)
+		return whatsmeow.SendResponse{}, &ChatNotAllowedError{Chat: chat.ToNonAD()}
+	}
+	if force || duplicateWindow <= 0 {
+		return s.Client.SendMessage(ctx, chat, build())
+	}
+	if err := s.Duplicates.claim(chat, text, duplicateWindow, time.Now()); err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	resp, err := s.Client.SendMessage(ctx, chat, build())
+	s.Duplicates.settle(chat, text, resp.ID, err)
+	return resp, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestDuplicateGuard(t *testing.T) {
+	var guard DuplicateGuard
+	alice := types.NewJID("15557654321", types.DefaultUserServer)
+	bob := types.NewJID("15550000002", types.DefaultUserServer)
+	now := time.Unix(1700000000, 0)
+
+	if err := guard.claim(alice, "hi", time.Minute, now); err != nil {
+		t.Fatalf("expected the first send to be allowed, got %v", err)
+	}
+	var duplicate *DuplicateError
+	if err := guard.claim(alice, "hi", time.Minute, now.Add(time.Second)); !errors.As(err, &duplicate) || duplicate.PreviousID != "" {
+		t.Errorf("expected a duplicate of an in-flight send, got %v", err)
+	}
+	guard.settle(alice, "hi", "msg-1", nil)
+	if err := guard.claim(alice, "hi", time.Minute, now.Add(30*time.Second)); !errors.As(err, &duplicate) || duplicate.PreviousID != "msg-1" {
+		t.Errorf("expected a duplicate of msg-1, got %v", err)
+	}
+	if err := guard.claim(alice, "hi!", time.Minute, now); err != nil {
+		t.Errorf("expected a different text to be allowed, got %v", err)
+	}
+	if err := guard.claim(bob, "hi", time.Minute, now); err != nil {
+		t.Errorf("expected the same text to another chat to be allowed, got %v", err)
+	}
+	if err := guard.claim(alice, "hi", time.Minute, now.Add(time.Minute)); err != nil {
+		t.Errorf("expected the window to expire, got %v", err)
+	}
+
+	// A send that certainly failed doesn't block its retry
+	guard.settle(bob, "hi", "", whatsmeow.ErrNotConnected)
+	if err := guard.claim(bob, "hi", time.Minute, now); err != nil {
+		t.Errorf("expected a failed send to be retryable, got %v", err)
+	}
+	// One that may have gone out does
+	guard.settle(bob, "hi", "", whatsmeow.ErrMessageTimedOut)
+	if err := guard.claim(bob, "hi", time.Minute, now.Add(time.Second)); !errors.As(err, &duplicate) {
+		t.Errorf("expected a timed-out send to block its retry, got %v", err)
+	}
+}
+
+func TestSendMessageHandler_duplicate(t *testing.T) {
+	prev := duplicateWindow
+	duplicateWindow = time.Minute
+	t.Cleanup(func() { duplicateWindow = prev })
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(body)))
+		return w
+	}
+	if w := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "hi"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected the first send to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "hi"}`)
+	var resp struct {
+		Code        string `json:"code"`
+		RetrySafe   bool   `json:"retry_safe"`
+		DuplicateOf string `json:"duplicate_of"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusConflict || resp.Code != "duplicate" || resp.RetrySafe || resp.DuplicateOf != "mock-msg-id" {
+		t.Errorf("expected the repeat to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "hi", "force": true}`); w.Code != http.StatusOK {
+		t.Errorf("expected force to send anyway, got %d: %s", w.Code, w.Body.String())
+	}
+	if sent := len(mock.GetCallsByMethod("SendMessage")); sent != 2 {
+		t.Errorf("expected 2 sends, got %d", sent)
+	}
+}
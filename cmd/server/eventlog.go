@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// eventLogRetention is how long emitted events stay available for replay
+var eventLogRetention = 72 * time.Hour
+
+// eventReplayPageSize is how many logged events are read at a time when replaying
+const eventReplayPageSize = 500
+
+// AppendEvent logs an event and returns its sequence number, which /events sends as the
+// SSE id. Sequence numbers only grow, so they work as a resume cursor.
+func (st *MessageStore) AppendEvent(ctx context.Context, evt MessageEvent) (int64, error) {
+	if st == nil {
+		return 0, nil
+	}
+	data, err := json.Marshal(evt.Payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := st.db.ExecContext(ctx,
+		`INSERT INTO events (type, payload, created_at) VALUES (?, ?, ?)`,
+		evt.Type, string(data), time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// EventsAfter returns up to limit logged events with sequence numbers above after and,
+// if until is set, below it, oldest first. Payloads come back as raw JSON.
+func (st *MessageStore) EventsAfter(ctx context.Context, after, until int64, limit int) ([]MessageEvent, error) {
+	events := []MessageEvent{}
+	if st == nil {
+		return events, nil
+	}
+	query := `SELECT seq, type, payload FROM events WHERE seq > ?`
+	args := []interface{}{after}
+	if until > 0 {
+		query += ` AND seq < ?`
+		args = append(args, until)
+	}
+	query += ` ORDER BY seq LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := st.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var evt MessageEvent
+		var payload string
+		if err := rows.Scan(&evt.Seq, &evt.Type, &payload); err != nil {
+			return nil, err
+		}
+		evt.Payload = json.RawMessage(payload)
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
+
+// PruneEvents deletes events logged before before (unix seconds)
+func (st *MessageStore) PruneEvents(ctx context.Context, before int64) (int64, error) {
+	if st == nil {
+		return 0, nil
+	}
+	res, err := st.db.ExecContext(ctx, `DELETE FROM events WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// pruneEventLog drops events past eventLogRetention, or sooner if the retention policy
+// deletes messages sooner, since events carry message contents
+func (s *UserSession) pruneEventLog(ctx context.Context, now time.Time) {
+	cutoff := now.Add(-eventLogRetention)
+	if messageCutoff, _ := s.Retention.Get().cutoffs(now); messageCutoff.After(cutoff) {
+		cutoff = messageCutoff
+	}
+	deleted, err := s.Messages.PruneEvents(ctx, cutoff.Unix())
+	if err != nil {
+		log.Printf("[events] User %d: failed to prune event log: %v", s.UserID, err)
+	} else if deleted > 0 {
+		log.Printf("[events] User %d: pruned %d logged events", s.UserID, deleted)
+	}
+}
+
+// eventCursor hands one consumer every logged event once and in order. Events the live
+// channel dropped, or another consumer took, are filled in from the log.
+type eventCursor struct {
+	session *UserSession
+	last    int64 // sequence number of the last event sent
+}
+
+// replay sends logged events after the cursor, up to but excluding until (0 for all)
+func (c *eventCursor) replay(ctx context.Context, until int64, send func(MessageEvent) error) error {
+	for {
+		events, err := c.session.Messages.EventsAfter(ctx, c.last, until, eventReplayPageSize)
+		if err != nil {
+			return err
+		}
+		for _, evt := range events {
+			if err := send(evt); err != nil {
+				return err
+			}
+			c.last = evt.Seq
+		}
+		if len(events) < eventReplayPageSize {
+			return nil
+		}
+	}
+}
+
+// deliver sends a live event, first replaying any the cursor skipped past
+func (c *eventCursor) deliver(ctx context.Context, evt MessageEvent, send func(MessageEvent) error) error {
+	if evt.Seq == 0 {
+		// Not logged, e.g. the message store couldn't be opened
+		return send(evt)
+	}
+	if evt.Seq <= c.last {
+		return nil
+	}
+	if c.last > 0 && evt.Seq > c.last+1 {
+		if err := c.replay(ctx, evt.Seq, send); err != nil {
+			return err
+		}
+	}
+	if err := send(evt); err != nil {
+		return err
+	}
+	c.last = evt.Seq
+	return nil
+}
+
+// eventsCursor reads where a reconnecting /events consumer left off, from the
+// Last-Event-ID header browsers send or a cursor parameter; 0 if neither is set
+func eventsCursor(r *http.Request) (int64, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("cursor")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	cursor, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", raw)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageStore_eventLog(t *testing.T) {
+	ctx := context.Background()
+	st := newTestMessageStore(t)
+
+	for i, typ := range []string{"message", "receipt", "message"} {
+		seq, err := st.AppendEvent(ctx, MessageEvent{Type: typ, Payload: map[string]int{"n": i}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != int64(i+1) {
+			t.Errorf("expected sequence %d, got %d", i+1, seq)
+		}
+	}
+
+	events, err := st.EventsAfter(ctx, 1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Seq != 2 || events[0].Type != "receipt" || events[1].Seq != 3 {
+		t.Fatalf("unexpected events after 1: %+v", events)
+	}
+	if events, _ := st.EventsAfter(ctx, 0, 3, 10); len(events) != 2 {
+		t.Errorf("expected until to be exclusive, got %+v", events)
+	}
+
+	if deleted, err := st.PruneEvents(ctx, time.Now().Add(time.Minute).Unix()); err != nil || deleted != 3 {
+		t.Errorf("expected 3 events pruned, got %d (%v)", deleted, err)
+	}
+	// Sequence numbers aren't reused after pruning, so old cursors stay valid
+	if seq, _ := st.AppendEvent(ctx, MessageEvent{Type: "message"}); seq != 4 {
+		t.Errorf("expected sequence 4 after pruning, got %d", seq)
+	}
+}
+
+func TestEventCursor_fillsGaps(t *testing.T) {
+	session := injectMockSession(setupTestManager(t), 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+	for i := 0; i < 4; i++ {
+		session.emit(MessageEvent{Type: "message", Payload: i})
+	}
+	// The consumer got event 1; 2 and 3 went to someone else
+	for i := 0; i < 4; i++ {
+		<-session.EventChan
+	}
+
+	var sent []int64
+	send := func(evt MessageEvent) error {
+		sent = append(sent, evt.Seq)
+		return nil
+	}
+	cursor := eventCursor{session: session, last: 1}
+	cursor.deliver(context.Background(), MessageEvent{Type: "message", Seq: 4}, send)
+	cursor.deliver(context.Background(), MessageEvent{Type: "message", Seq: 3}, send)
+	if len(sent) != 3 || sent[0] != 2 || sent[1] != 3 || sent[2] != 4 {
+		t.Errorf("expected 2, 3 and 4 once each, got %v", sent)
+	}
+}
+
+func TestEventsHandler_resume(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+	for _, typ := range []string{"message", "receipt", "presence"} {
+		session.emit(MessageEvent{Type: typ, Payload: map[string]string{"kind": typ}})
+	}
+
+	for _, resume := range []func(r *http.Request){
+		func(r *http.Request) { r.Header.Set("Last-Event-ID", "1") },
+		func(r *http.Request) { r.URL.RawQuery += "&cursor=1" },
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, "/events?user_id=1", nil).WithContext(ctx)
+		resume(req)
+		w := httptest.NewRecorder()
+		eventsHandler(w, req)
+		cancel()
+
+		body := w.Body.String()
+		if strings.Contains(body, "id: 1\n") || !strings.Contains(body, "id: 2\n") || !strings.Contains(body, "id: 3\n") {
+			t.Errorf("expected events 2 and 3 to be replayed, got %q", body)
+		}
+		if !strings.Contains(body, `"payload":{"kind":"presence"}`) {
+			t.Errorf("expected replayed payloads as sent, got %q", body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	eventsHandler(w, httptest.NewRequest(http.MethodGet, "/events?user_id=1&cursor=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad cursor, got %d", w.Code)
+	}
+}
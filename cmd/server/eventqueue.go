@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// What emit does with an event when EventChan is full because no consumer keeps up
+type overflowPolicy string
+
+const (
+	overflowDropNewest overflowPolicy = "drop-newest" // discard the new event
+	overflowDropOldest overflowPolicy = "drop-oldest" // discard the oldest queued event to make room
+	overflowBlock      overflowPolicy = "block"       // wait up to EVENT_BLOCK_TIMEOUT for room, then discard
+	// Leave it in the event log and feed it to EventChan once there's room, so nothing is
+	// lost. Falls back to drop-newest for sessions without a message store.
+	overflowSpill overflowPolicy = "spill"
+)
+
+const (
+	defaultEventBufferSize   = 100
+	defaultEventBlockTimeout = 5 * time.Second
+	// eventBlockPollInterval is how often a blocked event checks for room in the backlog
+	eventBlockPollInterval = 10 * time.Millisecond
+)
+
+// eventQueueConfig sizes every session's EventChan and says how it overflows
+type eventQueueConfig struct {
+	Size         int
+	Overflow     overflowPolicy
+	BlockTimeout time.Duration
+}
+
+var eventQueue = eventQueueConfig{
+	Size:         defaultEventBufferSize,
+	Overflow:     overflowDropNewest,
+	BlockTimeout: defaultEventBlockTimeout,
+}
+
+// eventQueueFromEnv reads EVENT_BUFFER_SIZE, EVENT_OVERFLOW and EVENT_BLOCK_TIMEOUT
+func eventQueueFromEnv() eventQueueConfig {
+	cfg := eventQueueConfig{
+		Size:         concurrencyLimitFromEnv("EVENT_BUFFER_SIZE", defaultEventBufferSize),
+		Overflow:     overflowDropNewest,
+		BlockTimeout: durationFromEnv("EVENT_BLOCK_TIMEOUT", defaultEventBlockTimeout),
+	}
+	if cfg.Size < 1 {
+		log.Printf("Warning: invalid EVENT_BUFFER_SIZE %d, using %d", cfg.Size, defaultEventBufferSize)
+		cfg.Size = defaultEventBufferSize
+	}
+	switch policy := overflowPolicy(strings.ToLower(os.Getenv("EVENT_OVERFLOW"))); policy {
+	case "":
+	case overflowDropNewest, overflowDropOldest, overflowBlock, overflowSpill:
+		cfg.Overflow = policy
+	default:
+		log.Printf("Warning: invalid EVENT_OVERFLOW %q, using %s", policy, overflowDropNewest)
+	}
+	return cfg
+}
+
+// eventQueueState is a session's overflow bookkeeping. Spill state is guarded by the
+// session's emitMu.
+type eventQueueState struct {
+	dropped    atomic.Int64
+	spilling   bool  // backlog events are going to the log only, until drainSpill catches up
+	spillAfter int64 // sequence number drainSpill continues after
+}
+
+// Dropped returns how many events were discarded because a consumer's queue was full
+func (q *eventQueueState) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// queueEvent hands an emitted event to every connected consumer, or to the EventChan
+// backlog while none is connected, applying the overflow policy to full queues. The
+// caller holds s.emitMu. Under the block policy, waiting for room is left to the returned
+// wait, to be run once emitMu is released so consumers can still connect and take the
+// backlog meanwhile; the caller holds s.deliverMu throughout, which keeps events in order.
+func (s *UserSession) queueEvent(evt MessageEvent) (wait func()) {
+	policy := eventQueue.Overflow
+	if policy == overflowSpill && evt.Seq == 0 {
+		policy = overflowDropNewest
+	}
+
+	if subs := s.Events.subscribers(); len(subs) > 0 {
+		var full []*eventSubscriber
+		for _, sub := range subs {
+			if policy == overflowBlock {
+				select {
+				case sub.C <- evt:
+				default:
+					full = append(full, sub)
+				}
+				continue
+			}
+			if !s.offerEvent(sub.C, evt, policy) {
+				// The consumer replays it from the log
+				select {
+				case sub.spilled <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if len(full) == 0 {
+			return nil
+		}
+		return func() {
+			for _, sub := range full {
+				s.offerEvent(sub.C, evt, overflowBlock)
+			}
+		}
+	}
+
+	if policy == overflowBlock {
+		select {
+		case s.EventChan <- evt:
+			return nil
+		default:
+			return func() { s.awaitBacklogRoom(evt) }
+		}
+	}
+	if policy == overflowSpill && s.Queue.spilling {
+		// Queued behind the spilled events, which drainSpill sends first
+		return nil
+	}
+	if !s.offerEvent(s.EventChan, evt, policy) {
+		s.Queue.spilling = true
+		s.Queue.spillAfter = evt.Seq - 1
+		log.Printf("Event channel full for user %d, spilling events to the event log", s.UserID)
+		go s.drainSpill()
+	}
+	return nil
+}
+
+// awaitBacklogRoom waits up to EVENT_BLOCK_TIMEOUT for room in EventChan, or for a
+// consumer to connect and take evt instead. It checks under emitMu each time, so evt
+// can't land in the backlog after a consumer that connected meanwhile has taken it.
+func (s *UserSession) awaitBacklogRoom(evt MessageEvent) {
+	timer := time.NewTimer(eventQueue.BlockTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(eventBlockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			s.dropEvent(evt)
+			return
+		}
+		s.emitMu.Lock()
+		subs := s.Events.subscribers()
+		queued := false
+		if len(subs) == 0 {
+			select {
+			case s.EventChan <- evt:
+				queued = true
+			default:
+			}
+		}
+		s.emitMu.Unlock()
+		if queued {
+			return
+		}
+		for _, sub := range subs {
+			s.offerEvent(sub.C, evt, overflowBlock)
+		}
+		if len(subs) > 0 {
+			return
+		}
+	}
+}
+
+// offerEvent puts evt on ch, applying policy if ch is full. It reports false if evt was
+// spilled, i.e. left in the event log only.
+func (s *UserSession) offerEvent(ch chan MessageEvent, evt MessageEvent, policy overflowPolicy) bool {
+	switch policy {
+	case overflowSpill:
+		select {
+		case ch <- evt:
+			return true
+		default:
+			return false
+		}
+
+	case overflowDropOldest:
+		for {
+			select {
+			case ch <- evt:
+				return true
+			default:
+			}
+			select {
+			case oldest := <-ch:
+				s.dropEvent(oldest)
+			default:
+			}
+		}
+
+	case overflowBlock:
+		timer := time.NewTimer(eventQueue.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case ch <- evt:
+		case <-timer.C:
+			s.dropEvent(evt)
+		}
+
+	default:
+		select {
+		case ch <- evt:
+		default:
+			s.dropEvent(evt)
+		}
+	}
+	return true
+}
+
+func (s *UserSession) dropEvent(evt MessageEvent) {
+	dropped := s.Queue.dropped.Add(1)
+	droppedEvents.Inc(strconv.Itoa(s.UserID))
+	log.Printf("Event channel full for user %d, dropping %s event (%d dropped)", s.UserID, evt.Type, dropped)
+}
+
+// drainSpill feeds spilled events from the log to EventChan in order as room frees up,
+// then hands the channel back to emit. It stops early if a consumer connects and takes
+// over the backlog.
+func (s *UserSession) drainSpill() {
+	s.emitMu.Lock()
+	after := s.Queue.spillAfter
+	s.emitMu.Unlock()
+
+	for {
+		events, err := s.Messages.EventsAfter(context.Background(), after, 0, eventReplayPageSize)
+		if err != nil {
+			log.Printf("[events] User %d: failed to read spilled events, skipping them: %v", s.UserID, err)
+			s.emitMu.Lock()
+			s.Queue.spilling = false
+			s.emitMu.Unlock()
+			return
+		}
+		for _, evt := range events {
+			s.emitMu.Lock()
+			spilling := s.Queue.spilling
+			s.emitMu.Unlock()
+			if !spilling {
+				return
+			}
+			s.EventChan <- evt
+			after = evt.Seq
+		}
+		if len(events) > 0 {
+			continue
+		}
+
+		// Caught up, unless emit logged another event since the query
+		s.emitMu.Lock()
+		more, err := s.Messages.EventsAfter(context.Background(), after, 0, 1)
+		if err != nil || len(more) == 0 {
+			s.Queue.spilling = false
+			s.emitMu.Unlock()
+			return
+		}
+		s.emitMu.Unlock()
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func withEventQueue(t *testing.T, cfg eventQueueConfig) {
+	t.Helper()
+	prev := eventQueue
+	eventQueue = cfg
+	t.Cleanup(func() { eventQueue = prev })
+}
+
+// emitTypes emits an event of each type, in order
+func emitTypes(t *testing.T, session *UserSession, types ...string) {
+	t.Helper()
+	for _, typ := range types {
+		session.emit(MessageEvent{Type: typ})
+	}
+}
+
+func queuedTypes(session *UserSession) []string {
+	var types []string
+	for {
+		select {
+		case evt := <-session.EventChan:
+			types = append(types, evt.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func newQueueTestSession(t *testing.T) *UserSession {
+	session := injectMockSession(setupTestManager(t), 1, NewLoggedInMockClient())
+	session.EventChan = make(chan MessageEvent, 2)
+	return session
+}
+
+func TestQueueEvent_dropPolicies(t *testing.T) {
+	tests := []struct {
+		policy overflowPolicy
+		want   []string
+	}{
+		{overflowDropNewest, []string{"a", "b"}},
+		{overflowDropOldest, []string{"b", "c"}},
+		{overflowBlock, []string{"a", "b"}},
+		// Without a message store there's nowhere to spill to
+		{overflowSpill, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			withEventQueue(t, eventQueueConfig{Size: 2, Overflow: tt.policy, BlockTimeout: 10 * time.Millisecond})
+			session := newQueueTestSession(t)
+			emitTypes(t, session, "a", "b", "c")
+
+			got := queuedTypes(session)
+			if len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("expected %v queued, got %v", tt.want, got)
+			}
+			if session.Queue.Dropped() != 1 {
+				t.Errorf("expected 1 dropped event, got %d", session.Queue.Dropped())
+			}
+		})
+	}
+}
+
+func TestQueueEvent_blockWaitsForConsumer(t *testing.T) {
+	withEventQueue(t, eventQueueConfig{Size: 2, Overflow: overflowBlock, BlockTimeout: time.Second})
+	session := newQueueTestSession(t)
+	emitTypes(t, session, "a", "b")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-session.EventChan
+	}()
+	emitTypes(t, session, "c")
+	if got := queuedTypes(session); len(got) != 2 || got[1] != "c" || session.Queue.Dropped() != 0 {
+		t.Errorf("expected c to wait for room, got %v with %d dropped", got, session.Queue.Dropped())
+	}
+}
+
+func TestQueueEvent_blockLetsConsumersConnect(t *testing.T) {
+	withEventQueue(t, eventQueueConfig{Size: 2, Overflow: overflowBlock, BlockTimeout: time.Second})
+	session := newQueueTestSession(t)
+	emitTypes(t, session, "a", "b")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		session.emit(MessageEvent{Type: "c"})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A consumer connecting takes the backlog while c waits, and then gets c itself
+	sub := session.Events.subscribe(2)
+	start := time.Now()
+	backlog, _, _ := session.takeBacklog()
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("expected the backlog to be taken without waiting on c, took %v", waited)
+	}
+	if len(backlog) != 2 || backlog[0].Type != "a" {
+		t.Errorf("expected a and b in the backlog, got %+v", backlog)
+	}
+	select {
+	case evt := <-sub.C:
+		if evt.Type != "c" {
+			t.Errorf("expected c, got %s", evt.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected c to reach the new consumer")
+	}
+	<-done
+	if session.Queue.Dropped() != 0 {
+		t.Errorf("expected nothing dropped, got %d", session.Queue.Dropped())
+	}
+}
+
+func TestQueueEvent_spill(t *testing.T) {
+	withEventQueue(t, eventQueueConfig{Size: 2, Overflow: overflowSpill})
+	session := newQueueTestSession(t)
+	session.Messages = newTestMessageStore(t)
+	emitTypes(t, session, "a", "b", "c", "d", "e")
+
+	var got []string
+	for len(got) < 5 {
+		select {
+		case evt := <-session.EventChan:
+			got = append(got, evt.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("expected all 5 events, got %v", got)
+		}
+	}
+	if got[0] != "a" || got[2] != "c" || got[4] != "e" {
+		t.Errorf("expected spilled events in order, got %v", got)
+	}
+	if session.Queue.Dropped() != 0 {
+		t.Errorf("expected nothing dropped, got %d", session.Queue.Dropped())
+	}
+
+	// Once drained, events go straight to the channel again
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		session.emitMu.Lock()
+		spilling := session.Queue.spilling
+		session.emitMu.Unlock()
+		if !spilling {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected spilling to end")
+		}
+	}
+	emitTypes(t, session, "f")
+	if got := queuedTypes(session); len(got) != 1 || got[0] != "f" {
+		t.Errorf("expected f to be queued directly, got %v", got)
+	}
+}
+
+func TestEventQueueFromEnv(t *testing.T) {
+	t.Setenv("EVENT_BUFFER_SIZE", "500")
+	t.Setenv("EVENT_OVERFLOW", "Drop-Oldest")
+	if cfg := eventQueueFromEnv(); cfg.Size != 500 || cfg.Overflow != overflowDropOldest {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("EVENT_BUFFER_SIZE", "0")
+	t.Setenv("EVENT_OVERFLOW", "shrug")
+	if cfg := eventQueueFromEnv(); cfg.Size != defaultEventBufferSize || cfg.Overflow != overflowDropNewest {
+		t.Errorf("expected defaults for invalid settings, got %+v", cfg)
+	}
+}
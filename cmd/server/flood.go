@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Default flood threshold: more than 20 messages from one sender in one chat within 10 seconds
+const (
+	defaultFloodMaxMessages = 20
+	defaultFloodWindow      = 10 * time.Second
+)
+
+// FloodPolicy decides when a sender is flooding a chat and what happens then
+type FloodPolicy struct {
+	MaxMessages int           // messages allowed per Window; 0 disables detection
+	Window      time.Duration // sliding window the messages are counted over
+	// Mute, if set, mutes the chat for this long once a flood is detected. Messages from a
+	// muted chat are still stored but aren't emitted until the mute expires.
+	Mute time.Duration
+}
+
+var floodPolicy = floodPolicyFromEnv()
+
+// floodPolicyFromEnv reads FLOOD_MAX_MESSAGES, FLOOD_WINDOW and FLOOD_MUTE
+func floodPolicyFromEnv() FloodPolicy {
+	policy := FloodPolicy{MaxMessages: defaultFloodMaxMessages, Window: defaultFloodWindow}
+	if value := os.Getenv("FLOOD_MAX_MESSAGES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			policy.MaxMessages = n
+		} else {
+			log.Printf("Warning: invalid FLOOD_MAX_MESSAGES %q, using %d", value, policy.MaxMessages)
+		}
+	}
+	if value := os.Getenv("FLOOD_WINDOW"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			policy.Window = d
+		} else {
+			log.Printf("Warning: invalid FLOOD_WINDOW %q, using %v", value, policy.Window)
+		}
+	}
+	if value := os.Getenv("FLOOD_MUTE"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			policy.Mute = d
+		} else {
+			log.Printf("Warning: invalid FLOOD_MUTE %q, not muting", value)
+		}
+	}
+	return policy
+}
+
+// FloodPayload is the payload of a "flood_detected" event
+type FloodPayload struct {
+	ChatJID       string `json:"chat_jid"`
+	SenderJID     string `json:"sender_jid"`
+	Count         int    `json:"count"` // messages seen within the window
+	WindowSeconds int    `json:"window_seconds"`
+	MutedUntil    int64  `json:"muted_until,omitempty"` // set when the chat was muted in response
+}
+
+type floodKey struct {
+	chat, sender string
+}
+
+// FloodDetector counts recent messages per sender and chat. The zero value is ready to use.
+type FloodDetector struct {
+	mu     sync.Mutex
+	recent map[floodKey][]time.Time
+	// senders currently over the limit, so a flood is reported once rather than per message
+	flagged map[floodKey]bool
+	muted   map[string]time.Time
+}
+
+// Observe records a message and reports whether it starts a flood. It returns the number
+// of messages in the window either way.
+func (d *FloodDetector) Observe(chat, sender string, now time.Time, policy FloodPolicy) (int, bool) {
+	if policy.MaxMessages <= 0 {
+		return 0, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.recent == nil {
+		d.recent = make(map[floodKey][]time.Time)
+		d.flagged = make(map[floodKey]bool)
+	}
+
+	key := floodKey{chat, sender}
+	cutoff := now.Add(-policy.Window)
+	times := d.recent[key]
+	for len(times) > 0 && !times[0].After(cutoff) {
+		times = times[1:]
+	}
+	times = append(times, now)
+	d.recent[key] = times
+
+	// Forget quiet senders so the map doesn't grow with every chat ever seen
+	for k, ts := range d.recent {
+		if k != key && !ts[len(ts)-1].After(cutoff) {
+			delete(d.recent, k)
+			delete(d.flagged, k)
+		}
+	}
+
+	if len(times) <= policy.MaxMessages {
+		d.flagged[key] = false
+		return len(times), false
+	}
+	if d.flagged[key] {
+		return len(times), false
+	}
+	d.flagged[key] = true
+	return len(times), true
+}
+
+// Mute suppresses a chat's events until the given time
+func (d *FloodDetector) Mute(chat string, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.muted == nil {
+		d.muted = make(map[string]time.Time)
+	}
+	d.muted[chat] = until
+}
+
+// Muted reports whether a chat is muted because of a flood
+func (d *FloodDetector) Muted(chat string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.muted[chat]
+	if ok && !now.Before(until) {
+		delete(d.muted, chat)
+		return false
+	}
+	return ok
+}
+
+// checkFlood tracks an incoming message against the flood policy. It reports whether
+// the message should be held back from consumers because its chat is muted for flooding.
+// Messages are counted by when they were sent, so a backlog delivered all at once after
+// being offline isn't taken for a flood.
+func (s *UserSession) checkFlood(payload MessagePayload) bool {
+	if payload.IsFromMe {
+		return false
+	}
+	policy := floodPolicy
+	now := time.Now()
+	sent := now
+	if payload.Timestamp > 0 {
+		sent = time.Unix(payload.Timestamp, 0)
+	}
+	count, flooded := s.Floods.Observe(payload.ChatJID, payload.SenderJID, sent, policy)
+	if flooded {
+		log.Printf("[flood] User %d: %s sent %d messages in %v to %s", s.UserID, payload.SenderJID, count, policy.Window, payload.ChatJID)
+		evt := FloodPayload{
+			ChatJID:       payload.ChatJID,
+			SenderJID:     payload.SenderJID,
+			Count:         count,
+			WindowSeconds: int(policy.Window / time.Second),
+		}
+		if policy.Mute > 0 {
+			until := now.Add(policy.Mute)
+			s.Floods.Mute(payload.ChatJID, until)
+			evt.MutedUntil = until.Unix()
+			go s.muteChat(payload.ChatJID, policy.Mute)
+		}
+		s.emit(MessageEvent{Type: "flood_detected", Payload: evt})
+	}
+	return s.Floods.Muted(payload.ChatJID, now)
+}
+
+// muteChat mutes a chat on WhatsApp so the user's phone stops notifying too
+func (s *UserSession) muteChat(chatJID string, duration time.Duration) {
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return
+	}
+	if err := s.Client.SendAppState(context.Background(), appstate.BuildMute(chat, true, duration)); err != nil {
+		log.Printf("[flood] User %d: failed to mute %s: %v", s.UserID, chatJID, err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestFloodDetector_Observe(t *testing.T) {
+	policy := FloodPolicy{MaxMessages: 3, Window: 10 * time.Second}
+	var d FloodDetector
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		if _, flooded := d.Observe("chat", "alice", now.Add(time.Duration(i)*time.Second), policy); flooded {
+			t.Fatalf("message %d: unexpected flood", i)
+		}
+	}
+	count, flooded := d.Observe("chat", "alice", now.Add(3*time.Second), policy)
+	if !flooded || count != 4 {
+		t.Errorf("expected flood on 4th message, got count %d flooded %v", count, flooded)
+	}
+	if _, flooded := d.Observe("chat", "alice", now.Add(4*time.Second), policy); flooded {
+		t.Error("expected an ongoing flood to be reported once")
+	}
+	if _, flooded := d.Observe("chat", "bob", now.Add(4*time.Second), policy); flooded {
+		t.Error("expected senders to be counted separately")
+	}
+
+	// Once the window passes the sender is back under the limit and can be flagged again
+	later := now.Add(time.Minute)
+	if count, flooded := d.Observe("chat", "alice", later, policy); flooded || count != 1 {
+		t.Errorf("expected count to reset, got %d flooded %v", count, flooded)
+	}
+	for i := 1; i <= 3; i++ {
+		_, flooded = d.Observe("chat", "alice", later.Add(time.Duration(i)*time.Second), policy)
+	}
+	if !flooded {
+		t.Error("expected a new flood to be reported")
+	}
+}
+
+func TestFloodDetector_disabled(t *testing.T) {
+	var d FloodDetector
+	for i := 0; i < 100; i++ {
+		if _, flooded := d.Observe("chat", "alice", time.Now(), FloodPolicy{}); flooded {
+			t.Fatal("expected detection to be disabled")
+		}
+	}
+}
+
+func TestUserSession_checkFlood(t *testing.T) {
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	prev := floodPolicy
+	t.Cleanup(func() { floodPolicy = prev })
+
+	t.Run("flags flood", func(t *testing.T) {
+		floodPolicy = FloodPolicy{MaxMessages: 2, Window: time.Minute}
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+
+		for i := 0; i < 3; i++ {
+			session.handleEvent(incomingText(chat, fmt.Sprintf("M%d", i), "spam"))
+		}
+
+		var floods []FloodPayload
+		messages := 0
+		for len(session.EventChan) > 0 {
+			evt := <-session.EventChan
+			switch evt.Type {
+			case "flood_detected":
+				floods = append(floods, evt.Payload.(FloodPayload))
+			case "message":
+				messages++
+			}
+		}
+		if len(floods) != 1 || floods[0].Count != 3 || floods[0].SenderJID != chat.String() || floods[0].MutedUntil != 0 {
+			t.Errorf("expected one flood event, got %+v", floods)
+		}
+		if messages != 3 {
+			t.Errorf("expected messages to keep flowing without mute, got %d", messages)
+		}
+		if calls := mock.GetCallsByMethod("SendAppState"); len(calls) != 0 {
+			t.Errorf("expected chat not to be muted, got %d calls", len(calls))
+		}
+	})
+
+	t.Run("counts by send time", func(t *testing.T) {
+		floodPolicy = FloodPolicy{MaxMessages: 2, Window: 10 * time.Second}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+
+		// A backlog sent a minute apart, delivered together on reconnect
+		for i := 0; i < 3; i++ {
+			evt := incomingText(chat, fmt.Sprintf("M%d", i), "hi")
+			evt.Info.Timestamp = evt.Info.Timestamp.Add(time.Duration(i) * time.Minute)
+			session.handleEvent(evt)
+		}
+		for len(session.EventChan) > 0 {
+			if evt := <-session.EventChan; evt.Type == "flood_detected" {
+				t.Errorf("expected no flood for an offline backlog, got %+v", evt.Payload)
+			}
+		}
+	})
+
+	t.Run("mutes flooded chat", func(t *testing.T) {
+		floodPolicy = FloodPolicy{MaxMessages: 2, Window: time.Minute, Mute: time.Hour}
+		mock := NewLoggedInMockClient()
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+		session.Messages = newTestMessageStore(t)
+
+		for i := 0; i < 5; i++ {
+			session.handleEvent(incomingText(chat, fmt.Sprintf("M%d", i), "spam"))
+		}
+
+		var kinds []string
+		for len(session.EventChan) > 0 {
+			kinds = append(kinds, (<-session.EventChan).Type)
+		}
+		if fmt.Sprint(kinds) != "[message message flood_detected]" {
+			t.Errorf("expected messages to stop after the flood, got %v", kinds)
+		}
+		stored, _ := session.Messages.List(t.Context(), chat.String(), 0, 10)
+		if len(stored) != 5 {
+			t.Errorf("expected all messages to be stored, got %d", len(stored))
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for len(mock.GetCallsByMethod("SendAppState")) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if calls := mock.GetCallsByMethod("SendAppState"); len(calls) != 1 {
+			t.Errorf("expected chat to be muted on WhatsApp, got %d calls", len(calls))
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+var errNotForwardable = errors.New("message can't be forwarded")
+
+// forwardedMessage rebuilds a stored or supplied message for resending, marked as
+// forwarded. Media is forwarded by reference: the encrypted upload is reused, which
+// only works while it's still on WhatsApp's servers.
+func forwardedMessage(p MessagePayload) (*waE2E.Message, error) {
+	forwarded := &waE2E.ContextInfo{
+		IsForwarded:     proto.Bool(true),
+		ForwardingScore: proto.Uint32(1),
+	}
+	hasMedia := len(p.MediaKey) > 0 && (p.DirectPath != "" || p.MediaURL != "")
+
+	switch p.MediaType {
+	case "":
+		if p.Text == "" {
+			return nil, fmt.Errorf("%w: it has no text", errNotForwardable)
+		}
+		return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String(p.Text),
+			ContextInfo: forwarded,
+		}}, nil
+	case "location":
+		return &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude:  proto.Float64(p.Latitude),
+			DegreesLongitude: proto.Float64(p.Longitude),
+			Address:          proto.String(p.Address),
+			ContextInfo:      forwarded,
+		}}, nil
+	case "contact":
+		if p.ContactVCard == "" {
+			return nil, fmt.Errorf("%w: the contact has no vCard", errNotForwardable)
+		}
+		return &waE2E.Message{ContactMessage: &waE2E.ContactMessage{
+			DisplayName: proto.String(p.ContactName),
+			Vcard:       proto.String(p.ContactVCard),
+			ContextInfo: forwarded,
+		}}, nil
+	case "image", "video", "document", "audio", "ptt", "sticker":
+		if !hasMedia {
+			return nil, fmt.Errorf("%w: its media keys weren't kept", errNotForwardable)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s messages aren't supported", errNotForwardable, p.MediaType)
+	}
+
+	switch p.MediaType {
+	case "image":
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			URL:           proto.String(p.MediaURL),
+			DirectPath:    proto.String(p.DirectPath),
+			MediaKey:      p.MediaKey,
+			FileEncSHA256: p.FileEncSHA256,
+			FileSHA256:    p.FileSHA256,
+			FileLength:    proto.Uint64(p.FileLength),
+			Mimetype:      proto.String(p.MimeType),
+			Caption:       proto.String(p.Caption),
+			ContextInfo:   forwarded,
+		}}, nil
+	case "video":
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			URL:           proto.String(p.MediaURL),
+			DirectPath:    proto.String(p.DirectPath),
+			MediaKey:      p.MediaKey,
+			FileEncSHA256: p.FileEncSHA256,
+			FileSHA256:    p.FileSHA256,
+			FileLength:    proto.Uint64(p.FileLength),
+			Mimetype:      proto.String(p.MimeType),
+			Caption:       proto.String(p.Caption),
+			ContextInfo:   forwarded,
+		}}, nil
+	case "document":
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			URL:           proto.String(p.MediaURL),
+			DirectPath:    proto.String(p.DirectPath),
+			MediaKey:      p.MediaKey,
+			FileEncSHA256: p.FileEncSHA256,
+			FileSHA256:    p.FileSHA256,
+			FileLength:    proto.Uint64(p.FileLength),
+			Mimetype:      proto.String(p.MimeType),
+			Caption:       proto.String(p.Caption),
+			FileName:      proto.String(p.FileName),
+			ContextInfo:   forwarded,
+		}}, nil
+	case "audio", "ptt":
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			URL:           proto.String(p.MediaURL),
+			DirectPath:    proto.String(p.DirectPath),
+			MediaKey:      p.MediaKey,
+			FileEncSHA256: p.FileEncSHA256,
+			FileSHA256:    p.FileSHA256,
+			FileLength:    proto.Uint64(p.FileLength),
+			Mimetype:      proto.String(p.MimeType),
+			PTT:           proto.Bool(p.IsPTT),
+			ContextInfo:   forwarded,
+		}}, nil
+	default: // sticker
+		return &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+			URL:           proto.String(p.MediaURL),
+			DirectPath:    proto.String(p.DirectPath),
+			MediaKey:      p.MediaKey,
+			FileEncSHA256: p.FileEncSHA256,
+			FileSHA256:    p.FileSHA256,
+			FileLength:    proto.Uint64(p.FileLength),
+			Mimetype:      proto.String(p.MimeType),
+			IsAnimated:    proto.Bool(p.IsAnimated),
+			ContextInfo:   forwarded,
+		}}, nil
+	}
+}
+
+func forwardMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID    int    `json:"user_id"`
+		ChatJID   string `json:"chat_jid"` // where the message is from
+		MessageID string `json:"message_id"`
+		ToJID     string `json:"to_jid"`
+		// Message is used instead of the message store, e.g. for messages from before it existed
+		Message *MessagePayload `json:"message,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Message == nil && (req.ChatJID == "" || req.MessageID == "") {
+		errorResponse(w, http.StatusBadRequest, "chat_jid and message_id, or message, required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	to, err := session.parseChatJID(req.ToJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid to_jid")
+		return
+	}
+
+	source := req.Message
+	if source == nil {
+		chat, err := session.parseChatJID(req.ChatJID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid jid")
+			return
+		}
+		if source, err = session.Messages.Get(r.Context(), chat.String(), req.MessageID); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if source == nil {
+			errorResponse(w, http.StatusNotFound, "message not found")
+			return
+		}
+	}
+
+	msg, err := forwardedMessage(*source)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := session.Client.SendMessage(r.Context(), to, msg)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestForwardedMessage(t *testing.T) {
+	msg, err := forwardedMessage(MessagePayload{Text: "hello"})
+	if err != nil || msg.GetExtendedTextMessage().GetText() != "hello" || !msg.GetExtendedTextMessage().GetContextInfo().GetIsForwarded() {
+		t.Errorf("unexpected text forward %+v (%v)", msg, err)
+	}
+
+	image := MessagePayload{MediaType: "image", MediaKey: []byte{1}, DirectPath: "/v/t62/abc", MimeType: "image/jpeg", FileLength: 42, Caption: "look"}
+	msg, err = forwardedMessage(image)
+	if err != nil || msg.GetImageMessage().GetDirectPath() != "/v/t62/abc" || msg.GetImageMessage().GetCaption() != "look" {
+		t.Errorf("unexpected image forward %+v (%v)", msg, err)
+	}
+
+	image.MediaKey = nil
+	if _, err := forwardedMessage(image); !errors.Is(err, errNotForwardable) {
+		t.Errorf("expected media without keys to be rejected, got %v", err)
+	}
+	if _, err := forwardedMessage(MessagePayload{MediaType: "system", Text: "Alice joined"}); !errors.Is(err, errNotForwardable) {
+		t.Errorf("expected system messages to be rejected, got %v", err)
+	}
+}
+
+func TestForwardMessageHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	session.Messages.Save(t.Context(), MessagePayload{ID: "MSG1", ChatJID: "111@s.whatsapp.net", Text: "pass it on", Timestamp: 100})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		forwardMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/forward", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net", "message_id": "nope", "to_jid": "222@s.whatsapp.net"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown message, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net", "message_id": "MSG1", "to_jid": "222@s.whatsapp.net"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post(`{"user_id": 1, "message": {"text": "supplied"}, "to_jid": "222@s.whatsapp.net"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a supplied message, got %d: %s", w.Code, w.Body.String())
+	}
+
+	calls := mock.GetCallsByMethod("SendMessage")
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 sends, got %d", len(calls))
+	}
+	if text := calls[0].Args[2].(*waE2E.Message).GetExtendedTextMessage().GetText(); text != "pass it on" {
+		t.Errorf("expected the stored message to be forwarded, got %q", text)
+	}
+	if to := calls[1].Args[1].(types.JID); to.String() != "222@s.whatsapp.net" {
+		t.Errorf("expected the forward to go to 222, got %v", to)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNominatimURL = "https://nominatim.openstreetmap.org"
+	geocodeTimeout      = 5 * time.Second
+	// Nominatim's usage policy allows at most one request per second
+	nominatimMinInterval = time.Second
+	geocodeCacheSize     = 1000
+)
+
+// Geocoder resolves coordinates to a human-readable address
+type Geocoder interface {
+	ReverseGeocode(ctx context.Context, lat, lon float64) (string, error)
+}
+
+// geocoder enriches incoming coordinate-only locations; nil disables enrichment
+var geocoder = geocoderFromEnv()
+
+// geocoderFromEnv builds the geocoder selected by GEOCODER ("nominatim" or empty to disable)
+func geocoderFromEnv() Geocoder {
+	switch name := strings.ToLower(os.Getenv("GEOCODER")); name {
+	case "":
+		return nil
+	case "nominatim":
+		baseURL := os.Getenv("NOMINATIM_URL")
+		if baseURL == "" {
+			baseURL = defaultNominatimURL
+		}
+		log.Printf("Reverse geocoding enabled via Nominatim at %s", baseURL)
+		return NewNominatimGeocoder(baseURL, os.Getenv("GEOCODER_LANGUAGE"))
+	default:
+		log.Printf("Warning: unknown GEOCODER %q, reverse geocoding disabled", name)
+		return nil
+	}
+}
+
+// NominatimGeocoder queries an OpenStreetMap Nominatim server. Requests are serialized and
+// spaced out to respect the public server's rate limit, and results are cached by
+// coordinates rounded to roughly a metre.
+type NominatimGeocoder struct {
+	BaseURL  string
+	Language string
+	Client   *http.Client
+
+	mu          sync.Mutex
+	lastRequest time.Time
+	minInterval time.Duration
+	cache       map[string]string
+}
+
+// NewNominatimGeocoder returns a geocoder for the Nominatim server at baseURL.
+// language is sent as Accept-Language and may be empty.
+func NewNominatimGeocoder(baseURL, language string) *NominatimGeocoder {
+	return &NominatimGeocoder{
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		Language:    language,
+		Client:      &http.Client{Timeout: geocodeTimeout},
+		minInterval: nominatimMinInterval,
+		cache:       make(map[string]string),
+	}
+}
+
+func (g *NominatimGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (string, error) {
+	key := strconv.FormatFloat(lat, 'f', 5, 64) + "," + strconv.FormatFloat(lon, 'f', 5, 64)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if address, ok := g.cache[key]; ok {
+		return address, nil
+	}
+	if wait := g.minInterval - time.Since(g.lastRequest); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	g.lastRequest = time.Now()
+
+	query := url.Values{
+		"format": {"jsonv2"},
+		"lat":    {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon":    {strconv.FormatFloat(lon, 'f', -1, 64)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.BaseURL+"/reverse?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "wa_meow (+https://github.com/jo-inc/wa_meow)")
+	if g.Language != "" {
+		req.Header.Set("Accept-Language", g.Language)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode nominatim response: %w", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("nominatim: %s", result.Error)
+	}
+
+	if len(g.cache) >= geocodeCacheSize {
+		g.cache = make(map[string]string)
+	}
+	g.cache[key] = result.DisplayName
+	return result.DisplayName, nil
+}
+
+// geocodeLocation fills in the address of a coordinate-only location. On failure the
+// location is left without an address.
+func geocodeLocation(g Geocoder, payload *MessagePayload) {
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	address, err := g.ReverseGeocode(ctx, payload.Latitude, payload.Longitude)
+	if err != nil {
+		log.Printf("[geocode] Reverse geocoding %s failed: %v", payload.ID, err)
+	} else if address != "" {
+		payload.Address = address
+		payload.AddressGeocoded = true
+		if payload.Text == "" {
+			payload.Text = address
+		}
+	}
+}
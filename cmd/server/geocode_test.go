@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type fakeGeocoder struct {
+	address string
+	err     error
+}
+
+func (f *fakeGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (string, error) {
+	return f.address, f.err
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/reverse" || r.URL.Query().Get("format") != "jsonv2" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("User-Agent") == "" {
+			t.Error("expected a User-Agent header")
+		}
+		if r.Header.Get("Accept-Language") != "de" {
+			t.Errorf("expected Accept-Language de, got %q", r.Header.Get("Accept-Language"))
+		}
+		if r.URL.Query().Get("lat") == "0" {
+			w.Write([]byte(`{"error":"Unable to geocode"}`))
+			return
+		}
+		w.Write([]byte(`{"display_name":"Brandenburger Tor, Pariser Platz, Berlin"}`))
+	}))
+	defer server.Close()
+
+	g := NewNominatimGeocoder(server.URL+"/", "de")
+	g.minInterval = 0
+
+	address, err := g.ReverseGeocode(context.Background(), 52.516275, 13.377704)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if address != "Brandenburger Tor, Pariser Platz, Berlin" {
+		t.Errorf("unexpected address %q", address)
+	}
+
+	// Nearby coordinates hit the cache
+	if _, err := g.ReverseGeocode(context.Background(), 52.5162751, 13.3777041); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 request with caching, got %d", requests.Load())
+	}
+
+	if _, err := g.ReverseGeocode(context.Background(), 0, 0); err == nil {
+		t.Error("expected error for ungeocodable coordinates")
+	}
+}
+
+func TestNominatimGeocoder_RespectsContextWhileRateLimited(t *testing.T) {
+	g := NewNominatimGeocoder("http://127.0.0.1:0", "")
+	g.lastRequest = time.Now()
+	g.minInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.ReverseGeocode(ctx, 1, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestUserSession_handleEvent_GeocodesLocation(t *testing.T) {
+	original := geocoder
+	defer func() { geocoder = original }()
+
+	lat, lon := 40.6892, -74.0445
+	locationEvent := func(address *string) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{
+					Chat:   types.JID{User: "chat", Server: types.DefaultUserServer},
+					Sender: types.JID{User: "sender", Server: types.DefaultUserServer},
+				},
+				ID:        "msg-loc",
+				Timestamp: time.Now(),
+			},
+			Message: &waE2E.Message{
+				LocationMessage: &waE2E.LocationMessage{
+					DegreesLatitude:  &lat,
+					DegreesLongitude: &lon,
+					Address:          address,
+				},
+			},
+		}
+	}
+	receive := func(t *testing.T, session *UserSession) MessagePayload {
+		t.Helper()
+		select {
+		case msg := <-session.EventChan:
+			return msg.Payload.(MessagePayload)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for location event")
+			return MessagePayload{}
+		}
+	}
+
+	t.Run("adds address to coordinate-only location", func(t *testing.T) {
+		geocoder = &fakeGeocoder{address: "Liberty Island, New York"}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+
+		session.handleEvent(locationEvent(nil))
+
+		payload := receive(t, session)
+		if payload.Address != "Liberty Island, New York" || !payload.AddressGeocoded {
+			t.Errorf("expected geocoded address, got %+v", payload)
+		}
+		if payload.Text != "Liberty Island, New York" {
+			t.Errorf("expected text to fall back to the address, got %q", payload.Text)
+		}
+	})
+
+	t.Run("keeps sender address", func(t *testing.T) {
+		geocoder = &fakeGeocoder{address: "should not be used"}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+		sent := "Statue of Liberty"
+
+		session.handleEvent(locationEvent(&sent))
+
+		payload := receive(t, session)
+		if payload.Address != sent || payload.AddressGeocoded {
+			t.Errorf("expected sender's address, got %+v", payload)
+		}
+	})
+
+	t.Run("emits without address when geocoding fails", func(t *testing.T) {
+		geocoder = &fakeGeocoder{err: errors.New("unavailable")}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+
+		session.handleEvent(locationEvent(nil))
+
+		payload := receive(t, session)
+		if payload.Address != "" || payload.Latitude != lat {
+			t.Errorf("expected plain location, got %+v", payload)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// GroupInvitePayload is what an invite link shows before joining. Participants may
+// be partial or empty; Size is the full count.
+type GroupInvitePayload struct {
+	GroupInfoPayload
+	Size             int  `json:"size"`
+	RequiresApproval bool `json:"requires_approval"` // joining sends a request to the admins
+}
+
+// inviteLinkResponse answers with a link and the code in it, which is what
+// /groups/invite-info and /groups/join take
+func inviteLinkResponse(w http.ResponseWriter, link string) {
+	jsonResponse(w, map[string]interface{}{
+		"link": link,
+		"code": strings.TrimPrefix(link, whatsmeow.InviteLinkPrefix),
+	})
+}
+
+// inviteErrorResponse reports a failed invite link call, telling apart what the
+// caller can fix from what failed on WhatsApp's side
+func inviteErrorResponse(w http.ResponseWriter, action string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, whatsmeow.ErrInviteLinkInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, whatsmeow.ErrInviteLinkRevoked):
+		status = http.StatusGone
+	case errors.Is(err, whatsmeow.ErrGroupInviteLinkUnauthorized), errors.Is(err, whatsmeow.ErrNotInGroup):
+		status = http.StatusForbidden
+	case errors.Is(err, whatsmeow.ErrGroupNotFound):
+		status = http.StatusNotFound
+	}
+	errorResponse(w, status, fmt.Sprintf("failed to %s: %v", action, err))
+}
+
+// groupInviteLinkHandler returns the current invite link of a group; only admins can get it
+func groupInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(r.URL.Query().Get("group_jid"))
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+
+	link, err := session.Client.GetGroupInviteLink(context.Background(), group, false)
+	if err != nil {
+		inviteErrorResponse(w, "get invite link", err)
+		return
+	}
+	inviteLinkResponse(w, link)
+}
+
+// resetGroupInviteLinkHandler revokes a group's invite link and returns the one replacing it
+func resetGroupInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		GroupJID string `json:"group_jid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(req.GroupJID)
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+
+	link, err := session.Client.GetGroupInviteLink(context.Background(), group, true)
+	if err != nil {
+		inviteErrorResponse(w, "reset invite link", err)
+		return
+	}
+	inviteLinkResponse(w, link)
+}
+
+// groupInviteInfoHandler shows the group an invite link leads to, without joining it
+func groupInviteInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		errorResponse(w, http.StatusBadRequest, "code required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	info, err := session.Client.GetGroupInfoFromLink(context.Background(), code)
+	if err != nil {
+		inviteErrorResponse(w, "resolve invite link", err)
+		return
+	}
+
+	jsonResponse(w, GroupInvitePayload{
+		GroupInfoPayload: newGroupInfoPayload(info),
+		Size:             max(info.ParticipantCount, len(info.Participants)),
+		RequiresApproval: info.IsJoinApprovalRequired,
+	})
+}
+
+// joinGroupHandler joins a group with an invite link or its code. For groups that
+// require approval this only sends the request to join.
+func joinGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Code   string `json:"code"` // the code or the whole link
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Code == "" {
+		errorResponse(w, http.StatusBadRequest, "code required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := session.Client.JoinGroupWithLink(context.Background(), req.Code)
+	if err != nil {
+		inviteErrorResponse(w, "join group", err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"group_jid": group.String(),
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestGroupInviteLinkHandlers(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	mock.InviteLink = whatsmeow.InviteLinkPrefix + "AbCdEf"
+
+	var resp struct {
+		Link string `json:"link"`
+		Code string `json:"code"`
+	}
+
+	w := httptest.NewRecorder()
+	groupInviteLinkHandler(w, httptest.NewRequest(http.MethodGet, "/groups/invite-link?user_id=1&group_jid="+group.String(), nil))
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Link != mock.InviteLink || resp.Code != "AbCdEf" {
+		t.Fatalf("expected the link and its code, got %d: %s", w.Code, w.Body.String())
+	}
+	if call := mock.GetCallsByMethod("GetGroupInviteLink")[0]; call.Args[2].(bool) {
+		t.Error("expected getting the link not to reset it")
+	}
+
+	w = httptest.NewRecorder()
+	resetGroupInviteLinkHandler(w, httptest.NewRequest(http.MethodPost, "/groups/invite-link/reset", bytes.NewBufferString(`{"user_id": 1, "group_jid": "`+group.String()+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if call := mock.GetCallsByMethod("GetGroupInviteLink")[1]; !call.Args[2].(bool) {
+		t.Error("expected the link to be reset")
+	}
+
+	w = httptest.NewRecorder()
+	groupInviteLinkHandler(w, httptest.NewRequest(http.MethodGet, "/groups/invite-link?user_id=1&group_jid=123@s.whatsapp.net", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-group jid, got %d", w.Code)
+	}
+
+	mock.InviteLinkError = fmt.Errorf("%w: 401", whatsmeow.ErrGroupInviteLinkUnauthorized)
+	w = httptest.NewRecorder()
+	groupInviteLinkHandler(w, httptest.NewRequest(http.MethodGet, "/groups/invite-link?user_id=1&group_jid="+group.String(), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin, got %d", w.Code)
+	}
+}
+
+func TestGroupInviteInfoAndJoin(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.InviteGroup = &types.GroupInfo{
+		JID:                         types.NewJID("120363000000000000", types.GroupServer),
+		GroupName:                   types.GroupName{Name: "Book club"},
+		GroupMembershipApprovalMode: types.GroupMembershipApprovalMode{IsJoinApprovalRequired: true},
+		ParticipantCount:            42,
+	}
+
+	w := httptest.NewRecorder()
+	groupInviteInfoHandler(w, httptest.NewRequest(http.MethodGet, "/groups/invite-info?user_id=1&code=AbCdEf", nil))
+	var info GroupInvitePayload
+	json.Unmarshal(w.Body.Bytes(), &info)
+	if w.Code != http.StatusOK || info.Name != "Book club" || info.Size != 42 || !info.RequiresApproval {
+		t.Fatalf("expected the group behind the link, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	joinGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/join", bytes.NewBufferString(`{"user_id": 1, "code": "https://chat.whatsapp.com/AbCdEf"}`)))
+	var joined struct {
+		GroupJID string `json:"group_jid"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &joined)
+	if w.Code != http.StatusOK || joined.GroupJID != mock.InviteGroup.JID.String() {
+		t.Fatalf("expected to join the group, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{whatsmeow.ErrInviteLinkRevoked, http.StatusGone},
+		{whatsmeow.ErrInviteLinkInvalid, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		mock.InviteLinkError = tt.err
+		w = httptest.NewRecorder()
+		joinGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/join", bytes.NewBufferString(`{"user_id": 1, "code": "AbCdEf"}`)))
+		if w.Code != tt.want {
+			t.Errorf("expected %d for %v, got %d", tt.want, tt.err, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	joinGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/join", bytes.NewBufferString(`{"user_id": 1}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a code, got %d", w.Code)
+	}
+}
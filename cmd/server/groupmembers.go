@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// cachedGroup is the participant list of one group and when it last changed
+type cachedGroup struct {
+	Participants []ParticipantInfo `json:"participants"`
+	UpdatedAt    int64             `json:"updated_at"` // unix seconds
+}
+
+// GroupMembers caches the participants of the user's groups so they can be listed
+// without asking WhatsApp. A group is fetched once and then kept current from the
+// join, leave, promote and demote notifications. The cache is persisted in the message
+// store so it survives restarts. The zero value is ready to use and persists nothing.
+type GroupMembers struct {
+	mu     sync.RWMutex
+	groups map[string]cachedGroup
+	store  *MessageStore
+}
+
+// load reads the persisted groups from st and keeps st for later changes
+func (g *GroupMembers) load(st *MessageStore) error {
+	groups, err := st.GroupMembers(context.Background())
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.groups = groups
+	g.store = st
+	return nil
+}
+
+// Get returns a group's participants and when they last changed, if the group is cached
+func (g *GroupMembers) Get(groupJID string) ([]ParticipantInfo, int64, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	group, ok := g.groups[groupJID]
+	return group.Participants, group.UpdatedAt, ok
+}
+
+// Set replaces a group's participants, e.g. after fetching its info
+func (g *GroupMembers) Set(groupJID string, participants []ParticipantInfo, at time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.put(groupJID, participants, at)
+}
+
+// Refresh replaces a cached group's participants with a list just fetched from
+// WhatsApp and returns who joined or left since, e.g. while notifications were missed.
+// It returns nil if nobody did, or if the group wasn't cached and there's nothing to compare.
+func (g *GroupMembers) Refresh(groupJID string, participants []ParticipantInfo, at time.Time) *core.GroupUpdatePayload {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prev, cached := g.groups[groupJID]
+	if cached && slices.Equal(prev.Participants, participants) {
+		// Unchanged, so changed_since keeps answering 304
+		return nil
+	}
+	g.put(groupJID, participants, at)
+	if !cached {
+		return nil
+	}
+
+	before := make(map[string]bool, len(prev.Participants))
+	for _, p := range prev.Participants {
+		before[p.JID] = true
+	}
+	changed := &core.GroupUpdatePayload{GroupJID: groupJID, Timestamp: at.Unix(), Reconciled: true}
+	for _, p := range participants {
+		if !before[p.JID] {
+			changed.Joined = append(changed.Joined, p.JID)
+		}
+		delete(before, p.JID)
+	}
+	for _, p := range prev.Participants {
+		if before[p.JID] {
+			changed.Left = append(changed.Left, p.JID)
+		}
+	}
+	if len(changed.Joined)+len(changed.Left) == 0 {
+		// Only admin rights changed
+		return nil
+	}
+	return changed
+}
+
+// Forget drops a group the user has left
+func (g *GroupMembers) Forget(groupJID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.groups, groupJID)
+	if err := g.store.DeleteGroupMembers(context.Background(), groupJID); err != nil {
+		log.Printf("[groups] Failed to forget %s: %v", groupJID, err)
+	}
+}
+
+// Apply updates a cached group from a membership notification. Groups that aren't
+// cached are left alone; they're fetched in full when first asked for.
+func (g *GroupMembers) Apply(v *events.GroupInfo) {
+	if len(v.Join)+len(v.Leave)+len(v.Promote)+len(v.Demote) == 0 {
+		return
+	}
+	groupJID := v.JID.String()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	group, ok := g.groups[groupJID]
+	if !ok {
+		return
+	}
+
+	byJID := make(map[string]int, len(group.Participants))
+	participants := make([]ParticipantInfo, 0, len(group.Participants)+len(v.Join))
+	for _, p := range group.Participants {
+		byJID[p.JID] = len(participants)
+		participants = append(participants, p)
+	}
+	for _, jid := range v.Join {
+		if _, ok := byJID[jid.String()]; !ok {
+			byJID[jid.String()] = len(participants)
+			participants = append(participants, ParticipantInfo{JID: jid.String()})
+		}
+	}
+	setAdmin := func(jids []types.JID, admin bool) {
+		for _, jid := range jids {
+			if i, ok := byJID[jid.String()]; ok {
+				participants[i].IsAdmin = admin
+				participants[i].IsSuperAdmin = participants[i].IsSuperAdmin && admin
+			}
+		}
+	}
+	setAdmin(v.Promote, true)
+	setAdmin(v.Demote, false)
+	if len(v.Leave) > 0 {
+		left := make(map[string]bool, len(v.Leave))
+		for _, jid := range v.Leave {
+			left[jid.String()] = true
+		}
+		kept := participants[:0]
+		for _, p := range participants {
+			if !left[p.JID] {
+				kept = append(kept, p)
+			}
+		}
+		participants = kept
+	}
+
+	at := v.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	g.put(groupJID, participants, at)
+}
+
+// put stores a group, keeping UpdatedAt increasing so every change is newer than any
+// changed_since a client got back before it. The caller must hold g.mu.
+func (g *GroupMembers) put(groupJID string, participants []ParticipantInfo, at time.Time) {
+	if g.groups == nil {
+		g.groups = make(map[string]cachedGroup)
+	}
+	group := cachedGroup{Participants: participants, UpdatedAt: at.Unix()}
+	if prev, ok := g.groups[groupJID]; ok && group.UpdatedAt <= prev.UpdatedAt {
+		group.UpdatedAt = prev.UpdatedAt + 1
+	}
+	g.groups[groupJID] = group
+	if err := g.store.SaveGroupMembers(context.Background(), groupJID, group); err != nil {
+		log.Printf("[groups] Failed to persist participants of %s: %v", groupJID, err)
+	}
+}
+
+// GroupMembers returns every persisted group participant list, by group JID
+func (st *MessageStore) GroupMembers(ctx context.Context) (map[string]cachedGroup, error) {
+	groups := make(map[string]cachedGroup)
+	if st == nil {
+		return groups, nil
+	}
+	rows, err := st.db.QueryContext(ctx, `SELECT group_jid, participants, updated_at FROM group_members`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupJID, data string
+		var group cachedGroup
+		if err := rows.Scan(&groupJID, &data, &group.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &group.Participants); err != nil {
+			return nil, err
+		}
+		groups[groupJID] = group
+	}
+	return groups, rows.Err()
+}
+
+// SaveGroupMembers persists a group's participant list
+func (st *MessageStore) SaveGroupMembers(ctx context.Context, groupJID string, group cachedGroup) error {
+	if st == nil {
+		return nil
+	}
+	data, err := json.Marshal(group.Participants)
+	if err != nil {
+		return err
+	}
+	_, err = st.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO group_members (group_jid, participants, updated_at) VALUES (?, ?, ?)`,
+		groupJID, string(data), group.UpdatedAt)
+	return err
+}
+
+// DeleteGroupMembers drops a group's persisted participant list
+func (st *MessageStore) DeleteGroupMembers(ctx context.Context, groupJID string) error {
+	if st == nil {
+		return nil
+	}
+	_, err := st.db.ExecContext(ctx, `DELETE FROM group_members WHERE group_jid = ?`, groupJID)
+	return err
+}
+
+// participantsOf converts a group's participants for the API
+func participantsOf(info *types.GroupInfo) []ParticipantInfo {
+	participants := make([]ParticipantInfo, 0, len(info.Participants))
+	for _, p := range info.Participants {
+		participants = append(participants, ParticipantInfo{
+			JID:          p.JID.String(),
+			IsAdmin:      p.IsAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+		})
+	}
+	return participants
+}
+
+// refreshGroup caches the participants of a group just fetched from WhatsApp, emitting
+// a reconciled group_update event for joins and leaves the cache hadn't seen
+func (s *UserSession) refreshGroup(group types.JID, info *types.GroupInfo) {
+	changed := s.Groups.Refresh(group.String(), participantsOf(info), time.Now())
+	if changed == nil || !s.chatAllowed(group) {
+		return
+	}
+	log.Printf("[groups] User %d: %s has %d new and %d departed members", s.UserID, changed.GroupJID, len(changed.Joined), len(changed.Left))
+	s.emit(core.NewEvent(*changed))
+}
+
+// trackGroupMembers keeps the group cache current from membership notifications
+func (s *UserSession) trackGroupMembers(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.JoinedGroup:
+		s.Groups.Set(v.JID.String(), participantsOf(&v.GroupInfo), time.Now())
+	case *events.GroupInfo:
+		if own := s.Client.GetStore().GetID(); own != nil {
+			for _, jid := range v.Leave {
+				if jid.User == own.User || jid.User == s.Client.GetStore().GetLID().User {
+					s.Groups.Forget(v.JID.String())
+					return
+				}
+			}
+		}
+		s.Groups.Apply(v)
+	}
+}
+
+// emitGroupUpdate publishes membership and settings changes of a group
+func (s *UserSession) emitGroupUpdate(v *events.GroupInfo) {
+	if !s.chatAllowed(v.JID) {
+		return
+	}
+	if payload, ok := core.NewGroupUpdatePayload(v); ok {
+		s.emit(core.NewEvent(payload))
+	}
+}
+
+// groupParticipants returns a group's participants and when they last changed, from
+// the cache or, the first time, from WhatsApp
+func (s *UserSession) groupParticipants(ctx context.Context, group types.JID) ([]ParticipantInfo, int64, error) {
+	if participants, updatedAt, ok := s.Groups.Get(group.String()); ok {
+		return participants, updatedAt, nil
+	}
+	info, err := s.Client.GetGroupInfo(ctx, group)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.refreshGroup(group, info)
+	participants, updatedAt, _ := s.Groups.Get(group.String())
+	return participants, updatedAt, nil
+}
+
+// listGroupParticipantsHandler lists a group's participants from the cache, fetching
+// them from WhatsApp the first time. With changed_since (unix seconds, as returned in
+// X-Updated-At) it answers 304 if nothing changed since then.
+func listGroupParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	groupJID := r.URL.Query().Get("group_jid")
+	if groupJID == "" {
+		errorResponse(w, http.StatusBadRequest, "group_jid required")
+		return
+	}
+
+	var changedSince int64
+	if raw := r.URL.Query().Get("changed_since"); raw != "" {
+		var err error
+		if changedSince, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid changed_since")
+			return
+		}
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := types.ParseJID(groupJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	participants, updatedAt, err := session.groupParticipants(context.Background(), jid)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to get group info: "+err.Error())
+		return
+	}
+
+	w.Header().Set("X-Updated-At", strconv.FormatInt(updatedAt, 10))
+	if changedSince > 0 && updatedAt <= changedSince {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	jsonResponse(w, participants)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestGroupMembers_Apply(t *testing.T) {
+	var g GroupMembers
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	carol := types.NewJID("333", types.DefaultUserServer)
+
+	// Changes to groups that were never fetched are ignored
+	g.Apply(&events.GroupInfo{JID: group, Join: []types.JID{alice}})
+	if _, _, ok := g.Get(group.String()); ok {
+		t.Fatal("expected an unknown group to stay uncached")
+	}
+
+	start := time.Unix(1700000000, 0)
+	g.Set(group.String(), []ParticipantInfo{{JID: alice.String(), IsAdmin: true, IsSuperAdmin: true}, {JID: bob.String()}}, start)
+	g.Apply(&events.GroupInfo{JID: group, Timestamp: start, Join: []types.JID{carol}, Leave: []types.JID{bob}, Promote: []types.JID{carol}, Demote: []types.JID{alice}})
+
+	participants, updatedAt, _ := g.Get(group.String())
+	if len(participants) != 2 || participants[0].JID != alice.String() || participants[0].IsAdmin || participants[0].IsSuperAdmin {
+		t.Errorf("expected alice demoted and bob gone, got %+v", participants)
+	}
+	if participants[1].JID != carol.String() || !participants[1].IsAdmin {
+		t.Errorf("expected carol added as admin, got %+v", participants)
+	}
+	if updatedAt <= start.Unix() {
+		t.Errorf("expected a change in the same second to still move updated_at, got %d", updatedAt)
+	}
+}
+
+func TestListGroupParticipantsHandler_Cache(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	if err := session.Groups.load(newTestMessageStore(t)); err != nil {
+		t.Fatal(err)
+	}
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	mock.GroupInfo = &types.GroupInfo{JID: group, Participants: []types.GroupParticipant{{JID: types.NewJID("111", types.DefaultUserServer)}}}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		listGroupParticipantsHandler(w, httptest.NewRequest(http.MethodGet, "/groups/participants?user_id=1&group_jid="+group.String()+query, nil))
+		return w
+	}
+	first := get("")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	updatedAt := first.Header().Get("X-Updated-At")
+	if w := get("&changed_since=" + updatedAt); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 before any change, got %d", w.Code)
+	}
+	if n := len(mock.GetCallsByMethod("GetGroupInfo")); n != 1 {
+		t.Errorf("expected one network fetch, got %d", n)
+	}
+
+	session.handleEvent(&events.GroupInfo{JID: group, Timestamp: time.Now(), Join: []types.JID{types.NewJID("222", types.DefaultUserServer)}})
+	w := get("&changed_since=" + updatedAt)
+	if w.Code != http.StatusOK || w.Header().Get("X-Updated-At") == updatedAt {
+		t.Fatalf("expected the join to show up, got %d", w.Code)
+	}
+
+	// Persisted participants survive a reload
+	var reloaded GroupMembers
+	if err := reloaded.load(session.Groups.store); err != nil {
+		t.Fatal(err)
+	}
+	if participants, _, _ := reloaded.Get(group.String()); len(participants) != 2 {
+		t.Errorf("expected 2 persisted participants, got %+v", participants)
+	}
+}
+
+func TestGetGroupInfoHandler_ParticipantsChanged(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	alice := types.GroupParticipant{JID: types.NewJID("111", types.DefaultUserServer)}
+	bob := types.GroupParticipant{JID: types.NewJID("222", types.DefaultUserServer)}
+	carol := types.GroupParticipant{JID: types.NewJID("333", types.DefaultUserServer)}
+
+	get := func(participants ...types.GroupParticipant) {
+		t.Helper()
+		mock.GroupInfo = &types.GroupInfo{JID: group, Participants: participants}
+		w := httptest.NewRecorder()
+		getGroupInfoHandler(w, httptest.NewRequest(http.MethodGet, "/groups/info?user_id=1&group_jid="+group.String(), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	noEvent := func() {
+		t.Helper()
+		select {
+		case evt := <-session.EventChan:
+			t.Errorf("expected no event, got %+v", evt)
+		default:
+		}
+	}
+
+	// The first fetch has nothing to compare against
+	get(alice, bob)
+	noEvent()
+
+	get(alice, carol)
+	select {
+	case evt := <-session.EventChan:
+		changed, ok := evt.Payload.(core.GroupUpdatePayload)
+		if evt.Type != "group_update" || !ok || !changed.Reconciled || changed.GroupJID != group.String() ||
+			len(changed.Joined) != 1 || changed.Joined[0] != carol.JID.String() || len(changed.Left) != 1 || changed.Left[0] != bob.JID.String() {
+			t.Errorf("expected carol joined and bob left, got %+v", evt)
+		}
+	default:
+		t.Fatal("expected a reconciled group_update event")
+	}
+
+	// Nor is anything reported for a promotion, which comes with its own notification
+	carol.IsAdmin = true
+	get(alice, carol)
+	noEvent()
+	if participants, _, _ := session.Groups.Get(group.String()); !participants[1].IsAdmin {
+		t.Errorf("expected the cache to pick up the promotion, got %+v", participants)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// participantUpdateErrors explains the codes WhatsApp answers a participant change with
+var participantUpdateErrors = map[int]string{
+	http.StatusUnauthorized:        "not allowed, the user isn't an admin",
+	http.StatusForbidden:           "their privacy settings don't allow adding them; invite them with invite_code instead",
+	http.StatusNotFound:            "not a WhatsApp user or not in the group",
+	http.StatusRequestTimeout:      "they recently left the group and can't be added back yet",
+	http.StatusConflict:            "already in the group",
+	http.StatusNotAcceptable:       "the group is full",
+	http.StatusInternalServerError: "WhatsApp couldn't apply the change",
+}
+
+// ParticipantUpdateResult is the outcome of a participant change for one person
+type ParticipantUpdateResult struct {
+	JID    string `json:"jid"`
+	Status int    `json:"status"` // 200, or the code WhatsApp refused the change with
+	Error  string `json:"error,omitempty"`
+	// Set when the person can't be added directly and has to be sent an invite
+	InviteCode       string `json:"invite_code,omitempty"`
+	InviteExpiration int64  `json:"invite_expiration,omitempty"`
+}
+
+// participantUpdateResults converts WhatsApp's answer to a participant change
+func participantUpdateResults(participants []types.GroupParticipant) ([]ParticipantUpdateResult, []types.JID) {
+	results := make([]ParticipantUpdateResult, 0, len(participants))
+	var changed []types.JID
+	for _, p := range participants {
+		result := ParticipantUpdateResult{JID: p.JID.String(), Status: http.StatusOK}
+		if p.Error != 0 {
+			result.Status = p.Error
+			result.Error = participantUpdateErrors[p.Error]
+			if result.Error == "" {
+				result.Error = fmt.Sprintf("WhatsApp refused the change (%d)", p.Error)
+			}
+		} else {
+			changed = append(changed, p.JID)
+		}
+		if p.AddRequest != nil {
+			result.InviteCode = p.AddRequest.Code
+			result.InviteExpiration = p.AddRequest.Expiration.Unix()
+		}
+		results = append(results, result)
+	}
+	return results, changed
+}
+
+// updateGroupParticipantsHandler adds, removes, promotes or demotes group members.
+// Each participant gets its own result, since WhatsApp applies the change to some and
+// refuses it for others.
+func updateGroupParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID       int      `json:"user_id"`
+		GroupJID     string   `json:"group_jid"`
+		Action       string   `json:"action"` // add, remove, promote or demote
+		Participants []string `json:"participants"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	action := whatsmeow.ParticipantChange(req.Action)
+	switch action {
+	case whatsmeow.ParticipantChangeAdd, whatsmeow.ParticipantChangeRemove,
+		whatsmeow.ParticipantChangePromote, whatsmeow.ParticipantChangeDemote:
+	default:
+		errorResponse(w, http.StatusBadRequest, "action must be add, remove, promote or demote")
+		return
+	}
+	if len(req.Participants) == 0 {
+		errorResponse(w, http.StatusBadRequest, "participants required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(req.GroupJID)
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+	participants := make([]types.JID, 0, len(req.Participants))
+	for _, raw := range req.Participants {
+		jid, err := types.ParseJID(raw)
+		if err != nil || jid.User == "" {
+			errorResponse(w, http.StatusBadRequest, "invalid participant "+raw)
+			return
+		}
+		participants = append(participants, jid.ToNonAD())
+	}
+
+	updated, err := session.Client.UpdateGroupParticipants(context.Background(), group, participants, action)
+	if err != nil {
+		// The whole request was refused, e.g. by a group we're not an admin of
+		errorResponse(w, groupUpdateStatus(err), fmt.Sprintf("failed to update participants: %v", err))
+		return
+	}
+	results, changed := participantUpdateResults(updated)
+
+	// Keep the participant cache current without waiting for the notification
+	if len(changed) > 0 {
+		change := &events.GroupInfo{JID: group, Timestamp: time.Now()}
+		switch action {
+		case whatsmeow.ParticipantChangeAdd:
+			change.Join = changed
+		case whatsmeow.ParticipantChangeRemove:
+			change.Leave = changed
+		case whatsmeow.ParticipantChangePromote:
+			change.Promote = changed
+		case whatsmeow.ParticipantChangeDemote:
+			change.Demote = changed
+		}
+		session.Groups.Apply(change)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"participants": results,
+	})
+}
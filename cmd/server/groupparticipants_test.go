@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestUpdateGroupParticipantsHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	session.Groups.Set(group.String(), []ParticipantInfo{{JID: alice.String(), IsAdmin: true}}, time.Now())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		updateGroupParticipantsHandler(w, httptest.NewRequest(http.MethodPost, "/groups/participants/update", bytes.NewBufferString(body)))
+		return w
+	}
+
+	t.Run("validates the request", func(t *testing.T) {
+		bad := []string{
+			`{"user_id": 1, "group_jid": "` + group.String() + `", "action": "ban", "participants": ["222@s.whatsapp.net"]}`,
+			`{"user_id": 1, "group_jid": "` + group.String() + `", "action": "add"}`,
+			`{"user_id": 1, "group_jid": "222@s.whatsapp.net", "action": "add", "participants": ["222@s.whatsapp.net"]}`,
+		}
+		for _, body := range bad {
+			if w := post(body); w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for %s, got %d", body, w.Code)
+			}
+		}
+	})
+
+	t.Run("reports each participant", func(t *testing.T) {
+		carol := types.NewJID("333", types.DefaultUserServer)
+		mock.ParticipantUpdates = []types.GroupParticipant{
+			{JID: bob},
+			{JID: carol, Error: http.StatusForbidden, AddRequest: &types.GroupParticipantAddRequest{Code: "INVITE", Expiration: time.Unix(1700000000, 0)}},
+		}
+		w := post(`{"user_id": 1, "group_jid": "` + group.String() + `", "action": "add", "participants": ["222@s.whatsapp.net", "333@s.whatsapp.net"]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		call := mock.GetCallsByMethod("UpdateGroupParticipants")[0]
+		if call.Args[3].(whatsmeow.ParticipantChange) != whatsmeow.ParticipantChangeAdd {
+			t.Errorf("expected an add, got %v", call.Args[3])
+		}
+
+		var resp struct {
+			Participants []ParticipantUpdateResult `json:"participants"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Participants) != 2 || resp.Participants[0].Status != http.StatusOK {
+			t.Fatalf("expected bob to be added, got %+v", resp.Participants)
+		}
+		refused := resp.Participants[1]
+		if refused.Status != http.StatusForbidden || refused.Error == "" || refused.InviteCode != "INVITE" || refused.InviteExpiration != 1700000000 {
+			t.Errorf("expected carol to be refused with an invite code, got %+v", refused)
+		}
+
+		participants, _, _ := session.Groups.Get(group.String())
+		if len(participants) != 2 || participants[1].JID != bob.String() {
+			t.Errorf("expected only bob to join the cached group, got %+v", participants)
+		}
+	})
+
+	t.Run("maps a refused request", func(t *testing.T) {
+		mock.ParticipantUpdateError = fmt.Errorf("%w: not an admin", whatsmeow.ErrIQForbidden)
+		defer func() { mock.ParticipantUpdateError = nil }()
+		w := post(`{"user_id": 1, "group_jid": "` + group.String() + `", "action": "remove", "participants": ["222@s.whatsapp.net"]}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a non-admin, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
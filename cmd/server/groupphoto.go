@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// groupPhotoHandler gets (GET) or sets (POST) a group's photo
+func groupPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getGroupPhoto(w, r)
+	case http.MethodPost:
+		uploadLimiter.wrap(setGroupPhoto)(w, r)
+	default:
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// getGroupPhoto returns where to download the group's photo; preview=true asks for the thumbnail
+func getGroupPhoto(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(r.URL.Query().Get("group_jid"))
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+
+	info, err := session.Client.GetProfilePictureInfo(context.Background(), group, &whatsmeow.GetProfilePictureParams{
+		Preview: r.URL.Query().Get("preview") == "true",
+	})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet):
+		errorResponse(w, http.StatusNotFound, "group has no photo")
+		return
+	case errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		errorResponse(w, http.StatusForbidden, "not allowed to see the group photo")
+		return
+	case err != nil:
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to get group photo: %v", err))
+		return
+	case info == nil:
+		// Only returned when asking with the ID of the current photo, which this doesn't
+		errorResponse(w, http.StatusNotFound, "group has no photo")
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":   info.ID,
+		"url":  info.URL,
+		"type": info.Type,
+	})
+}
+
+// setGroupPhoto replaces the group's photo with a JPEG, or removes it. Only admins can,
+// unless the group isn't locked.
+func setGroupPhoto(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   int    `json:"user_id"`
+		GroupJID string `json:"group_jid"`
+		ImageB64 string `json:"image_b64"`
+		Remove   bool   `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	var photo []byte
+	switch {
+	case req.Remove && req.ImageB64 != "":
+		errorResponse(w, http.StatusBadRequest, "image_b64 and remove are mutually exclusive")
+		return
+	case !req.Remove:
+		var err error
+		if photo, err = decodePhoto(req.ImageB64, "group photo"); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(req.GroupJID)
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+
+	pictureID, err := session.Client.SetGroupPhoto(context.Background(), group, photo)
+	if errors.Is(err, whatsmeow.ErrInvalidImageFormat) {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		errorResponse(w, groupUpdateStatus(err), fmt.Sprintf("failed to set group photo: %v", err))
+		return
+	}
+
+	if req.Remove {
+		jsonResponse(w, map[string]interface{}{"removed": true})
+		return
+	}
+	jsonResponse(w, map[string]interface{}{
+		"picture_id": pictureID,
+	})
+}
+
+// decodePhoto decodes the image_b64 of a group or profile photo, which WhatsApp only
+// takes as a JPEG
+func decodePhoto(imageB64, what string) ([]byte, error) {
+	photo, err := base64.StdEncoding.DecodeString(imageB64)
+	if err != nil || len(photo) == 0 {
+		return nil, errors.New("image_b64 required")
+	}
+	if mimeType := sniffMimeType(photo); mimeType != "image/jpeg" {
+		if mimeType == "" {
+			mimeType = "an unknown type"
+		}
+		return nil, fmt.Errorf("%s must be a JPEG, got %s", what, mimeType)
+	}
+	return photo, nil
+}
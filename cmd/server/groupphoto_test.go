@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestGetGroupPhoto(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.ProfilePicture = &types.ProfilePictureInfo{ID: "1700000000", URL: "https://pps.whatsapp.net/v/photo.jpg", Type: "preview"}
+
+	w := httptest.NewRecorder()
+	groupPhotoHandler(w, httptest.NewRequest(http.MethodGet, "/groups/photo?user_id=1&group_jid=120363000000000000@g.us&preview=true", nil))
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp["id"] != "1700000000" || resp["url"] != mock.ProfilePicture.URL {
+		t.Fatalf("expected the photo, got %d: %s", w.Code, w.Body.String())
+	}
+	if params := mock.GetCallsByMethod("GetProfilePictureInfo")[0].Args[2].(*whatsmeow.GetProfilePictureParams); !params.Preview {
+		t.Error("expected the thumbnail to be asked for")
+	}
+
+	mock.ProfilePicture, mock.ProfilePictureError = nil, whatsmeow.ErrProfilePictureNotSet
+	w = httptest.NewRecorder()
+	groupPhotoHandler(w, httptest.NewRequest(http.MethodGet, "/groups/photo?user_id=1&group_jid=120363000000000000@g.us", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a group without a photo, got %d", w.Code)
+	}
+}
+
+func TestSetGroupPhoto(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.GroupPhotoID = "1700000001"
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, img, nil)
+	body, _ := json.Marshal(map[string]interface{}{
+		"user_id": 1, "group_jid": "120363000000000000@g.us", "image_b64": base64.StdEncoding.EncodeToString(photo.Bytes()),
+	})
+	w := httptest.NewRecorder()
+	groupPhotoHandler(w, httptest.NewRequest(http.MethodPost, "/groups/photo", bytes.NewReader(body)))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("1700000001")) {
+		t.Fatalf("expected the new picture ID, got %d: %s", w.Code, w.Body.String())
+	}
+	if sent := mock.GetCallsByMethod("SetGroupPhoto")[0].Args[2].([]byte); !bytes.Equal(sent, photo.Bytes()) {
+		t.Error("expected the JPEG to be set as is")
+	}
+
+	w = httptest.NewRecorder()
+	groupPhotoHandler(w, httptest.NewRequest(http.MethodPost, "/groups/photo", bytes.NewBufferString(`{"user_id": 1, "group_jid": "120363000000000000@g.us", "remove": true}`)))
+	if w.Code != http.StatusOK || mock.GetCallsByMethod("SetGroupPhoto")[1].Args[2].([]byte) != nil {
+		t.Errorf("expected the photo to be removed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var notJPEG bytes.Buffer
+	png.Encode(&notJPEG, img)
+	body, _ = json.Marshal(map[string]interface{}{
+		"user_id": 1, "group_jid": "120363000000000000@g.us", "image_b64": base64.StdEncoding.EncodeToString(notJPEG.Bytes()),
+	})
+	w = httptest.NewRecorder()
+	groupPhotoHandler(w, httptest.NewRequest(http.MethodPost, "/groups/photo", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a PNG, got %d", w.Code)
+	}
+	if calls := mock.GetCallsByMethod("SetGroupPhoto"); len(calls) != 2 {
+		t.Errorf("expected the PNG not to reach WhatsApp, got %d calls", len(calls))
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WhatsApp's limits on group settings
+const (
+	maxGroupNameLength  = 100
+	maxGroupTopicLength = 2048
+)
+
+// disappearingTimers are the only timers WhatsApp offers, in seconds
+var disappearingTimers = map[uint32]time.Duration{
+	0:       whatsmeow.DisappearingTimerOff,
+	86400:   whatsmeow.DisappearingTimer24Hours,
+	604800:  whatsmeow.DisappearingTimer7Days,
+	7776000: whatsmeow.DisappearingTimer90Days,
+}
+
+// groupUpdateStatus tells apart a group the caller can't change from one that
+// doesn't exist or a setting WhatsApp turned down
+func groupUpdateStatus(err error) int {
+	switch {
+	case errors.Is(err, whatsmeow.ErrIQForbidden), errors.Is(err, whatsmeow.ErrIQNotAuthorized), errors.Is(err, whatsmeow.ErrNotInGroup):
+		return http.StatusForbidden
+	case errors.Is(err, whatsmeow.ErrGroupNotFound), errors.Is(err, whatsmeow.ErrIQNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, whatsmeow.ErrIQBadRequest):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// updateGroupHandler changes a group's name, topic, announce-only and locked modes and
+// disappearing-message timer. Only the fields given are changed, one at a time in that
+// order; WhatsApp has no call that sets them together, so a failure can leave the
+// earlier ones applied, and the error lists them in "updated".
+func updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID         int     `json:"user_id"`
+		GroupJID       string  `json:"group_jid"`
+		Name           *string `json:"name"`
+		Topic          *string `json:"topic"`    // empty clears it
+		Announce       *bool   `json:"announce"` // only admins can send messages
+		Locked         *bool   `json:"locked"`   // only admins can edit the group info
+		EphemeralTimer *uint32 `json:"ephemeral_timer"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	if req.Name == nil && req.Topic == nil && req.Announce == nil && req.Locked == nil && req.EphemeralTimer == nil {
+		errorResponse(w, http.StatusBadRequest, "nothing to update")
+		return
+	}
+	if req.Name != nil && (*req.Name == "" || utf8.RuneCountInString(*req.Name) > maxGroupNameLength) {
+		errorResponse(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxGroupNameLength))
+		return
+	}
+	if req.Topic != nil && utf8.RuneCountInString(*req.Topic) > maxGroupTopicLength {
+		errorResponse(w, http.StatusBadRequest, fmt.Sprintf("topic must be at most %d characters", maxGroupTopicLength))
+		return
+	}
+	var timer time.Duration
+	if req.EphemeralTimer != nil {
+		var ok bool
+		if timer, ok = disappearingTimers[*req.EphemeralTimer]; !ok {
+			errorResponse(w, http.StatusBadRequest, "ephemeral_timer must be 0, 86400, 604800 or 7776000")
+			return
+		}
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	group, err := types.ParseJID(req.GroupJID)
+	if err != nil || group.Server != types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "invalid group_jid")
+		return
+	}
+
+	ctx := context.Background()
+	updated := []string{}
+	apply := func(field string, set func() error) bool {
+		if err := set(); err != nil {
+			errorResponseWith(w, groupUpdateStatus(err), fmt.Sprintf("failed to set %s: %v", field, err), map[string]interface{}{
+				"updated": updated,
+			})
+			return false
+		}
+		updated = append(updated, field)
+		return true
+	}
+
+	if req.Name != nil && !apply("name", func() error {
+		return session.Client.SetGroupName(ctx, group, *req.Name)
+	}) {
+		return
+	}
+	if req.Topic != nil && !apply("topic", func() error {
+		return session.Client.SetGroupTopic(ctx, group, "", "", *req.Topic)
+	}) {
+		return
+	}
+	if req.Announce != nil && !apply("announce", func() error {
+		return session.Client.SetGroupAnnounce(ctx, group, *req.Announce)
+	}) {
+		return
+	}
+	if req.Locked != nil && !apply("locked", func() error {
+		return session.Client.SetGroupLocked(ctx, group, *req.Locked)
+	}) {
+		return
+	}
+	if req.EphemeralTimer != nil && !apply("ephemeral_timer", func() error {
+		return session.Client.SetDisappearingTimer(ctx, group, timer, time.Now())
+	}) {
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"updated": updated,
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestUpdateGroupHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+
+	w := httptest.NewRecorder()
+	updateGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/update", bytes.NewBufferString(
+		`{"user_id": 1, "group_jid": "`+group.String()+`", "name": "Book club", "topic": "", "announce": false, "ephemeral_timer": 604800}`)))
+	var resp struct {
+		Updated []string `json:"updated"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || fmt.Sprint(resp.Updated) != "[name topic announce ephemeral_timer]" {
+		t.Fatalf("expected the given settings to be updated, got %d: %s", w.Code, w.Body.String())
+	}
+	if calls := mock.GetCallsByMethod("SetGroupName"); len(calls) != 1 || calls[0].Args[2] != "Book club" {
+		t.Errorf("expected the name to be set, got %+v", calls)
+	}
+	if calls := mock.GetCallsByMethod("SetGroupAnnounce"); len(calls) != 1 || calls[0].Args[2].(bool) {
+		t.Errorf("expected announce to be turned off, got %+v", calls)
+	}
+	if calls := mock.GetCallsByMethod("SetDisappearingTimer"); len(calls) != 1 || calls[0].Args[2].(time.Duration) != whatsmeow.DisappearingTimer7Days {
+		t.Errorf("expected a 7 day timer, got %+v", calls)
+	}
+	if len(mock.GetCallsByMethod("SetGroupLocked")) != 0 {
+		t.Error("expected locked to be left alone")
+	}
+
+	mock.GroupUpdateError = fmt.Errorf("%w: not an admin", whatsmeow.ErrIQForbidden)
+	w = httptest.NewRecorder()
+	updateGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/update", bytes.NewBufferString(
+		`{"user_id": 1, "group_jid": "`+group.String()+`", "locked": true}`)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mock.GroupUpdateError = fmt.Errorf("failed to get old group info to update topic: %w", whatsmeow.ErrGroupNotFound)
+	w = httptest.NewRecorder()
+	updateGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/update", bytes.NewBufferString(
+		`{"user_id": 1, "group_jid": "`+group.String()+`", "topic": "Weekly sync"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a group that's gone, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUpdateGroupHandler_Validation(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"nothing to update", `{"user_id": 1, "group_jid": "120363000000000000@g.us"}`},
+		{"empty name", `{"user_id": 1, "group_jid": "120363000000000000@g.us", "name": ""}`},
+		{"unsupported timer", `{"user_id": 1, "group_jid": "120363000000000000@g.us", "ephemeral_timer": 3600}`},
+		{"not a group", `{"user_id": 1, "group_jid": "15551234567@s.whatsapp.net", "locked": true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			updateGroupHandler(w, httptest.NewRequest(http.MethodPost, "/groups/update", bytes.NewBufferString(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	for _, call := range mock.Calls {
+		if call.Method != "IsLoggedIn" {
+			t.Errorf("expected no changes for invalid requests, got %s", call.Method)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Conversation is what a history sync says about a chat besides its messages
+type Conversation struct {
+	JID           string `json:"jid"`
+	Name          string `json:"name,omitempty"`
+	UnreadCount   uint32 `json:"unread_count"`
+	LastMessageAt int64  `json:"last_message_at,omitempty"` // unix seconds
+}
+
+// HistorySyncPayload is emitted as a "history_sync" event once a batch of past
+// messages from the phone has been stored
+type HistorySyncPayload struct {
+	SyncType      string `json:"sync_type"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+}
+
+// SaveConversation records a chat's name, unread count and last activity
+func (st *MessageStore) SaveConversation(ctx context.Context, conv Conversation) error {
+	if st == nil {
+		return nil
+	}
+	_, err := st.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO conversations (chat_jid, name, unread_count, last_message_at) VALUES (?, ?, ?, ?)`,
+		conv.JID, conv.Name, conv.UnreadCount, conv.LastMessageAt)
+	return err
+}
+
+// Conversation returns what is known about a chat, or nil if it never came up in a history sync
+func (st *MessageStore) Conversation(ctx context.Context, chatJID string) (*Conversation, error) {
+	if st == nil {
+		return nil, nil
+	}
+	conv := Conversation{JID: chatJID}
+	err := st.db.QueryRowContext(ctx,
+		`SELECT name, unread_count, last_message_at FROM conversations WHERE chat_jid = ?`, chatJID).
+		Scan(&conv.Name, &conv.UnreadCount, &conv.LastMessageAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// SaveHistory stores past messages in one transaction. Messages that are already
+// stored are kept as they are, since the live copy may carry more than the synced one.
+func (st *MessageStore) SaveHistory(ctx context.Context, messages []MessagePayload) error {
+	if st == nil || len(messages) == 0 {
+		return nil
+	}
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT OR IGNORE INTO messages (chat_jid, id, timestamp, media_type, payload) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, msg := range messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, msg.ChatJID, msg.ID, msg.Timestamp, msg.MediaType, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Oldest returns a chat's earliest stored message, or nil if none is stored
+func (st *MessageStore) Oldest(ctx context.Context, chatJID string) (*MessagePayload, error) {
+	if st == nil {
+		return nil, nil
+	}
+	var data string
+	err := st.db.QueryRowContext(ctx,
+		`SELECT payload FROM messages WHERE chat_jid = ? AND media_type != 'system' ORDER BY timestamp, rowid LIMIT 1`, chatJID).
+		Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var msg MessagePayload
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// historyRequestWait is how long /chats/history-request waits for the phone to answer
+// before leaving the messages to arrive as a history_sync event
+var historyRequestWait = 20 * time.Second
+
+// HistoryRequests hands the answers to on-demand history requests to the requests
+// waiting for them. The zero value is ready to use.
+type HistoryRequests struct {
+	mu      sync.Mutex
+	waiting map[string][]chan []MessagePayload // by chat JID
+}
+
+// wait registers for the next on-demand sync of chatJID; done must be called once the
+// caller stops waiting
+func (h *HistoryRequests) wait(chatJID string) (ch <-chan []MessagePayload, done func()) {
+	c := make(chan []MessagePayload, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.waiting == nil {
+		h.waiting = make(map[string][]chan []MessagePayload)
+	}
+	h.waiting[chatJID] = append(h.waiting[chatJID], c)
+	return c, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, w := range h.waiting[chatJID] {
+			if w == c {
+				h.waiting[chatJID] = append(h.waiting[chatJID][:i], h.waiting[chatJID][i+1:]...)
+				break
+			}
+		}
+		if len(h.waiting[chatJID]) == 0 {
+			delete(h.waiting, chatJID)
+		}
+	}
+}
+
+// deliver passes the messages of an on-demand sync to everyone waiting on the chat
+func (h *HistoryRequests) deliver(chatJID string, messages []MessagePayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.waiting[chatJID] {
+		select {
+		case c <- messages:
+		default:
+		}
+	}
+}
+
+// historyMessagePayload converts a synced message the way live messages are, minus
+// downloading, answering or emitting it
+func (s *UserSession) historyMessagePayload(v *events.Message) (MessagePayload, bool) {
+	payload, ok := s.newMessagePayload(core.ParseMessage(v))
+	if ok && payload.MediaType == "poll" {
+		s.savePoll(payload.ChatJID, payload.ID, payload.PollOptions)
+	}
+	return payload, ok
+}
+
+// handleHistorySync stores the conversations and messages the phone sends after
+// pairing and on demand, so GET /chats/{jid}/messages can page back past what was
+// received live
+func (s *UserSession) handleHistorySync(v *events.HistorySync) {
+	ctx := context.Background()
+	keep := s.Retention.Get().Mode != RetentionNone
+	onDemand := v.Data.GetSyncType() == waHistorySync.HistorySync_ON_DEMAND
+	stored := HistorySyncPayload{SyncType: v.Data.GetSyncType().String()}
+
+	for _, conv := range v.Data.GetConversations() {
+		chat, err := types.ParseJID(conv.GetID())
+		if err != nil || !s.chatAllowed(chat) {
+			continue
+		}
+		name := conv.GetName()
+		if name == "" {
+			name = conv.GetDisplayName()
+		}
+		if err := s.Messages.SaveConversation(ctx, Conversation{
+			JID:           chat.String(),
+			Name:          name,
+			UnreadCount:   conv.GetUnreadCount(),
+			LastMessageAt: int64(conv.GetConversationTimestamp()),
+		}); err != nil {
+			log.Printf("[history] Failed to store conversation %s for user %d: %v", chat, s.UserID, err)
+		}
+		stored.Conversations++
+
+		messages := make([]MessagePayload, 0, len(conv.GetMessages()))
+		for _, hist := range conv.GetMessages() {
+			evt, err := s.Client.ParseWebMessage(chat, hist.GetMessage())
+			if err != nil || evt.Message == nil {
+				continue
+			}
+			if payload, ok := s.historyMessagePayload(evt); ok {
+				messages = append(messages, payload)
+			}
+		}
+		if onDemand {
+			s.History.deliver(chat.String(), messages)
+		}
+		if !keep && !s.Messages.OnHold(chat.String()) {
+			continue
+		}
+		if err := s.Messages.SaveHistory(ctx, messages); err != nil {
+			log.Printf("[history] Failed to store %d messages of %s for user %d: %v", len(messages), chat, s.UserID, err)
+			continue
+		}
+		stored.Messages += len(messages)
+		s.prewarmMedia(messages, time.Now())
+	}
+
+	log.Printf("[history] User %d: stored %d messages from %d conversations (%s)",
+		s.UserID, stored.Messages, stored.Conversations, stored.SyncType)
+	s.emit(MessageEvent{Type: "history_sync", Payload: stored})
+}
+
+// chatMessagesHandler serves GET /chats/{jid}/messages: a page of a chat's stored
+// messages, oldest first, with what the last history sync said about the chat
+func chatMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	limit, before, err := messagePage(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	jid, err := types.ParseJID(r.PathValue("jid"))
+	if err != nil || jid.IsEmpty() {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	if !session.chatAllowed(jid) {
+		chatNotAllowedResponse(w)
+		return
+	}
+
+	messages, err := session.Messages.List(r.Context(), jid.String(), before, limit)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load messages: "+err.Error())
+		return
+	}
+	conv, err := session.Messages.Conversation(r.Context(), jid.String())
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load chat: "+err.Error())
+		return
+	}
+
+	messages = session.TimeFormat.stamp(messages)
+	resp := map[string]interface{}{
+		"messages": messages,
+	}
+	if conv != nil {
+		resp["chat"] = conv
+	}
+	jsonResponse(w, resp)
+}
+
+// historyRequestHandler asks the phone for up to count messages older than the oldest
+// one stored for a chat, and answers with them once the phone responds. If it takes
+// longer than historyRequestWait, the request is answered with 202 and the messages
+// still arrive, stored and announced as a history_sync event.
+func historyRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID  int    `json:"user_id"`
+		ChatJID string `json:"chat_jid"`
+		Count   int    `json:"count,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Count < 0 {
+		errorResponse(w, http.StatusBadRequest, "invalid count")
+		return
+	}
+	count := defaultMessagePageSize
+	if req.Count > 0 {
+		count = min(req.Count, maxMessagePageSize)
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	own := session.Client.GetStore().GetID()
+	if own == nil {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	// The phone pages back from a message it knows, so start before the oldest one kept
+	oldest, err := session.Messages.Oldest(r.Context(), jid.String())
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load messages: "+err.Error())
+		return
+	}
+	if oldest == nil {
+		errorResponse(w, http.StatusBadRequest, "no stored messages in chat to request history before")
+		return
+	}
+	lastKnown := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: jid, IsFromMe: oldest.IsFromMe},
+		ID:            oldest.ID,
+		Timestamp:     time.Unix(oldest.Timestamp, 0),
+	}
+
+	answer, done := session.History.wait(jid.String())
+	defer done()
+	_, err = session.Client.SendMessage(context.Background(), own.ToNonAD(),
+		session.Client.BuildHistorySyncRequest(lastKnown, count), whatsmeow.SendRequestExtra{Peer: true})
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	timer := time.NewTimer(historyRequestWait)
+	defer timer.Stop()
+	select {
+	case messages := <-answer:
+		messages = session.TimeFormat.stamp(messages)
+		jsonResponse(w, map[string]interface{}{
+			"messages": messages,
+		})
+	case <-timer.C:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "requested",
+		})
+	case <-r.Context().Done():
+	}
+}
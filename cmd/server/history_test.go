@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func historyMsg(id string, ts uint64, fromMe bool, msg *waE2E.Message) *waHistorySync.HistorySyncMsg {
+	return &waHistorySync.HistorySyncMsg{Message: &waWeb.WebMessageInfo{
+		Key:              &waCommon.MessageKey{ID: proto.String(id), FromMe: proto.Bool(fromMe)},
+		MessageTimestamp: proto.Uint64(ts),
+		Message:          msg,
+	}}
+}
+
+func TestHandleHistorySync(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+	chat := "15557654321@s.whatsapp.net"
+
+	// A message already received live is kept as it was
+	session.Messages.Save(t.Context(), MessagePayload{ID: "M2", ChatJID: chat, Text: "live copy", Timestamp: 200})
+
+	session.handleEvent(&events.HistorySync{Data: &waHistorySync.HistorySync{
+		SyncType: waHistorySync.HistorySync_INITIAL_BOOTSTRAP.Enum(),
+		Conversations: []*waHistorySync.Conversation{{
+			ID:                    proto.String(chat),
+			Name:                  proto.String("Alice"),
+			UnreadCount:           proto.Uint32(2),
+			ConversationTimestamp: proto.Uint64(300),
+			Messages: []*waHistorySync.HistorySyncMsg{
+				historyMsg("M1", 100, false, &waE2E.Message{Conversation: proto.String("hello")}),
+				historyMsg("M2", 200, true, &waE2E.Message{Conversation: proto.String("synced copy")}),
+				historyMsg("M3", 300, false, &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+					Caption:    proto.String("look"),
+					DirectPath: proto.String("/v/img"),
+					MediaKey:   []byte("key"),
+				}}),
+				historyMsg("M4", 400, false, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{}}),
+			},
+		}},
+	}})
+
+	evt := <-session.EventChan
+	payload, ok := evt.Payload.(HistorySyncPayload)
+	if evt.Type != "history_sync" || !ok || payload.Conversations != 1 || payload.Messages != 3 {
+		t.Fatalf("expected a history_sync event for 3 messages, got %+v", evt)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/chats/"+chat+"/messages?user_id=1&before=300", nil)
+	req.SetPathValue("jid", chat)
+	chatMessagesHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Messages []MessagePayload `json:"messages"`
+		Chat     *Conversation    `json:"chat"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Messages) != 2 || resp.Messages[0].Text != "hello" || resp.Messages[1].Text != "live copy" {
+		t.Errorf("expected the two messages before 300 with the live copy kept, got %+v", resp.Messages)
+	}
+	if resp.Messages[0].SenderJID != chat {
+		t.Errorf("expected the DM's sender to be the chat, got %q", resp.Messages[0].SenderJID)
+	}
+	if resp.Chat == nil || resp.Chat.Name != "Alice" || resp.Chat.UnreadCount != 2 {
+		t.Errorf("expected the conversation details, got %+v", resp.Chat)
+	}
+
+	image, _ := session.Messages.Get(t.Context(), chat, "M3")
+	if image == nil || image.MediaType != "image" || image.Caption != "look" || image.DirectPath != "/v/img" {
+		t.Errorf("expected the image to be stored with its media keys, got %+v", image)
+	}
+}
+
+func TestHandleHistorySync_RetentionNone(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+	session.Retention.Set(RetentionPolicy{Mode: RetentionNone})
+	chat := "15557654321@s.whatsapp.net"
+
+	session.handleEvent(&events.HistorySync{Data: &waHistorySync.HistorySync{
+		Conversations: []*waHistorySync.Conversation{{
+			ID:       proto.String(chat),
+			Messages: []*waHistorySync.HistorySyncMsg{historyMsg("M1", 100, false, &waE2E.Message{Conversation: proto.String("hello")})},
+		}},
+	}})
+
+	if history, _ := session.Messages.List(t.Context(), chat, 0, 10); len(history) != 0 {
+		t.Errorf("expected nothing to be kept, got %+v", history)
+	}
+}
+
+func TestChatMessagesHandler_Validation(t *testing.T) {
+	manager = setupTestManager(t)
+	injectMockSession(manager, 1, NewLoggedInMockClient())
+
+	tests := []struct {
+		name  string
+		query string
+		jid   string
+		want  int
+	}{
+		{"missing user", "", "123@s.whatsapp.net", http.StatusBadRequest},
+		{"bad limit", "user_id=1&limit=x", "123@s.whatsapp.net", http.StatusBadRequest},
+		{"unknown session", "user_id=2", "123@s.whatsapp.net", http.StatusNotFound},
+		{"bad jid", "user_id=1", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/chats/x/messages?"+tt.query, nil)
+			req.SetPathValue("jid", tt.jid)
+			chatMessagesHandler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHistoryRequestHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	chat := "15557654321@s.whatsapp.net"
+	session.Messages.Save(t.Context(), MessagePayload{ID: "NEWER", ChatJID: chat, Text: "b", Timestamp: 600})
+	session.Messages.Save(t.Context(), MessagePayload{ID: "OLDEST", ChatJID: chat, Text: "a", Timestamp: 500, IsFromMe: true})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		historyRequestHandler(w, httptest.NewRequest(http.MethodPost, "/chats/history-request", bytes.NewBufferString(body)))
+		return w
+	}
+
+	t.Run("answers with the messages the phone sends", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- post(`{"user_id": 1, "chat_jid": "` + chat + `", "count": 20}`) }()
+
+		for deadline := time.Now().Add(time.Second); len(mock.GetCallsByMethod("SendMessage")) == 0; {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the history request to be sent")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		call := mock.GetCallsByMethod("SendMessage")[0]
+		if to := call.Args[1].(types.JID); to.User != "1234567890" {
+			t.Errorf("expected the request to go to the user's own phone, got %s", to)
+		}
+		if extra := call.Args[3].([]whatsmeow.SendRequestExtra); len(extra) != 1 || !extra[0].Peer {
+			t.Errorf("expected a peer message, got %+v", extra)
+		}
+		request := call.Args[2].(*waE2E.Message).GetProtocolMessage().GetPeerDataOperationRequestMessage().GetHistorySyncOnDemandRequest()
+		if request.GetOldestMsgID() != "OLDEST" || !request.GetOldestMsgFromMe() || request.GetOnDemandMsgCount() != 20 {
+			t.Errorf("expected a request for 20 messages before the oldest stored one, got %+v", request)
+		}
+
+		session.handleEvent(&events.HistorySync{Data: &waHistorySync.HistorySync{
+			SyncType: waHistorySync.HistorySync_ON_DEMAND.Enum(),
+			Conversations: []*waHistorySync.Conversation{{
+				ID:       proto.String(chat),
+				Messages: []*waHistorySync.HistorySyncMsg{historyMsg("OLDER", 400, false, &waE2E.Message{Conversation: proto.String("older")})},
+			}},
+		}})
+
+		w := <-done
+		var resp struct {
+			Messages []MessagePayload `json:"messages"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || len(resp.Messages) != 1 || resp.Messages[0].ID != "OLDER" {
+			t.Errorf("expected the older message, got %d: %s", w.Code, w.Body.String())
+		}
+		if msg, _ := session.Messages.Get(t.Context(), chat, "OLDER"); msg == nil {
+			t.Error("expected the older message to be stored")
+		}
+	})
+
+	t.Run("accepts when the phone is slow", func(t *testing.T) {
+		prev := historyRequestWait
+		historyRequestWait = 10 * time.Millisecond
+		t.Cleanup(func() { historyRequestWait = prev })
+
+		if w := post(`{"user_id": 1, "chat_jid": "` + chat + `"}`); w.Code != http.StatusAccepted {
+			t.Errorf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("needs a stored message to page back from", func(t *testing.T) {
+		if w := post(`{"user_id": 1, "chat_jid": "15550000000@s.whatsapp.net"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
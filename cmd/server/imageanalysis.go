@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	imageAnalysisTimeout = time.Minute
+	// imageAnalysisQueueWait is how long an image waits for a free analysis slot before
+	// it's skipped, so a backlog can't pile up downloaded images in memory
+	imageAnalysisQueueWait      = 30 * time.Second
+	defaultImageAnalysisWorkers = 2
+)
+
+// ImageAnalysis is what an analyzer found in an image
+type ImageAnalysis struct {
+	Text   string   `json:"text"`   // OCR text
+	Labels []string `json:"labels"` // e.g. "receipt", "screenshot"
+}
+
+// ImageAnalyzer extracts text and labels from an image
+type ImageAnalyzer interface {
+	Analyze(ctx context.Context, image []byte, mimeType string) (ImageAnalysis, error)
+}
+
+// ImageAnalysisQueue runs images through an analyzer, a bounded number at a time so
+// analyses can't starve media downloads
+type ImageAnalysisQueue struct {
+	analyzer ImageAnalyzer // nil turns analysis off
+	slots    chan struct{}
+}
+
+func NewImageAnalysisQueue(analyzer ImageAnalyzer, workers int) *ImageAnalysisQueue {
+	return &ImageAnalysisQueue{analyzer: analyzer, slots: make(chan struct{}, max(1, workers))}
+}
+
+// imageAnalysis is the queue sessions use unless they're given their own. Its analyzer
+// is nil unless IMAGE_ANALYZER_URL is set.
+var imageAnalysis = NewImageAnalysisQueue(imageAnalyzerFromEnv(),
+	concurrencyLimitFromEnv("IMAGE_ANALYZER_CONCURRENCY", defaultImageAnalysisWorkers))
+
+func imageAnalyzerFromEnv() ImageAnalyzer {
+	endpoint := os.Getenv("IMAGE_ANALYZER_URL")
+	if endpoint == "" {
+		return nil
+	}
+	log.Printf("Image analysis enabled via %s", endpoint)
+	return NewHTTPImageAnalyzer(endpoint, os.Getenv("IMAGE_ANALYZER_API_KEY"))
+}
+
+// HTTPImageAnalyzer posts the raw image to an endpoint that answers with
+// {"text": "...", "labels": ["..."]}
+type HTTPImageAnalyzer struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+func NewHTTPImageAnalyzer(url, apiKey string) *HTTPImageAnalyzer {
+	return &HTTPImageAnalyzer{
+		URL:    url,
+		APIKey: apiKey,
+		Client: &http.Client{Timeout: imageAnalysisTimeout},
+	}
+}
+
+func (a *HTTPImageAnalyzer) Analyze(ctx context.Context, image []byte, mimeType string) (ImageAnalysis, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(image))
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", mimeType)
+	if a.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.APIKey)
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ImageAnalysis{}, fmt.Errorf("image analyzer returned status %d", resp.StatusCode)
+	}
+
+	var result ImageAnalysis
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ImageAnalysis{}, fmt.Errorf("invalid image analyzer response: %w", err)
+	}
+	result.Text = strings.TrimSpace(result.Text)
+	return result, nil
+}
+
+// ImageAnalysisPayload is the payload of an "image_analysis" event, sent after the image
+// message it belongs to
+type ImageAnalysisPayload struct {
+	MessageID string   `json:"message_id"`
+	ChatJID   string   `json:"chat_jid"`
+	Text      string   `json:"text,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+}
+
+// analyzeImage runs a cached image through the analyzer and emits what it found. It's
+// called from the download goroutine, so it's fine for it to block.
+func (s *UserSession) analyzeImage(msgID, chatJID string, image []byte, mimeType string) {
+	queue := s.ImageAnalysis
+	if queue == nil {
+		queue = imageAnalysis
+	}
+	if queue.analyzer == nil {
+		return
+	}
+
+	select {
+	case queue.slots <- struct{}{}:
+		defer func() { <-queue.slots }()
+	case <-time.After(imageAnalysisQueueWait):
+		log.Printf("[image/analysis] Skipping %s: analyzer busy", msgID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageAnalysisTimeout)
+	defer cancel()
+	analysis, err := queue.analyzer.Analyze(ctx, image, mimeType)
+	if err != nil {
+		log.Printf("[image/analysis] %s failed: %v", msgID, err)
+		return
+	}
+	if analysis.Text == "" && len(analysis.Labels) == 0 {
+		return
+	}
+	s.emit(MessageEvent{Type: "image_analysis", Payload: ImageAnalysisPayload{
+		MessageID: msgID,
+		ChatJID:   chatJID,
+		Text:      analysis.Text,
+		Labels:    analysis.Labels,
+	}})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeImageAnalyzer struct {
+	analysis ImageAnalysis
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	release  chan struct{}
+}
+
+func (f *fakeImageAnalyzer) Analyze(ctx context.Context, image []byte, mimeType string) (ImageAnalysis, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	if f.release != nil {
+		<-f.release
+	}
+	return f.analysis, nil
+}
+
+func TestHTTPImageAnalyzer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "image/jpeg" || string(body) != "jpeg-bytes" {
+			t.Errorf("unexpected request %s %q", r.Header.Get("Content-Type"), body)
+		}
+		w.Write([]byte(`{"text": "TOTAL 12.50\n", "labels": ["receipt"]}`))
+	}))
+	defer srv.Close()
+
+	analysis, err := NewHTTPImageAnalyzer(srv.URL, "").Analyze(context.Background(), []byte("jpeg-bytes"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if analysis.Text != "TOTAL 12.50" || !slices.Equal(analysis.Labels, []string{"receipt"}) {
+		t.Errorf("unexpected analysis: %+v", analysis)
+	}
+}
+
+func TestUserSession_analyzeImage(t *testing.T) {
+	t.Run("emits analysis after caching", func(t *testing.T) {
+		analyzer := &fakeImageAnalyzer{analysis: ImageAnalysis{Text: "INVOICE 42", Labels: []string{"document"}}}
+		chat := types.NewJID("15551234567", types.DefaultUserServer)
+		mock := NewLoggedInMockClient()
+		mock.DownloadData = []byte("jpeg-bytes")
+		session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10), MediaCache: make(map[string][]byte),
+			ImageAnalysis: NewImageAnalysisQueue(analyzer, 1)}
+
+		session.handleEvent(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+				ID:            "IMG1",
+				Timestamp:     time.Unix(1700000000, 0),
+			},
+			Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Mimetype: proto.String("image/jpeg")}},
+		})
+
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case evt := <-session.EventChan:
+				if evt.Type != "image_analysis" {
+					continue
+				}
+				payload := evt.Payload.(ImageAnalysisPayload)
+				if payload.MessageID != "IMG1" || payload.ChatJID != chat.String() || payload.Text != "INVOICE 42" {
+					t.Errorf("unexpected analysis: %+v", payload)
+				}
+				return
+			case <-deadline:
+				t.Fatal("expected an image_analysis event")
+			}
+		}
+	})
+
+	t.Run("limits concurrent analyses", func(t *testing.T) {
+		fake := &fakeImageAnalyzer{analysis: ImageAnalysis{Labels: []string{"photo"}}, release: make(chan struct{})}
+		session := &UserSession{UserID: 1, EventChan: make(chan MessageEvent, 10), ImageAnalysis: NewImageAnalysisQueue(fake, 2)}
+
+		for i := 0; i < 5; i++ {
+			go session.analyzeImage("IMG", "chat", nil, "image/jpeg")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if n := fake.inFlight.Load(); n != 2 {
+			t.Errorf("expected 2 analyses in flight, got %d", n)
+		}
+		close(fake.release)
+
+		deadline := time.After(2 * time.Second)
+		for received := 0; received < 5; received++ {
+			select {
+			case <-session.EventChan:
+			case <-deadline:
+				t.Fatalf("expected 5 analysis events, got %d", received)
+			}
+		}
+		if peak := fake.peak.Load(); peak > 2 {
+			t.Errorf("expected at most 2 concurrent analyses, saw %d", peak)
+		}
+	})
+}
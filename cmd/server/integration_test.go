@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// The integration tests run the whole server, routes and middleware included, with
+// sessions whose WhatsApp side is scripted by the test: fakeWhatsApp stands in for
+// whatsmeow and the phone, and everything else is the production code path.
+
+// fakeWhatsApp is the mock client plus what a session needs over its lifetime: a QR
+// login the test drives, and events delivered to the session's handlers
+type fakeWhatsApp struct {
+	*MockWhatsAppClient
+	qr chan whatsmeow.QRChannelItem
+
+	mu       sync.Mutex
+	handlers []whatsmeow.EventHandler
+}
+
+func newFakeWhatsApp() *fakeWhatsApp {
+	return &fakeWhatsApp{MockWhatsAppClient: NewMockClient(), qr: make(chan whatsmeow.QRChannelItem, 10)}
+}
+
+func (f *fakeWhatsApp) GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
+	f.recordCall("GetQRChannel", ctx)
+	return f.qr, nil
+}
+
+func (f *fakeWhatsApp) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append(f.handlers, handler)
+	return uint32(len(f.handlers))
+}
+
+// SendMessage fails like whatsmeow does while the connection is down
+func (f *fakeWhatsApp) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if !f.IsConnected() {
+		return whatsmeow.SendResponse{}, whatsmeow.ErrNotConnected
+	}
+	return f.MockWhatsAppClient.SendMessage(ctx, to, message, extra...)
+}
+
+// dispatch delivers an event the way whatsmeow does, synchronously to every handler
+func (f *fakeWhatsApp) dispatch(evt interface{}) {
+	f.mu.Lock()
+	handlers := append([]whatsmeow.EventHandler(nil), f.handlers...)
+	f.mu.Unlock()
+	for _, handler := range handlers {
+		handler(evt)
+	}
+}
+
+// showQR makes the next QR code appear
+func (f *fakeWhatsApp) showQR(code string) {
+	f.qr <- whatsmeow.QRChannelItem{Event: whatsmeow.QRChannelEventCode, Code: code}
+}
+
+// pair is the phone scanning the code: whatsmeow stores the device, reports the pairing
+// and then ends the QR channel
+func (f *fakeWhatsApp) pair(device types.JID) {
+	f.SetDeviceID(&device)
+	f.SetLoggedIn(true)
+	f.dispatch(&events.PairSuccess{ID: device, Platform: "android"})
+	f.qr <- whatsmeow.QRChannelSuccess
+}
+
+// drop and reconnect are the websocket going away and whatsmeow's auto-reconnect
+func (f *fakeWhatsApp) drop() {
+	f.SetConnected(false)
+	f.dispatch(&events.Disconnected{})
+}
+
+func (f *fakeWhatsApp) reconnect() {
+	f.SetConnected(true)
+	f.dispatch(&events.Connected{})
+}
+
+// receive is a message arriving from a contact
+func (f *fakeWhatsApp) receive(from types.JID, id string, msg *waE2E.Message) {
+	f.dispatch(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: from, Sender: from},
+			ID:            id,
+			PushName:      "Alice",
+			Timestamp:     time.Now(),
+		},
+		Message: msg,
+	})
+}
+
+// integrationServer is the API on a local port, with a fakeWhatsApp per session
+type integrationServer struct {
+	t   *testing.T
+	url string
+
+	mu     sync.Mutex
+	phones map[int]*fakeWhatsApp
+}
+
+func newIntegrationServer(t *testing.T) *integrationServer {
+	t.Helper()
+	srv := &integrationServer{t: t, phones: make(map[int]*fakeWhatsApp)}
+
+	manager = setupTestManager(t)
+	manager.newClient = func(userID int) (WhatsAppClient, error) {
+		phone := newFakeWhatsApp()
+		srv.mu.Lock()
+		srv.phones[userID] = phone
+		srv.mu.Unlock()
+		return phone, nil
+	}
+	prevUpload, prevDownload := uploadLimiter, downloadLimiter
+	uploadLimiter = newConcurrencyLimiter("media upload", defaultMediaUploadConcurrency)
+	downloadLimiter = newConcurrencyLimiter("media download", defaultMediaDownloadConcurrency)
+	t.Cleanup(func() { uploadLimiter, downloadLimiter = prevUpload, prevDownload })
+
+	server := httptest.NewServer(newRouter(5*time.Second, 5*time.Second, 10*time.Second))
+	t.Cleanup(server.Close)
+	srv.url = server.URL
+	return srv
+}
+
+// call sends a request with a JSON body (or none) and decodes the JSON answer
+func (s *integrationServer) call(method, path string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, s.url+path, reader)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+// sseEvent is one server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// stream opens an SSE endpoint and returns its events as they arrive. The request runs
+// in the background, since the server may send nothing, not even headers, until the
+// first event.
+func (s *integrationServer) stream(path string) <-chan sseEvent {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.url+path, nil)
+
+	out := make(chan sseEvent, 100)
+	go func() {
+		defer close(out)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var evt sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				evt.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				evt.Data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				out <- evt
+				evt = sseEvent{}
+			}
+		}
+	}()
+	return out
+}
+
+func nextSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case evt, ok := <-events:
+		if !ok {
+			t.Fatal("event stream ended")
+		}
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+// nextEvent returns the next API event of the given type from an /events stream
+func nextEvent(t *testing.T, events <-chan sseEvent, eventType string) map[string]interface{} {
+	t.Helper()
+	for {
+		var evt struct {
+			Type    string                 `json:"type"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		json.Unmarshal([]byte(nextSSE(t, events).Data), &evt)
+		if evt.Type == eventType {
+			return evt.Payload
+		}
+	}
+}
+
+// login links a new session through the QR flow, as a user scanning the code would
+func (s *integrationServer) login(userID int, device types.JID) *fakeWhatsApp {
+	s.t.Helper()
+	qr := s.stream("/sessions/qr?user_id=" + strconv.Itoa(userID))
+	var phone *fakeWhatsApp
+	for deadline := time.Now().Add(2 * time.Second); phone == nil; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected /sessions/qr to open a session for user %d", userID)
+		}
+		s.mu.Lock()
+		phone = s.phones[userID]
+		s.mu.Unlock()
+	}
+
+	phone.showQR("2@QRCODE")
+	if evt := nextSSE(s.t, qr); evt.Event != "qr" || evt.Data != "2@QRCODE" {
+		s.t.Fatalf("expected the QR code, got %+v", evt)
+	}
+	phone.pair(device)
+	if evt := nextSSE(s.t, qr); evt.Event != "success" {
+		s.t.Fatalf("expected the login to succeed, got %+v", evt)
+	}
+	return phone
+}
+
+func TestIntegration_LoginSendReceive(t *testing.T) {
+	srv := newIntegrationServer(t)
+	device := types.JID{User: "15551234567", Device: 3, Server: types.DefaultUserServer}
+	alice := types.NewJID("15557654321", types.DefaultUserServer)
+
+	if status, body := srv.call(http.MethodGet, "/sessions/status?user_id=1", nil); status != http.StatusOK || body["logged_in"] != false {
+		t.Fatalf("expected no session yet, got %d %v", status, body)
+	}
+
+	phone := srv.login(1, device)
+
+	status, body := srv.call(http.MethodGet, "/sessions/status?user_id=1", nil)
+	if status != http.StatusOK || body["logged_in"] != true || body["connected"] != true || body["phone"] != "15551234567" {
+		t.Fatalf("expected a linked session, got %d %v", status, body)
+	}
+
+	events := srv.stream("/events?user_id=1")
+	if paired := nextEvent(t, events, "paired"); paired["phone"] != "15551234567" || paired["platform"] != "android" {
+		t.Errorf("expected a paired event, got %v", paired)
+	}
+
+	status, body = srv.call(http.MethodPost, "/messages/send", map[string]interface{}{
+		"user_id": 1, "chat_jid": alice.String(), "text": "Hello!",
+	})
+	if status != http.StatusOK || body["id"] == nil {
+		t.Fatalf("expected the message to be sent, got %d %v", status, body)
+	}
+	sent := phone.GetCallsByMethod("SendMessage")
+	if len(sent) != 1 || sent[0].Args[2].(*waE2E.Message).GetConversation() != "Hello!" {
+		t.Fatalf("expected one text message to reach WhatsApp, got %+v", sent)
+	}
+
+	phone.receive(alice, "IN1", &waE2E.Message{Conversation: proto.String("Hi back")})
+	msg := nextEvent(t, events, "message")
+	if msg["id"] != "IN1" || msg["text"] != "Hi back" || msg["sender_name"] != "Alice" {
+		t.Errorf("expected the incoming message, got %v", msg)
+	}
+
+	var history struct {
+		Messages []MessagePayload `json:"messages"`
+	}
+	resp, err := http.Get(srv.url + "/chats/" + alice.String() + "/messages?user_id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&history)
+	resp.Body.Close()
+	if n := len(history.Messages); n == 0 || history.Messages[n-1].ID != "IN1" {
+		t.Errorf("expected the incoming message to be stored, got %+v", history.Messages)
+	}
+}
+
+func TestIntegration_Media(t *testing.T) {
+	srv := newIntegrationServer(t)
+	phone := srv.login(1, types.JID{User: "15551234567", Device: 3, Server: types.DefaultUserServer})
+	alice := types.NewJID("15557654321", types.DefaultUserServer)
+	events := srv.stream("/events?user_id=1")
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2)))
+
+	status, body := srv.call(http.MethodPost, "/messages/image", map[string]interface{}{
+		"user_id": 1, "chat_jid": alice.String(), "caption": "a square",
+		"image_b64": base64.StdEncoding.EncodeToString(img.Bytes()),
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected the image to be sent, got %d %v", status, body)
+	}
+	uploads := phone.GetCallsByMethod("UploadReader")
+	if len(uploads) != 1 || !bytes.Equal(uploads[0].Args[1].([]byte), img.Bytes()) {
+		t.Fatalf("expected the image to be uploaded as is, got %d uploads", len(uploads))
+	}
+	sent := phone.GetCallsByMethod("SendMessage")
+	if len(sent) != 1 || sent[0].Args[2].(*waE2E.Message).GetImageMessage().GetCaption() != "a square" {
+		t.Fatalf("expected an image message with its caption, got %+v", sent)
+	}
+
+	phone.DownloadData = img.Bytes()
+	phone.receive(alice, "IMG1", &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+		Mimetype:      proto.String("image/png"),
+		DirectPath:    proto.String("/v/t62/img"),
+		MediaKey:      []byte("key"),
+		FileEncSHA256: []byte("enc"),
+		FileSHA256:    []byte("sha"),
+		FileLength:    proto.Uint64(uint64(img.Len())),
+	}})
+	msg := nextEvent(t, events, "message")
+	if msg["media_type"] != "image" || msg["direct_path"] != "/v/t62/img" {
+		t.Fatalf("expected an image message, got %v", msg)
+	}
+
+	status, body = srv.call(http.MethodPost, "/media/download", map[string]interface{}{
+		"user_id": 1, "message_id": "IMG1", "direct_path": "/v/t62/img", "mime_type": "image/png",
+		"media_key": []byte("key"), "file_enc_sha256": []byte("enc"), "file_sha256": []byte("sha"),
+	})
+	if status != http.StatusOK || body["data"] != base64.StdEncoding.EncodeToString(img.Bytes()) {
+		t.Errorf("expected the image back, got %d %v", status, body)
+	}
+}
+
+func TestIntegration_Reconnect(t *testing.T) {
+	srv := newIntegrationServer(t)
+	phone := srv.login(1, types.JID{User: "15551234567", Device: 3, Server: types.DefaultUserServer})
+	send := map[string]interface{}{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "ping"}
+
+	phone.drop()
+	status, body := srv.call(http.MethodPost, "/messages/send", send)
+	if status != http.StatusServiceUnavailable || body["code"] != "not_connected" || body["retry_safe"] != true {
+		t.Fatalf("expected a retryable not_connected error, got %d %v", status, body)
+	}
+	if _, body := srv.call(http.MethodGet, "/sessions/status?user_id=1", nil); body["connected"] != false {
+		t.Errorf("expected the session to show as disconnected, got %v", body)
+	}
+
+	phone.reconnect()
+	if status, body := srv.call(http.MethodPost, "/messages/send", send); status != http.StatusOK {
+		t.Fatalf("expected sending to work again, got %d %v", status, body)
+	}
+
+	_, body = srv.call(http.MethodGet, "/sessions/status?user_id=1&detail=true", nil)
+	history, _ := body["connection_history"].([]interface{})
+	var states []string
+	for _, entry := range history {
+		states = append(states, entry.(map[string]interface{})["state"].(string))
+	}
+	joined := strings.Join(states, ",")
+	if !strings.Contains(joined, ConnStateDisconnected+","+ConnStateConnected) {
+		t.Errorf("expected the drop and reconnect in the connection history, got %v", states)
+	}
+}
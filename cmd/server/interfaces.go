@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"time"
 
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
 )
 
 // WhatsAppClient abstracts the whatsmeow.Client for testing
@@ -16,16 +22,40 @@ type WhatsAppClient interface {
 	IsLoggedIn() bool
 	Connect() error
 	Disconnect()
+	// ResetConnection drops the websocket and lets the client reconnect automatically
+	ResetConnection()
+	// Logout unlinks the device from the phone and deletes it from the store
+	Logout(ctx context.Context) error
 
 	// QR login
 	GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error)
+	// PairPhone asks for a code to link by entering it on the phone instead of scanning
+	// a QR code; the QR login must be connected
+	PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error)
 
 	// Messaging
 	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
 	SendChatPresence(ctx context.Context, jid types.JID, presence types.ChatPresence, media types.ChatPresenceMedia) error
+	// SendPresence shows the user as online or offline
+	SendPresence(ctx context.Context, state types.Presence) error
+	// SubscribePresence asks for a contact's online/last seen updates, delivered as *events.Presence
+	SubscribePresence(ctx context.Context, jid types.JID) error
+	// MarkRead sends read receipts for messages in chat; sender is required in groups
+	MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+	// BuildRevoke builds a delete-for-everyone; sender is empty for the user's own messages
+	BuildRevoke(chat, sender types.JID, id types.MessageID) *waE2E.Message
+	// DecryptPollVote decrypts a PollUpdateMessage into the hashes of the selected options
+	DecryptPollVote(ctx context.Context, vote *events.Message) (*waE2E.PollVoteMessage, error)
+	// BuildHistorySyncRequest asks the phone for count messages before lastKnown; it's
+	// sent as a peer message and answered with an ON_DEMAND *events.HistorySync
+	BuildHistorySyncRequest(lastKnown *types.MessageInfo, count int) *waE2E.Message
+	// ParseWebMessage turns a message from a history sync into a message event
+	ParseWebMessage(chatJID types.JID, webMsg *waWeb.WebMessageInfo) (*events.Message, error)
 
 	// Media
 	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	// UploadReader encrypts and uploads from a stream; tempFile may be nil to use a fresh temp file
+	UploadReader(ctx context.Context, plaintext io.Reader, tempFile io.ReadWriteSeeker, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
 	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
 	DownloadMediaWithPath(ctx context.Context, directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType whatsmeow.MediaType, mmsType string) ([]byte, error)
 	// DownloadAndDecrypt downloads from URL directly without modifying parameters (for mms3 URLs)
@@ -34,6 +64,39 @@ type WhatsAppClient interface {
 	// Groups
 	GetJoinedGroups(ctx context.Context) ([]*types.GroupInfo, error)
 	GetGroupInfo(ctx context.Context, jid types.JID) (*types.GroupInfo, error)
+	// UpdateGroupParticipants adds, removes, promotes or demotes members; each returned
+	// participant carries the error code if the change was refused for them
+	UpdateGroupParticipants(ctx context.Context, jid types.JID, changes []types.JID, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error)
+	// GetGroupInviteLink returns the group's invite link, replacing it with a new one if reset
+	GetGroupInviteLink(ctx context.Context, jid types.JID, reset bool) (string, error)
+	GetGroupInfoFromLink(ctx context.Context, code string) (*types.GroupInfo, error)
+	JoinGroupWithLink(ctx context.Context, code string) (types.JID, error)
+	SetGroupName(ctx context.Context, jid types.JID, name string) error
+	// SetGroupTopic replaces the description; empty IDs are filled in by whatsmeow
+	SetGroupTopic(ctx context.Context, jid types.JID, previousID, newID, topic string) error
+	SetGroupAnnounce(ctx context.Context, jid types.JID, announce bool) error
+	SetGroupLocked(ctx context.Context, jid types.JID, locked bool) error
+	// SetDisappearingTimer works for any chat; for groups it changes the setting for everyone
+	SetDisappearingTimer(ctx context.Context, chat types.JID, timer time.Duration, settingTS time.Time) error
+	// SetGroupPhoto sets a JPEG as the group's photo, or removes it if nil; returns the new picture ID
+	SetGroupPhoto(ctx context.Context, jid types.JID, avatar []byte) (string, error)
+
+	// Profiles
+	GetProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error)
+	// SetProfilePhoto sets a JPEG as the account's own picture, or removes it if nil; returns the new picture ID
+	SetProfilePhoto(ctx context.Context, avatar []byte) (string, error)
+	// SetStatusMessage sets the account's about text
+	SetStatusMessage(ctx context.Context, msg string) error
+	// IsOnWhatsApp looks up phone numbers given as "+<digits>"
+	IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error)
+	GetBlocklist(ctx context.Context) (*types.Blocklist, error)
+	// UpdateBlocklist blocks or unblocks a contact and returns the new list
+	UpdateBlocklist(ctx context.Context, jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error)
+
+	// Business catalogs
+	// GetBusinessCatalog returns up to limit products of a business, from the cursor after
+	GetBusinessCatalog(ctx context.Context, jid types.JID, limit int, after string) (*BusinessCatalog, error)
+	GetBusinessProduct(ctx context.Context, jid types.JID, productID string) (*BusinessProduct, error)
 
 	// Store access
 	GetStore() DeviceStore
@@ -43,12 +106,22 @@ type WhatsAppClient interface {
 
 	// Media retry - request phone to re-upload media
 	SendMediaRetryReceipt(ctx context.Context, message *types.MessageInfo, mediaKey []byte) error
+
+	// App state - chat mute/archive/pin changes synced to the user's other devices
+	SendAppState(ctx context.Context, patch appstate.PatchInfo) error
 }
 
 // DeviceStore abstracts access to device/store information
 type DeviceStore interface {
 	GetID() *types.JID
+	GetLID() types.JID // EmptyJID until the server has assigned one
+	// GetAltJID maps a phone number JID to its LID or a LID to its phone number, returning
+	// EmptyJID if the mapping isn't known
+	GetAltJID(ctx context.Context, jid types.JID) (types.JID, error)
 	GetContacts() ContactStore
+	GetChatSettings() ChatSettingsStore
+	// Delete removes the device record, leaving the store unpaired
+	Delete(ctx context.Context) error
 }
 
 // ContactStore abstracts access to contacts
@@ -56,7 +129,13 @@ type ContactStore interface {
 	GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error)
 }
 
-// realClientWrapper wraps the real whatsmeow.Client to implement WhatsAppClient
+// ChatSettingsStore abstracts access to the mute/pin/archive state synced from the phone
+type ChatSettingsStore interface {
+	GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error)
+}
+
+// realClientWrapper wraps the real whatsmeow.Client to implement WhatsAppClient.
+// Send and media failures are counted in the protocol metrics.
 type realClientWrapper struct {
 	client *whatsmeow.Client
 }
@@ -81,18 +160,60 @@ func (w *realClientWrapper) Disconnect() {
 	w.client.Disconnect()
 }
 
+func (w *realClientWrapper) ResetConnection() {
+	w.client.ResetConnection()
+}
+
+func (w *realClientWrapper) Logout(ctx context.Context) error {
+	return w.client.Logout(ctx)
+}
+
 func (w *realClientWrapper) GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
 	return w.client.GetQRChannel(ctx)
 }
 
+func (w *realClientWrapper) PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error) {
+	return w.client.PairPhone(ctx, phone, showPushNotification, clientType, clientDisplayName)
+}
+
 func (w *realClientWrapper) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
-	return w.client.SendMessage(ctx, to, message, extra...)
+	resp, err := w.client.SendMessage(ctx, to, message, extra...)
+	recordSendError(err)
+	return resp, err
 }
 
 func (w *realClientWrapper) SendChatPresence(ctx context.Context, jid types.JID, presence types.ChatPresence, media types.ChatPresenceMedia) error {
 	return w.client.SendChatPresence(ctx, jid, presence, media)
 }
 
+func (w *realClientWrapper) SendPresence(ctx context.Context, state types.Presence) error {
+	return w.client.SendPresence(ctx, state)
+}
+
+func (w *realClientWrapper) SubscribePresence(ctx context.Context, jid types.JID) error {
+	return w.client.SubscribePresence(ctx, jid)
+}
+
+func (w *realClientWrapper) MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	return w.client.MarkRead(ctx, ids, timestamp, chat, sender, receiptTypeExtra...)
+}
+
+func (w *realClientWrapper) BuildRevoke(chat, sender types.JID, id types.MessageID) *waE2E.Message {
+	return w.client.BuildRevoke(chat, sender, id)
+}
+
+func (w *realClientWrapper) DecryptPollVote(ctx context.Context, vote *events.Message) (*waE2E.PollVoteMessage, error) {
+	return w.client.DecryptPollVote(ctx, vote)
+}
+
+func (w *realClientWrapper) BuildHistorySyncRequest(lastKnown *types.MessageInfo, count int) *waE2E.Message {
+	return w.client.BuildHistorySyncRequest(lastKnown, count)
+}
+
+func (w *realClientWrapper) ParseWebMessage(chatJID types.JID, webMsg *waWeb.WebMessageInfo) (*events.Message, error) {
+	return w.client.ParseWebMessage(chatJID, webMsg)
+}
+
 func (w *realClientWrapper) GetJoinedGroups(ctx context.Context) ([]*types.GroupInfo, error) {
 	return w.client.GetJoinedGroups(ctx)
 }
@@ -101,20 +222,124 @@ func (w *realClientWrapper) GetGroupInfo(ctx context.Context, jid types.JID) (*t
 	return w.client.GetGroupInfo(ctx, jid)
 }
 
+func (w *realClientWrapper) UpdateGroupParticipants(ctx context.Context, jid types.JID, changes []types.JID, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error) {
+	return w.client.UpdateGroupParticipants(ctx, jid, changes, action)
+}
+
+func (w *realClientWrapper) GetGroupInviteLink(ctx context.Context, jid types.JID, reset bool) (string, error) {
+	return w.client.GetGroupInviteLink(ctx, jid, reset)
+}
+
+func (w *realClientWrapper) GetGroupInfoFromLink(ctx context.Context, code string) (*types.GroupInfo, error) {
+	return w.client.GetGroupInfoFromLink(ctx, code)
+}
+
+func (w *realClientWrapper) JoinGroupWithLink(ctx context.Context, code string) (types.JID, error) {
+	return w.client.JoinGroupWithLink(ctx, code)
+}
+
+func (w *realClientWrapper) SetGroupName(ctx context.Context, jid types.JID, name string) error {
+	return w.client.SetGroupName(ctx, jid, name)
+}
+
+func (w *realClientWrapper) SetGroupTopic(ctx context.Context, jid types.JID, previousID, newID, topic string) error {
+	if previousID == "" {
+		// whatsmeow looks this up itself but drops the cause of a failure, which tells
+		// a group we're not in apart from one that's gone
+		info, err := w.client.GetGroupInfo(ctx, jid)
+		if err != nil {
+			return fmt.Errorf("failed to get old group info to update topic: %w", err)
+		}
+		previousID = info.TopicID
+	}
+	return w.client.SetGroupTopic(ctx, jid, previousID, newID, topic)
+}
+
+func (w *realClientWrapper) SetGroupAnnounce(ctx context.Context, jid types.JID, announce bool) error {
+	return w.client.SetGroupAnnounce(ctx, jid, announce)
+}
+
+func (w *realClientWrapper) SetGroupLocked(ctx context.Context, jid types.JID, locked bool) error {
+	return w.client.SetGroupLocked(ctx, jid, locked)
+}
+
+func (w *realClientWrapper) SetDisappearingTimer(ctx context.Context, chat types.JID, timer time.Duration, settingTS time.Time) error {
+	return w.client.SetDisappearingTimer(ctx, chat, timer, settingTS)
+}
+
+func (w *realClientWrapper) SetGroupPhoto(ctx context.Context, jid types.JID, avatar []byte) (string, error) {
+	return w.client.SetGroupPhoto(ctx, jid, avatar)
+}
+
+func (w *realClientWrapper) GetProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
+	return w.client.GetProfilePictureInfo(ctx, jid, params)
+}
+
+func (w *realClientWrapper) SetProfilePhoto(ctx context.Context, avatar []byte) (string, error) {
+	// The same query as for groups, without a target
+	return w.client.SetGroupPhoto(ctx, types.EmptyJID, avatar)
+}
+
+func (w *realClientWrapper) SetStatusMessage(ctx context.Context, msg string) error {
+	return w.client.SetStatusMessage(ctx, msg)
+}
+
+func (w *realClientWrapper) IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error) {
+	return w.client.IsOnWhatsApp(ctx, phones)
+}
+
+func (w *realClientWrapper) GetBlocklist(ctx context.Context) (*types.Blocklist, error) {
+	return w.client.GetBlocklist(ctx)
+}
+
+func (w *realClientWrapper) UpdateBlocklist(ctx context.Context, jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
+	return w.client.UpdateBlocklist(ctx, jid, action)
+}
+
+func (w *realClientWrapper) GetBusinessCatalog(ctx context.Context, jid types.JID, limit int, after string) (*BusinessCatalog, error) {
+	resp, err := queryCatalog(ctx, w.client, catalogQuery(jid, limit, after))
+	if err != nil {
+		return nil, err
+	}
+	return parseCatalog(resp)
+}
+
+func (w *realClientWrapper) GetBusinessProduct(ctx context.Context, jid types.JID, productID string) (*BusinessProduct, error) {
+	resp, err := queryCatalog(ctx, w.client, productQuery(jid, productID))
+	if err != nil {
+		return nil, err
+	}
+	return parseProductResponse(resp)
+}
+
 func (w *realClientWrapper) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
-	return w.client.Upload(ctx, plaintext, appInfo)
+	resp, err := w.client.Upload(ctx, plaintext, appInfo)
+	recordMediaError("upload", err)
+	return resp, err
+}
+
+func (w *realClientWrapper) UploadReader(ctx context.Context, plaintext io.Reader, tempFile io.ReadWriteSeeker, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	resp, err := w.client.UploadReader(ctx, plaintext, tempFile, appInfo)
+	recordMediaError("upload", err)
+	return resp, err
 }
 
 func (w *realClientWrapper) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
-	return w.client.Download(ctx, msg)
+	data, err := w.client.Download(ctx, msg)
+	recordMediaError("download", err)
+	return data, err
 }
 
 func (w *realClientWrapper) DownloadMediaWithPath(ctx context.Context, directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType whatsmeow.MediaType, mmsType string) ([]byte, error) {
-	return w.client.DownloadMediaWithPath(ctx, directPath, encFileHash, fileHash, mediaKey, fileLength, mediaType, mmsType)
+	data, err := w.client.DownloadMediaWithPath(ctx, directPath, encFileHash, fileHash, mediaKey, fileLength, mediaType, mmsType)
+	recordMediaError("download", err)
+	return data, err
 }
 
 func (w *realClientWrapper) DownloadAndDecrypt(ctx context.Context, url string, mediaKey []byte, appInfo whatsmeow.MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte) ([]byte, error) {
-	return w.client.DangerousInternals().DownloadAndDecrypt(ctx, url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256)
+	data, err := w.client.DangerousInternals().DownloadAndDecrypt(ctx, url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256)
+	recordMediaError("download", err)
+	return data, err
 }
 
 func (w *realClientWrapper) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
@@ -125,6 +350,10 @@ func (w *realClientWrapper) SendMediaRetryReceipt(ctx context.Context, message *
 	return w.client.SendMediaRetryReceipt(ctx, message, mediaKey)
 }
 
+func (w *realClientWrapper) SendAppState(ctx context.Context, patch appstate.PatchInfo) error {
+	return w.client.SendAppState(ctx, patch)
+}
+
 func (w *realClientWrapper) GetStore() DeviceStore {
 	return &realDeviceStoreWrapper{w.client.Store}
 }
@@ -138,6 +367,22 @@ func (w *realDeviceStoreWrapper) GetID() *types.JID {
 	return w.store.ID
 }
 
+func (w *realDeviceStoreWrapper) GetLID() types.JID {
+	return w.store.GetLID()
+}
+
+func (w *realDeviceStoreWrapper) GetAltJID(ctx context.Context, jid types.JID) (types.JID, error) {
+	return w.store.GetAltJID(ctx, jid)
+}
+
 func (w *realDeviceStoreWrapper) GetContacts() ContactStore {
 	return w.store.Contacts
 }
+
+func (w *realDeviceStoreWrapper) GetChatSettings() ChatSettingsStore {
+	return w.store.ChatSettings
+}
+
+func (w *realDeviceStoreWrapper) Delete(ctx context.Context) error {
+	return w.store.Delete(ctx)
+}
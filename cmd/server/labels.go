@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Label is a WhatsApp Business label, synced from the phone through app state
+type Label struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color int32  `json:"color"` // index into WhatsApp's label palette
+	// Chats with the label
+	ChatJIDs []string `json:"chat_jids"`
+}
+
+// SaveLabel creates or renames a label
+func (st *MessageStore) SaveLabel(ctx context.Context, id, name string, color int32) error {
+	if st == nil {
+		return nil
+	}
+	_, err := st.db.ExecContext(ctx, `INSERT OR REPLACE INTO labels (id, name, color) VALUES (?, ?, ?)`, id, name, color)
+	return err
+}
+
+// DeleteLabel drops a label and takes it off every chat and message
+func (st *MessageStore) DeleteLabel(ctx context.Context, id string) error {
+	if st == nil {
+		return nil
+	}
+	for _, query := range []string{
+		`DELETE FROM labels WHERE id = ?`,
+		`DELETE FROM label_chats WHERE label_id = ?`,
+		`DELETE FROM label_messages WHERE label_id = ?`,
+	} {
+		if _, err := st.db.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Labels lists the labels with the chats they're on, by ID
+func (st *MessageStore) Labels(ctx context.Context) ([]Label, error) {
+	labels := []Label{}
+	if st == nil {
+		return labels, nil
+	}
+	rows, err := st.db.QueryContext(ctx, `SELECT id, name, color FROM labels ORDER BY CAST(id AS INTEGER), id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := make(map[string]int)
+	for rows.Next() {
+		label := Label{ChatJIDs: []string{}}
+		if err := rows.Scan(&label.ID, &label.Name, &label.Color); err != nil {
+			return nil, err
+		}
+		byID[label.ID] = len(labels)
+		labels = append(labels, label)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chats, err := st.db.QueryContext(ctx, `SELECT label_id, chat_jid FROM label_chats ORDER BY chat_jid`)
+	if err != nil {
+		return nil, err
+	}
+	defer chats.Close()
+	for chats.Next() {
+		var labelID, chatJID string
+		if err := chats.Scan(&labelID, &chatJID); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[labelID]; ok {
+			labels[i].ChatJIDs = append(labels[i].ChatJIDs, chatJID)
+		}
+	}
+	return labels, chats.Err()
+}
+
+// HasLabel reports whether a label with this ID exists
+func (st *MessageStore) HasLabel(ctx context.Context, id string) (bool, error) {
+	if st == nil {
+		return false, nil
+	}
+	var found int
+	err := st.db.QueryRowContext(ctx, `SELECT 1 FROM labels WHERE id = ?`, id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetChatLabel puts a label on a chat, or takes it off
+func (st *MessageStore) SetChatLabel(ctx context.Context, chatJID, labelID string, labeled bool) error {
+	if st == nil {
+		return nil
+	}
+	query := `DELETE FROM label_chats WHERE label_id = ? AND chat_jid = ?`
+	if labeled {
+		query = `INSERT OR IGNORE INTO label_chats (label_id, chat_jid) VALUES (?, ?)`
+	}
+	_, err := st.db.ExecContext(ctx, query, labelID, chatJID)
+	return err
+}
+
+// SetMessageLabel puts a label on a message, or takes it off. The message needn't be
+// stored yet; the label shows once it is.
+func (st *MessageStore) SetMessageLabel(ctx context.Context, chatJID, messageID, labelID string, labeled bool) error {
+	if st == nil {
+		return nil
+	}
+	query := `DELETE FROM label_messages WHERE label_id = ? AND chat_jid = ? AND message_id = ?`
+	if labeled {
+		query = `INSERT OR IGNORE INTO label_messages (label_id, chat_jid, message_id) VALUES (?, ?, ?)`
+	}
+	_, err := st.db.ExecContext(ctx, query, labelID, chatJID, messageID)
+	return err
+}
+
+// ChatLabels returns the IDs of the labels on a chat
+func (st *MessageStore) ChatLabels(ctx context.Context, chatJID string) ([]string, error) {
+	if st == nil {
+		return nil, nil
+	}
+	rows, err := st.db.QueryContext(ctx, `SELECT label_id FROM label_chats WHERE chat_jid = ? ORDER BY CAST(label_id AS INTEGER)`, chatJID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// attachLabels sets LabelIDs of messages read back from a chat to their current labels
+func (st *MessageStore) attachLabels(ctx context.Context, chatJID string, messages []MessagePayload) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	rows, err := st.db.QueryContext(ctx,
+		`SELECT message_id, label_id FROM label_messages WHERE chat_jid = ? ORDER BY CAST(label_id AS INTEGER)`, chatJID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	labels := make(map[string][]string)
+	for rows.Next() {
+		var messageID, labelID string
+		if err := rows.Scan(&messageID, &labelID); err != nil {
+			return err
+		}
+		labels[messageID] = append(labels[messageID], labelID)
+	}
+	for i := range messages {
+		messages[i].LabelIDs = labels[messages[i].ID]
+	}
+	return rows.Err()
+}
+
+// trackLabels keeps the stored labels current from app state sync
+func (s *UserSession) trackLabels(evt interface{}) {
+	ctx := context.Background()
+	var err error
+	switch v := evt.(type) {
+	case *events.LabelEdit:
+		if v.Action.GetDeleted() {
+			err = s.Messages.DeleteLabel(ctx, v.LabelID)
+		} else {
+			err = s.Messages.SaveLabel(ctx, v.LabelID, v.Action.GetName(), v.Action.GetColor())
+		}
+	case *events.LabelAssociationChat:
+		err = s.Messages.SetChatLabel(ctx, v.JID.String(), v.LabelID, v.Action.GetLabeled())
+	case *events.LabelAssociationMessage:
+		err = s.Messages.SetMessageLabel(ctx, v.JID.String(), v.MessageID, v.LabelID, v.Action.GetLabeled())
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("[labels] Failed to store label change for user %d: %v", s.UserID, err)
+	}
+}
+
+// flagChatLabels marks a message with the labels of its chat
+func (s *UserSession) flagChatLabels(payload *MessagePayload, chat types.JID) {
+	labels, err := s.Messages.ChatLabels(context.Background(), chat.String())
+	if err != nil {
+		log.Printf("[labels] Failed to get labels of %s for user %d: %v", chat, s.UserID, err)
+		return
+	}
+	payload.ChatLabelIDs = labels
+}
+
+// labelsHandler lists the account's labels and the chats they're on. Only WhatsApp
+// Business accounts have labels.
+func labelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	labels, err := session.Messages.Labels(r.Context())
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to list labels: "+err.Error())
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"labels": labels})
+}
+
+// assignLabelHandler puts a label on a chat, or with message_id on a message, or takes
+// it off with "labeled": false. The change syncs to the phone.
+func assignLabelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID    int    `json:"user_id"`
+		ChatJID   string `json:"chat_jid"`
+		MessageID string `json:"message_id,omitempty"`
+		LabelID   string `json:"label_id"`
+		Labeled   *bool  `json:"labeled,omitempty"` // defaults to true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.LabelID == "" {
+		errorResponse(w, http.StatusBadRequest, "label_id required")
+		return
+	}
+	labeled := req.Labeled == nil || *req.Labeled
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	ctx := r.Context()
+	if known, err := session.Messages.HasLabel(ctx, req.LabelID); err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to look up label: "+err.Error())
+		return
+	} else if !known {
+		errorResponse(w, http.StatusNotFound, "unknown label")
+		return
+	}
+
+	patch := appstate.BuildLabelChat(jid, req.LabelID, labeled)
+	if req.MessageID != "" {
+		patch = appstate.BuildLabelMessage(jid, req.LabelID, req.MessageID, labeled)
+	}
+	if err := session.Client.SendAppState(ctx, patch); err != nil {
+		errorResponse(w, http.StatusBadGateway, "failed to sync label: "+err.Error())
+		return
+	}
+
+	// The phone echoes the change back through app state, but don't wait for it
+	if req.MessageID != "" {
+		err = session.Messages.SetMessageLabel(ctx, jid.String(), req.MessageID, req.LabelID, labeled)
+	} else {
+		err = session.Messages.SetChatLabel(ctx, jid.String(), req.LabelID, labeled)
+	}
+	if err != nil {
+		log.Printf("[labels] Failed to store label change for user %d: %v", session.UserID, err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"chat_jid":   jid.String(),
+		"message_id": req.MessageID,
+		"label_id":   req.LabelID,
+		"labeled":    labeled,
+	})
+}
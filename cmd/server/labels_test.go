@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waSyncAction"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTrackLabels(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	ctx := context.Background()
+	chat := types.NewJID("15557654321", types.DefaultUserServer)
+
+	session.handleEvent(&events.LabelEdit{LabelID: "1", Action: &waSyncAction.LabelEditAction{Name: proto.String("New customer"), Color: proto.Int32(2)}})
+	session.handleEvent(&events.LabelEdit{LabelID: "5", Action: &waSyncAction.LabelEditAction{Name: proto.String("Paid"), Color: proto.Int32(7)}})
+	session.handleEvent(&events.LabelAssociationChat{JID: chat, LabelID: "1", Action: &waSyncAction.LabelAssociationAction{Labeled: proto.Bool(true)}})
+	session.handleEvent(&events.LabelAssociationMessage{JID: chat, MessageID: "m1", LabelID: "5", Action: &waSyncAction.LabelAssociationAction{Labeled: proto.Bool(true)}})
+
+	labels, err := session.Messages.Labels(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 2 || labels[0].Name != "New customer" || labels[0].Color != 2 || len(labels[0].ChatJIDs) != 1 || labels[0].ChatJIDs[0] != chat.String() {
+		t.Fatalf("expected both labels with the chat on the first, got %+v", labels)
+	}
+
+	// New messages carry the chat's labels, stored ones their own
+	session.handleEvent(incomingText(chat, "m1", "I'd like to order"))
+	evt := <-session.EventChan
+	if payload := evt.Payload.(MessagePayload); len(payload.ChatLabelIDs) != 1 || payload.ChatLabelIDs[0] != "1" {
+		t.Errorf("expected the chat's label on the message, got %v", payload.ChatLabelIDs)
+	}
+	if stored, _ := session.Messages.Get(ctx, chat.String(), "m1"); stored == nil || len(stored.LabelIDs) != 1 || stored.LabelIDs[0] != "5" {
+		t.Errorf("expected the message's own label when read back, got %+v", stored)
+	}
+
+	// Deleting a label takes it off everything
+	session.handleEvent(&events.LabelEdit{LabelID: "5", Action: &waSyncAction.LabelEditAction{Deleted: proto.Bool(true)}})
+	if messages, _ := session.Messages.List(ctx, chat.String(), 0, 10); len(messages) != 1 || messages[0].LabelIDs != nil {
+		t.Errorf("expected the deleted label to be gone, got %+v", messages)
+	}
+}
+
+func TestLabelHandlers(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	session.Messages.SaveLabel(context.Background(), "3", "Follow up", 4)
+
+	assign := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		assignLabelHandler(w, httptest.NewRequest(http.MethodPost, "/labels/assign", bytes.NewBufferString(body)))
+		return w
+	}
+	if w := assign(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "label_id": "3"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := assign(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "message_id": "m1", "label_id": "3", "labeled": false}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	calls := mock.GetCallsByMethod("SendAppState")
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 app state patches, got %d", len(calls))
+	}
+	if index := calls[0].Args[1].(appstate.PatchInfo).Mutations[0].Index; index[0] != appstate.IndexLabelAssociationChat || index[1] != "3" {
+		t.Errorf("expected a chat label patch, got %v", index)
+	}
+	if mutation := calls[1].Args[1].(appstate.PatchInfo).Mutations[0]; mutation.Index[0] != appstate.IndexLabelAssociationMessage || mutation.Value.GetLabelAssociationAction().GetLabeled() {
+		t.Errorf("expected a message unlabel patch, got %v", mutation.Index)
+	}
+
+	if w := assign(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "label_id": "99"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown label, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	labelsHandler(w, httptest.NewRequest(http.MethodGet, "/labels?user_id=1", nil))
+	var resp struct {
+		Labels []Label `json:"labels"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.Labels) != 1 || len(resp.Labels[0].ChatJIDs) != 1 {
+		t.Errorf("expected the label on the chat, got %d: %s", w.Code, w.Body.String())
+	}
+}
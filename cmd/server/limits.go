@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Default number of in-flight requests per endpoint class. Media requests hold whole
+// files (plus their base64 encoding) in memory, so they get tight limits.
+const (
+	defaultMediaUploadConcurrency   = 8
+	defaultMediaDownloadConcurrency = 16
+)
+
+// concurrencyLimiter caps the number of requests a group of handlers serves at once.
+// Requests beyond the limit are rejected immediately rather than queued, so a burst of
+// large uploads can't pile up and exhaust memory.
+type concurrencyLimiter struct {
+	name     string
+	base     int // limit from the environment, used when the config file sets none
+	mu       sync.Mutex
+	limit    int // <= 0 means unlimited
+	inFlight int
+}
+
+// Limiters for the media endpoints, set up in main
+var uploadLimiter, downloadLimiter *concurrencyLimiter
+
+// newConcurrencyLimiter returns a limiter for the named endpoint class; limit <= 0 means unlimited
+func newConcurrencyLimiter(name string, limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{name: name, base: limit, limit: limit}
+}
+
+// override replaces the limit with one from the config file, or restores the
+// environment's limit if limit is nil. Requests already in flight keep their slots.
+func (l *concurrencyLimiter) override(limit *int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = l.base
+	if limit != nil {
+		l.limit = *limit
+	}
+}
+
+func (l *concurrencyLimiter) acquire() (inFlight int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit > 0 && l.inFlight >= l.limit {
+		return l.inFlight, false
+	}
+	l.inFlight++
+	return l.inFlight, true
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+}
+
+// concurrencyLimitFromEnv reads a limit from the environment, falling back to def
+func concurrencyLimitFromEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d", key, value, def)
+		return def
+	}
+	return limit
+}
+
+// wrap returns a handler that responds 503 with Retry-After when the limiter is saturated.
+// A nil limiter, as before main sets them up, doesn't limit.
+func (l *concurrencyLimiter) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlight, ok := l.acquire()
+		if !ok {
+			log.Printf("[limits] %s saturated (%d in flight), rejecting %s", l.name, inFlight, r.URL.Path)
+			w.Header().Set("Retry-After", "1")
+			errorResponse(w, http.StatusServiceUnavailable, l.name+" capacity exhausted, retry later")
+			return
+		}
+		defer l.release()
+		next(w, r)
+	}
+}
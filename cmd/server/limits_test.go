@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Run("rejects requests beyond the limit", func(t *testing.T) {
+		l := newConcurrencyLimiter("media upload", 1)
+		entered := make(chan struct{}, 1)
+		release := make(chan struct{})
+		handler := l.wrap(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+			jsonResponse(w, map[string]string{"status": "ok"})
+		})
+
+		done := make(chan int)
+		go func() {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/messages/image", nil))
+			done <- w.Code
+		}()
+		<-entered
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/messages/image", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("expected Retry-After header")
+		}
+
+		close(release)
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected first request to succeed, got %d", code)
+		}
+
+		// The slot is free again once the first request completes
+		w = httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/messages/image", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("expected 200 after slot freed, got %d", w.Code)
+		}
+	})
+
+	t.Run("zero limit is unlimited", func(t *testing.T) {
+		l := newConcurrencyLimiter("media download", 0)
+		called := false
+		l.wrap(func(w http.ResponseWriter, r *http.Request) { called = true })(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		if !called {
+			t.Error("expected handler to be called")
+		}
+	})
+
+	t.Run("reads limit from env", func(t *testing.T) {
+		t.Setenv("MEDIA_UPLOAD_CONCURRENCY", "3")
+		if got := concurrencyLimitFromEnv("MEDIA_UPLOAD_CONCURRENCY", 8); got != 3 {
+			t.Errorf("expected 3, got %d", got)
+		}
+		t.Setenv("MEDIA_UPLOAD_CONCURRENCY", "lots")
+		if got := concurrencyLimitFromEnv("MEDIA_UPLOAD_CONCURRENCY", 8); got != 8 {
+			t.Errorf("expected default 8, got %d", got)
+		}
+	})
+}
+
+func TestPhotoUploadsAreLimited(t *testing.T) {
+	prev := uploadLimiter
+	uploadLimiter = newConcurrencyLimiter("media upload", 1)
+	t.Cleanup(func() { uploadLimiter = prev })
+	if _, ok := uploadLimiter.acquire(); !ok {
+		t.Fatal("expected to take the only slot")
+	}
+	defer uploadLimiter.release()
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/groups/photo":  groupPhotoHandler,
+		"/profile/photo": newRouter(time.Second, time.Second, time.Second).ServeHTTP,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected 503 while uploads are saturated, got %d", path, w.Code)
+		}
+	}
+}
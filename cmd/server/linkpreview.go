@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif" // decoders for og:image thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	linkPreviewTimeout = 5 * time.Second
+	// Only the head of a page is needed for its meta tags
+	maxLinkPreviewPage  = 512 << 10
+	maxLinkPreviewImage = 2 << 20
+	// Longest side of the JPEG thumbnail, about what the phone sends
+	linkPreviewThumbnailSize = 300
+	maxLinkPreviewTitle      = 200
+	maxLinkPreviewDesc       = 300
+	// Images are decoded in full before scaling; a small file can claim huge dimensions
+	maxLinkPreviewPixels = 25_000_000
+)
+
+var errPrivateAddress = errors.New("refusing to fetch a link preview from a private address")
+
+// linkPreviewClient fetches pages for previews. It won't connect to loopback, private
+// or link-local addresses, so a link in a message can't make the server probe its own
+// network.
+var linkPreviewClient = &http.Client{
+	Timeout: linkPreviewTimeout,
+	Transport: &http.Transport{
+		// No proxy: the address check below must see the site's address, not the proxy's
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: linkPreviewTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+					ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+var (
+	linkPattern      = regexp.MustCompile(`https?://[^\s<>"]+`)
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	titleTagPattern  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// firstLink returns the first http(s) URL in text, without punctuation that ends the
+// sentence around it
+func firstLink(text string) string {
+	return strings.TrimRight(linkPattern.FindString(text), ".,;:!?)]}'")
+}
+
+// LinkPreview is what a page says about itself in its meta tags
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	Thumbnail   []byte // JPEG, if the page has an image that could be fetched
+}
+
+// parseLinkPreview reads the Open Graph tags of a page, falling back to its <title>
+// and description. Relative image URLs are resolved against base.
+func parseLinkPreview(base *url.URL, page string) LinkPreview {
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		name := strings.ToLower(attrs["property"])
+		if name == "" {
+			name = strings.ToLower(attrs["name"])
+		}
+		if _, seen := meta[name]; name != "" && !seen {
+			meta[name] = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+		}
+	}
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	preview := LinkPreview{
+		URL:         base.String(),
+		Title:       first(meta["og:title"], meta["twitter:title"]),
+		Description: first(meta["og:description"], meta["twitter:description"], meta["description"]),
+	}
+	if preview.Title == "" {
+		if m := titleTagPattern.FindStringSubmatch(page); m != nil {
+			preview.Title = strings.Join(strings.Fields(html.UnescapeString(m[1])), " ")
+		}
+	}
+	if image := first(meta["og:image"], meta["og:image:url"], meta["twitter:image"]); image != "" {
+		if ref, err := base.Parse(image); err == nil && (ref.Scheme == "http" || ref.Scheme == "https") {
+			preview.ImageURL = ref.String()
+		}
+	}
+	preview.Title = truncateRunes(preview.Title, maxLinkPreviewTitle)
+	preview.Description = truncateRunes(preview.Description, maxLinkPreviewDesc)
+	return preview
+}
+
+func truncateRunes(s string, limit int) string {
+	if runes := []rune(s); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+	return s
+}
+
+// fetchLinkPreview loads a page and its preview image. A page without a title isn't
+// worth a card and is an error.
+func fetchLinkPreview(ctx context.Context, link string) (*LinkPreview, error) {
+	base, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	body, contentType, err := fetchForPreview(ctx, link, maxLinkPreviewPage)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("not a web page: %s", contentType)
+	}
+	preview := parseLinkPreview(base, string(body))
+	preview.URL = link // as it appears in the text
+	if preview.Title == "" {
+		return nil, errors.New("page has no title")
+	}
+	if preview.ImageURL != "" {
+		if data, _, err := fetchForPreview(ctx, preview.ImageURL, maxLinkPreviewImage); err == nil {
+			preview.Thumbnail, _ = previewThumbnail(data)
+		}
+	}
+	return &preview, nil
+}
+
+// fetchForPreview GETs a URL, reading at most limit bytes of the body
+func fetchForPreview(ctx context.Context, link string, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	// Many sites only serve their meta tags to clients that look like link unfurlers
+	req.Header.Set("User-Agent", "WhatsApp/2.23 (link preview)")
+	resp, err := linkPreviewClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: %s", link, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	return data, resp.Header.Get("Content-Type"), err
+}
+
+// previewThumbnail scales an image down to a small JPEG for the preview card
+func previewThumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxLinkPreviewPixels {
+		return nil, fmt.Errorf("image of %dx%d is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, errors.New("empty image")
+	}
+	scale := float64(linkPreviewThumbnailSize) / float64(max(w, h))
+	if scale > 1 {
+		scale = 1
+	}
+	tw, th := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*w/tw, b.Min.Y+y*h/th))
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apply fills in the preview card of an outgoing text
+func (p *LinkPreview) apply(msg *waE2E.ExtendedTextMessage) {
+	msg.MatchedText = proto.String(p.URL)
+	msg.Title = proto.String(p.Title)
+	msg.Description = proto.String(p.Description)
+	msg.PreviewType = waE2E.ExtendedTextMessage_NONE.Enum()
+	if len(p.Thumbnail) > 0 {
+		msg.JPEGThumbnail = p.Thumbnail
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+func TestFirstLink(t *testing.T) {
+	for text, want := range map[string]string{
+		"see https://example.com/a?b=1.":         "https://example.com/a?b=1",
+		"(http://example.com/x) and https://y.z": "http://example.com/x",
+		"no links here":                          "",
+	} {
+		if got := firstLink(text); got != want {
+			t.Errorf("%q: expected %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestParseLinkPreview(t *testing.T) {
+	base, _ := url.Parse("https://example.com/post/1")
+	page := `<html><head><title>Fallback</title>
+		<meta content="A &amp; B" property="og:title">
+		<meta name='description' content='The description'>
+		<meta property="og:image" content="/img/cover.png">
+		</head></html>`
+	p := parseLinkPreview(base, page)
+	if p.Title != "A & B" || p.Description != "The description" || p.ImageURL != "https://example.com/img/cover.png" {
+		t.Errorf("unexpected preview %+v", p)
+	}
+	if p := parseLinkPreview(base, `<title>
+		Only a   title</title>`); p.Title != "Only a title" {
+		t.Errorf("expected the <title> fallback, got %q", p.Title)
+	}
+}
+
+func TestSendMessageHandler_LinkPreview(t *testing.T) {
+	var cover bytes.Buffer
+	png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 1200, 600)))
+	var fetched atomic.Int32
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<meta property="og:title" content="Big news"><meta property="og:description" content="It happened"><meta property="og:image" content="/cover.png">`))
+		case "/cover.png":
+			w.Write(cover.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	// The test server is on loopback, which the real client refuses
+	if _, err := fetchLinkPreview(context.Background(), site.URL+"/article"); !errors.Is(err, errPrivateAddress) {
+		t.Errorf("expected loopback to be refused, got %v", err)
+	}
+	prev := linkPreviewClient
+	linkPreviewClient = site.Client()
+	t.Cleanup(func() { linkPreviewClient = prev })
+
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(body)))
+		return w
+	}
+	send := func(body string) *waE2E.Message {
+		w := post(body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		calls := mock.GetCallsByMethod("SendMessage")
+		return calls[len(calls)-1].Args[2].(*waE2E.Message)
+	}
+
+	link := site.URL + "/article"
+	ext := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "read ` + link + `!", "link_preview": true}`).GetExtendedTextMessage()
+	if ext.GetMatchedText() != link || ext.GetTitle() != "Big news" || ext.GetDescription() != "It happened" {
+		t.Errorf("expected the preview card, got %v", ext)
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(ext.GetJPEGThumbnail())); err != nil || format != "jpeg" || cfg.Width != 300 || cfg.Height != 150 {
+		t.Errorf("expected a 300x150 JPEG thumbnail, got %s %+v %v", format, cfg, err)
+	}
+
+	// Without the flag, or when the page can't be read, the text goes out plain
+	if msg := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "read ` + link + `"}`); msg.GetConversation() == "" {
+		t.Errorf("expected a plain text without link_preview, got %v", msg)
+	}
+	if msg := send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "` + site.URL + `/gone", "link_preview": true}`); msg.GetConversation() == "" {
+		t.Errorf("expected a plain text when the page is missing, got %v", msg)
+	}
+
+	// Sends refused anyway don't fetch the page
+	prevWindow := duplicateWindow
+	duplicateWindow = time.Minute
+	t.Cleanup(func() { duplicateWindow = prevWindow })
+	send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "again ` + link + `"}`)
+	fetched.Store(0)
+	if w := post(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "again ` + link + `", "link_preview": true}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate, got %d: %s", w.Code, w.Body.String())
+	}
+	session.ChatAccess.Set(chatAccessConfig{Deny: []string{"15550000000@s.whatsapp.net"}})
+	if w := post(`{"user_id": 1, "chat_jid": "15550000000@s.whatsapp.net", "text": "read ` + link + `", "link_preview": true}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a denied chat, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := fetched.Load(); n != 0 {
+		t.Errorf("expected refused sends not to fetch the link, got %d requests", n)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestLoad is the load generator: it links many sessions on the integration server,
+// hits them all with a burst of incoming messages, then downloads media through them
+// in parallel, and fails if any event or download is lost. With -load.targets it also
+// fails if latency or throughput misses the targets below; those depend on the machine,
+// so they're for runs on known hardware rather than CI. It only runs when asked for:
+//
+//	go test ./cmd/server -run TestLoad -load -load.targets -load.sessions 50
+var (
+	loadRun       = flag.Bool("load", false, "run TestLoad")
+	loadTargets   = flag.Bool("load.targets", false, "fail TestLoad when it misses a latency or throughput target")
+	loadSessions  = flag.Int("load.sessions", 20, "sessions to link")
+	loadBurst     = flag.Int("load.burst", 200, "messages each session receives at once")
+	loadDownloads = flag.Int("load.downloads", 200, "media downloads, spread over the sessions")
+	loadMediaSize = flag.Int("load.media-size", 1<<20, "size of each downloaded file in bytes")
+	// A burst outruns any queue; spill is the policy that loses nothing on the way
+	loadOverflow = flag.String("load.overflow", string(overflowSpill), "EVENT_OVERFLOW policy")
+)
+
+// The targets hold with the defaults above on a single core, with about half to spare;
+// CONTRIBUTING.md explains what each one guards
+const (
+	loadTargetEventP99    = time.Second // from WhatsApp's event to the /events consumer
+	loadTargetEventRate   = 2000        // events per second, over all sessions
+	loadTargetDownloadP99 = 1500 * time.Millisecond
+)
+
+// latencies collects timings from concurrent workers
+type latencies struct {
+	mu sync.Mutex
+	d  []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.d = append(l.d, d)
+	l.mu.Unlock()
+}
+
+// percentile returns the p-th percentile (0-100) of the timings
+func (l *latencies) percentile(p float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.d) == 0 {
+		return 0
+	}
+	sort.Slice(l.d, func(i, j int) bool { return l.d[i] < l.d[j] })
+	return l.d[min(len(l.d)-1, int(float64(len(l.d))*p/100))]
+}
+
+func TestLoad(t *testing.T) {
+	if !*loadRun {
+		t.Skip("load test; run with -load")
+	}
+	quietLogs(t)
+	withEventQueue(t, eventQueueConfig{Size: defaultEventBufferSize, Overflow: overflowPolicy(*loadOverflow), BlockTimeout: defaultEventBlockTimeout})
+
+	srv := newIntegrationServer(t)
+	phones := make([]*fakeWhatsApp, *loadSessions)
+	streams := make([]<-chan sseEvent, *loadSessions)
+	for i := range phones {
+		userID := i + 1
+		phones[i] = srv.login(userID, types.JID{User: fmt.Sprintf("1555%07d", userID), Device: 3, Server: types.DefaultUserServer})
+		streams[i] = srv.stream("/events?user_id=" + strconv.Itoa(userID))
+	}
+	t.Logf("linked %d sessions", len(phones))
+
+	t.Run("message burst", func(t *testing.T) {
+		// Each message carries the time it was received from WhatsApp, so the consumer
+		// can tell how long it took to come through
+		alice := types.NewJID("15557654321", types.DefaultUserServer)
+		var delivery latencies
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := range phones {
+			wg.Add(2)
+			go func(phone *fakeWhatsApp) {
+				defer wg.Done()
+				for j := 0; j < *loadBurst; j++ {
+					sent := strconv.FormatInt(time.Now().UnixNano(), 10)
+					phone.receive(alice, fmt.Sprintf("LOAD%d", j), &waE2E.Message{Conversation: proto.String(sent)})
+				}
+			}(phones[i])
+			go func(userID int, events <-chan sseEvent) {
+				defer wg.Done()
+				timeout := time.After(30 * time.Second)
+				for received := 0; received < *loadBurst; {
+					select {
+					case evt, ok := <-events:
+						if !ok {
+							t.Errorf("user %d: event stream ended after %d messages", userID, received)
+							return
+						}
+						var parsed struct {
+							Type    string         `json:"type"`
+							Payload MessagePayload `json:"payload"`
+						}
+						json.Unmarshal([]byte(evt.Data), &parsed)
+						if parsed.Type != "message" {
+							continue
+						}
+						sent, _ := strconv.ParseInt(parsed.Payload.Text, 10, 64)
+						delivery.add(time.Since(time.Unix(0, sent)))
+						received++
+					case <-timeout:
+						t.Errorf("user %d: timed out after %d of %d messages", userID, received, *loadBurst)
+						return
+					}
+				}
+			}(i+1, streams[i])
+		}
+		wg.Wait()
+		elapsed := time.Since(start)
+
+		total := len(phones) * *loadBurst
+		rate := float64(total) / elapsed.Seconds()
+		p50, p99 := delivery.percentile(50), delivery.percentile(99)
+		t.Logf("%d messages in %v: %.0f/s, delivery p50 %v, p99 %v", total, elapsed.Round(time.Millisecond), rate, p50, p99)
+		if !*loadTargets {
+			return
+		}
+		if p99 > loadTargetEventP99 {
+			t.Errorf("delivery p99 %v is over the target of %v", p99, loadTargetEventP99)
+		}
+		if rate < loadTargetEventRate {
+			t.Errorf("%.0f events/s is under the target of %d", rate, loadTargetEventRate)
+		}
+	})
+
+	t.Run("media downloads", func(t *testing.T) {
+		media := bytes.Repeat([]byte{0xAB}, *loadMediaSize)
+		for _, phone := range phones {
+			phone.DownloadData = media
+		}
+
+		// As many workers as the server lets through at once; any more are turned away
+		jobs := make(chan int)
+		var timings latencies
+		var wg sync.WaitGroup
+		start := time.Now()
+		for w := 0; w < defaultMediaDownloadConcurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := range jobs {
+					body, _ := json.Marshal(map[string]interface{}{
+						"user_id": n%len(phones) + 1, "direct_path": "/v/t62/load", "mime_type": "image/jpeg",
+					})
+					began := time.Now()
+					resp, err := http.Post(srv.url+"/media/download", "application/json", bytes.NewReader(body))
+					if err != nil {
+						t.Errorf("download %d: %v", n, err)
+						continue
+					}
+					var decoded struct {
+						Size int `json:"size"`
+					}
+					json.NewDecoder(resp.Body).Decode(&decoded)
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK || decoded.Size != len(media) {
+						t.Errorf("download %d: expected %d bytes, got %d with status %d", n, len(media), decoded.Size, resp.StatusCode)
+						continue
+					}
+					timings.add(time.Since(began))
+				}
+			}()
+		}
+		for n := 0; n < *loadDownloads; n++ {
+			jobs <- n
+		}
+		close(jobs)
+		wg.Wait()
+		elapsed := time.Since(start)
+
+		p50, p99 := timings.percentile(50), timings.percentile(99)
+		mb := float64(*loadDownloads**loadMediaSize) / (1 << 20)
+		t.Logf("%d downloads of %d bytes in %v: %.0f MiB/s, p50 %v, p99 %v",
+			*loadDownloads, *loadMediaSize, elapsed.Round(time.Millisecond), mb/elapsed.Seconds(), p50, p99)
+		if *loadTargets && p99 > loadTargetDownloadP99 {
+			t.Errorf("download p99 %v is over the target of %v", p99, loadTargetDownloadP99)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+var errLogoutSessionMissing = errors.New("session not found")
+
+// Logout unlinks a user's device from their phone and wipes it: the device record,
+// the local device database, message history, per-session settings and jo_bot's backup
+// are deleted so nothing of the session is left behind. If WhatsApp can't be
+// told (e.g. while offline) the session is left alone, unless force is set, in which
+// case it's wiped anyway and stays listed under Linked devices on the phone until
+// removed there.
+func (m *SessionManager) Logout(ctx context.Context, userID int, force bool) error {
+	session := m.GetSession(userID)
+	if session == nil {
+		return errLogoutSessionMissing
+	}
+
+	store := session.Client.GetStore()
+	if store.GetID() != nil {
+		if err := session.Client.Logout(ctx); err != nil {
+			if !force {
+				return fmt.Errorf("failed to unlink device: %w", err)
+			}
+			log.Printf("Failed to unlink device for user %d, wiping it anyway: %v", userID, err)
+			session.Client.Disconnect()
+			if err := store.Delete(ctx); err != nil {
+				return fmt.Errorf("failed to delete device: %w", err)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	session.stop()
+	session.Client.Disconnect()
+	session.Messages.Close()
+	if session.Container != nil {
+		session.Container.Close()
+	}
+	delete(m.sessions, userID)
+	if err := m.storage.Drop(ctx, userID); err != nil {
+		log.Printf("Failed to delete the %s device database for user %d: %v", m.storage.Name(), userID, err)
+	}
+	for _, path := range m.sessionDataFiles(userID) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete %s for user %d: %v", path, userID, err)
+		}
+	}
+	os.Remove(m.syncStatePath(userID))
+	m.mu.Unlock()
+
+	log.Printf("User %d logged out", userID)
+	if err := m.deleteSessionFromJoBot(userID); err != nil {
+		log.Printf("Warning: failed to delete jo_bot backup for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// logoutSessionHandler unlinks and wipes a session. Unlike DELETE /sessions, which only
+// disconnects, the device disappears from the phone's Linked devices.
+func logoutSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int  `json:"user_id"`
+		Force  bool `json:"force"` // wipe the session even if WhatsApp can't be reached
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.UserID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	if err := manager.Logout(r.Context(), req.UserID, req.Force); err != nil {
+		if errors.Is(err, errLogoutSessionMissing) {
+			errorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		errorResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	jsonResponse(w, map[string]string{"status": "logged_out"})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogoutSessionHandler(t *testing.T) {
+	deleted := make(chan string, 1)
+	joBot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted <- r.URL.Query().Get("user_id")
+		}
+	}))
+	defer joBot.Close()
+
+	manager = NewSessionManager(t.TempDir(), joBot.URL, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 7, mock)
+	dbPath := manager.storage.Path(7)
+	os.WriteFile(dbPath, []byte("device"), 0600)
+	os.WriteFile(dbPath+"-wal", []byte("wal"), 0600)
+	dataFiles := []string{manager.sessionDataFiles(7)[0], filepath.Join(manager.dataDir, "webhook_7.json")}
+	for _, path := range dataFiles {
+		os.WriteFile(path, []byte("{}"), 0600)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		logoutSessionHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/logout", bytes.NewBufferString(body)))
+		return w
+	}
+
+	// An unreachable WhatsApp leaves the session alone unless forced
+	mock.LogoutError = errors.New("websocket not connected")
+	if w := post(`{"user_id": 7}`); w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 when the unlink fails, got %d", w.Code)
+	}
+	if manager.GetSession(7) == nil || mock.GetStore().GetID() == nil {
+		t.Fatal("expected the session to survive a failed logout")
+	}
+
+	mock.LogoutError = nil
+	if w := post(`{"user_id": 7}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if manager.GetSession(7) != nil {
+		t.Error("expected the session to be removed")
+	}
+	if mock.GetStore().GetID() != nil {
+		t.Error("expected the device to be deleted")
+	}
+	for _, path := range append([]string{dbPath, dbPath + "-wal"}, dataFiles...) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	select {
+	case userID := <-deleted:
+		if userID != "7" {
+			t.Errorf("expected user 7's backup to be deleted, got %q", userID)
+		}
+	default:
+		t.Error("expected the jo_bot backup to be deleted")
+	}
+
+	if w := post(`{"user_id": 7}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once logged out, got %d", w.Code)
+	}
+}
+
+func TestLogout_Force(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.LogoutError = errors.New("websocket not connected")
+	injectMockSession(manager, 1, mock)
+
+	if err := manager.Logout(t.Context(), 1, true); err != nil {
+		t.Fatalf("expected a forced logout to succeed, got %v", err)
+	}
+	if manager.GetSession(1) != nil || mock.GetStore().GetID() != nil {
+		t.Error("expected the session and device to be wiped")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,6 +20,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jo-inc/wa_meow/internal/core"
 	_ "github.com/mattn/go-sqlite3"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waCommon"
@@ -27,7 +29,6 @@ import (
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -44,16 +45,29 @@ func (t *baileysTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	req.Header.Del("User-Agent")
 	// Log what we're actually sending
 	log.Printf("[media/http] Request: %s, Headers: Origin=%s", req.URL.Host, req.Header.Get("Origin"))
-	return t.base.RoundTrip(req)
+	resp, err := t.base.RoundTrip(req)
+	// Report download progress for callers that asked for it via withDownloadProgress
+	if err == nil && resp.ContentLength > 0 {
+		if report := downloadProgressFromContext(req.Context()); report != nil {
+			resp.Body = newProgressReader(resp.Body, resp.ContentLength, report)
+		}
+	}
+	return resp, err
 }
 
 type SessionManager struct {
 	sessions           map[int]*UserSession
 	mu                 sync.RWMutex
 	dataDir            string
+	storage            StorageDriver
+	sessionSync        sessionSyncConfig
+	syncMu             sync.Mutex // serializes session uploads
 	joBotURL           string
 	joBotInternalToken string
 	encryptKey         []byte
+	// newClient, if set, replaces the whatsmeow client and its device store, so the
+	// integration tests can run sessions against a scripted fake
+	newClient func(userID int) (WhatsAppClient, error)
 }
 
 // PendingMediaRetry stores info needed to complete a media retry download
@@ -72,47 +86,104 @@ type UserSession struct {
 	LastUsed   time.Time
 	QRChannel  chan string
 	LoginDone  chan bool
-	EventChan  chan MessageEvent
+	EventChan  chan MessageEvent // backlog of events emitted while no consumer is connected
+	Events     eventBroadcaster  // connected /events and /ws consumers
+	emitMu     sync.Mutex        // keeps events in the channel in event log order
+	deliverMu  sync.Mutex        // held by emit while an event waits for room, so later ones wait behind it
+	Queue      eventQueueState   // overflow state of EventChan
 	MediaCache map[string][]byte // Cache downloaded media by message ID
 	MediaMu    sync.RWMutex
+	// When and from which chat each cached media item arrived, for retention
+	MediaCacheInfo map[string]cachedMediaInfo
+	// Background downloads of recent media from history syncs
+	Prewarm MediaPrewarmer
+	// Where cached images are analyzed; nil uses the shared queue
+	ImageAnalysis *ImageAnalysisQueue
 	// Pending media retries: message ID -> pending retry info
 	PendingRetries   map[string]*PendingMediaRetry
 	PendingRetriesMu sync.RWMutex
+	// Recent connection state transitions, for diagnosing missed messages
+	ConnHistory ConnectionHistory
+	// Last time any event arrived from WhatsApp, for status reports
+	LastServerActivity time.Time
+	// Since when keepalives have been failing, or the websocket has been closed without
+	// being asked to; zero while the connection is fine. Checked by the watchdog.
+	KeepAliveFailingSince time.Time
+	DisconnectedSince     time.Time
+	WatchdogReconnects    int
+	ActivityMu            sync.RWMutex
+	// Disappearing-messages timers seen on direct chats
+	Ephemeral EphemeralTimers
+	// Transcript of received messages and chat notifications; nil if it couldn't be opened
+	Messages *MessageStore
+	// Incoming calls awaiting an answer, for missed-call notifications
+	Calls CallTracker
+	// Automatic away-message replies to direct messages
+	Away AwayMode
+	// Automatic reactions to matching incoming messages
+	AutoReact AutoReact
+	// URL events are also POSTed to
+	Webhook Webhook
+	// Per-sender message rates, for flood detection
+	Floods FloodDetector
+	// Schedule of outgoing messages, kept within outboundPacing
+	Pacer OutboundPacer
+	// First messages per day, held to the warm-up schedule while the number is new
+	Warmup WarmupTracker
+	// Texts recently sent to each chat, to refuse duplicates within duplicateWindow
+	Duplicates DuplicateGuard
+	// Language incoming messages are translated into, if any
+	Translation TranslationSetting
+	// How long message history and cached media are kept
+	Retention RetentionSetting
+	// Timezone and locale timestamps are formatted in
+	TimeFormat TimeFormatSetting
+	// Whether events go out with metadata only
+	Redaction RedactionSetting
+	// Chats the session is limited to or shut out of
+	ChatAccess ChatAccessSetting
+	// Whether sends wait for approval, and the ones waiting
+	Approval ApprovalSetting
+	Pending  PendingSends
+	// On-demand history requests waiting for the phone to answer
+	History HistoryRequests
+	// Participants of the user's groups, kept current from notifications
+	Groups GroupMembers
+	// Contacts whose presence the user subscribed to, and the user's own online status
+	Presence     PresenceSubscriptions
+	Availability AvailabilitySetting
+	// Incoming messages waiting for geocoding or translation
+	Enrich EnrichQueue
+	// Signalled when a QR login ends without pairing, so it can be restarted, or is cancelled
+	QRExpired   chan struct{}
+	QRCancelled chan struct{}
+	qrMu        sync.Mutex
+	qrCancel    context.CancelFunc // set while a QR login is running
+	qrReady     chan struct{}      // closed once the running QR login has its first code
+	// Ends when the session is closed, stopping its background work
+	lifeOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
-type MessageEvent struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
+// Context is cancelled once the session is closed
+func (s *UserSession) Context() context.Context {
+	s.lifeOnce.Do(func() { s.ctx, s.cancel = context.WithCancel(context.Background()) })
+	return s.ctx
 }
 
-type MessagePayload struct {
-	ID         string `json:"id"`
-	ChatJID    string `json:"chat_jid"`
-	SenderJID  string `json:"sender_jid"`
-	SenderName string `json:"sender_name"`
-	Text       string `json:"text"`
-	Timestamp  int64  `json:"timestamp"`
-	IsFromMe   bool   `json:"is_from_me"`
-	// Media fields
-	MediaType string `json:"media_type,omitempty"` // "image", "location", etc.
-	MediaURL  string `json:"media_url,omitempty"`
-	MimeType  string `json:"mime_type,omitempty"`
-	Caption   string `json:"caption,omitempty"`
-	// Location fields
-	Latitude  float64 `json:"latitude,omitempty"`
-	Longitude float64 `json:"longitude,omitempty"`
-	// Contact fields (vCard)
-	ContactName  string `json:"contact_name,omitempty"`
-	ContactVCard string `json:"contact_vcard,omitempty"`
-	// Media download info
-	MediaKey      []byte `json:"media_key,omitempty"`
-	DirectPath    string `json:"direct_path,omitempty"`
-	FileEncSHA256 []byte `json:"file_enc_sha256,omitempty"`
-	FileSHA256    []byte `json:"file_sha256,omitempty"`
-	FileLength    uint64 `json:"file_length,omitempty"`
-	IsPTT         bool   `json:"is_ptt,omitempty"` // Push-to-talk (voice note) - critical for download
+// stop ends the session's background work when it's closed
+func (s *UserSession) stop() {
+	s.Context()
+	s.cancel()
 }
 
+// The event and message payload types are shared with the bridge and CLI
+type (
+	MessageEvent   = core.Event
+	MessagePayload = core.MessagePayload
+)
+
 type ChatPayload struct {
 	JID     string `json:"jid"`
 	Name    string `json:"name"`
@@ -139,6 +210,8 @@ func NewSessionManager(dataDir, joBotURL, encryptKeyB64 string) *SessionManager
 	return &SessionManager{
 		sessions:           make(map[int]*UserSession),
 		dataDir:            dataDir,
+		storage:            &sqliteDirDriver{Dir: dataDir},
+		sessionSync:        sessionSyncFromEnv(),
 		joBotURL:           joBotURL,
 		joBotInternalToken: strings.TrimSpace(os.Getenv("JO_WHATSAPP_INTERNAL_TOKEN")),
 		encryptKey:         encryptKey,
@@ -198,7 +271,8 @@ func (m *SessionManager) decrypt(encoded string) ([]byte, error) {
 }
 
 func (m *SessionManager) fetchSessionFromJoBot(userID int) error {
-	if m.joBotURL == "" || m.encryptKey == nil {
+	dbPath := m.storage.Path(userID)
+	if m.joBotURL == "" || m.encryptKey == nil || dbPath == "" {
 		return nil
 	}
 	
@@ -223,8 +297,12 @@ func (m *SessionManager) fetchSessionFromJoBot(userID int) error {
 		return nil
 	}
 	
+	// In incremental mode, deltas since the last full snapshot come along, oldest first
 	var result struct {
-		Data string `json:"data"`
+		Data   string `json:"data"`
+		Deltas []struct {
+			Data string `json:"data"`
+		} `json:"deltas"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil
@@ -239,14 +317,25 @@ func (m *SessionManager) fetchSessionFromJoBot(userID int) error {
 		log.Printf("Failed to decrypt session: %v", err)
 		return nil
 	}
+	for i, d := range result.Deltas {
+		delta, err := m.decrypt(d.Data)
+		if err == nil {
+			dbData, err = applySessionDelta(dbData, delta)
+		}
+		if err != nil {
+			log.Printf("Failed to apply session delta %d/%d: %v", i+1, len(result.Deltas), err)
+			return nil
+		}
+	}
 	
-	dbPath := filepath.Join(m.dataDir, fmt.Sprintf("user_%d.db", userID))
 	if err := os.WriteFile(dbPath, dbData, 0600); err != nil {
 		log.Printf("Failed to write session db: %v", err)
 		return err
 	}
+	// Whatever we knew about past uploads doesn't describe this database; start over with a full snapshot
+	os.Remove(m.syncStatePath(userID))
 	
-	log.Printf("✅ Restored session for user %d from jo_bot", userID)
+	log.Printf("✅ Restored session for user %d from jo_bot (%d deltas)", userID, len(result.Deltas))
 	return nil
 }
 
@@ -255,13 +344,51 @@ func (m *SessionManager) saveSessionToJoBot(userID int) error {
 		return nil
 	}
 	
-	dbPath := filepath.Join(m.dataDir, fmt.Sprintf("user_%d.db", userID))
-	dbData, err := os.ReadFile(dbPath)
+	dbPath := m.storage.Path(userID)
+	if dbPath == "" {
+		return fmt.Errorf("session backup isn't supported by the %s storage driver", m.storage.Name())
+	}
+	// The live client may be writing to the database; copying the file could tear it
+	dbData, err := snapshotSQLite(context.Background(), dbPath)
 	if err != nil {
 		return err
 	}
 	
-	encrypted, err := m.encrypt(dbData)
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+	if !m.sessionSync.Incremental {
+		return m.postSessionToJoBot(userID, &sessionUpload{Kind: sessionUploadFull, Data: dbData})
+	}
+
+	var prev *sessionSyncState
+	var state sessionSyncState
+	if err := readJSONFile(m.syncStatePath(userID), &state); err == nil && state.Seq > 0 {
+		prev = &state
+	}
+	upload, next := planSessionUpload(m.sessionSync, prev, dbData, time.Now())
+	if upload == nil {
+		log.Printf("Session for user %d unchanged since last save", userID)
+		return nil
+	}
+	err = m.postSessionToJoBot(userID, upload)
+	if errors.Is(err, errSessionBaseMismatch) {
+		log.Printf("jo_bot is missing the base of the session delta for user %d, sending a full snapshot", userID)
+		upload, next = fullSessionUpload(prev, dbData, next.Hashes, time.Now())
+		err = m.postSessionToJoBot(userID, upload)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(m.syncStatePath(userID), next); err != nil {
+		log.Printf("Warning: failed to record session sync state for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// postSessionToJoBot encrypts and uploads one save. Incremental mode adds the upload's
+// kind and sequence numbers so jo_bot can chain deltas onto their snapshot.
+func (m *SessionManager) postSessionToJoBot(userID int, upload *sessionUpload) error {
+	encrypted, err := m.encrypt(upload.Data)
 	if err != nil {
 		return err
 	}
@@ -270,6 +397,13 @@ func (m *SessionManager) saveSessionToJoBot(userID int) error {
 		"user_id": userID,
 		"data":    encrypted,
 	}
+	if m.sessionSync.Incremental {
+		payload["kind"] = upload.Kind
+		payload["seq"] = upload.Seq
+		if upload.Kind == sessionUploadDelta {
+			payload["base_seq"] = upload.BaseSeq
+		}
+	}
 	jsonData, _ := json.Marshal(payload)
 	
 	url := fmt.Sprintf("%s/api/whatsapp/session", m.joBotURL)
@@ -286,12 +420,15 @@ func (m *SessionManager) saveSessionToJoBot(userID int) error {
 	}
 	defer resp.Body.Close()
 	
+	if resp.StatusCode == http.StatusConflict && upload.Kind == sessionUploadDelta {
+		return errSessionBaseMismatch
+	}
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Failed to save session: status %d", resp.StatusCode)
 		return fmt.Errorf("save failed: %d", resp.StatusCode)
 	}
 	
-	log.Printf("✅ Saved session for user %d to jo_bot", userID)
+	log.Printf("✅ Saved session for user %d to jo_bot (%s, %d bytes)", userID, upload.Kind, len(upload.Data))
 	return nil
 }
 
@@ -306,23 +443,111 @@ func (m *SessionManager) GetOrCreateSession(userID int) (*UserSession, error) {
 
 	// Try to restore session from jo_bot
 	m.fetchSessionFromJoBot(userID)
+	return m.openSession(userID)
+}
 
-	ctx := context.Background()
-	dbPath := filepath.Join(m.dataDir, fmt.Sprintf("user_%d.db", userID))
+// sessionSetting is a per-session setting kept in DATA_DIR. Opening a session loads it,
+// a transfer moves its file and logout deletes it.
+type sessionSetting struct {
+	file string // file name, formatted with the user ID
+	what string // what it holds, for log messages
+	load func(s *UserSession, path string) error
+}
+
+var sessionSettings = []sessionSetting{
+	{"away_%d.json", "away config", func(s *UserSession, path string) error { return s.Away.load(path) }},
+	{"autoreact_%d.json", "auto-react rules", func(s *UserSession, path string) error { return s.AutoReact.load(path) }},
+	{"webhook_%d.json", "webhook", func(s *UserSession, path string) error { return s.Webhook.load(path) }},
+	{"translation_%d.json", "translation setting", func(s *UserSession, path string) error { return s.Translation.load(path) }},
+	{"retention_%d.json", "retention policy", func(s *UserSession, path string) error { return s.Retention.load(path) }},
+	{"timeformat_%d.json", "time format", func(s *UserSession, path string) error { return s.TimeFormat.load(path) }},
+	{"redaction_%d.json", "redaction setting", func(s *UserSession, path string) error { return s.Redaction.load(path) }},
+	{"chataccess_%d.json", "chat access lists", func(s *UserSession, path string) error { return s.ChatAccess.load(path) }},
+	{"approval_%d.json", "approval setting", func(s *UserSession, path string) error { return s.Approval.load(path) }},
+	{"presence_%d.json", "presence setting", func(s *UserSession, path string) error { return s.Availability.load(path) }},
+	{"warmup_%d.json", "warm-up state", func(s *UserSession, path string) error { return s.Warmup.load(path) }},
+}
+
+// settingPath is where the setting file named by the pattern file is kept for userID
+func (m *SessionManager) settingPath(file string, userID int) string {
+	return filepath.Join(m.dataDir, fmt.Sprintf(file, userID))
+}
+
+// openSession opens the user's device and message databases and registers the session.
+// The caller must hold m.mu.
+func (m *SessionManager) openSession(userID int) (*UserSession, error) {
+	var client WhatsAppClient
+	var container *sqlstore.Container
+	var err error
+	if m.newClient != nil {
+		client, err = m.newClient(userID)
+	} else {
+		client, container, err = m.openWhatsmeowClient(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	dbLog := waLog.Stdout("Database", "ERROR", true)
-	container, err := sqlstore.New(ctx, "sqlite3", "file:"+dbPath+"?_foreign_keys=on", dbLog)
+	messages, err := openMessageStore(filepath.Join(m.dataDir, fmt.Sprintf("messages_%d.db", userID)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create sqlstore: %w", err)
+		log.Printf("Warning: message history disabled for user %d: %v", userID, err)
+	}
+
+	session := &UserSession{
+		UserID:         userID,
+		Client:         client,
+		Container:      container,
+		DBPath:         m.storage.Path(userID),
+		LastUsed:       time.Now(),
+		QRChannel:      make(chan string, 10),
+		LoginDone:      make(chan bool, 1),
+		QRExpired:      make(chan struct{}, 1),
+		QRCancelled:    make(chan struct{}, 1),
+		EventChan:      make(chan MessageEvent, eventQueue.Size),
+		MediaCache:     make(map[string][]byte),
+		PendingRetries: make(map[string]*PendingMediaRetry),
+		Messages:       messages,
+
+		LastServerActivity: time.Now(),
+	}
+	for _, setting := range sessionSettings {
+		if err := setting.load(session, m.settingPath(setting.file, userID)); err != nil {
+			log.Printf("Warning: failed to load %s for user %d: %v", setting.what, userID, err)
+		}
+	}
+	if err := session.Groups.load(messages); err != nil {
+		log.Printf("Warning: failed to load group participants for user %d: %v", userID, err)
+	}
+
+	client.AddEventHandler(func(evt interface{}) {
+		session.handleEvent(evt)
+	})
+	if real, ok := client.(*realClientWrapper); ok {
+		rawClient := real.client
+		rawClient.AutoReconnectHook = func(err error) bool {
+			session.ConnHistory.Record(ConnStateReconnectAttempt, fmt.Sprintf("attempt %d: %v", rawClient.AutoReconnectErrors, err))
+			return true
+		}
 	}
+	// Every send goes through the client, so this is where pacing can't be bypassed
+	session.Client = &pacedClient{WhatsAppClient: client, session: session}
+
+	m.sessions[userID] = session
+	return session, nil
+}
 
-	deviceStore, err := container.GetFirstDevice(ctx)
+// openWhatsmeowClient opens the user's device store and a client for it
+func (m *SessionManager) openWhatsmeowClient(userID int) (WhatsAppClient, *sqlstore.Container, error) {
+	ctx := context.Background()
+	container, err := m.storage.Open(ctx, userID, core.Logger("Database"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get device: %w", err)
+		return nil, nil, fmt.Errorf("failed to create sqlstore: %w", err)
 	}
 
-	clientLog := waLog.Stdout("Client", "ERROR", true)
-	rawClient := whatsmeow.NewClient(deviceStore, clientLog)
+	rawClient, err := core.NewClient(ctx, container, core.Logger("Client"))
+	if err != nil {
+		return nil, nil, err
+	}
 	
 	// Configure a custom HTTP client for media downloads that mimics Baileys:
 	// 1. Remove Referer header (Baileys doesn't send it)
@@ -342,32 +567,14 @@ func (m *SessionManager) GetOrCreateSession(userID int) (*UserSession, error) {
 		Timeout:   60 * time.Second,
 	})
 	
-	client := newRealClientWrapper(rawClient)
-
-	session := &UserSession{
-		UserID:         userID,
-		Client:         client,
-		Container:      container,
-		DBPath:         dbPath,
-		LastUsed:       time.Now(),
-		QRChannel:      make(chan string, 10),
-		LoginDone:      make(chan bool, 1),
-		EventChan:      make(chan MessageEvent, 100),
-		MediaCache:     make(map[string][]byte),
-		PendingRetries: make(map[string]*PendingMediaRetry),
-	}
-
-	rawClient.AddEventHandler(func(evt interface{}) {
-		session.handleEvent(evt)
-	})
-
-	m.sessions[userID] = session
-	return session, nil
+	return newRealClientWrapper(rawClient), container, nil
 }
 
+// GetSession returns the user's open session, or nil. It takes the write lock since it
+// touches LastUsed, which concurrent requests for the same user would otherwise race on.
 func (m *SessionManager) GetSession(userID int) *UserSession {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if session, ok := m.sessions[userID]; ok {
 		session.LastUsed = time.Now()
 		return session
@@ -379,7 +586,9 @@ func (m *SessionManager) RemoveSession(userID int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if session, ok := m.sessions[userID]; ok {
+		session.stop()
 		session.Client.Disconnect()
+		session.Messages.Close()
 		// Save session before removing
 		m.saveSessionToJoBot(userID)
 		delete(m.sessions, userID)
@@ -394,91 +603,83 @@ func (m *SessionManager) SaveSession(userID int) {
 	}
 }
 
+// emit logs an event for replay and queues it for the session's consumers without
+// blocking the caller. With redaction on, the content is stripped first, so it's never
+// logged or sent.
+func (s *UserSession) emit(evt MessageEvent) {
+	if s.Redaction.Enabled() {
+		evt = redactEvent(evt)
+	}
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+	s.emitMu.Lock()
+	seq, err := s.Messages.AppendEvent(context.Background(), evt)
+	if err != nil {
+		log.Printf("[events] Failed to log %s event for user %d: %v", evt.Type, s.UserID, err)
+	}
+	evt.Seq = seq
+
+	s.Webhook.enqueue(s.Context(), s.UserID, evt)
+	wait := s.queueEvent(evt)
+	s.emitMu.Unlock()
+	if wait != nil {
+		wait()
+	}
+}
+
 func (s *UserSession) handleEvent(evt interface{}) {
+	// Keepalive timeouts are the absence of server noise, not noise
+	if _, isTimeout := evt.(*events.KeepAliveTimeout); !isTimeout {
+		s.touchActivity()
+	}
+	s.trackConnHealth(evt)
+	recordProtocolEvent(evt)
+	s.trackGroupMembers(evt)
+	s.trackLabels(evt)
+	if v, ok := evt.(*events.GroupInfo); ok {
+		s.emitGroupUpdate(v)
+	}
+
+	if s.handleSystemEvent(evt) {
+		return
+	}
+
 	switch v := evt.(type) {
 	case *events.Message:
-		payload := MessagePayload{
-			ID:         v.Info.ID,
-			ChatJID:    v.Info.Chat.String(),
-			SenderJID:  v.Info.Sender.String(),
-			SenderName: v.Info.PushName,
-			Timestamp:  v.Info.Timestamp.Unix(),
-			IsFromMe:   v.Info.IsFromMe,
+		unwrapViewOnce(v)
+		if !s.chatAllowed(v.Info.Chat) {
+			return
 		}
-
-		hasContent := false
-
-		// Handle text messages
-		if v.Message.Conversation != nil {
-			payload.Text = *v.Message.Conversation
-			hasContent = true
-		} else if v.Message.ExtendedTextMessage != nil && v.Message.ExtendedTextMessage.Text != nil {
-			payload.Text = *v.Message.ExtendedTextMessage.Text
-			hasContent = true
+		s.observeEphemeral(v)
+		if system := ephemeralSettingSystemMessage(v); system != nil {
+			s.emitMessage(*system)
+			return
+		}
+		// REVOKE is the zero type, so messages without a protocol message would match it
+		if protoMsg := v.Message.GetProtocolMessage(); protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_REVOKE {
+			s.handleRevoke(v)
+			return
+		}
+		if v.Message.GetPollUpdateMessage() != nil {
+			s.handlePollVote(v)
+			return
+		}
+		if v.Info.Chat == types.StatusBroadcastJID {
+			s.handleStatus(v)
+			return
 		}
 
-		// Handle image messages
-		if img := v.Message.ImageMessage; img != nil {
-			payload.MediaType = "image"
-			if img.Caption != nil {
-				payload.Caption = *img.Caption
-			}
-			if img.Mimetype != nil {
-				payload.MimeType = *img.Mimetype
-			}
-			if img.URL != nil {
-				payload.MediaURL = *img.URL
-			}
-			if img.DirectPath != nil {
-				payload.DirectPath = *img.DirectPath
-			}
-			payload.MediaKey = img.MediaKey
-			payload.FileEncSHA256 = img.FileEncSHA256
-			payload.FileSHA256 = img.FileSHA256
-			if img.FileLength != nil {
-				payload.FileLength = *img.FileLength
-			}
-			
-			// Test: download image immediately to compare with PTT download
-			go func(msgID string, imgMsg *waE2E.ImageMessage) {
-				data, err := s.Client.Download(context.Background(), imgMsg)
-				if err != nil {
-					log.Printf("[media/cache] Failed to download image %s: %v", msgID, err)
-					return
-				}
-				s.MediaMu.Lock()
-				s.MediaCache[msgID] = data
-				s.MediaMu.Unlock()
-				log.Printf("[media/cache] Cached image %s: %d bytes", msgID, len(data))
-			}(v.Info.ID, img)
-			
-			hasContent = true
+		parsed := core.ParseMessage(v)
+		payload, hasContent := s.newMessagePayload(parsed)
+		var geocodeWith Geocoder
+
+		// Cache media right away; audio is retried below
+		if media := parsed.Media; media != nil && media.Kind != "audio" && media.Kind != "ptt" {
+			go s.cacheMedia(v.Info.ID, payload.ChatJID, media.Kind, media.File, media.FileLength)
 		}
 
 		// Handle audio/voice messages (ptt = push-to-talk/voice note)
 		if audio := v.Message.AudioMessage; audio != nil {
-			payload.IsPTT = audio.GetPTT()
-			if payload.IsPTT {
-				payload.MediaType = "ptt"
-			} else {
-				payload.MediaType = "audio"
-			}
-			if audio.Mimetype != nil {
-				payload.MimeType = *audio.Mimetype
-			}
-			if audio.URL != nil {
-				payload.MediaURL = *audio.URL
-			}
-			if audio.DirectPath != nil {
-				payload.DirectPath = *audio.DirectPath
-			}
-			payload.MediaKey = audio.MediaKey
-			payload.FileEncSHA256 = audio.FileEncSHA256
-			payload.FileSHA256 = audio.FileSHA256
-			if audio.FileLength != nil {
-				payload.FileLength = *audio.FileLength
-			}
-			
 			// Download audio with retry loop for desktop-originated messages
 			// Desktop (web) messages may arrive before media upload is complete (mediaStage != RESOLVED)
 			// We retry with delays to wait for CDN, then fall back to MediaRetry for phone re-upload
@@ -539,10 +740,14 @@ func (s *UserSession) handleEvent(evt interface{}) {
 				}
 
 				if len(data) > 0 {
-					s.MediaMu.Lock()
-					s.MediaCache[msgID] = data
-					s.MediaMu.Unlock()
+					if !s.scanDownloadedMedia(msgID, msgInfo.Chat.String(), data) {
+						return
+					}
+					s.storeCachedMedia(msgID, msgInfo.Chat.String(), data)
 					log.Printf("[media/cache] Cached audio %s: %d bytes (ptt=%v)", msgID, len(data), isPTT)
+					if isPTT {
+						s.transcribeVoiceNote(msgID, msgInfo.Chat.String(), data, audioMsg.GetMimetype())
+					}
 					return
 				}
 
@@ -574,57 +779,16 @@ func (s *UserSession) handleEvent(evt interface{}) {
 					log.Printf("[media/cache] WARNING: Audio %s download failed after all retries, 0 bytes (ptt=%v)", msgID, isPTT)
 				}
 			}(v.Info.ID, audio, payload.IsPTT, &v.Info)
-			
-			hasContent = true
-		}
-
-		// Handle location messages
-		if loc := v.Message.LocationMessage; loc != nil {
-			payload.MediaType = "location"
-			if loc.DegreesLatitude != nil {
-				payload.Latitude = *loc.DegreesLatitude
-			}
-			if loc.DegreesLongitude != nil {
-				payload.Longitude = *loc.DegreesLongitude
-			}
-			if loc.Name != nil {
-				payload.Text = *loc.Name
-			}
-			if loc.Address != nil {
-				if payload.Text != "" {
-					payload.Text += " - " + *loc.Address
-				} else {
-					payload.Text = *loc.Address
-				}
-			}
-			hasContent = true
 		}
 
-		// Handle live location messages
-		if loc := v.Message.LiveLocationMessage; loc != nil {
-			payload.MediaType = "live_location"
-			if loc.DegreesLatitude != nil {
-				payload.Latitude = *loc.DegreesLatitude
-			}
-			if loc.DegreesLongitude != nil {
-				payload.Longitude = *loc.DegreesLongitude
-			}
-			if loc.Caption != nil {
-				payload.Caption = *loc.Caption
-			}
-			hasContent = true
+		// Sender shared only coordinates; look the address up before emitting
+		if payload.MediaType == "location" && payload.Address == "" && geocoder != nil && (payload.Latitude != 0 || payload.Longitude != 0) {
+			geocodeWith = geocoder
 		}
 
-		// Handle contact messages (single contact)
-		if contact := v.Message.ContactMessage; contact != nil {
-			payload.MediaType = "contact"
-			if contact.DisplayName != nil {
-				payload.ContactName = *contact.DisplayName
-			}
-			if contact.Vcard != nil {
-				payload.ContactVCard = *contact.Vcard
-			}
-			hasContent = true
+		// Poll options are kept so votes can be named
+		if payload.MediaType == "poll" {
+			s.savePoll(payload.ChatJID, v.Info.ID, payload.PollOptions)
 		}
 
 		// Handle contact array messages (multiple contacts)
@@ -638,6 +802,7 @@ func (s *UserSession) handleEvent(evt interface{}) {
 					SenderName: v.Info.PushName,
 					Timestamp:  v.Info.Timestamp.Unix(),
 					IsFromMe:   v.Info.IsFromMe,
+					IsSelfChat: s.isSelfChat(v.Info.Chat),
 					MediaType:  "contact",
 				}
 				if contact.DisplayName != nil {
@@ -645,28 +810,121 @@ func (s *UserSession) handleEvent(evt interface{}) {
 				}
 				if contact.Vcard != nil {
 					contactPayload.ContactVCard = *contact.Vcard
+					contactPayload.Contact = core.ParseVCard(*contact.Vcard)
 				}
-				select {
-				case s.EventChan <- MessageEvent{Type: "message", Payload: contactPayload}:
-				default:
-					log.Printf("Event channel full for user %d, dropping contact", s.UserID)
-				}
+				s.flagChatState(&contactPayload, v.Info.Chat)
+				s.flagChatLabels(&contactPayload, v.Info.Chat)
+				s.emitMessage(contactPayload)
 			}
 			// Don't set hasContent since we've already sent the events
 		}
 
+		muted := false
 		if hasContent {
-			select {
-			case s.EventChan <- MessageEvent{Type: "message", Payload: payload}:
-			default:
-				log.Printf("Event channel full for user %d, dropping message", s.UserID)
+			s.flagChatState(&payload, v.Info.Chat)
+			s.flagChatLabels(&payload, v.Info.Chat)
+			s.routeMessage(&payload)
+			if muted = s.checkFlood(payload); !muted {
+				s.autoReply(payload)
+				s.autoReact(payload)
 			}
 		}
+		if hasContent && (muted || s.routeCommand(payload)) {
+			// Muted for flooding or answered by the command router; keep it in history but don't forward it
+			s.storeMessage(payload)
+		} else if hasContent {
+			s.emitEnriched(payload, geocodeWith, s.wantsTranslation(payload))
+		}
+
+	case *events.HistorySync:
+		s.handleHistorySync(v)
+
+	case *events.Receipt:
+		canary.observeReceipt(s.UserID, v)
+		s.emitReceipt(v)
+		if v.Type == types.ReceiptTypeServerError {
+			s.handleServerErrorReceipt(v)
+		}
 
 	case *events.MediaRetry:
 		// Handle MediaRetry response from phone after SendMediaRetryReceipt
 		// This contains a new DirectPath for downloading media that was re-uploaded
 		s.handleMediaRetry(v)
+
+	case *events.PairSuccess:
+		s.Warmup.linked(time.Now())
+		s.emitPaired(v)
+
+	case *events.Presence:
+		s.emitPresence(v)
+
+	case *events.Connected:
+		s.ConnHistory.Record(ConnStateConnected, "")
+		go s.restorePresence()
+	case *events.Disconnected:
+		s.ConnHistory.Record(ConnStateDisconnected, "websocket closed")
+	case *events.StreamReplaced:
+		s.ConnHistory.Record(ConnStateStreamReplaced, "another client connected with the same session")
+	case *events.LoggedOut:
+		s.ConnHistory.Record(ConnStateLoggedOut, v.Reason.String())
+		go manager.relink(s, v)
+	case *events.ConnectFailure:
+		s.ConnHistory.Record(ConnStateConnectFailure, fmt.Sprintf("%s: %s", v.Reason, v.Message))
+	case *events.TemporaryBan:
+		s.ConnHistory.Record(ConnStateTemporaryBan, v.String())
+	case *events.ClientOutdated:
+		s.ConnHistory.Record(ConnStateClientOutdated, "")
+	case *events.KeepAliveTimeout:
+		s.ConnHistory.Record(ConnStateKeepAliveTimeout, fmt.Sprintf("%d errors, last success %s", v.ErrorCount, v.LastSuccess.Format(time.RFC3339)))
+	case *events.KeepAliveRestored:
+		s.ConnHistory.Record(ConnStateKeepAliveRestored, "")
+	}
+}
+
+const (
+	defaultMediaCacheMaxMB       = 64
+	defaultMediaCacheConcurrency = 4
+)
+
+// mediaCacheMaxBytes is the largest incoming media cached ahead of a request; bigger
+// files are downloaded when asked for. 0 caches everything.
+var mediaCacheMaxBytes = int64(concurrencyLimitFromEnv("MEDIA_CACHE_MAX_MB", defaultMediaCacheMaxMB)) << 20
+
+// mediaCacheSlots bounds background media downloads across sessions, so a burst of
+// incoming media can't hold every file in memory at once
+var mediaCacheSlots = make(chan struct{}, max(1, concurrencyLimitFromEnv("MEDIA_CACHE_CONCURRENCY", defaultMediaCacheConcurrency)))
+
+// cacheMedia downloads media in the background so /media/download can serve it from memory.
+// Large files emit download_progress events while they download.
+func (s *UserSession) cacheMedia(msgID, chatJID, mediaType string, msg whatsmeow.DownloadableMessage, fileLength uint64) {
+	if mediaCacheMaxBytes > 0 && int64(fileLength) > mediaCacheMaxBytes {
+		log.Printf("[media/cache] Not caching %s %s: %d bytes is over MEDIA_CACHE_MAX_MB", mediaType, msgID, fileLength)
+		return
+	}
+	select {
+	case mediaCacheSlots <- struct{}{}:
+	case <-s.Context().Done():
+		return
+	}
+	ctx := s.progressContext(msgID, chatJID, mediaType, fileLength)
+	data, err := s.Client.Download(ctx, msg)
+	<-mediaCacheSlots
+	if err != nil {
+		log.Printf("[media/cache] Failed to download %s %s: %v", mediaType, msgID, err)
+		return
+	}
+	if mediaCacheMaxBytes > 0 && int64(len(data)) > mediaCacheMaxBytes {
+		// The reported length was missing or wrong
+		log.Printf("[media/cache] Not caching %s %s: %d bytes is over MEDIA_CACHE_MAX_MB", mediaType, msgID, len(data))
+		return
+	}
+	if !s.scanDownloadedMedia(msgID, chatJID, data) {
+		return
+	}
+	s.storeCachedMedia(msgID, chatJID, data)
+	log.Printf("[media/cache] Cached %s %s: %d bytes", mediaType, msgID, len(data))
+	if img, ok := msg.(*waE2E.ImageMessage); ok {
+		s.analyzeImage(msgID, chatJID, data, img.GetMimetype())
 	}
 }
 
@@ -737,11 +995,16 @@ func (s *UserSession) handleMediaRetry(evt *events.MediaRetry) {
 		return
 	}
 
+	if !s.scanDownloadedMedia(msgID, evt.ChatID.String(), data) {
+		return
+	}
+
 	// Cache the downloaded media
-	s.MediaMu.Lock()
-	s.MediaCache[msgID] = data
-	s.MediaMu.Unlock()
+	s.storeCachedMedia(msgID, evt.ChatID.String(), data)
 	log.Printf("[media/retry] SUCCESS: Cached audio %s: %d bytes (ptt=%v) via MediaRetry", msgID, len(data), pending.IsPTT)
+	if pending.IsPTT {
+		go s.transcribeVoiceNote(msgID, evt.ChatID.String(), data, pending.AudioMsg.GetMimetype())
+	}
 }
 
 func jsonResponse(w http.ResponseWriter, data interface{}) {
@@ -749,10 +1012,25 @@ func jsonResponse(w http.ResponseWriter, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// errorResponse writes a JSON error. Under requestIDMiddleware the body carries the
+// request ID, and the error is logged with it.
 func errorResponse(w http.ResponseWriter, status int, message string) {
+	errorResponseWith(w, status, message, nil)
+}
+
+// errorResponseWith is errorResponse with extra fields in the body
+func errorResponseWith(w http.ResponseWriter, status int, message string, extra map[string]interface{}) {
+	body := map[string]interface{}{"error": message}
+	for k, v := range extra {
+		body[k] = v
+	}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+		log.Printf("[http] request_id=%s status=%d error=%q", id, status, message)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	json.NewEncoder(w).Encode(body)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -767,43 +1045,38 @@ func createSessionHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		UserID int `json:"user_id"`
+		// Set before a QR login starts, so a webhook taking QR codes gets the first one
+		Webhook *WebhookConfig `json:"webhook,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid json")
 		return
 	}
+	if req.Webhook != nil {
+		if err := req.Webhook.validate(); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	session, err := manager.GetOrCreateSession(req.UserID)
 	if err != nil {
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if req.Webhook != nil {
+		if _, err := session.Webhook.Set(*req.Webhook); err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to save webhook: "+err.Error())
+			return
+		}
+	}
 
 	if session.Client.GetStore().GetID() == nil {
-		qrChan, _ := session.Client.GetQRChannel(context.Background())
-		err := session.Client.Connect()
-		if err != nil && !strings.Contains(err.Error(), "already connected") {
+		if err := session.startQRLogin(); err != nil {
 			errorResponse(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		go func() {
-			for evt := range qrChan {
-				if evt.Event == "code" {
-					select {
-					case session.QRChannel <- evt.Code:
-					default:
-					}
-				} else if evt.Event == "success" {
-					select {
-					case session.LoginDone <- true:
-					default:
-					}
-					return
-				}
-			}
-		}()
-
 		jsonResponse(w, map[string]interface{}{
 			"status":  "needs_qr",
 			"user_id": req.UserID,
@@ -812,6 +1085,7 @@ func createSessionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !session.Client.IsConnected() {
+		session.ConnHistory.Record(ConnStateConnectAttempt, "session create")
 		err := session.Client.Connect()
 		if err != nil && !strings.Contains(err.Error(), "already connected") {
 			errorResponse(w, http.StatusInternalServerError, err.Error())
@@ -826,6 +1100,11 @@ func createSessionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// qrStreamTimeout bounds how long /sessions/qr keeps a login going, renewing expired codes
+const qrStreamTimeout = 5 * time.Minute
+
+// getQRHandler streams QR codes for linking a device, creating the session and starting
+// the login itself if needed and starting a new one whenever the codes expire
 func getQRHandler(w http.ResponseWriter, r *http.Request) {
 	userID := 0
 	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
@@ -834,9 +1113,9 @@ func getQRHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session := manager.GetSession(userID)
-	if session == nil {
-		errorResponse(w, http.StatusNotFound, "session not found")
+	session, err := manager.GetOrCreateSession(userID)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -849,8 +1128,29 @@ func getQRHandler(w http.ResponseWriter, r *http.Request) {
 		errorResponse(w, http.StatusInternalServerError, "streaming not supported")
 		return
 	}
+	sendError := func(err error) {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+		flusher.Flush()
+	}
 
-	timeout := time.After(2 * time.Minute)
+	if session.Client.GetStore().GetID() != nil {
+		if !session.Client.IsConnected() {
+			session.ConnHistory.Record(ConnStateConnectAttempt, "qr stream")
+			if err := session.Client.Connect(); err != nil && !strings.Contains(err.Error(), "already connected") {
+				sendError(err)
+				return
+			}
+		}
+		fmt.Fprintf(w, "event: success\ndata: logged_in\n\n")
+		flusher.Flush()
+		return
+	}
+	if err := session.startQRLogin(); err != nil {
+		sendError(err)
+		return
+	}
+
+	timeout := time.After(qrStreamTimeout)
 	for {
 		select {
 		case code := <-session.QRChannel:
@@ -863,6 +1163,18 @@ func getQRHandler(w http.ResponseWriter, r *http.Request) {
 			flusher.Flush()
 			return
 
+		case <-session.QRExpired:
+			log.Printf("📱 QR codes for user %d expired, starting a new login", userID)
+			if err := session.startQRLogin(); err != nil {
+				sendError(err)
+				return
+			}
+
+		case <-session.QRCancelled:
+			fmt.Fprintf(w, "event: cancelled\ndata: qr_cancelled\n\n")
+			flusher.Flush()
+			return
+
 		case <-timeout:
 			fmt.Fprintf(w, "event: timeout\ndata: qr_expired\n\n")
 			flusher.Flush()
@@ -892,14 +1204,29 @@ func getStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := map[string]interface{}{
-		"connected": session.Client.IsConnected(),
-		"logged_in": session.Client.IsLoggedIn(),
+		"connected":       session.Client.IsConnected(),
+		"logged_in":       session.Client.IsLoggedIn(),
+		"dropped_events":  session.Queue.Dropped(),
+		"event_consumers": session.Events.Count(),
 	}
 
 	if session.Client.GetStore().GetID() != nil {
 		resp["phone"] = session.Client.GetStore().GetID().User
 	}
 
+	if r.URL.Query().Get("detail") == "true" {
+		resp["connection_history"] = session.ConnHistory.Snapshot()
+		session.ActivityMu.RLock()
+		if !session.LastServerActivity.IsZero() {
+			resp["last_server_activity"] = session.LastServerActivity.Unix()
+		}
+		resp["watchdog_reconnects"] = session.WatchdogReconnects
+		session.ActivityMu.RUnlock()
+		if warmup := session.Warmup.Snapshot(currentConfig().Warmup, time.Now()); warmup != nil {
+			resp["warmup"] = warmup
+		}
+	}
+
 	jsonResponse(w, resp)
 }
 
@@ -945,6 +1272,9 @@ func getChatsHandler(w http.ResponseWriter, r *http.Request) {
 	groups, err := session.Client.GetJoinedGroups(ctx)
 	if err == nil {
 		for _, group := range groups {
+			if !session.chatAllowed(group.JID) {
+				continue
+			}
 			chats = append(chats, ChatPayload{
 				JID:     group.JID.String(),
 				Name:    group.Name,
@@ -956,6 +1286,9 @@ func getChatsHandler(w http.ResponseWriter, r *http.Request) {
 	contacts, err := session.Client.GetStore().GetContacts().GetAllContacts(ctx)
 	if err == nil {
 		for jid, contact := range contacts {
+			if !session.chatAllowed(jid) {
+				continue
+			}
 			name := contact.PushName
 			if name == "" {
 				name = contact.FullName
@@ -985,12 +1318,27 @@ func sendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		ChatJID string `json:"chat_jid"`
 		Text    string `json:"text"`
 		ReplyTo string `json:"reply_to,omitempty"` // Optional message ID to reply to
+		// What the replied-to message said and who wrote it, if history doesn't have it
+		QuotedText   string `json:"quoted_text,omitempty"`
+		QuotedSender string `json:"quoted_sender,omitempty"`
+		// Group participants to @-mention; the text should contain "@<number>" for each
+		Mentions []string `json:"mentions,omitempty"`
+		// Fetch the first link in the text and show it as a card with title, description and image
+		LinkPreview bool `json:"link_preview,omitempty"`
+		Force       bool `json:"force,omitempty"` // send even if the same text just went to the chat
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid json")
 		return
 	}
 
+	var limits limitCheck
+	limits.length("text", req.Text, maxTextLength)
+	limits.count("mentions", len(req.Mentions), 0, maxMentions)
+	if limits.reject(w) {
+		return
+	}
+
 	session := manager.GetSession(req.UserID)
 	if session == nil {
 		errorResponse(w, http.StatusNotFound, "session not found")
@@ -1002,34 +1350,76 @@ func sendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
 	}
 
-	var msg *waE2E.Message
+	var contextInfo *waE2E.ContextInfo
 	if req.ReplyTo != "" {
-		// Use ExtendedTextMessage with ContextInfo for reply
-		msg = &waE2E.Message{
-			ExtendedTextMessage: &waE2E.ExtendedTextMessage{
-				Text: proto.String(req.Text),
-				ContextInfo: &waE2E.ContextInfo{
-					StanzaID:      proto.String(req.ReplyTo),
-					Participant:   proto.String(jid.String()),
-					QuotedMessage: &waE2E.Message{Conversation: proto.String("")},
-				},
-			},
+		var quotedSender types.JID
+		if req.QuotedSender != "" {
+			if quotedSender, err = types.ParseJID(req.QuotedSender); err != nil {
+				errorResponse(w, http.StatusBadRequest, "invalid quoted_sender")
+				return
+			}
 		}
-	} else {
-		msg = &waE2E.Message{
-			Conversation: proto.String(req.Text),
+		contextInfo, err = session.replyContext(r.Context(), jid, req.ReplyTo, req.QuotedText, quotedSender)
+		if errors.Is(err, errQuotedSenderUnknown) {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to look up quoted message: "+err.Error())
+			return
 		}
 	}
+	if len(req.Mentions) > 0 {
+		mentioned, err := session.groupMentions(r.Context(), jid, req.Mentions)
+		var mentionErr *MentionError
+		if errors.As(err, &mentionErr) {
+			errorResponseWith(w, http.StatusBadRequest, mentionErr.Error(), map[string]interface{}{
+				"invalid": mentionErr.Invalid, "not_participants": mentionErr.NotParticipants,
+			})
+			return
+		} else if errors.Is(err, errMentionsNeedGroup) {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to get group participants: "+err.Error())
+			return
+		}
+		if contextInfo == nil {
+			contextInfo = &waE2E.ContextInfo{}
+		}
+		contextInfo.MentionedJID = mentioned
+	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.sendText(r.Context(), jid, req.Text, req.Force, func() *waE2E.Message {
+		// A preview is a nicety: the text goes out without one if the page can't be read
+		var preview *LinkPreview
+		if link := firstLink(req.Text); req.LinkPreview && link != "" {
+			var err error
+			if preview, err = fetchLinkPreview(r.Context(), link); err != nil {
+				log.Printf("[link-preview] User %d: no preview for %s: %v", session.UserID, link, err)
+			}
+		}
+
+		// Replies, mentions and previews need an ExtendedTextMessage
+		if contextInfo == nil && preview == nil {
+			return &waE2E.Message{Conversation: proto.String(req.Text)}
+		}
+		extended := &waE2E.ExtendedTextMessage{
+			Text:        proto.String(req.Text),
+			ContextInfo: contextInfo,
+		}
+		if preview != nil {
+			preview.apply(extended)
+		}
+		return &waE2E.Message{ExtendedTextMessage: extended}
+	})
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1067,7 +1457,7 @@ func sendReactionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
@@ -1077,7 +1467,7 @@ func sendReactionHandler(w http.ResponseWriter, r *http.Request) {
 	msg := &waE2E.Message{
 		ReactionMessage: &waE2E.ReactionMessage{
 			Key: &waCommon.MessageKey{
-				RemoteJID:   proto.String(req.ChatJID),
+				RemoteJID:   proto.String(jid.String()),
 				FromMe:      proto.Bool(true),
 				ID:          proto.String(req.MessageID),
 			},
@@ -1086,9 +1476,9 @@ func sendReactionHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1125,7 +1515,7 @@ func setTypingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
@@ -1155,6 +1545,12 @@ func eventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cursor, err := eventsCursor(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	session := manager.GetSession(userID)
 	if session == nil {
 		errorResponse(w, http.StatusNotFound, "session not found")
@@ -1171,17 +1567,17 @@ func eventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for {
-		select {
-		case evt := <-session.EventChan:
-			data, _ := json.Marshal(evt)
-			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
-			flusher.Flush()
-
-		case <-r.Context().Done():
-			return
+	send := func(evt MessageEvent) error {
+		data, _ := json.Marshal(evt)
+		if evt.Seq > 0 {
+			fmt.Fprintf(w, "id: %d\n", evt.Seq)
 		}
+		_, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		flusher.Flush()
+		return err
 	}
+
+	session.streamEvents(r.Context(), cursor, send)
 }
 
 func saveSessionHandler(w http.ResponseWriter, r *http.Request) {
@@ -1210,12 +1606,27 @@ func sendImageHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID   int    `json:"user_id"`
 		ChatJID  string `json:"chat_jid"`
-		ImageB64 string `json:"image_b64"` // Base64 encoded image
 		MimeType string `json:"mime_type"` // e.g. "image/jpeg"
 		Caption  string `json:"caption"`
+		ViewOnce bool   `json:"view_once"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid json")
+
+	var limits limitCheck
+	if limits.body(w, r, "image_b64", "image"); limits.reject(w) {
+		return
+	}
+
+	// image_b64 (base64 encoded image) is decoded straight to a temp file
+	image, err := decodeMediaRequest(r.Body, "image_b64", maxImageSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "image")
+		return
+	}
+	defer image.Close()
+
+	limits.size("image_b64", "image", image.Size)
+	limits.length("caption", req.Caption, maxCaptionLength)
+	if limits.reject(w) {
 		return
 	}
 
@@ -1230,21 +1641,28 @@ func sendImageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
 	}
 
-	// Decode base64 image
-	imageData, err := base64.StdEncoding.DecodeString(req.ImageB64)
+	mimeType, ok := mediaTypeFor(w, image, req.MimeType, "image")
+	if !ok {
+		return
+	}
+	if !scanOutgoingMedia(w, session, image, jid.String()) {
+		return
+	}
+
+	imageReader, err := image.Reader()
 	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid base64 image")
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Upload to WhatsApp servers
-	uploaded, err := session.Client.Upload(context.Background(), imageData, whatsmeow.MediaImage)
+	uploaded, err := session.Client.UploadReader(context.Background(), imageReader, nil, whatsmeow.MediaImage)
 	if err != nil {
 		errorResponse(w, http.StatusInternalServerError, "failed to upload image: "+err.Error())
 		return
@@ -1257,16 +1675,19 @@ func sendImageHandler(w http.ResponseWriter, r *http.Request) {
 			URL:           proto.String(uploaded.URL),
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
-			Mimetype:      proto.String(req.MimeType),
+			Mimetype:      proto.String(mimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
-			FileLength:    proto.Uint64(uint64(len(imageData))),
+			FileLength:    proto.Uint64(uint64(image.Size)),
 		},
 	}
+	if req.ViewOnce {
+		msg = viewOnceMessage(msg)
+	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1285,13 +1706,27 @@ func sendAudioHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID     int    `json:"user_id"`
 		ChatJID    string `json:"chat_jid"`
-		AudioB64   string `json:"audio_b64"`   // Base64 encoded audio
 		MimeType   string `json:"mime_type"`   // e.g. "audio/ogg; codecs=opus"
 		PTT        bool   `json:"ptt"`         // Push-to-talk (voice note mode)
 		Seconds    uint32 `json:"seconds"`     // Duration in seconds
+		ViewOnce   bool   `json:"view_once"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid json")
+
+	var limits limitCheck
+	if limits.body(w, r, "audio_b64", "audio"); limits.reject(w) {
+		return
+	}
+
+	// audio_b64 (base64 encoded audio) is decoded straight to a temp file
+	audio, err := decodeMediaRequest(r.Body, "audio_b64", maxAudioSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "audio")
+		return
+	}
+	defer audio.Close()
+
+	limits.size("audio_b64", "audio", audio.Size)
+	if limits.reject(w) {
 		return
 	}
 
@@ -1306,21 +1741,28 @@ func sendAudioHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
 	}
 
-	// Decode base64 audio
-	audioData, err := base64.StdEncoding.DecodeString(req.AudioB64)
+	mimeType, ok := mediaTypeFor(w, audio, req.MimeType, "audio")
+	if !ok {
+		return
+	}
+	if !scanOutgoingMedia(w, session, audio, jid.String()) {
+		return
+	}
+
+	audioReader, err := audio.Reader()
 	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid base64 audio")
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Upload to WhatsApp servers
-	uploaded, err := session.Client.Upload(context.Background(), audioData, whatsmeow.MediaAudio)
+	uploaded, err := session.Client.UploadReader(context.Background(), audioReader, nil, whatsmeow.MediaAudio)
 	if err != nil {
 		errorResponse(w, http.StatusInternalServerError, "failed to upload audio: "+err.Error())
 		return
@@ -1331,10 +1773,10 @@ func sendAudioHandler(w http.ResponseWriter, r *http.Request) {
 		URL:           proto.String(uploaded.URL),
 		DirectPath:    proto.String(uploaded.DirectPath),
 		MediaKey:      uploaded.MediaKey,
-		Mimetype:      proto.String(req.MimeType),
+		Mimetype:      proto.String(mimeType),
 		FileEncSHA256: uploaded.FileEncSHA256,
 		FileSHA256:    uploaded.FileSHA256,
-		FileLength:    proto.Uint64(uint64(len(audioData))),
+		FileLength:    proto.Uint64(uint64(audio.Size)),
 		PTT:           proto.Bool(req.PTT),
 	}
 	
@@ -1346,10 +1788,13 @@ func sendAudioHandler(w http.ResponseWriter, r *http.Request) {
 	msg := &waE2E.Message{
 		AudioMessage: audioMsg,
 	}
+	if req.ViewOnce {
+		msg = viewOnceMessage(msg)
+	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1368,13 +1813,27 @@ func sendDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID   int    `json:"user_id"`
 		ChatJID  string `json:"chat_jid"`
-		DocB64   string `json:"doc_b64"`   // Base64 encoded document
 		MimeType string `json:"mime_type"` // e.g. "application/pdf"
 		Filename string `json:"filename"`  // e.g. "report.pdf"
 		Caption  string `json:"caption"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid json")
+
+	var limits limitCheck
+	if limits.body(w, r, "doc_b64", "document"); limits.reject(w) {
+		return
+	}
+
+	// doc_b64 (base64 encoded document) is decoded straight to a temp file
+	doc, err := decodeMediaRequest(r.Body, "doc_b64", maxDocumentSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "document")
+		return
+	}
+	defer doc.Close()
+
+	limits.size("doc_b64", "document", doc.Size)
+	limits.length("caption", req.Caption, maxCaptionLength)
+	if limits.reject(w) {
 		return
 	}
 
@@ -1389,19 +1848,27 @@ func sendDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
 	}
 
-	docData, err := base64.StdEncoding.DecodeString(req.DocB64)
+	mimeType, ok := mediaTypeFor(w, doc, req.MimeType, "")
+	if !ok {
+		return
+	}
+	if !scanOutgoingMedia(w, session, doc, jid.String()) {
+		return
+	}
+
+	docReader, err := doc.Reader()
 	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid base64 document")
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	uploaded, err := session.Client.Upload(context.Background(), docData, whatsmeow.MediaDocument)
+	uploaded, err := session.Client.UploadReader(context.Background(), docReader, nil, whatsmeow.MediaDocument)
 	if err != nil {
 		errorResponse(w, http.StatusInternalServerError, "failed to upload document: "+err.Error())
 		return
@@ -1413,17 +1880,17 @@ func sendDocumentHandler(w http.ResponseWriter, r *http.Request) {
 			URL:           proto.String(uploaded.URL),
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
-			Mimetype:      proto.String(req.MimeType),
+			Mimetype:      proto.String(mimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
-			FileLength:    proto.Uint64(uint64(len(docData))),
+			FileLength:    proto.Uint64(uint64(doc.Size)),
 			FileName:      proto.String(req.Filename),
 		},
 	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1463,7 +1930,7 @@ func sendLocationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jid, err := types.ParseJID(req.ChatJID)
+	jid, err := session.parseChatJID(req.ChatJID)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid jid")
 		return
@@ -1478,9 +1945,9 @@ func sendLocationHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	resp, err := session.Client.SendMessage(context.Background(), jid, msg)
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 
@@ -1544,76 +2011,94 @@ func getGroupInfoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	participants := make([]ParticipantInfo, 0, len(info.Participants))
-	for _, p := range info.Participants {
-		participants = append(participants, ParticipantInfo{
-			JID:          p.JID.String(),
-			IsAdmin:      p.IsAdmin,
-			IsSuperAdmin: p.IsSuperAdmin,
-		})
-	}
+	session.refreshGroup(info.JID, info)
+	payload := newGroupInfoPayload(info)
 
-	payload := GroupInfoPayload{
+	jsonResponse(w, payload)
+}
+
+func newGroupInfoPayload(info *types.GroupInfo) GroupInfoPayload {
+	return GroupInfoPayload{
 		JID:          info.JID.String(),
 		Name:         info.Name,
 		Topic:        info.Topic,
 		Created:      info.GroupCreated.Unix(),
 		CreatorJID:   info.OwnerJID.String(),
-		Participants: participants,
+		Participants: participantsOf(info),
 		IsAnnounce:   info.IsAnnounce,
 		IsLocked:     info.IsLocked,
 	}
-
-	jsonResponse(w, payload)
 }
 
-func listGroupParticipantsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := 0
-	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
-	if userID == 0 {
-		errorResponse(w, http.StatusBadRequest, "user_id required")
-		return
-	}
+// downloadMediaWithRetry downloads media by its direct path, retrying while the CDN
+// returns nothing. The media type used for decryption is derived from mimeType.
+func (s *UserSession) downloadMediaWithRetry(directPath string, fileEncSHA256, fileSHA256, mediaKey []byte, mimeType string) ([]byte, error) {
+	var data []byte
+	var err error
 
-	groupJID := r.URL.Query().Get("group_jid")
-	if groupJID == "" {
-		errorResponse(w, http.StatusBadRequest, "group_jid required")
-		return
+	// Determine media type and mmsType based on mime
+	// Note: PTT uses mmsType="audio" same as regular audio (Baileys has no 'ptt' in MEDIA_PATH_MAP)
+	var mediaType whatsmeow.MediaType
+	var mmsType string
+	if strings.HasPrefix(mimeType, "audio/") {
+		mediaType = whatsmeow.MediaAudio
+		mmsType = "audio" // PTT and regular audio both use "audio"
+	} else if strings.HasPrefix(mimeType, "video/") {
+		mediaType = whatsmeow.MediaVideo
+		mmsType = "video"
+	} else if strings.HasPrefix(mimeType, "image/") || mimeType == lottieStickerMimeType {
+		// Lottie stickers are uploaded as images despite their archive mime type
+		mediaType = whatsmeow.MediaImage
+		mmsType = "image"
+	} else {
+		mediaType = whatsmeow.MediaDocument
+		mmsType = "document"
 	}
 
-	session := manager.GetSession(userID)
-	if session == nil {
-		errorResponse(w, http.StatusNotFound, "session not found")
-		return
-	}
+	// Retry with exponential backoff - CDN returns 26-byte empty stub for stale auth
+	maxRetries := 4
+	backoffs := []time.Duration{500 * time.Millisecond, 1 * time.Second, 2 * time.Second, 4 * time.Second}
 
-	if !session.Client.IsLoggedIn() {
-		errorResponse(w, http.StatusBadRequest, "not logged in")
-		return
-	}
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := backoffs[attempt-1]
+			log.Printf("[media/download] Retry %d/%d after %v", attempt, maxRetries, backoff)
+			time.Sleep(backoff)
+		}
 
-	jid, err := types.ParseJID(groupJID)
-	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "invalid jid")
-		return
+		data, err = s.Client.DownloadMediaWithPath(
+			context.Background(),
+			directPath,
+			fileEncSHA256,
+			fileSHA256,
+			mediaKey,
+			-1,
+			mediaType,
+			mmsType,
+		)
+
+		log.Printf("[media/download] Attempt %d: dataLen=%d, err=%v", attempt+1, len(data), err)
+
+		if err != nil {
+			continue
+		}
+
+		if len(data) > 0 {
+			break
+		}
+
+		log.Printf("[media/download] Attempt %d: got 0 bytes (stale auth, will retry)", attempt+1)
 	}
 
-	info, err := session.Client.GetGroupInfo(context.Background(), jid)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "failed to get group info: "+err.Error())
-		return
+		log.Printf("[media/download] All attempts failed: %v", err)
+		return nil, fmt.Errorf("failed to download: %w", err)
 	}
-
-	participants := make([]ParticipantInfo, 0, len(info.Participants))
-	for _, p := range info.Participants {
-		participants = append(participants, ParticipantInfo{
-			JID:          p.JID.String(),
-			IsAdmin:      p.IsAdmin,
-			IsSuperAdmin: p.IsSuperAdmin,
-		})
+	if len(data) == 0 {
+		log.Printf("[media/download] All attempts returned 0 bytes")
+		return nil, errors.New("media download returned empty content after retries")
 	}
-
-	jsonResponse(w, participants)
+	return data, nil
 }
 
 func downloadMediaHandler(w http.ResponseWriter, r *http.Request) {
@@ -1660,6 +2145,7 @@ func downloadMediaHandler(w http.ResponseWriter, r *http.Request) {
 			// Remove from cache after serving
 			session.MediaMu.Lock()
 			delete(session.MediaCache, req.MessageID)
+			delete(session.MediaCacheInfo, req.MessageID)
 			session.MediaMu.Unlock()
 			jsonResponse(w, map[string]interface{}{
 				"data":      base64.StdEncoding.EncodeToString(cachedData),
@@ -1676,73 +2162,17 @@ func downloadMediaHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[media/download] Downloading %s (ptt=%v) for user %d, fileLen=%d", 
 		req.MimeType, req.IsPTT, req.UserID, req.FileLength)
 	
-	var data []byte
-	var err error
-	
-	// Determine media type and mmsType based on mime
-	// Note: PTT uses mmsType="audio" same as regular audio (Baileys has no 'ptt' in MEDIA_PATH_MAP)
-	var mediaType whatsmeow.MediaType
-	var mmsType string
-	if strings.HasPrefix(req.MimeType, "audio/") {
-		mediaType = whatsmeow.MediaAudio
-		mmsType = "audio" // PTT and regular audio both use "audio"
-	} else if strings.HasPrefix(req.MimeType, "video/") {
-		mediaType = whatsmeow.MediaVideo
-		mmsType = "video"
-	} else if strings.HasPrefix(req.MimeType, "image/") {
-		mediaType = whatsmeow.MediaImage
-		mmsType = "image"
-	} else {
-		mediaType = whatsmeow.MediaDocument
-		mmsType = "document"
-	}
-	
-	// Retry with exponential backoff - CDN returns 26-byte empty stub for stale auth
-	maxRetries := 4
-	backoffs := []time.Duration{500 * time.Millisecond, 1 * time.Second, 2 * time.Second, 4 * time.Second}
-	
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		if attempt > 0 {
-			backoff := backoffs[attempt-1]
-			log.Printf("[media/download] Retry %d/%d after %v", attempt, maxRetries, backoff)
-			time.Sleep(backoff)
-		}
-		
-		data, err = session.Client.DownloadMediaWithPath(
-			context.Background(),
-			req.DirectPath,
-			req.FileEncSHA256,
-			req.FileSHA256,
-			req.MediaKey,
-			-1,
-			mediaType,
-			mmsType,
-		)
-		
-		log.Printf("[media/download] Attempt %d: dataLen=%d, err=%v", attempt+1, len(data), err)
-		
-		if err != nil {
-			continue
-		}
-		
-		if len(data) > 0 {
-			break
-		}
-		
-		log.Printf("[media/download] Attempt %d: got 0 bytes (stale auth, will retry)", attempt+1)
-	}
-	
+	data, err := session.downloadMediaWithRetry(req.DirectPath, req.FileEncSHA256, req.FileSHA256, req.MediaKey, req.MimeType)
 	if err != nil {
-		log.Printf("[media/download] All attempts failed: %v", err)
-		errorResponse(w, http.StatusInternalServerError, "failed to download: "+err.Error())
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if len(data) == 0 {
-		log.Printf("[media/download] All attempts returned 0 bytes")
-		errorResponse(w, http.StatusInternalServerError, "media download returned empty content after retries")
+	log.Printf("[media/download] Success: %d bytes", len(data))
+
+	if !session.scanDownloadedMedia(req.MessageID, "", data) {
+		errorResponse(w, http.StatusForbidden, "media withheld by virus scan")
 		return
 	}
-	log.Printf("[media/download] Success: %d bytes", len(data))
 
 	// Return as base64
 	jsonResponse(w, map[string]interface{}{
@@ -1767,28 +2197,40 @@ func main() {
 	encryptKey := os.Getenv("WHATSAPP_SESSION_KEY")
 
 	manager = NewSessionManager(dataDir, joBotURL, encryptKey)
+	storage, err := storageDriverFromEnv(dataDir)
+	if err != nil {
+		log.Fatalf("Invalid storage config: %v", err)
+	}
+	manager.storage = storage
+
+	eventQueue = eventQueueFromEnv()
+	uploadLimiter = newConcurrencyLimiter("media upload", concurrencyLimitFromEnv("MEDIA_UPLOAD_CONCURRENCY", defaultMediaUploadConcurrency))
+	downloadLimiter = newConcurrencyLimiter("media download", concurrencyLimitFromEnv("MEDIA_DOWNLOAD_CONCURRENCY", defaultMediaDownloadConcurrency))
 
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/sessions", createSessionHandler)
-	http.HandleFunc("/sessions/qr", getQRHandler)
-	http.HandleFunc("/sessions/status", getStatusHandler)
-	http.HandleFunc("/sessions/delete", deleteSessionHandler)
-	http.HandleFunc("/sessions/save", saveSessionHandler)
-	http.HandleFunc("/chats", getChatsHandler)
-	http.HandleFunc("/groups/info", getGroupInfoHandler)
-	http.HandleFunc("/groups/participants", listGroupParticipantsHandler)
-	http.HandleFunc("/messages/send", sendMessageHandler)
-	http.HandleFunc("/messages/typing", setTypingHandler)
-	http.HandleFunc("/messages/react", sendReactionHandler)
-	http.HandleFunc("/messages/image", sendImageHandler)
-	http.HandleFunc("/messages/audio", sendAudioHandler)
-	http.HandleFunc("/messages/document", sendDocumentHandler)
-	http.HandleFunc("/messages/location", sendLocationHandler)
-	http.HandleFunc("/media/download", downloadMediaHandler)
-	http.HandleFunc("/events", eventsHandler)
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		configFile = &configWatcher{path: path}
+		cfg, err := configFile.reload()
+		if err != nil {
+			log.Fatalf("Failed to load config %s: %v", path, err)
+		}
+		log.Printf("⚙️  Loaded config from %s (%d command rules)", path, len(cfg.Commands.Rules))
+		go configFile.run(durationFromEnv("CONFIG_RELOAD_INTERVAL", defaultConfigReloadInterval))
+	}
+
+	handler := newRouter(
+		durationFromEnv("STATUS_TIMEOUT", defaultStatusTimeout),
+		durationFromEnv("REQUEST_TIMEOUT", defaultRequestTimeout),
+		durationFromEnv("MEDIA_TIMEOUT", defaultMediaTimeout),
+	)
+
+	go manager.runWatchdog(watchdogTimeoutFromEnv())
+	go manager.runRetention(retentionInterval)
+	if canary != nil {
+		go canary.run(manager)
+	}
 
 	log.Printf("🚀 WhatsApp server starting on port %s", port)
-	log.Printf("📁 Data directory: %s", dataDir)
+	log.Printf("📁 Data directory: %s (%s storage)", dataDir, storage.Name())
 	if joBotURL != "" {
 		log.Printf("🔗 Jo Bot URL: %s", joBotURL)
 	}
@@ -1796,7 +2238,87 @@ func main() {
 		log.Printf("🔐 Session persistence enabled")
 	}
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// newRouter builds the API with its middleware. The timeouts are the deadlines of each
+// endpoint class; event streams and probes don't get one.
+func newRouter(statusTimeout, requestTimeout, mediaTimeout time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/admin/reload", withTimeout(statusTimeout, reloadConfigHandler))
+	mux.HandleFunc("/admin/approvals", withTimeout(statusTimeout, listApprovalsHandler))
+	mux.HandleFunc("/admin/approvals/approve", withTimeout(requestTimeout, approveSendHandler))
+	mux.HandleFunc("/admin/approvals/reject", withTimeout(statusTimeout, rejectSendHandler))
+	mux.HandleFunc("/sessions", withTimeout(requestTimeout, createSessionHandler))
+	mux.HandleFunc("/sessions/qr", getQRHandler)
+	mux.HandleFunc("/sessions/qr/cancel", withTimeout(requestTimeout, cancelQRHandler))
+	mux.HandleFunc("/sessions/pair-code", withTimeout(requestTimeout, pairCodeHandler))
+	mux.HandleFunc("/sessions/status", withTimeout(statusTimeout, getStatusHandler))
+	mux.HandleFunc("/sessions/delete", withTimeout(requestTimeout, deleteSessionHandler))
+	mux.HandleFunc("/sessions/save", withTimeout(requestTimeout, saveSessionHandler))
+	mux.HandleFunc("/sessions/transfer", withTimeout(requestTimeout, transferSessionHandler))
+	mux.HandleFunc("/sessions/logout", withTimeout(requestTimeout, logoutSessionHandler))
+	mux.HandleFunc("/sessions/webhook", withTimeout(statusTimeout, webhookHandler))
+	mux.HandleFunc("/sessions/away", withTimeout(statusTimeout, awayHandler))
+	mux.HandleFunc("/sessions/auto-react", withTimeout(statusTimeout, autoReactHandler))
+	mux.HandleFunc("/sessions/translation", withTimeout(statusTimeout, translationHandler))
+	mux.HandleFunc("/sessions/time-format", withTimeout(statusTimeout, timeFormatHandler))
+	mux.HandleFunc("/sessions/redaction", withTimeout(statusTimeout, redactionHandler))
+	mux.HandleFunc("/sessions/chat-access", withTimeout(statusTimeout, chatAccessHandler))
+	mux.HandleFunc("/sessions/approval", withTimeout(statusTimeout, approvalSettingHandler))
+	mux.HandleFunc("/sessions/retention", withTimeout(statusTimeout, retentionHandler))
+	mux.HandleFunc("/chats", withTimeout(statusTimeout, getChatsHandler))
+	mux.HandleFunc("/chats/settings", withTimeout(statusTimeout, getChatSettingsHandler))
+	mux.HandleFunc("/chats/legal-hold", withTimeout(statusTimeout, legalHoldHandler))
+	mux.HandleFunc("/labels", withTimeout(statusTimeout, labelsHandler))
+	mux.HandleFunc("/labels/assign", withTimeout(requestTimeout, assignLabelHandler))
+	mux.HandleFunc("/chats/history-request", withTimeout(requestTimeout, historyRequestHandler))
+	mux.HandleFunc("GET /chats/{jid}/messages", withTimeout(statusTimeout, chatMessagesHandler))
+	mux.HandleFunc("/contacts/avatar", withTimeout(requestTimeout, contactAvatarHandler))
+	mux.HandleFunc("/contacts/check", withTimeout(requestTimeout, checkContactsHandler))
+	mux.HandleFunc("/contacts/blocklist", withTimeout(requestTimeout, getBlocklistHandler))
+	mux.HandleFunc("/contacts/block", withTimeout(requestTimeout, blockContactHandler))
+	mux.HandleFunc("/contacts/unblock", withTimeout(requestTimeout, unblockContactHandler))
+	mux.HandleFunc("/business/catalog", withTimeout(requestTimeout, businessCatalogHandler))
+	mux.HandleFunc("/business/product", withTimeout(requestTimeout, businessProductHandler))
+	mux.HandleFunc("/groups/info", withTimeout(statusTimeout, getGroupInfoHandler))
+	mux.HandleFunc("/groups/participants", withTimeout(statusTimeout, listGroupParticipantsHandler))
+	mux.HandleFunc("/groups/participants/update", withTimeout(requestTimeout, updateGroupParticipantsHandler))
+	mux.HandleFunc("/groups/invite-link", withTimeout(requestTimeout, groupInviteLinkHandler))
+	mux.HandleFunc("/groups/invite-link/reset", withTimeout(requestTimeout, resetGroupInviteLinkHandler))
+	mux.HandleFunc("/groups/invite-info", withTimeout(requestTimeout, groupInviteInfoHandler))
+	mux.HandleFunc("/groups/join", withTimeout(requestTimeout, joinGroupHandler))
+	mux.HandleFunc("/groups/update", withTimeout(requestTimeout, updateGroupHandler))
+	mux.HandleFunc("/groups/photo", withTimeout(requestTimeout, groupPhotoHandler))
+	mux.HandleFunc("/profile/photo", withTimeout(requestTimeout, uploadLimiter.wrap(profilePhotoHandler)))
+	mux.HandleFunc("/profile/about", withTimeout(requestTimeout, profileAboutHandler))
+	mux.HandleFunc("/messages", withTimeout(statusTimeout, getMessagesHandler))
+	mux.HandleFunc("/messages/send", withTimeout(requestTimeout, sendMessageHandler))
+	mux.HandleFunc("/messages/product", withTimeout(requestTimeout, sendProductHandler))
+	mux.HandleFunc("/messages/typing", withTimeout(requestTimeout, setTypingHandler))
+	mux.HandleFunc("/presence/subscribe", withTimeout(requestTimeout, subscribePresenceHandler))
+	mux.HandleFunc("/presence/set", withTimeout(requestTimeout, setPresenceHandler))
+	mux.HandleFunc("/messages/react", withTimeout(requestTimeout, sendReactionHandler))
+	mux.HandleFunc("/messages/poll", withTimeout(requestTimeout, sendPollHandler))
+	mux.HandleFunc("/messages/revoke", withTimeout(requestTimeout, revokeMessageHandler))
+	mux.HandleFunc("/messages/forward", withTimeout(requestTimeout, forwardMessageHandler))
+	mux.HandleFunc("/messages/read", withTimeout(requestTimeout, markReadHandler))
+	mux.HandleFunc("/messages/image", withTimeout(mediaTimeout, uploadLimiter.wrap(sendImageHandler)))
+	mux.HandleFunc("/messages/video", withTimeout(mediaTimeout, uploadLimiter.wrap(sendVideoHandler)))
+	mux.HandleFunc("/messages/audio", withTimeout(mediaTimeout, uploadLimiter.wrap(sendAudioHandler)))
+	mux.HandleFunc("/messages/document", withTimeout(mediaTimeout, uploadLimiter.wrap(sendDocumentHandler)))
+	mux.HandleFunc("/messages/sticker", withTimeout(mediaTimeout, uploadLimiter.wrap(sendStickerHandler)))
+	mux.HandleFunc("/messages/location", withTimeout(requestTimeout, sendLocationHandler))
+	mux.HandleFunc("/status/post", withTimeout(mediaTimeout, uploadLimiter.wrap(postStatusHandler)))
+	mux.HandleFunc("/media/download", withTimeout(mediaTimeout, downloadLimiter.wrap(downloadMediaHandler)))
+	mux.HandleFunc("/media/quoted", withTimeout(mediaTimeout, downloadLimiter.wrap(quotedMediaHandler)))
+	mux.HandleFunc("/events", eventsHandler)
+	mux.HandleFunc("/ws", wsHandler)
+
+	return requestIDMiddleware(corsMiddleware(corsFromEnv(), compressionMiddleware(mux)))
+}
@@ -16,7 +16,7 @@ import (
 )
 
 // Test helper: create a session manager with a mock client injected
-func setupTestManager(t *testing.T) *SessionManager {
+func setupTestManager(t testing.TB) *SessionManager {
 	t.Helper()
 	return NewSessionManager(t.TempDir(), "", "")
 }
@@ -26,14 +26,16 @@ func injectMockSession(m *SessionManager, userID int, client *MockWhatsAppClient
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	session := &UserSession{
-		UserID:     userID,
-		Client:     client,
-		DBPath:     "",
-		LastUsed:   time.Now(),
-		QRChannel:  make(chan string, 10),
-		LoginDone:  make(chan bool, 1),
-		EventChan:  make(chan MessageEvent, 100),
-		MediaCache: make(map[string][]byte),
+		UserID:      userID,
+		Client:      client,
+		DBPath:      "",
+		LastUsed:    time.Now(),
+		QRChannel:   make(chan string, 10),
+		LoginDone:   make(chan bool, 1),
+		QRExpired:   make(chan struct{}, 1),
+		QRCancelled: make(chan struct{}, 1),
+		EventChan:   make(chan MessageEvent, 100),
+		MediaCache:  make(map[string][]byte),
 	}
 	m.sessions[userID] = session
 	return session
@@ -346,6 +348,35 @@ func TestGetStatusHandler(t *testing.T) {
 		if resp["phone"] != "1234567890" {
 			t.Errorf("expected phone '1234567890', got %v", resp["phone"])
 		}
+		if _, ok := resp["connection_history"]; ok {
+			t.Error("expected no connection_history without detail=true")
+		}
+	})
+
+	t.Run("includes connection history with detail=true", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(manager, 301, mock)
+		session.handleEvent(&events.Connected{})
+		session.handleEvent(&events.Disconnected{})
+
+		req := httptest.NewRequest(http.MethodGet, "/sessions/status?user_id=301&detail=true", nil)
+		w := httptest.NewRecorder()
+		getStatusHandler(w, req)
+
+		var resp struct {
+			ConnectionHistory []ConnectionEvent `json:"connection_history"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if len(resp.ConnectionHistory) != 2 {
+			t.Fatalf("expected 2 history entries, got %d", len(resp.ConnectionHistory))
+		}
+		if resp.ConnectionHistory[0].State != ConnStateConnected {
+			t.Errorf("expected first state %q, got %q", ConnStateConnected, resp.ConnectionHistory[0].State)
+		}
+		if resp.ConnectionHistory[1].State != ConnStateDisconnected {
+			t.Errorf("expected second state %q, got %q", ConnStateDisconnected, resp.ConnectionHistory[1].State)
+		}
 	})
 }
 
@@ -410,17 +441,6 @@ func TestGetQRHandler(t *testing.T) {
 			t.Errorf("expected 400, got %d", w.Code)
 		}
 	})
-
-	t.Run("returns 404 for unknown session", func(t *testing.T) {
-		manager = setupTestManager(t)
-		req := httptest.NewRequest(http.MethodGet, "/sessions/qr?user_id=99999", nil)
-		w := httptest.NewRecorder()
-		getQRHandler(w, req)
-
-		if w.Code != http.StatusNotFound {
-			t.Errorf("expected 404, got %d", w.Code)
-		}
-	})
 }
 
 func TestSaveSessionHandler(t *testing.T) {
@@ -848,9 +868,12 @@ func TestSendImageHandler(t *testing.T) {
 			t.Errorf("expected 200, got %d", w.Code)
 		}
 
-		uploadCalls := mock.GetCallsByMethod("Upload")
+		uploadCalls := mock.GetCallsByMethod("UploadReader")
 		if len(uploadCalls) != 1 {
-			t.Errorf("expected 1 Upload call, got %d", len(uploadCalls))
+			t.Fatalf("expected 1 UploadReader call, got %d", len(uploadCalls))
+		}
+		if string(uploadCalls[0].Args[1].([]byte)) != "fake-image-data" {
+			t.Errorf("expected decoded image bytes to be uploaded, got %q", uploadCalls[0].Args[1])
 		}
 
 		sendCalls := mock.GetCallsByMethod("SendMessage")
@@ -859,6 +882,49 @@ func TestSendImageHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("corrects mismatched mime type", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(manager, 904, mock)
+
+		pngData := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+		body := `{"user_id": 904, "chat_jid": "1234567890@s.whatsapp.net", "image_b64": "` + pngData + `", "mime_type": "image/jpeg"}`
+		req := httptest.NewRequest(http.MethodPost, "/messages/image", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		sendImageHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		sendCalls := mock.GetCallsByMethod("SendMessage")
+		if len(sendCalls) != 1 {
+			t.Fatalf("expected 1 SendMessage call, got %d", len(sendCalls))
+		}
+		msg := sendCalls[0].Args[2].(*waE2E.Message)
+		if got := msg.GetImageMessage().GetMimetype(); got != "image/png" {
+			t.Errorf("expected mimetype corrected to image/png, got %q", got)
+		}
+	})
+
+	t.Run("rejects content that is not an image", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(manager, 905, mock)
+
+		pdfData := base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n%fake"))
+		body := `{"user_id": 905, "chat_jid": "1234567890@s.whatsapp.net", "image_b64": "` + pdfData + `", "mime_type": "image/jpeg"}`
+		req := httptest.NewRequest(http.MethodPost, "/messages/image", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		sendImageHandler(w, req)
+
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415, got %d", w.Code)
+		}
+		if len(mock.GetCallsByMethod("UploadReader")) != 0 {
+			t.Error("expected no upload for rejected content")
+		}
+	})
+
 	t.Run("handles upload error", func(t *testing.T) {
 		manager = setupTestManager(t)
 		mock := NewLoggedInMockClient()
@@ -1419,6 +1485,7 @@ func TestUserSession_handleEvent(t *testing.T) {
 	ptr := func(s string) *string { return &s }
 	ptrF := func(f float64) *float64 { return &f }
 	ptrU := func(u uint64) *uint64 { return &u }
+	ptrB := func(b bool) *bool { return &b }
 
 	// Helper to create MessageInfo with embedded MessageSource
 	makeInfo := func(id string) types.MessageInfo {
@@ -1532,6 +1599,83 @@ func TestUserSession_handleEvent(t *testing.T) {
 		}
 	})
 
+	t.Run("handles video message", func(t *testing.T) {
+		session := makeTestSession()
+
+		evt := &events.Message{
+			Info: makeInfo("msg-video"),
+			Message: &waE2E.Message{
+				VideoMessage: &waE2E.VideoMessage{
+					Caption:    ptr("Clip"),
+					Mimetype:   ptr("video/mp4"),
+					DirectPath: ptr("/v/media/456"),
+					FileLength: ptrU(5 << 20),
+				},
+			},
+		}
+
+		session.handleEvent(evt)
+
+		msg := <-session.EventChan
+		payload := msg.Payload.(MessagePayload)
+		if payload.MediaType != "video" {
+			t.Errorf("expected media_type 'video', got %q", payload.MediaType)
+		}
+		if payload.Caption != "Clip" || payload.FileLength != 5<<20 {
+			t.Errorf("unexpected payload: %+v", payload)
+		}
+	})
+
+	t.Run("handles document message", func(t *testing.T) {
+		session := makeTestSession()
+
+		evt := &events.Message{
+			Info: makeInfo("msg-doc"),
+			Message: &waE2E.Message{
+				DocumentMessage: &waE2E.DocumentMessage{
+					Mimetype: ptr("application/pdf"),
+					FileName: ptr("report.pdf"),
+				},
+			},
+		}
+
+		session.handleEvent(evt)
+
+		msg := <-session.EventChan
+		payload := msg.Payload.(MessagePayload)
+		if payload.MediaType != "document" {
+			t.Errorf("expected media_type 'document', got %q", payload.MediaType)
+		}
+		if payload.FileName != "report.pdf" {
+			t.Errorf("expected file_name 'report.pdf', got %q", payload.FileName)
+		}
+	})
+
+	t.Run("marks animated sticker", func(t *testing.T) {
+		session := makeTestSession()
+
+		evt := &events.Message{
+			Info: makeInfo("msg-sticker"),
+			Message: &waE2E.Message{
+				StickerMessage: &waE2E.StickerMessage{
+					Mimetype:   ptr("image/webp"),
+					IsAnimated: ptrB(true),
+				},
+			},
+		}
+
+		session.handleEvent(evt)
+
+		msg := <-session.EventChan
+		payload := msg.Payload.(MessagePayload)
+		if payload.MediaType != "sticker" {
+			t.Errorf("expected media_type 'sticker', got %q", payload.MediaType)
+		}
+		if !payload.IsAnimated {
+			t.Error("expected is_animated to be set")
+		}
+	})
+
 	t.Run("handles location message", func(t *testing.T) {
 		session := makeTestSession()
 
@@ -1634,6 +1778,9 @@ func TestUserSession_handleEvent(t *testing.T) {
 		if payload.ContactName != "Jane Doe" {
 			t.Errorf("expected contact_name 'Jane Doe', got %q", payload.ContactName)
 		}
+		if payload.Contact == nil || payload.Contact.Name != "Jane Doe" {
+			t.Errorf("expected parsed contact named 'Jane Doe', got %+v", payload.Contact)
+		}
 	})
 
 	t.Run("handles contacts array message", func(t *testing.T) {
@@ -1723,6 +1870,33 @@ func TestUserSession_handleEvent(t *testing.T) {
 	})
 }
 
+func TestUserSession_cacheMedia(t *testing.T) {
+	prev := mediaCacheMaxBytes
+	mediaCacheMaxBytes = 8
+	t.Cleanup(func() { mediaCacheMaxBytes = prev })
+	mock := NewLoggedInMockClient()
+	session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10), MediaCache: make(map[string][]byte)}
+	doc := &waE2E.DocumentMessage{}
+
+	mock.DownloadData = []byte("small")
+	session.cacheMedia("M1", "15551234567@s.whatsapp.net", "document", doc, 5)
+	if string(session.MediaCache["M1"]) != "small" {
+		t.Error("expected media under the limit to be cached")
+	}
+
+	session.cacheMedia("M2", "15551234567@s.whatsapp.net", "document", doc, 1<<20)
+	if len(mock.GetCallsByMethod("Download")) != 1 {
+		t.Error("expected media over the limit not to be downloaded")
+	}
+
+	// An unknown length is checked once downloaded
+	mock.DownloadData = []byte("much too large")
+	session.cacheMedia("M3", "15551234567@s.whatsapp.net", "document", doc, 0)
+	if _, ok := session.MediaCache["M3"]; ok {
+		t.Error("expected media found to be over the limit not to be cached")
+	}
+}
+
 // ==================== Mock Client Tests ====================
 
 func TestMockClient(t *testing.T) {
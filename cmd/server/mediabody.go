@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+var (
+	errInvalidJSON   = errors.New("invalid json")
+	errInvalidBase64 = errors.New("invalid base64")
+	errMediaTooLarge = errors.New("media too large")
+)
+
+// maxMediaFieldsSize is the room a media request has for the fields beside the media
+const maxMediaFieldsSize = 64 << 10
+
+// spooledMedia is base64 media from a request body, decoded into a temp file
+type spooledMedia struct {
+	File *os.File
+	Size int64
+	max  int64
+}
+
+// Reader rewinds the temp file and returns it for reading from the start
+func (m *spooledMedia) Reader() (io.Reader, error) {
+	if _, err := m.File.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return m.File, nil
+}
+
+// Bytes reads the whole decoded file into memory, for the few callers that need a slice
+func (m *spooledMedia) Bytes() ([]byte, error) {
+	r, err := m.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Close removes the temp file
+func (m *spooledMedia) Close() {
+	m.File.Close()
+	os.Remove(m.File.Name())
+}
+
+// decodeMediaRequest decodes the JSON object in body into req, except for b64Field whose
+// base64 string value is decoded straight into a temp file as it streams in. This avoids
+// holding both the base64 string and the decoded bytes of large media in memory.
+// Media over maxSize bytes, or a body too long to hold it, fails with errMediaTooLarge
+// as soon as the limit is passed. The returned media is never nil on success and must
+// be closed by the caller.
+func decodeMediaRequest(body io.Reader, b64Field string, maxSize int64, req interface{}) (*spooledMedia, error) {
+	file, err := os.CreateTemp("", "wa_media_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	media := &spooledMedia{File: file, max: maxSize}
+
+	// base64 grows the media by a third
+	limited := &limitedBody{r: body, left: int64(base64.StdEncoding.EncodedLen(int(maxSize))) + maxMediaFieldsSize}
+	fields, err := decodeObjectSpooling(limited, b64Field, media)
+	if err != nil && limited.err != nil {
+		// The body ran out or failed; that, not the JSON it cut short, is the problem
+		err = limited.err
+	}
+	if err == nil {
+		var raw []byte
+		raw, err = json.Marshal(fields)
+		if err == nil && json.Unmarshal(raw, req) != nil {
+			err = errInvalidJSON
+		}
+	}
+	if err != nil {
+		media.Close()
+		return nil, err
+	}
+	return media, nil
+}
+
+// decodeObjectSpooling collects the top-level fields of a JSON object, spooling b64Field into media
+func decodeObjectSpooling(body io.Reader, b64Field string, media *spooledMedia) (map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(body)
+	fields := make(map[string]json.RawMessage)
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errInvalidJSON
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errInvalidJSON
+		}
+		key, _ := tok.(string)
+		if key != b64Field {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, errInvalidJSON
+			}
+			fields[key] = raw
+			continue
+		}
+
+		// The decoder has read the key but not the colon; take over the raw stream from here
+		rest := bufio.NewReader(io.MultiReader(dec.Buffered(), body))
+		if err := spoolBase64Value(rest, media); err != nil {
+			return nil, err
+		}
+
+		// Whatever follows the media value is small; re-wrap it as an object and decode it normally
+		tail, err := io.ReadAll(rest)
+		if err != nil {
+			return nil, errInvalidJSON
+		}
+		tail = bytes.TrimLeft(tail, " \t\r\n")
+		switch {
+		case len(tail) > 0 && tail[0] == '}':
+			return fields, nil
+		case len(tail) > 0 && tail[0] == ',':
+			var more map[string]json.RawMessage
+			if err := json.Unmarshal(append([]byte("{"), tail[1:]...), &more); err != nil {
+				return nil, errInvalidJSON
+			}
+			for k, v := range more {
+				if k != b64Field {
+					fields[k] = v
+				}
+			}
+			return fields, nil
+		default:
+			return nil, errInvalidJSON
+		}
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('}') {
+		return nil, errInvalidJSON
+	}
+	return fields, nil
+}
+
+// spoolBase64Value reads `: "<base64>"` (or `: null`) from r and writes the decoded bytes to media
+func spoolBase64Value(r *bufio.Reader, media *spooledMedia) error {
+	if b, err := readNonSpace(r); err != nil || b != ':' {
+		return errInvalidJSON
+	}
+	b, err := readNonSpace(r)
+	if err != nil {
+		return errInvalidJSON
+	}
+	if b == 'n' {
+		literal := make([]byte, 3)
+		if _, err := io.ReadFull(r, literal); err != nil || string(literal) != "ull" {
+			return errInvalidJSON
+		}
+		return nil
+	}
+	if b != '"' {
+		return errInvalidJSON
+	}
+
+	str := &jsonStringReader{r: r}
+	n, err := io.Copy(media.File, io.LimitReader(base64.NewDecoder(base64.StdEncoding, str), media.max+1))
+	media.Size = n
+	if n > media.max {
+		return errMediaTooLarge
+	}
+	if err != nil {
+		if str.err != nil {
+			return str.err
+		}
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errInvalidBase64
+		}
+		return err
+	}
+	if !str.done {
+		return errInvalidJSON
+	}
+	return nil
+}
+
+// limitedBody reads at most left bytes of a request body, failing with errMediaTooLarge
+// past that. The first error other than EOF is kept in err.
+type limitedBody struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// Only a body that goes on past the limit is too large
+		if n, err := b.r.Read(make([]byte, 1)); n == 0 {
+			if err != nil && err != io.EOF && b.err == nil {
+				b.err = err
+			}
+			return 0, err
+		}
+		b.err = errMediaTooLarge
+		return 0, b.err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func readNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, nil
+		}
+	}
+}
+
+// jsonStringReader yields the contents of a JSON string whose opening quote was already
+// consumed, stopping at the closing quote. Only the escapes that can appear in base64
+// text (\/ and line breaks) are accepted.
+type jsonStringReader struct {
+	r    *bufio.Reader
+	done bool
+	err  error
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			s.err = errInvalidJSON
+			return n, s.err
+		}
+		switch b {
+		case '"':
+			s.done = true
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		case '\\':
+			esc, err := s.r.ReadByte()
+			if err != nil {
+				s.err = errInvalidJSON
+				return n, s.err
+			}
+			switch esc {
+			case '/':
+				p[n] = '/'
+				n++
+			case 'n', 'r':
+				// Line-wrapped base64; the decoder ignores newlines anyway
+			default:
+				s.err = errInvalidBase64
+				return n, s.err
+			}
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// mediaDecodeError writes the 400 (or 413) response for a failed decodeMediaRequest
+func mediaDecodeError(w http.ResponseWriter, err error, kind string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, errMediaTooLarge), errors.As(err, &tooLarge):
+		errorResponse(w, http.StatusRequestEntityTooLarge, kind+" too large")
+	case errors.Is(err, errInvalidBase64):
+		errorResponse(w, http.StatusBadRequest, "invalid base64 "+kind)
+	case errors.Is(err, errInvalidJSON):
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+	default:
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
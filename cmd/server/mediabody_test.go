@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMediaRequest(t *testing.T) {
+	type request struct {
+		UserID   int    `json:"user_id"`
+		ChatJID  string `json:"chat_jid"`
+		MimeType string `json:"mime_type"`
+	}
+	payload := []byte("some binary \x00\x01\x02 image data")
+	b64 := base64.StdEncoding.EncodeToString(payload)
+
+	t.Run("spools media and decodes surrounding fields", func(t *testing.T) {
+		body := `{"user_id": 7, "image_b64": "` + b64 + `", "chat_jid": "123@s.whatsapp.net", "mime_type": "image/png"}`
+		var req request
+		media, err := decodeMediaRequest(strings.NewReader(body), "image_b64", maxImageSize, &req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer media.Close()
+
+		if req.UserID != 7 || req.ChatJID != "123@s.whatsapp.net" || req.MimeType != "image/png" {
+			t.Errorf("unexpected request fields: %+v", req)
+		}
+		if media.Size != int64(len(payload)) {
+			t.Errorf("expected size %d, got %d", len(payload), media.Size)
+		}
+		data, err := media.Bytes()
+		if err != nil {
+			t.Fatalf("failed to read media: %v", err)
+		}
+		if string(data) != string(payload) {
+			t.Errorf("decoded media mismatch: %q", data)
+		}
+	})
+
+	t.Run("media field last", func(t *testing.T) {
+		body := `{"user_id":7,"image_b64":"` + b64 + `"}`
+		var req request
+		media, err := decodeMediaRequest(strings.NewReader(body), "image_b64", maxImageSize, &req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer media.Close()
+		if req.UserID != 7 || media.Size != int64(len(payload)) {
+			t.Errorf("unexpected result: %+v size=%d", req, media.Size)
+		}
+	})
+
+	t.Run("accepts escaped slashes", func(t *testing.T) {
+		raw := []byte{0xff, 0xff, 0xff} // encodes to "////"
+		body := `{"image_b64": "` + strings.ReplaceAll(base64.StdEncoding.EncodeToString(raw), "/", `\/`) + `"}`
+		var req request
+		media, err := decodeMediaRequest(strings.NewReader(body), "image_b64", maxImageSize, &req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer media.Close()
+		data, _ := media.Bytes()
+		if string(data) != string(raw) {
+			t.Errorf("expected %v, got %v", raw, data)
+		}
+	})
+
+	t.Run("missing media field yields empty media", func(t *testing.T) {
+		var req request
+		media, err := decodeMediaRequest(strings.NewReader(`{"user_id": 1}`), "image_b64", maxImageSize, &req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer media.Close()
+		if media.Size != 0 || req.UserID != 1 {
+			t.Errorf("unexpected result: %+v size=%d", req, media.Size)
+		}
+	})
+
+	t.Run("rejects invalid base64", func(t *testing.T) {
+		var req request
+		_, err := decodeMediaRequest(strings.NewReader(`{"image_b64": "not-valid-base64!!!"}`), "image_b64", maxImageSize, &req)
+		if !errors.Is(err, errInvalidBase64) {
+			t.Errorf("expected errInvalidBase64, got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid json", func(t *testing.T) {
+		for _, body := range []string{"bad", `{"user_id": 1,`, `{"image_b64": "` + b64, `{"image_b64": "` + b64 + `" "x"}`} {
+			var req request
+			_, err := decodeMediaRequest(strings.NewReader(body), "image_b64", maxImageSize, &req)
+			if !errors.Is(err, errInvalidJSON) {
+				t.Errorf("body %q: expected errInvalidJSON, got %v", body, err)
+			}
+		}
+	})
+
+	t.Run("stops at the size limit", func(t *testing.T) {
+		var req request
+		body := `{"image_b64": "` + b64 + `"}`
+		if _, err := decodeMediaRequest(strings.NewReader(body), "image_b64", int64(len(payload)-1), &req); !errors.Is(err, errMediaTooLarge) {
+			t.Errorf("expected errMediaTooLarge for oversized media, got %v", err)
+		}
+		media, err := decodeMediaRequest(strings.NewReader(body), "image_b64", int64(len(payload)), &req)
+		if err != nil {
+			t.Fatalf("expected media at the limit to be taken, got %v", err)
+		}
+		media.Close()
+
+		// Nor can the other fields grow without bound
+		fields := `{"caption": "` + strings.Repeat("x", maxMediaFieldsSize) + `", "image_b64": "` + b64 + `"}`
+		if _, err := decodeMediaRequest(strings.NewReader(fields), "image_b64", int64(len(payload)), &req); !errors.Is(err, errMediaTooLarge) {
+			t.Errorf("expected errMediaTooLarge for oversized fields, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how many leading bytes are inspected to detect the media type
+const sniffLen = 512
+
+// sniffMimeType detects the media type from magic numbers. It extends http.DetectContentType
+// with the audio/video containers WhatsApp uses that the standard library doesn't know.
+// An empty string means the type couldn't be determined.
+func sniffMimeType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(head, []byte("#!AMR")):
+		return "audio/amr"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		brand := string(head[8:12])
+		switch {
+		case brand == "M4A " || brand == "M4B ":
+			return "audio/mp4"
+		case strings.HasPrefix(brand, "3gp"):
+			return "video/3gpp"
+		case brand == "qt  ":
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(head, []byte{0xFF, 0xF1}) || bytes.HasPrefix(head, []byte{0xFF, 0xF9}):
+		return "audio/aac"
+	}
+
+	detected := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(detected, "text/plain"), detected == "application/octet-stream":
+		return ""
+	case detected == "application/ogg":
+		return "audio/ogg"
+	}
+	mediaType, _, _ := mime.ParseMediaType(detected)
+	return mediaType
+}
+
+// mimeAllowlist holds the MEDIA_ALLOWED_TYPES patterns, e.g. "image/*,audio/*,application/pdf".
+// An empty allowlist permits every type.
+var mimeAllowlist = parseMimeAllowlist(os.Getenv("MEDIA_ALLOWED_TYPES"))
+
+func parseMimeAllowlist(value string) []string {
+	var patterns []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func mimeAllowed(allowlist []string, mimeType string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	base, _, _ := mime.ParseMediaType(mimeType)
+	for _, pattern := range allowlist {
+		if pattern == base || pattern == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(base, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MediaTypeError describes content that can't be sent as the requested media kind
+type MediaTypeError struct {
+	Status  int
+	Message string
+}
+
+func (e *MediaTypeError) Error() string {
+	return e.Message
+}
+
+// resolveMimeType checks the sniffed type of head against the declared mime type for an
+// upload of the given family ("image", "audio", "video", or "" for documents).
+// It returns the mime type to put in the message, correcting the declared one when the
+// bytes are clearly something else, or a *MediaTypeError if the content must be rejected.
+func resolveMimeType(declared string, head []byte, family string) (string, error) {
+	sniffed := sniffMimeType(head)
+	if audio, ok := audioContainers[sniffed]; ok && family == "audio" {
+		// The brand of an MP4 or 3GP file doesn't say whether it holds any video
+		sniffed = audio
+	}
+	declaredBase, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		declaredBase = ""
+	}
+
+	resolved := declared
+	switch {
+	case sniffed == "":
+		// Unknown content; trust the caller
+	case declaredBase == "":
+		resolved = sniffed
+	case refinesMimeType(declaredBase, sniffed):
+		// The declared type is a more specific format inside the sniffed container
+		sniffed = canonicalMimeType(declaredBase)
+	case declaredBase != sniffed && !equivalentMimeTypes(declaredBase, sniffed):
+		log.Printf("[media/type] Declared %q but content looks like %q, correcting", declared, sniffed)
+		resolved = sniffed
+	}
+
+	if family != "" {
+		if sniffed != "" && !strings.HasPrefix(sniffed, family+"/") {
+			return "", &MediaTypeError{
+				Status:  http.StatusUnsupportedMediaType,
+				Message: fmt.Sprintf("content is %s, not %s", sniffed, family),
+			}
+		}
+		if resolved == "" {
+			return "", &MediaTypeError{
+				Status:  http.StatusBadRequest,
+				Message: "mime_type required: could not detect " + family + " type",
+			}
+		}
+	}
+	if resolved == "" {
+		resolved = "application/octet-stream"
+	}
+
+	if !mimeAllowed(mimeAllowlist, resolved) {
+		return "", &MediaTypeError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: "media type " + resolved + " is not allowed",
+		}
+	}
+	return resolved, nil
+}
+
+// mimeAliases maps non-canonical names clients commonly send to the type sniffMimeType reports
+var mimeAliases = map[string]string{
+	"image/jpg":   "image/jpeg",
+	"audio/mp3":   "audio/mpeg",
+	"audio/x-m4a": "audio/mp4",
+	"audio/m4a":   "audio/mp4",
+	"audio/opus":  "audio/ogg",
+	"audio/wav":   "audio/wave",
+	"audio/x-wav": "audio/wave",
+	"video/mpeg4": "video/mp4",
+}
+
+func canonicalMimeType(t string) string {
+	if c, ok := mimeAliases[t]; ok {
+		return c
+	}
+	return t
+}
+
+// equivalentMimeTypes treats aliases that describe the same container as a match
+func equivalentMimeTypes(a, b string) bool {
+	return canonicalMimeType(a) == canonicalMimeType(b)
+}
+
+// audioContainers maps the ISO media containers sniffed as video to their audio-only form
+var audioContainers = map[string]string{
+	"video/mp4":  "audio/mp4",
+	"video/3gpp": "audio/3gpp",
+}
+
+// zipFormats are zip archives with a type of their own that magic numbers can't tell apart
+var zipFormats = map[string]bool{
+	"application/vnd.android.package-archive": true,
+	"application/java-archive":                true,
+	"application/x-zip-compressed":            true,
+}
+
+// refinesMimeType reports whether declared is a specific format stored in the sniffed
+// container, such as a .docx in a zip or an .m4a in an MP4, and so is no mismatch
+func refinesMimeType(declared, sniffed string) bool {
+	declared = canonicalMimeType(declared)
+	switch sniffed {
+	case "application/zip":
+		return zipFormats[declared] || strings.HasSuffix(declared, "+zip") ||
+			strings.HasPrefix(declared, "application/vnd.openxmlformats-officedocument.") ||
+			strings.HasPrefix(declared, "application/vnd.oasis.opendocument.")
+	case "video/mp4", "video/3gpp":
+		return declared == audioContainers[sniffed]
+	}
+	return false
+}
+
+// Head returns up to sniffLen leading bytes of the media
+func (m *spooledMedia) Head() ([]byte, error) {
+	r, err := m.Reader()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// mediaTypeFor sniffs spooled media and resolves the mime type, writing an error response on failure
+func mediaTypeFor(w http.ResponseWriter, media *spooledMedia, declared, family string) (string, bool) {
+	head, err := media.Head()
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	resolved, err := resolveMimeType(declared, head, family)
+	if err != nil {
+		if typeErr, ok := err.(*MediaTypeError); ok {
+			errorResponse(w, typeErr.Status, typeErr.Message)
+		} else {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+		}
+		return "", false
+	}
+	return resolved, true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+var (
+	jpegHead = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	pngHead  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	oggHead  = []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00OpusHead")
+	mp4Head  = []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00")
+	m4aHead  = []byte("\x00\x00\x00\x18ftypM4A \x00\x00\x00\x00")
+	pdfHead  = []byte("%PDF-1.7\n")
+	isomHead = []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00")
+	movHead  = []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00")
+	zipHead  = []byte("PK\x03\x04\x14\x00\x06\x00")
+)
+
+func TestSniffMimeType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", jpegHead, "image/jpeg"},
+		{"png", pngHead, "image/png"},
+		{"ogg opus", oggHead, "audio/ogg"},
+		{"mp4 video", mp4Head, "video/mp4"},
+		{"m4a audio", m4aHead, "audio/mp4"},
+		{"amr", []byte("#!AMR\n"), "audio/amr"},
+		{"pdf", pdfHead, "application/pdf"},
+		{"plain text is unknown", []byte("hello world"), ""},
+		{"empty is unknown", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffMimeType(tt.head); got != tt.want {
+				t.Errorf("sniffMimeType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveMimeType(t *testing.T) {
+	tests := []struct {
+		name       string
+		declared   string
+		head       []byte
+		family     string
+		want       string
+		wantStatus int
+	}{
+		{"matching type kept", "image/jpeg", jpegHead, "image", "image/jpeg", 0},
+		{"alias kept", "image/jpg", jpegHead, "image", "image/jpg", 0},
+		{"codec parameters kept", "audio/ogg; codecs=opus", oggHead, "audio", "audio/ogg; codecs=opus", 0},
+		{"wrong image type corrected", "image/jpeg", pngHead, "image", "image/png", 0},
+		{"missing type filled in", "", pdfHead, "", "application/pdf", 0},
+		{"unknown content trusts caller", "text/csv", []byte("a,b\n1,2\n"), "", "text/csv", 0},
+		{"unknown document defaults", "", []byte("a,b\n1,2\n"), "", "application/octet-stream", 0},
+		{"document wins over wrong declared", "application/zip", pdfHead, "", "application/pdf", 0},
+		{"pdf sent as image rejected", "image/jpeg", pdfHead, "image", "", http.StatusUnsupportedMediaType},
+		{"docx in zip kept", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", zipHead, "",
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document", 0},
+		{"epub in zip kept", "application/epub+zip", zipHead, "", "application/epub+zip", 0},
+		{"wrong document type over zip corrected", "application/pdf", zipHead, "", "application/zip", 0},
+		{"m4a with generic brand kept", "audio/mp4", isomHead, "audio", "audio/mp4", 0},
+		{"m4a alias with generic brand kept", "audio/x-m4a", isomHead, "audio", "audio/x-m4a", 0},
+		{"undeclared mp4 sent as audio", "", isomHead, "audio", "audio/mp4", 0},
+		{"m4a sent as video rejected", "video/mp4", m4aHead, "video", "", http.StatusUnsupportedMediaType},
+		{"quicktime sent as audio rejected", "audio/mp4", movHead, "audio", "", http.StatusUnsupportedMediaType},
+		{"undetectable image without type rejected", "", []byte("???"), "image", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveMimeType(tt.declared, tt.head, tt.family)
+			if tt.wantStatus != 0 {
+				var typeErr *MediaTypeError
+				if !errors.As(err, &typeErr) {
+					t.Fatalf("expected MediaTypeError, got %v", err)
+				}
+				if typeErr.Status != tt.wantStatus {
+					t.Errorf("status = %d, want %d", typeErr.Status, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveMimeType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveMimeType_Allowlist(t *testing.T) {
+	original := mimeAllowlist
+	defer func() { mimeAllowlist = original }()
+	mimeAllowlist = parseMimeAllowlist(" image/*, application/pdf ,")
+
+	if _, err := resolveMimeType("image/png", pngHead, "image"); err != nil {
+		t.Errorf("expected image/png allowed by wildcard, got %v", err)
+	}
+	if _, err := resolveMimeType("application/pdf", pdfHead, ""); err != nil {
+		t.Errorf("expected application/pdf allowed, got %v", err)
+	}
+
+	_, err := resolveMimeType("audio/ogg", oggHead, "audio")
+	var typeErr *MediaTypeError
+	if !errors.As(err, &typeErr) || typeErr.Status != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for audio/ogg, got %v", err)
+	}
+
+	// The allowlist applies to the corrected type, not the declared one
+	_, err = resolveMimeType("image/jpeg", pdfHead, "")
+	if err != nil {
+		t.Errorf("expected corrected application/pdf to be allowed, got %v", err)
+	}
+}
+
+func TestMimeAllowed_EmptyAllowsAll(t *testing.T) {
+	if !mimeAllowed(nil, "application/x-anything") {
+		t.Error("expected empty allowlist to allow every type")
+	}
+}
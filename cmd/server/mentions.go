@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+var errMentionsNeedGroup = errors.New("mentions need a group chat")
+
+// MentionError lists mentioned JIDs that aren't members of the group, or aren't JIDs
+type MentionError struct {
+	Invalid         []string
+	NotParticipants []string
+}
+
+func (e *MentionError) Error() string {
+	if len(e.Invalid) > 0 {
+		return fmt.Sprintf("invalid mentions: %v", e.Invalid)
+	}
+	return fmt.Sprintf("not group participants: %v", e.NotParticipants)
+}
+
+// groupMentions checks that every mentioned JID is a participant of group and returns
+// them as they go in ContextInfo.MentionedJID, without duplicates
+func (s *UserSession) groupMentions(ctx context.Context, group types.JID, mentions []string) ([]string, error) {
+	if group.Server != types.GroupServer {
+		return nil, errMentionsNeedGroup
+	}
+	var bad MentionError
+	jids := make([]types.JID, 0, len(mentions))
+	for _, raw := range mentions {
+		jid, err := types.ParseJID(raw)
+		if err != nil || jid.User == "" || jid.Server == "" {
+			bad.Invalid = append(bad.Invalid, raw)
+			continue
+		}
+		jids = append(jids, jid.ToNonAD())
+	}
+	if len(bad.Invalid) > 0 {
+		return nil, &bad
+	}
+
+	participants, _, err := s.groupParticipants(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(participants))
+	for _, p := range participants {
+		members[p.JID] = true
+	}
+	isMember := func(jid types.JID) bool {
+		if members[jid.String()] {
+			return true
+		}
+		// Groups list members by phone number or by LID; either address names them
+		alt := s.altJID(jid)
+		return !alt.IsEmpty() && members[alt.String()]
+	}
+	refreshed := false
+	mentioned := make([]string, 0, len(jids))
+	seen := make(map[string]bool)
+	for _, jid := range jids {
+		key := jid.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !isMember(jid) && !refreshed {
+			// The cached list may predate the member joining; fetch it once more
+			refreshed = true
+			if info, err := s.Client.GetGroupInfo(ctx, group); err != nil {
+				log.Printf("[mentions] User %d: failed to refresh %s: %v", s.UserID, group, err)
+			} else {
+				s.refreshGroup(group, info)
+				for _, p := range info.Participants {
+					for _, addr := range []types.JID{p.JID, p.PhoneNumber, p.LID} {
+						if !addr.IsEmpty() {
+							members[addr.ToNonAD().String()] = true
+						}
+					}
+				}
+			}
+		}
+		if !isMember(jid) {
+			bad.NotParticipants = append(bad.NotParticipants, key)
+			continue
+		}
+		mentioned = append(mentioned, key)
+	}
+	if len(bad.NotParticipants) > 0 {
+		return nil, &bad
+	}
+	return mentioned, nil
+}
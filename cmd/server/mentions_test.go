@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestSendMessageHandler_Mentions(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.GroupInfo = &types.GroupInfo{Participants: []types.GroupParticipant{
+		{JID: types.NewJID("15551112222", types.DefaultUserServer)},
+		{JID: types.NewJID("15553334444", types.DefaultUserServer)},
+	}}
+	injectMockSession(manager, 1, mock)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := send(`{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "@15551112222 @15553334444 standup", "mentions": ["15551112222@s.whatsapp.net", "15553334444:2@s.whatsapp.net", "15551112222@s.whatsapp.net"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	sent := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message)
+	mentioned := sent.GetExtendedTextMessage().GetContextInfo().GetMentionedJID()
+	if len(mentioned) != 2 || mentioned[0] != "15551112222@s.whatsapp.net" || mentioned[1] != "15553334444@s.whatsapp.net" {
+		t.Errorf("expected both participants mentioned once, got %v", mentioned)
+	}
+	// The participants were fetched once and then cached
+	send(`{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "@15551112222", "mentions": ["15551112222@s.whatsapp.net"]}`)
+	if calls := mock.GetCallsByMethod("GetGroupInfo"); len(calls) != 1 {
+		t.Errorf("expected one group info fetch, got %d", len(calls))
+	}
+
+	for name, body := range map[string]string{
+		"not a participant": `{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "hi", "mentions": ["15559999999@s.whatsapp.net"]}`,
+		"invalid jid":       `{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "hi", "mentions": ["nobody"]}`,
+		"direct chat":       `{"user_id": 1, "chat_jid": "15551112222@s.whatsapp.net", "text": "hi", "mentions": ["15551112222@s.whatsapp.net"]}`,
+	} {
+		if w := send(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	if w := send(`{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "hi", "mentions": ["15559999999@s.whatsapp.net"]}`); !bytes.Contains(w.Body.Bytes(), []byte(`"not_participants":["15559999999@s.whatsapp.net"]`)) {
+		t.Errorf("expected the non-participant listed, got %s", w.Body.String())
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 2 {
+		t.Errorf("expected refused mentions not to be sent, got %d sends", len(calls))
+	}
+
+	// A member is found by their LID, and one who joined since the list was cached after a refetch
+	mock.SetLIDMapping(types.NewJID("15551112222", types.DefaultUserServer), types.NewJID("11111111111111", types.HiddenUserServer))
+	mock.GroupInfo = &types.GroupInfo{Participants: append(mock.GroupInfo.Participants,
+		types.GroupParticipant{JID: types.NewJID("22222222222222", types.HiddenUserServer), PhoneNumber: types.NewJID("15555556666", types.DefaultUserServer)})}
+	w = send(`{"user_id": 1, "chat_jid": "120363000000000001@g.us", "text": "hi", "mentions": ["11111111111111@lid", "15555556666@s.whatsapp.net"]}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected mentions by LID and of a new member to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 3 {
+		t.Errorf("expected the message sent, got %d sends", len(calls))
+	}
+}
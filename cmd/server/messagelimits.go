@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+)
+
+// WhatsApp's limits on outgoing messages. Going over them isn't caught until WhatsApp
+// rejects the send (or the recipient's phone cuts the text off), which for media is
+// after the whole file has been uploaded, so requests are checked against them first.
+const (
+	maxTextLength         = 65536
+	maxCaptionLength      = 1024
+	maxStatusTextLength   = 700
+	maxPollQuestionLength = core.MaxPollQuestionLength
+	maxPollOptionLength   = core.MaxPollOptionLength
+	minPollOptions        = core.MinPollOptions
+	maxPollOptions        = core.MaxPollOptions
+	maxMentions           = 256
+	maxImageSize          = 16 << 20
+	maxAudioSize          = 16 << 20
+	maxVideoSize          = 16 << 20
+	maxDocumentSize       = 2 << 30
+	maxStickerSourceSize  = maxImageSize
+)
+
+// maxMediaSize is the largest file WhatsApp takes for each kind of media. For stickers
+// it bounds the upload, which may be an image to convert; inspectSticker checks the result.
+var maxMediaSize = map[string]int64{
+	"image":    maxImageSize,
+	"audio":    maxAudioSize,
+	"video":    maxVideoSize,
+	"document": maxDocumentSize,
+	"sticker":  maxStickerSourceSize,
+}
+
+// fieldError is one request field that breaks a limit
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// limitCheck collects every limit a request breaks, so a client can fix them all at once
+type limitCheck struct {
+	errs []fieldError
+}
+
+func (c *limitCheck) fail(field, format string, args ...interface{}) {
+	c.errs = append(c.errs, fieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// length checks the length of a text field in characters
+func (c *limitCheck) length(field, value string, max int) {
+	if n := utf8.RuneCountInString(value); n > max {
+		c.fail(field, "%d characters, over the limit of %d", n, max)
+	}
+}
+
+// count checks the number of items in a list field
+func (c *limitCheck) count(field string, n, min, max int) {
+	if n < min || n > max {
+		c.fail(field, "%d items, must be between %d and %d", n, min, max)
+	}
+}
+
+// size checks the decoded size of a kind of media
+func (c *limitCheck) size(field, kind string, size int64) {
+	if max := maxMediaSize[kind]; max > 0 && size > max {
+		c.fail(field, "%d bytes, over the %s limit of %d", size, kind, max)
+	}
+}
+
+// body checks a media request's Content-Length, so a file that's far too large is
+// turned away before it's read at all, and caps the body at the same size so a
+// chunked request can't stream past it either.
+func (c *limitCheck) body(w http.ResponseWriter, r *http.Request, field, kind string) {
+	max := maxMediaSize[kind]
+	if max <= 0 {
+		return
+	}
+	// base64 grows the file by a third; leave room for the other fields
+	limit := int64(base64.StdEncoding.EncodedLen(int(max))) + maxMediaFieldsSize
+	if r.ContentLength > limit {
+		c.fail(field, "request of %d bytes is over the %s limit of %d", r.ContentLength, kind, max)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
+
+// reject answers 400 with the broken limits, if there are any
+func (c *limitCheck) reject(w http.ResponseWriter) bool {
+	if len(c.errs) == 0 {
+		return false
+	}
+	errorResponseWith(w, http.StatusBadRequest, "message exceeds WhatsApp limits", map[string]interface{}{
+		"fields": c.errs,
+	})
+	return true
+}
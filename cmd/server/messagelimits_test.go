@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitCheck(t *testing.T) {
+	var limits limitCheck
+	limits.length("text", strings.Repeat("é", maxCaptionLength), maxCaptionLength)
+	limits.count("options", 3, minPollOptions, maxPollOptions)
+	limits.size("image_b64", "image", maxImageSize)
+	limits.size("sticker_b64", "sticker", maxStickerSourceSize)
+	if len(limits.errs) != 0 {
+		t.Fatalf("expected everything within limits to pass, got %+v", limits.errs)
+	}
+
+	limits.length("caption", strings.Repeat("a", maxCaptionLength+1), maxCaptionLength)
+	limits.count("options", 13, minPollOptions, maxPollOptions)
+	limits.size("image_b64", "image", maxImageSize+1)
+	limits.size("sticker_b64", "sticker", maxStickerSourceSize+1)
+	if len(limits.errs) != 4 || limits.errs[0].Field != "caption" || limits.errs[2].Field != "image_b64" || limits.errs[3].Field != "sticker_b64" {
+		t.Errorf("expected caption, options, image_b64 and sticker_b64 to fail, got %+v", limits.errs)
+	}
+}
+
+func TestSendHandlersRejectOverLimits(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	decode := func(w *httptest.ResponseRecorder) []fieldError {
+		var resp struct {
+			Fields []fieldError `json:"fields"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Fields
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"user_id": 1, "chat_jid": "123@s.whatsapp.net", "text": strings.Repeat("a", maxTextLength+1)})
+	w := httptest.NewRecorder()
+	sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewReader(body)))
+	if fields := decode(w); w.Code != http.StatusBadRequest || len(fields) != 1 || fields[0].Field != "text" {
+		t.Errorf("expected a text field error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{
+		"user_id":   1,
+		"chat_jid":  "123@s.whatsapp.net",
+		"image_b64": base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0 tiny jpeg")),
+		"caption":   strings.Repeat("a", maxCaptionLength+1),
+	})
+	w = httptest.NewRecorder()
+	sendImageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/image", bytes.NewReader(body)))
+	if fields := decode(w); w.Code != http.StatusBadRequest || len(fields) != 1 || fields[0].Field != "caption" {
+		t.Errorf("expected a caption field error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A declared size far over the limit is refused without reading the body
+	req := httptest.NewRequest(http.MethodPost, "/messages/image", strings.NewReader("{}"))
+	req.ContentLength = 60 << 20
+	w = httptest.NewRecorder()
+	sendImageHandler(w, req)
+	if fields := decode(w); w.Code != http.StatusBadRequest || len(fields) != 1 || fields[0].Field != "image_b64" {
+		t.Errorf("expected an image_b64 field error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A chunked body is cut off once it passes the limit
+	stream := &endlessBase64{}
+	req = httptest.NewRequest(http.MethodPost, "/messages/image", io.MultiReader(strings.NewReader(`{"user_id": 1, "image_b64": "`), stream))
+	w = httptest.NewRecorder()
+	sendImageHandler(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an endless chunked body, got %d: %s", w.Code, w.Body.String())
+	}
+	if limit := int64(base64.StdEncoding.EncodedLen(maxImageSize)) + maxMediaFieldsSize; stream.read > limit+64<<10 {
+		t.Errorf("expected reading to stop near %d bytes, read %d", limit, stream.read)
+	}
+
+	if calls := mock.GetCallsByMethod("UploadReader"); len(calls) != 0 {
+		t.Errorf("expected nothing to be uploaded, got %d uploads", len(calls))
+	}
+}
+
+// endlessBase64 is a body that never ends, counting what's read of it
+type endlessBase64 struct {
+	read int64
+}
+
+func (r *endlessBase64) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'A'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
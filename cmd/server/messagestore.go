@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 500
+)
+
+// MessageStore keeps a per-user transcript of received messages and chat notifications,
+// so GET /messages can show a chat the way it appears on the phone. It lives in its own
+// SQLite file next to the session database so the session blob stays small.
+//
+// All methods are safe to call on a nil *MessageStore, which stores nothing.
+type MessageStore struct {
+	db *sql.DB
+
+	mu    sync.RWMutex
+	holds map[string]LegalHold // chats exempt from retention, by JID
+}
+
+const messageStoreSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	chat_jid   TEXT    NOT NULL,
+	id         TEXT    NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	media_type TEXT    NOT NULL DEFAULT '',
+	payload    TEXT    NOT NULL,
+	PRIMARY KEY (chat_jid, id)
+);
+CREATE INDEX IF NOT EXISTS messages_chat_timestamp ON messages (chat_jid, timestamp);
+CREATE TABLE IF NOT EXISTS polls (
+	chat_jid   TEXT    NOT NULL,
+	id         TEXT    NOT NULL,
+	options    TEXT    NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (chat_jid, id)
+);
+CREATE TABLE IF NOT EXISTS group_members (
+	group_jid    TEXT    PRIMARY KEY,
+	participants TEXT    NOT NULL,
+	updated_at   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS events (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	type       TEXT    NOT NULL,
+	payload    TEXT    NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_created_at ON events (created_at);
+CREATE TABLE IF NOT EXISTS conversations (
+	chat_jid        TEXT    PRIMARY KEY,
+	name            TEXT    NOT NULL DEFAULT '',
+	unread_count    INTEGER NOT NULL DEFAULT 0,
+	last_message_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS legal_holds (
+	chat_jid   TEXT    PRIMARY KEY,
+	reason     TEXT    NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS labels (
+	id    TEXT    PRIMARY KEY,
+	name  TEXT    NOT NULL,
+	color INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS label_chats (
+	label_id TEXT NOT NULL,
+	chat_jid TEXT NOT NULL,
+	PRIMARY KEY (label_id, chat_jid)
+);
+CREATE TABLE IF NOT EXISTS label_messages (
+	label_id   TEXT NOT NULL,
+	chat_jid   TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	PRIMARY KEY (label_id, chat_jid, message_id)
+);
+CREATE INDEX IF NOT EXISTS label_messages_chat ON label_messages (chat_jid);
+`
+
+// openMessageStore opens (creating if needed) the message database at path
+func openMessageStore(path string) (*MessageStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(messageStoreSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create message schema: %w", err)
+	}
+	st := &MessageStore{db: db}
+	if err := st.loadLegalHolds(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load legal holds: %w", err)
+	}
+	return st, nil
+}
+
+// Save stores a message, replacing any earlier copy with the same chat and ID
+func (st *MessageStore) Save(ctx context.Context, msg MessagePayload) error {
+	if st == nil {
+		return nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = st.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO messages (chat_jid, id, timestamp, media_type, payload) VALUES (?, ?, ?, ?, ?)`,
+		msg.ChatJID, msg.ID, msg.Timestamp, msg.MediaType, string(data))
+	return err
+}
+
+// Get returns a stored message, or nil if there is none with that chat and ID
+func (st *MessageStore) Get(ctx context.Context, chatJID, id string) (*MessagePayload, error) {
+	if st == nil {
+		return nil, nil
+	}
+	var data string
+	err := st.db.QueryRowContext(ctx, `SELECT payload FROM messages WHERE chat_jid = ? AND id = ?`, chatJID, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var msg MessagePayload
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return nil, err
+	}
+	messages := []MessagePayload{msg}
+	if err := st.attachLabels(ctx, chatJID, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// List returns up to limit messages in the chat older than before (a unix timestamp,
+// 0 for the latest), oldest first
+func (st *MessageStore) List(ctx context.Context, chatJID string, before int64, limit int) ([]MessagePayload, error) {
+	messages := []MessagePayload{}
+	if st == nil {
+		return messages, nil
+	}
+	query := `SELECT payload FROM messages WHERE chat_jid = ?`
+	args := []interface{}{chatJID}
+	if before > 0 {
+		query += ` AND timestamp < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY timestamp DESC, rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := st.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var msg MessagePayload
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reverse into chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, st.attachLabels(ctx, chatJID, messages)
+}
+
+// Close closes the underlying database
+func (st *MessageStore) Close() error {
+	if st == nil {
+		return nil
+	}
+	return st.db.Close()
+}
+
+// emitMessage records a message payload in the store and queues it for consumers, unless
+// its chat is shut out, as system messages about group changes and calls can be
+func (s *UserSession) emitMessage(payload MessagePayload) {
+	if chat, err := types.ParseJID(payload.ChatJID); err == nil && !s.chatAllowed(chat) {
+		return
+	}
+	s.storeMessage(payload)
+	payload.TimestampFormatted = s.TimeFormat.Format(payload.Timestamp)
+	s.emit(core.NewEvent(payload))
+}
+
+// storeMessage records a message payload, unless the retention policy keeps nothing
+func (s *UserSession) storeMessage(payload MessagePayload) {
+	if s.Retention.Get().Mode == RetentionNone && !s.Messages.OnHold(payload.ChatJID) {
+		return
+	}
+	if err := s.Messages.Save(context.Background(), payload); err != nil {
+		log.Printf("[messages] Failed to store %s for user %d: %v", payload.ID, s.UserID, err)
+	}
+}
+
+// messagePage reads the limit and before (unix seconds) query parameters of a
+// message listing
+func messagePage(r *http.Request) (int, int64, error) {
+	limit := defaultMessagePageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		limit = min(n, maxMessagePageSize)
+	}
+
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("invalid before")
+		}
+		before = n
+	}
+	return limit, before, nil
+}
+
+func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	chatJID := r.URL.Query().Get("chat_jid")
+	if chatJID == "" {
+		errorResponse(w, http.StatusBadRequest, "chat_jid required")
+		return
+	}
+
+	limit, before, err := messagePage(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	if !session.chatAllowed(jid) {
+		chatNotAllowedResponse(w)
+		return
+	}
+
+	messages, err := session.Messages.List(r.Context(), jid.String(), before, limit)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load messages: "+err.Error())
+		return
+	}
+
+	messages = session.TimeFormat.stamp(messages)
+	jsonResponse(w, map[string]interface{}{
+		"messages": messages,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func newTestMessageStore(t testing.TB) *MessageStore {
+	t.Helper()
+	store, err := openMessageStore(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("failed to open message store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestMessageStore(t *testing.T) {
+	ctx := context.Background()
+	chat := "123@s.whatsapp.net"
+
+	t.Run("lists messages oldest first with paging", func(t *testing.T) {
+		store := newTestMessageStore(t)
+		for i, id := range []string{"a", "b", "c", "d"} {
+			if err := store.Save(ctx, MessagePayload{ID: id, ChatJID: chat, Timestamp: int64(100 + i), Text: id}); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+		}
+		store.Save(ctx, MessagePayload{ID: "other", ChatJID: "456@s.whatsapp.net", Timestamp: 200})
+
+		latest, err := store.List(ctx, chat, 0, 2)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(latest) != 2 || latest[0].ID != "c" || latest[1].ID != "d" {
+			t.Errorf("expected [c d], got %+v", latest)
+		}
+
+		older, err := store.List(ctx, chat, latest[0].Timestamp, 10)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(older) != 2 || older[0].ID != "a" || older[1].ID != "b" {
+			t.Errorf("expected [a b], got %+v", older)
+		}
+	})
+
+	t.Run("replaces message with same ID", func(t *testing.T) {
+		store := newTestMessageStore(t)
+		store.Save(ctx, MessagePayload{ID: "a", ChatJID: chat, Timestamp: 100, Text: "first"})
+		store.Save(ctx, MessagePayload{ID: "a", ChatJID: chat, Timestamp: 100, Text: "second"})
+
+		messages, _ := store.List(ctx, chat, 0, 10)
+		if len(messages) != 1 || messages[0].Text != "second" {
+			t.Errorf("expected single updated message, got %+v", messages)
+		}
+	})
+
+	t.Run("nil store is a no-op", func(t *testing.T) {
+		var store *MessageStore
+		if err := store.Save(ctx, MessagePayload{ID: "a"}); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		messages, err := store.List(ctx, chat, 0, 10)
+		if err != nil || len(messages) != 0 {
+			t.Errorf("expected empty result, got %v, %v", messages, err)
+		}
+	})
+}
+
+func TestGetMessagesHandler(t *testing.T) {
+	t.Run("requires chat_jid", func(t *testing.T) {
+		manager = setupTestManager(t)
+		req := httptest.NewRequest(http.MethodGet, "/messages?user_id=1", nil)
+		w := httptest.NewRecorder()
+		getMessagesHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("rejects invalid limit", func(t *testing.T) {
+		manager = setupTestManager(t)
+		req := httptest.NewRequest(http.MethodGet, "/messages?user_id=1&chat_jid=123@s.whatsapp.net&limit=-1", nil)
+		w := httptest.NewRecorder()
+		getMessagesHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("returns stored messages", func(t *testing.T) {
+		manager = setupTestManager(t)
+		session := injectMockSession(manager, 970, NewLoggedInMockClient())
+		session.Messages = newTestMessageStore(t)
+		session.emitMessage(MessagePayload{ID: "m1", ChatJID: "123@s.whatsapp.net", Timestamp: 100, Text: "hello"})
+
+		req := httptest.NewRequest(http.MethodGet, "/messages?user_id=970&chat_jid=123@s.whatsapp.net", nil)
+		w := httptest.NewRecorder()
+		getMessagesHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Messages []MessagePayload `json:"messages"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Messages) != 1 || resp.Messages[0].Text != "hello" {
+			t.Errorf("unexpected messages: %+v", resp.Messages)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Error sources, so dashboards can tell WhatsApp refusing or failing a request apart
+// from failures on our side
+const (
+	errorSourceWhatsApp = "whatsapp"
+	errorSourceLocal    = "local"
+)
+
+// counterVec is a counter family with labels, exposed in OpenMetrics text format
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by label values joined with \xff
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Inc adds one to the counter with the given label values, in the order the labels
+// were declared
+func (c *counterVec) Inc(labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", c.name, len(labelValues), len(c.labels)))
+	}
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, "\xff")]++
+	c.mu.Unlock()
+}
+
+// Value returns the counter with the given label values
+func (c *counterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *counterVec) writeTo(b *strings.Builder) {
+	fmt.Fprintf(b, "# TYPE %s counter\n# HELP %s %s\n", c.name, c.name, c.help)
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(c.name + "_total")
+		if len(c.labels) > 0 {
+			b.WriteByte('{')
+			for i, value := range strings.Split(key, "\xff") {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(b, "%s=%s", c.labels[i], escapeLabelValue(value))
+			}
+			b.WriteByte('}')
+		}
+		b.WriteString(" " + strconv.FormatFloat(c.values[key], 'g', -1, 64) + "\n")
+	}
+	c.mu.Unlock()
+}
+
+func escapeLabelValue(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// Protocol-level failure counters
+var (
+	sendErrors = newCounterVec("wa_send_errors",
+		"Failed message sends by source and error code.", "source", "code")
+	mediaErrors = newCounterVec("wa_media_errors",
+		"Failed media uploads and downloads by direction and HTTP status.", "direction", "status")
+	retryReceipts = newCounterVec("wa_retry_receipts",
+		"Retry receipts received, meaning a recipient couldn't decrypt a message we sent.")
+	messageRetries = newCounterVec("wa_message_retries",
+		"Incoming messages that only decrypted after re-requesting them from the sender.")
+	decryptionFailures = newCounterVec("wa_decryption_failures",
+		"Incoming messages that couldn't be decrypted, by reason.", "reason")
+	droppedEvents = newCounterVec("wa_dropped_events",
+		"Events discarded because the session's event channel was full, by user.", "user_id")
+
+	protocolMetrics = []*counterVec{sendErrors, mediaErrors, retryReceipts, messageRetries, decryptionFailures, canaryChecks, droppedEvents}
+)
+
+// classifyError labels an error from whatsmeow. Error codes returned by the WhatsApp
+// server (in message acks and info queries) and HTTP statuses from the media servers
+// are attributed to WhatsApp; everything else is local.
+func classifyError(err error) (source, code string) {
+	var iqErr *whatsmeow.IQError
+	var httpErr whatsmeow.DownloadHTTPError
+	switch {
+	case errors.Is(err, whatsmeow.ErrServerReturnedError):
+		// "server returned error 479"
+		fields := strings.Fields(err.Error())
+		return errorSourceWhatsApp, fields[len(fields)-1]
+	case errors.As(err, &iqErr):
+		return errorSourceWhatsApp, strconv.Itoa(iqErr.Code)
+	case errors.As(err, &httpErr) && httpErr.Response != nil:
+		return errorSourceWhatsApp, strconv.Itoa(httpErr.StatusCode)
+	case errors.Is(err, whatsmeow.ErrIQTimedOut), errors.Is(err, whatsmeow.ErrMessageTimedOut):
+		// WhatsApp never answered
+		return errorSourceWhatsApp, "timeout"
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorSourceLocal, "timeout"
+	case errors.Is(err, whatsmeow.ErrNotConnected), errors.Is(err, whatsmeow.ErrNotLoggedIn):
+		return errorSourceLocal, "not_connected"
+	case errors.Is(err, context.Canceled):
+		return errorSourceLocal, "canceled"
+	}
+	// Uploads report server rejections as a plain "upload failed with status code 405"
+	if status, ok := strings.CutPrefix(err.Error(), "upload failed with status code "); ok {
+		return errorSourceWhatsApp, status
+	}
+	return errorSourceLocal, "other"
+}
+
+func recordSendError(err error) {
+	if err != nil {
+		sendErrors.Inc(classifyError(err))
+	}
+}
+
+func recordMediaError(direction string, err error) {
+	if err == nil {
+		return
+	}
+	status := "error"
+	if source, code := classifyError(err); source == errorSourceWhatsApp {
+		status = code
+	}
+	mediaErrors.Inc(direction, status)
+}
+
+// recordProtocolEvent counts retry receipts and decryption failures among incoming events
+func recordProtocolEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Receipt:
+		if v.Type == types.ReceiptTypeRetry {
+			retryReceipts.Inc()
+		}
+	case *events.Message:
+		if v.RetryCount > 0 {
+			messageRetries.Inc()
+		}
+	case *events.UndecryptableMessage:
+		switch {
+		case v.IsUnavailable && v.UnavailableType != "":
+			decryptionFailures.Inc("unavailable_" + string(v.UnavailableType))
+		case v.IsUnavailable:
+			decryptionFailures.Inc("unavailable")
+		default:
+			decryptionFailures.Inc("decrypt_failed")
+		}
+	}
+}
+
+// metricsHandler serves the protocol error counters in OpenMetrics text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	for _, c := range protocolMetrics {
+		c.writeTo(&b)
+	}
+	b.WriteString("# EOF\n")
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err    error
+		source string
+		code   string
+	}{
+		{fmt.Errorf("%w %d", whatsmeow.ErrServerReturnedError, 479), errorSourceWhatsApp, "479"},
+		{fmt.Errorf("failed to get group info: %w", whatsmeow.ErrIQNotAllowed), errorSourceWhatsApp, "405"},
+		{whatsmeow.ErrMediaDownloadFailedWith410, errorSourceWhatsApp, "410"},
+		{errors.New("upload failed with status code 405"), errorSourceWhatsApp, "405"},
+		{whatsmeow.ErrMessageTimedOut, errorSourceWhatsApp, "timeout"},
+		{context.DeadlineExceeded, errorSourceLocal, "timeout"},
+		{whatsmeow.ErrNotConnected, errorSourceLocal, "not_connected"},
+		{errors.New("failed to marshal message"), errorSourceLocal, "other"},
+	}
+	for _, tt := range tests {
+		if source, code := classifyError(tt.err); source != tt.source || code != tt.code {
+			t.Errorf("classifyError(%v) = %s/%s, want %s/%s", tt.err, source, code, tt.source, tt.code)
+		}
+	}
+}
+
+func TestRecordProtocolEvent(t *testing.T) {
+	retries := retryReceipts.Value()
+	failed := decryptionFailures.Value("decrypt_failed")
+	viewOnce := decryptionFailures.Value("unavailable_view_once")
+
+	recordProtocolEvent(&events.Receipt{Type: types.ReceiptTypeRetry})
+	recordProtocolEvent(&events.Receipt{Type: types.ReceiptTypeRead})
+	recordProtocolEvent(&events.UndecryptableMessage{})
+	recordProtocolEvent(&events.UndecryptableMessage{IsUnavailable: true, UnavailableType: events.UnavailableTypeViewOnce})
+
+	if got := retryReceipts.Value() - retries; got != 1 {
+		t.Errorf("expected 1 retry receipt, got %v", got)
+	}
+	if got := decryptionFailures.Value("decrypt_failed") - failed; got != 1 {
+		t.Errorf("expected 1 decryption failure, got %v", got)
+	}
+	if got := decryptionFailures.Value("unavailable_view_once") - viewOnce; got != 1 {
+		t.Errorf("expected 1 unavailable view-once message, got %v", got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	recordSendError(fmt.Errorf("%w %d", whatsmeow.ErrServerReturnedError, 463))
+	recordMediaError("upload", errors.New("upload failed with status code 479"))
+
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE wa_send_errors counter\n",
+		`wa_send_errors_total{source="whatsapp",code="463"} `,
+		`wa_media_errors_total{direction="upload",status="479"} `,
+		"# TYPE wa_decryption_failures counter\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("expected exposition to end with # EOF")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, preferring gzip
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		refused := false
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				refused = err != nil || weight == 0
+			}
+		}
+		accepted[name] = !refused
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressResponseWriter compresses the body once the handler commits to a response.
+// Event streams are passed through untouched so SSE frames are delivered immediately.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressor  io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") || h.Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", cw.encoding)
+	h.Add("Vary", "Accept-Encoding")
+	if cw.encoding == "gzip" {
+		gz := gzipWriterPool.Get().(*gzip.Writer)
+		gz.Reset(cw.ResponseWriter)
+		cw.compressor = gz
+	} else {
+		fw, _ := flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		cw.compressor = fw
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.compressor == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.compressor.Write(p)
+}
+
+// Flush pushes any buffered compressed data to the client
+func (cw *compressResponseWriter) Flush() {
+	if gz, ok := cw.compressor.(*gzip.Writer); ok {
+		gz.Flush()
+	} else if fw, ok := cw.compressor.(*flate.Writer); ok {
+		fw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressResponseWriter) close() {
+	if cw.compressor == nil {
+		return
+	}
+	cw.compressor.Close()
+	if gz, ok := cw.compressor.(*gzip.Writer); ok {
+		gz.Reset(io.Discard)
+		gzipWriterPool.Put(gz)
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressionMiddleware gzip/deflate-compresses responses for clients that ask for it.
+// Chat lists and base64 media payloads shrink considerably.
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		// WebSocket upgrades hijack the connection, leaving nothing to compress
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits propagated request IDs to characters that are safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// requestIDMiddleware tags every request with an X-Request-ID, keeping the caller's if it
+// sent a usable one, echoes it in the response and logs the outcome under it. Probe
+// endpoints aren't logged.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		switch r.URL.Path {
+		case "/health", "/readyz", "/metrics":
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log.Printf("[http] request_id=%s method=%s path=%s status=%d duration=%s",
+			id, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// Default time handlers get to respond, by endpoint class
+const (
+	defaultStatusTimeout  = 10 * time.Second
+	defaultRequestTimeout = 30 * time.Second
+	defaultMediaTimeout   = 2 * time.Minute
+)
+
+// timeoutWriter buffers a handler's response so it can be dropped if the handler
+// overruns its deadline
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 {
+		tw.status = status
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+// withTimeout gives next d to respond, after which the client gets a 504 and whatever
+// the handler writes later is discarded. The request context is cancelled at the
+// deadline, but WhatsApp calls that don't take it run to completion in the background.
+// Not for streaming handlers, whose output is held back until they return.
+func withTimeout(d time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			for k, v := range tw.header {
+				w.Header()[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("[http] %s %s exceeded its %v timeout", r.Method, r.URL.Path, d)
+				errorResponse(w, http.StatusGatewayTimeout, fmt.Sprintf("request timed out after %v", d))
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"deflate":                 "deflate",
+		"deflate, gzip":           "gzip",
+		"gzip;q=0, deflate":       "deflate",
+		"GZIP;q=0.5":              "gzip",
+		"br":                      "",
+		"gzip;q=0.0, deflate;q=0": "",
+	}
+	for header, want := range cases {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"jid":"123@s.whatsapp.net","name":"Someone"},`, 100)
+	handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+
+	t.Run("gzips when accepted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/chats", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("expected gzip encoding, got %q", w.Header().Get("Content-Encoding"))
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("invalid gzip body: %v", err)
+		}
+		data, _ := io.ReadAll(gz)
+		if string(data) != body {
+			t.Error("decompressed body mismatch")
+		}
+	})
+
+	t.Run("deflates when only deflate accepted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/chats", nil)
+		req.Header.Set("Accept-Encoding", "deflate")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "deflate" {
+			t.Fatalf("expected deflate encoding, got %q", w.Header().Get("Content-Encoding"))
+		}
+		data, _ := io.ReadAll(flate.NewReader(w.Body))
+		if string(data) != body {
+			t.Error("decompressed body mismatch")
+		}
+	})
+
+	t.Run("passes through without Accept-Encoding", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/chats", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Error("expected no content encoding")
+		}
+		if w.Body.String() != body {
+			t.Error("body mismatch")
+		}
+	})
+
+	t.Run("does not compress event streams", func(t *testing.T) {
+		sse := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: message\ndata: {}\n\n")
+			w.(http.Flusher).Flush()
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		sse.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Error("expected event stream to be uncompressed")
+		}
+		if w.Body.String() != "event: message\ndata: {}\n\n" {
+			t.Errorf("unexpected body %q", w.Body.String())
+		}
+	})
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	handler := requestIDMiddleware(compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorResponse(w, http.StatusInternalServerError, "send failed")
+	})))
+	serve := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/messages/send", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if id != "" {
+			req.Header.Set(requestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	bodyID := func(w *httptest.ResponseRecorder) string {
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader failed: %v", err)
+		}
+		var body map[string]string
+		json.NewDecoder(gz).Decode(&body)
+		return body["request_id"]
+	}
+
+	t.Run("propagates caller's ID", func(t *testing.T) {
+		w := serve("jo-bot-42")
+		if got := w.Header().Get(requestIDHeader); got != "jo-bot-42" {
+			t.Errorf("expected header to echo caller's ID, got %q", got)
+		}
+		if got := bodyID(w); got != "jo-bot-42" {
+			t.Errorf("expected error body to carry caller's ID, got %q", got)
+		}
+	})
+
+	t.Run("generates when missing or unsafe", func(t *testing.T) {
+		for _, id := range []string{"", "bad id\nforged log line", strings.Repeat("x", 200)} {
+			w := serve(id)
+			got := w.Header().Get(requestIDHeader)
+			if got == "" || got == id {
+				t.Errorf("expected a generated ID for %q, got %q", id, got)
+			}
+			if bodyID(w) != got {
+				t.Error("expected error body and header IDs to match")
+			}
+		}
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("passes a timely response through", func(t *testing.T) {
+		handler := withTimeout(time.Second, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "yes")
+			errorResponse(w, http.StatusTeapot, "short and stout")
+		})
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/sessions/status", nil))
+		if w.Code != http.StatusTeapot || w.Header().Get("X-Test") != "yes" || !strings.Contains(w.Body.String(), "short and stout") {
+			t.Errorf("unexpected response %d %v: %s", w.Code, w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("answers 504 when the handler overruns", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		cancelled := make(chan bool, 1)
+		handler := withTimeout(20*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			cancelled <- true
+			<-release
+			jsonResponse(w, map[string]string{"status": "late"})
+		})
+
+		w := httptest.NewRecorder()
+		w.Header().Set(requestIDHeader, "req-42")
+		handler(w, httptest.NewRequest(http.MethodPost, "/messages/send", nil))
+		if w.Code != http.StatusGatewayTimeout {
+			t.Fatalf("expected 504, got %d", w.Code)
+		}
+		var body map[string]string
+		json.NewDecoder(w.Body).Decode(&body)
+		if !strings.Contains(body["error"], "timed out") || body["request_id"] != "req-42" {
+			t.Errorf("expected a structured timeout error, got %v", body)
+		}
+		if !<-cancelled {
+			t.Error("expected the handler's context to be cancelled")
+		}
+	})
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"io"
+	"slices"
 	"sync"
 	"time"
 
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waCommon"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
 )
 
 // MockWhatsAppClient implements WhatsAppClient for testing
@@ -19,19 +26,47 @@ type MockWhatsAppClient struct {
 	loggedIn  bool
 
 	// Configurable return values
-	ConnectError        error
-	SendMessageResponse whatsmeow.SendResponse
-	SendMessageError    error
-	SendPresenceError   error
-	UploadResponse      whatsmeow.UploadResponse
-	UploadError         error
-	DownloadData        []byte
-	DownloadError       error
-	JoinedGroups        []*types.GroupInfo
-	JoinedGroupsError   error
-	GroupInfo           *types.GroupInfo
-	GroupInfoError      error
-	QRChannelError      error
+	ConnectError           error
+	SendMessageResponse    whatsmeow.SendResponse
+	SendMessageError       error
+	SendPresenceError      error
+	SubscribePresenceError error
+	LogoutError            error
+	UploadResponse         whatsmeow.UploadResponse
+	UploadError            error
+	DownloadData           []byte
+	DownloadError          error
+	JoinedGroups           []*types.GroupInfo
+	JoinedGroupsError      error
+	GroupInfo              *types.GroupInfo
+	GroupInfoError         error
+	ParticipantUpdates     []types.GroupParticipant // nil applies every change
+	ParticipantUpdateError error
+	InviteLink             string
+	InviteGroup            *types.GroupInfo // the group InviteLink leads to
+	InviteLinkError        error
+	GroupUpdateError       error // returned by every group setting change
+	GroupPhotoID           string
+	ProfilePicture         *types.ProfilePictureInfo
+	ProfilePictureError    error
+	ProfileUpdateError     error // returned by SetProfilePhoto and SetStatusMessage
+	OnWhatsApp             []types.IsOnWhatsAppResponse
+	OnWhatsAppError        error
+	Blocked                []types.JID // the blocklist, changed by UpdateBlocklist
+	BlocklistError         error
+	Catalog                *BusinessCatalog // GetBusinessProduct looks products up in it too
+	CatalogError           error
+	QRChannelError         error
+	SendAppStateError      error
+	MarkReadError          error
+	PollVote               *waE2E.PollVoteMessage
+	PollVoteError          error
+	// Items sent down successive QR channels, each closed once its items are sent;
+	// further channels stay empty and open
+	QRItems [][]whatsmeow.QRChannelItem
+	// Code returned by PairPhone
+	PairCode       string
+	PairPhoneError error
 
 	// Store mock
 	store *MockDeviceStore
@@ -49,14 +84,32 @@ type MockCall struct {
 
 // MockDeviceStore implements DeviceStore for testing
 type MockDeviceStore struct {
-	ID       *types.JID
-	Contacts *MockContactStore
+	ID           *types.JID
+	LID          types.JID
+	Contacts     *MockContactStore
+	ChatSettings *MockChatSettingsStore
+	LIDMappings  map[types.JID]types.JID // phone number -> LID
 }
 
 func (s *MockDeviceStore) GetID() *types.JID {
 	return s.ID
 }
 
+func (s *MockDeviceStore) GetLID() types.JID {
+	return s.LID
+}
+
+func (s *MockDeviceStore) GetAltJID(ctx context.Context, jid types.JID) (types.JID, error) {
+	for pn, lid := range s.LIDMappings {
+		if jid == pn {
+			return lid, nil
+		} else if jid == lid {
+			return pn, nil
+		}
+	}
+	return types.EmptyJID, nil
+}
+
 func (s *MockDeviceStore) GetContacts() ContactStore {
 	return s.Contacts
 }
@@ -71,14 +124,35 @@ func (c *MockContactStore) GetAllContacts(ctx context.Context) (map[types.JID]ty
 	return c.AllContacts, c.ContactsError
 }
 
+func (s *MockDeviceStore) GetChatSettings() ChatSettingsStore {
+	return s.ChatSettings
+}
+
+func (s *MockDeviceStore) Delete(ctx context.Context) error {
+	s.ID = nil
+	s.LID = types.EmptyJID
+	return nil
+}
+
+// MockChatSettingsStore implements ChatSettingsStore for testing
+type MockChatSettingsStore struct {
+	Settings      map[types.JID]types.LocalChatSettings
+	SettingsError error
+}
+
+func (c *MockChatSettingsStore) GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error) {
+	return c.Settings[chat], c.SettingsError
+}
+
 // NewMockClient creates a disconnected mock client
 func NewMockClient() *MockWhatsAppClient {
 	return &MockWhatsAppClient{
 		connected: false,
 		loggedIn:  false,
 		store: &MockDeviceStore{
-			ID:       nil,
-			Contacts: &MockContactStore{AllContacts: make(map[types.JID]types.ContactInfo)},
+			ID:           nil,
+			Contacts:     &MockContactStore{AllContacts: make(map[types.JID]types.ContactInfo)},
+			ChatSettings: &MockChatSettingsStore{Settings: make(map[types.JID]types.LocalChatSettings)},
 		},
 		Calls: make([]MockCall, 0),
 	}
@@ -151,6 +225,14 @@ func (m *MockWhatsAppClient) SetDeviceID(jid *types.JID) {
 	m.store.ID = jid
 }
 
+// SetLIDMapping records the LID of a phone number for Store.GetAltJID
+func (m *MockWhatsAppClient) SetLIDMapping(pn, lid types.JID) {
+	if m.store.LIDMappings == nil {
+		m.store.LIDMappings = make(map[types.JID]types.JID)
+	}
+	m.store.LIDMappings[pn] = lid
+}
+
 // SetContacts sets the contacts for Store.Contacts access
 func (m *MockWhatsAppClient) SetContacts(contacts map[types.JID]types.ContactInfo) {
 	m.store.Contacts.AllContacts = contacts
@@ -190,12 +272,45 @@ func (m *MockWhatsAppClient) Disconnect() {
 	m.mu.Unlock()
 }
 
+func (m *MockWhatsAppClient) ResetConnection() {
+	m.recordCall("ResetConnection")
+}
+
+func (m *MockWhatsAppClient) Logout(ctx context.Context) error {
+	m.recordCall("Logout", ctx)
+	if m.LogoutError != nil {
+		return m.LogoutError
+	}
+	m.mu.Lock()
+	m.connected = false
+	m.loggedIn = false
+	m.mu.Unlock()
+	return m.store.Delete(ctx)
+}
+
+func (m *MockWhatsAppClient) PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error) {
+	m.recordCall("PairPhone", ctx, phone, showPushNotification, clientType, clientDisplayName)
+	if m.PairPhoneError != nil {
+		return "", m.PairPhoneError
+	}
+	return m.PairCode, nil
+}
+
 func (m *MockWhatsAppClient) GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
 	m.recordCall("GetQRChannel", ctx)
 	if m.QRChannelError != nil {
 		return nil, m.QRChannelError
 	}
 	ch := make(chan whatsmeow.QRChannelItem, 10)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.QRItems) > 0 {
+		for _, item := range m.QRItems[0] {
+			ch <- item
+		}
+		close(ch)
+		m.QRItems = m.QRItems[1:]
+	}
 	return ch, nil
 }
 
@@ -218,6 +333,96 @@ func (m *MockWhatsAppClient) SendChatPresence(ctx context.Context, jid types.JID
 	return m.SendPresenceError
 }
 
+func (m *MockWhatsAppClient) SendPresence(ctx context.Context, state types.Presence) error {
+	m.recordCall("SendPresence", ctx, state)
+	return m.SendPresenceError
+}
+
+func (m *MockWhatsAppClient) SubscribePresence(ctx context.Context, jid types.JID) error {
+	m.recordCall("SubscribePresence", ctx, jid)
+	return m.SubscribePresenceError
+}
+
+func (m *MockWhatsAppClient) MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	m.recordCall("MarkRead", ctx, ids, timestamp, chat, sender, receiptTypeExtra)
+	return m.MarkReadError
+}
+
+func (m *MockWhatsAppClient) BuildRevoke(chat, sender types.JID, id types.MessageID) *waE2E.Message {
+	key := &waCommon.MessageKey{
+		FromMe:    proto.Bool(true),
+		ID:        proto.String(id),
+		RemoteJID: proto.String(chat.String()),
+	}
+	if !sender.IsEmpty() && (m.store.ID == nil || sender.User != m.store.ID.User) {
+		key.FromMe = proto.Bool(false)
+		if chat.Server == types.GroupServer {
+			key.Participant = proto.String(sender.ToNonAD().String())
+		}
+	}
+	return &waE2E.Message{
+		ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  key,
+		},
+	}
+}
+
+func (m *MockWhatsAppClient) DecryptPollVote(ctx context.Context, vote *events.Message) (*waE2E.PollVoteMessage, error) {
+	m.recordCall("DecryptPollVote", ctx, vote)
+	if m.PollVoteError != nil {
+		return nil, m.PollVoteError
+	}
+	return m.PollVote, nil
+}
+
+func (m *MockWhatsAppClient) BuildHistorySyncRequest(lastKnown *types.MessageInfo, count int) *waE2E.Message {
+	return &waE2E.Message{
+		ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_PEER_DATA_OPERATION_REQUEST_MESSAGE.Enum(),
+			PeerDataOperationRequestMessage: &waE2E.PeerDataOperationRequestMessage{
+				PeerDataOperationRequestType: waE2E.PeerDataOperationRequestType_HISTORY_SYNC_ON_DEMAND.Enum(),
+				HistorySyncOnDemandRequest: &waE2E.PeerDataOperationRequestMessage_HistorySyncOnDemandRequest{
+					ChatJID:              proto.String(lastKnown.Chat.String()),
+					OldestMsgID:          proto.String(lastKnown.ID),
+					OldestMsgFromMe:      proto.Bool(lastKnown.IsFromMe),
+					OnDemandMsgCount:     proto.Int32(int32(count)),
+					OldestMsgTimestampMS: proto.Int64(lastKnown.Timestamp.UnixMilli()),
+				},
+			},
+		},
+	}
+}
+
+// ParseWebMessage does what the real client does for the common cases: the sender is
+// the user for their own messages, the chat in DMs and the participant in groups
+func (m *MockWhatsAppClient) ParseWebMessage(chatJID types.JID, webMsg *waWeb.WebMessageInfo) (*events.Message, error) {
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			IsFromMe: webMsg.GetKey().GetFromMe(),
+			IsGroup:  chatJID.Server == types.GroupServer,
+		},
+		ID:        webMsg.GetKey().GetID(),
+		PushName:  webMsg.GetPushName(),
+		Timestamp: time.Unix(int64(webMsg.GetMessageTimestamp()), 0),
+	}
+	switch {
+	case info.IsFromMe && m.store.ID != nil:
+		info.Sender = m.store.ID.ToNonAD()
+	case !info.IsGroup:
+		info.Sender = chatJID
+	default:
+		sender, err := types.ParseJID(webMsg.GetKey().GetParticipant())
+		if err != nil {
+			return nil, err
+		}
+		info.Sender = sender
+	}
+	evt := &events.Message{Info: info, RawMessage: webMsg.GetMessage()}
+	return evt.UnwrapRaw(), nil
+}
+
 func (m *MockWhatsAppClient) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
 	m.recordCall("Upload", ctx, plaintext, appInfo)
 	if m.UploadError != nil {
@@ -235,6 +440,28 @@ func (m *MockWhatsAppClient) Upload(ctx context.Context, plaintext []byte, appIn
 	return m.UploadResponse, nil
 }
 
+func (m *MockWhatsAppClient) UploadReader(ctx context.Context, plaintext io.Reader, tempFile io.ReadWriteSeeker, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	data, err := io.ReadAll(plaintext)
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	m.recordCall("UploadReader", ctx, data, appInfo)
+	if m.UploadError != nil {
+		return whatsmeow.UploadResponse{}, m.UploadError
+	}
+	if m.UploadResponse.URL == "" {
+		return whatsmeow.UploadResponse{
+			URL:           "https://mock.whatsapp.net/media/123",
+			DirectPath:    "/v/mock/123",
+			MediaKey:      []byte("mock-media-key"),
+			FileEncSHA256: []byte("mock-enc-sha"),
+			FileSHA256:    []byte("mock-sha"),
+			FileLength:    uint64(len(data)),
+		}, nil
+	}
+	return m.UploadResponse, nil
+}
+
 func (m *MockWhatsAppClient) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
 	m.recordCall("Download", ctx, msg)
 	if m.DownloadError != nil {
@@ -256,6 +483,147 @@ func (m *MockWhatsAppClient) GetGroupInfo(ctx context.Context, jid types.JID) (*
 	return m.GroupInfo, m.GroupInfoError
 }
 
+func (m *MockWhatsAppClient) UpdateGroupParticipants(ctx context.Context, jid types.JID, changes []types.JID, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error) {
+	m.recordCall("UpdateGroupParticipants", ctx, jid, changes, action)
+	if m.ParticipantUpdateError != nil {
+		return nil, m.ParticipantUpdateError
+	}
+	if m.ParticipantUpdates != nil {
+		return m.ParticipantUpdates, nil
+	}
+	updated := make([]types.GroupParticipant, 0, len(changes))
+	for _, jid := range changes {
+		updated = append(updated, types.GroupParticipant{JID: jid, IsAdmin: action == whatsmeow.ParticipantChangePromote})
+	}
+	return updated, nil
+}
+
+func (m *MockWhatsAppClient) GetGroupInviteLink(ctx context.Context, jid types.JID, reset bool) (string, error) {
+	m.recordCall("GetGroupInviteLink", ctx, jid, reset)
+	return m.InviteLink, m.InviteLinkError
+}
+
+func (m *MockWhatsAppClient) GetGroupInfoFromLink(ctx context.Context, code string) (*types.GroupInfo, error) {
+	m.recordCall("GetGroupInfoFromLink", ctx, code)
+	return m.InviteGroup, m.InviteLinkError
+}
+
+func (m *MockWhatsAppClient) JoinGroupWithLink(ctx context.Context, code string) (types.JID, error) {
+	m.recordCall("JoinGroupWithLink", ctx, code)
+	if m.InviteLinkError != nil {
+		return types.EmptyJID, m.InviteLinkError
+	}
+	return m.InviteGroup.JID, nil
+}
+
+func (m *MockWhatsAppClient) SetGroupName(ctx context.Context, jid types.JID, name string) error {
+	m.recordCall("SetGroupName", ctx, jid, name)
+	return m.GroupUpdateError
+}
+
+func (m *MockWhatsAppClient) SetGroupTopic(ctx context.Context, jid types.JID, previousID, newID, topic string) error {
+	m.recordCall("SetGroupTopic", ctx, jid, previousID, newID, topic)
+	return m.GroupUpdateError
+}
+
+func (m *MockWhatsAppClient) SetGroupAnnounce(ctx context.Context, jid types.JID, announce bool) error {
+	m.recordCall("SetGroupAnnounce", ctx, jid, announce)
+	return m.GroupUpdateError
+}
+
+func (m *MockWhatsAppClient) SetGroupLocked(ctx context.Context, jid types.JID, locked bool) error {
+	m.recordCall("SetGroupLocked", ctx, jid, locked)
+	return m.GroupUpdateError
+}
+
+func (m *MockWhatsAppClient) SetDisappearingTimer(ctx context.Context, chat types.JID, timer time.Duration, settingTS time.Time) error {
+	m.recordCall("SetDisappearingTimer", ctx, chat, timer, settingTS)
+	return m.GroupUpdateError
+}
+
+func (m *MockWhatsAppClient) SetGroupPhoto(ctx context.Context, jid types.JID, avatar []byte) (string, error) {
+	m.recordCall("SetGroupPhoto", ctx, jid, avatar)
+	if m.GroupUpdateError != nil {
+		return "", m.GroupUpdateError
+	}
+	if avatar == nil {
+		return "remove", nil
+	}
+	return m.GroupPhotoID, nil
+}
+
+func (m *MockWhatsAppClient) GetProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
+	m.recordCall("GetProfilePictureInfo", ctx, jid, params)
+	return m.ProfilePicture, m.ProfilePictureError
+}
+
+func (m *MockWhatsAppClient) SetProfilePhoto(ctx context.Context, avatar []byte) (string, error) {
+	m.recordCall("SetProfilePhoto", ctx, avatar)
+	if m.ProfileUpdateError != nil {
+		return "", m.ProfileUpdateError
+	}
+	if avatar == nil {
+		return "remove", nil
+	}
+	return m.GroupPhotoID, nil
+}
+
+func (m *MockWhatsAppClient) SetStatusMessage(ctx context.Context, msg string) error {
+	m.recordCall("SetStatusMessage", ctx, msg)
+	return m.ProfileUpdateError
+}
+
+func (m *MockWhatsAppClient) IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error) {
+	m.recordCall("IsOnWhatsApp", ctx, phones)
+	return m.OnWhatsApp, m.OnWhatsAppError
+}
+
+func (m *MockWhatsAppClient) GetBlocklist(ctx context.Context) (*types.Blocklist, error) {
+	m.recordCall("GetBlocklist", ctx)
+	if m.BlocklistError != nil {
+		return nil, m.BlocklistError
+	}
+	return &types.Blocklist{JIDs: m.Blocked}, nil
+}
+
+func (m *MockWhatsAppClient) UpdateBlocklist(ctx context.Context, jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
+	m.recordCall("UpdateBlocklist", ctx, jid, action)
+	if m.BlocklistError != nil {
+		return nil, m.BlocklistError
+	}
+	m.Blocked = slices.DeleteFunc(m.Blocked, func(blocked types.JID) bool { return blocked == jid })
+	if action == events.BlocklistChangeActionBlock {
+		m.Blocked = append(m.Blocked, jid)
+	}
+	return &types.Blocklist{JIDs: m.Blocked}, nil
+}
+
+func (m *MockWhatsAppClient) GetBusinessCatalog(ctx context.Context, jid types.JID, limit int, after string) (*BusinessCatalog, error) {
+	m.recordCall("GetBusinessCatalog", ctx, jid, limit, after)
+	if m.CatalogError != nil {
+		return nil, m.CatalogError
+	}
+	if m.Catalog == nil {
+		return nil, whatsmeow.ErrIQNotFound
+	}
+	return m.Catalog, nil
+}
+
+func (m *MockWhatsAppClient) GetBusinessProduct(ctx context.Context, jid types.JID, productID string) (*BusinessProduct, error) {
+	m.recordCall("GetBusinessProduct", ctx, jid, productID)
+	if m.CatalogError != nil {
+		return nil, m.CatalogError
+	}
+	if m.Catalog != nil {
+		for _, product := range m.Catalog.Products {
+			if product.ID == productID {
+				return &product, nil
+			}
+		}
+	}
+	return nil, whatsmeow.ErrIQNotFound
+}
+
 func (m *MockWhatsAppClient) GetStore() DeviceStore {
 	m.recordCall("GetStore")
 	return m.store
@@ -292,3 +660,8 @@ func (m *MockWhatsAppClient) SendMediaRetryReceipt(ctx context.Context, message
 	m.recordCall("SendMediaRetryReceipt", ctx, message, mediaKey)
 	return nil
 }
+
+func (m *MockWhatsAppClient) SendAppState(ctx context.Context, patch appstate.PatchInfo) error {
+	m.recordCall("SendAppState", ctx, patch)
+	return m.SendAppStateError
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Default outbound pacing. WhatsApp bans numbers that send like a bot, above all ones
+// that message many people who never wrote to them, so sends are spread out well below
+// the rates that get noticed.
+const (
+	defaultPacingPerMinute       = 20
+	defaultPacingNewChatsPerHour = 15
+	defaultPacingMaxWait         = 20 * time.Second // under REQUEST_TIMEOUT
+)
+
+// OutboundPacing limits how fast each session sends messages, whatever the client
+// calling the API does
+type OutboundPacing struct {
+	PerMinute int // messages per minute; 0 disables
+	// First messages per hour to people the session has no history with; 0 disables
+	NewChatsPerHour int
+	// How long a send may queue for its turn. Sends that would wait longer are refused
+	// right away, so a request doesn't time out with the message still queued.
+	MaxWait time.Duration
+}
+
+var outboundPacing = outboundPacingFromEnv()
+
+// outboundPacingFromEnv reads PACING_PER_MINUTE, PACING_NEW_CHATS_PER_HOUR and PACING_MAX_WAIT
+func outboundPacingFromEnv() OutboundPacing {
+	return OutboundPacing{
+		PerMinute:       concurrencyLimitFromEnv("PACING_PER_MINUTE", defaultPacingPerMinute),
+		NewChatsPerHour: concurrencyLimitFromEnv("PACING_NEW_CHATS_PER_HOUR", defaultPacingNewChatsPerHour),
+		MaxWait:         durationFromEnv("PACING_MAX_WAIT", defaultPacingMaxWait),
+	}
+}
+
+// PacingError is returned instead of sending when a message would have to queue longer
+// than MaxWait. Nothing was sent.
+type PacingError struct {
+	Limit      string // "per_minute" or "new_chats_per_hour"
+	RetryAfter time.Duration
+}
+
+func (e *PacingError) Error() string {
+	return fmt.Sprintf("outbound %s limit reached, retry in %v", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// OutboundPacer books each of a session's sends a time to go out, so they stay within
+// outboundPacing in the order they were made. The zero value is ready to use.
+type OutboundPacer struct {
+	mu       sync.Mutex
+	sends    []time.Time // when recent and queued sends go out, oldest first
+	newChats []time.Time // the same, for first messages to new chats
+	known    map[types.JID]bool
+}
+
+// nextSlot returns when another send fits in a window holding limit sends per period,
+// given the times booked in it. It drops the bookings that have left the window.
+func nextSlot(booked *[]time.Time, limit int, period time.Duration, now time.Time) time.Time {
+	kept := (*booked)[:0]
+	for _, at := range *booked {
+		if at.After(now.Add(-period)) {
+			kept = append(kept, at)
+		}
+	}
+	*booked = kept
+	if len(kept) < limit {
+		return now
+	}
+	return kept[len(kept)-limit].Add(period)
+}
+
+// knows reports whether the pacer has let a send to chat through
+func (p *OutboundPacer) knows(chat types.JID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.known[chat]
+}
+
+// reserve books the earliest time a send to chat may go out, or refuses it with a
+// *PacingError if that's more than policy.MaxWait away. newChat is a first message to
+// someone the session has no history with.
+func (p *OutboundPacer) reserve(chat types.JID, newChat bool, policy OutboundPacing, now time.Time) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	at, limit := now, ""
+	if policy.PerMinute > 0 {
+		if slot := nextSlot(&p.sends, policy.PerMinute, time.Minute, now); slot.After(at) {
+			at, limit = slot, "per_minute"
+		}
+		// Never ahead of a send booked before this one
+		if n := len(p.sends); n > 0 && p.sends[n-1].After(at) {
+			at, limit = p.sends[n-1], "per_minute"
+		}
+	}
+	newChat = newChat && policy.NewChatsPerHour > 0
+	if newChat {
+		if slot := nextSlot(&p.newChats, policy.NewChatsPerHour, time.Hour, now); slot.After(at) {
+			at, limit = slot, "new_chats_per_hour"
+		}
+	}
+
+	if wait := at.Sub(now); wait > policy.MaxWait {
+		return time.Time{}, &PacingError{Limit: limit, RetryAfter: wait}
+	}
+	if policy.PerMinute > 0 {
+		p.sends = append(p.sends, at)
+	}
+	if newChat {
+		p.newChats = append(p.newChats, at)
+	}
+	if p.known == nil {
+		p.known = make(map[types.JID]bool)
+	}
+	p.known[chat] = true
+	return at, nil
+}
+
+// release gives back the slots reserve booked for a send that didn't go out, so they
+// don't count against the sends after it. A chat it would have introduced is new again.
+func (p *OutboundPacer) release(chat types.JID, at time.Time, newChat bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unbook(&p.sends, at)
+	if newChat {
+		unbook(&p.newChats, at)
+		delete(p.known, chat)
+	}
+}
+
+// unbook removes one booking at the given time
+func unbook(booked *[]time.Time, at time.Time) {
+	if i := slices.IndexFunc(*booked, at.Equal); i >= 0 {
+		*booked = slices.Delete(*booked, i, i+1)
+	}
+}
+
+// pacedClient refuses sends to chats outside the session's access lists, queues them
+// for approval if the session needs it, and holds the rest back to its OutboundPacer's
+// schedule and first messages to the warm-up limits. Everything but SendMessage goes
+// straight to the client.
+type pacedClient struct {
+	WhatsAppClient
+	session *UserSession
+}
+
+func (c *pacedClient) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if !c.session.chatAllowed(to) {
+		log.Printf("[chat-access] User %d: refusing send to %s", c.session.UserID, to)
+		return whatsmeow.SendResponse{}, &ChatNotAllowedError{Chat: to.ToNonAD()}
+	}
+	if c.session.Approval.Enabled() && c.paces(to, message) && !isApprovedSend(ctx) {
+		return whatsmeow.SendResponse{}, c.session.holdForApproval(to, message, extra)
+	}
+	if !c.paces(to, message) {
+		return c.WhatsAppClient.SendMessage(ctx, to, message, extra...)
+	}
+
+	chat := to.ToNonAD()
+	warmup := currentConfig().Warmup
+	newChat := false
+	if (outboundPacing.NewChatsPerHour > 0 || len(warmup.Schedule) > 0) && !c.session.Pacer.knows(chat) {
+		newChat = c.isNewChat(ctx, chat)
+	}
+	if newChat {
+		if err := c.session.Warmup.reserve(warmup, time.Now()); err != nil {
+			log.Printf("[warmup] User %d: refusing first message to %s: %v", c.session.UserID, chat, err)
+			return whatsmeow.SendResponse{}, err
+		}
+	}
+
+	at, err := c.session.Pacer.reserve(chat, newChat, outboundPacing, time.Now())
+	if err != nil {
+		if newChat {
+			c.session.Warmup.release()
+		}
+		log.Printf("[pacing] User %d: refusing send to %s: %v", c.session.UserID, chat, err)
+		return whatsmeow.SendResponse{}, err
+	}
+	if wait := time.Until(at); wait > 0 {
+		log.Printf("[pacing] User %d: holding send to %s for %v", c.session.UserID, chat, wait.Round(time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			c.release(chat, at, newChat)
+			return whatsmeow.SendResponse{}, ctx.Err()
+		}
+	}
+
+	resp, err := c.WhatsAppClient.SendMessage(ctx, to, message, extra...)
+	if err != nil && classifySendError(err).RetrySafe {
+		// Nothing went out, so it mustn't hold up the sends after it
+		c.release(chat, at, newChat)
+	} else if newChat {
+		// Counted even if the send failed after going out, as it may have reached them
+		c.session.recordFirstContact(time.Now())
+	}
+	return resp, err
+}
+
+// release gives back what a send that didn't go out reserved
+func (c *pacedClient) release(chat types.JID, at time.Time, newChat bool) {
+	c.session.Pacer.release(chat, at, newChat)
+	if newChat {
+		c.session.Warmup.release()
+	}
+}
+
+// paces reports whether a send counts against the limits. Notes to self and protocol
+// messages (revokes, edits) reach nobody new.
+func (c *pacedClient) paces(to types.JID, message *waE2E.Message) bool {
+	if message.GetProtocolMessage() != nil {
+		return false
+	}
+	if store := c.GetStore(); store != nil {
+		if own := store.GetID(); own != nil && own.User == to.User && own.Server == to.Server {
+			return false
+		}
+	}
+	return true
+}
+
+// isNewChat reports whether chat is a person the session has no messages with. Groups
+// the session is in aren't new. Without stored history every person counts as new.
+func (c *pacedClient) isNewChat(ctx context.Context, chat types.JID) bool {
+	if chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer {
+		return false
+	}
+	history, err := c.session.Messages.List(ctx, chat.String(), 0, 1)
+	return err != nil || len(history) == 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func withOutboundPacing(t *testing.T, policy OutboundPacing) {
+	t.Helper()
+	prev := outboundPacing
+	outboundPacing = policy
+	t.Cleanup(func() { outboundPacing = prev })
+}
+
+func TestOutboundPacer_reserve(t *testing.T) {
+	policy := OutboundPacing{PerMinute: 2, NewChatsPerHour: 1, MaxWait: 90 * time.Second}
+	alice := types.NewJID("15557654321", types.DefaultUserServer)
+	now := time.Unix(1700000000, 0)
+
+	var p OutboundPacer
+	for i, want := range []time.Duration{0, 0, time.Minute, time.Minute} {
+		at, err := p.reserve(alice, false, policy, now)
+		if err != nil || at.Sub(now) != want {
+			t.Fatalf("send %d: expected to go out after %v, got %v (%v)", i, want, at.Sub(now), err)
+		}
+	}
+	var paced *PacingError
+	if _, err := p.reserve(alice, false, policy, now); !errors.As(err, &paced) || paced.Limit != "per_minute" || paced.RetryAfter != 2*time.Minute {
+		t.Errorf("expected a send two minutes out to be refused, got %v", err)
+	}
+
+	// A second new chat waits for the hour, however quiet the session is
+	p = OutboundPacer{}
+	p.reserve(alice, true, policy, now)
+	bob := types.NewJID("15550000000", types.DefaultUserServer)
+	if _, err := p.reserve(bob, true, policy, now.Add(10*time.Minute)); !errors.As(err, &paced) || paced.Limit != "new_chats_per_hour" || paced.RetryAfter != 50*time.Minute {
+		t.Errorf("expected the second new chat to be refused, got %v", err)
+	}
+	if !p.knows(alice) || p.knows(bob) {
+		t.Error("expected only the chat that was let through to be known")
+	}
+
+	// A send that never went out gives its slots back
+	p = OutboundPacer{}
+	at, _ := p.reserve(alice, true, policy, now)
+	p.release(alice, at, true)
+	if p.knows(alice) {
+		t.Error("expected a released new chat to be new again")
+	}
+	if _, err := p.reserve(bob, true, policy, now); err != nil {
+		t.Errorf("expected the released new chat slot to be free, got %v", err)
+	}
+}
+
+func TestPacedClient_SendMessage(t *testing.T) {
+	withOutboundPacing(t, OutboundPacing{PerMinute: 1, NewChatsPerHour: 1})
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	session.Client = &pacedClient{WhatsAppClient: mock, session: session}
+	known := types.NewJID("15557654321", types.DefaultUserServer)
+	session.Messages.Save(context.Background(), MessagePayload{ID: "M1", ChatJID: known.String(), Timestamp: 1700000000})
+
+	text := &waE2E.Message{Conversation: proto.String("hi")}
+	if _, err := session.Client.SendMessage(context.Background(), known, text); err != nil {
+		t.Fatalf("expected the first send to go out, got %v", err)
+	}
+	// Notes to self and revokes don't count
+	own := *session.Client.GetStore().GetID()
+	if _, err := session.Client.SendMessage(context.Background(), own.ToNonAD(), text); err != nil {
+		t.Errorf("expected a note to self to go out, got %v", err)
+	}
+	if _, err := session.Client.SendMessage(context.Background(), known, session.Client.BuildRevoke(known, types.EmptyJID, "M2")); err != nil {
+		t.Errorf("expected a revoke to go out, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "again"}`)))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" || !bytes.Contains(w.Body.Bytes(), []byte(`"rate_limited"`)) {
+		t.Errorf("expected 429 rate_limited with Retry-After, got %d %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if sent := len(mock.GetCallsByMethod("SendMessage")); sent != 3 {
+		t.Errorf("expected the refused message not to reach WhatsApp, got %d sends", sent)
+	}
+}
+
+func TestPacedClient_newChats(t *testing.T) {
+	withOutboundPacing(t, OutboundPacing{NewChatsPerHour: 1})
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(setupTestManager(t), 1, mock)
+	session.Messages = newTestMessageStore(t)
+	client := &pacedClient{WhatsAppClient: mock, session: session}
+	text := &waE2E.Message{Conversation: proto.String("hi")}
+
+	// A send that certainly didn't go out doesn't use up the hour
+	mock.SendMessageError = whatsmeow.ErrNotConnected
+	if _, err := client.SendMessage(context.Background(), types.NewJID("15550000001", types.DefaultUserServer), text); !errors.Is(err, whatsmeow.ErrNotConnected) {
+		t.Fatalf("expected the send to fail, got %v", err)
+	}
+	mock.SendMessageError = nil
+	if _, err := client.SendMessage(context.Background(), types.NewJID("15550000001", types.DefaultUserServer), text); err != nil {
+		t.Fatalf("expected the first new chat to go out, got %v", err)
+	}
+	// Groups aren't new people
+	if _, err := client.SendMessage(context.Background(), types.NewJID("120363000000000000", types.GroupServer), text); err != nil {
+		t.Errorf("expected a group message to go out, got %v", err)
+	}
+	var paced *PacingError
+	if _, err := client.SendMessage(context.Background(), types.NewJID("15550000002", types.DefaultUserServer), text); !errors.As(err, &paced) {
+		t.Errorf("expected the second new chat to be refused, got %v", err)
+	}
+}
+
+func TestPacedClient_cancelledRequest(t *testing.T) {
+	withOutboundPacing(t, OutboundPacing{PerMinute: 1, MaxWait: 2 * time.Minute})
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	session.Client = &pacedClient{WhatsAppClient: mock, session: session}
+	known := types.NewJID("15557654321", types.DefaultUserServer)
+	session.Messages.Save(context.Background(), MessagePayload{ID: "M1", ChatJID: known.String(), Timestamp: 1700000000})
+	if _, err := session.Client.SendMessage(context.Background(), known, &waE2E.Message{Conversation: proto.String("hi")}); err != nil {
+		t.Fatalf("expected the first send to go out, got %v", err)
+	}
+
+	// The caller gives up while the send waits for the next minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "again"}`))
+	sendMessageHandler(w, req.WithContext(ctx))
+	if w.Code == http.StatusOK {
+		t.Errorf("expected the cancelled send to fail, got %d: %s", w.Code, w.Body.String())
+	}
+	if sent := len(mock.GetCallsByMethod("SendMessage")); sent != 1 {
+		t.Errorf("expected the cancelled message not to reach WhatsApp, got %d sends", sent)
+	}
+	session.Pacer.mu.Lock()
+	booked := len(session.Pacer.sends)
+	session.Pacer.mu.Unlock()
+	if booked != 1 {
+		t.Errorf("expected the cancelled send to give its slot back, got %d booked", booked)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/jo-inc/wa_meow/internal/core"
+)
+
+// newMessagePayload converts a message for the API, adding what only the session knows
+// to core.NewMessagePayload. It has no side effects, so live and synced messages share
+// it; downloading media, naming votes and the like are up to the caller.
+func (s *UserSession) newMessagePayload(msg core.Message) (MessagePayload, bool) {
+	payload, hasContent := core.NewMessagePayload(msg)
+	payload.IsSelfChat = s.isSelfChat(msg.Info.Chat)
+	payload.MentionsMe = msg.Info.IsGroup && s.mentionsMe(msg.Raw)
+	return payload, hasContent
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// PollVotePayload is emitted as a "poll_vote" event. Options holds the names of every
+// option the voter currently has selected; it is empty when they withdraw their vote.
+type PollVotePayload struct {
+	PollID     string   `json:"poll_id"`
+	ChatJID    string   `json:"chat_jid"`
+	VoterJID   string   `json:"voter_jid"`
+	VoterName  string   `json:"voter_name,omitempty"`
+	Options    []string `json:"options"`
+	Timestamp  int64    `json:"timestamp"`
+	IsFromMe   bool     `json:"is_from_me"`
+	IsSelfChat bool     `json:"is_self_chat,omitempty"`
+	// UnknownPoll is set for votes on polls this session never saw, whose options can't
+	// be named. OptionHashes then has the hex SHA-256 of each selected option instead.
+	UnknownPoll  bool     `json:"unknown_poll,omitempty"`
+	OptionHashes []string `json:"option_hashes,omitempty"`
+}
+
+// SavePoll remembers a poll's options, so votes on it can be matched back to names
+func (st *MessageStore) SavePoll(ctx context.Context, chatJID, pollID string, options []string) error {
+	if st == nil {
+		return nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = st.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO polls (chat_jid, id, options, created_at) VALUES (?, ?, ?, ?)`,
+		chatJID, pollID, string(data), time.Now().Unix())
+	return err
+}
+
+// PollOptions returns the options of a poll saved with SavePoll, or nil if it's unknown
+func (st *MessageStore) PollOptions(ctx context.Context, chatJID, pollID string) ([]string, error) {
+	if st == nil {
+		return nil, nil
+	}
+	var data string
+	err := st.db.QueryRowContext(ctx, `SELECT options FROM polls WHERE chat_jid = ? AND id = ?`, chatJID, pollID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var options []string
+	if err := json.Unmarshal([]byte(data), &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// savePoll records a sent or received poll's options for naming its votes
+func (s *UserSession) savePoll(chatJID, pollID string, options []string) {
+	if err := s.Messages.SavePoll(context.Background(), chatJID, pollID, options); err != nil {
+		log.Printf("[poll] Failed to store poll %s for user %d: %v", pollID, s.UserID, err)
+	}
+}
+
+// handlePollVote decrypts a vote and emits it with the names of the selected options.
+// Votes carry only SHA-256 hashes of the option names, so they can only be named for
+// polls this session has seen.
+func (s *UserSession) handlePollVote(evt *events.Message) {
+	update := evt.Message.GetPollUpdateMessage()
+	pollID := update.GetPollCreationMessageKey().GetID()
+	vote, err := s.Client.DecryptPollVote(context.Background(), evt)
+	if err != nil {
+		log.Printf("[poll] Failed to decrypt vote %s on poll %s for user %d: %v", evt.Info.ID, pollID, s.UserID, err)
+		return
+	}
+
+	chatJID := evt.Info.Chat.String()
+	options, err := s.Messages.PollOptions(context.Background(), chatJID, pollID)
+	if err != nil {
+		log.Printf("[poll] Failed to look up poll %s for user %d: %v", pollID, s.UserID, err)
+		return
+	}
+	payload := PollVotePayload{
+		PollID:     pollID,
+		ChatJID:    chatJID,
+		VoterJID:   evt.Info.Sender.String(),
+		VoterName:  evt.Info.PushName,
+		Options:    []string{},
+		Timestamp:  evt.Info.Timestamp.Unix(),
+		IsFromMe:   evt.Info.IsFromMe,
+		IsSelfChat: s.isSelfChat(evt.Info.Chat),
+	}
+	if options == nil {
+		// Not an empty (withdrawn) vote: the poll's options just aren't known here
+		log.Printf("[poll] Vote %s is on poll %s, which isn't known for user %d", evt.Info.ID, pollID, s.UserID)
+		payload.UnknownPoll = true
+		for _, hash := range vote.GetSelectedOptions() {
+			payload.OptionHashes = append(payload.OptionHashes, hex.EncodeToString(hash))
+		}
+		s.emit(MessageEvent{Type: "poll_vote", Payload: payload})
+		return
+	}
+
+	selected, unknown := core.SelectedPollOptions(options, vote.GetSelectedOptions())
+	payload.Options = append(payload.Options, selected...)
+	if unknown > 0 {
+		log.Printf("[poll] Vote %s selects %d options of poll %s that aren't known for user %d", evt.Info.ID, unknown, pollID, s.UserID)
+	}
+	s.emit(MessageEvent{Type: "poll_vote", Payload: payload})
+}
+
+// buildPollCreation builds a poll message; the random secret is what votes are
+// encrypted with
+func buildPollCreation(question string, options []string, multiSelect bool) (*waE2E.Message, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	selectable := uint32(1)
+	if multiSelect {
+		selectable = 0 // any number
+	}
+	pollOptions := make([]*waE2E.PollCreationMessage_Option, len(options))
+	for i, option := range options {
+		pollOptions[i] = &waE2E.PollCreationMessage_Option{OptionName: proto.String(option)}
+	}
+	return &waE2E.Message{
+		PollCreationMessage: &waE2E.PollCreationMessage{
+			Name:                   proto.String(question),
+			Options:                pollOptions,
+			SelectableOptionsCount: proto.Uint32(selectable),
+		},
+		MessageContextInfo: &waE2E.MessageContextInfo{
+			MessageSecret: secret,
+		},
+	}, nil
+}
+
+func sendPollHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID      int      `json:"user_id"`
+		ChatJID     string   `json:"chat_jid"`
+		Question    string   `json:"question"`
+		Options     []string `json:"options"`
+		MultiSelect bool     `json:"multi_select"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	var limits limitCheck
+	limits.length("question", req.Question, maxPollQuestionLength)
+	limits.count("options", len(req.Options), minPollOptions, maxPollOptions)
+	for i, option := range req.Options {
+		limits.length(fmt.Sprintf("options[%d]", i), option, maxPollOptionLength)
+	}
+	if limits.reject(w) {
+		return
+	}
+
+	options, err := core.ValidatePoll(req.Question, req.Options)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	msg, err := buildPollCreation(strings.TrimSpace(req.Question), options, req.MultiSelect)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	session.savePoll(jid.String(), resp.ID, options)
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
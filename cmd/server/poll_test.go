@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSendPollHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendPollHandler(w, httptest.NewRequest(http.MethodPost, "/messages/poll", bytes.NewBufferString(body)))
+		return w
+	}
+
+	for _, body := range []string{
+		`{"user_id": 1, "chat_jid": "123@s.whatsapp.net", "question": " ", "options": ["a", "b"]}`,
+		`{"user_id": 1, "chat_jid": "123@s.whatsapp.net", "question": "Lunch?", "options": ["only one"]}`,
+		`{"user_id": 1, "chat_jid": "123@s.whatsapp.net", "question": "Lunch?", "options": ["pizza", " pizza "]}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w := post(`{"user_id": 1, "chat_jid": "123@s.whatsapp.net", "question": "Lunch?", "options": ["pizza", "sushi"], "multi_select": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	msg := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message)
+	poll := msg.GetPollCreationMessage()
+	if poll.GetName() != "Lunch?" || len(poll.GetOptions()) != 2 || poll.GetSelectableOptionsCount() != 0 {
+		t.Errorf("unexpected poll %+v", poll)
+	}
+	if len(msg.GetMessageContextInfo().GetMessageSecret()) != 32 {
+		t.Error("expected a message secret for encrypting votes")
+	}
+	options, _ := session.Messages.PollOptions(t.Context(), "123@s.whatsapp.net", "mock-msg-id")
+	if len(options) != 2 || options[1] != "sushi" {
+		t.Errorf("expected the poll's options to be stored, got %v", options)
+	}
+}
+
+func TestHandleEvent_PollVote(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+
+	chat := types.NewJID("123456789", types.GroupServer)
+	voter := types.NewJID("15551234567", types.DefaultUserServer)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: voter, IsGroup: true},
+		ID:            "POLL1",
+		Timestamp:     time.Unix(1700000000, 0),
+	}
+	session.handleEvent(&events.Message{Info: info, Message: &waE2E.Message{
+		PollCreationMessageV3: &waE2E.PollCreationMessage{
+			Name: proto.String("Lunch?"),
+			Options: []*waE2E.PollCreationMessage_Option{
+				{OptionName: proto.String("pizza")},
+				{OptionName: proto.String("sushi")},
+				{OptionName: proto.String("salad")},
+			},
+			SelectableOptionsCount: proto.Uint32(1),
+		},
+	}})
+	created := <-session.EventChan
+	if p := created.Payload.(MessagePayload); p.MediaType != "poll" || p.Text != "Lunch?" || len(p.PollOptions) != 3 || p.PollMultiSelect {
+		t.Errorf("unexpected poll message %+v", p)
+	}
+
+	sushi := sha256.Sum256([]byte("sushi"))
+	mock.PollVote = &waE2E.PollVoteMessage{SelectedOptions: [][]byte{sushi[:]}}
+	info.ID = "VOTE1"
+	session.handleEvent(&events.Message{Info: info, Message: &waE2E.Message{
+		PollUpdateMessage: &waE2E.PollUpdateMessage{
+			PollCreationMessageKey: &waCommon.MessageKey{ID: proto.String("POLL1")},
+		},
+	}})
+
+	select {
+	case evt := <-session.EventChan:
+		vote, ok := evt.Payload.(PollVotePayload)
+		if evt.Type != "poll_vote" || !ok {
+			t.Fatalf("expected a poll_vote event, got %+v", evt)
+		}
+		if vote.PollID != "POLL1" || vote.VoterJID != voter.String() || len(vote.Options) != 1 || vote.Options[0] != "sushi" || vote.UnknownPoll {
+			t.Errorf("unexpected vote %+v", vote)
+		}
+	default:
+		t.Fatal("expected the vote to be emitted")
+	}
+
+	// A vote on a poll this session never saw isn't mistaken for a withdrawn one
+	info.ID = "VOTE2"
+	session.handleEvent(&events.Message{Info: info, Message: &waE2E.Message{
+		PollUpdateMessage: &waE2E.PollUpdateMessage{
+			PollCreationMessageKey: &waCommon.MessageKey{ID: proto.String("POLL0")},
+		},
+	}})
+	vote := (<-session.EventChan).Payload.(PollVotePayload)
+	if !vote.UnknownPoll || len(vote.Options) != 0 || len(vote.OptionHashes) != 1 || vote.OptionHashes[0] != hex.EncodeToString(sushi[:]) {
+		t.Errorf("expected an unknown-poll vote with the option hash, got %+v", vote)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// PresencePayload is emitted as a "presence" event when a subscribed contact comes
+// online or goes offline
+type PresencePayload = core.PresencePayload
+
+// PresenceSubscriptions remembers whose presence the user subscribed to. WhatsApp
+// forgets subscriptions when the connection drops, so they're renewed on every
+// connect. The zero value is ready to use.
+type PresenceSubscriptions struct {
+	mu   sync.Mutex
+	jids map[types.JID]bool
+}
+
+// Add remembers a subscription
+func (p *PresenceSubscriptions) Add(jid types.JID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jids == nil {
+		p.jids = make(map[types.JID]bool)
+	}
+	p.jids[jid] = true
+}
+
+// List returns every subscribed JID
+func (p *PresenceSubscriptions) List() []types.JID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	jids := make([]types.JID, 0, len(p.jids))
+	for jid := range p.jids {
+		jids = append(jids, jid)
+	}
+	return jids
+}
+
+// AvailabilitySetting is the online status chosen with /presence/set. WhatsApp forgets
+// it with the connection, so it's sent again on every connect.
+type AvailabilitySetting struct {
+	persistedSetting[availabilityConfig]
+}
+
+type availabilityConfig struct {
+	Presence types.Presence `json:"presence"` // "" until set
+}
+
+// State returns the chosen status, or "" if none was
+func (a *AvailabilitySetting) State() types.Presence {
+	return a.Get().Presence
+}
+
+// restorePresence sends the user's chosen status and renews their presence
+// subscriptions after a reconnect. The status goes first: WhatsApp only delivers
+// others' presence to accounts that are online.
+func (s *UserSession) restorePresence() {
+	if state := s.Availability.State(); state != "" {
+		if err := s.Client.SendPresence(context.Background(), state); err != nil {
+			log.Printf("[presence] Failed to restore %s for user %d: %v", state, s.UserID, err)
+		}
+	}
+	for _, jid := range s.Presence.List() {
+		if err := s.Client.SubscribePresence(context.Background(), jid); err != nil {
+			log.Printf("[presence] Failed to resubscribe user %d to %s: %v", s.UserID, jid, err)
+		}
+	}
+}
+
+// emitPresence forwards a contact's presence change
+func (s *UserSession) emitPresence(v *events.Presence) {
+	if !s.chatAllowed(v.From) {
+		return
+	}
+	s.emit(core.NewEvent(core.NewPresencePayload(v)))
+}
+
+// subscribePresenceHandler asks WhatsApp for a contact's online and last seen updates,
+// which then arrive as "presence" events
+func subscribePresenceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		JID    string `json:"jid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.JID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		errorResponse(w, http.StatusBadRequest, "presence is only available for users")
+		return
+	}
+
+	if err := session.Client.SubscribePresence(context.Background(), jid); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	session.Presence.Add(jid)
+
+	jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+// setPresenceHandler shows the user as online or offline. Being online is what lets
+// correspondents see read receipts and "online", and lets presence subscriptions work.
+func setPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID   int            `json:"user_id"`
+		Presence types.Presence `json:"presence"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Presence != types.PresenceAvailable && req.Presence != types.PresenceUnavailable {
+		errorResponse(w, http.StatusBadRequest, "presence must be available or unavailable")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	if err := session.Client.SendPresence(context.Background(), req.Presence); err != nil {
+		if errors.Is(err, whatsmeow.ErrNoPushName) {
+			// The name arrives with the first app state sync after pairing
+			errorResponse(w, http.StatusConflict, "account name not synced yet, try again shortly")
+			return
+		}
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err := session.Availability.Set(availabilityConfig{Presence: req.Presence}); err != nil {
+		log.Printf("[presence] Failed to save %s for user %d: %v", req.Presence, session.UserID, err)
+	}
+
+	jsonResponse(w, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestSubscribePresenceHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		subscribePresenceHandler(w, httptest.NewRequest(http.MethodPost, "/presence/subscribe", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "jid": "123@g.us"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a group, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "jid": "111@s.whatsapp.net"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	calls := mock.GetCallsByMethod("SubscribePresence")
+	if len(calls) != 1 || calls[0].Args[1].(types.JID).User != "111" {
+		t.Fatalf("expected a subscription to 111, got %+v", calls)
+	}
+
+	// Subscriptions are renewed when the connection comes back
+	session.handleEvent(&events.Connected{})
+	for deadline := time.Now().Add(time.Second); len(mock.GetCallsByMethod("SubscribePresence")) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the subscription to be renewed on connect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandleEvent_Presence(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	lastSeen := time.Unix(1700000000, 0)
+
+	session.handleEvent(&events.Presence{From: types.NewJID("111", types.DefaultUserServer), Unavailable: true, LastSeen: lastSeen})
+
+	evt := <-session.EventChan
+	payload, ok := evt.Payload.(PresencePayload)
+	if evt.Type != "presence" || !ok || payload.Online || payload.LastSeen != lastSeen.Unix() || payload.JID != "111@s.whatsapp.net" {
+		t.Errorf("unexpected presence event %+v", evt)
+	}
+}
+
+func TestSetPresenceHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Availability.load(t.TempDir() + "/presence.json")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		setPresenceHandler(w, httptest.NewRequest(http.MethodPost, "/presence/set", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "presence": "away"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown presence, got %d", w.Code)
+	}
+	mock.SendPresenceError = whatsmeow.ErrNoPushName
+	if w := post(`{"user_id": 1, "presence": "available"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 before the push name is known, got %d", w.Code)
+	}
+	if session.Availability.State() != "" {
+		t.Error("expected a failed presence not to be saved")
+	}
+	mock.SendPresenceError = nil
+	if w := post(`{"user_id": 1, "presence": "available"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if session.Availability.State() != types.PresenceAvailable {
+		t.Errorf("expected available to be saved, got %q", session.Availability.State())
+	}
+
+	// The status is sent again on reconnect
+	session.handleEvent(&events.Connected{})
+	for deadline := time.Now().Add(time.Second); len(mock.GetCallsByMethod("SendPresence")) < 3; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the presence to be restored on connect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if state := mock.GetCallsByMethod("SendPresence")[2].Args[1].(types.Presence); state != types.PresenceAvailable {
+		t.Errorf("expected available to be restored, got %q", state)
+	}
+}
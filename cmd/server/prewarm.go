@@ -0,0 +1,188 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMediaPrewarmWorkers  = 2
+	defaultMediaPrewarmMaxBytes = 256 << 20
+	// mediaPrewarmQueueSize bounds the downloads a session can have waiting
+	mediaPrewarmQueueSize = 500
+	// mediaPrewarmUnknownSize is held in the budget for media whose length WhatsApp
+	// didn't report, until it's downloaded and measured
+	mediaPrewarmUnknownSize = 1 << 20
+)
+
+// mediaPrewarmConfig is how much media from history syncs is downloaded ahead of time,
+// so the first /media/download requests after linking are served from the cache
+type mediaPrewarmConfig struct {
+	Window time.Duration // how far back media is downloaded; 0 disables pre-warming
+	// Per session and Window: media is counted by the bytes downloaded, and held at the
+	// length WhatsApp reports while it waits
+	MaxBytes int64
+}
+
+var mediaPrewarm = mediaPrewarmFromEnv()
+
+// mediaPrewarmSlots bounds concurrent pre-warm downloads across sessions, so they can't
+// crowd out live media
+var mediaPrewarmSlots = make(chan struct{}, max(1, concurrencyLimitFromEnv("HISTORY_MEDIA_PREWARM_CONCURRENCY", defaultMediaPrewarmWorkers)))
+
+// mediaPrewarmFromEnv reads HISTORY_MEDIA_PREWARM_DAYS (off unless set) and
+// HISTORY_MEDIA_PREWARM_MAX_MB
+func mediaPrewarmFromEnv() mediaPrewarmConfig {
+	cfg := mediaPrewarmConfig{MaxBytes: defaultMediaPrewarmMaxBytes}
+	if value := os.Getenv("HISTORY_MEDIA_PREWARM_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			log.Printf("Warning: invalid HISTORY_MEDIA_PREWARM_DAYS %q, not pre-warming media", value)
+		} else {
+			cfg.Window = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	if value := os.Getenv("HISTORY_MEDIA_PREWARM_MAX_MB"); value != "" {
+		mb, err := strconv.Atoi(value)
+		if err != nil || mb <= 0 {
+			log.Printf("Warning: invalid HISTORY_MEDIA_PREWARM_MAX_MB %q, using %d", value, defaultMediaPrewarmMaxBytes>>20)
+		} else {
+			cfg.MaxBytes = int64(mb) << 20
+		}
+	}
+	if cfg.Window > 0 {
+		log.Printf("Pre-warming the last %v of history media, up to %d MB per session", cfg.Window, cfg.MaxBytes>>20)
+	}
+	return cfg
+}
+
+// MediaPrewarmer downloads a session's recent history media in the background, newest
+// first, until its share of mediaPrewarm.MaxBytes for the window is used up
+type MediaPrewarmer struct {
+	mu     sync.Mutex
+	since  time.Time // start of the window used counts
+	used   int64     // bytes downloaded in the window
+	queued int64     // bytes held for downloads still waiting
+	queue  chan MessagePayload
+	start  sync.Once
+}
+
+// reserve holds room for a file in the session's budget, which fills up again once a
+// window has passed since it started counting
+func (p *MediaPrewarmer) reserve(size int64, cfg mediaPrewarmConfig, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.since) >= cfg.Window {
+		p.since, p.used = now, 0
+	}
+	if p.used+p.queued+size > cfg.MaxBytes {
+		return false
+	}
+	p.queued += size
+	return true
+}
+
+// settle swaps a file's reservation for the bytes actually downloaded, 0 if it wasn't
+func (p *MediaPrewarmer) settle(reserved, downloaded int64) {
+	p.mu.Lock()
+	p.queued -= reserved
+	p.used += downloaded
+	p.mu.Unlock()
+}
+
+// prewarmSize is what a file holds in the budget until it's downloaded
+func prewarmSize(msg MessagePayload) int64 {
+	if msg.FileLength == 0 {
+		return mediaPrewarmUnknownSize
+	}
+	return int64(msg.FileLength)
+}
+
+// prewarmMedia queues the media among synced messages that's recent enough and not
+// cached yet. It never blocks; what doesn't fit in the queue or budget is left for
+// /media/download to fetch on demand.
+func (s *UserSession) prewarmMedia(messages []MessagePayload, now time.Time) {
+	cfg := mediaPrewarm
+	if cfg.Window <= 0 {
+		return
+	}
+	cutoff := now.Add(-cfg.Window).Unix()
+	var recent []MessagePayload
+	for _, msg := range messages {
+		if msg.DirectPath != "" && len(msg.MediaKey) > 0 && msg.Timestamp >= cutoff && !s.hasCachedMedia(msg.ID) {
+			recent = append(recent, msg)
+		}
+	}
+	if len(recent) == 0 {
+		return
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].Timestamp > recent[j].Timestamp })
+
+	s.Prewarm.start.Do(func() {
+		s.Prewarm.queue = make(chan MessagePayload, mediaPrewarmQueueSize)
+		go s.runPrewarm()
+	})
+	queued := 0
+	for _, msg := range recent {
+		size := prewarmSize(msg)
+		if !s.Prewarm.reserve(size, cfg, now) {
+			continue
+		}
+		select {
+		case s.Prewarm.queue <- msg:
+			queued++
+		default:
+			s.Prewarm.settle(size, 0)
+		}
+	}
+	if queued > 0 {
+		log.Printf("[media/prewarm] User %d: queued %d of %d recent history media", s.UserID, queued, len(recent))
+	}
+}
+
+func (s *UserSession) hasCachedMedia(msgID string) bool {
+	s.MediaMu.RLock()
+	defer s.MediaMu.RUnlock()
+	_, ok := s.MediaCache[msgID]
+	return ok
+}
+
+// runPrewarm downloads queued media one at a time, each waiting for a free slot, until
+// the session is closed
+func (s *UserSession) runPrewarm() {
+	done := s.Context().Done()
+	for {
+		var msg MessagePayload
+		select {
+		case <-done:
+			return
+		case msg = <-s.Prewarm.queue:
+		}
+		size := prewarmSize(msg)
+		if s.hasCachedMedia(msg.ID) {
+			s.Prewarm.settle(size, 0)
+			continue
+		}
+		select {
+		case <-done:
+			return
+		case mediaPrewarmSlots <- struct{}{}:
+		}
+		data, err := s.downloadMediaWithRetry(msg.DirectPath, msg.FileEncSHA256, msg.FileSHA256, msg.MediaKey, msg.MimeType)
+		<-mediaPrewarmSlots
+		if err != nil {
+			log.Printf("[media/prewarm] Failed to download %s %s: %v", msg.MediaType, msg.ID, err)
+			s.Prewarm.settle(size, 0)
+			continue
+		}
+		s.Prewarm.settle(size, int64(len(data)))
+		if !s.scanDownloadedMedia(msg.ID, msg.ChatJID, data) {
+			continue
+		}
+		s.storeCachedMedia(msg.ID, msg.ChatJID, data)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrewarmMedia(t *testing.T) {
+	prev := mediaPrewarm
+	mediaPrewarm = mediaPrewarmConfig{Window: 7 * 24 * time.Hour, MaxBytes: 1000}
+	t.Cleanup(func() { mediaPrewarm = prev })
+
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.DownloadData = []byte("image bytes")
+	session := injectMockSession(manager, 1, mock)
+	session.storeCachedMedia("cached", "15557654321@s.whatsapp.net", []byte("already here"))
+
+	now := time.Unix(1700000000, 0)
+	day := int64(24 * 60 * 60)
+	media := func(id string, age int64) MessagePayload {
+		return MessagePayload{
+			ID: id, ChatJID: "15557654321@s.whatsapp.net", MediaType: "image", MimeType: "image/jpeg",
+			DirectPath: "/v/" + id, MediaKey: []byte("key"), FileLength: 400, Timestamp: now.Unix() - age,
+		}
+	}
+	session.prewarmMedia([]MessagePayload{
+		media("old", 8*day),
+		media("recent-3", 3*day),
+		media("recent-1", day),
+		media("recent-2", 2*day),
+		media("cached", day),
+		{ID: "text", ChatJID: "15557654321@s.whatsapp.net", Text: "hi", Timestamp: now.Unix()},
+	}, now)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !(session.hasCachedMedia("recent-1") && session.hasCachedMedia("recent-2")) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the two newest media to be cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The budget of 1000 bytes fits two files; older and cached media aren't fetched
+	var paths []string
+	for _, call := range mock.GetCallsByMethod("DownloadMediaWithPath") {
+		paths = append(paths, call.Args[1].(string))
+	}
+	if len(paths) != 2 || paths[0] != "/v/recent-1" || paths[1] != "/v/recent-2" {
+		t.Errorf("expected the newest media to be downloaded first within the budget, got %v", paths)
+	}
+}
+
+func TestMediaPrewarmer_budget(t *testing.T) {
+	cfg := mediaPrewarmConfig{Window: 24 * time.Hour, MaxBytes: 3 << 20}
+	now := time.Unix(1700000000, 0)
+	var p MediaPrewarmer
+
+	// Media of unknown length is held at an estimate, then counted as downloaded
+	unknown := prewarmSize(MessagePayload{})
+	if !p.reserve(unknown, cfg, now) || !p.reserve(unknown, cfg, now) {
+		t.Fatal("expected two unknown-length files to fit")
+	}
+	if p.reserve(2<<20, cfg, now) {
+		t.Error("expected unknown-length files to count against the budget")
+	}
+	p.settle(unknown, 100)
+	p.settle(unknown, 2<<20)
+	if !p.reserve(1<<20-100, cfg, now) || p.reserve(1, cfg, now) {
+		t.Error("expected the budget to count the bytes actually downloaded")
+	}
+
+	// The budget fills up again once the window has passed
+	p.settle(1<<20-100, 1<<20-100)
+	if !p.reserve(3<<20, cfg, now.Add(24*time.Hour)) {
+		t.Error("expected a new window to start with the whole budget")
+	}
+}
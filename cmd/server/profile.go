@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// maxAboutLength is the longest about text WhatsApp accepts
+const maxAboutLength = 139
+
+// profilePhotoHandler replaces the account's own profile picture with a JPEG, or removes it
+func profilePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		ImageB64 string `json:"image_b64"`
+		Remove   bool   `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	var photo []byte
+	switch {
+	case req.Remove && req.ImageB64 != "":
+		errorResponse(w, http.StatusBadRequest, "image_b64 and remove are mutually exclusive")
+		return
+	case !req.Remove:
+		var err error
+		if photo, err = decodePhoto(req.ImageB64, "profile photo"); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	pictureID, err := session.Client.SetProfilePhoto(context.Background(), photo)
+	if errors.Is(err, whatsmeow.ErrInvalidImageFormat) {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to set profile photo: %v", err))
+		return
+	}
+
+	if req.Remove {
+		jsonResponse(w, map[string]interface{}{"removed": true})
+		return
+	}
+	jsonResponse(w, map[string]interface{}{
+		"picture_id": pictureID,
+	})
+}
+
+// profileAboutHandler sets the account's about text
+func profileAboutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		About  string `json:"about"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if utf8.RuneCountInString(req.About) > maxAboutLength {
+		errorResponse(w, http.StatusBadRequest, fmt.Sprintf("about must be at most %d characters", maxAboutLength))
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	if err := session.Client.SetStatusMessage(context.Background(), req.About); err != nil {
+		errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to set about: %v", err))
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"about": req.About,
+	})
+}
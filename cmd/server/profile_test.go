@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfilePhotoHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+	mock.GroupPhotoID = "1700000002"
+
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, image.NewGray(image.Rect(0, 0, 2, 2)), nil)
+	body, _ := json.Marshal(map[string]interface{}{"user_id": 1, "image_b64": base64.StdEncoding.EncodeToString(photo.Bytes())})
+	w := httptest.NewRecorder()
+	profilePhotoHandler(w, httptest.NewRequest(http.MethodPost, "/profile/photo", bytes.NewReader(body)))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("1700000002")) {
+		t.Fatalf("expected the new picture ID, got %d: %s", w.Code, w.Body.String())
+	}
+	if sent := mock.GetCallsByMethod("SetProfilePhoto")[0].Args[1].([]byte); !bytes.Equal(sent, photo.Bytes()) {
+		t.Error("expected the JPEG to be set as is")
+	}
+
+	w = httptest.NewRecorder()
+	profilePhotoHandler(w, httptest.NewRequest(http.MethodPost, "/profile/photo", bytes.NewBufferString(`{"user_id": 1, "remove": true}`)))
+	if w.Code != http.StatusOK || mock.GetCallsByMethod("SetProfilePhoto")[1].Args[1].([]byte) != nil {
+		t.Errorf("expected the photo to be removed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	profilePhotoHandler(w, httptest.NewRequest(http.MethodPost, "/profile/photo", bytes.NewBufferString(`{"user_id": 1, "image_b64": "bm90IGFuIGltYWdl"}`)))
+	if w.Code != http.StatusBadRequest || len(mock.GetCallsByMethod("SetProfilePhoto")) != 2 {
+		t.Errorf("expected a non-JPEG to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestProfileAboutHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	profileAboutHandler(w, httptest.NewRequest(http.MethodPost, "/profile/about", bytes.NewBufferString(`{"user_id": 1, "about": "Open 9-5 🕘"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if about := mock.GetCallsByMethod("SetStatusMessage")[0].Args[1].(string); about != "Open 9-5 🕘" {
+		t.Errorf("expected the about text to be set, got %q", about)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"user_id": 1, "about": strings.Repeat("a", maxAboutLength+1)})
+	w = httptest.NewRecorder()
+	profileAboutHandler(w, httptest.NewRequest(http.MethodPost, "/profile/about", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest || len(mock.GetCallsByMethod("SetStatusMessage")) != 1 {
+		t.Errorf("expected an overlong about to be refused, got %d", w.Code)
+	}
+}
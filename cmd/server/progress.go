@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// progressMinSize is the smallest media for which download progress events are emitted
+const progressMinSize = 1 << 20
+
+// progressStep is the minimum percentage increase between two progress reports
+const progressStep = 5
+
+// DownloadProgressPayload is emitted as a "download_progress" event while large media downloads
+type DownloadProgressPayload struct {
+	MessageID string `json:"message_id"`
+	ChatJID   string `json:"chat_jid"`
+	MediaType string `json:"media_type"`
+	Bytes     int64  `json:"bytes"`
+	Total     int64  `json:"total"`
+	Percent   int    `json:"percent"`
+}
+
+type downloadProgressKey struct{}
+
+// downloadProgressFunc is called with the bytes received so far and the expected total
+type downloadProgressFunc func(received, total int64)
+
+// withDownloadProgress attaches a progress callback that the media HTTP transport reports to
+func withDownloadProgress(ctx context.Context, fn downloadProgressFunc) context.Context {
+	return context.WithValue(ctx, downloadProgressKey{}, fn)
+}
+
+func downloadProgressFromContext(ctx context.Context) downloadProgressFunc {
+	fn, _ := ctx.Value(downloadProgressKey{}).(downloadProgressFunc)
+	return fn
+}
+
+// progressReader counts bytes read from a response body and reports every progressStep percent
+type progressReader struct {
+	io.ReadCloser
+	total       int64
+	received    int64
+	lastPercent int
+	report      downloadProgressFunc
+}
+
+func newProgressReader(body io.ReadCloser, total int64, report downloadProgressFunc) *progressReader {
+	return &progressReader{ReadCloser: body, total: total, lastPercent: -1, report: report}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.ReadCloser.Read(buf)
+	p.received += int64(n)
+	if p.total > 0 {
+		percent := int(p.received * 100 / p.total)
+		if percent >= p.lastPercent+progressStep || (err == io.EOF && percent != p.lastPercent) {
+			p.lastPercent = percent
+			p.report(p.received, p.total)
+		}
+	}
+	return n, err
+}
+
+// progressContext returns a context that emits download_progress events for the message,
+// or a plain background context when the media is too small to be worth tracking
+func (s *UserSession) progressContext(msgID, chatJID, mediaType string, fileLength uint64) context.Context {
+	ctx := context.Background()
+	if fileLength < progressMinSize {
+		return ctx
+	}
+	return withDownloadProgress(ctx, func(received, total int64) {
+		percent := int(received * 100 / total)
+		if percent > 100 {
+			percent = 100
+		}
+		s.emit(MessageEvent{
+			Type: "download_progress",
+			Payload: DownloadProgressPayload{
+				MessageID: msgID,
+				ChatJID:   chatJID,
+				MediaType: mediaType,
+				Bytes:     received,
+				Total:     total,
+				Percent:   percent,
+			},
+		})
+	})
+}
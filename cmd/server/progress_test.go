@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type stubRoundTripper struct {
+	body string
+}
+
+func (s stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Body:          io.NopCloser(strings.NewReader(s.body)),
+		ContentLength: int64(len(s.body)),
+	}, nil
+}
+
+func TestProgressReader(t *testing.T) {
+	var reports []int64
+	body := io.NopCloser(bytes.NewReader(make([]byte, 1000)))
+	r := newProgressReader(body, 1000, func(received, total int64) {
+		reports = append(reports, received)
+	})
+
+	buf := make([]byte, 10)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+
+	// One report at 0%-ish start plus one every 5% up to 100%
+	if len(reports) < 20 || len(reports) > 22 {
+		t.Errorf("expected ~21 reports, got %d", len(reports))
+	}
+	if reports[len(reports)-1] != 1000 {
+		t.Errorf("expected final report at 1000 bytes, got %d", reports[len(reports)-1])
+	}
+}
+
+func TestBaileysTransportReportsProgress(t *testing.T) {
+	transport := &baileysTransport{base: stubRoundTripper{body: strings.Repeat("x", 100)}}
+
+	var last int64
+	ctx := withDownloadProgress(context.Background(), func(received, total int64) {
+		last = received
+	})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://mmg.whatsapp.net/v/t62", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	io.ReadAll(resp.Body)
+
+	if last != 100 {
+		t.Errorf("expected progress to reach 100 bytes, got %d", last)
+	}
+}
+
+func TestUserSession_progressContext(t *testing.T) {
+	session := &UserSession{UserID: 1, EventChan: make(chan MessageEvent, 10)}
+
+	t.Run("small media is not tracked", func(t *testing.T) {
+		ctx := session.progressContext("msg-1", "chat@s.whatsapp.net", "video", 1024)
+		if downloadProgressFromContext(ctx) != nil {
+			t.Error("expected no progress callback for small media")
+		}
+	})
+
+	t.Run("large media emits download_progress events", func(t *testing.T) {
+		ctx := session.progressContext("msg-2", "chat@s.whatsapp.net", "video", 10<<20)
+		report := downloadProgressFromContext(ctx)
+		if report == nil {
+			t.Fatal("expected progress callback")
+		}
+		report(5<<20, 10<<20)
+
+		evt := <-session.EventChan
+		if evt.Type != "download_progress" {
+			t.Fatalf("expected download_progress, got %q", evt.Type)
+		}
+		payload := evt.Payload.(DownloadProgressPayload)
+		if payload.MessageID != "msg-2" || payload.Percent != 50 || payload.MediaType != "video" {
+			t.Errorf("unexpected payload: %+v", payload)
+		}
+	})
+}
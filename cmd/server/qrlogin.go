@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// How a QR login ended
+type qrOutcome int
+
+const (
+	qrPaired qrOutcome = iota
+	qrExpired
+	qrCancelled
+)
+
+// PairedPayload is emitted as a "paired" event when a QR login links the account
+type PairedPayload struct {
+	Phone        string `json:"phone"`
+	DeviceJID    string `json:"device_jid"`
+	LID          string `json:"lid,omitempty"`
+	Platform     string `json:"platform"` // of the phone, e.g. "android" or "smbi"
+	IsBusiness   bool   `json:"is_business"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+func (s *UserSession) emitPaired(evt *events.PairSuccess) {
+	payload := PairedPayload{
+		Phone:        evt.ID.User,
+		DeviceJID:    evt.ID.String(),
+		Platform:     evt.Platform,
+		IsBusiness:   evt.BusinessName != "",
+		BusinessName: evt.BusinessName,
+	}
+	if !evt.LID.IsEmpty() {
+		payload.LID = evt.LID.String()
+	}
+	log.Printf("📱 User %d paired as %s (%s)", s.UserID, payload.DeviceJID, payload.Platform)
+	s.emit(MessageEvent{Type: "paired", Payload: payload})
+}
+
+// QRCodePayload is POSTed as a "qr" event to webhooks that take QR codes
+type QRCodePayload struct {
+	Code      string `json:"code"`
+	ExpiresAt int64  `json:"expires_at"` // unix seconds; a new code follows unless the login ends
+}
+
+// webhookQR POSTs a QR login event to the session's webhook if it takes QR codes. These
+// don't go through emit: they're only of use while the login runs, so they're neither
+// logged nor queued for the event stream, which has /sessions/qr as its counterpart.
+func (s *UserSession) webhookQR(evt MessageEvent) {
+	if s.Webhook.Get().QRCodes {
+		s.Webhook.enqueue(s.Context(), s.UserID, evt)
+	}
+}
+
+// startQRLogin connects an unpaired session and relays its QR codes to QRChannel until
+// the phone pairs or the codes run out, in which case QRExpired is signalled. It does
+// nothing if a QR login is already running.
+func (s *UserSession) startQRLogin() error {
+	s.qrMu.Lock()
+	defer s.qrMu.Unlock()
+	if s.qrCancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	qrChan, err := s.Client.GetQRChannel(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	// Codes left over from an expired flow can't be scanned anymore
+drain:
+	for {
+		select {
+		case <-s.QRChannel:
+		case <-s.QRExpired:
+		case <-s.QRCancelled:
+		default:
+			break drain
+		}
+	}
+	s.ConnHistory.Record(ConnStateConnectAttempt, "qr login")
+	if err := s.Client.Connect(); err != nil && !strings.Contains(err.Error(), "already connected") {
+		cancel()
+		return err
+	}
+	ready := make(chan struct{})
+	markReady := sync.OnceFunc(func() { close(ready) })
+	s.qrCancel, s.qrReady = cancel, ready
+
+	go func() {
+		outcome := s.relayQRCodes(ctx, qrChan, markReady)
+		markReady()
+		s.qrMu.Lock()
+		s.qrCancel = nil
+		s.qrMu.Unlock()
+		cancel()
+
+		ended := s.QRExpired
+		switch outcome {
+		case qrPaired:
+			return
+		case qrCancelled:
+			ended = s.QRCancelled
+		default:
+			s.webhookQR(MessageEvent{Type: "qr_expired", Payload: struct{}{}})
+		}
+		select {
+		case ended <- struct{}{}:
+		default:
+		}
+	}()
+	return nil
+}
+
+// relayQRCodes forwards codes from whatsmeow until the flow ends or ctx is cancelled,
+// calling ready on the first
+func (s *UserSession) relayQRCodes(ctx context.Context, qrChan <-chan whatsmeow.QRChannelItem, ready func()) qrOutcome {
+	for {
+		select {
+		case <-ctx.Done():
+			return qrCancelled
+		case evt, ok := <-qrChan:
+			if !ok {
+				return qrExpired
+			}
+			switch evt.Event {
+			case whatsmeow.QRChannelEventCode:
+				ready()
+				select {
+				case s.QRChannel <- evt.Code:
+				default:
+				}
+				s.webhookQR(MessageEvent{Type: "qr", Payload: QRCodePayload{
+					Code:      evt.Code,
+					ExpiresAt: time.Now().Add(evt.Timeout).Unix(),
+				}})
+			case whatsmeow.QRChannelSuccess.Event:
+				select {
+				case s.LoginDone <- true:
+				default:
+				}
+				return qrPaired
+			default:
+				log.Printf("QR login for user %d ended: %s %v", s.UserID, evt.Event, evt.Error)
+				return qrExpired
+			}
+		}
+	}
+}
+
+// pairClientDisplayName is how the login shows on the phone; WhatsApp only accepts
+// "Browser (OS)" names of common browsers
+const pairClientDisplayName = "Chrome (Linux)"
+
+// PairCodePayload is POSTed as a "pair_code" event to webhooks that take QR codes
+type PairCodePayload struct {
+	Code string `json:"code"`
+}
+
+// pairPhone starts a QR login if none is running and asks for a code that links phone
+// when entered under Linked devices, for phones that can't scan the QR code. The code
+// is also POSTed to webhooks that take QR codes.
+func (s *UserSession) pairPhone(ctx context.Context, phone string) (string, error) {
+	if err := s.startQRLogin(); err != nil {
+		return "", err
+	}
+	s.qrMu.Lock()
+	ready := s.qrReady
+	s.qrMu.Unlock()
+	// WhatsApp only takes the request once the login's connection is up, which the
+	// first QR code shows
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	code, err := s.Client.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, pairClientDisplayName)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("📱 Pairing code generated for user %d", s.UserID)
+	s.webhookQR(MessageEvent{Type: "pair_code", Payload: PairCodePayload{Code: code}})
+	return code, nil
+}
+
+// pairCodeHandler links a session by phone number instead of QR code: it answers the
+// code to enter on the phone, which also gets a notification asking for it
+func pairCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Phone  string `json:"phone"` // international format, e.g. "+15551234567"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.UserID == 0 || req.Phone == "" {
+		errorResponse(w, http.StatusBadRequest, "user_id and phone required")
+		return
+	}
+
+	session, err := manager.GetOrCreateSession(req.UserID)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if session.Client.GetStore().GetID() != nil {
+		errorResponse(w, http.StatusConflict, "session is already linked")
+		return
+	}
+
+	code, err := session.pairPhone(r.Context(), req.Phone)
+	switch {
+	case errors.Is(err, whatsmeow.ErrPhoneNumberTooShort), errors.Is(err, whatsmeow.ErrPhoneNumberIsNotInternational):
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		errorResponse(w, http.StatusGatewayTimeout, "login didn't connect in time")
+		return
+	case err != nil:
+		errorResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	jsonResponse(w, map[string]string{"code": code})
+}
+
+// cancelQRLogin aborts a running QR login and disconnects the unpaired client, reporting
+// whether there was one to cancel
+func (s *UserSession) cancelQRLogin() bool {
+	s.qrMu.Lock()
+	cancel := s.qrCancel
+	s.qrMu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	s.Client.Disconnect()
+	s.ConnHistory.Record(ConnStateDisconnected, "qr login cancelled")
+	return true
+}
+
+func cancelQRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	status := "not_running"
+	if session.cancelQRLogin() {
+		log.Printf("📱 QR login cancelled for user %d", userID)
+		status = "cancelled"
+	}
+	jsonResponse(w, map[string]string{"status": status})
+}
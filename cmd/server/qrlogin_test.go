@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestGetQRHandler_RestartsExpiredLogin(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewMockClient()
+	mock.QRItems = [][]whatsmeow.QRChannelItem{
+		{{Event: whatsmeow.QRChannelEventCode, Code: "code-1"}, whatsmeow.QRChannelTimeout},
+		{{Event: whatsmeow.QRChannelEventCode, Code: "code-2"}, whatsmeow.QRChannelSuccess},
+	}
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	getQRHandler(w, httptest.NewRequest(http.MethodGet, "/sessions/qr?user_id=1", nil))
+
+	if !strings.Contains(w.Body.String(), "event: success") {
+		t.Errorf("expected the stream to end in success, got %q", w.Body.String())
+	}
+	if n := len(mock.GetCallsByMethod("GetQRChannel")); n != 2 {
+		t.Errorf("expected a second login after the first expired, got %d", n)
+	}
+	if n := len(mock.GetCallsByMethod("Connect")); n != 2 {
+		t.Errorf("expected each login to connect, got %d", n)
+	}
+}
+
+func TestGetQRHandler_AlreadyPaired(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	getQRHandler(w, httptest.NewRequest(http.MethodGet, "/sessions/qr?user_id=1", nil))
+
+	if !strings.Contains(w.Body.String(), "event: success") || len(mock.GetCallsByMethod("GetQRChannel")) != 0 {
+		t.Errorf("expected immediate success without a QR login, got %q", w.Body.String())
+	}
+}
+
+func TestStartQRLogin_OnlyOnce(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewMockClient()
+	session := injectMockSession(manager, 1, mock)
+
+	for i := 0; i < 3; i++ {
+		if err := session.startQRLogin(); err != nil {
+			t.Fatalf("startQRLogin failed: %v", err)
+		}
+	}
+	if n := len(mock.GetCallsByMethod("GetQRChannel")); n != 1 {
+		t.Errorf("expected one QR login while it's running, got %d", n)
+	}
+}
+
+func TestCancelQRHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewMockClient()
+	injectMockSession(manager, 1, mock)
+
+	cancel := func() string {
+		w := httptest.NewRecorder()
+		cancelQRHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/qr/cancel?user_id=1", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp["status"]
+	}
+	if status := cancel(); status != "not_running" {
+		t.Errorf("expected nothing to cancel, got %q", status)
+	}
+
+	stream := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		getQRHandler(stream, httptest.NewRequest(http.MethodGet, "/sessions/qr?user_id=1", nil))
+		close(done)
+	}()
+	// Retry until the stream has started its login
+	for deadline := time.Now().Add(time.Second); cancel() != "cancelled"; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the running login to be cancelled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the QR stream to end")
+	}
+	if !strings.Contains(stream.Body.String(), "event: cancelled") {
+		t.Errorf("expected a cancelled event, got %q", stream.Body.String())
+	}
+	if len(mock.GetCallsByMethod("Disconnect")) != 1 {
+		t.Error("expected the client to be disconnected")
+	}
+	if len(mock.GetCallsByMethod("GetQRChannel")) != 1 {
+		t.Error("expected a cancelled login not to be restarted")
+	}
+}
+
+func TestHandleEvent_PairSuccessEmitsPaired(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewMockClient())
+
+	session.handleEvent(&events.PairSuccess{
+		ID:           types.NewADJID("15551234567", 0, 3),
+		LID:          types.NewJID("123456789", types.HiddenUserServer),
+		Platform:     "smba",
+		BusinessName: "Acme",
+	})
+
+	select {
+	case evt := <-session.EventChan:
+		payload, ok := evt.Payload.(PairedPayload)
+		if evt.Type != "paired" || !ok {
+			t.Fatalf("expected a paired event, got %+v", evt)
+		}
+		if payload.Phone != "15551234567" || payload.DeviceJID != "15551234567:3@s.whatsapp.net" || !payload.IsBusiness || payload.Platform != "smba" {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+	default:
+		t.Fatal("expected an event to be emitted")
+	}
+}
+
+func TestStartQRLogin_PostsCodesToWebhook(t *testing.T) {
+	received := make(chan webhookDelivery, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var delivery webhookDelivery
+		json.NewDecoder(r.Body).Decode(&delivery)
+		received <- delivery
+	}))
+	defer hook.Close()
+
+	manager = setupTestManager(t)
+	mock := NewMockClient()
+	mock.QRItems = [][]whatsmeow.QRChannelItem{
+		{{Event: whatsmeow.QRChannelEventCode, Code: "code-1", Timeout: time.Minute}, whatsmeow.QRChannelTimeout},
+	}
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	createSessionHandler(w, httptest.NewRequest(http.MethodPost, "/sessions",
+		strings.NewReader(`{"user_id": 1, "webhook": {"url": "`+hook.URL+`", "qr_codes": true}}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, want := range []string{"qr", "qr_expired"} {
+		select {
+		case delivery := <-received:
+			if delivery.Type != want || delivery.UserID != 1 {
+				t.Errorf("expected a %s event, got %+v", want, delivery)
+			}
+			if payload, _ := delivery.Payload.(map[string]interface{}); want == "qr" && (payload["code"] != "code-1" || payload["expires_at"] == nil) {
+				t.Errorf("expected the code and its expiry, got %v", delivery.Payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected a %s event to be posted", want)
+		}
+	}
+}
+
+func TestPairCodeHandler(t *testing.T) {
+	received := make(chan webhookDelivery, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var delivery webhookDelivery
+		json.NewDecoder(r.Body).Decode(&delivery)
+		received <- delivery
+	}))
+	defer hook.Close()
+
+	manager = setupTestManager(t)
+	mock := NewMockClient()
+	mock.QRItems = [][]whatsmeow.QRChannelItem{{{Event: whatsmeow.QRChannelEventCode, Code: "code-1", Timeout: time.Minute}}}
+	mock.PairCode = "ABCD-EFGH"
+	session := injectMockSession(manager, 1, mock)
+	session.Webhook.Set(WebhookConfig{URL: hook.URL, QRCodes: true})
+
+	w := httptest.NewRecorder()
+	pairCodeHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/pair-code",
+		strings.NewReader(`{"user_id": 1, "phone": "+1 555 123 4567"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ABCD-EFGH"`) {
+		t.Fatalf("expected the pairing code, got %d: %s", w.Code, w.Body.String())
+	}
+	if calls := mock.GetCallsByMethod("PairPhone"); len(calls) != 1 || calls[0].Args[1] != "+1 555 123 4567" {
+		t.Errorf("expected the code to be asked for the phone, got %+v", calls)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for posted := false; !posted; {
+		select {
+		case delivery := <-received:
+			if posted = delivery.Type == "pair_code"; posted {
+				if payload, _ := delivery.Payload.(map[string]interface{}); payload["code"] != "ABCD-EFGH" {
+					t.Errorf("expected the code to be posted, got %v", delivery.Payload)
+				}
+			}
+		case <-deadline:
+			t.Fatal("expected a pair_code event to be posted")
+		}
+	}
+
+	linked := NewLoggedInMockClient()
+	injectMockSession(manager, 2, linked)
+	w = httptest.NewRecorder()
+	pairCodeHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/pair-code",
+		strings.NewReader(`{"user_id": 2, "phone": "+15551234567"}`)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a linked session, got %d", w.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// quotedMediaHandler downloads the media of a message quoted by a reply, identified by
+// the reply's chat and quoted_id, using the keys stored with the original message
+func quotedMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		ChatJID  string `json:"chat_jid"`
+		QuotedID string `json:"quoted_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.QuotedID == "" {
+		errorResponse(w, http.StatusBadRequest, "quoted_id required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	original, err := session.Messages.Get(r.Context(), jid.String(), req.QuotedID)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if original == nil {
+		errorResponse(w, http.StatusNotFound, "quoted message not found")
+		return
+	}
+	if len(original.MediaKey) == 0 || original.DirectPath == "" {
+		errorResponse(w, http.StatusBadRequest, "quoted message has no media")
+		return
+	}
+
+	// The original may still be cached from when it arrived; leave it there, since it's
+	// also the message's own media
+	session.MediaMu.RLock()
+	data, cached := session.MediaCache[original.ID]
+	session.MediaMu.RUnlock()
+	if !cached {
+		log.Printf("[media/quoted] Downloading %s quoted in %s for user %d", original.ID, original.ChatJID, req.UserID)
+		if data, err = session.downloadMediaWithRetry(original.DirectPath, original.FileEncSHA256, original.FileSHA256, original.MediaKey, original.MimeType); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !session.scanDownloadedMedia(original.ID, original.ChatJID, data) {
+			errorResponse(w, http.StatusForbidden, "media withheld by virus scan")
+			return
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"data":       base64.StdEncoding.EncodeToString(data),
+		"mime_type":  original.MimeType,
+		"media_type": original.MediaType,
+		"size":       len(data),
+	})
+}
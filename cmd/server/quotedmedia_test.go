@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandleEvent_ReplySetsQuotedID(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+
+	session.handleEvent(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:   types.NewJID("111", types.DefaultUserServer),
+				Sender: types.NewJID("111", types.DefaultUserServer),
+			},
+			ID: "REPLY1",
+		},
+		Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String("nice photo"),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:    proto.String("PHOTO1"),
+				Participant: proto.String("222@s.whatsapp.net"),
+			},
+		}},
+	})
+
+	evt := <-session.EventChan
+	payload := evt.Payload.(MessagePayload)
+	if payload.QuotedID != "PHOTO1" || payload.QuotedSender != "222@s.whatsapp.net" {
+		t.Errorf("expected the quoted message to be set, got %q from %q", payload.QuotedID, payload.QuotedSender)
+	}
+}
+
+func TestQuotedMediaHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.DownloadData = []byte("jpeg-bytes")
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	session.Messages.Save(t.Context(), MessagePayload{ID: "PHOTO1", ChatJID: "111@s.whatsapp.net", MediaType: "image", MimeType: "image/jpeg",
+		DirectPath: "/v/t62/abc", MediaKey: []byte{1}, Timestamp: 100})
+	session.Messages.Save(t.Context(), MessagePayload{ID: "TEXT1", ChatJID: "111@s.whatsapp.net", Text: "no media", Timestamp: 101})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		quotedMediaHandler(w, httptest.NewRequest(http.MethodPost, "/media/quoted", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net", "quoted_id": "nope"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown message, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net", "quoted_id": "TEXT1"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a message without media, got %d", w.Code)
+	}
+
+	w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net", "quoted_id": "PHOTO1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data     []byte `json:"data"`
+		MimeType string `json:"mime_type"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if string(resp.Data) != "jpeg-bytes" || resp.MimeType != "image/jpeg" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	calls := mock.GetCallsByMethod("DownloadMediaWithPath")
+	if len(calls) != 1 || calls[0].Args[1].(string) != "/v/t62/abc" {
+		t.Errorf("expected a download by the stored direct path, got %+v", calls)
+	}
+}
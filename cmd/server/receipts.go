@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ReceiptPayload is emitted as a "receipt" event
+type ReceiptPayload = core.ReceiptPayload
+
+// emitReceipt publishes a delivery, read or played receipt for sent messages
+func (s *UserSession) emitReceipt(v *events.Receipt) {
+	if !s.chatAllowed(v.Chat) {
+		return
+	}
+	if payload, ok := core.NewReceiptPayload(v); ok {
+		s.emit(core.NewEvent(payload))
+	}
+}
+
+func markReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID     int      `json:"user_id"`
+		ChatJID    string   `json:"chat_jid"`
+		MessageIDs []string `json:"message_ids"`
+		// SenderJID is required in groups, where all the messages must be from this sender
+		SenderJID string `json:"sender_jid,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.MessageIDs) == 0 {
+		errorResponse(w, http.StatusBadRequest, "message_ids required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	sender := types.EmptyJID
+	if req.SenderJID != "" {
+		if sender, err = types.ParseJID(req.SenderJID); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid sender_jid")
+			return
+		}
+	} else if jid.Server == types.GroupServer {
+		errorResponse(w, http.StatusBadRequest, "sender_jid required for groups")
+		return
+	}
+
+	if err := session.Client.MarkRead(context.Background(), req.MessageIDs, time.Now(), jid, sender); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	jsonResponse(w, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestMarkReadHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		markReadHandler(w, httptest.NewRequest(http.MethodPost, "/messages/read", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "chat_jid": "111@s.whatsapp.net"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without message_ids, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "chat_jid": "120363000000000000@g.us", "message_ids": ["A"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a group without sender_jid, got %d", w.Code)
+	}
+
+	w := post(`{"user_id": 1, "chat_jid": "120363000000000000@g.us", "message_ids": ["A", "B"], "sender_jid": "222@s.whatsapp.net"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	calls := mock.GetCallsByMethod("MarkRead")
+	if len(calls) != 1 {
+		t.Fatalf("expected one MarkRead call, got %d", len(calls))
+	}
+	ids := calls[0].Args[1].([]types.MessageID)
+	if len(ids) != 2 || calls[0].Args[3].(types.JID).Server != types.GroupServer || calls[0].Args[4].(types.JID).User != "222" {
+		t.Errorf("unexpected MarkRead args %+v", calls[0].Args)
+	}
+}
+
+func TestHandleEvent_Receipt(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	chat := types.NewJID("111", types.DefaultUserServer)
+	receipt := func(receiptType types.ReceiptType, fromMe bool) *events.Receipt {
+		return &events.Receipt{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat, IsFromMe: fromMe},
+			MessageIDs:    []types.MessageID{"A", "B"},
+			Timestamp:     time.Unix(1700000000, 0),
+			Type:          receiptType,
+		}
+	}
+
+	// Retries and the user's own reads on other devices aren't reported
+	session.handleEvent(receipt(types.ReceiptTypeRetry, false))
+	session.handleEvent(receipt(types.ReceiptTypeRead, true))
+	session.handleEvent(receipt(types.ReceiptTypeRead, false))
+
+	evt := <-session.EventChan
+	payload, ok := evt.Payload.(ReceiptPayload)
+	if evt.Type != "receipt" || !ok {
+		t.Fatalf("expected a receipt event, got %+v", evt)
+	}
+	if payload.Status != "read" || len(payload.MessageIDs) != 2 || payload.RecipientJID != chat.String() || payload.Timestamp != 1700000000 {
+		t.Errorf("unexpected receipt %+v", payload)
+	}
+	if len(session.EventChan) != 0 {
+		t.Errorf("expected only the read receipt to be emitted, %d more queued", len(session.EventChan))
+	}
+}
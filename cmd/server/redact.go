@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+)
+
+// redactEvent strips what was said or sent from an event, leaving who, where, when and
+// what kind: message text, captions, media and its download keys, locations, contacts,
+// poll options, translations, transcripts, image analysis and the text of sends held
+// for approval. Events without content are returned as they are.
+func redactEvent(evt MessageEvent) MessageEvent {
+	switch p := evt.Payload.(type) {
+	case MessagePayload:
+		evt.Payload = redactMessage(p)
+	case TranscriptionPayload:
+		p.Text = ""
+		evt.Payload = p
+	case ImageAnalysisPayload:
+		p.Text, p.Labels = "", nil
+		evt.Payload = p
+	case PollVotePayload:
+		p.Options, p.OptionHashes = []string{}, nil
+		evt.Payload = p
+	case ApprovalPayload:
+		p.Text = ""
+		evt.Payload = p
+	}
+	return evt
+}
+
+// redactMessage keeps a message's metadata: IDs, sender, chat, timestamps, media type
+// and size, and the flags the server sets
+func redactMessage(p MessagePayload) MessagePayload {
+	return MessagePayload{
+		ID:                 p.ID,
+		ChatJID:            p.ChatJID,
+		SenderJID:          p.SenderJID,
+		SenderName:         p.SenderName,
+		Timestamp:          p.Timestamp,
+		TimestampFormatted: p.TimestampFormatted,
+		IsFromMe:           p.IsFromMe,
+		IsSelfChat:         p.IsSelfChat,
+		MentionsMe:         p.MentionsMe,
+		QuotedID:           p.QuotedID,
+		QuotedSender:       p.QuotedSender,
+		ChatMuted:          p.ChatMuted,
+		ChatArchived:       p.ChatArchived,
+		ChatLabelIDs:       p.ChatLabelIDs,
+		LabelIDs:           p.LabelIDs,
+		MediaType:          p.MediaType,
+		MimeType:           p.MimeType,
+		FileLength:         p.FileLength,
+		IsPTT:              p.IsPTT,
+		IsAnimated:         p.IsAnimated,
+		IsViewOnce:         p.IsViewOnce,
+		SystemType:         p.SystemType,
+		EphemeralTimer:     p.EphemeralTimer,
+		Tags:               p.Tags,
+		Language:           p.Language,
+		Redacted:           true,
+	}
+}
+
+// RedactionSetting is whether a session's events leave the server without their content
+type RedactionSetting struct {
+	persistedSetting[redactionConfig]
+}
+
+type redactionConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Enabled reports whether events are redacted
+func (r *RedactionSetting) Enabled() bool {
+	return r.Get().Enabled
+}
+
+// redactionHandler reads (GET) or sets (POST) whether a session's events, on every
+// output, carry metadata only
+func redactionHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[redactionConfig]{
+		name:    "redaction setting",
+		setting: func(s *UserSession) settingStore[redactionConfig] { return &s.Redaction },
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestRedactEvent(t *testing.T) {
+	evt := redactEvent(MessageEvent{Type: "message", Payload: MessagePayload{
+		ID: "M1", ChatJID: "123@g.us", SenderJID: "15551234567@s.whatsapp.net", Timestamp: 1700000000,
+		Text: "secret", Caption: "also secret", MediaType: "image", MimeType: "image/jpeg", FileLength: 2048,
+		MediaKey: []byte{1}, DirectPath: "/v/t62", Latitude: 52.5, Translation: "geheim",
+	}})
+	p := evt.Payload.(MessagePayload)
+	if p.Text != "" || p.Caption != "" || p.MediaKey != nil || p.DirectPath != "" || p.Latitude != 0 || p.Translation != "" {
+		t.Errorf("expected the content to be stripped, got %+v", p)
+	}
+	if p.ID != "M1" || p.SenderJID == "" || p.Timestamp != 1700000000 || p.MediaType != "image" || p.FileLength != 2048 || !p.Redacted {
+		t.Errorf("expected the metadata to be kept, got %+v", p)
+	}
+
+	if p := redactEvent(MessageEvent{Type: "transcription", Payload: TranscriptionPayload{MessageID: "M2", Text: "hello"}}).Payload.(TranscriptionPayload); p.Text != "" || p.MessageID != "M2" {
+		t.Errorf("expected the transcript to be stripped, got %+v", p)
+	}
+	receipt := MessageEvent{Type: "flood_detected", Payload: FloodPayload{ChatJID: "123@g.us", Count: 9}}
+	if got := redactEvent(receipt); got.Payload != receipt.Payload {
+		t.Errorf("expected an event without content to be left alone, got %+v", got)
+	}
+}
+
+func TestUserSession_emit_Redacted(t *testing.T) {
+	session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10), Messages: newTestMessageStore(t)}
+	session.Redaction.load(filepath.Join(t.TempDir(), "redaction.json"))
+	if _, err := session.Redaction.Set(redactionConfig{Enabled: true}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	session.handleEvent(incomingText(chat, "M1", "my PIN is 1234"))
+
+	payload := (<-session.EventChan).Payload.(MessagePayload)
+	if payload.Text != "" || payload.ID != "M1" || !payload.Redacted {
+		t.Errorf("expected a metadata-only message, got %+v", payload)
+	}
+	logged, err := session.Messages.EventsAfter(t.Context(), 0, 0, 10)
+	if err != nil || len(logged) != 1 || bytes.Contains(logged[0].Payload.(json.RawMessage), []byte("PIN")) {
+		t.Errorf("expected the logged event to be redacted too, got %v (%v)", logged, err)
+	}
+}
+
+func TestWebhook_redacts(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer hook.Close()
+
+	var h Webhook
+	h.Set(WebhookConfig{URL: hook.URL, Redact: true})
+	h.enqueue(context.Background(), 5, MessageEvent{Type: "message", Payload: MessagePayload{ID: "abc", Text: "my PIN is 1234"}})
+
+	select {
+	case body := <-bodies:
+		var delivery struct {
+			Payload MessagePayload `json:"payload"`
+		}
+		json.Unmarshal(body, &delivery)
+		if delivery.Payload.ID != "abc" || delivery.Payload.Text != "" || !delivery.Payload.Redacted {
+			t.Errorf("expected a redacted delivery, got %s", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the event to be delivered")
+	}
+}
+
+func TestUserSession_routeMessage_Redacted(t *testing.T) {
+	received := make(chan RoutedMessage, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg RoutedMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer srv.Close()
+	useConfig(t, `{"routing": {"rules": [{"tag": "invoices", "keywords": ["invoice"], "webhook": "`+srv.URL+`"}]}}`)
+
+	session := &UserSession{UserID: 5, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+	session.Redaction.Set(redactionConfig{Enabled: true})
+	session.handleEvent(incomingText(types.NewJID("15551234567", types.DefaultUserServer), "M1", "invoice for account 1234"))
+
+	select {
+	case msg := <-received:
+		if msg.Message.ID != "M1" || msg.Message.Text != "" || !msg.Message.Redacted || msg.Tag != "invoices" {
+			t.Errorf("expected a redacted routed message, got %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the routing webhook to be called")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// relinkDeleteWait is how long a logged-out session waits for whatsmeow to delete the
+// device record before deleting it itself
+var relinkDeleteWait = 5 * time.Second
+
+// NeedsRelinkPayload is emitted as a "needs_relink" event when WhatsApp rejects a
+// session, e.g. because it was unlinked on the phone or a stale backup was restored.
+// A new QR login has already been started; open /sessions/qr to show its codes.
+type NeedsRelinkPayload struct {
+	Reason    string `json:"reason"`
+	OnConnect bool   `json:"on_connect"` // rejected while connecting rather than kicked off later
+}
+
+// relink wipes a logged-out session's device and its jo_bot backup, so the dead session
+// isn't restored and retried on the next start, and moves the session to a QR login
+func (m *SessionManager) relink(s *UserSession, evt *events.LoggedOut) {
+	log.Printf("⚠️ User %d was logged out (%s), resetting for a new link", s.UserID, evt.Reason)
+	s.Client.Disconnect()
+
+	// whatsmeow deletes the device right after dispatching the event
+	store := s.Client.GetStore()
+	for deadline := time.Now().Add(relinkDeleteWait); store.GetID() != nil && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if store.GetID() != nil {
+		if err := store.Delete(context.Background()); err != nil {
+			log.Printf("Failed to delete logged-out device for user %d: %v", s.UserID, err)
+			return
+		}
+	}
+
+	os.Remove(m.syncStatePath(s.UserID))
+	if err := m.deleteSessionFromJoBot(s.UserID); err != nil {
+		log.Printf("Warning: failed to delete jo_bot backup for user %d: %v", s.UserID, err)
+	}
+
+	s.emit(MessageEvent{Type: "needs_relink", Payload: NeedsRelinkPayload{
+		Reason:    evt.Reason.String(),
+		OnConnect: evt.OnConnect,
+	}})
+	if err := s.startQRLogin(); err != nil {
+		log.Printf("Failed to start QR login for user %d: %v", s.UserID, err)
+	}
+}
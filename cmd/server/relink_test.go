@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestRelinkAfterLogout(t *testing.T) {
+	deleted := make(chan string, 1)
+	joBot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted <- r.URL.Query().Get("user_id")
+		}
+	}))
+	defer joBot.Close()
+	prev := relinkDeleteWait
+	relinkDeleteWait = 0
+	t.Cleanup(func() { relinkDeleteWait = prev })
+
+	manager = NewSessionManager(t.TempDir(), joBot.URL, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 7, mock)
+
+	session.handleEvent(&events.LoggedOut{OnConnect: true, Reason: events.ConnectFailureLoggedOut})
+
+	select {
+	case evt := <-session.EventChan:
+		payload, ok := evt.Payload.(NeedsRelinkPayload)
+		if evt.Type != "needs_relink" || !ok || !payload.OnConnect {
+			t.Fatalf("expected a needs_relink event, got %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a needs_relink event")
+	}
+	select {
+	case userID := <-deleted:
+		if userID != "7" {
+			t.Errorf("expected user 7's backup to be deleted, got %q", userID)
+		}
+	default:
+		t.Error("expected the jo_bot backup to be deleted")
+	}
+	if mock.GetStore().GetID() != nil {
+		t.Error("expected the device record to be wiped")
+	}
+	// The QR login starts right after the event
+	for deadline := time.Now().Add(time.Second); len(mock.GetCallsByMethod("GetQRChannel")) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a new QR login")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(mock.GetCallsByMethod("Disconnect")) == 0 {
+		t.Error("expected the rejected connection to be dropped")
+	}
+}
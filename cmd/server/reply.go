@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+var errQuotedSenderUnknown = errors.New("quoted message not in history; quoted_sender required")
+
+// quotedMessage rebuilds enough of a stored message for WhatsApp to render it in a
+// reply's quote: its text, or the kind of media with its caption
+func quotedMessage(p MessagePayload) *waE2E.Message {
+	switch p.MediaType {
+	case "image":
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String(p.Caption), Mimetype: proto.String(p.MimeType)}}
+	case "video":
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{Caption: proto.String(p.Caption), Mimetype: proto.String(p.MimeType)}}
+	case "document":
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Caption: proto.String(p.Caption), FileName: proto.String(p.FileName), Mimetype: proto.String(p.MimeType),
+		}}
+	case "audio", "ptt":
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{PTT: proto.Bool(p.IsPTT), Mimetype: proto.String(p.MimeType)}}
+	case "sticker":
+		return &waE2E.Message{StickerMessage: &waE2E.StickerMessage{IsAnimated: proto.Bool(p.IsAnimated), Mimetype: proto.String(p.MimeType)}}
+	case "location":
+		return &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude: proto.Float64(p.Latitude), DegreesLongitude: proto.Float64(p.Longitude), Address: proto.String(p.Address),
+		}}
+	case "contact":
+		return &waE2E.Message{ContactMessage: &waE2E.ContactMessage{DisplayName: proto.String(p.ContactName), Vcard: proto.String(p.ContactVCard)}}
+	}
+	return &waE2E.Message{Conversation: proto.String(p.Text)}
+}
+
+// replyContext builds the ContextInfo of a reply to message id in chat. The quoted
+// text and sender default to what history has of the message; in a direct chat a
+// message that isn't stored is taken to be the other person's. Groups need to know
+// who wrote it, or the quote is attributed to the group itself.
+func (s *UserSession) replyContext(ctx context.Context, chat types.JID, id, quotedText string, quotedSender types.JID) (*waE2E.ContextInfo, error) {
+	stored, err := s.Messages.Get(ctx, chat.String(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := quotedSender
+	if sender.IsEmpty() && stored != nil {
+		if stored.IsFromMe {
+			if own := s.Client.GetStore().GetID(); own != nil {
+				sender = own.ToNonAD()
+			}
+		} else if jid, err := types.ParseJID(stored.SenderJID); err == nil {
+			sender = jid.ToNonAD()
+		}
+	}
+	if sender.IsEmpty() {
+		if chat.Server == types.GroupServer {
+			return nil, errQuotedSenderUnknown
+		}
+		sender = chat
+	}
+
+	quoted := &waE2E.Message{Conversation: proto.String(quotedText)}
+	if quotedText == "" && stored != nil {
+		quoted = quotedMessage(*stored)
+	}
+	return &waE2E.ContextInfo{
+		StanzaID:      proto.String(id),
+		Participant:   proto.String(sender.String()),
+		QuotedMessage: quoted,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+func TestSendMessageHandler_ReplyQuote(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	group := "120363000000000001@g.us"
+	session.Messages.Save(context.Background(), MessagePayload{
+		ID: "PHOTO1", ChatJID: group, SenderJID: "15551112222@s.whatsapp.net", Timestamp: 1700000000,
+		MediaType: "image", MimeType: "image/jpeg", Caption: "the view",
+	})
+
+	send := func(body string) (*httptest.ResponseRecorder, *waE2E.ContextInfo) {
+		w := httptest.NewRecorder()
+		sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(body)))
+		calls := mock.GetCallsByMethod("SendMessage")
+		if w.Code != http.StatusOK || len(calls) == 0 {
+			return w, nil
+		}
+		return w, calls[len(calls)-1].Args[2].(*waE2E.Message).GetExtendedTextMessage().GetContextInfo()
+	}
+
+	// From history: the group member who sent it, and the photo with its caption
+	w, info := send(`{"user_id": 1, "chat_jid": "` + group + `", "text": "nice", "reply_to": "PHOTO1"}`)
+	if info.GetStanzaID() != "PHOTO1" || info.GetParticipant() != "15551112222@s.whatsapp.net" ||
+		info.GetQuotedMessage().GetImageMessage().GetCaption() != "the view" {
+		t.Errorf("expected the stored photo quoted from its sender, got %d %v", w.Code, info)
+	}
+
+	// Given by the caller
+	w, info = send(`{"user_id": 1, "chat_jid": "` + group + `", "text": "yes", "reply_to": "OLD", "quoted_text": "lunch?", "quoted_sender": "15553334444@s.whatsapp.net"}`)
+	if info.GetParticipant() != "15553334444@s.whatsapp.net" || info.GetQuotedMessage().GetConversation() != "lunch?" {
+		t.Errorf("expected the given quote, got %d %v", w.Code, info)
+	}
+
+	// A group message history doesn't have can't be attributed
+	w, _ = send(`{"user_id": 1, "chat_jid": "` + group + `", "text": "yes", "reply_to": "OLD"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a quoted_sender, got %d: %s", w.Code, w.Body.String())
+	}
+	w, _ = send(`{"user_id": 1, "chat_jid": "` + group + `", "text": "yes", "reply_to": "OLD", "quoted_sender": "@@"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid quoted_sender, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Our own message in a direct chat is quoted as ours
+	session.Messages.Save(context.Background(), MessagePayload{
+		ID: "MINE", ChatJID: "15557654321@s.whatsapp.net", IsFromMe: true, Text: "see you at 8", Timestamp: 1700000000,
+	})
+	w, info = send(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "text": "make it 9", "reply_to": "MINE"}`)
+	own := mock.GetStore().GetID().ToNonAD().String()
+	if info.GetParticipant() != own || info.GetQuotedMessage().GetConversation() != "see you at 8" {
+		t.Errorf("expected our own message quoted from %s, got %d %v", own, w.Code, info)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Retention modes
+const (
+	RetentionForever = "forever" // keep everything (the default)
+	RetentionDays    = "days"    // keep the last Days days
+	RetentionNone    = "none"    // don't keep messages at all
+)
+
+const (
+	retentionInterval = time.Hour
+	// noRetentionMediaGrace is how long cached media survives under RetentionNone, so
+	// consumers still get a chance to download it
+	noRetentionMediaGrace = 15 * time.Minute
+)
+
+// RetentionPolicy is how long a session's message history and cached media are kept.
+// Chats under legal hold are exempt.
+type RetentionPolicy struct {
+	Mode string `json:"mode"`
+	Days int    `json:"days,omitempty"`
+}
+
+func (p RetentionPolicy) validate() error {
+	switch p.Mode {
+	case "", RetentionForever, RetentionNone:
+		return nil
+	case RetentionDays:
+		if p.Days <= 0 {
+			return errors.New("days must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("mode must be %s, %s or %s", RetentionForever, RetentionDays, RetentionNone)
+	}
+}
+
+// normalize validates a policy and fills in the mode it defaults to
+func (p RetentionPolicy) normalize() (RetentionPolicy, error) {
+	if err := p.validate(); err != nil {
+		return p, err
+	}
+	if p.Mode == "" {
+		p.Mode = RetentionForever
+	}
+	if p.Mode != RetentionDays {
+		p.Days = 0
+	}
+	return p, nil
+}
+
+// cutoffs returns the time before which messages and cached media are deleted, or zero
+// times if nothing expires
+func (p RetentionPolicy) cutoffs(now time.Time) (messages, media time.Time) {
+	switch p.Mode {
+	case RetentionDays:
+		cutoff := now.AddDate(0, 0, -p.Days)
+		return cutoff, cutoff
+	case RetentionNone:
+		return now, now.Add(-noRetentionMediaGrace)
+	default:
+		return time.Time{}, time.Time{}
+	}
+}
+
+// RetentionSetting is a session's retention policy. The zero value keeps everything.
+type RetentionSetting struct {
+	persistedSetting[RetentionPolicy]
+}
+
+// LegalHold exempts a chat from retention
+type LegalHold struct {
+	ChatJID   string `json:"chat_jid"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (st *MessageStore) loadLegalHolds() error {
+	rows, err := st.db.Query(`SELECT chat_jid, reason, created_at FROM legal_holds`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	st.holds = make(map[string]LegalHold)
+	for rows.Next() {
+		var hold LegalHold
+		if err := rows.Scan(&hold.ChatJID, &hold.Reason, &hold.CreatedAt); err != nil {
+			return err
+		}
+		st.holds[hold.ChatJID] = hold
+	}
+	return rows.Err()
+}
+
+// SetLegalHold places a chat under legal hold, or releases it
+func (st *MessageStore) SetLegalHold(ctx context.Context, chatJID, reason string, hold bool) error {
+	if st == nil {
+		return errors.New("message history is not available")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !hold {
+		if _, err := st.db.ExecContext(ctx, `DELETE FROM legal_holds WHERE chat_jid = ?`, chatJID); err != nil {
+			return err
+		}
+		delete(st.holds, chatJID)
+		return nil
+	}
+	h := LegalHold{ChatJID: chatJID, Reason: reason, CreatedAt: time.Now().Unix()}
+	if existing, ok := st.holds[chatJID]; ok {
+		h.CreatedAt = existing.CreatedAt
+	}
+	_, err := st.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO legal_holds (chat_jid, reason, created_at) VALUES (?, ?, ?)`,
+		h.ChatJID, h.Reason, h.CreatedAt)
+	if err != nil {
+		return err
+	}
+	st.holds[chatJID] = h
+	return nil
+}
+
+// OnHold reports whether a chat is under legal hold
+func (st *MessageStore) OnHold(chatJID string) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	_, ok := st.holds[chatJID]
+	return ok
+}
+
+// LegalHolds lists the chats under legal hold, oldest first
+func (st *MessageStore) LegalHolds() []LegalHold {
+	holds := []LegalHold{}
+	if st == nil {
+		return holds
+	}
+	st.mu.RLock()
+	for _, h := range st.holds {
+		holds = append(holds, h)
+	}
+	st.mu.RUnlock()
+	sort.Slice(holds, func(i, j int) bool {
+		if holds[i].CreatedAt != holds[j].CreatedAt {
+			return holds[i].CreatedAt < holds[j].CreatedAt
+		}
+		return holds[i].ChatJID < holds[j].ChatJID
+	})
+	return holds
+}
+
+// Prune deletes messages older than before (unix seconds), except in chats under legal hold
+func (st *MessageStore) Prune(ctx context.Context, before int64) (int64, error) {
+	if st == nil {
+		return 0, nil
+	}
+	res, err := st.db.ExecContext(ctx,
+		`DELETE FROM messages WHERE timestamp < ? AND chat_jid NOT IN (SELECT chat_jid FROM legal_holds)`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// storeCachedMedia keeps downloaded media until a consumer fetches it or retention expires it
+func (s *UserSession) storeCachedMedia(msgID, chatJID string, data []byte) {
+	s.MediaMu.Lock()
+	defer s.MediaMu.Unlock()
+	if s.MediaCacheInfo == nil {
+		s.MediaCacheInfo = make(map[string]cachedMediaInfo)
+	}
+	s.MediaCache[msgID] = data
+	s.MediaCacheInfo[msgID] = cachedMediaInfo{ChatJID: chatJID, CachedAt: time.Now()}
+}
+
+// cachedMediaInfo records where cached media came from, for retention
+type cachedMediaInfo struct {
+	ChatJID  string
+	CachedAt time.Time
+}
+
+// pruneMediaCache drops media cached before cutoff, except from chats under legal hold
+func (s *UserSession) pruneMediaCache(cutoff time.Time) int {
+	s.MediaMu.Lock()
+	defer s.MediaMu.Unlock()
+	pruned := 0
+	for id, info := range s.MediaCacheInfo {
+		if !info.CachedAt.Before(cutoff) || s.Messages.OnHold(info.ChatJID) {
+			continue
+		}
+		delete(s.MediaCache, id)
+		delete(s.MediaCacheInfo, id)
+		pruned++
+	}
+	return pruned
+}
+
+// applyRetention deletes whatever the session's policy no longer allows it to keep
+func (s *UserSession) applyRetention(ctx context.Context, now time.Time) {
+	messageCutoff, mediaCutoff := s.Retention.Get().cutoffs(now)
+	if messageCutoff.IsZero() {
+		return
+	}
+	deleted, err := s.Messages.Prune(ctx, messageCutoff.Unix())
+	if err != nil {
+		log.Printf("[retention] User %d: failed to prune messages: %v", s.UserID, err)
+	}
+	pruned := s.pruneMediaCache(mediaCutoff)
+	if deleted > 0 || pruned > 0 {
+		log.Printf("[retention] User %d: deleted %d messages and %d cached media", s.UserID, deleted, pruned)
+	}
+}
+
+// runRetention periodically applies every session's retention policy
+func (m *SessionManager) runRetention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mu.RLock()
+		sessions := make([]*UserSession, 0, len(m.sessions))
+		for _, session := range m.sessions {
+			sessions = append(sessions, session)
+		}
+		m.mu.RUnlock()
+
+		now := time.Now()
+		for _, s := range sessions {
+			s.applyRetention(context.Background(), now)
+			s.pruneEventLog(context.Background(), now)
+		}
+	}
+}
+
+// retentionHandler reads (GET) or sets (POST) a session's retention policy
+func retentionHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[RetentionPolicy]{
+		name:    "retention policy",
+		setting: func(s *UserSession) settingStore[RetentionPolicy] { return &s.Retention },
+		view: func(policy RetentionPolicy) interface{} {
+			if policy.Mode == "" {
+				policy.Mode = RetentionForever
+			}
+			return policy
+		},
+		applied: func(ctx context.Context, s *UserSession, _ RetentionPolicy) {
+			s.applyRetention(ctx, time.Now())
+		},
+	})
+}
+
+// legalHoldHandler lists (GET) or places/releases (POST) legal holds on a session's chats
+func legalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		userID := 0
+		fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+		if userID == 0 {
+			errorResponse(w, http.StatusBadRequest, "user_id required")
+			return
+		}
+		session := manager.GetSession(userID)
+		if session == nil {
+			errorResponse(w, http.StatusNotFound, "session not found")
+			return
+		}
+		jsonResponse(w, map[string]interface{}{"holds": session.Messages.LegalHolds()})
+
+	case http.MethodPost:
+		var req struct {
+			UserID  int    `json:"user_id"`
+			ChatJID string `json:"chat_jid"`
+			Hold    bool   `json:"hold"`
+			Reason  string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		session := manager.GetSession(req.UserID)
+		if session == nil {
+			errorResponse(w, http.StatusNotFound, "session not found")
+			return
+		}
+		jid, err := types.ParseJID(req.ChatJID)
+		if err != nil || jid.User == "" {
+			errorResponse(w, http.StatusBadRequest, "invalid jid")
+			return
+		}
+		if err := session.Messages.SetLegalHold(r.Context(), jid.String(), req.Reason, req.Hold); err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to update legal hold: "+err.Error())
+			return
+		}
+		log.Printf("[retention] User %d: legal hold on %s set to %v", req.UserID, jid, req.Hold)
+		jsonResponse(w, map[string]interface{}{"chat_jid": jid.String(), "hold": req.Hold})
+
+	default:
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy_validate(t *testing.T) {
+	valid := []RetentionPolicy{{}, {Mode: RetentionForever}, {Mode: RetentionNone}, {Mode: RetentionDays, Days: 30}}
+	for _, p := range valid {
+		if err := p.validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", p, err)
+		}
+	}
+	invalid := []RetentionPolicy{{Mode: RetentionDays}, {Mode: RetentionDays, Days: -1}, {Mode: "week"}}
+	for _, p := range invalid {
+		if err := p.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+}
+
+func TestMessageStore_LegalHold(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "messages.db")
+	store, err := openMessageStore(path)
+	if err != nil {
+		t.Fatalf("openMessageStore failed: %v", err)
+	}
+	held, other := "1@s.whatsapp.net", "2@s.whatsapp.net"
+	for _, chat := range []string{held, other} {
+		store.Save(ctx, MessagePayload{ID: "old", ChatJID: chat, Timestamp: 100})
+		store.Save(ctx, MessagePayload{ID: "new", ChatJID: chat, Timestamp: 300})
+	}
+	if err := store.SetLegalHold(ctx, held, "case 42", true); err != nil {
+		t.Fatalf("SetLegalHold failed: %v", err)
+	}
+
+	deleted, err := store.Prune(ctx, 200)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 message pruned, got %d, %v", deleted, err)
+	}
+	if msgs, _ := store.List(ctx, held, 0, 10); len(msgs) != 2 {
+		t.Errorf("expected held chat to keep both messages, got %d", len(msgs))
+	}
+	if msgs, _ := store.List(ctx, other, 0, 10); len(msgs) != 1 || msgs[0].ID != "new" {
+		t.Errorf("expected only the new message in other chat, got %+v", msgs)
+	}
+
+	// Holds survive reopening the store
+	store.Close()
+	store, err = openMessageStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer store.Close()
+	holds := store.LegalHolds()
+	if len(holds) != 1 || holds[0].ChatJID != held || holds[0].Reason != "case 42" {
+		t.Errorf("unexpected holds after reopen: %+v", holds)
+	}
+
+	store.SetLegalHold(ctx, held, "", false)
+	if store.OnHold(held) {
+		t.Error("expected hold to be released")
+	}
+}
+
+func TestUserSession_applyRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	held, other := "1@s.whatsapp.net", "2@s.whatsapp.net"
+
+	t.Run("days", func(t *testing.T) {
+		session := &UserSession{UserID: 1, MediaCache: make(map[string][]byte)}
+		session.Messages = newTestMessageStore(t)
+		session.Messages.SetLegalHold(ctx, held, "", true)
+		session.Retention.Set(RetentionPolicy{Mode: RetentionDays, Days: 7})
+
+		old := now.AddDate(0, 0, -8).Unix()
+		for _, chat := range []string{held, other} {
+			session.Messages.Save(ctx, MessagePayload{ID: "old", ChatJID: chat, Timestamp: old})
+			session.Messages.Save(ctx, MessagePayload{ID: "recent", ChatJID: chat, Timestamp: now.Unix()})
+		}
+		session.storeCachedMedia("media-held", held, []byte("a"))
+		session.storeCachedMedia("media-other", other, []byte("b"))
+		session.storeCachedMedia("media-new", other, []byte("c"))
+		session.MediaCacheInfo["media-held"] = cachedMediaInfo{ChatJID: held, CachedAt: now.AddDate(0, 0, -8)}
+		session.MediaCacheInfo["media-other"] = cachedMediaInfo{ChatJID: other, CachedAt: now.AddDate(0, 0, -8)}
+
+		session.applyRetention(ctx, now)
+
+		if msgs, _ := session.Messages.List(ctx, other, 0, 10); len(msgs) != 1 {
+			t.Errorf("expected old message to be pruned, got %d messages", len(msgs))
+		}
+		if msgs, _ := session.Messages.List(ctx, held, 0, 10); len(msgs) != 2 {
+			t.Errorf("expected held chat to be untouched, got %d messages", len(msgs))
+		}
+		if _, ok := session.MediaCache["media-other"]; ok {
+			t.Error("expected expired media to be dropped")
+		}
+		if _, ok := session.MediaCache["media-held"]; !ok {
+			t.Error("expected held chat's media to be kept")
+		}
+		if _, ok := session.MediaCache["media-new"]; !ok {
+			t.Error("expected recent media to be kept")
+		}
+	})
+
+	t.Run("none stops storing except held chats", func(t *testing.T) {
+		session := &UserSession{UserID: 1, EventChan: make(chan MessageEvent, 10)}
+		session.Messages = newTestMessageStore(t)
+		session.Messages.SetLegalHold(ctx, held, "", true)
+		session.Retention.Set(RetentionPolicy{Mode: RetentionNone})
+
+		session.emitMessage(MessagePayload{ID: "a", ChatJID: other, Timestamp: now.Unix()})
+		session.emitMessage(MessagePayload{ID: "b", ChatJID: held, Timestamp: now.Unix()})
+
+		if msgs, _ := session.Messages.List(ctx, other, 0, 10); len(msgs) != 0 {
+			t.Errorf("expected nothing stored, got %d messages", len(msgs))
+		}
+		if msgs, _ := session.Messages.List(ctx, held, 0, 10); len(msgs) != 1 {
+			t.Errorf("expected held chat to be stored, got %d messages", len(msgs))
+		}
+		if len(session.EventChan) != 2 {
+			t.Errorf("expected both messages to be emitted, got %d", len(session.EventChan))
+		}
+	})
+}
+
+func TestRetentionHandlers(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1010, NewLoggedInMockClient())
+	session.Messages = newTestMessageStore(t)
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := post(retentionHandler, `{"user_id": 1010, "mode": "days"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days without a count, got %d", w.Code)
+	}
+	if w := post(retentionHandler, `{"user_id": 1010, "mode": "days", "days": 30}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if p := session.Retention.Get(); p.Mode != RetentionDays || p.Days != 30 {
+		t.Errorf("unexpected policy %+v", p)
+	}
+
+	if w := post(legalHoldHandler, `{"user_id": 1010, "chat_jid": "not a jid", "hold": true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid jid, got %d", w.Code)
+	}
+	if w := post(legalHoldHandler, `{"user_id": 1010, "chat_jid": "123@s.whatsapp.net", "hold": true, "reason": "audit"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/chats/legal-hold?user_id=1010", nil)
+	w := httptest.NewRecorder()
+	legalHoldHandler(w, req)
+	var resp struct {
+		Holds []LegalHold `json:"holds"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Holds) != 1 || resp.Holds[0].ChatJID != "123@s.whatsapp.net" || resp.Holds[0].Reason != "audit" {
+		t.Errorf("unexpected holds: %+v", resp.Holds)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MessageRevokedPayload is emitted as a "message_revoked" event when a message is
+// deleted for everyone, so consumers can hide what it said
+type MessageRevokedPayload struct {
+	ID         string `json:"id"` // of the deleted message
+	ChatJID    string `json:"chat_jid"`
+	SenderJID  string `json:"sender_jid,omitempty"` // who sent the deleted message
+	RevokedBy  string `json:"revoked_by"`           // the sender, or a group admin
+	Timestamp  int64  `json:"timestamp"`
+	IsFromMe   bool   `json:"is_from_me"`
+	IsSelfChat bool   `json:"is_self_chat,omitempty"`
+}
+
+// Revoke replaces a stored message with a "deleted" notice, the way the phone shows it.
+// Messages that were never stored are left alone.
+func (st *MessageStore) Revoke(ctx context.Context, chatJID, id string) error {
+	if st == nil {
+		return nil
+	}
+	msg, err := st.Get(ctx, chatJID, id)
+	if err != nil || msg == nil {
+		return err
+	}
+	return st.Save(ctx, MessagePayload{
+		ID:         msg.ID,
+		ChatJID:    msg.ChatJID,
+		SenderJID:  msg.SenderJID,
+		SenderName: msg.SenderName,
+		Text:       "This message was deleted",
+		Timestamp:  msg.Timestamp,
+		IsFromMe:   msg.IsFromMe,
+		IsSelfChat: msg.IsSelfChat,
+		MediaType:  "system",
+		SystemType: SystemMessageRevoked,
+	})
+}
+
+// handleRevoke emits a remote delete-for-everyone and blanks the message in history
+// and the media cache
+func (s *UserSession) handleRevoke(evt *events.Message) {
+	key := evt.Message.GetProtocolMessage().GetKey()
+	payload := MessageRevokedPayload{
+		ID:         key.GetID(),
+		ChatJID:    evt.Info.Chat.String(),
+		SenderJID:  key.GetParticipant(),
+		RevokedBy:  evt.Info.Sender.String(),
+		Timestamp:  evt.Info.Timestamp.Unix(),
+		IsFromMe:   evt.Info.IsFromMe,
+		IsSelfChat: s.isSelfChat(evt.Info.Chat),
+	}
+	if payload.SenderJID == "" {
+		// Outside of admin deletes in groups, people can only revoke their own messages
+		payload.SenderJID = payload.RevokedBy
+	}
+
+	if err := s.Messages.Revoke(context.Background(), payload.ChatJID, payload.ID); err != nil {
+		log.Printf("[messages] Failed to revoke %s for user %d: %v", payload.ID, s.UserID, err)
+	}
+	s.MediaMu.Lock()
+	delete(s.MediaCache, payload.ID)
+	delete(s.MediaCacheInfo, payload.ID)
+	s.MediaMu.Unlock()
+
+	s.emit(MessageEvent{Type: "message_revoked", Payload: payload})
+}
+
+func revokeMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID    int    `json:"user_id"`
+		ChatJID   string `json:"chat_jid"`
+		MessageID string `json:"message_id"`
+		// SenderJID is set to delete someone else's message in a group the user is admin of
+		SenderJID string `json:"sender_jid,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.MessageID == "" {
+		errorResponse(w, http.StatusBadRequest, "message_id required")
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+	sender := types.EmptyJID
+	if req.SenderJID != "" {
+		if sender, err = types.ParseJID(req.SenderJID); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid sender_jid")
+			return
+		}
+	}
+
+	resp, err := session.Client.SendMessage(r.Context(), jid, session.Client.BuildRevoke(jid, sender, req.MessageID))
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	if err := session.Messages.Revoke(context.Background(), jid.String(), req.MessageID); err != nil {
+		log.Printf("[messages] Failed to revoke %s for user %d: %v", req.MessageID, session.UserID, err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRevokeMessageHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	session.Messages = newTestMessageStore(t)
+	group := "120363000000000000@g.us"
+	session.Messages.Save(t.Context(), MessagePayload{ID: "MSG1", ChatJID: group, Text: "oops", Timestamp: 100})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		revokeMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/revoke", bytes.NewBufferString(body)))
+		return w
+	}
+	if w := post(`{"user_id": 1, "chat_jid": "` + group + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a message_id, got %d", w.Code)
+	}
+
+	w := post(`{"user_id": 1, "chat_jid": "` + group + `", "message_id": "MSG1", "sender_jid": "15551234567@s.whatsapp.net"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	key := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message).GetProtocolMessage().GetKey()
+	if key.GetID() != "MSG1" || key.GetFromMe() || key.GetParticipant() != "15551234567@s.whatsapp.net" {
+		t.Errorf("unexpected revoke key %+v", key)
+	}
+	history, _ := session.Messages.List(t.Context(), group, 0, 10)
+	if len(history) != 1 || history[0].Text == "oops" || history[0].SystemType != SystemMessageRevoked {
+		t.Errorf("expected the stored message to be blanked, got %+v", history)
+	}
+}
+
+func TestHandleEvent_Revoke(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	chat := types.NewJID("15557654321", types.DefaultUserServer)
+	session.MediaCache["MSG2"] = []byte("photo")
+
+	session.handleEvent(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "REVOKE1",
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  &waCommon.MessageKey{RemoteJID: proto.String(chat.String()), ID: proto.String("MSG2")},
+		}},
+	})
+
+	evt := <-session.EventChan
+	payload, ok := evt.Payload.(MessageRevokedPayload)
+	if evt.Type != "message_revoked" || !ok {
+		t.Fatalf("expected a message_revoked event, got %+v", evt)
+	}
+	if payload.ID != "MSG2" || payload.SenderJID != chat.String() || payload.RevokedBy != chat.String() {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if _, cached := session.MediaCache["MSG2"]; cached {
+		t.Error("expected the revoked message's media to be dropped")
+	}
+}
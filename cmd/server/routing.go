@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// RoutingConfig tags incoming messages that match keyword or regex rules, and can
+// forward them to per-rule webhooks, so downstream systems can act on a subset of
+// messages without consuming the whole event stream.
+type RoutingConfig struct {
+	Rules []RoutingRule `json:"rules"`
+}
+
+// RoutingRule matches a message when any keyword or the regex matches its text or
+// caption, and the chat passes the filters. Filters that are left empty match everything.
+type RoutingRule struct {
+	Tag      string   `json:"tag"`
+	Keywords []string `json:"keywords,omitempty"` // case-insensitive substrings
+	Regex    string   `json:"regex,omitempty"`
+	Chats    []string `json:"chats,omitempty"`     // chat JIDs
+	ChatType string   `json:"chat_type,omitempty"` // "direct" or "group"
+	UserIDs  []int    `json:"user_ids,omitempty"`
+	// Webhook receives {"user_id", "tag", "message"} for each match
+	Webhook string `json:"webhook,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// RoutedMessage is posted to a routing rule's webhook
+type RoutedMessage struct {
+	UserID  int            `json:"user_id"`
+	Tag     string         `json:"tag"`
+	Message MessagePayload `json:"message"`
+}
+
+func (c *RoutingConfig) compile() error {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.Tag == "" {
+			return fmt.Errorf("rule %d: tag required", i)
+		}
+		if len(rule.Keywords) == 0 && rule.Regex == "" {
+			return fmt.Errorf("rule %q: set keywords or regex", rule.Tag)
+		}
+		if rule.ChatType != "" && rule.ChatType != "direct" && rule.ChatType != "group" {
+			return fmt.Errorf("rule %q: chat_type must be direct or group", rule.Tag)
+		}
+		for j, kw := range rule.Keywords {
+			rule.Keywords[j] = strings.ToLower(kw)
+		}
+		for j, chat := range rule.Chats {
+			jid, err := types.ParseJID(chat)
+			if err != nil || jid.User == "" {
+				return fmt.Errorf("rule %q: invalid chat %q", rule.Tag, chat)
+			}
+			rule.Chats[j] = jid.String()
+		}
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Tag, err)
+			}
+			rule.re = re
+		}
+	}
+	return nil
+}
+
+func (r *RoutingRule) matches(userID int, payload MessagePayload) bool {
+	if len(r.UserIDs) > 0 && !slices.Contains(r.UserIDs, userID) {
+		return false
+	}
+	if len(r.Chats) > 0 && !slices.Contains(r.Chats, payload.ChatJID) {
+		return false
+	}
+	if r.ChatType != "" {
+		isGroup := strings.HasSuffix(payload.ChatJID, "@"+types.GroupServer)
+		if isGroup != (r.ChatType == "group") {
+			return false
+		}
+	}
+
+	text := strings.TrimSpace(payload.Text + "\n" + payload.Caption)
+	if text == "" {
+		return false
+	}
+	if r.re != nil && r.re.MatchString(text) {
+		return true
+	}
+	lower := strings.ToLower(text)
+	for _, kw := range r.Keywords {
+		if strings.Contains(lower, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the rules that apply to a message
+func (c *RoutingConfig) match(userID int, payload MessagePayload) []*RoutingRule {
+	var matched []*RoutingRule
+	for i := range c.Rules {
+		if c.Rules[i].matches(userID, payload) {
+			matched = append(matched, &c.Rules[i])
+		}
+	}
+	return matched
+}
+
+// routeMessage tags a message with the routing rules it matches and forwards it to
+// their webhooks
+func (s *UserSession) routeMessage(payload *MessagePayload) {
+	matched := currentConfig().Routing.match(s.UserID, *payload)
+	for _, rule := range matched {
+		if !slices.Contains(payload.Tags, rule.Tag) {
+			payload.Tags = append(payload.Tags, rule.Tag)
+		}
+	}
+	// Webhooks get the message with all of its tags, redacted like every other output
+	msg := *payload
+	if s.Redaction.Enabled() {
+		msg = redactMessage(msg)
+	}
+	for _, rule := range matched {
+		if rule.Webhook != "" {
+			go s.postRoutedMessage(rule.Webhook, RoutedMessage{UserID: s.UserID, Tag: rule.Tag, Message: msg})
+		}
+	}
+}
+
+func (s *UserSession) postRoutedMessage(url string, msg RoutedMessage) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[routing] User %d: webhook for %q failed: %v", s.UserID, msg.Tag, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[routing] User %d: webhook for %q returned status %d", s.UserID, msg.Tag, resp.StatusCode)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestParseConfig_Routing(t *testing.T) {
+	invalid := []string{
+		`{"routing": {"rules": [{"keywords": ["x"]}]}}`,
+		`{"routing": {"rules": [{"tag": "t"}]}}`,
+		`{"routing": {"rules": [{"tag": "t", "regex": "("}]}}`,
+		`{"routing": {"rules": [{"tag": "t", "keywords": ["x"], "chat_type": "channel"}]}}`,
+		`{"routing": {"rules": [{"tag": "t", "keywords": ["x"], "chats": ["@"]}]}}`,
+	}
+	for _, cfg := range invalid {
+		if _, err := parseConfig([]byte(cfg)); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+}
+
+func TestRoutingConfig_match(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{"routing": {"rules": [
+		{"tag": "invoices", "keywords": ["Invoice"]},
+		{"tag": "orders", "regex": "order #\\d+", "chat_type": "group"},
+		{"tag": "vip", "keywords": ["hi"], "chats": ["15550000000@s.whatsapp.net"], "user_ids": [2]}
+	]}}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	routing := &cfg.Routing
+	dm := "15551234567@s.whatsapp.net"
+	group := "120363000000000000@g.us"
+
+	tags := func(userID int, payload MessagePayload) []string {
+		var out []string
+		for _, rule := range routing.match(userID, payload) {
+			out = append(out, rule.Tag)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		userID  int
+		payload MessagePayload
+		want    []string
+	}{
+		{"keyword in text", 1, MessagePayload{ChatJID: dm, Text: "here is the INVOICE"}, []string{"invoices"}},
+		{"keyword in caption", 1, MessagePayload{ChatJID: dm, MediaType: "image", Caption: "invoice scan"}, []string{"invoices"}},
+		{"regex in group", 1, MessagePayload{ChatJID: group, Text: "order #42 invoice"}, []string{"invoices", "orders"}},
+		{"regex outside group", 1, MessagePayload{ChatJID: dm, Text: "order #42"}, nil},
+		{"chat and user filter", 2, MessagePayload{ChatJID: "15550000000@s.whatsapp.net", Text: "hi"}, []string{"vip"}},
+		{"wrong user", 1, MessagePayload{ChatJID: "15550000000@s.whatsapp.net", Text: "hi"}, nil},
+		{"no text", 1, MessagePayload{ChatJID: dm, MediaType: "image"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tags(tt.userID, tt.payload); !slices.Equal(got, tt.want) {
+				t.Errorf("got tags %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserSession_routeMessage(t *testing.T) {
+	received := make(chan RoutedMessage, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg RoutedMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer srv.Close()
+	useConfig(t, `{"routing": {"rules": [{"tag": "invoices", "keywords": ["invoice"], "webhook": "`+srv.URL+`"}]}}`)
+
+	session := &UserSession{UserID: 5, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+	session.handleEvent(incomingText(types.NewJID("15551234567", types.DefaultUserServer), "M1", "invoice attached"))
+
+	evt := <-session.EventChan
+	if tags := evt.Payload.(MessagePayload).Tags; !slices.Equal(tags, []string{"invoices"}) {
+		t.Errorf("expected emitted message to be tagged, got %v", tags)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.UserID != 5 || msg.Tag != "invoices" || msg.Message.ID != "M1" {
+			t.Errorf("unexpected webhook payload: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected webhook to be called")
+	}
+}
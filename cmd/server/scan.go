@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	mediaScanTimeout     = time.Minute
+	clamavChunkSize      = 64 * 1024
+	defaultClamAVAddress = "localhost:3310"
+)
+
+// ScanResult is a virus scanner's verdict on one file
+type ScanResult struct {
+	Infected  bool
+	Signature string // name of the detected threat
+}
+
+// MediaScanner checks media for malware
+type MediaScanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+// What to do with infected media, set by MEDIA_SCAN_ACTION
+const (
+	// ScanActionTag reports infected media with a media_infected event but delivers and sends it
+	ScanActionTag = "tag"
+	// ScanActionQuarantine additionally withholds infected incoming media from downloads
+	ScanActionQuarantine = "quarantine"
+	// ScanActionBlock additionally refuses to send infected media, and fails closed when
+	// the scanner is unreachable
+	ScanActionBlock = "block"
+)
+
+var (
+	// mediaScanner is nil unless MEDIA_SCANNER is set
+	mediaScanner    = mediaScannerFromEnv()
+	mediaScanAction = scanActionFromEnv()
+)
+
+func mediaScannerFromEnv() MediaScanner {
+	switch name := strings.ToLower(os.Getenv("MEDIA_SCANNER")); name {
+	case "":
+		return nil
+	case "clamav":
+		addr := os.Getenv("CLAMAV_ADDRESS")
+		if addr == "" {
+			addr = defaultClamAVAddress
+		}
+		log.Printf("Media scanning enabled via clamd at %s", addr)
+		return NewClamAVScanner(addr)
+	case "icap":
+		scanner, err := NewICAPScanner(os.Getenv("ICAP_URL"))
+		if err != nil {
+			log.Printf("Warning: %v, media scanning disabled", err)
+			return nil
+		}
+		log.Printf("Media scanning enabled via ICAP at %s", scanner.URL)
+		return scanner
+	default:
+		log.Printf("Warning: unknown MEDIA_SCANNER %q, media scanning disabled", name)
+		return nil
+	}
+}
+
+func scanActionFromEnv() string {
+	switch action := strings.ToLower(os.Getenv("MEDIA_SCAN_ACTION")); action {
+	case "":
+		return ScanActionTag
+	case ScanActionTag, ScanActionQuarantine, ScanActionBlock:
+		return action
+	default:
+		log.Printf("Warning: invalid MEDIA_SCAN_ACTION %q, using %s", action, ScanActionTag)
+		return ScanActionTag
+	}
+}
+
+// ClamAVScanner streams files to clamd with the INSTREAM command
+type ClamAVScanner struct {
+	Network string // "tcp" or "unix"
+	Address string
+}
+
+// NewClamAVScanner takes a host:port, or a socket path starting with "/"
+func NewClamAVScanner(addr string) *ClamAVScanner {
+	if strings.HasPrefix(addr, "/") {
+		return &ClamAVScanner{Network: "unix", Address: addr}
+	}
+	return &ClamAVScanner{Network: "tcp", Address: addr}
+}
+
+func (c *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, err
+	}
+	buf := make([]byte, clamavChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return ScanResult{}, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanResult{}, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return ScanResult{}, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return ScanResult{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return ScanResult{}, err
+	}
+	return parseClamAVReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamAVReply interprets "stream: OK" and "stream: <signature> FOUND"
+func parseClamAVReply(reply string) (ScanResult, error) {
+	_, verdict, _ := strings.Cut(reply, ": ")
+	switch {
+	case verdict == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// ICAPScanner submits files to an ICAP antivirus service (RFC 3507) with REQMOD. A 204
+// response means the file is clean; anything the server modifies or blocks is infected.
+type ICAPScanner struct {
+	URL *url.URL
+}
+
+func NewICAPScanner(rawURL string) (*ICAPScanner, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "icap" || u.Host == "" {
+		return nil, fmt.Errorf("invalid ICAP_URL %q", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host += ":1344"
+	}
+	return &ICAPScanner{URL: u}, nil
+}
+
+func (s *ICAPScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.URL.Host)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	httpHeader := "POST /upload HTTP/1.1\r\nHost: wa-meow\r\nContent-Type: application/octet-stream\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", len(body))
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "REQMOD %s ICAP/1.0\r\n", s.URL)
+	fmt.Fprintf(&req, "Host: %s\r\n", s.URL.Host)
+	req.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&req, "Encapsulated: req-hdr=0, req-body=%d\r\n\r\n", len(httpHeader))
+	req.WriteString(httpHeader)
+	if len(body) > 0 {
+		fmt.Fprintf(&req, "%x\r\n", len(body))
+		req.Write(body)
+		req.WriteString("\r\n")
+	}
+	req.WriteString("0\r\n\r\n")
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return ScanResult{}, err
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	status, err := tp.ReadLine()
+	if err != nil {
+		return ScanResult{}, err
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ScanResult{}, err
+	}
+	return parseICAPResponse(status, http.Header(header))
+}
+
+func parseICAPResponse(status string, header http.Header) (ScanResult, error) {
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return ScanResult{}, fmt.Errorf("icap: malformed status %q", status)
+	}
+	switch fields[1] {
+	case "204":
+		return ScanResult{}, nil
+	case "200":
+		signature := header.Get("X-Virus-ID")
+		if signature == "" {
+			// X-Infection-Found: Type=0; Resolution=2; Threat=<name>;
+			for _, part := range strings.Split(header.Get("X-Infection-Found"), ";") {
+				if name, ok := strings.CutPrefix(strings.TrimSpace(part), "Threat="); ok {
+					signature = name
+				}
+			}
+		}
+		if signature == "" {
+			signature = "blocked by ICAP server"
+		}
+		return ScanResult{Infected: true, Signature: signature}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("icap: %s", status)
+	}
+}
+
+// MediaInfectedPayload is the payload of a "media_infected" event
+type MediaInfectedPayload struct {
+	MessageID string `json:"message_id,omitempty"` // incoming media only
+	ChatJID   string `json:"chat_jid,omitempty"`
+	Direction string `json:"direction"` // "incoming" or "outgoing"
+	Signature string `json:"signature"`
+	Action    string `json:"action"`
+}
+
+// scanDownloadedMedia scans incoming media before it's cached or served, reporting whether
+// it may be delivered
+func (s *UserSession) scanDownloadedMedia(msgID, chatJID string, data []byte) bool {
+	if mediaScanner == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mediaScanTimeout)
+	defer cancel()
+
+	result, err := mediaScanner.Scan(ctx, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[media/scan] Scanning %s failed: %v", msgID, err)
+		return mediaScanAction != ScanActionBlock
+	}
+	if !result.Infected {
+		return true
+	}
+	log.Printf("[media/scan] User %d: incoming media %s in %s is infected (%s), action %s", s.UserID, msgID, chatJID, result.Signature, mediaScanAction)
+	s.emit(MessageEvent{Type: "media_infected", Payload: MediaInfectedPayload{
+		MessageID: msgID,
+		ChatJID:   chatJID,
+		Direction: "incoming",
+		Signature: result.Signature,
+		Action:    mediaScanAction,
+	}})
+	return mediaScanAction == ScanActionTag
+}
+
+// scanOutgoingMedia scans media before it's uploaded. It writes the error response and
+// returns false if the send must not go ahead.
+func scanOutgoingMedia(w http.ResponseWriter, session *UserSession, media *spooledMedia, chatJID string) bool {
+	if mediaScanner == nil {
+		return true
+	}
+	r, err := media.Reader()
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mediaScanTimeout)
+	defer cancel()
+
+	result, err := mediaScanner.Scan(ctx, r)
+	if err != nil {
+		log.Printf("[media/scan] Scanning outgoing media for user %d failed: %v", session.UserID, err)
+		if mediaScanAction == ScanActionBlock {
+			errorResponse(w, http.StatusServiceUnavailable, "media scan failed: "+err.Error())
+			return false
+		}
+		return true
+	}
+	if !result.Infected {
+		return true
+	}
+	log.Printf("[media/scan] User %d: outgoing media to %s is infected (%s), action %s", session.UserID, chatJID, result.Signature, mediaScanAction)
+	session.emit(MessageEvent{Type: "media_infected", Payload: MediaInfectedPayload{
+		ChatJID:   chatJID,
+		Direction: "outgoing",
+		Signature: result.Signature,
+		Action:    mediaScanAction,
+	}})
+	if mediaScanAction == ScanActionBlock {
+		errorResponse(w, http.StatusUnprocessableEntity, "media is infected: "+result.Signature)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard antivirus test string
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+type fakeScanner struct {
+	err error
+}
+
+func (f *fakeScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	if f.err != nil {
+		return ScanResult{}, f.err
+	}
+	data, _ := io.ReadAll(r)
+	if bytes.Contains(data, []byte("EICAR")) {
+		return ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return ScanResult{}, nil
+}
+
+func useScanner(t *testing.T, scanner MediaScanner, action string) {
+	t.Helper()
+	prevScanner, prevAction := mediaScanner, mediaScanAction
+	mediaScanner, mediaScanAction = scanner, action
+	t.Cleanup(func() { mediaScanner, mediaScanAction = prevScanner, prevAction })
+}
+
+// serveFakeClamd answers one INSTREAM request, flagging streams that contain EICAR
+func serveFakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			if cmd, _ := r.ReadString(0); cmd != "zINSTREAM\x00" {
+				conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				conn.Close()
+				continue
+			}
+			var data []byte
+			for {
+				var size uint32
+				if binary.Read(r, binary.BigEndian, &size) != nil || size == 0 {
+					break
+				}
+				chunk := make([]byte, size)
+				io.ReadFull(r, chunk)
+				data = append(data, chunk...)
+			}
+			if bytes.Contains(data, []byte("EICAR")) {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAVScanner(t *testing.T) {
+	scanner := NewClamAVScanner(serveFakeClamd(t))
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("harmless"))
+	if err != nil || result.Infected {
+		t.Errorf("expected clean result, got %+v, %v", result, err)
+	}
+	result, err = scanner.Scan(context.Background(), strings.NewReader(strings.Repeat("x", clamavChunkSize)+eicar))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("expected EICAR to be found across chunks, got %+v, %v", result, err)
+	}
+}
+
+func TestParseClamAVReply(t *testing.T) {
+	if _, err := parseClamAVReply("stream: Can't allocate memory ERROR"); err == nil {
+		t.Error("expected clamd error to be reported")
+	}
+	if unix := NewClamAVScanner("/run/clamav/clamd.sock"); unix.Network != "unix" {
+		t.Errorf("expected socket path to use unix network, got %s", unix.Network)
+	}
+}
+
+func TestParseICAPResponse(t *testing.T) {
+	tests := []struct {
+		status    string
+		header    http.Header
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{"ICAP/1.0 204 No Content", nil, false, "", false},
+		{"ICAP/1.0 200 OK", http.Header{"X-Virus-Id": {"EICAR"}}, true, "EICAR", false},
+		{"ICAP/1.0 200 OK", http.Header{"X-Infection-Found": {"Type=0; Resolution=2; Threat=Win.Test;"}}, true, "Win.Test", false},
+		{"ICAP/1.0 200 OK", nil, true, "blocked by ICAP server", false},
+		{"ICAP/1.0 500 Server Error", nil, false, "", true},
+		{"HTTP/1.1 200 OK", nil, false, "", true},
+	}
+	for _, tt := range tests {
+		result, err := parseICAPResponse(tt.status, tt.header)
+		if (err != nil) != tt.wantErr || result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parseICAPResponse(%q) = %+v, %v", tt.status, result, err)
+		}
+	}
+	if _, err := NewICAPScanner("http://av.local"); err == nil {
+		t.Error("expected non-icap URL to be rejected")
+	}
+}
+
+func TestScanOutgoingMedia(t *testing.T) {
+	infected := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n" + eicar))
+	send := func(userID string) *httptest.ResponseRecorder {
+		body := `{"user_id": ` + userID + `, "chat_jid": "1234567890@s.whatsapp.net", "image_b64": "` + infected + `", "mime_type": "image/png"}`
+		req := httptest.NewRequest(http.MethodPost, "/messages/image", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		sendImageHandler(w, req)
+		return w
+	}
+
+	t.Run("block refuses infected media", func(t *testing.T) {
+		useScanner(t, &fakeScanner{}, ScanActionBlock)
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(manager, 1001, mock)
+
+		w := send("1001")
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+		}
+		if calls := mock.GetCallsByMethod("UploadReader"); len(calls) != 0 {
+			t.Errorf("expected nothing to be uploaded, got %d uploads", len(calls))
+		}
+		evt := <-session.EventChan
+		if payload := evt.Payload.(MediaInfectedPayload); evt.Type != "media_infected" || payload.Direction != "outgoing" {
+			t.Errorf("unexpected event %s %+v", evt.Type, evt.Payload)
+		}
+	})
+
+	t.Run("tag sends and reports", func(t *testing.T) {
+		useScanner(t, &fakeScanner{}, ScanActionTag)
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(manager, 1002, mock)
+
+		if w := send("1002"); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if len(session.EventChan) != 1 {
+			t.Errorf("expected a media_infected event, got %d events", len(session.EventChan))
+		}
+	})
+
+	t.Run("block fails closed when scanner is down", func(t *testing.T) {
+		useScanner(t, &fakeScanner{err: errors.New("connection refused")}, ScanActionBlock)
+		manager = setupTestManager(t)
+		injectMockSession(manager, 1003, NewLoggedInMockClient())
+
+		if w := send("1003"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+	})
+}
+
+func TestUserSession_scanDownloadedMedia(t *testing.T) {
+	session := &UserSession{UserID: 1, EventChan: make(chan MessageEvent, 10)}
+
+	useScanner(t, &fakeScanner{}, ScanActionQuarantine)
+	if !session.scanDownloadedMedia("M1", "chat", []byte("clean")) {
+		t.Error("expected clean media to be delivered")
+	}
+	if session.scanDownloadedMedia("M2", "chat", []byte(eicar)) {
+		t.Error("expected infected media to be withheld under quarantine")
+	}
+	evt := <-session.EventChan
+	if payload := evt.Payload.(MediaInfectedPayload); payload.MessageID != "M2" || payload.Direction != "incoming" || payload.Action != ScanActionQuarantine {
+		t.Errorf("unexpected event payload %+v", payload)
+	}
+
+	useScanner(t, &fakeScanner{err: errors.New("timeout")}, ScanActionQuarantine)
+	if !session.scanDownloadedMedia("M3", "chat", []byte(eicar)) {
+		t.Error("expected quarantine to fail open when the scanner is down")
+	}
+}
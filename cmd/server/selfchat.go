@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// selfChatAlias can be used as chat_jid to address the account's own note-to-self chat
+const selfChatAlias = "me"
+
+// isSelfChat reports whether chat is the account's own note-to-self chat, addressed by
+// phone number or LID
+func (s *UserSession) isSelfChat(chat types.JID) bool {
+	store := s.Client.GetStore()
+	if own := store.GetID(); own != nil && chat.User == own.User && chat.Server == own.Server {
+		return true
+	}
+	lid := store.GetLID()
+	return !lid.IsEmpty() && chat.User == lid.User && chat.Server == lid.Server
+}
+
+// mentionsMe reports whether a message @-mentions the account, by phone number or LID
+func (s *UserSession) mentionsMe(msg *waE2E.Message) bool {
+	for _, raw := range core.ContextInfo(msg).GetMentionedJID() {
+		// The note-to-self chat is addressed by the account's own JID
+		if jid, err := types.ParseJID(raw); err == nil && s.isSelfChat(jid) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChatJID parses the chat_jid of a send request. "me" addresses the note-to-self
+// chat, and the account's own JID is accepted even with the device part GetID reports,
+// which WhatsApp refuses as a recipient.
+func (s *UserSession) parseChatJID(raw string) (types.JID, error) {
+	if strings.EqualFold(raw, selfChatAlias) {
+		own := s.Client.GetStore().GetID()
+		if own == nil {
+			return types.EmptyJID, errors.New("own jid unknown")
+		}
+		return own.ToNonAD(), nil
+	}
+	jid, err := types.ParseJID(raw)
+	if err != nil {
+		return jid, err
+	}
+	if s.isSelfChat(jid) {
+		return jid.ToNonAD(), nil
+	}
+	return jid, nil
+}
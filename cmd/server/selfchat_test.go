@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUserSession_parseChatJID(t *testing.T) {
+	mock := NewLoggedInMockClient()
+	mock.store.ID = &types.JID{User: "1234567890", Device: 7, Server: types.DefaultUserServer}
+	mock.store.LID = types.JID{User: "99887766", Server: types.HiddenUserServer}
+	session := &UserSession{Client: mock}
+
+	tests := map[string]string{
+		"me":                          "1234567890@s.whatsapp.net",
+		"ME":                          "1234567890@s.whatsapp.net",
+		"1234567890:7@s.whatsapp.net": "1234567890@s.whatsapp.net",
+		"99887766:3@lid":              "99887766@lid",
+		"5550001111@s.whatsapp.net":   "5550001111@s.whatsapp.net",
+		"120363000000000000@g.us":     "120363000000000000@g.us",
+	}
+	for raw, want := range tests {
+		jid, err := session.parseChatJID(raw)
+		if err != nil || jid.String() != want {
+			t.Errorf("parseChatJID(%q) = %s, %v; want %s", raw, jid, err, want)
+		}
+	}
+
+	session.Client = NewMockClient()
+	if _, err := session.parseChatJID("me"); err == nil {
+		t.Error("expected \"me\" to fail without a logged-in device")
+	}
+}
+
+func TestSendMessageHandler_NoteToSelf(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.store.ID = &types.JID{User: "1234567890", Device: 12, Server: types.DefaultUserServer}
+	injectMockSession(manager, 1, mock)
+
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", bytes.NewBufferString(`{"user_id": 1, "chat_jid": "me", "text": "remember the milk"}`))
+	w := httptest.NewRecorder()
+	sendMessageHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if to := mock.GetCallsByMethod("SendMessage")[0].Args[1].(types.JID); to.String() != "1234567890@s.whatsapp.net" {
+		t.Errorf("expected message to own non-device JID, sent to %s", to)
+	}
+}
+
+func TestHandleEvent_SelfChatTagged(t *testing.T) {
+	mock := NewLoggedInMockClient()
+	mock.store.LID = types.JID{User: "99887766", Server: types.HiddenUserServer}
+	session := &UserSession{UserID: 1, Client: mock, EventChan: make(chan MessageEvent, 10)}
+	own := types.JID{User: "1234567890", Server: types.DefaultUserServer}
+	other := types.NewJID("15551234567", types.DefaultUserServer)
+
+	for _, chat := range []types.JID{own, mock.store.LID, other} {
+		session.handleEvent(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: own, IsFromMe: true},
+				ID:            "M-" + chat.User,
+				Timestamp:     time.Unix(1700000000, 0),
+			},
+			Message: &waE2E.Message{Conversation: proto.String("note")},
+		})
+	}
+
+	for _, want := range []bool{true, true, false} {
+		evt := <-session.EventChan
+		if payload := evt.Payload.(MessagePayload); payload.IsSelfChat != want {
+			t.Errorf("message in %s: expected is_self_chat=%v", payload.ChatJID, want)
+		}
+	}
+}
+
+func TestUserSession_mentionsMe(t *testing.T) {
+	mock := NewLoggedInMockClient()
+	mock.store.ID = &types.JID{User: "1234567890", Device: 7, Server: types.DefaultUserServer}
+	mock.store.LID = types.JID{User: "99887766", Server: types.HiddenUserServer}
+	session := &UserSession{Client: mock}
+
+	mentioning := func(jids ...string) *waE2E.Message {
+		return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String("hey"),
+			ContextInfo: &waE2E.ContextInfo{MentionedJID: jids},
+		}}
+	}
+	if !session.mentionsMe(mentioning("5550001111@s.whatsapp.net", "1234567890@s.whatsapp.net")) {
+		t.Error("expected a mention by phone number to match")
+	}
+	if !session.mentionsMe(mentioning("99887766@lid")) {
+		t.Error("expected a mention by LID to match")
+	}
+	if session.mentionsMe(mentioning("5550001111@s.whatsapp.net")) || session.mentionsMe(&waE2E.Message{Conversation: proto.String("hi")}) {
+		t.Error("expected messages mentioning others, or no one, not to match")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/libsignal/signalerror"
+	"go.mau.fi/whatsmeow"
+)
+
+// sendFailure is what the API reports about a failed SendMessage
+type sendFailure struct {
+	Status int
+	Code   string
+	// RetrySafe is true when the message certainly wasn't sent, so sending it again can't
+	// deliver it twice. It says nothing about whether the retry will succeed.
+	RetrySafe bool
+	// Device is the recipient device the message couldn't be encrypted for, if known
+	Device string
+	// RetryAfter is when the send will be let through, if it was held back by pacing or warm-up
+	RetryAfter time.Duration
+	// DuplicateOf is the ID of the identical message already sent, for duplicate refusals
+	DuplicateOf string
+}
+
+// classifySendError works out why whatsmeow failed to send a message. Failures before
+// the message node goes out (connection, group lookup, encryption) are safe to retry;
+// once it's out, a missing or failed ack doesn't prove nobody got it.
+func classifySendError(err error) sendFailure {
+	var disconnected *whatsmeow.DisconnectedError
+	var paced *PacingError
+	var warmup *WarmupError
+	var duplicate *DuplicateError
+	var notAllowed *ChatNotAllowedError
+	var pending *PendingApprovalError
+	switch {
+	case errors.As(err, &pending):
+		// Not sent yet, and sending it again would queue it twice
+		return sendFailure{Status: http.StatusAccepted, Code: "pending_approval"}
+	case errors.As(err, &notAllowed):
+		return sendFailure{Status: http.StatusForbidden, Code: "chat_not_allowed", RetrySafe: true}
+	case errors.As(err, &paced):
+		return sendFailure{Status: http.StatusTooManyRequests, Code: "rate_limited", RetrySafe: true, RetryAfter: paced.RetryAfter}
+	case errors.As(err, &warmup):
+		return sendFailure{Status: http.StatusTooManyRequests, Code: "warmup_limit", RetrySafe: true, RetryAfter: warmup.RetryAfter}
+	case errors.As(err, &duplicate):
+		// This one wasn't sent, but the same text already was, so forcing it out repeats it
+		return sendFailure{Status: http.StatusConflict, Code: "duplicate", DuplicateOf: duplicate.PreviousID}
+	case errors.Is(err, whatsmeow.ErrNotConnected):
+		return sendFailure{Status: http.StatusServiceUnavailable, Code: "not_connected", RetrySafe: true}
+	case errors.As(err, &disconnected):
+		// The connection dropped while waiting for the ack
+		return sendFailure{Status: http.StatusServiceUnavailable, Code: "disconnected"}
+	case errors.Is(err, whatsmeow.ErrMessageTimedOut), errors.Is(err, context.DeadlineExceeded):
+		return sendFailure{Status: http.StatusGatewayTimeout, Code: "timeout"}
+	case errors.Is(err, whatsmeow.ErrNotInGroup):
+		return sendFailure{Status: http.StatusForbidden, Code: "not_in_group", RetrySafe: true}
+	case errors.Is(err, whatsmeow.ErrGroupNotFound):
+		return sendFailure{Status: http.StatusNotFound, Code: "group_not_found", RetrySafe: true}
+	case errors.Is(err, signalerror.ErrUntrustedIdentity):
+		return sendFailure{Status: http.StatusBadGateway, Code: "identity_changed", RetrySafe: true}
+	case errors.Is(err, whatsmeow.ErrNoSession):
+		// Wrapped as "<ErrNoSession> with <user>:<device>"
+		_, device, _ := strings.Cut(err.Error(), whatsmeow.ErrNoSession.Error()+" with ")
+		return sendFailure{Status: http.StatusBadGateway, Code: "no_session", RetrySafe: true, Device: device}
+	case errors.Is(err, whatsmeow.ErrServerReturnedError):
+		return sendFailure{Status: http.StatusBadGateway, Code: "server_rejected", RetrySafe: true}
+	case strings.HasPrefix(err.Error(), "failed to get group members"),
+		strings.HasPrefix(err.Error(), "failed to get device list"):
+		return sendFailure{Status: http.StatusBadGateway, Code: "recipients_unavailable", RetrySafe: true}
+	}
+	return sendFailure{Status: http.StatusInternalServerError, Code: "send_failed"}
+}
+
+// sendErrorResponse reports a failed send with its code and whether it's safe to retry.
+// A send held for approval didn't fail: it's answered 202 with the ID it will go out with.
+func sendErrorResponse(w http.ResponseWriter, err error) {
+	var pending *PendingApprovalError
+	if errors.As(err, &pending) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     pending.ID,
+			"status": "pending",
+		})
+		return
+	}
+	failure := classifySendError(err)
+	extra := map[string]interface{}{
+		"code":       failure.Code,
+		"retry_safe": failure.RetrySafe,
+	}
+	if failure.Device != "" {
+		extra["device"] = failure.Device
+	}
+	if failure.DuplicateOf != "" {
+		extra["duplicate_of"] = failure.DuplicateOf
+	}
+	if failure.RetryAfter > 0 {
+		seconds := int((failure.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		extra["retry_after"] = seconds
+	}
+	errorResponseWith(w, failure.Status, err.Error(), extra)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/libsignal/signalerror"
+	"go.mau.fi/whatsmeow"
+)
+
+func TestClassifySendError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		code      string
+		retrySafe bool
+		device    string
+	}{
+		{whatsmeow.ErrNotConnected, "not_connected", true, ""},
+		{&whatsmeow.DisconnectedError{Action: "message send"}, "disconnected", false, ""},
+		{whatsmeow.ErrMessageTimedOut, "timeout", false, ""},
+		{fmt.Errorf("failed to get group members: %w", whatsmeow.ErrNotInGroup), "not_in_group", true, ""},
+		{fmt.Errorf("failed to process prekey bundle: %w", signalerror.ErrUntrustedIdentity), "identity_changed", true, ""},
+		{fmt.Errorf("%w with %s", whatsmeow.ErrNoSession, "123:4"), "no_session", true, "123:4"},
+		{fmt.Errorf("%w %d", whatsmeow.ErrServerReturnedError, 479), "server_rejected", true, ""},
+		{fmt.Errorf("failed to get device list: boom"), "recipients_unavailable", true, ""},
+		{&ChatNotAllowedError{}, "chat_not_allowed", true, ""},
+		{&PendingApprovalError{}, "pending_approval", false, ""},
+		{fmt.Errorf("something else"), "send_failed", false, ""},
+	} {
+		got := classifySendError(tc.err)
+		if got.Code != tc.code || got.RetrySafe != tc.retrySafe || got.Device != tc.device {
+			t.Errorf("%v: expected %s (retry safe %v, device %q), got %+v", tc.err, tc.code, tc.retrySafe, tc.device, got)
+		}
+	}
+}
+
+func TestSendMessageHandler_ErrorDetail(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	mock.SendMessageError = fmt.Errorf("%w with %s", whatsmeow.ErrNoSession, "123:4")
+	injectMockSession(manager, 1, mock)
+
+	w := httptest.NewRecorder()
+	sendMessageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/send",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "123@g.us", "text": "hi"}`)))
+
+	var resp struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RetrySafe bool   `json:"retry_safe"`
+		Device    string `json:"device"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusBadGateway || resp.Code != "no_session" || !resp.RetrySafe || resp.Device != "123:4" || resp.Error == "" {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
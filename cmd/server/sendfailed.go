@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// SendFailedPayload is the payload of a "send_failed" event: a message that didn't go
+// out, or that WhatsApp rejected after accepting it, where no API response reports it
+type SendFailedPayload struct {
+	ChatJID    string   `json:"chat_jid"`
+	MessageIDs []string `json:"message_ids,omitempty"` // if known
+	// What sent it: "whatsapp" for rejections after sending, "approval", "away",
+	// "auto_react" or "command"
+	Source string `json:"source"`
+	// What the send was for: the approved send's ID, or the incoming message that was
+	// answered or reacted to
+	Reference string `json:"reference,omitempty"`
+	Code      string `json:"code"` // as in /messages/send errors
+	Error     string `json:"error"`
+	RetrySafe bool   `json:"retry_safe"`
+}
+
+// emitSendFailed reports a failed background send with its code, as /messages/send
+// would have if a caller had been waiting on it. A send held for approval hasn't
+// failed; send_pending already reported it.
+func (s *UserSession) emitSendFailed(source, reference string, chat types.JID, id types.MessageID, err error) {
+	var pending *PendingApprovalError
+	if errors.As(err, &pending) {
+		return
+	}
+	failure := classifySendError(err)
+	payload := SendFailedPayload{
+		ChatJID:   chat.String(),
+		Source:    source,
+		Reference: reference,
+		Code:      failure.Code,
+		Error:     err.Error(),
+		RetrySafe: failure.RetrySafe,
+	}
+	if id != "" {
+		payload.MessageIDs = []string{id}
+	}
+	s.emit(MessageEvent{Type: "send_failed", Payload: payload})
+}
+
+// handleServerErrorReceipt reports sent messages WhatsApp's server failed to deliver. The
+// receipt itself is still emitted as a receipt event.
+func (s *UserSession) handleServerErrorReceipt(v *events.Receipt) {
+	log.Printf("[send] User %d: server error receipt for %v in %s", s.UserID, v.MessageIDs, v.Chat)
+	s.emit(MessageEvent{Type: "send_failed", Payload: SendFailedPayload{
+		ChatJID:    v.Chat.String(),
+		MessageIDs: v.MessageIDs,
+		Source:     "whatsapp",
+		Code:       "server_error",
+		Error:      "WhatsApp failed to deliver the message",
+	}})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestSendFailedEvents(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+	chat := types.NewJID("15557654321", types.DefaultUserServer)
+
+	// An away reply that can't be sent
+	mock.SendMessageError = whatsmeow.ErrNotConnected
+	session.Away.Set(AwayConfig{Enabled: true, Message: "back soon"})
+	session.autoReply(MessagePayload{ID: "IN1", ChatJID: chat.String(), Text: "hello?"})
+
+	select {
+	case evt := <-session.EventChan:
+		p := evt.Payload.(SendFailedPayload)
+		if evt.Type != "send_failed" || p.Source != "away" || p.Reference != "IN1" || p.Code != "not_connected" || !p.RetrySafe {
+			t.Errorf("expected send_failed for the away reply, got %s %+v", evt.Type, p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a send_failed event")
+	}
+
+	// A message WhatsApp accepted and then failed to deliver: its receipt, then send_failed
+	session.handleEvent(&events.Receipt{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		MessageIDs:    []types.MessageID{"OUT1"},
+		Type:          types.ReceiptTypeServerError,
+	})
+	if evt := <-session.EventChan; evt.Type != "receipt" || evt.Payload.(ReceiptPayload).Status != "server_error" {
+		t.Errorf("expected the server_error receipt, got %s %+v", evt.Type, evt.Payload)
+	}
+	evt := <-session.EventChan
+	if p, ok := evt.Payload.(SendFailedPayload); !ok || p.Source != "whatsapp" || p.Code != "server_error" || len(p.MessageIDs) != 1 || p.MessageIDs[0] != "OUT1" {
+		t.Errorf("expected send_failed for the rejected message, got %s %+v", evt.Type, evt.Payload)
+	}
+
+	// A background send held for approval hasn't failed
+	session.emitSendFailed("away", "IN2", chat, "", &PendingApprovalError{ID: "HELD"})
+	select {
+	case evt := <-session.EventChan:
+		t.Errorf("expected no send_failed for a held send, got %s %+v", evt.Type, evt.Payload)
+	default:
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionBlockSize is the granularity at which session databases are diffed
+	sessionBlockSize = 64 * 1024
+	// maxSessionDeltas bounds how many deltas a restore has to replay before the next
+	// full snapshot is taken
+	maxSessionDeltas = 50
+
+	defaultFullSnapshotInterval = 24 * time.Hour
+)
+
+// Session upload kinds
+const (
+	sessionUploadFull  = "full"
+	sessionUploadDelta = "delta"
+)
+
+// errSessionBaseMismatch is returned when jo_bot doesn't have the snapshot a delta
+// builds on, and a full snapshot has to be sent instead
+var errSessionBaseMismatch = errors.New("jo_bot rejected delta: base snapshot mismatch")
+
+// sessionSyncConfig controls how session databases are shipped to jo_bot. In full mode
+// (the default) every save uploads the whole database. In incremental mode saves upload
+// only the blocks that changed since the last upload, with a full snapshot every
+// FullInterval or maxSessionDeltas deltas.
+type sessionSyncConfig struct {
+	Incremental  bool
+	FullInterval time.Duration
+}
+
+func sessionSyncFromEnv() sessionSyncConfig {
+	cfg := sessionSyncConfig{FullInterval: durationFromEnv("SESSION_FULL_SNAPSHOT_INTERVAL", defaultFullSnapshotInterval)}
+	switch mode := strings.ToLower(os.Getenv("SESSION_SYNC")); mode {
+	case "", "full":
+	case "incremental":
+		cfg.Incremental = true
+	default:
+		log.Printf("Warning: unknown SESSION_SYNC %q, using full", mode)
+	}
+	return cfg
+}
+
+// sessionSyncState describes what jo_bot last received for a user
+type sessionSyncState struct {
+	Seq     int64    `json:"seq"`
+	FullSeq int64    `json:"full_seq"`
+	FullAt  int64    `json:"full_at"`
+	Hashes  []string `json:"hashes"` // SHA-256 of each block
+}
+
+// sessionUpload is one save sent to jo_bot
+type sessionUpload struct {
+	Kind    string
+	Seq     int64
+	BaseSeq int64  // delta only: the Seq it applies on top of
+	Data    []byte // the whole database, or an encoded delta
+}
+
+func (m *SessionManager) syncStatePath(userID int) string {
+	return filepath.Join(m.dataDir, fmt.Sprintf("session_sync_%d.json", userID))
+}
+
+func hashSessionBlocks(data []byte) []string {
+	hashes := make([]string, 0, (len(data)+sessionBlockSize-1)/sessionBlockSize)
+	for off := 0; off < len(data); off += sessionBlockSize {
+		sum := sha256.Sum256(data[off:min(off+sessionBlockSize, len(data))])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	return hashes
+}
+
+// planSessionUpload decides what to send for data given what jo_bot already has. It
+// returns nil if nothing changed since the last upload.
+func planSessionUpload(cfg sessionSyncConfig, prev *sessionSyncState, data []byte, now time.Time) (*sessionUpload, sessionSyncState) {
+	hashes := hashSessionBlocks(data)
+	if prev == nil || now.Sub(time.Unix(prev.FullAt, 0)) >= cfg.FullInterval || prev.Seq-prev.FullSeq >= maxSessionDeltas {
+		return fullSessionUpload(prev, data, hashes, now)
+	}
+
+	var changed []int
+	for i, hash := range hashes {
+		if i >= len(prev.Hashes) || prev.Hashes[i] != hash {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 && len(hashes) == len(prev.Hashes) {
+		return nil, *prev
+	}
+	next := sessionSyncState{Seq: prev.Seq + 1, FullSeq: prev.FullSeq, FullAt: prev.FullAt, Hashes: hashes}
+	return &sessionUpload{
+		Kind:    sessionUploadDelta,
+		Seq:     next.Seq,
+		BaseSeq: prev.Seq,
+		Data:    encodeSessionDelta(data, changed),
+	}, next
+}
+
+func fullSessionUpload(prev *sessionSyncState, data []byte, hashes []string, now time.Time) (*sessionUpload, sessionSyncState) {
+	seq := int64(1)
+	if prev != nil {
+		seq = prev.Seq + 1
+	}
+	return &sessionUpload{Kind: sessionUploadFull, Seq: seq, Data: data},
+		sessionSyncState{Seq: seq, FullSeq: seq, FullAt: now.Unix(), Hashes: hashes}
+}
+
+// encodeSessionDelta serializes the given blocks of data as the new total size
+// (uint64) followed by index (uint32), length (uint32) and contents of each block
+func encodeSessionDelta(data []byte, blocks []int) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(len(data)))
+	for _, i := range blocks {
+		block := data[i*sessionBlockSize : min((i+1)*sessionBlockSize, len(data))]
+		buf = binary.BigEndian.AppendUint32(buf, uint32(i))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(block)))
+		buf = append(buf, block...)
+	}
+	return buf
+}
+
+// applySessionDelta rebuilds a database from the snapshot it was diffed against
+func applySessionDelta(base, delta []byte) ([]byte, error) {
+	if len(delta) < 8 {
+		return nil, errors.New("session delta too short")
+	}
+	size := binary.BigEndian.Uint64(delta)
+	if size > 1<<34 {
+		return nil, fmt.Errorf("session delta size %d out of range", size)
+	}
+	data := make([]byte, size)
+	copy(data, base)
+	for rest := delta[8:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return nil, errors.New("truncated session delta")
+		}
+		index, length := binary.BigEndian.Uint32(rest), binary.BigEndian.Uint32(rest[4:])
+		rest = rest[8:]
+		off := uint64(index) * sessionBlockSize
+		if uint64(length) > uint64(len(rest)) || length > sessionBlockSize || off+uint64(length) > size {
+			return nil, fmt.Errorf("session delta block %d out of range", index)
+		}
+		copy(data[off:], rest[:length])
+		rest = rest[length:]
+	}
+	return data, nil
+}
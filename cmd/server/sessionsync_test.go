@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+const testSessionKey = "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+
+func TestPlanSessionUpload(t *testing.T) {
+	cfg := sessionSyncConfig{Incremental: true, FullInterval: time.Hour}
+	now := time.Now()
+	data := bytes.Repeat([]byte{1}, 3*sessionBlockSize)
+
+	upload, state := planSessionUpload(cfg, nil, data, now)
+	if upload.Kind != sessionUploadFull || state.Seq != 1 || len(state.Hashes) != 3 {
+		t.Fatalf("expected first upload to be a full snapshot, got %s %+v", upload.Kind, state)
+	}
+	if upload, _ := planSessionUpload(cfg, &state, data, now); upload != nil {
+		t.Errorf("expected nothing to upload for unchanged data, got %s", upload.Kind)
+	}
+
+	changed := bytes.Clone(data)
+	changed[sessionBlockSize+10] = 2
+	upload, next := planSessionUpload(cfg, &state, changed, now)
+	if upload.Kind != sessionUploadDelta || upload.BaseSeq != 1 || next.Seq != 2 {
+		t.Fatalf("expected a delta on top of seq 1, got %s %+v", upload.Kind, next)
+	}
+	if len(upload.Data) != 8+8+sessionBlockSize {
+		t.Errorf("expected the delta to carry one block, got %d bytes", len(upload.Data))
+	}
+
+	if upload, _ := planSessionUpload(cfg, &next, changed, now.Add(2*time.Hour)); upload.Kind != sessionUploadFull {
+		t.Errorf("expected a full snapshot after FullInterval, got %s", upload.Kind)
+	}
+	next.Seq = next.FullSeq + maxSessionDeltas
+	changed[0] = 3
+	if upload, _ := planSessionUpload(cfg, &next, changed, now); upload.Kind != sessionUploadFull {
+		t.Errorf("expected a full snapshot after %d deltas, got %s", maxSessionDeltas, upload.Kind)
+	}
+}
+
+func TestApplySessionDelta(t *testing.T) {
+	base := bytes.Repeat([]byte("a"), 2*sessionBlockSize+100)
+	for _, target := range [][]byte{
+		append(bytes.Clone(base), bytes.Repeat([]byte("b"), sessionBlockSize)...), // grown
+		base[:sessionBlockSize/2], // shrunk
+	} {
+		var changed []int
+		baseHashes := hashSessionBlocks(base)
+		for i, hash := range hashSessionBlocks(target) {
+			if i >= len(baseHashes) || baseHashes[i] != hash {
+				changed = append(changed, i)
+			}
+		}
+		got, err := applySessionDelta(base, encodeSessionDelta(target, changed))
+		if err != nil || !bytes.Equal(got, target) {
+			t.Errorf("round trip to %d bytes failed: %v", len(target), err)
+		}
+	}
+
+	if _, err := applySessionDelta(base, []byte{0, 0, 0, 0, 0, 0, 0, 10, 0, 0, 0, 5, 0, 0, 0, 4, 1, 2, 3, 4}); err == nil {
+		t.Error("expected out-of-range block to be rejected")
+	}
+}
+
+// fakeJoBotSessions stores session uploads the way jo_bot is expected to: a full
+// snapshot plus the deltas chained onto it
+type fakeJoBotSessions struct {
+	full    string
+	seq     int64
+	deltas  []map[string]string
+	uploads []map[string]interface{}
+}
+
+func (f *fakeJoBotSessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": f.full, "deltas": f.deltas})
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.uploads = append(f.uploads, body)
+	seq := int64(body["seq"].(float64))
+	if body["kind"] == sessionUploadDelta {
+		if int64(body["base_seq"].(float64)) != f.seq {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.deltas = append(f.deltas, map[string]string{"data": body["data"].(string)})
+	} else {
+		f.full, f.deltas = body["data"].(string), nil
+	}
+	f.seq = seq
+}
+
+func TestSessionSync_Incremental(t *testing.T) {
+	joBot := &fakeJoBotSessions{}
+	srv := httptest.NewServer(joBot)
+	defer srv.Close()
+
+	m := NewSessionManager(t.TempDir(), srv.URL, testSessionKey)
+	m.sessionSync = sessionSyncConfig{Incremental: true, FullInterval: time.Hour}
+	dbPath := m.storage.Path(5)
+
+	db, err := sql.Open("sqlite3", "file:"+dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	save := func() {
+		t.Helper()
+		if err := m.saveSessionToJoBot(5); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	exec(`CREATE TABLE blobs (id INTEGER PRIMARY KEY, data BLOB)`)
+	for i := 0; i < 8; i++ {
+		exec(`INSERT INTO blobs (id, data) VALUES (?, ?)`, i, bytes.Repeat([]byte{byte(i)}, 32*1024))
+	}
+	save()
+	exec(`UPDATE blobs SET data = ? WHERE id = 7`, bytes.Repeat([]byte("y"), 32*1024))
+	save()
+	save() // unchanged, nothing uploaded
+
+	if len(joBot.uploads) != 2 || joBot.uploads[0]["kind"] != sessionUploadFull || joBot.uploads[1]["kind"] != sessionUploadDelta {
+		t.Fatalf("expected a full snapshot then a delta, got %d uploads", len(joBot.uploads))
+	}
+
+	// jo_bot lost the chain: the next delta is refused and a full snapshot replaces it
+	joBot.seq = 0
+	exec(`DELETE FROM blobs WHERE id = 0`)
+	save()
+	if last := joBot.uploads[len(joBot.uploads)-1]; last["kind"] != sessionUploadFull || len(joBot.deltas) != 0 {
+		t.Errorf("expected fallback to a full snapshot, got %v", last["kind"])
+	}
+
+	exec(`INSERT INTO blobs (id, data) VALUES (100, ?)`, bytes.Repeat([]byte("w"), 200*1024))
+	save()
+	want, err := snapshotSQLite(context.Background(), dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	os.Remove(dbPath)
+	if err := m.fetchSessionFromJoBot(5); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	restored, _ := os.ReadFile(dbPath)
+	if !bytes.Equal(restored, want) {
+		t.Errorf("restored database differs from the last save (%d vs %d bytes)", len(restored), len(want))
+	}
+	if _, err := os.Stat(m.syncStatePath(5)); !os.IsNotExist(err) {
+		t.Error("expected restore to reset the sync state")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// persistedSetting is a per-session setting of type T, saved as JSON to the file the
+// session loads it from. If T has a normalize method, values go through it before
+// they're applied. The zero value holds T's zero value and keeps changes in memory only.
+type persistedSetting[T any] struct {
+	mu    sync.Mutex
+	path  string
+	value T
+}
+
+// settingNormalizer is implemented by setting values that need checking or canonicalizing
+type settingNormalizer[T any] interface {
+	normalize() (T, error)
+}
+
+// normalizeSetting checks value and returns it in canonical form, if its type says how
+func normalizeSetting[T any](value T) (T, error) {
+	if n, ok := any(value).(settingNormalizer[T]); ok {
+		return n.normalize()
+	}
+	return value, nil
+}
+
+// load restores the value saved at path and persists future changes there. Without a
+// file the zero value stays.
+func (p *persistedSetting[T]) load(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	value, err = normalizeSetting(value)
+	if err != nil {
+		return err
+	}
+	p.value = value
+	return nil
+}
+
+// Get returns the current value
+func (p *persistedSetting[T]) Get() T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value
+}
+
+// Set checks and saves a new value, returning it as it was applied
+func (p *persistedSetting[T]) Set(value T) (T, error) {
+	value, err := normalizeSetting(value)
+	if err != nil {
+		return value, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path != "" {
+		if err := writeJSONFile(p.path, value); err != nil {
+			return value, err
+		}
+	}
+	p.value = value
+	return value, nil
+}
+
+// update changes the value in place with fn, and saves it if fn reports a change. The
+// change stays in effect even if it can't be saved.
+func (p *persistedSetting[T]) update(fn func(*T) bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !fn(&p.value) || p.path == "" {
+		return nil
+	}
+	return writeJSONFile(p.path, p.value)
+}
+
+// settingStore is a persistedSetting, or a type wrapping one that does more on Set
+type settingStore[T any] interface {
+	Get() T
+	Set(T) (T, error)
+}
+
+// settingEndpoint describes the GET and POST endpoint of one kind of setting
+type settingEndpoint[T any] struct {
+	name    string // for error messages, e.g. "away config"
+	setting func(*UserSession) settingStore[T]
+	// view is what GET and POST answer with; nil answers with the value itself
+	view func(T) interface{}
+	// accept may turn a POST away before its value is checked, answering it itself
+	accept func(w http.ResponseWriter, value T) bool
+	// refuse answers a POST whose value normalize rejects; nil answers 400 with the error
+	refuse func(w http.ResponseWriter, err error)
+	// applied runs once a POSTed value is saved
+	applied func(ctx context.Context, s *UserSession, value T)
+}
+
+// serveSetting reads (GET) or replaces (POST) a session's setting. A POST body holds
+// user_id next to the setting's own fields.
+func serveSetting[T any](w http.ResponseWriter, r *http.Request, e settingEndpoint[T]) {
+	view := e.view
+	if view == nil {
+		view = func(value T) interface{} { return value }
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		userID := 0
+		fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+		if userID == 0 {
+			errorResponse(w, http.StatusBadRequest, "user_id required")
+			return
+		}
+		session := manager.GetSession(userID)
+		if session == nil {
+			errorResponse(w, http.StatusNotFound, "session not found")
+			return
+		}
+		jsonResponse(w, view(e.setting(session).Get()))
+
+	case http.MethodPost:
+		var req struct {
+			UserID int `json:"user_id"`
+		}
+		var value T
+		body, err := io.ReadAll(r.Body)
+		if err != nil || json.Unmarshal(body, &req) != nil || json.Unmarshal(body, &value) != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		session := manager.GetSession(req.UserID)
+		if session == nil {
+			errorResponse(w, http.StatusNotFound, "session not found")
+			return
+		}
+		if e.accept != nil && !e.accept(w, value) {
+			return
+		}
+		if _, err := normalizeSetting(value); err != nil {
+			if e.refuse != nil {
+				e.refuse(w, err)
+			} else {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		value, err = e.setting(session).Set(value)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to save "+e.name+": "+err.Error())
+			return
+		}
+		if e.applied != nil {
+			e.applied(r.Context(), session, value)
+		}
+		jsonResponse(w, view(value))
+
+	default:
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSetting trims its name and refuses an empty one
+type testSetting struct {
+	Name string `json:"name"`
+}
+
+func (s testSetting) normalize() (testSetting, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return s, errors.New("name required")
+	}
+	return s, nil
+}
+
+func TestPersistedSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setting.json")
+	var setting persistedSetting[testSetting]
+	if err := setting.load(path); err != nil {
+		t.Fatalf("expected a missing file to load as the zero value, got %v", err)
+	}
+	if value, err := setting.Set(testSetting{Name: " alice "}); err != nil || value.Name != "alice" {
+		t.Fatalf("expected the value normalized, got %+v (%v)", value, err)
+	}
+	if _, err := setting.Set(testSetting{Name: " "}); err == nil || setting.Get().Name != "alice" {
+		t.Errorf("expected a refused value to leave the setting alone, got %+v (%v)", setting.Get(), err)
+	}
+
+	var restored persistedSetting[testSetting]
+	if err := restored.load(path); err != nil || restored.Get().Name != "alice" {
+		t.Errorf("expected alice to be restored, got %+v (%v)", restored.Get(), err)
+	}
+
+	// update only writes when something changed
+	os.Remove(path)
+	restored.update(func(s *testSetting) bool { return false })
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected an unchanged value not to be saved")
+	}
+	restored.update(func(s *testSetting) bool {
+		s.Name = "bob"
+		return true
+	})
+	var saved testSetting
+	if err := readJSONFile(path, &saved); err != nil || saved.Name != "bob" {
+		t.Errorf("expected the update to be saved, got %+v (%v)", saved, err)
+	}
+
+	// Without a path nothing touches the disk
+	var memory persistedSetting[testSetting]
+	if _, err := memory.Set(testSetting{Name: "carol"}); err != nil || memory.Get().Name != "carol" {
+		t.Errorf("expected the zero value to keep changes in memory, got %+v (%v)", memory.Get(), err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultStatusBackground is the background of text statuses that don't pick one,
+// WhatsApp's own teal
+const defaultStatusBackground = 0xFF075E54
+
+// parseStatusColor turns "#RRGGBB" into the opaque ARGB value WhatsApp expects
+func parseStatusColor(hex string) (uint32, error) {
+	digits, ok := strings.CutPrefix(hex, "#")
+	if !ok || len(digits) != 6 {
+		return 0, fmt.Errorf("invalid color %q, expected #RRGGBB", hex)
+	}
+	rgb, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q, expected #RRGGBB", hex)
+	}
+	return 0xFF000000 | uint32(rgb), nil
+}
+
+// postStatusHandler posts a text, image or video status. WhatsApp sends it to the
+// contacts allowed by the account's status privacy setting on the phone.
+func postStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Type   string `json:"type"` // "text", "image" or "video"
+		// Text statuses
+		Text            string `json:"text,omitempty"`
+		BackgroundColor string `json:"background_color,omitempty"` // #RRGGBB
+		Font            string `json:"font,omitempty"`             // e.g. "system_bold"
+		// Image and video statuses; media_b64 is the base64 encoded file
+		MimeType string `json:"mime_type,omitempty"`
+		Caption  string `json:"caption,omitempty"`
+	}
+
+	var limits limitCheck
+	if limits.body(w, r, "media_b64", "video"); limits.reject(w) {
+		return
+	}
+
+	media, err := decodeMediaRequest(r.Body, "media_b64", maxVideoSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "media")
+		return
+	}
+	defer media.Close()
+
+	switch req.Type {
+	case "text":
+		if strings.TrimSpace(req.Text) == "" {
+			errorResponse(w, http.StatusBadRequest, "text required")
+			return
+		}
+		limits.length("text", req.Text, maxStatusTextLength)
+	case "image", "video":
+		if media.Size == 0 {
+			errorResponse(w, http.StatusBadRequest, "media_b64 required")
+			return
+		}
+		limits.size("media_b64", req.Type, media.Size)
+		limits.length("caption", req.Caption, maxCaptionLength)
+	default:
+		errorResponse(w, http.StatusBadRequest, "type must be text, image or video")
+		return
+	}
+	if limits.reject(w) {
+		return
+	}
+
+	background := uint32(defaultStatusBackground)
+	if req.BackgroundColor != "" {
+		if background, err = parseStatusColor(req.BackgroundColor); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var font *waE2E.ExtendedTextMessage_FontType
+	if req.Font != "" {
+		value, ok := waE2E.ExtendedTextMessage_FontType_value[strings.ToUpper(req.Font)]
+		if !ok {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("unknown font %q", req.Font))
+			return
+		}
+		font = waE2E.ExtendedTextMessage_FontType(value).Enum()
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	var msg *waE2E.Message
+	if req.Type == "text" {
+		msg = &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:           proto.String(req.Text),
+			TextArgb:       proto.Uint32(0xFFFFFFFF),
+			BackgroundArgb: proto.Uint32(background),
+			Font:           font,
+		}}
+	} else {
+		mimeType, ok := mediaTypeFor(w, media, req.MimeType, req.Type)
+		if !ok {
+			return
+		}
+		if !scanOutgoingMedia(w, session, media, types.StatusBroadcastJID.String()) {
+			return
+		}
+		reader, err := media.Reader()
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		mediaType := whatsmeow.MediaImage
+		if req.Type == "video" {
+			mediaType = whatsmeow.MediaVideo
+		}
+		uploaded, err := session.Client.UploadReader(context.Background(), reader, nil, mediaType)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to upload %s: %v", req.Type, err))
+			return
+		}
+		if req.Type == "image" {
+			msg = &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+				Caption:       proto.String(req.Caption),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(mimeType),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(media.Size)),
+			}}
+		} else {
+			msg = &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+				Caption:       proto.String(req.Caption),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(mimeType),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(media.Size)),
+			}}
+		}
+	}
+
+	resp, err := session.Client.SendMessage(r.Context(), types.StatusBroadcastJID, msg)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
+
+// handleStatus emits a status update as a "status" event. The payload is the same as a
+// message's, with chat_jid status@broadcast and the poster as sender. Statuses aren't
+// stored with the chats, but their media is cached like a message's.
+func (s *UserSession) handleStatus(v *events.Message) {
+	parsed := core.ParseMessage(v)
+	payload, hasContent := s.newMessagePayload(parsed)
+	if !hasContent {
+		return
+	}
+	if media := parsed.Media; media != nil {
+		go s.cacheMedia(v.Info.ID, payload.ChatJID, media.Kind, media.File, media.FileLength)
+	}
+	payload.TimestampFormatted = s.TimeFormat.Format(payload.Timestamp)
+	s.emit(MessageEvent{Type: "status", Payload: payload})
+}
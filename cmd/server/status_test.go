@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPostStatusHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		postStatusHandler(w, httptest.NewRequest(http.MethodPost, "/status/post", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "type": "text", "text": "Open until 8 today", "background_color": "#FF8800", "font": "system_bold"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	call := mock.GetCallsByMethod("SendMessage")[0]
+	if to := call.Args[1].(types.JID); to != types.StatusBroadcastJID {
+		t.Errorf("expected the status broadcast, got %s", to)
+	}
+	text := call.Args[2].(*waE2E.Message).GetExtendedTextMessage()
+	if text.GetText() != "Open until 8 today" || text.GetBackgroundArgb() != 0xFFFF8800 || text.GetFont() != waE2E.ExtendedTextMessage_SYSTEM_BOLD {
+		t.Errorf("unexpected text status %v", text)
+	}
+
+	video := base64.StdEncoding.EncodeToString([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"))
+	if w := post(`{"user_id": 1, "type": "video", "caption": "New menu", "media_b64": "` + video + `"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if upload := mock.GetCallsByMethod("UploadReader")[0]; upload.Args[2] != whatsmeow.MediaVideo {
+		t.Errorf("expected a video upload, got %v", upload.Args[2])
+	}
+	if msg := mock.GetCallsByMethod("SendMessage")[1].Args[2].(*waE2E.Message).GetVideoMessage(); msg.GetCaption() != "New menu" || msg.GetMimetype() != "video/mp4" {
+		t.Errorf("unexpected video status %v", msg)
+	}
+
+	for body, field := range map[string]string{
+		`{"user_id": 1, "type": "image"}`:                                         "media_b64 required",
+		`{"user_id": 1, "type": "text", "text": "hi", "font": "comic_sans"}`:      "unknown font",
+		`{"user_id": 1, "type": "text", "text": "hi", "background_color": "red"}`: "invalid color",
+		`{"user_id": 1, "type": "poll"}`:                                          "type must be",
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(field)) {
+			t.Errorf("%s: expected 400 %q, got %d: %s", body, field, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestUserSession_handleEvent_Status(t *testing.T) {
+	session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10), Messages: newTestMessageStore(t)}
+	poster := types.NewJID("15551234567", types.DefaultUserServer)
+
+	session.handleEvent(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: types.StatusBroadcastJID, Sender: poster},
+			ID:            "S1",
+			PushName:      "Alice",
+			Timestamp:     time.Unix(1700000000, 0),
+		},
+		Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("On holiday!")}},
+	})
+
+	evt := <-session.EventChan
+	payload, ok := evt.Payload.(MessagePayload)
+	if evt.Type != "status" || !ok || payload.Text != "On holiday!" || payload.SenderJID != poster.String() {
+		t.Fatalf("expected a status event, got %+v", evt)
+	}
+	if stored, _ := session.Messages.List(t.Context(), types.StatusBroadcastJID.String(), 0, 10); len(stored) != 0 {
+		t.Errorf("expected statuses not to be stored as messages, got %v", stored)
+	}
+}
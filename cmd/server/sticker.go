@@ -0,0 +1,271 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sticker constraints enforced by WhatsApp clients. Stickers outside these limits are
+// either rejected by the recipient or rendered as a broken image.
+const (
+	stickerDimension        = 512
+	maxStaticStickerSize    = 100 << 10
+	maxAnimatedStickerSize  = 500 << 10
+	maxLottieStickerSize    = 1 << 20
+	lottieStickerMimeType   = "application/was"
+	webpStickerMimeType     = "image/webp"
+	webpAnimationFlag       = 0x02
+	webpHeaderInspectLength = 30
+)
+
+var errInvalidSticker = errors.New("invalid sticker")
+
+// stickerInfo describes validated sticker content
+type stickerInfo struct {
+	MimeType string
+	Width    uint32
+	Height   uint32
+	Animated bool
+	Lottie   bool
+}
+
+// inspectSticker identifies a WebP or Lottie sticker and checks it against the size limits
+func inspectSticker(media *spooledMedia) (*stickerInfo, error) {
+	head, err := media.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	var info *stickerInfo
+	switch {
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		info, err = parseWebPHeader(head)
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		info, err = parseLottieArchive(media)
+	default:
+		return nil, fmt.Errorf("%w: expected WebP or Lottie (.was) content", errInvalidSticker)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Width != stickerDimension || info.Height != stickerDimension {
+		return nil, fmt.Errorf("%w: must be %dx%d, got %dx%d", errInvalidSticker,
+			stickerDimension, stickerDimension, info.Width, info.Height)
+	}
+
+	limit := int64(maxStaticStickerSize)
+	switch {
+	case info.Lottie:
+		limit = maxLottieStickerSize
+	case info.Animated:
+		limit = maxAnimatedStickerSize
+	}
+	if media.Size > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d KB limit", errInvalidSticker, media.Size, limit>>10)
+	}
+	return info, nil
+}
+
+// parseWebPHeader reads the dimensions and animation flag from the first chunk of a WebP file
+func parseWebPHeader(head []byte) (*stickerInfo, error) {
+	if len(head) < webpHeaderInspectLength {
+		return nil, fmt.Errorf("%w: truncated WebP header", errInvalidSticker)
+	}
+	info := &stickerInfo{MimeType: webpStickerMimeType}
+	chunk := head[12:]
+	switch string(chunk[0:4]) {
+	case "VP8X":
+		// Extended format: flags, then 24-bit canvas width-1 and height-1
+		info.Animated = chunk[8]&webpAnimationFlag != 0
+		info.Width = 1 + (uint32(chunk[12]) | uint32(chunk[13])<<8 | uint32(chunk[14])<<16)
+		info.Height = 1 + (uint32(chunk[15]) | uint32(chunk[16])<<8 | uint32(chunk[17])<<16)
+	case "VP8 ":
+		// Lossy: 3-byte frame tag and start code precede the 14-bit dimensions
+		if !bytes.Equal(chunk[11:14], []byte{0x9d, 0x01, 0x2a}) {
+			return nil, fmt.Errorf("%w: bad VP8 start code", errInvalidSticker)
+		}
+		info.Width = uint32(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff)
+		info.Height = uint32(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff)
+	case "VP8L":
+		// Lossless: signature byte, then 14-bit width-1 and height-1 packed together
+		if chunk[8] != 0x2f {
+			return nil, fmt.Errorf("%w: bad VP8L signature", errInvalidSticker)
+		}
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		info.Width = 1 + bits&0x3fff
+		info.Height = 1 + (bits>>14)&0x3fff
+	default:
+		return nil, fmt.Errorf("%w: unknown WebP chunk %q", errInvalidSticker, chunk[0:4])
+	}
+	return info, nil
+}
+
+// parseLottieArchive reads the canvas size from the animation JSON inside a .was archive
+func parseLottieArchive(media *spooledMedia) (*stickerInfo, error) {
+	archive, err := zip.NewReader(media.File, media.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable Lottie archive", errInvalidSticker)
+	}
+	for _, f := range archive.File {
+		if path.Ext(f.Name) != ".json" || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: unreadable Lottie archive", errInvalidSticker)
+		}
+		var animation struct {
+			Width  uint32            `json:"w"`
+			Height uint32            `json:"h"`
+			Layers []json.RawMessage `json:"layers"`
+			Frames *float64          `json:"op"`
+		}
+		err = json.NewDecoder(rc).Decode(&animation)
+		rc.Close()
+		if err != nil || animation.Frames == nil || animation.Layers == nil {
+			// Metadata or other non-animation JSON; keep looking
+			continue
+		}
+		return &stickerInfo{
+			MimeType: lottieStickerMimeType,
+			Width:    animation.Width,
+			Height:   animation.Height,
+			Animated: true,
+			Lottie:   true,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: no Lottie animation found in archive", errInvalidSticker)
+}
+
+func sendStickerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID  int    `json:"user_id"`
+		ChatJID string `json:"chat_jid"`
+	}
+	var limits limitCheck
+	if limits.body(w, r, "sticker_b64", "sticker"); limits.reject(w) {
+		return
+	}
+
+	// sticker_b64 (base64 encoded WebP, .was Lottie archive, or PNG/JPEG to convert) is
+	// decoded straight to a temp file
+	sticker, err := decodeMediaRequest(r.Body, "sticker_b64", maxStickerSourceSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "sticker")
+		return
+	}
+	defer sticker.Close()
+
+	if limits.size("sticker_b64", "sticker", sticker.Size); limits.reject(w) {
+		return
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	if head, err := sticker.Head(); err == nil && isStickerSourceImage(head) {
+		converted, err := convertToSticker(r.Context(), sticker)
+		switch {
+		case errors.Is(err, errInvalidSticker):
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, errStickerConversionUnavailable):
+			errorResponse(w, http.StatusNotImplemented, err.Error())
+			return
+		case err != nil:
+			errorResponse(w, http.StatusInternalServerError, "failed to convert sticker: "+err.Error())
+			return
+		}
+		defer converted.Close()
+		sticker = converted
+	}
+
+	info, err := inspectSticker(sticker)
+	if err != nil {
+		if errors.Is(err, errInvalidSticker) {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+		} else {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if !mimeAllowed(mimeAllowlist, info.MimeType) {
+		errorResponse(w, http.StatusUnsupportedMediaType, "media type "+info.MimeType+" is not allowed")
+		return
+	}
+	if !scanOutgoingMedia(w, session, sticker, jid.String()) {
+		return
+	}
+
+	stickerReader, err := sticker.Reader()
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Stickers are uploaded as images, whatever their container
+	uploaded, err := session.Client.UploadReader(context.Background(), stickerReader, nil, whatsmeow.MediaImage)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to upload sticker: "+err.Error())
+		return
+	}
+
+	msg := &waE2E.Message{
+		StickerMessage: &waE2E.StickerMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			Mimetype:      proto.String(info.MimeType),
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uint64(sticker.Size)),
+			Width:         proto.Uint32(info.Width),
+			Height:        proto.Uint32(info.Height),
+			IsAnimated:    proto.Bool(info.Animated),
+			IsLottie:      proto.Bool(info.Lottie),
+		},
+	}
+
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// webpVP8X builds an extended-format WebP header with the given canvas size, padded to size bytes
+func webpVP8X(width, height int, animated bool, size int) []byte {
+	var flags byte
+	if animated {
+		flags = webpAnimationFlag
+	}
+	w, h := width-1, height-1
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00")
+	data = append(data, flags, 0, 0, 0,
+		byte(w), byte(w>>8), byte(w>>16),
+		byte(h), byte(h>>8), byte(h>>16))
+	if len(data) < size {
+		data = append(data, make([]byte, size-len(data))...)
+	}
+	return data
+}
+
+// webpVP8 builds a lossy WebP header with the given frame size
+func webpVP8(width, height int) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8 \x00\x00\x00\x00")
+	data = append(data, 0, 0, 0, 0x9d, 0x01, 0x2a,
+		byte(width), byte(width>>8), byte(height), byte(height>>8))
+	return data
+}
+
+func lottieArchive(t *testing.T, animationJSON string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"animation/animation_secondary.json": `{"sticker-pack-id":"x"}`,
+		"animation/animation.json":           animationJSON,
+	} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func spoolBytes(t *testing.T, data []byte) *spooledMedia {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "sticker_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	media := &spooledMedia{File: file, Size: int64(len(data))}
+	t.Cleanup(media.Close)
+	return media
+}
+
+func TestInspectSticker(t *testing.T) {
+	t.Run("static WebP", func(t *testing.T) {
+		info, err := inspectSticker(spoolBytes(t, webpVP8(512, 512)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Animated || info.Lottie || info.MimeType != "image/webp" {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	})
+
+	t.Run("animated WebP", func(t *testing.T) {
+		info, err := inspectSticker(spoolBytes(t, webpVP8X(512, 512, true, 200<<10)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !info.Animated || info.Width != 512 || info.Height != 512 {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	})
+
+	t.Run("Lottie archive", func(t *testing.T) {
+		data := lottieArchive(t, `{"v":"5.7.4","fr":30,"ip":0,"op":60,"w":512,"h":512,"layers":[]}`)
+		info, err := inspectSticker(spoolBytes(t, data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !info.Lottie || !info.Animated || info.MimeType != "application/was" {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	})
+
+	rejects := []struct {
+		name string
+		data []byte
+	}{
+		{"wrong dimensions", webpVP8X(256, 256, false, 0)},
+		{"static over size limit", webpVP8X(512, 512, false, 150<<10)},
+		{"animated over size limit", webpVP8X(512, 512, true, 600<<10)},
+		{"not a sticker", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")},
+		{"truncated WebP", []byte("RIFF\x00\x00\x00\x00WEBPVP8X")},
+	}
+	for _, tt := range rejects {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			_, err := inspectSticker(spoolBytes(t, tt.data))
+			if !errors.Is(err, errInvalidSticker) {
+				t.Errorf("expected errInvalidSticker, got %v", err)
+			}
+		})
+	}
+
+	t.Run("rejects archive without animation", func(t *testing.T) {
+		data := lottieArchive(t, `{"not":"lottie"}`)
+		if _, err := inspectSticker(spoolBytes(t, data)); !errors.Is(err, errInvalidSticker) {
+			t.Errorf("expected errInvalidSticker, got %v", err)
+		}
+	})
+}
+
+func TestSendStickerHandler(t *testing.T) {
+	t.Run("rejects non-POST methods", func(t *testing.T) {
+		manager = setupTestManager(t)
+		req := httptest.NewRequest(http.MethodGet, "/messages/sticker", nil)
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", w.Code)
+		}
+	})
+
+	t.Run("rejects invalid sticker", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(manager, 950, mock)
+
+		data := base64.StdEncoding.EncodeToString(webpVP8(100, 100))
+		body := `{"user_id": 950, "chat_jid": "1234567890@s.whatsapp.net", "sticker_b64": "` + data + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/messages/sticker", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+		if len(mock.GetCallsByMethod("UploadReader")) != 0 {
+			t.Error("expected no upload for invalid sticker")
+		}
+	})
+
+	t.Run("sends animated sticker", func(t *testing.T) {
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(manager, 951, mock)
+
+		data := base64.StdEncoding.EncodeToString(webpVP8X(512, 512, true, 64))
+		body := `{"user_id": 951, "chat_jid": "1234567890@s.whatsapp.net", "sticker_b64": "` + data + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/messages/sticker", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		sendCalls := mock.GetCallsByMethod("SendMessage")
+		if len(sendCalls) != 1 {
+			t.Fatalf("expected 1 SendMessage call, got %d", len(sendCalls))
+		}
+		sticker := sendCalls[0].Args[2].(*waE2E.Message).GetStickerMessage()
+		if !sticker.GetIsAnimated() || sticker.GetIsLottie() {
+			t.Errorf("expected animated non-Lottie sticker, got %+v", sticker)
+		}
+		if sticker.GetMimetype() != "image/webp" || sticker.GetWidth() != 512 {
+			t.Errorf("unexpected sticker fields: %+v", sticker)
+		}
+	})
+}
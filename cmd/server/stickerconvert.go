@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+)
+
+// maxStickerSourcePixels bounds the images accepted for conversion, so a small file
+// can't expand into gigabytes when decoded
+const maxStickerSourcePixels = 40_000_000
+
+// stickerQualities are the cwebp qualities tried in turn until the sticker fits the
+// static size limit
+var stickerQualities = []int{80, 60, 40, 20}
+
+// cwebpPath is the WebP encoder used for sticker conversion
+var cwebpPath = "cwebp"
+
+func init() {
+	if path := os.Getenv("CWEBP_PATH"); path != "" {
+		cwebpPath = path
+	}
+}
+
+var errStickerConversionUnavailable = errors.New("sticker conversion unavailable: cwebp not found")
+
+// isStickerSourceImage reports whether head starts a PNG or JPEG that needs converting
+func isStickerSourceImage(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")) || bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff})
+}
+
+// fitSticker scales img to fit a 512x512 canvas, keeping its aspect ratio and centering
+// it on a transparent background
+func fitSticker(img image.Image) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, stickerDimension, stickerDimension))
+	b := img.Bounds()
+	w, h := stickerDimension, stickerDimension
+	if b.Dx() > b.Dy() {
+		h = max(1, b.Dy()*stickerDimension/b.Dx())
+	} else {
+		w = max(1, b.Dx()*stickerDimension/b.Dy())
+	}
+	x, y := (stickerDimension-w)/2, (stickerDimension-h)/2
+	draw.CatmullRom.Scale(canvas, image.Rect(x, y, x+w, y+h), img, b, draw.Src, nil)
+	return canvas
+}
+
+// convertToSticker turns a PNG or JPEG into a static 512x512 WebP sticker, lowering the
+// quality until it fits under the size limit. The caller must close the result.
+func convertToSticker(ctx context.Context, media *spooledMedia) (*spooledMedia, error) {
+	r, err := media.Reader()
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable image: %v", errInvalidSticker, err)
+	}
+	if cfg.Width*cfg.Height > maxStickerSourcePixels {
+		return nil, fmt.Errorf("%w: %dx%d image is too large to convert", errInvalidSticker, cfg.Width, cfg.Height)
+	}
+	if r, err = media.Reader(); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unreadable image: %v", errInvalidSticker, err)
+	}
+
+	dir, err := os.MkdirTemp("", "wa_sticker_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "sticker.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fitSticker(img)); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(src, buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+
+	dst := filepath.Join(dir, "sticker.webp")
+	var size int64
+	for _, quality := range stickerQualities {
+		cmd := exec.CommandContext(ctx, cwebpPath, "-quiet", "-q", fmt.Sprint(quality), "-alpha_q", "100", src, "-o", dst)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+				return nil, errStickerConversionUnavailable
+			}
+			return nil, fmt.Errorf("cwebp failed: %v: %s", err, bytes.TrimSpace(output))
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			return nil, err
+		}
+		if size = info.Size(); size <= maxStaticStickerSize {
+			return spoolFile(dst)
+		}
+	}
+	return nil, fmt.Errorf("%w: still %d bytes at the lowest quality", errInvalidSticker, size)
+}
+
+// spoolFile copies path into a new spooled temp file
+func spoolFile(path string) (*spooledMedia, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp("", "wa_media_*")
+	if err != nil {
+		return nil, err
+	}
+	media := &spooledMedia{File: file, Size: int64(len(data))}
+	if _, err := file.Write(data); err != nil {
+		media.Close()
+		return nil, err
+	}
+	return media, nil
+}
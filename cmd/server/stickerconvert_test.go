@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fakeCwebp installs a stand-in for cwebp that writes webp to its -o argument
+func fakeCwebp(t *testing.T, webp []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.webp")
+	if err := os.WriteFile(fixture, webp, 0600); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "cwebp")
+	body := "#!/bin/sh\nwhile [ $# -gt 0 ]; do [ \"$1\" = -o ] && out=$2; shift; done\ncp " + fixture + " \"$out\"\n"
+	if err := os.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	prev := cwebpPath
+	cwebpPath = script
+	t.Cleanup(func() { cwebpPath = prev })
+}
+
+func TestFitSticker(t *testing.T) {
+	src, _ := png.Decode(bytes.NewReader(testPNG(t, 200, 100)))
+	canvas := fitSticker(src)
+
+	if b := canvas.Bounds(); b.Dx() != 512 || b.Dy() != 512 {
+		t.Fatalf("expected a 512x512 canvas, got %v", b)
+	}
+	// A 2:1 image fills the width and is centered vertically
+	if _, _, _, a := canvas.At(256, 50).RGBA(); a != 0 {
+		t.Error("expected transparent padding above the image")
+	}
+	if r, _, _, a := canvas.At(256, 256).RGBA(); a == 0 || r == 0 {
+		t.Error("expected the image in the middle of the canvas")
+	}
+	if _, _, _, a := canvas.At(5, 256).RGBA(); a == 0 {
+		t.Error("expected the image to reach the left edge")
+	}
+}
+
+func TestSendStickerHandler_ConvertsImages(t *testing.T) {
+	t.Run("converts PNG to a WebP sticker", func(t *testing.T) {
+		fakeCwebp(t, webpVP8(512, 512))
+		manager = setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(manager, 960, mock)
+
+		data := base64.StdEncoding.EncodeToString(testPNG(t, 64, 64))
+		body := `{"user_id": 960, "chat_jid": "1234567890@s.whatsapp.net", "sticker_b64": "` + data + `"}`
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, httptest.NewRequest(http.MethodPost, "/messages/sticker", bytes.NewBufferString(body)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		sticker := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message).GetStickerMessage()
+		if sticker.GetMimetype() != "image/webp" || sticker.GetWidth() != 512 || sticker.GetIsAnimated() {
+			t.Errorf("unexpected sticker fields: %+v", sticker)
+		}
+	})
+
+	t.Run("reports a missing encoder", func(t *testing.T) {
+		prev := cwebpPath
+		cwebpPath = filepath.Join(t.TempDir(), "missing-cwebp")
+		t.Cleanup(func() { cwebpPath = prev })
+		manager = setupTestManager(t)
+		injectMockSession(manager, 961, NewLoggedInMockClient())
+
+		data := base64.StdEncoding.EncodeToString(testPNG(t, 64, 64))
+		body := `{"user_id": 961, "chat_jid": "1234567890@s.whatsapp.net", "sticker_b64": "` + data + `"}`
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, httptest.NewRequest(http.MethodPost, "/messages/sticker", bytes.NewBufferString(body)))
+
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("rejects oversized output", func(t *testing.T) {
+		fakeCwebp(t, webpVP8X(512, 512, false, maxStaticStickerSize+1))
+		manager = setupTestManager(t)
+		injectMockSession(manager, 962, NewLoggedInMockClient())
+
+		data := base64.StdEncoding.EncodeToString(testPNG(t, 64, 64))
+		body := `{"user_id": 962, "chat_jid": "1234567890@s.whatsapp.net", "sticker_b64": "` + data + `"}`
+		w := httptest.NewRecorder()
+		sendStickerHandler(w, httptest.NewRequest(http.MethodPost, "/messages/sticker", bytes.NewBufferString(body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
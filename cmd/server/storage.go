@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jo-inc/wa_meow/internal/core"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// StorageDriver opens the per-user whatsmeow device databases
+type StorageDriver interface {
+	Name() string
+	Open(ctx context.Context, userID int, log waLog.Logger) (*sqlstore.Container, error)
+	// Path returns the file holding the user's database, or "" if the driver doesn't
+	// keep one, in which case sessions can't be backed up to jo_bot
+	Path(userID int) string
+	// Drop deletes the user's database once its container is closed
+	Drop(ctx context.Context, userID int) error
+}
+
+// storageDriverFromEnv picks the driver named by STORAGE_DRIVER: "sqlite" (the default)
+// keeps one file per user in dataDir, "memory" keeps everything in memory, and
+// "postgres" keeps each user in their own schema of the database at STORAGE_DSN.
+// Only the device databases are affected: message history and per-session settings
+// are always files in dataDir.
+func storageDriverFromEnv(dataDir string) (StorageDriver, error) {
+	switch name := strings.ToLower(os.Getenv("STORAGE_DRIVER")); name {
+	case "", "sqlite":
+		return &sqliteDirDriver{Dir: dataDir}, nil
+	case "memory":
+		return &sqliteMemoryDriver{}, nil
+	case "postgres":
+		dsn := os.Getenv("STORAGE_DSN")
+		if dsn == "" {
+			return nil, fmt.Errorf("STORAGE_DSN is required for the postgres storage driver")
+		}
+		return &postgresSchemaDriver{DSN: dsn}, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", name)
+	}
+}
+
+// sqliteDirDriver keeps each user's database in its own SQLite file
+type sqliteDirDriver struct {
+	Dir string
+}
+
+func (d *sqliteDirDriver) Name() string {
+	return "sqlite"
+}
+
+func (d *sqliteDirDriver) Path(userID int) string {
+	return filepath.Join(d.Dir, fmt.Sprintf("user_%d.db", userID))
+}
+
+func (d *sqliteDirDriver) Open(ctx context.Context, userID int, log waLog.Logger) (*sqlstore.Container, error) {
+	return core.OpenSQLite(ctx, d.Path(userID), log)
+}
+
+func (d *sqliteDirDriver) Drop(ctx context.Context, userID int) error {
+	path := d.Path(userID)
+	for _, suffix := range sqliteSuffixes {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotSQLite returns a consistent copy of the SQLite database at path while other
+// connections may be writing to it. The online backup API copies it page by page under
+// a read lock, which also keeps the page layout stable between snapshots so deltas stay
+// small.
+func snapshotSQLite(ctx context.Context, path string) ([]byte, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=10000")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := sql.Open("sqlite3", "file:"+tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer srcConn.Close()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = dstConn.Raw(func(dstRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			backup, err := dstRaw.(*sqlite3.SQLiteConn).Backup("main", srcRaw.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	dstConn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("backup of %s failed: %w", path, err)
+	}
+	return os.ReadFile(tmp.Name())
+}
+
+// sqliteMemoryDriver keeps each user's database in memory for the life of the process.
+// Meant for tests and throwaway deployments.
+type sqliteMemoryDriver struct{}
+
+func (d *sqliteMemoryDriver) Name() string {
+	return "memory"
+}
+
+func (d *sqliteMemoryDriver) Path(userID int) string {
+	return ""
+}
+
+func (d *sqliteMemoryDriver) Open(ctx context.Context, userID int, log waLog.Logger) (*sqlstore.Container, error) {
+	// A shared cache keeps one database per name across the pool's connections
+	return sqlstore.New(ctx, "sqlite3", fmt.Sprintf("file:user_%d?mode=memory&cache=shared&_foreign_keys=on", userID), log)
+}
+
+func (d *sqliteMemoryDriver) Drop(ctx context.Context, userID int) error {
+	// The database goes with its last connection
+	return nil
+}
+
+// postgresSchemaDriver keeps each user's tables in their own schema of a shared
+// Postgres database
+type postgresSchemaDriver struct {
+	DSN string
+}
+
+func (d *postgresSchemaDriver) Name() string {
+	return "postgres"
+}
+
+func (d *postgresSchemaDriver) Path(userID int) string {
+	return ""
+}
+
+func (d *postgresSchemaDriver) Open(ctx context.Context, userID int, log waLog.Logger) (*sqlstore.Container, error) {
+	schema := fmt.Sprintf("user_%d", userID)
+	db, err := sql.Open("postgres", d.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	_, err = db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(schema))
+	db.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema %s: %w", schema, err)
+	}
+	dsn, err := withSearchPath(d.DSN, schema)
+	if err != nil {
+		return nil, err
+	}
+	return sqlstore.New(ctx, "postgres", dsn, log)
+}
+
+func (d *postgresSchemaDriver) Drop(ctx context.Context, userID int) error {
+	schema := fmt.Sprintf("user_%d", userID)
+	db, err := sql.Open("postgres", d.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "DROP SCHEMA IF EXISTS "+pq.QuoteIdentifier(schema)+" CASCADE"); err != nil {
+		return fmt.Errorf("failed to drop schema %s: %w", schema, err)
+	}
+	return nil
+}
+
+// withSearchPath points every connection of dsn, in URL or key=value form, at schema
+func withSearchPath(dsn, schema string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid STORAGE_DSN: %w", err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return strings.TrimSpace(dsn) + " search_path=" + schema, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+func TestStorageDriverFromEnv(t *testing.T) {
+	tests := map[string]string{"": "sqlite", "sqlite": "sqlite", "memory": "memory", "Postgres": "postgres"}
+	t.Setenv("STORAGE_DSN", "postgres://wa@db/wa")
+	for env, want := range tests {
+		t.Setenv("STORAGE_DRIVER", env)
+		driver, err := storageDriverFromEnv(t.TempDir())
+		if err != nil || driver.Name() != want {
+			t.Errorf("STORAGE_DRIVER=%q: got %v, %v; want %s", env, driver, err, want)
+		}
+	}
+
+	t.Setenv("STORAGE_DRIVER", "mysql")
+	if _, err := storageDriverFromEnv(t.TempDir()); err == nil {
+		t.Error("expected unknown driver to be rejected")
+	}
+	t.Setenv("STORAGE_DRIVER", "postgres")
+	t.Setenv("STORAGE_DSN", "")
+	if _, err := storageDriverFromEnv(t.TempDir()); err == nil {
+		t.Error("expected postgres without a DSN to be rejected")
+	}
+}
+
+func TestStorageDrivers_Open(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, driver := range []StorageDriver{&sqliteDirDriver{Dir: dir}, &sqliteMemoryDriver{}} {
+		container, err := driver.Open(ctx, 7, waLog.Noop)
+		if err != nil {
+			t.Fatalf("%s: Open failed: %v", driver.Name(), err)
+		}
+		if _, err := container.GetFirstDevice(ctx); err != nil {
+			t.Errorf("%s: GetFirstDevice failed: %v", driver.Name(), err)
+		}
+		container.Close()
+	}
+
+	sqlite := &sqliteDirDriver{Dir: dir}
+	if _, err := os.Stat(sqlite.Path(7)); err != nil {
+		t.Errorf("expected sqlite driver to create a database file: %v", err)
+	}
+	if err := sqlite.Drop(ctx, 7); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+	if _, err := os.Stat(sqlite.Path(7)); !os.IsNotExist(err) {
+		t.Errorf("expected Drop to delete the database file, got %v", err)
+	}
+}
+
+func TestWithSearchPath(t *testing.T) {
+	tests := map[string]string{
+		"postgres://wa:secret@db:5432/wa?sslmode=disable": "postgres://wa:secret@db:5432/wa?search_path=user_3&sslmode=disable",
+		"host=db dbname=wa ":                              "host=db dbname=wa search_path=user_3",
+	}
+	for dsn, want := range tests {
+		if got, err := withSearchPath(dsn, "user_3"); err != nil || got != want {
+			t.Errorf("withSearchPath(%q) = %q, %v; want %q", dsn, got, err, want)
+		}
+	}
+}
+
+func TestSaveSessionToJoBot_RequiresFileStorage(t *testing.T) {
+	m := NewSessionManager(t.TempDir(), "http://jo-bot.invalid", testSessionKey)
+	m.storage = &sqliteMemoryDriver{}
+	if err := m.saveSessionToJoBot(1); err == nil {
+		t.Error("expected backup without a database file to fail")
+	}
+	if err := m.fetchSessionFromJoBot(1); err != nil {
+		t.Errorf("expected restore to be skipped, got %v", err)
+	}
+}
+
+func TestSnapshotSQLite_ConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user_1.db")
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE kv (k INTEGER PRIMARY KEY, v BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			db.Exec(`INSERT OR REPLACE INTO kv (k, v) VALUES (?, randomblob(4096))`, i%500)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		data, err := snapshotSQLite(context.Background(), path)
+		if err != nil {
+			t.Fatalf("snapshot failed: %v", err)
+		}
+		copyPath := filepath.Join(t.TempDir(), "copy.db")
+		os.WriteFile(copyPath, data, 0600)
+		snap, _ := sql.Open("sqlite3", "file:"+copyPath+"?mode=ro")
+		var result string
+		if err := snap.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil || result != "ok" {
+			t.Errorf("snapshot %d is corrupt: %s, %v", i, result, err)
+		}
+		snap.Close()
+	}
+	close(stop)
+	wg.Wait()
+}
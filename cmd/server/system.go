@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// System message kinds, reported in MessagePayload.SystemType for media_type "system"
+const (
+	SystemGroupSubjectChanged     = "group_subject_changed"
+	SystemGroupDescriptionChanged = "group_description_changed"
+	SystemGroupDescriptionDeleted = "group_description_deleted"
+	SystemGroupJoinedViaLink      = "group_joined_via_link"
+	SystemSecurityCodeChanged     = "security_code_changed"
+	SystemEphemeralChanged        = "ephemeral_changed"
+	SystemCallMissed              = "call_missed"
+	SystemMessageRevoked          = "message_revoked"
+)
+
+// pendingCallTTL bounds how long an unanswered call offer is remembered while waiting
+// for the terminate that marks it missed
+const pendingCallTTL = time.Hour
+
+// newSystemPayload builds a system message for a chat notification. System messages have
+// no WhatsApp message ID, so one is derived from the kind and time to keep them unique.
+func newSystemPayload(chat types.JID, actor *types.JID, kind, text string, ts int64) MessagePayload {
+	payload := MessagePayload{
+		ID:         fmt.Sprintf("system:%s:%d", kind, ts),
+		ChatJID:    chat.String(),
+		Text:       text,
+		Timestamp:  ts,
+		MediaType:  "system",
+		SystemType: kind,
+	}
+	if actor != nil && !actor.IsEmpty() {
+		payload.SenderJID = actor.String()
+	}
+	return payload
+}
+
+// groupInfoSystemMessages turns subject, description, disappearing-timer and
+// invite-link join notifications into system messages
+func groupInfoSystemMessages(v *events.GroupInfo) []MessagePayload {
+	var messages []MessagePayload
+	if name := v.Name; name != nil {
+		actor := v.Sender
+		if !name.NameSetBy.IsEmpty() {
+			actor = &name.NameSetBy
+		}
+		ts := v.Timestamp.Unix()
+		if !name.NameSetAt.IsZero() {
+			ts = name.NameSetAt.Unix()
+		}
+		messages = append(messages, newSystemPayload(v.JID, actor, SystemGroupSubjectChanged, name.Name, ts))
+	}
+	if topic := v.Topic; topic != nil {
+		actor := v.Sender
+		if !topic.TopicSetBy.IsEmpty() {
+			actor = &topic.TopicSetBy
+		}
+		ts := v.Timestamp.Unix()
+		if !topic.TopicSetAt.IsZero() {
+			ts = topic.TopicSetAt.Unix()
+		}
+		kind := SystemGroupDescriptionChanged
+		if topic.TopicDeleted {
+			kind = SystemGroupDescriptionDeleted
+		}
+		msg := newSystemPayload(v.JID, actor, kind, topic.Topic, ts)
+		if topic.TopicID != "" {
+			msg.ID = "system:" + kind + ":" + topic.TopicID
+		}
+		messages = append(messages, msg)
+	}
+	if eph := v.Ephemeral; eph != nil {
+		timer := uint32(0)
+		if eph.IsEphemeral {
+			timer = eph.DisappearingTimer
+		}
+		msg := newSystemPayload(v.JID, v.Sender, SystemEphemeralChanged, describeEphemeralTimer(timer), v.Timestamp.Unix())
+		msg.EphemeralTimer = timer
+		messages = append(messages, msg)
+	}
+	if v.JoinReason == "invite" {
+		for _, joined := range v.Join {
+			msg := newSystemPayload(v.JID, &joined, SystemGroupJoinedViaLink, "joined using this group's invite link", v.Timestamp.Unix())
+			msg.ID += ":" + joined.User
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// ephemeralSettingSystemMessage maps a disappearing-messages change in a direct chat,
+// which arrives as a protocol message, to a system message. It returns nil for anything else.
+func ephemeralSettingSystemMessage(v *events.Message) *MessagePayload {
+	protoMsg := v.Message.GetProtocolMessage()
+	if protoMsg.GetType() != waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+		return nil
+	}
+	timer := protoMsg.GetEphemeralExpiration()
+	msg := newSystemPayload(v.Info.Chat, &v.Info.Sender, SystemEphemeralChanged, describeEphemeralTimer(timer), v.Info.Timestamp.Unix())
+	msg.ID = v.Info.ID
+	msg.IsFromMe = v.Info.IsFromMe
+	msg.EphemeralTimer = timer
+	return &msg
+}
+
+// securityCodeSystemMessage reports a contact's identity key change in their chat
+func securityCodeSystemMessage(v *events.IdentityChange) MessagePayload {
+	return newSystemPayload(v.JID.ToNonAD(), &v.JID, SystemSecurityCodeChanged,
+		"security code changed", v.Timestamp.Unix())
+}
+
+// describeEphemeralTimer renders a timer the way the phone's notification does
+func describeEphemeralTimer(seconds uint32) string {
+	const day = 24 * 60 * 60
+	switch {
+	case seconds == 0:
+		return "disappearing messages turned off"
+	case seconds%day == 0 && seconds/day == 1:
+		return "disappearing messages set to 24 hours"
+	case seconds%day == 0:
+		return fmt.Sprintf("disappearing messages set to %d days", seconds/day)
+	default:
+		return fmt.Sprintf("disappearing messages set to %s", time.Duration(seconds)*time.Second)
+	}
+}
+
+// pendingCall is an incoming call offer that hasn't been answered yet
+type pendingCall struct {
+	From    types.JID
+	Group   types.JID
+	Video   bool
+	Offered time.Time
+}
+
+// CallTracker pairs call offers with their outcome so that calls which ring out
+// unanswered can be reported as missed. The zero value is ready to use.
+type CallTracker struct {
+	mu      sync.Mutex
+	pending map[string]pendingCall
+}
+
+// Offer remembers an incoming call
+func (c *CallTracker) Offer(callID string, call pendingCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]pendingCall)
+	}
+	for id, p := range c.pending {
+		if time.Since(p.Offered) > pendingCallTTL {
+			delete(c.pending, id)
+		}
+	}
+	c.pending[callID] = call
+}
+
+// Answered forgets a call that was picked up or rejected
+func (c *CallTracker) Answered(callID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, callID)
+}
+
+// Terminated returns the call if it ended without being answered
+func (c *CallTracker) Terminated(callID string) (pendingCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call, ok := c.pending[callID]
+	delete(c.pending, callID)
+	return call, ok
+}
+
+// missedCallSystemMessage reports an unanswered call in the caller's (or group's) chat
+func missedCallSystemMessage(callID string, call pendingCall, ended time.Time) MessagePayload {
+	chat := call.From.ToNonAD()
+	if !call.Group.IsEmpty() {
+		chat = call.Group
+	}
+	text := "missed voice call"
+	if call.Video {
+		text = "missed video call"
+	}
+	msg := newSystemPayload(chat, &call.From, SystemCallMissed, text, ended.Unix())
+	msg.ID = "system:" + SystemCallMissed + ":" + callID
+	return msg
+}
+
+// handleSystemEvent turns protocol-level notifications into system messages that are
+// stored and emitted like regular messages. It reports whether evt was one of them.
+func (s *UserSession) handleSystemEvent(evt interface{}) bool {
+	switch v := evt.(type) {
+	case *events.GroupInfo:
+		for _, msg := range groupInfoSystemMessages(v) {
+			s.emitMessage(msg)
+		}
+	case *events.IdentityChange:
+		s.emitMessage(securityCodeSystemMessage(v))
+	case *events.CallOffer:
+		video := false
+		if v.Data != nil {
+			_, video = v.Data.GetOptionalChildByTag("video")
+		}
+		s.Calls.Offer(v.CallID, pendingCall{From: v.From, Group: v.GroupJID, Video: video, Offered: v.Timestamp})
+	case *events.CallOfferNotice:
+		s.Calls.Offer(v.CallID, pendingCall{From: v.From, Group: v.GroupJID, Video: v.Media == "video", Offered: v.Timestamp})
+	case *events.CallAccept:
+		s.Calls.Answered(v.CallID)
+	case *events.CallReject:
+		s.Calls.Answered(v.CallID)
+	case *events.CallTerminate:
+		if call, missed := s.Calls.Terminated(v.CallID); missed {
+			s.emitMessage(missedCallSystemMessage(v.CallID, call, v.Timestamp))
+		}
+	default:
+		return false
+	}
+	return true
+}
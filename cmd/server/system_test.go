@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func newSystemTestSession(t *testing.T) *UserSession {
+	t.Helper()
+	session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+	session.Messages = newTestMessageStore(t)
+	return session
+}
+
+// nextSystemMessage returns the next system message event, skipping the group_update
+// events emitted alongside group notifications
+func nextSystemMessage(t *testing.T, session *UserSession) MessagePayload {
+	t.Helper()
+	for {
+		select {
+		case evt := <-session.EventChan:
+			if evt.Type == "group_update" {
+				continue
+			}
+			payload, _ := evt.Payload.(MessagePayload)
+			if evt.Type != "message" || payload.MediaType != "system" {
+				t.Fatalf("expected system message event, got %s %+v", evt.Type, evt.Payload)
+			}
+			return payload
+		default:
+			t.Fatal("expected a system message event")
+			return MessagePayload{}
+		}
+	}
+}
+
+func TestUserSession_handleEvent_GroupInfoChanges(t *testing.T) {
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	admin := types.NewJID("15551234567", types.DefaultUserServer)
+	changedAt := time.Unix(1700000000, 0)
+
+	session := newSystemTestSession(t)
+
+	session.handleEvent(&events.GroupInfo{
+		JID:       group,
+		Sender:    &admin,
+		Timestamp: changedAt,
+		Name:      &types.GroupName{Name: "Weekend Plans", NameSetAt: changedAt, NameSetBy: admin},
+	})
+	session.handleEvent(&events.GroupInfo{
+		JID:       group,
+		Sender:    &admin,
+		Timestamp: changedAt.Add(time.Minute),
+		Topic:     &types.GroupTopic{Topic: "Hiking on Saturday", TopicID: "T1"},
+	})
+	session.handleEvent(&events.GroupInfo{
+		JID:       group,
+		Sender:    &admin,
+		Timestamp: changedAt.Add(2 * time.Minute),
+		Topic:     &types.GroupTopic{TopicID: "T2", TopicDeleted: true},
+	})
+
+	messages, err := session.Messages.List(context.Background(), group.String(), 0, 10)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 system messages, got %d: %+v", len(messages), messages)
+	}
+
+	want := []struct{ kind, text string }{
+		{SystemGroupSubjectChanged, "Weekend Plans"},
+		{SystemGroupDescriptionChanged, "Hiking on Saturday"},
+		{SystemGroupDescriptionDeleted, ""},
+	}
+	for i, w := range want {
+		msg := messages[i]
+		if msg.MediaType != "system" || msg.SystemType != w.kind || msg.Text != w.text {
+			t.Errorf("message %d: expected %s %q, got %+v", i, w.kind, w.text, msg)
+		}
+		if msg.SenderJID != admin.String() {
+			t.Errorf("message %d: expected sender %s, got %s", i, admin, msg.SenderJID)
+		}
+	}
+
+	// System messages are emitted like regular messages too, next to the group updates
+	counts := map[string]int{}
+	for len(session.EventChan) > 0 {
+		counts[(<-session.EventChan).Type]++
+	}
+	if counts["message"] != 3 || counts["group_update"] != 3 {
+		t.Errorf("expected 3 message and 3 group_update events, got %v", counts)
+	}
+}
+
+func TestUserSession_handleEvent_SystemNotifications(t *testing.T) {
+	contact := types.NewJID("15557654321", types.DefaultUserServer)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	now := time.Unix(1700000000, 0)
+
+	t.Run("disappearing timer change in direct chat", func(t *testing.T) {
+		session := newSystemTestSession(t)
+		session.handleEvent(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: contact, Sender: contact},
+				ID:            "EPH1",
+				Timestamp:     now,
+			},
+			Message: &waE2E.Message{
+				ProtocolMessage: &waE2E.ProtocolMessage{
+					Type:                waE2E.ProtocolMessage_EPHEMERAL_SETTING.Enum(),
+					EphemeralExpiration: proto.Uint32(604800),
+				},
+			},
+		})
+
+		msg := nextSystemMessage(t, session)
+		if msg.SystemType != SystemEphemeralChanged || msg.EphemeralTimer != 604800 || msg.ID != "EPH1" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+		if msg.Text != "disappearing messages set to 7 days" {
+			t.Errorf("unexpected text %q", msg.Text)
+		}
+		if timer, ok := session.Ephemeral.Get(contact.String()); !ok || timer != 604800 {
+			t.Errorf("expected chat timer to be tracked, got %d %v", timer, ok)
+		}
+	})
+
+	t.Run("user joined via invite link", func(t *testing.T) {
+		session := newSystemTestSession(t)
+		session.handleEvent(&events.GroupInfo{JID: group, Timestamp: now, JoinReason: "invite", Join: []types.JID{contact}})
+
+		msg := nextSystemMessage(t, session)
+		if msg.SystemType != SystemGroupJoinedViaLink || msg.SenderJID != contact.String() || msg.ChatJID != group.String() {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	})
+
+	t.Run("security code changed", func(t *testing.T) {
+		session := newSystemTestSession(t)
+		session.handleEvent(&events.IdentityChange{JID: contact, Timestamp: now})
+
+		msg := nextSystemMessage(t, session)
+		if msg.SystemType != SystemSecurityCodeChanged || msg.ChatJID != contact.String() {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	})
+
+	t.Run("unanswered call is reported missed", func(t *testing.T) {
+		session := newSystemTestSession(t)
+		meta := types.BasicCallMeta{From: contact, CallID: "CALL1", Timestamp: now}
+		offer := &waBinary.Node{Tag: "offer", Content: []waBinary.Node{{Tag: "video"}}}
+		session.handleEvent(&events.CallOffer{BasicCallMeta: meta, Data: offer})
+		session.handleEvent(&events.CallTerminate{BasicCallMeta: meta, Reason: "timeout"})
+
+		msg := nextSystemMessage(t, session)
+		if msg.SystemType != SystemCallMissed || msg.Text != "missed video call" || msg.ChatJID != contact.String() {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+
+		stored, _ := session.Messages.List(context.Background(), contact.String(), 0, 10)
+		if len(stored) != 1 {
+			t.Errorf("expected missed call to be stored, got %d messages", len(stored))
+		}
+	})
+
+	t.Run("answered call is not reported", func(t *testing.T) {
+		session := newSystemTestSession(t)
+		meta := types.BasicCallMeta{From: contact, CallID: "CALL2", Timestamp: now}
+		session.handleEvent(&events.CallOffer{BasicCallMeta: meta})
+		session.handleEvent(&events.CallAccept{BasicCallMeta: meta})
+		session.handleEvent(&events.CallTerminate{BasicCallMeta: meta})
+
+		if len(session.EventChan) != 0 {
+			t.Errorf("expected no events for answered call, got %d", len(session.EventChan))
+		}
+	})
+}
+
+func TestDescribeEphemeralTimer(t *testing.T) {
+	tests := map[uint32]string{
+		0:       "disappearing messages turned off",
+		86400:   "disappearing messages set to 24 hours",
+		7776000: "disappearing messages set to 90 days",
+		3600:    "disappearing messages set to 1h0m0s",
+	}
+	for seconds, want := range tests {
+		if got := describeEphemeralTimer(seconds); got != want {
+			t.Errorf("describeEphemeralTimer(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
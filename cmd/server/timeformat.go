@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// localeLayouts are the date formats of the supported locales, by BCP 47 tag. A tag
+// with a region not listed here falls back to its language.
+var localeLayouts = map[string]string{
+	"en":    "02/01/2006 15:04",
+	"en-US": "01/02/2006 3:04 PM",
+	"en-CA": "2006-01-02 3:04 PM",
+	"de":    "02.01.2006 15:04",
+	"es":    "02/01/2006 15:04",
+	"fr":    "02/01/2006 15:04",
+	"fr-CA": "2006-01-02 15:04",
+	"id":    "02/01/2006 15.04",
+	"it":    "02/01/2006 15:04",
+	"ja":    "2006/01/02 15:04",
+	"ko":    "2006. 01. 02. 15:04",
+	"nl":    "02-01-2006 15:04",
+	"pl":    "02.01.2006 15:04",
+	"pt":    "02/01/2006 15:04",
+	"ru":    "02.01.2006 15:04",
+	"tr":    "02.01.2006 15:04",
+	"zh":    "2006/01/02 15:04",
+}
+
+// defaultTimeLayout is used when the session has a timezone but no locale
+const defaultTimeLayout = "2006-01-02 15:04"
+
+// normalizeLocale canonicalizes a locale tag ("pt_br" → "pt-BR") and returns the
+// layout for it, or false if the locale isn't supported
+func normalizeLocale(tag string) (string, string, bool) {
+	lang, region, _ := strings.Cut(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	lang = strings.ToLower(lang)
+	if region != "" {
+		tag = lang + "-" + strings.ToUpper(region)
+		if layout, ok := localeLayouts[tag]; ok {
+			return tag, layout, true
+		}
+	} else {
+		tag = lang
+	}
+	layout, ok := localeLayouts[lang]
+	return tag, layout, ok
+}
+
+// TimeFormatSetting is the timezone and locale a session's timestamps are formatted
+// in, next to the unix ones. The zero value formats nothing.
+type TimeFormatSetting struct {
+	persistedSetting[timeFormatConfig]
+}
+
+type timeFormatConfig struct {
+	Timezone string `json:"timezone"` // IANA name; empty with a locale means UTC
+	Locale   string `json:"locale"`   // BCP 47 tag, e.g. "de-DE"
+
+	loc    *time.Location // nil formats nothing
+	layout string
+}
+
+// normalize checks a config and returns it canonicalized, with its location and layout.
+// Both fields empty turns formatting off.
+func (c timeFormatConfig) normalize() (timeFormatConfig, error) {
+	c.Timezone = strings.TrimSpace(c.Timezone)
+	if c.Timezone == "" && strings.TrimSpace(c.Locale) == "" {
+		return timeFormatConfig{}, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return c, fmt.Errorf("invalid timezone %q", c.Timezone)
+	}
+	layout := defaultTimeLayout
+	if strings.TrimSpace(c.Locale) != "" {
+		var ok bool
+		if c.Locale, layout, ok = normalizeLocale(c.Locale); !ok {
+			return c, fmt.Errorf("unsupported locale %q", c.Locale)
+		}
+	}
+	c.loc, c.layout = loc, layout
+	return c, nil
+}
+
+// Format renders a unix timestamp in the session's timezone and locale, or returns ""
+// if formatting is off
+func (t *TimeFormatSetting) Format(unix int64) string {
+	cfg := t.Get()
+	if cfg.loc == nil || unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).In(cfg.loc).Format(cfg.layout)
+}
+
+// stamp returns a copy of messages with their formatted timestamps filled in. It copies
+// since the slice may still be shared, as with history sync answers that are being saved.
+func (t *TimeFormatSetting) stamp(messages []MessagePayload) []MessagePayload {
+	stamped := make([]MessagePayload, len(messages))
+	for i, msg := range messages {
+		msg.TimestampFormatted = t.Format(msg.Timestamp)
+		stamped[i] = msg
+	}
+	return stamped
+}
+
+// timeFormatHandler reads (GET) or sets (POST) the timezone and locale of a session's
+// formatted timestamps
+func timeFormatHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[timeFormatConfig]{
+		name:    "time format",
+		setting: func(s *UserSession) settingStore[timeFormatConfig] { return &s.TimeFormat },
+		refuse: func(w http.ResponseWriter, err error) {
+			errorResponseWith(w, http.StatusBadRequest, err.Error(), map[string]interface{}{"locales": supportedLocales()})
+		},
+	})
+}
+
+// supportedLocales lists the locale tags timestamps can be formatted for
+func supportedLocales() []string {
+	tags := make([]string, 0, len(localeLayouts))
+	for tag := range localeLayouts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestTimeFormatSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeformat.json")
+	var setting TimeFormatSetting
+	setting.load(path)
+	if got := setting.Format(1700000000); got != "" {
+		t.Errorf("expected nothing formatted by default, got %q", got)
+	}
+
+	cfg, err := setting.Set(timeFormatConfig{Timezone: "America/New_York", Locale: "en_us"})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if cfg.Locale != "en-US" {
+		t.Errorf("expected the locale to be canonicalized, got %q", cfg.Locale)
+	}
+	if got := setting.Format(1700000000); got != "11/14/2023 5:13 PM" {
+		t.Errorf("unexpected US time %q", got)
+	}
+
+	var restored TimeFormatSetting
+	if err := restored.load(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := restored.Format(1700000000); got != "11/14/2023 5:13 PM" {
+		t.Errorf("expected the setting to persist, got %q", got)
+	}
+
+	// Regions without a format of their own fall back to the language
+	restored.Set(timeFormatConfig{Timezone: "Europe/Vienna", Locale: "de-AT"})
+	if got := restored.Format(1700000000); got != "14.11.2023 23:13" {
+		t.Errorf("unexpected Austrian time %q", got)
+	}
+	restored.Set(timeFormatConfig{Timezone: "Asia/Tokyo"})
+	if got := restored.Format(1700000000); got != "2023-11-15 07:13" {
+		t.Errorf("unexpected time without a locale %q", got)
+	}
+
+	for _, bad := range []timeFormatConfig{{Timezone: "Mars/Olympus"}, {Locale: "xx"}} {
+		if _, err := restored.Set(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestUserSession_emitMessage_FormatsTimestamp(t *testing.T) {
+	session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10), Messages: newTestMessageStore(t)}
+	session.TimeFormat.Set(timeFormatConfig{Timezone: "Europe/Berlin", Locale: "de"})
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	session.handleEvent(incomingText(chat, "M1", "hallo"))
+
+	payload := (<-session.EventChan).Payload.(MessagePayload)
+	if payload.Timestamp != 1700000000 || payload.TimestampFormatted != "14.11.2023 23:13" {
+		t.Errorf("expected both the unix and formatted timestamp, got %d and %q", payload.Timestamp, payload.TimestampFormatted)
+	}
+
+	// Stored messages are formatted as they're read back, in the current setting
+	session.TimeFormat.Set(timeFormatConfig{Timezone: "UTC", Locale: "en-US"})
+	messages, err := session.Messages.List(t.Context(), chat.String(), 0, 10)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("expected the stored message, got %v (%v)", messages, err)
+	}
+	messages = session.TimeFormat.stamp(messages)
+	if messages[0].TimestampFormatted != "11/14/2023 10:13 PM" {
+		t.Errorf("unexpected formatted timestamp %q", messages[0].TimestampFormatted)
+	}
+}
+
+func TestTimeFormatHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	injectMockSession(manager, 1, NewLoggedInMockClient())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		timeFormatHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/time-format", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"user_id": 1, "timezone": "Europe/Paris", "locale": "fr-FR"}`); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"locale":"fr-FR"`)) {
+		t.Errorf("expected the setting to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post(`{"user_id": 1, "locale": "tlh"}`); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(`"locales"`)) {
+		t.Errorf("expected an unsupported locale to be refused with the supported ones, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	timeFormatHandler(w, httptest.NewRequest(http.MethodGet, "/sessions/time-format?user_id=1", nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"timezone":"Europe/Paris"`)) {
+		t.Errorf("expected the saved setting, got %d: %s", w.Code, w.Body.String())
+	}
+}
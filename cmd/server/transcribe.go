@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	transcribeTimeout      = 2 * time.Minute
+	defaultTranscribeModel = "whisper-1"
+)
+
+// Transcript is the text recognised in a voice note
+type Transcript struct {
+	Text     string
+	Language string // empty if the service doesn't report it
+}
+
+// Transcriber converts recorded speech to text
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, mimeType string) (Transcript, error)
+}
+
+// transcriber is nil unless TRANSCRIBE_URL is set
+var transcriber = transcriberFromEnv()
+
+func transcriberFromEnv() Transcriber {
+	endpoint := os.Getenv("TRANSCRIBE_URL")
+	if endpoint == "" {
+		return nil
+	}
+	model := os.Getenv("TRANSCRIBE_MODEL")
+	if model == "" {
+		model = defaultTranscribeModel
+	}
+	log.Printf("Voice note transcription enabled via %s (model %s)", endpoint, model)
+	return NewHTTPTranscriber(endpoint, os.Getenv("TRANSCRIBE_API_KEY"), model)
+}
+
+// HTTPTranscriber posts audio to an OpenAI-compatible /v1/audio/transcriptions endpoint,
+// which both the hosted Whisper API and local Whisper servers expose
+type HTTPTranscriber struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+func NewHTTPTranscriber(url, apiKey, model string) *HTTPTranscriber {
+	return &HTTPTranscriber{
+		URL:    url,
+		APIKey: apiKey,
+		Model:  model,
+		Client: &http.Client{Timeout: transcribeTimeout},
+	}
+}
+
+// audioFileName picks a file name whose extension tells the service how to decode the audio
+func audioFileName(mimeType string) string {
+	base, _, _ := mime.ParseMediaType(mimeType)
+	switch base {
+	case "audio/ogg", "audio/opus":
+		return "voice.ogg"
+	case "audio/mpeg":
+		return "voice.mp3"
+	case "audio/mp4", "audio/aac", "audio/x-m4a":
+		return "voice.m4a"
+	case "audio/wav", "audio/x-wav":
+		return "voice.wav"
+	case "audio/webm":
+		return "voice.webm"
+	default:
+		return "voice.ogg" // WhatsApp voice notes are Ogg Opus
+	}
+}
+
+func (t *HTTPTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType string) (Transcript, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("model", t.Model)
+	form.WriteField("response_format", "json")
+	file, err := form.CreateFormFile("file", audioFileName(mimeType))
+	if err != nil {
+		return Transcript{}, err
+	}
+	file.Write(audio)
+	if err := form.Close(); err != nil {
+		return Transcript{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, &body)
+	if err != nil {
+		return Transcript{}, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return Transcript{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Transcript{}, fmt.Errorf("transcription service returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Text     string `json:"text"`
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Transcript{}, fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return Transcript{Text: strings.TrimSpace(result.Text), Language: result.Language}, nil
+}
+
+// TranscriptionPayload is the payload of a "transcription" event, sent after the voice
+// note it belongs to
+type TranscriptionPayload struct {
+	MessageID string `json:"message_id"`
+	ChatJID   string `json:"chat_jid"`
+	Text      string `json:"text"`
+	Language  string `json:"language,omitempty"`
+}
+
+// transcribeVoiceNote transcribes a downloaded voice note and emits the result. It's called
+// from the download goroutines, so it's fine for it to block.
+func (s *UserSession) transcribeVoiceNote(msgID, chatJID string, audio []byte, mimeType string) {
+	if transcriber == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transcribeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	transcript, err := transcriber.Transcribe(ctx, audio, mimeType)
+	if err != nil {
+		log.Printf("[transcribe] Voice note %s failed: %v", msgID, err)
+		return
+	}
+	log.Printf("[transcribe] Voice note %s: %d chars in %v", msgID, len(transcript.Text), time.Since(start).Round(time.Millisecond))
+	s.emit(MessageEvent{Type: "transcription", Payload: TranscriptionPayload{
+		MessageID: msgID,
+		ChatJID:   chatJID,
+		Text:      transcript.Text,
+		Language:  transcript.Language,
+	}})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeTranscriber struct {
+	text string
+	got  []byte
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType string) (Transcript, error) {
+	f.got = audio
+	return Transcript{Text: f.text, Language: "en"}, nil
+}
+
+func TestHTTPTranscriber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected auth header %q", r.Header.Get("Authorization"))
+		}
+		if r.FormValue("model") != "whisper-1" {
+			t.Errorf("unexpected model %q", r.FormValue("model"))
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "voice.ogg" || string(data) != "OggS-audio" {
+			t.Errorf("unexpected upload %s: %q", header.Filename, data)
+		}
+		w.Write([]byte(`{"text": " see you at five ", "language": "english"}`))
+	}))
+	defer srv.Close()
+
+	tr := NewHTTPTranscriber(srv.URL, "key", "whisper-1")
+	transcript, err := tr.Transcribe(context.Background(), []byte("OggS-audio"), "audio/ogg; codecs=opus")
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if transcript.Text != "see you at five" || transcript.Language != "english" {
+		t.Errorf("unexpected transcript: %+v", transcript)
+	}
+}
+
+func TestAudioFileName(t *testing.T) {
+	tests := map[string]string{
+		"audio/ogg; codecs=opus": "voice.ogg",
+		"audio/mpeg":             "voice.mp3",
+		"audio/mp4":              "voice.m4a",
+		"":                       "voice.ogg",
+	}
+	for mimeType, want := range tests {
+		if got := audioFileName(mimeType); got != want {
+			t.Errorf("audioFileName(%q) = %q, want %q", mimeType, got, want)
+		}
+	}
+}
+
+func TestUserSession_handleEvent_TranscribesVoiceNote(t *testing.T) {
+	original := transcriber
+	defer func() { transcriber = original }()
+	fake := &fakeTranscriber{text: "call me back"}
+	transcriber = fake
+
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+	mock := NewLoggedInMockClient()
+	mock.DownloadData = []byte("voice-bytes")
+	session := &UserSession{
+		UserID:     1,
+		Client:     mock,
+		EventChan:  make(chan MessageEvent, 10),
+		MediaCache: make(map[string][]byte),
+	}
+
+	session.handleEvent(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "PTT1",
+			Timestamp:     time.Unix(1700000000, 0),
+		},
+		Message: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			PTT:           proto.Bool(true),
+			Mimetype:      proto.String("audio/ogg; codecs=opus"),
+			DirectPath:    proto.String("/v/t62/voice"),
+			MediaKey:      []byte("key"),
+			FileEncSHA256: []byte("hash"),
+		}},
+	})
+
+	if evt := <-session.EventChan; evt.Type != "message" {
+		t.Fatalf("expected message event first, got %s", evt.Type)
+	}
+	select {
+	case evt := <-session.EventChan:
+		payload, ok := evt.Payload.(TranscriptionPayload)
+		if evt.Type != "transcription" || !ok {
+			t.Fatalf("expected transcription event, got %s %+v", evt.Type, evt.Payload)
+		}
+		if payload.MessageID != "PTT1" || payload.ChatJID != chat.String() || payload.Text != "call me back" {
+			t.Errorf("unexpected transcription: %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a transcription event")
+	}
+	if string(fake.got) != "voice-bytes" {
+		t.Errorf("expected downloaded audio to be transcribed, got %q", fake.got)
+	}
+}
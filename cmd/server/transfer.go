@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var (
+	errTransferSourceMissing = errors.New("source session not found")
+	errTransferNotLinked     = errors.New("source session is not linked")
+	errTransferTargetInUse   = errors.New("target user already has a session")
+)
+
+// fileMove is one file renamed during a session transfer
+type fileMove struct {
+	from, to string
+}
+
+// sqliteSuffixes are the files SQLite may leave next to a database: a WAL or journal
+var sqliteSuffixes = []string{"", "-wal", "-shm", "-journal"}
+
+// sessionDataFiles lists the message history and settings files of userID. The device
+// database is the storage driver's.
+func (m *SessionManager) sessionDataFiles(userID int) []string {
+	var files []string
+	messages := filepath.Join(m.dataDir, fmt.Sprintf("messages_%d.db", userID))
+	for _, suffix := range sqliteSuffixes {
+		files = append(files, messages+suffix)
+	}
+	for _, setting := range sessionSettings {
+		files = append(files, m.settingPath(setting.file, userID))
+	}
+	return files
+}
+
+// userFiles lists every file kept on disk for userID, paired with where it lives for
+// newUserID. The session sync state isn't included: jo_bot has no snapshot for the new
+// user, so the first save after a transfer has to be a full one.
+func (m *SessionManager) userFiles(userID, newUserID int) []fileMove {
+	var moves []fileMove
+	for _, suffix := range sqliteSuffixes {
+		moves = append(moves, fileMove{m.storage.Path(userID) + suffix, m.storage.Path(newUserID) + suffix})
+	}
+	to := m.sessionDataFiles(newUserID)
+	for i, from := range m.sessionDataFiles(userID) {
+		moves = append(moves, fileMove{from, to[i]})
+	}
+	return moves
+}
+
+// TransferSession reassigns the linked WhatsApp session of one user to another: the
+// device database, message history, per-session settings, cached media and sends held
+// for approval all move to toUserID, and the session reconnects under its new owner.
+// The target must not have a session or any files of its own. If a file can't be moved,
+// the ones already moved are put back and the session stays with fromUserID.
+func (m *SessionManager) TransferSession(fromUserID, toUserID int) (*UserSession, error) {
+	if m.storage.Path(fromUserID) == "" {
+		return nil, fmt.Errorf("session transfer isn't supported by the %s storage driver", m.storage.Name())
+	}
+
+	m.mu.Lock()
+	old, ok := m.sessions[fromUserID]
+	if !ok {
+		m.mu.Unlock()
+		return nil, errTransferSourceMissing
+	}
+	if old.Client.GetStore().GetID() == nil {
+		m.mu.Unlock()
+		return nil, errTransferNotLinked
+	}
+	if _, ok := m.sessions[toUserID]; ok {
+		m.mu.Unlock()
+		return nil, errTransferTargetInUse
+	}
+	moves := m.userFiles(fromUserID, toUserID)
+	for _, mv := range moves {
+		if _, err := os.Stat(mv.to); err == nil {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s exists", errTransferTargetInUse, filepath.Base(mv.to))
+		}
+	}
+	old.stop()
+	old.Client.Disconnect()
+	old.Messages.Close()
+	if old.Container != nil {
+		old.Container.Close()
+	}
+	delete(m.sessions, fromUserID)
+
+	session, err := m.moveSessionFiles(moves, toUserID)
+	if err != nil {
+		log.Printf("Session transfer from user %d to %d failed, restoring: %v", fromUserID, toUserID, err)
+		if _, reopenErr := m.openSession(fromUserID); reopenErr != nil {
+			log.Printf("Failed to reopen session for user %d: %v", fromUserID, reopenErr)
+		}
+		m.mu.Unlock()
+		return nil, err
+	}
+	os.Remove(m.syncStatePath(fromUserID))
+
+	old.MediaMu.RLock()
+	session.MediaCache, session.MediaCacheInfo = old.MediaCache, old.MediaCacheInfo
+	old.MediaMu.RUnlock()
+	old.PendingRetriesMu.RLock()
+	session.PendingRetries = old.PendingRetries
+	old.PendingRetriesMu.RUnlock()
+	// Their callers were told the sends are pending; they're approved under the new owner
+	old.Pending.mu.Lock()
+	session.Pending.items = old.Pending.items
+	old.Pending.mu.Unlock()
+	m.mu.Unlock()
+
+	log.Printf("Transferred session from user %d to user %d", fromUserID, toUserID)
+	if err := m.deleteSessionFromJoBot(fromUserID); err != nil {
+		log.Printf("Warning: failed to delete jo_bot backup for user %d: %v", fromUserID, err)
+	}
+	if err := m.saveSessionToJoBot(toUserID); err != nil {
+		log.Printf("Warning: failed to save transferred session for user %d: %v", toUserID, err)
+	}
+	if session.Client.GetStore().GetID() != nil {
+		session.ConnHistory.Record(ConnStateConnectAttempt, fmt.Sprintf("transferred from user %d", fromUserID))
+		if err := session.Client.Connect(); err != nil {
+			log.Printf("Warning: transferred session for user %d failed to connect: %v", toUserID, err)
+		}
+	}
+	return session, nil
+}
+
+// moveSessionFiles renames the files of a closed session and opens it under toUserID,
+// undoing the renames if anything fails. The caller must hold m.mu.
+func (m *SessionManager) moveSessionFiles(moves []fileMove, toUserID int) (*UserSession, error) {
+	var done []fileMove
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				log.Printf("Failed to move %s back: %v", done[i].to, err)
+			}
+		}
+	}
+	for _, mv := range moves {
+		if _, err := os.Stat(mv.from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(mv.from, mv.to); err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to move %s: %w", filepath.Base(mv.from), err)
+		}
+		done = append(done, mv)
+	}
+
+	session, err := m.openSession(toUserID)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	return session, nil
+}
+
+// deleteSessionFromJoBot drops jo_bot's backup for a user whose session moved away, so
+// it can't be restored and linked twice
+func (m *SessionManager) deleteSessionFromJoBot(userID int) error {
+	if m.joBotURL == "" || m.encryptKey == nil {
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/api/whatsapp/session?user_id=%d", m.joBotURL, userID)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-WhatsApp-Internal-Token", m.joBotInternalToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("delete failed: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func transferSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		FromUserID int `json:"from_user_id"`
+		ToUserID   int `json:"to_user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.FromUserID == 0 || req.ToUserID == 0 {
+		errorResponse(w, http.StatusBadRequest, "from_user_id and to_user_id required")
+		return
+	}
+	if req.FromUserID == req.ToUserID {
+		errorResponse(w, http.StatusBadRequest, "from_user_id and to_user_id must differ")
+		return
+	}
+
+	session, err := manager.TransferSession(req.FromUserID, req.ToUserID)
+	switch {
+	case errors.Is(err, errTransferSourceMissing):
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	case errors.Is(err, errTransferNotLinked):
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	case errors.Is(err, errTransferTargetInUse):
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"status":       "transferred",
+		"from_user_id": req.FromUserID,
+		"user_id":      req.ToUserID,
+		"connected":    session.Client.IsConnected(),
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// injectLinkedSession sets up a linked session for userID backed by real files in the
+// manager's data directory
+func injectLinkedSession(t *testing.T, m *SessionManager, userID int) (*UserSession, *MockWhatsAppClient) {
+	t.Helper()
+	mock := NewLoggedInMockClient()
+	mock.store.ID = &types.JID{User: "1234567890", Device: 4, Server: types.DefaultUserServer}
+	session := injectMockSession(m, userID, mock)
+
+	container, err := m.storage.Open(context.Background(), userID, waLog.Noop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Container = container
+	session.Messages, err = openMessageStore(filepath.Join(m.dataDir, fmt.Sprintf("messages_%d.db", userID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Messages.Save(context.Background(), MessagePayload{ID: "M1", ChatJID: "15551234567@s.whatsapp.net", Text: "hello", Timestamp: 1700000000})
+	session.Away.load(filepath.Join(m.dataDir, fmt.Sprintf("away_%d.json", userID)))
+	if _, err := session.Away.Set(AwayConfig{Enabled: true, Message: "back soon"}); err != nil {
+		t.Fatal(err)
+	}
+	session.Warmup.load(filepath.Join(m.dataDir, fmt.Sprintf("warmup_%d.json", userID)))
+	session.Warmup.linked(time.Now())
+	session.MediaCache["M2"] = []byte("jpeg")
+	return session, mock
+}
+
+func TestTransferSessionHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	_, mock := injectLinkedSession(t, manager, 1)
+
+	transfer := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sessions/transfer", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		transferSessionHandler(w, req)
+		return w
+	}
+
+	if w := transfer(`{"from_user_id": 1, "to_user_id": 1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a transfer to the same user, got %d", w.Code)
+	}
+	if w := transfer(`{"from_user_id": 9, "to_user_id": 2}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing source, got %d", w.Code)
+	}
+	os.WriteFile(filepath.Join(manager.dataDir, "retention_3.json"), []byte(`{}`), 0600)
+	if w := transfer(`{"from_user_id": 1, "to_user_id": 3}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 when the target has files, got %d", w.Code)
+	}
+	if manager.GetSession(1) == nil || len(mock.GetCallsByMethod("Disconnect")) != 0 {
+		t.Fatal("expected a rejected transfer to leave the source session alone")
+	}
+
+	w := transfer(`{"from_user_id": 1, "to_user_id": 2}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mock.GetCallsByMethod("Disconnect")) != 1 {
+		t.Error("expected the source client to be disconnected")
+	}
+	if manager.GetSession(1) != nil {
+		t.Error("expected the source session to be gone")
+	}
+	for _, name := range []string{"user_1.db", "messages_1.db", "away_1.json", "warmup_1.json"} {
+		if _, err := os.Stat(filepath.Join(manager.dataDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved", name)
+		}
+	}
+
+	session := manager.GetSession(2)
+	if session == nil {
+		t.Fatal("expected a session for the target user")
+	}
+	defer session.Messages.Close()
+	if session.DBPath != manager.storage.Path(2) {
+		t.Errorf("expected the session to use %s, got %s", manager.storage.Path(2), session.DBPath)
+	}
+	if msgs, err := session.Messages.List(context.Background(), "15551234567@s.whatsapp.net", 0, 10); err != nil || len(msgs) != 1 {
+		t.Errorf("expected message history to move, got %d messages, %v", len(msgs), err)
+	}
+	if cfg := session.Away.Get(); cfg.Message != "back soon" {
+		t.Errorf("expected away config to move, got %+v", cfg)
+	}
+	if string(session.MediaCache["M2"]) != "jpeg" {
+		t.Error("expected cached media to move")
+	}
+}
+
+func TestTransferSession_Unsupported(t *testing.T) {
+	m := setupTestManager(t)
+	m.storage = &sqliteMemoryDriver{}
+	injectMockSession(m, 1, NewLoggedInMockClient())
+	if _, err := m.TransferSession(1, 2); err == nil {
+		t.Error("expected transfer without database files to fail")
+	}
+}
+
+func TestTransferSession_keepsPendingSends(t *testing.T) {
+	manager = setupTestManager(t)
+	old, _ := injectLinkedSession(t, manager, 1)
+	to := types.NewJID("15551234567", types.DefaultUserServer)
+	old.Pending.add(&pendingSend{ID: "P1", To: to, Message: &waE2E.Message{Conversation: proto.String("held")}, CreatedAt: time.Now()})
+
+	session, err := manager.TransferSession(1, 2)
+	if err != nil {
+		t.Fatalf("expected the transfer to succeed, got %v", err)
+	}
+	defer session.Messages.Close()
+	if list := session.Pending.List(); len(list) != 1 || list[0].ID != "P1" || list[0].Text != "held" {
+		t.Errorf("expected the held send to move to the new owner, got %+v", list)
+	}
+}
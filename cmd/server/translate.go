@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const translateTimeout = 10 * time.Second
+
+// Translation is the result of translating a message
+type Translation struct {
+	DetectedLanguage string // ISO 639-1 code, empty if unknown
+	Text             string // empty if the text was already in the target language
+}
+
+// Translator detects the language of a message and translates it
+type Translator interface {
+	Translate(ctx context.Context, text, targetLanguage string) (Translation, error)
+}
+
+// noopTranslator is used when no translation service is configured
+type noopTranslator struct{}
+
+func (noopTranslator) Translate(context.Context, string, string) (Translation, error) {
+	return Translation{}, nil
+}
+
+var translator = translatorFromEnv()
+
+// translatorFromEnv returns an HTTP translator if TRANSLATE_URL is set, or the no-op one
+func translatorFromEnv() Translator {
+	baseURL := os.Getenv("TRANSLATE_URL")
+	if baseURL == "" {
+		return noopTranslator{}
+	}
+	log.Printf("Message translation available via %s", baseURL)
+	return NewHTTPTranslator(baseURL, os.Getenv("TRANSLATE_API_KEY"))
+}
+
+// HTTPTranslator calls a LibreTranslate-compatible /translate endpoint
+type HTTPTranslator struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewHTTPTranslator(baseURL, apiKey string) *HTTPTranslator {
+	return &HTTPTranslator{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: translateTimeout},
+	}
+}
+
+func (t *HTTPTranslator) Translate(ctx context.Context, text, targetLanguage string) (Translation, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  targetLanguage,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+	if err != nil {
+		return Translation{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.BaseURL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return Translation{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return Translation{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Translation{}, fmt.Errorf("translator returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Translation{}, fmt.Errorf("invalid translator response: %w", err)
+	}
+	translation := Translation{DetectedLanguage: result.DetectedLanguage.Language}
+	if translation.DetectedLanguage != targetLanguage && result.TranslatedText != text {
+		translation.Text = result.TranslatedText
+	}
+	return translation, nil
+}
+
+// TranslationSetting is the language a session's incoming messages are translated into
+type TranslationSetting struct {
+	persistedSetting[translationConfig]
+}
+
+type translationConfig struct {
+	TargetLanguage string `json:"target_language"` // empty disables translation
+}
+
+func (c translationConfig) normalize() (translationConfig, error) {
+	c.TargetLanguage = strings.ToLower(strings.TrimSpace(c.TargetLanguage))
+	return c, nil
+}
+
+// Target returns the language messages are translated into, or "" if disabled
+func (t *TranslationSetting) Target() string {
+	return t.Get().TargetLanguage
+}
+
+// translateMessage annotates an incoming message with its language and translation
+func translateMessage(tr Translator, target string, payload *MessagePayload) {
+	text := payload.Text
+	if text == "" {
+		text = payload.Caption
+	}
+	if text == "" || payload.IsFromMe {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), translateTimeout)
+	defer cancel()
+
+	translation, err := tr.Translate(ctx, text, target)
+	if err != nil {
+		log.Printf("[translate] Translating %s failed: %v", payload.ID, err)
+		return
+	}
+	payload.Language = translation.DetectedLanguage
+	if translation.Text != "" {
+		payload.Translation = translation.Text
+		payload.TranslationLanguage = target
+	}
+}
+
+// wantsTranslation reports whether an incoming message should go through the translator
+func (s *UserSession) wantsTranslation(payload MessagePayload) string {
+	if _, ok := translator.(noopTranslator); ok || payload.IsFromMe {
+		return ""
+	}
+	if payload.Text == "" && payload.Caption == "" {
+		return ""
+	}
+	return s.Translation.Target()
+}
+
+// enrichQueueSize is how many messages may wait for lookups before the event loop waits too
+const enrichQueueSize = 64
+
+// enrichMaxDelay is how long a message may wait for its turn before its lookups are
+// skipped, so a slow service can't hold back the messages behind it for long
+const enrichMaxDelay = translateTimeout
+
+type enrichJob struct {
+	payload     MessagePayload
+	geocoder    Geocoder
+	translateTo string
+	queued      time.Time
+}
+
+// EnrichQueue runs a session's message lookups on a single worker, so messages come
+// out in the order they arrived. The zero value is ready to use.
+type EnrichQueue struct {
+	once    sync.Once
+	jobs    chan enrichJob
+	pending atomic.Int32 // queued or being looked up
+}
+
+// emitEnriched runs the slow lookups a message needs (reverse geocoding, translation)
+// before emitting it. They run off the event loop so a slow service can't stall it;
+// messages that need none still wait behind ones that do, and failed lookups leave
+// the message as it was.
+func (s *UserSession) emitEnriched(payload MessagePayload, g Geocoder, translateTo string) {
+	q := &s.Enrich
+	if g == nil && translateTo == "" && q.pending.Load() == 0 {
+		s.emitMessage(payload)
+		return
+	}
+	q.once.Do(func() {
+		q.jobs = make(chan enrichJob, enrichQueueSize)
+		go s.runEnrich()
+	})
+	q.pending.Add(1)
+	select {
+	case q.jobs <- enrichJob{payload: payload, geocoder: g, translateTo: translateTo, queued: time.Now()}:
+	case <-s.Context().Done():
+		q.pending.Add(-1)
+	}
+}
+
+// runEnrich works through the session's queued messages until it's closed
+func (s *UserSession) runEnrich() {
+	q := &s.Enrich
+	for {
+		select {
+		case <-s.Context().Done():
+			return
+		case job := <-q.jobs:
+			if waited := time.Since(job.queued); waited > enrichMaxDelay {
+				log.Printf("[translate] User %d: %s waited %v, skipping lookups", s.UserID, job.payload.ID, waited.Round(time.Second))
+			} else {
+				if job.geocoder != nil {
+					geocodeLocation(job.geocoder, &job.payload)
+				}
+				if job.translateTo != "" {
+					translateMessage(translator, job.translateTo, &job.payload)
+				}
+			}
+			s.emitMessage(job.payload)
+			q.pending.Add(-1)
+		}
+	}
+}
+
+// translationHandler reads (GET) or sets (POST) the language a session's incoming
+// messages are translated into
+func translationHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[translationConfig]{
+		name:    "translation setting",
+		setting: func(s *UserSession) settingStore[translationConfig] { return &s.Translation },
+		accept: func(w http.ResponseWriter, cfg translationConfig) bool {
+			if _, ok := translator.(noopTranslator); ok && strings.TrimSpace(cfg.TargetLanguage) != "" {
+				errorResponse(w, http.StatusServiceUnavailable, "translation not configured")
+				return false
+			}
+			return true
+		},
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+type fakeTranslator struct {
+	language, text string
+}
+
+func (f *fakeTranslator) Translate(ctx context.Context, text, target string) (Translation, error) {
+	return Translation{DetectedLanguage: f.language, Text: f.text}, nil
+}
+
+// slowTranslator takes delay to translate text starting with "slow"
+type slowTranslator struct {
+	delay time.Duration
+}
+
+func (f *slowTranslator) Translate(ctx context.Context, text, target string) (Translation, error) {
+	if strings.HasPrefix(text, "slow") {
+		time.Sleep(f.delay)
+	}
+	return Translation{DetectedLanguage: "fr", Text: "translated"}, nil
+}
+
+func TestHTTPTranslator(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/translate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["q"] == "hello" {
+			w.Write([]byte(`{"translatedText": "hello", "detectedLanguage": {"confidence": 90, "language": "en"}}`))
+			return
+		}
+		w.Write([]byte(`{"translatedText": "good morning", "detectedLanguage": {"confidence": 95, "language": "de"}}`))
+	}))
+	defer srv.Close()
+
+	tr := NewHTTPTranslator(srv.URL+"/", "secret")
+	result, err := tr.Translate(context.Background(), "guten Morgen", "en")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if result.DetectedLanguage != "de" || result.Text != "good morning" {
+		t.Errorf("unexpected translation: %+v", result)
+	}
+	if got["source"] != "auto" || got["target"] != "en" || got["api_key"] != "secret" {
+		t.Errorf("unexpected request: %v", got)
+	}
+
+	result, err = tr.Translate(context.Background(), "hello", "en")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if result.DetectedLanguage != "en" || result.Text != "" {
+		t.Errorf("expected text already in target language to be left alone, got %+v", result)
+	}
+}
+
+func TestTranslationSetting_persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "translation.json")
+	var setting TranslationSetting
+	setting.load(path)
+	if _, err := setting.Set(translationConfig{TargetLanguage: "es"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var restored TranslationSetting
+	if err := restored.load(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if restored.Target() != "es" {
+		t.Errorf("expected es, got %q", restored.Target())
+	}
+}
+
+func TestUserSession_handleEvent_TranslatesMessage(t *testing.T) {
+	original := translator
+	defer func() { translator = original }()
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	t.Run("annotates when enabled", func(t *testing.T) {
+		translator = &fakeTranslator{language: "fr", text: "hello"}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+		session.Translation.Set(translationConfig{TargetLanguage: "en"})
+
+		session.handleEvent(incomingText(chat, "M1", "bonjour"))
+
+		select {
+		case evt := <-session.EventChan:
+			payload := evt.Payload.(MessagePayload)
+			if payload.Text != "bonjour" || payload.Language != "fr" || payload.Translation != "hello" || payload.TranslationLanguage != "en" {
+				t.Errorf("unexpected payload: %+v", payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected translated message to be emitted")
+		}
+	})
+
+	t.Run("untouched when disabled for the session", func(t *testing.T) {
+		translator = &fakeTranslator{language: "fr", text: "hello"}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+
+		session.handleEvent(incomingText(chat, "M2", "bonjour"))
+
+		payload := (<-session.EventChan).Payload.(MessagePayload)
+		if payload.Language != "" || payload.Translation != "" {
+			t.Errorf("expected no translation, got %+v", payload)
+		}
+	})
+
+	t.Run("keeps arrival order", func(t *testing.T) {
+		translator = &slowTranslator{delay: 50 * time.Millisecond}
+		session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10)}
+		defer session.stop()
+		session.Translation.Set(translationConfig{TargetLanguage: "en"})
+
+		session.handleEvent(incomingText(chat, "M3", "slow bonjour"))
+		session.handleEvent(incomingText(chat, "M4", "bonjour"))
+		session.Translation.Set(translationConfig{TargetLanguage: ""})
+		session.handleEvent(incomingText(chat, "M5", "bonjour"))
+
+		for _, want := range []string{"M3", "M4", "M5"} {
+			select {
+			case evt := <-session.EventChan:
+				if id := evt.Payload.(MessagePayload).ID; id != want {
+					t.Fatalf("expected %s next, got %s", want, id)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected %s to be emitted", want)
+			}
+		}
+	})
+}
+
+func TestTranslationHandler(t *testing.T) {
+	original := translator
+	defer func() { translator = original }()
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 990, NewLoggedInMockClient())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sessions/translation", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		translationHandler(w, req)
+		return w
+	}
+
+	translator = noopTranslator{}
+	if w := post(`{"user_id": 990, "target_language": "en"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a translator, got %d", w.Code)
+	}
+
+	translator = &fakeTranslator{}
+	if w := post(`{"user_id": 990, "target_language": " EN "}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if session.Translation.Target() != "en" {
+		t.Errorf("expected target en, got %q", session.Translation.Target())
+	}
+	if w := post(`{"user_id": 990, "target_language": ""}`); w.Code != http.StatusOK || session.Translation.Target() != "" {
+		t.Errorf("expected translation to be disabled, got %d %q", w.Code, session.Translation.Target())
+	}
+}
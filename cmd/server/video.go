@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// sendVideoHandler sends an MP4 (or 3GP/QuickTime) video, optionally view-once or as a
+// GIF: muted and looping, with the GIF service it came from
+func sendVideoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		ChatJID  string `json:"chat_jid"`
+		MimeType string `json:"mime_type"` // e.g. "video/mp4"
+		Caption  string `json:"caption"`
+		Seconds  uint32 `json:"seconds"` // duration, shown before it's downloaded
+		ViewOnce bool   `json:"view_once"`
+		// Play it like a GIF; gif_attribution credits "giphy", "tenor" or "klipy"
+		GifPlayback    bool   `json:"gif_playback"`
+		GifAttribution string `json:"gif_attribution,omitempty"`
+	}
+
+	var limits limitCheck
+	if limits.body(w, r, "video_b64", "video"); limits.reject(w) {
+		return
+	}
+
+	// video_b64 (base64 encoded video) is decoded straight to a temp file
+	video, err := decodeMediaRequest(r.Body, "video_b64", maxVideoSize, &req)
+	if err != nil {
+		mediaDecodeError(w, err, "video")
+		return
+	}
+	defer video.Close()
+
+	limits.size("video_b64", "video", video.Size)
+	limits.length("caption", req.Caption, maxCaptionLength)
+	if limits.reject(w) {
+		return
+	}
+
+	var attribution *waE2E.VideoMessage_Attribution
+	if req.GifAttribution != "" {
+		value, ok := waE2E.VideoMessage_Attribution_value[strings.ToUpper(req.GifAttribution)]
+		if !ok {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("unknown gif_attribution %q", req.GifAttribution))
+			return
+		}
+		if !req.GifPlayback {
+			errorResponse(w, http.StatusBadRequest, "gif_attribution needs gif_playback")
+			return
+		}
+		attribution = waE2E.VideoMessage_Attribution(value).Enum()
+	}
+
+	session := manager.GetSession(req.UserID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if !session.Client.IsLoggedIn() {
+		errorResponse(w, http.StatusBadRequest, "not logged in")
+		return
+	}
+
+	jid, err := session.parseChatJID(req.ChatJID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid jid")
+		return
+	}
+
+	mimeType, ok := mediaTypeFor(w, video, req.MimeType, "video")
+	if !ok {
+		return
+	}
+	if !scanOutgoingMedia(w, session, video, jid.String()) {
+		return
+	}
+
+	videoReader, err := video.Reader()
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	uploaded, err := session.Client.UploadReader(context.Background(), videoReader, nil, whatsmeow.MediaVideo)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to upload video: "+err.Error())
+		return
+	}
+
+	videoMsg := &waE2E.VideoMessage{
+		Caption:       proto.String(req.Caption),
+		URL:           proto.String(uploaded.URL),
+		DirectPath:    proto.String(uploaded.DirectPath),
+		MediaKey:      uploaded.MediaKey,
+		Mimetype:      proto.String(mimeType),
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    proto.Uint64(uint64(video.Size)),
+	}
+	if req.Seconds > 0 {
+		videoMsg.Seconds = proto.Uint32(req.Seconds)
+	}
+	if req.GifPlayback {
+		videoMsg.GifPlayback = proto.Bool(true)
+		videoMsg.GifAttribution = attribution
+	}
+	msg := &waE2E.Message{VideoMessage: videoMsg}
+	if req.ViewOnce {
+		msg = viewOnceMessage(msg)
+	}
+
+	resp, err := session.Client.SendMessage(r.Context(), jid, msg)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	})
+}
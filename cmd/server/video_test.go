@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+func TestSendVideoHandler_GifPlayback(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	mp4 := base64.StdEncoding.EncodeToString([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"))
+	send := func(fields string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sendVideoHandler(w, httptest.NewRequest(http.MethodPost, "/messages/video",
+			bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", `+fields+`, "video_b64": "`+mp4+`"}`)))
+		return w
+	}
+
+	if w := send(`"gif_playback": true, "gif_attribution": "tenor"`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	video := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message).GetVideoMessage()
+	if !video.GetGifPlayback() || video.GetGifAttribution() != waE2E.VideoMessage_TENOR {
+		t.Errorf("expected a Tenor GIF, got %v", video)
+	}
+
+	for name, fields := range map[string]string{
+		"unknown attribution":     `"gif_playback": true, "gif_attribution": "imgur"`,
+		"attribution without gif": `"gif_attribution": "giphy"`,
+	} {
+		if w := send(fields); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 1 {
+		t.Errorf("expected refused videos not to be sent, got %d sends", len(calls))
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// unwrapViewOnce strips the view-once and ephemeral wrappers left around a message's
+// content. whatsmeow takes off one of each, in a fixed order, so a message wrapped the
+// other way round (ephemeral inside view-once) or one that never went through its
+// unwrapping would otherwise be parsed without content and dropped.
+func unwrapViewOnce(v *events.Message) {
+	for {
+		msg := v.Message
+		switch {
+		case msg.GetViewOnceMessage().GetMessage() != nil:
+			v.Message = msg.GetViewOnceMessage().GetMessage()
+			v.IsViewOnce = true
+		case msg.GetViewOnceMessageV2().GetMessage() != nil:
+			v.Message = msg.GetViewOnceMessageV2().GetMessage()
+			v.IsViewOnce, v.IsViewOnceV2 = true, true
+		case msg.GetViewOnceMessageV2Extension().GetMessage() != nil:
+			v.Message = msg.GetViewOnceMessageV2Extension().GetMessage()
+			v.IsViewOnce, v.IsViewOnceV2, v.IsViewOnceV2Extension = true, true, true
+		case msg.GetEphemeralMessage().GetMessage() != nil:
+			v.Message = msg.GetEphemeralMessage().GetMessage()
+			v.IsEphemeral = true
+		default:
+			return
+		}
+	}
+}
+
+// viewOnceMessage marks media as view-once and wraps it the way the phone does: voice
+// notes in the V2 extension wrapper, images and videos in the V2 one
+func viewOnceMessage(msg *waE2E.Message) *waE2E.Message {
+	if audio := msg.GetAudioMessage(); audio != nil {
+		audio.ViewOnce = proto.Bool(true)
+		return &waE2E.Message{ViewOnceMessageV2Extension: &waE2E.FutureProofMessage{Message: msg}}
+	}
+	if image := msg.GetImageMessage(); image != nil {
+		image.ViewOnce = proto.Bool(true)
+	}
+	if video := msg.GetVideoMessage(); video != nil {
+		video.ViewOnce = proto.Bool(true)
+	}
+	return &waE2E.Message{ViewOnceMessageV2: &waE2E.FutureProofMessage{Message: msg}}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUserSession_handleEvent_ViewOnce(t *testing.T) {
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+	image := &waE2E.ImageMessage{
+		Mimetype: proto.String("image/jpeg"), DirectPath: proto.String("/v/once"), MediaKey: []byte("key"), ViewOnce: proto.Bool(true),
+	}
+
+	for name, msg := range map[string]*waE2E.Message{
+		"wrapped":                    {ViewOnceMessageV2: &waE2E.FutureProofMessage{Message: &waE2E.Message{ImageMessage: image}}},
+		"ephemeral inside view-once": {ViewOnceMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{ImageMessage: image}}}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			session := &UserSession{UserID: 1, Client: NewLoggedInMockClient(), EventChan: make(chan MessageEvent, 10), MediaCache: map[string][]byte{}}
+			evt := incomingText(chat, "V1", "")
+			evt.Message = msg
+
+			session.handleEvent(evt)
+
+			select {
+			case emitted := <-session.EventChan:
+				payload := emitted.Payload.(MessagePayload)
+				if payload.MediaType != "image" || payload.DirectPath != "/v/once" || !payload.IsViewOnce {
+					t.Errorf("expected the inner image marked view-once, got %+v", payload)
+				}
+			default:
+				t.Fatal("expected the view-once image to be emitted")
+			}
+		})
+	}
+}
+
+func TestSendViewOnceMedia(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	injectMockSession(manager, 1, mock)
+
+	jpeg := base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0 photo"))
+	w := httptest.NewRecorder()
+	sendImageHandler(w, httptest.NewRequest(http.MethodPost, "/messages/image",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "view_once": true, "image_b64": "`+jpeg+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	sent := mock.GetCallsByMethod("SendMessage")[0].Args[2].(*waE2E.Message)
+	if !sent.GetViewOnceMessageV2().GetMessage().GetImageMessage().GetViewOnce() {
+		t.Errorf("expected a view-once image, got %v", sent)
+	}
+
+	mp4 := base64.StdEncoding.EncodeToString([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"))
+	w = httptest.NewRecorder()
+	sendVideoHandler(w, httptest.NewRequest(http.MethodPost, "/messages/video",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "caption": "clip", "seconds": 12, "video_b64": "`+mp4+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	video := mock.GetCallsByMethod("SendMessage")[1].Args[2].(*waE2E.Message).GetVideoMessage()
+	if video.GetCaption() != "clip" || video.GetSeconds() != 12 || video.GetMimetype() != "video/mp4" || video.GetViewOnce() {
+		t.Errorf("expected a plain video, got %v", video)
+	}
+
+	ogg := base64.StdEncoding.EncodeToString([]byte("OggS\x00\x02 voice"))
+	w = httptest.NewRecorder()
+	sendAudioHandler(w, httptest.NewRequest(http.MethodPost, "/messages/audio",
+		bytes.NewBufferString(`{"user_id": 1, "chat_jid": "15557654321@s.whatsapp.net", "ptt": true, "view_once": true, "audio_b64": "`+ogg+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	sent = mock.GetCallsByMethod("SendMessage")[2].Args[2].(*waE2E.Message)
+	if !sent.GetViewOnceMessageV2Extension().GetMessage().GetAudioMessage().GetViewOnce() {
+		t.Errorf("expected a view-once voice note, got %v", sent)
+	}
+}
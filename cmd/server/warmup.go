@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// WarmupConfig ramps up how many people a newly linked number may message for the
+// first time each day. WhatsApp flags fresh numbers that reach out to strangers long
+// before it flags established ones, so the limit starts low and grows with the number's age.
+type WarmupConfig struct {
+	// Each step applies from AfterDays days after linking until the next one; numbers
+	// past the last step stay at its limit. Empty disables warm-up.
+	Schedule []WarmupStep `json:"schedule,omitempty"`
+	// Block refuses first messages over the day's limit. Otherwise they still go out and
+	// only the warmup events tell.
+	Block bool `json:"block,omitempty"`
+	// WarnAt is the share of the day's limit (0-1) that sets off a warning before the
+	// limit itself; 0 only reports reaching the limit
+	WarnAt float64 `json:"warn_at,omitempty"`
+}
+
+// WarmupStep is the daily limit on first messages from a number's age on
+type WarmupStep struct {
+	AfterDays     int `json:"after_days"`
+	DailyNewChats int `json:"daily_new_chats"`
+}
+
+func (c *WarmupConfig) validate() error {
+	for i, step := range c.Schedule {
+		switch {
+		case i == 0 && step.AfterDays != 0:
+			return errors.New("the first step must start at after_days 0")
+		case i > 0 && step.AfterDays <= c.Schedule[i-1].AfterDays:
+			return fmt.Errorf("step %d: after_days must increase", i)
+		case step.DailyNewChats < 0:
+			return fmt.Errorf("step %d: daily_new_chats can't be negative", i)
+		}
+	}
+	if c.WarnAt < 0 || c.WarnAt > 1 {
+		return errors.New("warn_at must be between 0 and 1")
+	}
+	return nil
+}
+
+// dailyLimit returns the limit for a number ageDays old, or -1 if warm-up is off
+func (c *WarmupConfig) dailyLimit(ageDays int) int {
+	limit := -1
+	for _, step := range c.Schedule {
+		if ageDays >= step.AfterDays {
+			limit = step.DailyNewChats
+		}
+	}
+	return limit
+}
+
+// WarmupPayload is the payload of a "warmup" event
+type WarmupPayload struct {
+	Level         string `json:"level"` // "warning", or "limit_reached"
+	NewChatsToday int    `json:"new_chats_today"`
+	DailyLimit    int    `json:"daily_limit"`
+	NumberAgeDays int    `json:"number_age_days"`
+	Blocking      bool   `json:"blocking"` // further first messages today are refused
+}
+
+// WarmupError is returned instead of sending a first message once the day's warm-up
+// limit is reached. Nothing was sent.
+type WarmupError struct {
+	DailyLimit int
+	RetryAfter time.Duration // until the count resets at midnight UTC
+}
+
+func (e *WarmupError) Error() string {
+	return fmt.Sprintf("warm-up limit of %d new chats a day reached, retry in %v", e.DailyLimit, e.RetryAfter.Round(time.Minute))
+}
+
+// warmupState is a session's warm-up bookkeeping, kept on disk across restarts
+type warmupState struct {
+	// When the number was linked. Sessions linked before warm-up was tracked count
+	// from their first message after.
+	LinkedAt int64  `json:"linked_at,omitempty"`
+	Day      string `json:"day,omitempty"` // UTC date NewChats counts
+	NewChats int    `json:"new_chats"`
+	Warned   bool   `json:"warned,omitempty"`
+	Reached  bool   `json:"reached,omitempty"`
+}
+
+// rollover starts counting from now's date if the count is from an earlier day. It
+// reports whether anything changed.
+func (s *warmupState) rollover(now time.Time) bool {
+	before := *s
+	if s.LinkedAt == 0 {
+		s.LinkedAt = now.Unix()
+	}
+	if day := now.UTC().Format(time.DateOnly); s.Day != day {
+		*s = warmupState{LinkedAt: s.LinkedAt, Day: day}
+	}
+	return *s != before
+}
+
+// age returns how many days ago the number was linked
+func (s *warmupState) age(now time.Time) int {
+	if s.LinkedAt == 0 {
+		return 0
+	}
+	return int(now.Sub(time.Unix(s.LinkedAt, 0)) / (24 * time.Hour))
+}
+
+// WarmupTracker counts a session's first messages per day against the warm-up schedule
+type WarmupTracker struct {
+	mu    sync.Mutex // held across each check and count
+	state persistedSetting[warmupState]
+	// First messages reserved but not yet recorded or released, so concurrent sends
+	// can't all pass the limit
+	pending int
+}
+
+func (t *WarmupTracker) load(path string) error {
+	return t.state.load(path)
+}
+
+// update changes the state with fn, logging if it can't be saved
+func (t *WarmupTracker) update(fn func(*warmupState) bool) {
+	if err := t.state.update(fn); err != nil {
+		log.Printf("Warning: failed to save warm-up state: %v", err)
+	}
+}
+
+// linked restarts warm-up for a newly linked number
+func (t *WarmupTracker) linked(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.update(func(s *warmupState) bool {
+		*s = warmupState{LinkedAt: now.Unix()}
+		return true
+	})
+}
+
+// reserve holds one of the day's first messages for a send about to go out, refusing it
+// with a *WarmupError if cfg blocks and the limit is used up by sent and reserved ones.
+// The reservation is settled with record once the message is out, or release if it isn't.
+func (t *WarmupTracker) reserve(cfg WarmupConfig, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.state.Get()
+	state.rollover(now)
+	limit := cfg.dailyLimit(state.age(now))
+	if cfg.Block && limit >= 0 && state.NewChats+t.pending >= limit {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return &WarmupError{DailyLimit: limit, RetryAfter: midnight.Sub(now)}
+	}
+	t.pending++
+	return nil
+}
+
+// release gives back a reservation for a first message that didn't go out
+func (t *WarmupTracker) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending > 0 {
+		t.pending--
+	}
+}
+
+// record counts a first message that went out, settling its reservation, and returns
+// the event to emit if it crossed the warning threshold or reached the limit
+func (t *WarmupTracker) record(cfg WarmupConfig, now time.Time) *WarmupPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending > 0 {
+		t.pending--
+	}
+	var payload *WarmupPayload
+	t.update(func(s *warmupState) bool {
+		changed := s.rollover(now)
+		age := s.age(now)
+		limit := cfg.dailyLimit(age)
+		if limit < 0 {
+			return changed
+		}
+		s.NewChats++
+
+		payload = &WarmupPayload{NewChatsToday: s.NewChats, DailyLimit: limit, NumberAgeDays: age}
+		switch {
+		case s.NewChats >= limit && !s.Reached:
+			s.Reached, s.Warned = true, true
+			payload.Level, payload.Blocking = "limit_reached", cfg.Block
+		case cfg.WarnAt > 0 && float64(s.NewChats) >= cfg.WarnAt*float64(limit) && !s.Warned:
+			s.Warned = true
+			payload.Level = "warning"
+		default:
+			payload = nil
+		}
+		return true
+	})
+	return payload
+}
+
+// Snapshot returns the day's count and limit for status reports, or nil if warm-up is off
+func (t *WarmupTracker) Snapshot(cfg WarmupConfig, now time.Time) map[string]interface{} {
+	state := t.state.Get()
+	age := state.age(now)
+	limit := cfg.dailyLimit(age)
+	if limit < 0 {
+		return nil
+	}
+	newChats := 0
+	if state.Day == now.UTC().Format(time.DateOnly) {
+		newChats = state.NewChats
+	}
+	return map[string]interface{}{
+		"number_age_days": age,
+		"new_chats_today": newChats,
+		"daily_limit":     limit,
+	}
+}
+
+// recordFirstContact counts a first message against the warm-up schedule, reporting
+// when it nears or reaches the day's limit
+func (s *UserSession) recordFirstContact(now time.Time) {
+	payload := s.Warmup.record(currentConfig().Warmup, now)
+	if payload == nil {
+		return
+	}
+	log.Printf("[warmup] User %d: %s, %d of %d new chats today (number is %d days old)",
+		s.UserID, payload.Level, payload.NewChatsToday, payload.DailyLimit, payload.NumberAgeDays)
+	s.emit(MessageEvent{Type: "warmup", Payload: payload})
+}
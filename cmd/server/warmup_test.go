@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseConfig_Warmup(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{"warmup": {"schedule": [{"after_days": 0, "daily_new_chats": 10}, {"after_days": 7, "daily_new_chats": 50}]}}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	for age, want := range map[int]int{0: 10, 6: 10, 7: 50, 365: 50} {
+		if got := cfg.Warmup.dailyLimit(age); got != want {
+			t.Errorf("expected a limit of %d at %d days, got %d", want, age, got)
+		}
+	}
+	if (&WarmupConfig{}).dailyLimit(0) != -1 {
+		t.Error("expected no limit without a schedule")
+	}
+
+	for _, invalid := range []string{
+		`{"warmup": {"schedule": [{"after_days": 1, "daily_new_chats": 10}]}}`,
+		`{"warmup": {"schedule": [{"after_days": 0, "daily_new_chats": 10}, {"after_days": 0, "daily_new_chats": 20}]}}`,
+		`{"warmup": {"schedule": [{"after_days": 0, "daily_new_chats": 10}], "warn_at": 2}}`,
+	} {
+		if _, err := parseConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestWarmupTracker(t *testing.T) {
+	cfg := WarmupConfig{Schedule: []WarmupStep{{0, 2}, {3, 5}}, Block: true, WarnAt: 0.5}
+	linked := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "warmup.json")
+
+	var tracker WarmupTracker
+	tracker.load(path)
+	tracker.linked(linked)
+
+	if payload := tracker.record(cfg, linked); payload == nil || payload.Level != "warning" {
+		t.Errorf("expected a warning at half the limit, got %+v", payload)
+	}
+	if payload := tracker.record(cfg, linked); payload == nil || payload.Level != "limit_reached" || !payload.Blocking {
+		t.Errorf("expected the limit to be reported, got %+v", payload)
+	}
+	var warmup *WarmupError
+	if err := tracker.reserve(cfg, linked); !errors.As(err, &warmup) || warmup.RetryAfter != 15*time.Hour {
+		t.Errorf("expected first messages to be refused until midnight, got %v", err)
+	}
+
+	// The count survives a restart and resets the next day
+	var restarted WarmupTracker
+	restarted.load(path)
+	if err := restarted.reserve(cfg, linked.Add(time.Hour)); err == nil {
+		t.Error("expected the count to survive a restart")
+	}
+	if err := restarted.reserve(cfg, linked.Add(24*time.Hour)); err != nil {
+		t.Errorf("expected a new day to start over, got %v", err)
+	}
+	// First messages in flight hold their place until they're released
+	restarted.reserve(cfg, linked.Add(24*time.Hour))
+	if err := restarted.reserve(cfg, linked.Add(24*time.Hour)); err == nil {
+		t.Error("expected the reserved messages to use up the limit")
+	}
+	restarted.release()
+	if err := restarted.reserve(cfg, linked.Add(24*time.Hour)); err != nil {
+		t.Errorf("expected a released reservation to be free again, got %v", err)
+	}
+	if snapshot := restarted.Snapshot(cfg, linked.Add(3*24*time.Hour)); snapshot["daily_limit"] != 5 || snapshot["number_age_days"] != 3 {
+		t.Errorf("expected the limit to ramp up on day 3, got %v", snapshot)
+	}
+}
+
+func TestPacedClient_warmup(t *testing.T) {
+	useConfig(t, `{"warmup": {"schedule": [{"after_days": 0, "daily_new_chats": 1}], "block": true}}`)
+	withOutboundPacing(t, OutboundPacing{})
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(setupTestManager(t), 1, mock)
+	session.Messages = newTestMessageStore(t)
+	client := &pacedClient{WhatsAppClient: mock, session: session}
+	text := &waE2E.Message{Conversation: proto.String("hi")}
+	alice := types.NewJID("15550000001", types.DefaultUserServer)
+
+	if _, err := client.SendMessage(context.Background(), alice, text); err != nil {
+		t.Fatalf("expected the first new chat to go out, got %v", err)
+	}
+	if evt := <-session.EventChan; evt.Type != "warmup" || evt.Payload.(*WarmupPayload).Level != "limit_reached" {
+		t.Errorf("expected a warmup event, got %+v", evt)
+	}
+	// Chats already messaged aren't first contacts any more
+	if _, err := client.SendMessage(context.Background(), alice, text); err != nil {
+		t.Errorf("expected a second message to the same chat to go out, got %v", err)
+	}
+	var warmup *WarmupError
+	if _, err := client.SendMessage(context.Background(), types.NewJID("15550000002", types.DefaultUserServer), text); !errors.As(err, &warmup) {
+		t.Errorf("expected the next new chat to be refused, got %v", err)
+	}
+	if sent := len(mock.GetCallsByMethod("SendMessage")); sent != 2 {
+		t.Errorf("expected 2 sends, got %d", sent)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// defaultWatchdogTimeout is how long a linked session's keepalive pings may keep failing,
+// or its websocket stay closed, before the watchdog steps in. whatsmeow resets a failing
+// connection itself after a few minutes, so this only catches ones it gave up on.
+const defaultWatchdogTimeout = 5 * time.Minute
+
+// WatchdogReconnectPayload is emitted as a "watchdog_reconnect" event when the watchdog
+// forces a stuck session to reconnect
+type WatchdogReconnectPayload struct {
+	Reason         string `json:"reason"` // "keepalive_failing" or "disconnected"
+	FailingSeconds int64  `json:"failing_seconds"`
+}
+
+// watchdogTimeoutFromEnv reads WATCHDOG_TIMEOUT (e.g. "5m"); "0" disables the watchdog
+func watchdogTimeoutFromEnv() time.Duration {
+	value := os.Getenv("WATCHDOG_TIMEOUT")
+	if value == "" {
+		return defaultWatchdogTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid WATCHDOG_TIMEOUT %q, using %v", value, defaultWatchdogTimeout)
+		return defaultWatchdogTimeout
+	}
+	return timeout
+}
+
+// touchActivity records that WhatsApp sent us something
+func (s *UserSession) touchActivity() {
+	s.ActivityMu.Lock()
+	s.LastServerActivity = time.Now()
+	s.ActivityMu.Unlock()
+}
+
+// trackConnHealth notes when keepalives start failing or the websocket drops, and when
+// the connection recovers. Quiet accounts are fine: only failures count.
+func (s *UserSession) trackConnHealth(evt interface{}) {
+	s.ActivityMu.Lock()
+	defer s.ActivityMu.Unlock()
+	switch v := evt.(type) {
+	case *events.Connected:
+		s.KeepAliveFailingSince, s.DisconnectedSince = time.Time{}, time.Time{}
+	case *events.Disconnected:
+		if s.DisconnectedSince.IsZero() {
+			s.DisconnectedSince = time.Now()
+		}
+	case *events.KeepAliveTimeout:
+		if s.KeepAliveFailingSince.IsZero() {
+			s.KeepAliveFailingSince = v.LastSuccess
+			if s.KeepAliveFailingSince.IsZero() {
+				s.KeepAliveFailingSince = time.Now()
+			}
+		}
+	case *events.KeepAliveRestored:
+		s.KeepAliveFailingSince = time.Time{}
+	}
+}
+
+// runWatchdog periodically reconnects sessions whose connection is failing
+func (m *SessionManager) runWatchdog(timeout time.Duration) {
+	if timeout <= 0 {
+		log.Printf("Watchdog disabled")
+		return
+	}
+	interval := timeout / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.checkFailingSessions(timeout)
+	}
+}
+
+// checkFailingSessions resets the connection of every linked session whose keepalives
+// have failed for longer than timeout, and reconnects ones whose websocket closed that
+// long ago without whatsmeow reconnecting. Reconnecting also makes the server replay any
+// queued offline messages.
+func (m *SessionManager) checkFailingSessions(timeout time.Duration) {
+	m.mu.RLock()
+	sessions := make([]*UserSession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	for _, s := range sessions {
+		if s.Client.GetStore().GetID() == nil {
+			continue
+		}
+		connected := s.Client.IsConnected()
+
+		s.ActivityMu.Lock()
+		reason, since := "", time.Time{}
+		switch {
+		case connected && !s.KeepAliveFailingSince.IsZero():
+			reason, since = "keepalive_failing", s.KeepAliveFailingSince
+		case !connected && !s.DisconnectedSince.IsZero():
+			reason, since = "disconnected", s.DisconnectedSince
+		}
+		failing := now.Sub(since)
+		if reason == "" || failing < timeout {
+			s.ActivityMu.Unlock()
+			continue
+		}
+		// Restart the clock so the reconnect gets a full timeout to work
+		if connected {
+			s.KeepAliveFailingSince = now
+		} else {
+			s.DisconnectedSince = now
+		}
+		s.WatchdogReconnects++
+		s.ActivityMu.Unlock()
+
+		log.Printf("[watchdog] User %d: %s for %v, forcing reconnect", s.UserID, reason, failing.Round(time.Second))
+		s.ConnHistory.Record(ConnStateWatchdogReconnect, reason+" for "+failing.Round(time.Second).String())
+		s.emit(MessageEvent{Type: "watchdog_reconnect", Payload: WatchdogReconnectPayload{
+			Reason:         reason,
+			FailingSeconds: int64(failing.Seconds()),
+		}})
+		if connected {
+			s.Client.ResetConnection()
+		} else if err := s.Client.Connect(); err != nil {
+			log.Printf("[watchdog] User %d: reconnect failed: %v", s.UserID, err)
+		}
+	}
+}
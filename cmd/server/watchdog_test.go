@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestWatchdogIdleTimeoutFromEnv(t *testing.T) {
+	t.Run("defaults when unset", func(t *testing.T) {
+		t.Setenv("WATCHDOG_TIMEOUT", "")
+		if got := watchdogTimeoutFromEnv(); got != defaultWatchdogTimeout {
+			t.Errorf("expected %v, got %v", defaultWatchdogTimeout, got)
+		}
+	})
+
+	t.Run("parses duration", func(t *testing.T) {
+		t.Setenv("WATCHDOG_TIMEOUT", "2m")
+		if got := watchdogTimeoutFromEnv(); got != 2*time.Minute {
+			t.Errorf("expected 2m, got %v", got)
+		}
+	})
+
+	t.Run("falls back on invalid value", func(t *testing.T) {
+		t.Setenv("WATCHDOG_TIMEOUT", "soon")
+		if got := watchdogTimeoutFromEnv(); got != defaultWatchdogTimeout {
+			t.Errorf("expected %v, got %v", defaultWatchdogTimeout, got)
+		}
+	})
+}
+
+func TestSessionManager_checkFailingSessions(t *testing.T) {
+	t.Run("resets connection with failing keepalives", func(t *testing.T) {
+		m := setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(m, 1, mock)
+		session.handleEvent(&events.KeepAliveTimeout{ErrorCount: 3, LastSuccess: time.Now().Add(-time.Hour)})
+
+		m.checkFailingSessions(5 * time.Minute)
+
+		if len(mock.GetCallsByMethod("ResetConnection")) != 1 {
+			t.Fatal("expected ResetConnection to be called")
+		}
+		if session.WatchdogReconnects != 1 {
+			t.Errorf("expected 1 watchdog reconnect, got %d", session.WatchdogReconnects)
+		}
+		select {
+		case evt := <-session.EventChan:
+			if payload, _ := evt.Payload.(WatchdogReconnectPayload); evt.Type != "watchdog_reconnect" || payload.Reason != "keepalive_failing" {
+				t.Errorf("expected a keepalive_failing watchdog_reconnect event, got %+v", evt)
+			}
+		default:
+			t.Error("expected watchdog_reconnect event")
+		}
+
+		// The clock restarts, so an immediate second check is a no-op
+		m.checkFailingSessions(5 * time.Minute)
+		if len(mock.GetCallsByMethod("ResetConnection")) != 1 {
+			t.Error("expected no second reset")
+		}
+	})
+
+	t.Run("leaves quiet session alone", func(t *testing.T) {
+		m := setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(m, 1, mock)
+		session.LastServerActivity = time.Now().Add(-24 * time.Hour)
+
+		m.checkFailingSessions(5 * time.Minute)
+
+		if len(mock.GetCallsByMethod("ResetConnection")) != 0 {
+			t.Error("expected no reset for a session that's only quiet")
+		}
+	})
+
+	t.Run("recovered keepalives clear the failure", func(t *testing.T) {
+		m := setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(m, 1, mock)
+		session.handleEvent(&events.KeepAliveTimeout{ErrorCount: 3, LastSuccess: time.Now().Add(-time.Hour)})
+		session.handleEvent(&events.KeepAliveRestored{})
+
+		m.checkFailingSessions(5 * time.Minute)
+
+		if len(mock.GetCallsByMethod("ResetConnection")) != 0 {
+			t.Error("expected no reset once keepalives recovered")
+		}
+	})
+
+	t.Run("reconnects session left disconnected", func(t *testing.T) {
+		m := setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		session := injectMockSession(m, 1, mock)
+		mock.Disconnect()
+		session.handleEvent(&events.Disconnected{})
+		session.DisconnectedSince = time.Now().Add(-time.Hour)
+
+		m.checkFailingSessions(5 * time.Minute)
+
+		if len(mock.GetCallsByMethod("Connect")) != 1 {
+			t.Error("expected the session to be reconnected")
+		}
+	})
+
+	t.Run("skips session disconnected on purpose", func(t *testing.T) {
+		m := setupTestManager(t)
+		mock := NewLoggedInMockClient()
+		injectMockSession(m, 1, mock)
+		mock.Disconnect()
+
+		m.checkFailingSessions(5 * time.Minute)
+
+		if len(mock.GetCallsByMethod("Connect")) != 0 || len(mock.GetCallsByMethod("ResetConnection")) != 0 {
+			t.Error("expected no reconnect without a dropped connection")
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// webhookQueueSize is how many events a session's webhook can fall behind by before
+// new ones are dropped
+const webhookQueueSize = 1000
+
+// webhookRetryDelays are the waits before each retry of a failed delivery
+var webhookRetryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// WebhookConfig is where a session's events are POSTed, as an alternative to holding
+// an SSE connection open
+type WebhookConfig struct {
+	URL string `json:"url"` // empty disables delivery
+	// Secret signs each delivery with HMAC-SHA256 over "<timestamp>.<body>", sent
+	// hex-encoded as X-Webhook-Signature with the Unix timestamp in X-Webhook-Timestamp
+	Secret string `json:"secret,omitempty"`
+	// Redact leaves message content out of the events sent to this URL
+	Redact bool `json:"redact,omitempty"`
+	// QRCodes also sends the codes of QR logins, as "qr" events, and "qr_expired" when
+	// they run out, for onboarding without holding /sessions/qr open
+	QRCodes bool `json:"qr_codes,omitempty"`
+}
+
+func (c WebhookConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
+
+func (c WebhookConfig) normalize() (WebhookConfig, error) {
+	return c, c.validate()
+}
+
+// webhookDelivery is the body POSTed for each event
+type webhookDelivery struct {
+	UserID int `json:"user_id"`
+	MessageEvent
+}
+
+// Webhook delivers a session's events to its configured URL one at a time, in order,
+// retrying failures. The zero value has no URL. Queued events go to whatever URL is set
+// when they're delivered.
+type Webhook struct {
+	persistedSetting[WebhookConfig]
+	queue chan MessageEvent
+	start sync.Once
+}
+
+// enqueue queues an event for delivery if a URL is configured, starting the delivery
+// worker on first use. The worker stops when ctx, the session's, is done. It never blocks.
+func (h *Webhook) enqueue(ctx context.Context, userID int, evt MessageEvent) {
+	if h.Get().URL == "" {
+		return
+	}
+	h.start.Do(func() {
+		h.queue = make(chan MessageEvent, webhookQueueSize)
+		go h.run(ctx, userID)
+	})
+	select {
+	case h.queue <- evt:
+	default:
+		log.Printf("[webhook] Queue full for user %d, dropping %s event", userID, evt.Type)
+	}
+}
+
+func (h *Webhook) run(ctx context.Context, userID int) {
+	for {
+		select {
+		case evt := <-h.queue:
+			h.deliver(ctx, userID, evt)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver POSTs one event, retrying until it's accepted, the receiver rejects it for
+// good, the retries run out or ctx is done
+func (h *Webhook) deliver(ctx context.Context, userID int, evt MessageEvent) {
+	if h.Get().Redact {
+		evt = redactEvent(evt)
+	}
+	body, err := json.Marshal(webhookDelivery{UserID: userID, MessageEvent: evt})
+	if err != nil {
+		log.Printf("[webhook] User %d: failed to encode %s event: %v", userID, evt.Type, err)
+		return
+	}
+	for attempt := 0; ; attempt++ {
+		cfg := h.Get()
+		if cfg.URL == "" {
+			return
+		}
+		retry, err := postWebhookEvent(ctx, cfg, evt.Type, body)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if !retry || attempt >= len(webhookRetryDelays) {
+			log.Printf("[webhook] User %d: giving up on %s event after %d attempts: %v", userID, evt.Type, attempt+1, err)
+			return
+		}
+		select {
+		case <-time.After(webhookRetryDelays[attempt]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// postWebhookEvent makes one delivery attempt, reporting whether a failure is worth retrying
+func postWebhookEvent(ctx context.Context, cfg WebhookConfig, eventType string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", eventType)
+	if cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", webhookSignature(cfg.Secret, timestamp, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+}
+
+// webhookSignature signs the timestamp along with the body, so a receiver that checks
+// the timestamp is recent can't be sent an old delivery again
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookHandler reads (GET) or replaces (POST) a session's webhook. The secret is
+// write-only; GET only says whether one is set.
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	serveSetting(w, r, settingEndpoint[WebhookConfig]{
+		name:    "webhook",
+		setting: func(s *UserSession) settingStore[WebhookConfig] { return &s.Webhook },
+		view: func(cfg WebhookConfig) interface{} {
+			return map[string]interface{}{"url": cfg.URL, "has_secret": cfg.Secret != "", "redact": cfg.Redact, "qr_codes": cfg.QRCodes}
+		},
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhook_deliversWithRetry(t *testing.T) {
+	prev := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { webhookRetryDelays = prev })
+
+	var attempts atomic.Int32
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer hook.Close()
+
+	var h Webhook
+	if _, err := h.Set(WebhookConfig{URL: hook.URL, Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	h.enqueue(context.Background(), 5, MessageEvent{Type: "message", Payload: MessagePayload{ID: "abc"}})
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the event to be delivered")
+	}
+	body := <-bodies
+	if attempts.Load() != 2 {
+		t.Errorf("expected a retry after the 503, got %d attempts", attempts.Load())
+	}
+	if got := r.Header.Get("X-Webhook-Event"); got != "message" {
+		t.Errorf("X-Webhook-Event = %q", got)
+	}
+	timestamp := r.Header.Get("X-Webhook-Timestamp")
+	if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Errorf("expected a current X-Webhook-Timestamp, got %q", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if got := r.Header.Get("X-Webhook-Signature"); got != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("unexpected signature %q", got)
+	}
+	var delivered struct {
+		UserID  int            `json:"user_id"`
+		Type    string         `json:"type"`
+		Payload MessagePayload `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &delivered); err != nil {
+		t.Fatal(err)
+	}
+	if delivered.UserID != 5 || delivered.Type != "message" || delivered.Payload.ID != "abc" {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestWebhook_stopsWithSession(t *testing.T) {
+	var attempts atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+	}))
+	defer hook.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var h Webhook
+	h.Set(WebhookConfig{URL: hook.URL})
+	h.enqueue(ctx, 5, MessageEvent{Type: "message", Payload: MessagePayload{ID: "abc"}})
+	time.Sleep(100 * time.Millisecond)
+	if n := attempts.Load(); n != 0 {
+		t.Errorf("expected nothing delivered for a stopped session, got %d attempts", n)
+	}
+}
+
+func TestPostWebhookEvent_permanentFailure(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer hook.Close()
+
+	retry, err := postWebhookEvent(context.Background(), WebhookConfig{URL: hook.URL}, "message", []byte("{}"))
+	if err == nil || retry {
+		t.Errorf("expected a 410 to fail without retry, got retry=%v err=%v", retry, err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	session := injectMockSession(manager, 1, NewLoggedInMockClient())
+	path := filepath.Join(t.TempDir(), "webhook_1.json")
+	if err := session.Webhook.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		webhookHandler(w, httptest.NewRequest(http.MethodPost, "/sessions/webhook", bytes.NewBufferString(body)))
+		return w
+	}
+	if w := post(`{"user_id": 1, "url": "ftp://example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-http url, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 2, "url": "https://example.com"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", w.Code)
+	}
+	if w := post(`{"user_id": 1, "url": "https://example.com/hook", "secret": "x"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var reloaded Webhook
+	if err := reloaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := reloaded.Get(); cfg.URL != "https://example.com/hook" || cfg.Secret != "x" {
+		t.Errorf("expected the webhook to be persisted, got %+v", cfg)
+	}
+
+	w := httptest.NewRecorder()
+	webhookHandler(w, httptest.NewRequest(http.MethodGet, "/sessions/webhook?user_id=1", nil))
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["url"] != "https://example.com/hook" || resp["has_secret"] != true || resp["secret"] != nil {
+		t.Errorf("unexpected GET response %v", resp)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// wsPingInterval is how often /ws pings the client, keeping proxies from timing out an
+// idle connection and noticing clients that went away
+var wsPingInterval = 30 * time.Second
+
+// wsCommand is a frame sent by a /ws client
+type wsCommand struct {
+	Type    string `json:"type"`         // ping, send or typing
+	ID      string `json:"id,omitempty"` // echoed in the reply so it can be matched up
+	ChatJID string `json:"chat_jid,omitempty"`
+	Text    string `json:"text,omitempty"`   // send
+	Force   bool   `json:"force,omitempty"`  // send: skip the duplicate guard
+	Typing  bool   `json:"typing,omitempty"` // typing: false sends paused
+}
+
+// wsReply answers a wsCommand. Events are sent as they are on /events, as MessageEvents.
+type wsReply struct {
+	Type   string      `json:"type"` // pong, result or error
+	ID     string      `json:"id,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Code   string      `json:"code,omitempty"` // for failed sends, as in /messages/send errors
+}
+
+// wsReadLimit fits a send of the longest text, even with every character escaped as
+// \uXXXX (a pair of them outside the BMP)
+const wsReadLimit = 12*maxTextLength + 4<<10
+
+// wsAcceptOptions lets the exact origins allowed by CORS open WebSockets too. A "*"
+// doesn't: browsers send cookies with WebSocket handshakes regardless of CORS, so any
+// site could send messages through the server.
+func wsAcceptOptions(cfg corsConfig) *websocket.AcceptOptions {
+	opts := &websocket.AcceptOptions{}
+	for _, origin := range cfg.Origins {
+		if origin != "*" {
+			opts.OriginPatterns = append(opts.OriginPatterns, origin)
+		}
+	}
+	return opts
+}
+
+// wsHandler streams a session's events over a WebSocket, for consumers behind proxies
+// that buffer SSE. It resumes from a cursor like /events, and clients can also send
+// commands on the same connection.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	fmt.Sscanf(r.URL.Query().Get("user_id"), "%d", &userID)
+	if userID == 0 {
+		errorResponse(w, http.StatusBadRequest, "user_id required")
+		return
+	}
+
+	cursor, err := eventsCursor(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session := manager.GetSession(userID)
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, wsAcceptOptions(corsFromEnv()))
+	if err != nil {
+		// Accept has already answered the request
+		log.Printf("[ws] User %d: %v", userID, err)
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(wsReadLimit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Commands run one at a time and in order, so reading (and answering pings) goes on
+	// while a send is in flight
+	commands := make(chan wsCommand, 16)
+	go func() {
+		defer cancel()
+		defer close(commands)
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			var cmd wsCommand
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				wsjson.Write(ctx, conn, wsReply{Type: "error", Error: "invalid json"})
+				continue
+			}
+			select {
+			case commands <- cmd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		for cmd := range commands {
+			if err := wsjson.Write(ctx, conn, session.runWSCommand(ctx, cmd)); err != nil {
+				cancel()
+			}
+		}
+	}()
+
+	go func() {
+		defer cancel()
+		session.streamEvents(ctx, cursor, func(evt MessageEvent) error {
+			return wsjson.Write(ctx, conn, evt)
+		})
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ping.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, wsPingInterval)
+			err := conn.Ping(pingCtx)
+			cancelPing()
+			if err != nil {
+				conn.Close(websocket.StatusGoingAway, "ping timeout")
+				return
+			}
+
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		}
+	}
+}
+
+// runWSCommand carries out a client command, checking it the way the matching HTTP
+// endpoint does
+func (s *UserSession) runWSCommand(ctx context.Context, cmd wsCommand) wsReply {
+	fail := func(message string) wsReply {
+		return wsReply{Type: "error", ID: cmd.ID, Error: message}
+	}
+
+	switch cmd.Type {
+	case "ping":
+		return wsReply{Type: "pong", ID: cmd.ID}
+	case "send", "typing":
+	default:
+		return fail("unknown command type")
+	}
+
+	if !s.Client.IsLoggedIn() {
+		return fail("not logged in")
+	}
+	jid, err := s.parseChatJID(cmd.ChatJID)
+	if err != nil {
+		return fail("invalid jid")
+	}
+
+	if cmd.Type == "typing" {
+		presence := types.ChatPresencePaused
+		if cmd.Typing {
+			presence = types.ChatPresenceComposing
+		}
+		if err := s.Client.SendChatPresence(ctx, jid, presence, types.ChatPresenceMediaText); err != nil {
+			return fail(err.Error())
+		}
+		return wsReply{Type: "result", ID: cmd.ID, Result: map[string]string{"status": "ok"}}
+	}
+
+	if cmd.Text == "" {
+		return fail("text required")
+	}
+	var limits limitCheck
+	if limits.length("text", cmd.Text, maxTextLength); len(limits.errs) > 0 {
+		return fail("message exceeds WhatsApp limits: text " + limits.errs[0].Message)
+	}
+	resp, err := s.sendText(ctx, jid, cmd.Text, cmd.Force, func() *waE2E.Message {
+		return &waE2E.Message{Conversation: proto.String(cmd.Text)}
+	})
+	var pending *PendingApprovalError
+	if errors.As(err, &pending) {
+		return wsReply{Type: "result", ID: cmd.ID, Result: map[string]interface{}{"id": pending.ID, "status": "pending"}}
+	}
+	if err != nil {
+		reply := fail(err.Error())
+		reply.Code = classifySendError(err).Code
+		return reply
+	}
+	return wsReply{Type: "result", ID: cmd.ID, Result: map[string]interface{}{
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+	}}
+}
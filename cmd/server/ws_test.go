@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestWSHandler(t *testing.T) {
+	manager = setupTestManager(t)
+	mock := NewLoggedInMockClient()
+	session := injectMockSession(manager, 1, mock)
+
+	server := httptest.NewServer(http.HandlerFunc(wsHandler))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws?user_id=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseNow()
+
+	session.emit(MessageEvent{Type: "message", Payload: MessagePayload{ID: "in-1"}})
+	var evt struct {
+		Type    string         `json:"type"`
+		Payload MessagePayload `json:"payload"`
+	}
+	if err := wsjson.Read(ctx, conn, &evt); err != nil {
+		t.Fatal(err)
+	}
+	if evt.Type != "message" || evt.Payload.ID != "in-1" {
+		t.Errorf("unexpected event %+v", evt)
+	}
+
+	command := func(cmd wsCommand) wsReply {
+		t.Helper()
+		if err := wsjson.Write(ctx, conn, cmd); err != nil {
+			t.Fatal(err)
+		}
+		var reply wsReply
+		if err := wsjson.Read(ctx, conn, &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	if reply := command(wsCommand{Type: "ping", ID: "p"}); reply.Type != "pong" || reply.ID != "p" {
+		t.Errorf("expected a pong, got %+v", reply)
+	}
+
+	reply := command(wsCommand{Type: "send", ID: "s", ChatJID: "123@s.whatsapp.net", Text: "hi"})
+	if reply.Type != "result" || reply.ID != "s" {
+		t.Fatalf("expected a send result, got %+v", reply)
+	}
+	if result, _ := reply.Result.(map[string]interface{}); result["id"] != "mock-msg-id" {
+		t.Errorf("expected the sent message's ID, got %+v", reply.Result)
+	}
+	if calls := mock.GetCallsByMethod("SendMessage"); len(calls) != 1 || calls[0].Args[1].(types.JID).User != "123" {
+		t.Errorf("expected one send to 123, got %v", calls)
+	}
+
+	if reply := command(wsCommand{Type: "typing", ChatJID: "123@s.whatsapp.net", Typing: true}); reply.Type != "result" {
+		t.Errorf("expected a typing result, got %+v", reply)
+	}
+	calls := mock.GetCallsByMethod("SendChatPresence")
+	if len(calls) != 1 || calls[0].Args[2] != types.ChatPresenceComposing {
+		t.Errorf("expected composing to be sent, got %v", calls)
+	}
+
+	if reply := command(wsCommand{Type: "send", ChatJID: "123@s.whatsapp.net"}); reply.Type != "error" || reply.Error != "text required" {
+		t.Errorf("expected an error for an empty send, got %+v", reply)
+	}
+	// Text is limited in characters, not bytes
+	if reply := command(wsCommand{Type: "send", ChatJID: "123@s.whatsapp.net", Text: strings.Repeat("é", maxTextLength)}); reply.Type != "result" {
+		t.Errorf("expected text at the limit to be sent, got %+v", reply)
+	}
+	if reply := command(wsCommand{Type: "send", ChatJID: "123@s.whatsapp.net", Text: strings.Repeat("a", maxTextLength+1)}); reply.Type != "error" {
+		t.Errorf("expected text over the limit to be refused, got %+v", reply)
+	}
+	if reply := command(wsCommand{Type: "delete"}); reply.Type != "error" {
+		t.Errorf("expected an error for an unknown command, got %+v", reply)
+	}
+}
+
+func TestWSHandler_unknownSession(t *testing.T) {
+	manager = setupTestManager(t)
+	w := httptest.NewRecorder()
+	wsHandler(w, httptest.NewRequest(http.MethodGet, "/ws?user_id=9", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestWSHandler_origins(t *testing.T) {
+	manager = setupTestManager(t)
+	injectMockSession(manager, 1, NewLoggedInMockClient())
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://dash.example.com, *")
+
+	server := httptest.NewServer(http.HandlerFunc(wsHandler))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(origin string) error {
+		conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws?user_id=1",
+			&websocket.DialOptions{HTTPHeader: http.Header{"Origin": {origin}}})
+		if err == nil {
+			conn.CloseNow()
+		}
+		return err
+	}
+
+	if err := dial("https://dash.example.com"); err != nil {
+		t.Errorf("expected a listed origin to connect, got %v", err)
+	}
+	// The wildcard opens CORS reads, not WebSockets that can send
+	if err := dial("https://evil.example.com"); err == nil {
+		t.Error("expected an unlisted origin to be refused")
+	}
+}
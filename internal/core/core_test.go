@@ -0,0 +1,76 @@
+package core
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *waE2E.Message
+		want string
+	}{
+		{"plain", &waE2E.Message{Conversation: proto.String("hi")}, "hi"},
+		{"extended", &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("hey")}}, "hey"},
+		{"image", &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("look")}}, ""},
+		{"nil", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.msg); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMediaOf(t *testing.T) {
+	voice := MediaOf(&waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+		PTT:        proto.Bool(true),
+		Mimetype:   proto.String("audio/ogg"),
+		DirectPath: proto.String("/v/voice"),
+		FileLength: proto.Uint64(42),
+	}})
+	if voice == nil || voice.Kind != "ptt" || voice.MimeType != "audio/ogg" || voice.DirectPath != "/v/voice" || voice.FileLength != 42 || voice.File == nil {
+		t.Errorf("expected a voice note, got %+v", voice)
+	}
+
+	sticker := MediaOf(&waE2E.Message{StickerMessage: &waE2E.StickerMessage{IsLottie: proto.Bool(true)}})
+	if sticker == nil || sticker.Kind != "sticker" || !sticker.IsAnimated {
+		t.Errorf("expected an animated sticker, got %+v", sticker)
+	}
+
+	if media := MediaOf(&waE2E.Message{Conversation: proto.String("hi")}); media != nil {
+		t.Errorf("expected no media for a text message, got %+v", media)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	sender := types.NewJID("15551234567", types.DefaultUserServer)
+	parsed := ParseMessage(&events.Message{
+		Info: types.MessageInfo{MessageSource: types.MessageSource{Sender: sender}, ID: "M1"},
+		Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String("agreed"),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      proto.String("Q1"),
+				Participant:   proto.String("15557654321@s.whatsapp.net"),
+				QuotedMessage: &waE2E.Message{Conversation: proto.String("lunch?")},
+			},
+		}},
+	})
+
+	if parsed.Text != "agreed" || parsed.Media != nil || parsed.Poll != nil {
+		t.Errorf("expected a text message, got %+v", parsed)
+	}
+	if parsed.QuotedID != "Q1" || parsed.QuotedSender != "15557654321@s.whatsapp.net" || parsed.QuotedText != "lunch?" {
+		t.Errorf("expected the quote to be picked apart, got %+v", parsed)
+	}
+	if name := parsed.SenderName(); name != "15551234567" {
+		t.Errorf("expected the number without a push name, got %q", name)
+	}
+}
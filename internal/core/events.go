@@ -0,0 +1,50 @@
+package core
+
+import (
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Message is an incoming message with its content picked apart. Frontends add what
+// only they show, e.g. the server's locations and contacts.
+type Message struct {
+	Info  types.MessageInfo
+	Raw   *waE2E.Message // the content, for what isn't picked apart here
+	Text  string         // of text messages; media captions are in Media
+	Media *Media
+	Poll  *waE2E.PollCreationMessage
+	// IsViewOnce marks media the recipient can open only once
+	IsViewOnce bool
+
+	// Set on replies: the quoted message's ID, sender and text
+	QuotedID     string
+	QuotedSender string
+	QuotedText   string
+}
+
+// ParseMessage picks apart a live message, or a synced one after the client's ParseWebMessage
+func ParseMessage(evt *events.Message) Message {
+	msg := Message{
+		Info:  evt.Info,
+		Raw:   evt.Message,
+		Text:  Text(evt.Message),
+		Media: MediaOf(evt.Message),
+		Poll:  PollCreation(evt.Message),
+	}
+	msg.IsViewOnce = evt.IsViewOnce || (msg.Media != nil && msg.Media.ViewOnce)
+	if quoted := ContextInfo(evt.Message); quoted.GetStanzaID() != "" {
+		msg.QuotedID = quoted.GetStanzaID()
+		msg.QuotedSender = quoted.GetParticipant()
+		msg.QuotedText = Text(quoted.GetQuotedMessage())
+	}
+	return msg
+}
+
+// SenderName is how to show who sent the message: their push name, else their number
+func (m Message) SenderName() string {
+	if m.Info.PushName != "" {
+		return m.Info.PushName
+	}
+	return m.Info.Sender.User
+}
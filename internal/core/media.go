@@ -0,0 +1,85 @@
+package core
+
+import (
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// Media is the downloadable attachment of a message
+type Media struct {
+	Kind     string // image, video, audio, ptt (voice note), document or sticker
+	Caption  string
+	MimeType string
+	FileName string // only set on documents
+	// IsAnimated is set on animated WebP and Lottie stickers
+	IsAnimated bool
+	// ViewOnce is the flag view-once images, videos and voice notes carry themselves
+	ViewOnce bool
+
+	// What's needed to download it, also later from the stored fields alone
+	URL           string
+	DirectPath    string
+	MediaKey      []byte
+	FileEncSHA256 []byte
+	FileSHA256    []byte
+	FileLength    uint64
+
+	// File is the message itself, for whatsmeow's Download
+	File whatsmeow.DownloadableMessage
+}
+
+// downloadable is what the media message types have in common
+type downloadable interface {
+	whatsmeow.DownloadableMessage
+	GetURL() string
+	GetMimetype() string
+	GetFileLength() uint64
+}
+
+func newMedia(kind string, file downloadable) *Media {
+	return &Media{
+		Kind:          kind,
+		MimeType:      file.GetMimetype(),
+		URL:           file.GetURL(),
+		DirectPath:    file.GetDirectPath(),
+		MediaKey:      file.GetMediaKey(),
+		FileEncSHA256: file.GetFileEncSHA256(),
+		FileSHA256:    file.GetFileSHA256(),
+		FileLength:    file.GetFileLength(),
+		File:          file,
+	}
+}
+
+// MediaOf returns the attachment of msg, or nil if it has none
+func MediaOf(msg *waE2E.Message) *Media {
+	switch {
+	case msg.GetImageMessage() != nil:
+		m := newMedia("image", msg.GetImageMessage())
+		m.Caption = msg.GetImageMessage().GetCaption()
+		m.ViewOnce = msg.GetImageMessage().GetViewOnce()
+		return m
+	case msg.GetVideoMessage() != nil:
+		m := newMedia("video", msg.GetVideoMessage())
+		m.Caption = msg.GetVideoMessage().GetCaption()
+		m.ViewOnce = msg.GetVideoMessage().GetViewOnce()
+		return m
+	case msg.GetAudioMessage() != nil:
+		kind := "audio"
+		if msg.GetAudioMessage().GetPTT() {
+			kind = "ptt"
+		}
+		m := newMedia(kind, msg.GetAudioMessage())
+		m.ViewOnce = msg.GetAudioMessage().GetViewOnce()
+		return m
+	case msg.GetDocumentMessage() != nil:
+		m := newMedia("document", msg.GetDocumentMessage())
+		m.Caption = msg.GetDocumentMessage().GetCaption()
+		m.FileName = msg.GetDocumentMessage().GetFileName()
+		return m
+	case msg.GetStickerMessage() != nil:
+		m := newMedia("sticker", msg.GetStickerMessage())
+		m.IsAnimated = msg.GetStickerMessage().GetIsAnimated() || msg.GetStickerMessage().GetIsLottie()
+		return m
+	}
+	return nil
+}
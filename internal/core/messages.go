@@ -0,0 +1,59 @@
+package core
+
+import (
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// Text returns the text of a plain or extended text message, or "" for other kinds
+func Text(msg *waE2E.Message) string {
+	if text := msg.GetConversation(); text != "" {
+		return text
+	}
+	return msg.GetExtendedTextMessage().GetText()
+}
+
+// TextMessage builds a plain text message
+func TextMessage(text string) *waE2E.Message {
+	return &waE2E.Message{Conversation: proto.String(text)}
+}
+
+// ContextInfo returns the ContextInfo of whichever content type the message carries
+func ContextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	type withContextInfo interface {
+		GetContextInfo() *waE2E.ContextInfo
+	}
+	candidates := []withContextInfo{
+		msg.GetExtendedTextMessage(), msg.GetImageMessage(), msg.GetVideoMessage(),
+		msg.GetAudioMessage(), msg.GetDocumentMessage(), msg.GetStickerMessage(),
+		msg.GetLocationMessage(), msg.GetContactMessage(),
+	}
+	for _, c := range candidates {
+		if info := c.GetContextInfo(); info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+// PollCreation returns the poll in msg, whichever version of the message it was sent as
+func PollCreation(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage()
+	case msg.GetPollCreationMessageV2() != nil:
+		return msg.GetPollCreationMessageV2()
+	case msg.GetPollCreationMessageV3() != nil:
+		return msg.GetPollCreationMessageV3()
+	}
+	return nil
+}
+
+// PollOptionNames lists the option names of a poll in order
+func PollOptionNames(poll *waE2E.PollCreationMessage) []string {
+	names := make([]string, 0, len(poll.GetOptions()))
+	for _, option := range poll.GetOptions() {
+		names = append(names, option.GetOptionName())
+	}
+	return names
+}
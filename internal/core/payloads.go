@@ -0,0 +1,313 @@
+package core
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Event types of the payloads defined here
+const (
+	EventMessage     = "message"
+	EventReceipt     = "receipt"
+	EventPresence    = "presence"
+	EventGroupUpdate = "group_update"
+)
+
+// Event is what consumers receive, as JSON, over every output: SSE, WebSocket, webhook
+// and the bridge callback
+type Event struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+	Seq     int64       `json:"seq,omitempty"` // position in the session's event log, 0 if it wasn't logged
+}
+
+// Payload is an event payload that knows its event type
+type Payload interface {
+	EventType() string
+}
+
+// NewEvent wraps a payload in an event of its type
+func NewEvent(p Payload) Event {
+	return Event{Type: p.EventType(), Payload: p}
+}
+
+// MessagePayload is a "message" event. The frontends fill in what they support; the
+// fields after the media ones are only set by the server.
+type MessagePayload struct {
+	ID         string `json:"id"`
+	ChatJID    string `json:"chat_jid"`
+	SenderJID  string `json:"sender_jid"`
+	SenderName string `json:"sender_name"`
+	Text       string `json:"text"`
+	Timestamp  int64  `json:"timestamp"`
+	// Timestamp in the session's timezone and locale, if it has one (see
+	// /sessions/time-format). Set by the server as the message goes out.
+	TimestampFormatted string `json:"timestamp_formatted,omitempty"`
+	IsFromMe           bool   `json:"is_from_me"`
+	// IsSelfChat marks messages in the account's own note-to-self chat
+	IsSelfChat bool `json:"is_self_chat,omitempty"`
+	// MentionsMe marks group messages that @-mention the account
+	MentionsMe bool `json:"mentions_me,omitempty"`
+	// Set on replies: the ID and sender of the quoted message. Its media can be fetched
+	// with /media/quoted.
+	QuotedID     string `json:"quoted_id,omitempty"`
+	QuotedSender string `json:"quoted_sender,omitempty"`
+	// Mute and archive state of the chat when the message arrived, from app state sync
+	ChatMuted    bool `json:"chat_muted,omitempty"`
+	ChatArchived bool `json:"chat_archived,omitempty"`
+	// WhatsApp Business labels (IDs, see GET /labels): those of the chat when the
+	// message arrived, and those on the message itself as of when it was read back
+	ChatLabelIDs []string `json:"chat_label_ids,omitempty"`
+	LabelIDs     []string `json:"label_ids,omitempty"`
+	// Media fields
+	MediaType string `json:"media_type,omitempty"` // "image", "location", etc.
+	MediaURL  string `json:"media_url,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+	Caption   string `json:"caption,omitempty"`
+	FileName  string `json:"file_name,omitempty"` // Documents only
+	// Location fields
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	// AddressGeocoded is set when Address was looked up from the coordinates rather than sent
+	AddressGeocoded bool `json:"address_geocoded,omitempty"`
+	// Contact fields (vCard)
+	ContactName  string       `json:"contact_name,omitempty"`
+	ContactVCard string       `json:"contact_vcard,omitempty"`
+	Contact      *ContactCard `json:"contact,omitempty"` // Parsed from ContactVCard
+	// Poll fields (media_type "poll"); the question is in Text
+	PollOptions     []string `json:"poll_options,omitempty"`
+	PollMultiSelect bool     `json:"poll_multi_select,omitempty"`
+	// Media download info
+	MediaKey      []byte `json:"media_key,omitempty"`
+	DirectPath    string `json:"direct_path,omitempty"`
+	FileEncSHA256 []byte `json:"file_enc_sha256,omitempty"`
+	FileSHA256    []byte `json:"file_sha256,omitempty"`
+	FileLength    uint64 `json:"file_length,omitempty"`
+	IsPTT         bool   `json:"is_ptt,omitempty"`      // Push-to-talk (voice note) - critical for download
+	IsAnimated    bool   `json:"is_animated,omitempty"` // Animated WebP or Lottie sticker
+	IsViewOnce    bool   `json:"is_view_once,omitempty"`
+	// System messages (media_type "system"): what kind of chat notification this is
+	SystemType     string `json:"system_type,omitempty"`
+	EphemeralTimer uint32 `json:"ephemeral_timer,omitempty"` // ephemeral_changed only; seconds, 0 = off
+	// Tags of the routing rules the message matched
+	Tags []string `json:"tags,omitempty"`
+	// Translation fields, set when the session has translation enabled
+	Language            string `json:"language,omitempty"` // detected language of the text or caption
+	Translation         string `json:"translation,omitempty"`
+	TranslationLanguage string `json:"translation_language,omitempty"`
+	// Redacted is set when the content was left out (see /sessions/redaction)
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+func (MessagePayload) EventType() string { return EventMessage }
+
+// NewMessagePayload converts a message for consumers: who sent it where, what it
+// quotes and what it says or carries. It returns false for messages there is nothing
+// to show for, like protocol messages.
+func NewMessagePayload(msg Message) (MessagePayload, bool) {
+	info := msg.Info
+	payload := MessagePayload{
+		ID:           info.ID,
+		ChatJID:      info.Chat.String(),
+		SenderJID:    info.Sender.String(),
+		SenderName:   info.PushName,
+		Timestamp:    info.Timestamp.Unix(),
+		IsFromMe:     info.IsFromMe,
+		IsViewOnce:   msg.IsViewOnce,
+		QuotedID:     msg.QuotedID,
+		QuotedSender: msg.QuotedSender,
+		Text:         msg.Text,
+	}
+	hasContent := msg.Text != ""
+
+	if media := msg.Media; media != nil {
+		payload.MediaType = media.Kind
+		payload.Caption = media.Caption
+		payload.MimeType = media.MimeType
+		payload.FileName = media.FileName
+		payload.MediaURL = media.URL
+		payload.DirectPath = media.DirectPath
+		payload.MediaKey = media.MediaKey
+		payload.FileEncSHA256 = media.FileEncSHA256
+		payload.FileSHA256 = media.FileSHA256
+		payload.FileLength = media.FileLength
+		payload.IsPTT = media.Kind == "ptt"
+		payload.IsAnimated = media.IsAnimated
+		hasContent = true
+	}
+
+	if loc := msg.Raw.GetLocationMessage(); loc != nil {
+		payload.MediaType = "location"
+		payload.Latitude = loc.GetDegreesLatitude()
+		payload.Longitude = loc.GetDegreesLongitude()
+		payload.Address = loc.GetAddress()
+		payload.Text = loc.GetName()
+		if payload.Address != "" && payload.Text != "" {
+			payload.Text += " - " + payload.Address
+		} else if payload.Address != "" {
+			payload.Text = payload.Address
+		}
+		hasContent = true
+	}
+
+	if loc := msg.Raw.GetLiveLocationMessage(); loc != nil {
+		payload.MediaType = "live_location"
+		payload.Latitude = loc.GetDegreesLatitude()
+		payload.Longitude = loc.GetDegreesLongitude()
+		payload.Caption = loc.GetCaption()
+		hasContent = true
+	}
+
+	if contact := msg.Raw.GetContactMessage(); contact != nil {
+		payload.MediaType = "contact"
+		payload.ContactName = contact.GetDisplayName()
+		if contact.Vcard != nil {
+			payload.ContactVCard = contact.GetVcard()
+			payload.Contact = ParseVCard(contact.GetVcard())
+		}
+		hasContent = true
+	}
+
+	if poll := msg.Poll; poll != nil {
+		payload.MediaType = "poll"
+		payload.Text = poll.GetName()
+		payload.PollOptions = PollOptionNames(poll)
+		payload.PollMultiSelect = poll.GetSelectableOptionsCount() != 1
+		hasContent = true
+	}
+
+	return payload, hasContent
+}
+
+// receiptStatuses maps the receipts reported to consumers to their status. Others, like
+// retries or reads on the user's own devices, aren't about the checkmarks of a message.
+var receiptStatuses = map[types.ReceiptType]string{
+	types.ReceiptTypeDelivered: "delivered",
+	types.ReceiptTypeRead:      "read",
+	types.ReceiptTypePlayed:    "played",
+	// The server couldn't deliver the message after accepting it
+	types.ReceiptTypeServerError: "server_error",
+}
+
+// ReceiptPayload is a "receipt" event: messages the user sent were delivered to, read
+// or played by a recipient
+type ReceiptPayload struct {
+	Status     string   `json:"status"` // "delivered", "read", "played" or "server_error"
+	MessageIDs []string `json:"message_ids"`
+	ChatJID    string   `json:"chat_jid"`
+	// RecipientJID is who delivered or read the messages; in groups each member sends their own
+	RecipientJID string `json:"recipient_jid"`
+	Timestamp    int64  `json:"timestamp"`
+	IsGroup      bool   `json:"is_group,omitempty"`
+}
+
+func (ReceiptPayload) EventType() string { return EventReceipt }
+
+// NewReceiptPayload converts a receipt for messages the user sent. It returns false for
+// the user's own receipts and kinds consumers aren't told about.
+func NewReceiptPayload(v *events.Receipt) (ReceiptPayload, bool) {
+	status, ok := receiptStatuses[v.Type]
+	if !ok || v.IsFromMe {
+		return ReceiptPayload{}, false
+	}
+	return ReceiptPayload{
+		Status:       status,
+		MessageIDs:   v.MessageIDs,
+		ChatJID:      v.Chat.String(),
+		RecipientJID: v.Sender.String(),
+		Timestamp:    v.Timestamp.Unix(),
+		IsGroup:      v.IsGroup,
+	}, true
+}
+
+// PresencePayload is a "presence" event: a subscribed contact came online or went offline
+type PresencePayload struct {
+	JID    string `json:"jid"`
+	Online bool   `json:"online"`
+	// LastSeen is when the contact was last online, in unix seconds. It's 0 while they're
+	// online or if they hide their last seen time.
+	LastSeen int64 `json:"last_seen,omitempty"`
+}
+
+func (PresencePayload) EventType() string { return EventPresence }
+
+// NewPresencePayload converts a contact's presence change
+func NewPresencePayload(v *events.Presence) PresencePayload {
+	payload := PresencePayload{
+		JID:    v.From.ToNonAD().String(),
+		Online: !v.Unavailable,
+	}
+	if v.Unavailable && !v.LastSeen.IsZero() {
+		payload.LastSeen = v.LastSeen.Unix()
+	}
+	return payload
+}
+
+// GroupUpdatePayload is a "group_update" event: members or settings of a group changed.
+// Only what changed is set.
+type GroupUpdatePayload struct {
+	GroupJID  string `json:"group_jid"`
+	ActorJID  string `json:"actor_jid,omitempty"` // who made the change, if known
+	Timestamp int64  `json:"timestamp"`
+
+	Joined   []string `json:"joined,omitempty"`
+	Left     []string `json:"left,omitempty"` // including those who were removed
+	Promoted []string `json:"promoted,omitempty"`
+	Demoted  []string `json:"demoted,omitempty"`
+	// JoinReason is "invite" when Joined came in through the invite link
+	JoinReason string `json:"join_reason,omitempty"`
+	// Reconciled is set when Joined and Left were found by comparing a freshly fetched
+	// member list with the cached one, the notifications having been missed
+	Reconciled bool `json:"reconciled,omitempty"`
+
+	Name     *string `json:"name,omitempty"`
+	Topic    *string `json:"topic,omitempty"`    // "" when the description was deleted
+	Announce *bool   `json:"announce,omitempty"` // only admins can send messages
+	Locked   *bool   `json:"locked,omitempty"`   // only admins can edit the group info
+}
+
+func (GroupUpdatePayload) EventType() string { return EventGroupUpdate }
+
+// NewGroupUpdatePayload converts a group change. It returns false for notifications
+// that change none of the payload's fields.
+func NewGroupUpdatePayload(v *events.GroupInfo) (GroupUpdatePayload, bool) {
+	payload := GroupUpdatePayload{
+		GroupJID:   v.JID.String(),
+		Timestamp:  v.Timestamp.Unix(),
+		Joined:     jidStrings(v.Join),
+		Left:       jidStrings(v.Leave),
+		Promoted:   jidStrings(v.Promote),
+		Demoted:    jidStrings(v.Demote),
+		JoinReason: v.JoinReason,
+	}
+	if v.Sender != nil && !v.Sender.IsEmpty() {
+		payload.ActorJID = v.Sender.String()
+	}
+	if v.Name != nil {
+		payload.Name = &v.Name.Name
+	}
+	if v.Topic != nil {
+		payload.Topic = &v.Topic.Topic
+	}
+	if v.Announce != nil {
+		payload.Announce = &v.Announce.IsAnnounce
+	}
+	if v.Locked != nil {
+		payload.Locked = &v.Locked.IsLocked
+	}
+	changed := payload.Joined != nil || payload.Left != nil || payload.Promoted != nil || payload.Demoted != nil ||
+		payload.Name != nil || payload.Topic != nil || payload.Announce != nil || payload.Locked != nil
+	return payload, changed
+}
+
+func jidStrings(jids []types.JID) []string {
+	if len(jids) == 0 {
+		return nil
+	}
+	strs := make([]string, len(jids))
+	for i, jid := range jids {
+		strs[i] = jid.String()
+	}
+	return strs
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewMessagePayload(t *testing.T) {
+	chat := types.NewJID("15557654321", types.DefaultUserServer)
+	info := types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, Sender: chat}, ID: "M1", Timestamp: time.Unix(1700000000, 0)}
+
+	payload, ok := NewMessagePayload(ParseMessage(&events.Message{Info: info, Message: &waE2E.Message{
+		LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude:  proto.Float64(52.52),
+			DegreesLongitude: proto.Float64(13.40),
+			Name:             proto.String("Office"),
+			Address:          proto.String("Main St 1"),
+		},
+	}}))
+	if !ok || payload.MediaType != "location" || payload.Text != "Office - Main St 1" || payload.Latitude != 52.52 {
+		t.Errorf("expected a location, got %+v", payload)
+	}
+	if payload.ID != "M1" || payload.ChatJID != chat.String() || payload.Timestamp != 1700000000 {
+		t.Errorf("expected the message header, got %+v", payload)
+	}
+
+	if _, ok := NewMessagePayload(ParseMessage(&events.Message{Info: info, Message: &waE2E.Message{
+		ProtocolMessage: &waE2E.ProtocolMessage{},
+	}})); ok {
+		t.Error("expected nothing to show for a protocol message")
+	}
+}
+
+func TestNewReceiptPayload(t *testing.T) {
+	chat := types.NewJID("15557654321", types.DefaultUserServer)
+	receipt := &events.Receipt{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		MessageIDs:    []string{"M1"},
+		Type:          types.ReceiptTypeRead,
+	}
+	if payload, ok := NewReceiptPayload(receipt); !ok || payload.Status != "read" || payload.RecipientJID != chat.String() {
+		t.Errorf("expected a read receipt, got %+v", payload)
+	}
+
+	receipt.Type = types.ReceiptTypeRetry
+	if _, ok := NewReceiptPayload(receipt); ok {
+		t.Error("expected retry receipts to be left out")
+	}
+}
+
+func TestNewGroupUpdatePayload(t *testing.T) {
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	admin := types.NewJID("15551234567", types.DefaultUserServer)
+
+	payload, ok := NewGroupUpdatePayload(&events.GroupInfo{
+		JID:      group,
+		Sender:   &admin,
+		Promote:  []types.JID{admin},
+		Announce: &types.GroupAnnounce{IsAnnounce: false},
+	})
+	if !ok || payload.ActorJID != admin.String() || len(payload.Promoted) != 1 || payload.Announce == nil || *payload.Announce {
+		t.Fatalf("expected the promotion and announce change, got %+v", payload)
+	}
+
+	// Unchanged settings stay out of the JSON, changes to false don't
+	data, _ := json.Marshal(NewEvent(payload))
+	var decoded map[string]map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if _, ok := decoded["payload"]["locked"]; ok {
+		t.Errorf("expected locked to be left out, got %s", data)
+	}
+	if announce, ok := decoded["payload"]["announce"]; !ok || announce != false {
+		t.Errorf("expected announce to be false, got %s", data)
+	}
+
+	if _, ok := NewGroupUpdatePayload(&events.GroupInfo{JID: group, Ephemeral: &types.GroupEphemeral{}}); ok {
+		t.Error("expected no update for a change the payload doesn't cover")
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+)
+
+// WhatsApp's limits on polls
+const (
+	MaxPollQuestionLength = 255
+	MaxPollOptionLength   = 100
+	MinPollOptions        = 2
+	MaxPollOptions        = 12
+)
+
+// ValidatePoll checks that a poll's question and options are usable, returning the
+// trimmed options. Lengths and the number of options are left to the caller.
+func ValidatePoll(question string, options []string) ([]string, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, errors.New("question required")
+	}
+	seen := make(map[string]bool, len(options))
+	trimmed := make([]string, len(options))
+	for i, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, errors.New("poll options can't be empty")
+		}
+		// Votes identify options by a hash of the name, so names must be unique
+		if seen[option] {
+			return nil, errors.New("poll options must be unique")
+		}
+		seen[option] = true
+		trimmed[i] = option
+	}
+	return trimmed, nil
+}
+
+// SelectedPollOptions names the options a vote selects. Votes carry SHA-256 hashes of
+// the option names rather than the names; unknown counts hashes matching none of options.
+func SelectedPollOptions(options []string, hashes [][]byte) (selected []string, unknown int) {
+	byHash := make(map[[sha256.Size]byte]string, len(options))
+	for _, option := range options {
+		byHash[sha256.Sum256([]byte(option))] = option
+	}
+	for _, hash := range hashes {
+		var key [sha256.Size]byte
+		copy(key[:], hash)
+		if name, ok := byHash[key]; ok {
+			selected = append(selected, name)
+		} else {
+			unknown++
+		}
+	}
+	return selected, unknown
+}
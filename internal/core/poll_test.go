@@ -0,0 +1,33 @@
+package core
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestValidatePoll(t *testing.T) {
+	options, err := ValidatePoll("Lunch?", []string{" sushi ", "pizza"})
+	if err != nil || options[0] != "sushi" || options[1] != "pizza" {
+		t.Errorf("expected trimmed options, got %v (%v)", options, err)
+	}
+	for name, options := range map[string][]string{
+		"empty option":     {"sushi", " "},
+		"repeated options": {"sushi", "sushi "},
+	} {
+		if _, err := ValidatePoll("Lunch?", options); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := ValidatePoll(" ", []string{"a", "b"}); err == nil {
+		t.Error("expected an empty question to be refused")
+	}
+}
+
+func TestSelectedPollOptions(t *testing.T) {
+	sushi := sha256.Sum256([]byte("sushi"))
+	other := sha256.Sum256([]byte("tacos"))
+	selected, unknown := SelectedPollOptions([]string{"pizza", "sushi"}, [][]byte{sushi[:], other[:]})
+	if len(selected) != 1 || selected[0] != "sushi" || unknown != 1 {
+		t.Errorf("expected sushi and one unknown hash, got %v and %d", selected, unknown)
+	}
+}
@@ -0,0 +1,34 @@
+// Package core is what the HTTP server, the CLI and the C bridge share: opening the
+// device store and client, reading incoming messages and building outgoing ones. A new
+// message type is added here once instead of in each frontend.
+package core
+
+import (
+	"context"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Logger is the logger the frontends give whatsmeow by default: errors only, to stdout
+func Logger(module string) waLog.Logger {
+	return waLog.Stdout(module, "ERROR", true)
+}
+
+// OpenSQLite opens (creating if needed) a whatsmeow device store in the SQLite file at path
+func OpenSQLite(ctx context.Context, path string, log waLog.Logger) (*sqlstore.Container, error) {
+	return sqlstore.New(ctx, "sqlite3", "file:"+path+"?_foreign_keys=on", log)
+}
+
+// NewClient creates a client for the first device in container, which is a fresh,
+// unpaired one if the store is empty
+func NewClient(ctx context.Context, container *sqlstore.Container, log waLog.Logger) (*whatsmeow.Client, error) {
+	device, err := container.GetFirstDevice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return whatsmeow.NewClient(device, log), nil
+}
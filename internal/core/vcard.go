@@ -0,0 +1,157 @@
+package core
+
+import (
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ContactCard is the structured form of a shared contact's vCard
+type ContactCard struct {
+	Name         string         `json:"name,omitempty"`
+	Organization string         `json:"organization,omitempty"`
+	Phones       []ContactPhone `json:"phones,omitempty"`
+	Emails       []string       `json:"emails,omitempty"`
+}
+
+// ContactPhone is a phone number from a vCard. WhatsApp adds a waid parameter to numbers
+// that have an account, which is turned into a JID that can be messaged directly.
+type ContactPhone struct {
+	Number string `json:"number"`
+	Type   string `json:"type,omitempty"`
+	JID    string `json:"jid,omitempty"`
+}
+
+// ParseVCard extracts the fields consumers care about from vCard 3.0/4.0 text.
+// Unknown properties are ignored; it returns nil if nothing useful was found.
+func ParseVCard(raw string) *ContactCard {
+	card := &ContactCard{}
+	var structuredName string
+
+	for _, line := range unfoldVCardLines(raw) {
+		nameAndParams, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(nameAndParams, ";")
+		name := strings.ToUpper(parts[0])
+		// Apple-style grouping: "item1.TEL;waid=...:+1 555..."
+		if _, after, grouped := strings.Cut(name, "."); grouped {
+			name = after
+		}
+		params := parseVCardParams(parts[1:])
+
+		switch name {
+		case "FN":
+			card.Name = unescapeVCard(value)
+		case "N":
+			structuredName = formatStructuredName(value)
+		case "ORG":
+			var units []string
+			for _, unit := range splitVCardValue(value) {
+				if unit != "" {
+					units = append(units, unit)
+				}
+			}
+			card.Organization = strings.Join(units, ", ")
+		case "TEL":
+			phone := ContactPhone{
+				Number: unescapeVCard(strings.TrimPrefix(value, "tel:")),
+				Type:   strings.ToLower(params["type"]),
+			}
+			if waid := params["waid"]; waid != "" {
+				phone.JID = types.NewJID(waid, types.DefaultUserServer).String()
+			}
+			if phone.Number != "" {
+				card.Phones = append(card.Phones, phone)
+			}
+		case "EMAIL":
+			if email := unescapeVCard(value); email != "" {
+				card.Emails = append(card.Emails, email)
+			}
+		}
+	}
+
+	if card.Name == "" {
+		card.Name = structuredName
+	}
+	if card.Name == "" && card.Organization == "" && len(card.Phones) == 0 && len(card.Emails) == 0 {
+		return nil
+	}
+	return card
+}
+
+// unfoldVCardLines splits vCard text into logical lines, joining folded continuation lines
+func unfoldVCardLines(raw string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseVCardParams handles both "TYPE=CELL" and bare vCard 2.1 style "CELL" parameters.
+// Multiple types are joined with commas.
+func parseVCardParams(raw []string) map[string]string {
+	params := make(map[string]string)
+	for _, p := range raw {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok {
+			key, value = "type", p
+		}
+		key = strings.ToLower(key)
+		value = strings.Trim(value, `"`)
+		if existing := params[key]; existing != "" {
+			value = existing + "," + value
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// formatStructuredName turns "Family;Given;Middle;Prefix;Suffix" into a display name
+func formatStructuredName(value string) string {
+	fields := splitVCardValue(value)
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+	var parts []string
+	for _, f := range []string{fields[3], fields[1], fields[2], fields[0], fields[4]} {
+		if f != "" {
+			parts = append(parts, f)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitVCardValue splits a compound value on unescaped semicolons and unescapes each part
+func splitVCardValue(value string) []string {
+	var fields []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteByte('\\')
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == ';':
+			fields = append(fields, unescapeVCard(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(fields, unescapeVCard(current.String()))
+}
+
+var vcardUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescapeVCard(value string) string {
+	return strings.TrimSpace(vcardUnescaper.Replace(value))
+}
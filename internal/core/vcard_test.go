@@ -0,0 +1,63 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVCard(t *testing.T) {
+	t.Run("WhatsApp contact with waid", func(t *testing.T) {
+		raw := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Doe;Jane;;;\r\nFN:Jane Doe\r\n" +
+			"ORG:Acme Inc.;Engineering\r\n" +
+			"TEL;type=CELL;type=VOICE;waid=14155550123:+1 415-555-0123\r\n" +
+			"TEL;TYPE=WORK:+1 415 555 0000\r\n" +
+			"EMAIL;type=INTERNET:jane@example.com\r\nEND:VCARD"
+
+		card := ParseVCard(raw)
+		want := &ContactCard{
+			Name:         "Jane Doe",
+			Organization: "Acme Inc., Engineering",
+			Phones: []ContactPhone{
+				{Number: "+1 415-555-0123", Type: "cell,voice", JID: "14155550123@s.whatsapp.net"},
+				{Number: "+1 415 555 0000", Type: "work"},
+			},
+			Emails: []string{"jane@example.com"},
+		}
+		if !reflect.DeepEqual(card, want) {
+			t.Errorf("ParseVCard() = %+v, want %+v", card, want)
+		}
+	})
+
+	t.Run("grouped properties and folded lines", func(t *testing.T) {
+		raw := "BEGIN:VCARD\nVERSION:3.0\nFN:Very Long\n  Name\n" +
+			"item1.TEL;waid=447700900123:+44 7700 900123\nitem1.X-ABLabel:Mobile\nEND:VCARD"
+
+		card := ParseVCard(raw)
+		if card == nil || card.Name != "Very Long Name" {
+			t.Fatalf("expected unfolded name, got %+v", card)
+		}
+		if len(card.Phones) != 1 || card.Phones[0].JID != "447700900123@s.whatsapp.net" {
+			t.Errorf("expected grouped TEL with JID, got %+v", card.Phones)
+		}
+	})
+
+	t.Run("falls back to structured name", func(t *testing.T) {
+		card := ParseVCard("BEGIN:VCARD\nN:Smith;John;Q;Dr.;Jr.\nEND:VCARD")
+		if card == nil || card.Name != "Dr. John Q Smith Jr." {
+			t.Errorf("expected structured name, got %+v", card)
+		}
+	})
+
+	t.Run("unescapes values", func(t *testing.T) {
+		card := ParseVCard(`FN:Doe\, Jane` + "\n" + `ORG:R\;D Labs`)
+		if card == nil || card.Name != "Doe, Jane" || card.Organization != "R;D Labs" {
+			t.Errorf("unexpected unescaping: %+v", card)
+		}
+	})
+
+	t.Run("returns nil for empty card", func(t *testing.T) {
+		if card := ParseVCard("BEGIN:VCARD\nVERSION:3.0\nEND:VCARD"); card != nil {
+			t.Errorf("expected nil, got %+v", card)
+		}
+	})
+}
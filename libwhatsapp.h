@@ -25,6 +25,13 @@ extern const char *_GoStringPtr(_GoString_ s);
 
 #include <stdlib.h>
 
+// wa_log_callback receives every log line: level is 0 (debug) to 3 (error)
+typedef void (*wa_log_callback)(int level, const char *module, const char *message);
+
+static inline void wa_call_log_callback(wa_log_callback cb, int level, const char *module, const char *message) {
+	cb(level, module, message);
+}
+
 #line 1 "cgo-generated-wrapper"
 
 
@@ -93,10 +100,15 @@ extern char* WhatsAppGetQRCode(int timeoutMs);
 extern int WhatsAppIsConnected(void);
 extern int WhatsAppIsLoggedIn(void);
 extern char* WhatsAppGetChats(void);
+extern char* WhatsAppGetContacts(void);
+extern char* WhatsAppGetMessages(char* chatJID, int limit);
 extern char* WhatsAppSendMessage(char* jidStr, char* text);
+extern char* WhatsAppSendTyping(char* jidStr, int on);
+extern char* WhatsAppMarkRead(char* jidStr, char* messageIDsJSON);
 extern void WhatsAppDisconnect(void);
 extern void WhatsAppFreeString(char* str);
 extern void WhatsAppSetMessageCallback(void* callback);
+extern char* WhatsAppSetLogCallback(wa_log_callback callback, char* minLevel);
 
 #ifdef __cplusplus
 }
@@ -3,9 +3,13 @@ package main
 import (
 	"bufio"
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
+	"mime"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,16 +17,13 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/mdp/qrterminal/v3"
+	"github.com/jo-inc/wa_meow/internal/core"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/mdp/qrterminal/v3"
 	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/proto/waWeb"
-	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
-	"google.golang.org/protobuf/proto"
 )
 
 type App struct {
@@ -30,6 +31,9 @@ type App struct {
 	currentChat  types.JID
 	chats        []ChatInfo
 	messageStore sync.Map // map[string][]StoredMessage - messages by chat JID
+	mediaDir     string   // where media arriving in the open chat is saved; empty to not save it
+	db           *sql.DB  // the CLI's own settings, kept next to the session in whatsapp.db
+	aliases      map[string]types.JID
 }
 
 type StoredMessage struct {
@@ -38,6 +42,92 @@ type StoredMessage struct {
 	Text      string
 	Timestamp time.Time
 	IsFromMe  bool
+	Status    MessageStatus     // How far our own messages got
+	Reactions map[string]string // Emoji by the JID of who reacted
+
+	// Set on replies: the quoted message's ID and sender JID, and the quote's text as
+	// embedded in the reply, for when the original isn't stored
+	QuotedID     string
+	QuotedSender string
+	QuotedText   string
+
+	MediaPath string // where the message's media was saved, if it was
+
+	// Set on polls: the option names in order, and each voter's current choices by JID
+	PollOptions []string
+	PollVotes   map[string][]string
+}
+
+// MessageStatus is the furthest receipt seen for a message we sent, like the phone's ticks
+type MessageStatus int
+
+const (
+	StatusNone MessageStatus = iota
+	StatusSent
+	StatusDelivered
+	StatusRead
+	StatusPlayed
+)
+
+// receiptStatuses maps the receipts recipients send to the status they mean.
+// In groups a message counts as read once anyone has read it.
+var receiptStatuses = map[types.ReceiptType]MessageStatus{
+	types.ReceiptTypeDelivered: StatusDelivered,
+	types.ReceiptTypeRead:      StatusRead,
+	types.ReceiptTypePlayed:    StatusPlayed,
+}
+
+// historyStatuses maps the status history sync reports for our own messages
+var historyStatuses = map[waWeb.WebMessageInfo_Status]MessageStatus{
+	waWeb.WebMessageInfo_SERVER_ACK:   StatusSent,
+	waWeb.WebMessageInfo_DELIVERY_ACK: StatusDelivered,
+	waWeb.WebMessageInfo_READ:         StatusRead,
+	waWeb.WebMessageInfo_PLAYED:       StatusPlayed,
+}
+
+func (s MessageStatus) marker() string {
+	switch s {
+	case StatusSent:
+		return "✓"
+	case StatusDelivered:
+		return "✓✓"
+	case StatusRead:
+		return "✓✓ read"
+	case StatusPlayed:
+		return "✓✓ played"
+	}
+	return ""
+}
+
+// markers summarizes a message's receipt status and reactions, e.g. " ✓✓ read [👍 2 ❤️]"
+func (m StoredMessage) markers() string {
+	var out string
+	if m.IsFromMe && m.Status != StatusNone {
+		out += " " + m.Status.marker()
+	}
+	if len(m.Reactions) == 0 {
+		return out
+	}
+	counts := make(map[string]int)
+	for _, emoji := range m.Reactions {
+		counts[emoji]++
+	}
+	emojis := make([]string, 0, len(counts))
+	for emoji := range counts {
+		emojis = append(emojis, emoji)
+	}
+	sort.Slice(emojis, func(i, j int) bool {
+		if counts[emojis[i]] != counts[emojis[j]] {
+			return counts[emojis[i]] > counts[emojis[j]]
+		}
+		return emojis[i] < emojis[j]
+	})
+	for i, emoji := range emojis {
+		if counts[emoji] > 1 {
+			emojis[i] = fmt.Sprintf("%s %d", emoji, counts[emoji])
+		}
+	}
+	return out + " [" + strings.Join(emojis, " ") + "]"
 }
 
 type ChatInfo struct {
@@ -47,22 +137,32 @@ type ChatInfo struct {
 }
 
 func main() {
+	downloadMedia := flag.Bool("download-media", false, "save media arriving in the open chat to -media-dir")
+	mediaDir := flag.String("media-dir", defaultMediaDir(), "where -download-media saves files, in a folder per chat")
+	flag.Parse()
+
 	ctx := context.Background()
-	dbLog := waLog.Stdout("Database", "ERROR", true)
-	container, err := sqlstore.New(ctx, "sqlite3", "file:whatsapp.db?_foreign_keys=on", dbLog)
+	container, err := core.OpenSQLite(ctx, "whatsapp.db", core.Logger("Database"))
 	if err != nil {
 		panic(err)
 	}
 
-	deviceStore, err := container.GetFirstDevice(ctx)
+	client, err := core.NewClient(ctx, container, core.Logger("Client"))
 	if err != nil {
 		panic(err)
 	}
 
-	clientLog := waLog.Stdout("Client", "ERROR", true)
-	client := whatsmeow.NewClient(deviceStore, clientLog)
-
 	app := &App{client: client}
+	if *downloadMedia {
+		app.mediaDir = *mediaDir
+	}
+	app.db, err = sql.Open("sqlite3", "file:whatsapp.db?_foreign_keys=on")
+	if err != nil {
+		panic(err)
+	}
+	if err := app.loadAliases(); err != nil {
+		fmt.Printf("⚠️ Couldn't load chat aliases: %v\n", err)
+	}
 
 	client.AddEventHandler(app.eventHandler)
 
@@ -102,27 +202,45 @@ func main() {
 func (a *App) eventHandler(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Message:
-		sender := v.Info.Sender.User
-		if v.Info.PushName != "" {
-			sender = v.Info.PushName
+		parsed := core.ParseMessage(v)
+		sender := parsed.SenderName()
+
+		if reaction := v.Message.GetReactionMessage(); reaction != nil {
+			a.handleReaction(v.Info.Chat, v.Info.Sender.ToNonAD().String(), sender, reaction.GetKey().GetID(), reaction.GetText())
+			return
+		}
+		if v.Message.GetPollUpdateMessage() != nil {
+			a.handlePollVote(v, sender)
+			return
 		}
 
-		text := ""
-		if v.Message.Conversation != nil {
-			text = *v.Message.Conversation
-		} else if v.Message.ExtendedTextMessage != nil {
-			text = *v.Message.ExtendedTextMessage.Text
+		text := parsed.Text
+		media := mediaOf(parsed)
+		if text == "" && media != nil {
+			text = media.label()
+		}
+		poll := parsed.Poll
+		if text == "" && poll != nil {
+			text = "📊 " + poll.GetName()
 		}
 
 		if text != "" {
+			msg := StoredMessage{
+				ID:           v.Info.ID,
+				Sender:       sender,
+				Text:         text,
+				Timestamp:    v.Info.Timestamp,
+				IsFromMe:     v.Info.IsFromMe,
+				QuotedID:     parsed.QuotedID,
+				QuotedSender: parsed.QuotedSender,
+				QuotedText:   parsed.QuotedText,
+			}
+			if poll != nil {
+				msg.PollOptions = core.PollOptionNames(poll)
+			}
+
 			// Store the message
-			a.storeMessage(v.Info.Chat.String(), StoredMessage{
-				ID:        v.Info.ID,
-				Sender:    sender,
-				Text:      text,
-				Timestamp: v.Info.Timestamp,
-				IsFromMe:  v.Info.IsFromMe,
-			})
+			a.storeMessage(v.Info.Chat.String(), msg)
 
 			// Display if in current chat
 			if v.Info.Chat == a.currentChat {
@@ -130,10 +248,23 @@ func (a *App) eventHandler(evt interface{}) {
 				if v.Info.IsFromMe {
 					direction = "📤"
 				}
-				fmt.Printf("\n%s [%s] %s: %s\n> ", direction, v.Info.Timestamp.Format("15:04"), sender, text)
+				fmt.Println()
+				if quote := a.quoteLine(v.Info.Chat.String(), msg); quote != "" {
+					fmt.Println(quote)
+				}
+				if poll != nil {
+					text += "\n" + msg.pollResults()
+				}
+				fmt.Printf("%s [%s] %s: %s\n> ", direction, v.Info.Timestamp.Format("15:04"), sender, text)
+				if media != nil && a.mediaDir != "" {
+					go a.autoDownload(v.Info.Chat, msg, media)
+				}
 			}
 		}
 
+	case *events.Receipt:
+		a.handleReceipt(v)
+
 	case *events.HistorySync:
 		a.handleHistorySync(v)
 
@@ -155,6 +286,112 @@ func (a *App) storeMessage(chatJID string, msg StoredMessage) {
 	a.messageStore.Store(chatJID, messages)
 }
 
+// findMessage looks up a stored message by chat and ID
+func (a *App) findMessage(chatJID, id string) (StoredMessage, bool) {
+	existing, ok := a.messageStore.Load(chatJID)
+	if !ok {
+		return StoredMessage{}, false
+	}
+	for _, msg := range existing.([]StoredMessage) {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return StoredMessage{}, false
+}
+
+// quoteLine renders the "↪ replying to" line shown above a reply, taking the sender
+// and text from the stored original when there is one
+func (a *App) quoteLine(chatJID string, msg StoredMessage) string {
+	if msg.QuotedID == "" {
+		return ""
+	}
+	sender, text := msg.QuotedSender, msg.QuotedText
+	if jid, err := types.ParseJID(sender); err == nil && jid.User != "" {
+		sender = jid.User
+	}
+	if original, ok := a.findMessage(chatJID, msg.QuotedID); ok {
+		sender, text = original.Sender, original.Text
+	}
+	if sender == "" {
+		sender = "unknown"
+	}
+	if text == "" {
+		text = "(message not available)"
+	}
+	if len(text) > 60 {
+		text = text[:57] + "..."
+	}
+	return fmt.Sprintf("   ↪ replying to %s: %s", sender, text)
+}
+
+// updateMessage applies fn to a copy of a stored message and stores the copy.
+// It returns false if the message isn't stored.
+func (a *App) updateMessage(chatJID, id string, fn func(msg *StoredMessage)) bool {
+	existing, ok := a.messageStore.Load(chatJID)
+	if !ok {
+		return false
+	}
+	messages := existing.([]StoredMessage)
+	for i := range messages {
+		if messages[i].ID != id {
+			continue
+		}
+		updated := make([]StoredMessage, len(messages))
+		copy(updated, messages)
+		fn(&updated[i])
+		a.messageStore.Store(chatJID, updated)
+		return true
+	}
+	return false
+}
+
+// handleReaction records a reaction on a stored message; an empty emoji removes it
+func (a *App) handleReaction(chat types.JID, reactorJID, reactor, targetID, emoji string) {
+	var target StoredMessage
+	found := a.updateMessage(chat.String(), targetID, func(msg *StoredMessage) {
+		reactions := make(map[string]string, len(msg.Reactions)+1)
+		for jid, e := range msg.Reactions {
+			reactions[jid] = e
+		}
+		if emoji == "" {
+			delete(reactions, reactorJID)
+		} else {
+			reactions[reactorJID] = emoji
+		}
+		msg.Reactions = reactions
+		target = *msg
+	})
+	if !found || chat != a.currentChat {
+		return
+	}
+
+	text := target.Text
+	if len(text) > 40 {
+		text = text[:37] + "..."
+	}
+	if emoji == "" {
+		fmt.Printf("\n%s removed their reaction to \"%s\"\n> ", reactor, text)
+	} else {
+		fmt.Printf("\n%s %s reacted to \"%s\"\n> ", emoji, reactor, text)
+	}
+}
+
+// handleReceipt moves our own messages' status forward as recipients get and read them
+func (a *App) handleReceipt(evt *events.Receipt) {
+	status, ok := receiptStatuses[evt.Type]
+	if !ok || evt.IsFromMe {
+		return
+	}
+	for _, id := range evt.MessageIDs {
+		a.updateMessage(evt.Chat.String(), id, func(msg *StoredMessage) {
+			if msg.IsFromMe && status > msg.Status {
+				msg.Status = status
+			}
+		})
+	}
+}
+
 func (a *App) handleHistorySync(evt *events.HistorySync) {
 	syncType := evt.Data.GetSyncType().String()
 	conversations := evt.Data.GetConversations()
@@ -190,29 +427,313 @@ func (a *App) parseHistoryMessage(chatJID types.JID, webMsg *waWeb.WebMessageInf
 		return nil
 	}
 
-	text := ""
-	if parsedEvt.Message.Conversation != nil {
-		text = *parsedEvt.Message.Conversation
-	} else if parsedEvt.Message.ExtendedTextMessage != nil && parsedEvt.Message.ExtendedTextMessage.Text != nil {
-		text = *parsedEvt.Message.ExtendedTextMessage.Text
+	parsed := core.ParseMessage(parsedEvt)
+	text := parsed.Text
+	poll := parsed.Poll
+	if text == "" && poll != nil {
+		text = "📊 " + poll.GetName()
 	}
 
 	if text == "" {
 		return nil
 	}
 
-	sender := parsedEvt.Info.Sender.User
-	if parsedEvt.Info.PushName != "" {
-		sender = parsedEvt.Info.PushName
+	msg := &StoredMessage{
+		ID:           parsedEvt.Info.ID,
+		Sender:       parsed.SenderName(),
+		Text:         text,
+		Timestamp:    parsedEvt.Info.Timestamp,
+		IsFromMe:     parsedEvt.Info.IsFromMe,
+		QuotedID:     parsed.QuotedID,
+		QuotedSender: parsed.QuotedSender,
+		QuotedText:   parsed.QuotedText,
+	}
+	if poll != nil {
+		msg.PollOptions = core.PollOptionNames(poll)
+		for _, update := range webMsg.GetPollUpdates() {
+			voter := update.GetPollUpdateMessageKey().GetParticipant()
+			if update.GetPollUpdateMessageKey().GetFromMe() {
+				voter = "me"
+			} else if voter == "" {
+				voter = update.GetPollUpdateMessageKey().GetRemoteJID()
+			}
+			msg.setVote(voter, update.GetVote().GetSelectedOptions())
+		}
 	}
+	if msg.IsFromMe {
+		msg.Status = historyStatuses[webMsg.GetStatus()]
+	}
+	for _, reaction := range webMsg.GetReactions() {
+		if reaction.GetText() == "" {
+			continue
+		}
+		reactor := reaction.GetKey().GetParticipant()
+		if reaction.GetKey().GetFromMe() {
+			reactor = "me"
+		} else if reactor == "" {
+			reactor = reaction.GetKey().GetRemoteJID()
+		}
+		if msg.Reactions == nil {
+			msg.Reactions = make(map[string]string)
+		}
+		msg.Reactions[reactor] = reaction.GetText()
+	}
+	return msg
+}
 
-	return &StoredMessage{
-		ID:        parsedEvt.Info.ID,
-		Sender:    sender,
-		Text:      text,
-		Timestamp: parsedEvt.Info.Timestamp,
-		IsFromMe:  parsedEvt.Info.IsFromMe,
+// setVote records a voter's choices on a poll. Votes carry SHA-256 hashes of the option
+// names rather than the names; an empty vote withdraws it.
+func (m *StoredMessage) setVote(voter string, hashes [][]byte) {
+	selected, _ := core.SelectedPollOptions(m.PollOptions, hashes)
+
+	votes := make(map[string][]string, len(m.PollVotes)+1)
+	for jid, options := range m.PollVotes {
+		votes[jid] = options
 	}
+	if len(selected) == 0 {
+		delete(votes, voter)
+	} else {
+		votes[voter] = selected
+	}
+	m.PollVotes = votes
+}
+
+// pollResults tallies a poll's votes per option, e.g. "   ▸ Yes 2 · No 1 · Maybe 0"
+func (m StoredMessage) pollResults() string {
+	counts := make(map[string]int, len(m.PollOptions))
+	for _, options := range m.PollVotes {
+		for _, option := range options {
+			counts[option]++
+		}
+	}
+	results := make([]string, len(m.PollOptions))
+	for i, option := range m.PollOptions {
+		results[i] = fmt.Sprintf("%s %d", option, counts[option])
+	}
+	return "   ▸ " + strings.Join(results, " · ")
+}
+
+// handlePollVote decrypts a vote and updates the poll's tally, showing it if the chat is
+// open. Votes on polls that aren't stored can't be named and are dropped.
+func (a *App) handlePollVote(evt *events.Message, sender string) {
+	vote, err := a.client.DecryptPollVote(context.Background(), evt)
+	if err != nil {
+		return
+	}
+	voter := evt.Info.Sender.ToNonAD().String()
+	if evt.Info.IsFromMe {
+		voter = "me"
+	}
+
+	var poll StoredMessage
+	pollID := evt.Message.GetPollUpdateMessage().GetPollCreationMessageKey().GetID()
+	found := a.updateMessage(evt.Info.Chat.String(), pollID, func(msg *StoredMessage) {
+		msg.setVote(voter, vote.GetSelectedOptions())
+		poll = *msg
+	})
+	if !found || evt.Info.Chat != a.currentChat {
+		return
+	}
+
+	question := strings.TrimPrefix(poll.Text, "📊 ")
+	if len(question) > 40 {
+		question = question[:37] + "..."
+	}
+	fmt.Printf("\n📊 %s voted on \"%s\"\n%s\n> ", sender, question, poll.pollResults())
+}
+
+// sendPoll sends "question | option | option ..." as a single-choice poll
+func (a *App) sendPoll(args string) {
+	parts := strings.Split(args, "|")
+	if len(parts) < 1+core.MinPollOptions {
+		fmt.Println("Usage: poll <question> | <option> | <option> ...")
+		return
+	}
+	if a.currentChat.IsEmpty() {
+		fmt.Println("No chat open. Use 'open <number>' first.")
+		return
+	}
+
+	question := strings.TrimSpace(parts[0])
+	options, err := core.ValidatePoll(question, parts[1:])
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	if len(options) > core.MaxPollOptions {
+		fmt.Printf("Polls can have at most %d options.\n", core.MaxPollOptions)
+		return
+	}
+	if len([]rune(question)) > core.MaxPollQuestionLength {
+		fmt.Printf("The question can be at most %d characters.\n", core.MaxPollQuestionLength)
+		return
+	}
+	for _, option := range options {
+		if len([]rune(option)) > core.MaxPollOptionLength {
+			fmt.Printf("Options can be at most %d characters.\n", core.MaxPollOptionLength)
+			return
+		}
+	}
+
+	msg := a.client.BuildPollCreation(question, options, 1)
+	resp, err := a.client.SendMessage(context.Background(), a.currentChat, msg)
+	if err != nil {
+		fmt.Printf("❌ Error sending poll: %v\n", err)
+		return
+	}
+
+	a.storeMessage(a.currentChat.String(), StoredMessage{
+		ID:          resp.ID,
+		Sender:      "You",
+		Text:        "📊 " + question,
+		Timestamp:   resp.Timestamp,
+		IsFromMe:    true,
+		Status:      StatusSent,
+		PollOptions: options,
+	})
+
+	fmt.Printf("✅ Poll sent! (ID: %s)\n", resp.ID)
+}
+
+// incomingMedia is the downloadable attachment of a received message
+type incomingMedia struct {
+	*core.Media
+}
+
+func mediaOf(msg core.Message) *incomingMedia {
+	if msg.Media == nil {
+		return nil
+	}
+	return &incomingMedia{msg.Media}
+}
+
+// label is how a media message is shown in place of text, e.g. "[image] caption"
+func (m *incomingMedia) label() string {
+	kind := m.Kind
+	if kind == "ptt" {
+		kind = "voice note"
+	}
+	label := "[" + kind + "]"
+	if m.FileName != "" {
+		label += " " + m.FileName
+	}
+	if m.Caption != "" {
+		label += " " + m.Caption
+	}
+	return label
+}
+
+// mediaPrefixes start saved file names the way the phone names them, e.g. IMG-20260102-...
+var mediaPrefixes = map[string]string{
+	"image":    "IMG",
+	"video":    "VID",
+	"audio":    "AUD",
+	"document": "DOC",
+	"sticker":  "STK",
+	"ptt":      "PTT",
+}
+
+// mediaExtensions covers the usual WhatsApp types, where mime's choice is odd or missing
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"audio/ogg":       ".ogg",
+	"audio/mpeg":      ".mp3",
+	"audio/mp4":       ".m4a",
+	"application/pdf": ".pdf",
+}
+
+// fileName names a downloaded file: documents keep their own name, everything else gets
+// the kind, date and message ID, e.g. IMG-20260102-150405-3EB0C0FFEE.jpg
+func (m *incomingMedia) fileName(msg StoredMessage) string {
+	if m.FileName != "" {
+		return safeFileName(m.FileName)
+	}
+	mimeType, _, _ := strings.Cut(m.MimeType, ";")
+	ext, ok := mediaExtensions[mimeType]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		} else {
+			ext = ".bin"
+		}
+	}
+	id := msg.ID
+	if len(id) > 10 {
+		id = id[:10]
+	}
+	return fmt.Sprintf("%s-%s-%s%s", mediaPrefixes[m.Kind], msg.Timestamp.Format("20060102-150405"), safeFileName(id), ext)
+}
+
+// safeFileName replaces characters that aren't allowed in file names on common systems
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// uniquePath adds " (2)", " (3)", ... before the extension until path is unused
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func defaultMediaDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "WhatsAppMedia"
+	}
+	return filepath.Join(home, "WhatsAppMedia")
+}
+
+// chatName is the chat's name from the chat list, or its number if it isn't listed
+func (a *App) chatName(chat types.JID) string {
+	for _, c := range a.chats {
+		if c.JID == chat {
+			return c.Name
+		}
+	}
+	return chat.User
+}
+
+// autoDownload saves a message's media into the chat's folder and prints where it went
+func (a *App) autoDownload(chat types.JID, msg StoredMessage, media *incomingMedia) {
+	data, err := a.client.Download(context.Background(), media.File)
+	if err != nil {
+		fmt.Printf("\n❌ Failed to download %s: %v\n> ", media.Kind, err)
+		return
+	}
+	dir := filepath.Join(a.mediaDir, safeFileName(a.chatName(chat)))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Printf("\n❌ Failed to save %s: %v\n> ", media.Kind, err)
+		return
+	}
+	path := uniquePath(filepath.Join(dir, media.fileName(msg)))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fmt.Printf("\n❌ Failed to save %s: %v\n> ", media.Kind, err)
+		return
+	}
+
+	a.updateMessage(chat.String(), msg.ID, func(stored *StoredMessage) {
+		stored.MediaPath = path
+	})
+	fmt.Printf("\n   💾 %s\n> ", path)
 }
 
 func (a *App) runREPL() {
@@ -241,10 +762,16 @@ func (a *App) runREPL() {
 			a.searchChats(args)
 		case "open":
 			a.openChat(args)
+		case "alias":
+			a.setAlias(args)
+		case "unalias":
+			a.removeAlias(args)
 		case "messages", "msgs":
 			a.showMessages()
 		case "send":
 			a.sendMessage(args)
+		case "poll":
+			a.sendPoll(args)
 		case "status":
 			a.showStatus()
 		case "quit", "exit":
@@ -262,10 +789,17 @@ func (a *App) showHelp() {
   chats / list      - List all chats
   search <query>    - Search chats by name
   open <number>     - Open chat by number from list
+  open <alias>      - Open chat by alias
+  alias [name n]    - List aliases, or name chat n from the list
+  unalias <name>    - Remove an alias
   messages / msgs   - Show messages in current chat
   send <message>    - Send message to current chat
+  poll q | a | b    - Send a poll with question q and options a, b, ...
   status            - Show connection status
   quit / exit       - Exit the program
+
+Start with -download-media to save photos, videos, voice notes and documents
+arriving in the open chat to ~/WhatsAppMedia/<chat>/ (see -media-dir).
 `)
 }
 
@@ -357,7 +891,14 @@ func (a *App) searchChats(query string) {
 
 func (a *App) openChat(args string) {
 	if args == "" {
-		fmt.Println("Usage: open <number>")
+		fmt.Println("Usage: open <number|alias>")
+		return
+	}
+
+	if jid, ok := a.aliases[strings.ToLower(args)]; ok {
+		a.currentChat = jid
+		fmt.Printf("\n✅ Opened chat: %s\n", a.chatName(jid))
+		a.showMessages()
 		return
 	}
 
@@ -380,6 +921,103 @@ func (a *App) openChat(args string) {
 	a.showMessages()
 }
 
+const aliasSchema = `CREATE TABLE IF NOT EXISTS cli_aliases (
+	name TEXT PRIMARY KEY,
+	jid  TEXT NOT NULL
+)`
+
+// loadAliases reads the saved chat aliases
+func (a *App) loadAliases() error {
+	a.aliases = make(map[string]types.JID)
+	if _, err := a.db.Exec(aliasSchema); err != nil {
+		return err
+	}
+	rows, err := a.db.Query(`SELECT name, jid FROM cli_aliases`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
+			return err
+		}
+		jid, err := types.ParseJID(raw)
+		if err != nil {
+			continue
+		}
+		a.aliases[name] = jid
+	}
+	return rows.Err()
+}
+
+// setAlias names a chat from the list, e.g. "alias work 3", so "open work" finds it after
+// restarts. Without arguments it lists the aliases.
+func (a *App) setAlias(args string) {
+	if args == "" {
+		a.listAliases()
+		return
+	}
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		fmt.Println("Usage: alias <name> <number>")
+		return
+	}
+	name := strings.ToLower(fields[0])
+	if _, err := strconv.Atoi(name); err == nil {
+		fmt.Println("Aliases can't be numbers; those open chats from the list.")
+		return
+	}
+	if len(a.chats) == 0 {
+		fmt.Println("No chats loaded. Run 'chats' first.")
+		return
+	}
+	num, err := strconv.Atoi(fields[1])
+	if err != nil || num < 1 || num > len(a.chats) {
+		fmt.Printf("Invalid chat number. Use 1-%d\n", len(a.chats))
+		return
+	}
+
+	chat := a.chats[num-1]
+	if _, err := a.db.Exec(`INSERT OR REPLACE INTO cli_aliases (name, jid) VALUES (?, ?)`, name, chat.JID.String()); err != nil {
+		fmt.Printf("❌ Error saving alias: %v\n", err)
+		return
+	}
+	a.aliases[name] = chat.JID
+	fmt.Printf("✅ '%s' now opens %s\n", name, chat.Name)
+}
+
+func (a *App) removeAlias(name string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := a.aliases[name]; !ok {
+		fmt.Println("Usage: unalias <name> (see 'alias' for the list)")
+		return
+	}
+	if _, err := a.db.Exec(`DELETE FROM cli_aliases WHERE name = ?`, name); err != nil {
+		fmt.Printf("❌ Error removing alias: %v\n", err)
+		return
+	}
+	delete(a.aliases, name)
+	fmt.Printf("✅ Removed alias '%s'\n", name)
+}
+
+func (a *App) listAliases() {
+	if len(a.aliases) == 0 {
+		fmt.Println("No aliases yet. Use 'alias <name> <number>' after 'chats'.")
+		return
+	}
+	names := make([]string, 0, len(a.aliases))
+	for name := range a.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("\n🔖 Aliases:")
+	for _, name := range names {
+		fmt.Printf("  %-12s %s (%s)\n", name, a.chatName(a.aliases[name]), a.aliases[name].User)
+	}
+	fmt.Println()
+}
+
 func (a *App) showMessages() {
 	if a.currentChat.IsEmpty() {
 		fmt.Println("No chat open. Use 'open <number>' first.")
@@ -426,7 +1064,16 @@ func (a *App) showMessages() {
 		if len(text) > 80 {
 			text = text[:77] + "..."
 		}
-		fmt.Printf("%s [%s] %s: %s\n", direction, msg.Timestamp.Format("Jan 02 15:04"), msg.Sender, text)
+		if msg.MediaPath != "" {
+			text += " 💾 " + msg.MediaPath
+		}
+		if quote := a.quoteLine(chatJID, msg); quote != "" {
+			fmt.Println(quote)
+		}
+		fmt.Printf("%s [%s] %s: %s%s\n", direction, msg.Timestamp.Format("Jan 02 15:04"), msg.Sender, text, msg.markers())
+		if msg.PollOptions != nil {
+			fmt.Println(msg.pollResults())
+		}
 	}
 	fmt.Println("────────────────────────────────────────")
 	fmt.Println()
@@ -443,16 +1090,22 @@ func (a *App) sendMessage(text string) {
 		return
 	}
 
-	msg := &waE2E.Message{
-		Conversation: proto.String(text),
-	}
-
-	resp, err := a.client.SendMessage(context.Background(), a.currentChat, msg)
+	resp, err := a.client.SendMessage(context.Background(), a.currentChat, core.TextMessage(text))
 	if err != nil {
 		fmt.Printf("❌ Error sending message: %v\n", err)
 		return
 	}
 
+	// Keep our own message so receipts and reactions can be shown on it
+	a.storeMessage(a.currentChat.String(), StoredMessage{
+		ID:        resp.ID,
+		Sender:    "You",
+		Text:      text,
+		Timestamp: resp.Timestamp,
+		IsFromMe:  true,
+		Status:    StatusSent,
+	})
+
 	fmt.Printf("✅ Message sent! (ID: %s, Timestamp: %s)\n", resp.ID, resp.Timestamp.Format("15:04:05"))
 }
 